@@ -0,0 +1,258 @@
+// Package audit detects operations that are applied more than once during a
+// restore, for example when a resumed or retried file replays lines that were
+// already written. Duplicate applies are harmless for idempotent writes but show
+// how much work a crash cost, and a high count points at checkpointing problems.
+package audit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// maxDuplicateSamples caps how many duplicate operations are kept for reporting.
+const maxDuplicateSamples = 10
+
+// digestSize is the size of one digest in the on-disk log.
+const digestSize = 16
+
+// digest identifies one applied operation: its table, primary key and write
+// timestamp.
+type digest [digestSize]byte
+
+// halves returns the digest as two 64-bit hashes for the Bloom filter.
+func (d digest) halves() (uint64, uint64) {
+	return binary.LittleEndian.Uint64(d[:8]), binary.LittleEndian.Uint64(d[8:]) | 1
+}
+
+// operationKey returns the attributes identifying op's item. FULL exports carry no
+// separate keys, so the scalar attributes of the image stand in for them.
+func operationKey(op itemimage.Operation) string {
+	switch {
+	case len(op.Keys) > 0:
+		return itemimage.KeyFingerprint(op.Keys)
+	case op.NewImage != nil:
+		return itemimage.KeyFingerprint(op.NewImage)
+	default:
+		return itemimage.KeyFingerprint(op.OldImage)
+	}
+}
+
+// digestOf hashes table and the key and WriteTimestampMicros of op, so the same
+// operation fanned out to several tables is recorded once per table.
+func digestOf(table string, op itemimage.Operation) digest {
+	key := operationKey(op)
+	buf := make([]byte, 0, len(table)+1+len(key)+8)
+	buf = append(buf, table...)
+	buf = append(buf, 0)
+	buf = append(buf, key...)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(op.WriteTimestampMicros))
+	sum := sha256.Sum256(buf)
+	var d digest
+	copy(d[:], sum[:digestSize])
+	return d
+}
+
+// describe returns a readable table, key and timestamp for duplicate samples.
+func describe(table string, op itemimage.Operation) string {
+	key := strings.TrimSuffix(strings.ReplaceAll(operationKey(op), "\x00", " "), " ")
+	return fmt.Sprintf("%s: %s @%d", table, key, op.WriteTimestampMicros)
+}
+
+// DuplicateAuditor records a digest of every applied operation and counts those
+// seen before. Digests are held in a Bloom filter and appended to a local log
+// file, which is reloaded on the next run so duplicates across a crash and resume
+// are detected. Because the filter is probabilistic, a small fraction of reported
+// duplicates (about one in a million at the expected capacity) may be false.
+// Example:
+//
+//	auditor := audit.NewDuplicateAuditor("restore-001.digests")
+//	if err := auditor.Open(summary.ItemCount); err != nil {
+//	    return err
+//	}
+//	defer auditor.Close()
+//	w := audit.NewWriter(ddbWriter, auditor, "orders")
+type DuplicateAuditor struct {
+	filter     *bloomFilter
+	file       *os.File
+	log        *bufio.Writer
+	path       string
+	samples    []string // First maxDuplicateSamples duplicate operations
+	applied    int64
+	duplicates int64
+	mu         sync.Mutex
+}
+
+// NewDuplicateAuditor creates an auditor logging digests to path. Call Open before
+// recording operations.
+func NewDuplicateAuditor(path string) *DuplicateAuditor {
+	return &DuplicateAuditor{path: path}
+}
+
+// Open sizes the filter for expectedItems new operations plus any digests already
+// in the log, and loads those digests. A partial digest left by a crash is dropped.
+func (a *DuplicateAuditor) Open(expectedItems int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file != nil {
+		return fmt.Errorf("audit log %s is already open", a.path)
+	}
+
+	f, err := os.OpenFile(a.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	existing := info.Size() / digestSize
+	if err := f.Truncate(existing * digestSize); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to truncate audit log: %w", err)
+	}
+
+	filter := newBloomFilter(expectedItems + existing)
+	r := bufio.NewReader(f)
+	var d digest
+	for {
+		if _, err := io.ReadFull(r, d[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			_ = f.Close()
+			return fmt.Errorf("failed to read audit log: %w", err)
+		}
+		filter.testAndAdd(d)
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to seek audit log: %w", err)
+	}
+
+	a.filter = filter
+	a.file = f
+	a.log = bufio.NewWriterSize(f, 64<<10)
+	return nil
+}
+
+// Record logs op as applied to table and reports whether it was applied to
+// table before.
+func (a *DuplicateAuditor) Record(table string, op itemimage.Operation) (bool, error) {
+	d := digestOf(table, op)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return false, fmt.Errorf("audit log %s is not open", a.path)
+	}
+	a.applied++
+	duplicate := a.filter.testAndAdd(d)
+	if duplicate {
+		a.duplicates++
+		if len(a.samples) < maxDuplicateSamples {
+			a.samples = append(a.samples, describe(table, op))
+		}
+	}
+	if _, err := a.log.Write(d[:]); err != nil {
+		return duplicate, fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return duplicate, nil
+}
+
+// Flush writes buffered digests to the log file.
+func (a *DuplicateAuditor) Flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.log == nil {
+		return nil
+	}
+	if err := a.log.Flush(); err != nil {
+		return fmt.Errorf("failed to flush audit log: %w", err)
+	}
+	return nil
+}
+
+// Close flushes and closes the log file.
+func (a *DuplicateAuditor) Close() error {
+	if err := a.Flush(); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+// Applied returns the number of operations recorded in this run.
+func (a *DuplicateAuditor) Applied() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.applied
+}
+
+// Duplicates returns the number of operations recorded that had been applied
+// before, and up to ten of them as examples.
+func (a *DuplicateAuditor) Duplicates() (int64, []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.duplicates, append([]string(nil), a.samples...)
+}
+
+// Writer is the subset of writer.Writer wrapped by AuditingWriter.
+type Writer interface {
+	WriteBatch(ctx context.Context, ops []itemimage.Operation) error
+	Flush(ctx context.Context) error
+}
+
+// AuditingWriter records every operation of a successfully written batch with a
+// DuplicateAuditor, as applied to its table. Writers of several tables can share
+// one auditor.
+// Example:
+//
+//	w := audit.NewWriter(writer.NewDynamoDBWriter(client, table, 25), auditor, table)
+type AuditingWriter struct {
+	next    Writer
+	auditor *DuplicateAuditor
+	table   string
+}
+
+// NewWriter wraps next, writing to table, so its writes are audited.
+func NewWriter(next Writer, auditor *DuplicateAuditor, table string) *AuditingWriter {
+	return &AuditingWriter{next: next, auditor: auditor, table: table}
+}
+
+// WriteBatch writes ops and then records them.
+func (w *AuditingWriter) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	if err := w.next.WriteBatch(ctx, ops); err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if _, err := w.auditor.Record(w.table, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush flushes the wrapped writer and the audit log.
+func (w *AuditingWriter) Flush(ctx context.Context) error {
+	if err := w.next.Flush(ctx); err != nil {
+		return err
+	}
+	return w.auditor.Flush()
+}
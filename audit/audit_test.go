@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+func deleteOp(pk string, ts int64) itemimage.Operation {
+	return itemimage.Operation{
+		Type:                 itemimage.OpDelete,
+		Keys:                 map[string]types.AttributeValue{"PK": &types.AttributeValueMemberS{Value: pk}},
+		OldImage:             map[string]types.AttributeValue{"PK": &types.AttributeValueMemberS{Value: pk}},
+		WriteTimestampMicros: ts,
+	}
+}
+
+// TestAuditorDetectsDuplicatesAcrossRuns covers the main use case: operations
+// replayed after a crash and resume are reported, while a later change to the same
+// key (different write timestamp) is not.
+func TestAuditorDetectsDuplicatesAcrossRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "digests")
+
+	first := NewDuplicateAuditor(path)
+	if err := first.Open(10); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, op := range []itemimage.Operation{deleteOp("a", 1), deleteOp("b", 1)} {
+		if dup, err := first.Record("orders", op); err != nil || dup {
+			t.Fatalf("Record(%v) = %v, %v; want first apply", op.Keys, dup, err)
+		}
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	second := NewDuplicateAuditor(path)
+	if err := second.Open(10); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer second.Close()
+	if dup, _ := second.Record("orders", deleteOp("a", 1)); !dup {
+		t.Error("expected replayed operation to be a duplicate")
+	}
+	if dup, _ := second.Record("orders", deleteOp("a", 2)); dup {
+		t.Error("expected a later write to the same key not to be a duplicate")
+	}
+	n, samples := second.Duplicates()
+	if n != 1 || len(samples) != 1 || samples[0] != "orders: PK=S:a @1" {
+		t.Errorf("Duplicates() = %d, %v", n, samples)
+	}
+	if second.Applied() != 2 {
+		t.Errorf("expected 2 applied operations this run, got %d", second.Applied())
+	}
+}
+
+// TestAuditorDropsPartialDigest ensures a digest torn by a crash mid-write does not
+// shift every later digest in the log.
+func TestAuditorDropsPartialDigest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "digests")
+	d := digestOf("orders", deleteOp("a", 1))
+	if err := os.WriteFile(path, append(d[:], 1, 2, 3), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewDuplicateAuditor(path)
+	if err := a.Open(1); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if dup, _ := a.Record("orders", deleteOp("a", 1)); !dup {
+		t.Error("expected the complete digest to be loaded")
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.Size() != 2*digestSize {
+		t.Errorf("expected log of 2 digests, got %d bytes", info.Size())
+	}
+}
+
+// TestBloomFilterFalsePositiveRate checks the filter sizing: at capacity, false
+// duplicates must stay rare enough not to mislead operators. Lookups also add, so
+// only a few are made to keep the filter near its capacity.
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	const n = 100000
+	f := newBloomFilter(n)
+	for i := int64(0); i < n; i++ {
+		if f.testAndAdd(digestOf("orders", deleteOp("item", i))) {
+			t.Fatalf("digest %d reported as present before it was added", i)
+		}
+	}
+	falsePositives := 0
+	for i := int64(n); i < n+n/10; i++ {
+		if f.testAndAdd(digestOf("orders", deleteOp("item", i))) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 2 {
+		t.Errorf("expected at most 2 false positives in %d lookups, got %d", n/10, falsePositives)
+	}
+}
+
+type failingWriter struct {
+	err error
+}
+
+func (w *failingWriter) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	return w.err
+}
+
+func (w *failingWriter) Flush(ctx context.Context) error {
+	return nil
+}
+
+// TestAuditingWriterRecordsOnlyWrittenBatches ensures failed batches are not
+// recorded, so their retry is not misreported as a duplicate apply.
+func TestAuditingWriterRecordsOnlyWrittenBatches(t *testing.T) {
+	a := NewDuplicateAuditor(filepath.Join(t.TempDir(), "digests"))
+	if err := a.Open(10); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	inner := &failingWriter{err: errors.New("throttled")}
+	w := NewWriter(inner, a, "orders")
+	ops := []itemimage.Operation{deleteOp("a", 1)}
+	if err := w.WriteBatch(context.Background(), ops); err == nil {
+		t.Fatal("expected the write error to be returned")
+	}
+	inner.err = nil
+	if err := w.WriteBatch(context.Background(), ops); err != nil {
+		t.Fatalf("WriteBatch: %v", err)
+	}
+	if n, _ := a.Duplicates(); n != 0 || a.Applied() != 1 {
+		t.Errorf("expected 1 applied and 0 duplicates, got %d and %d", a.Applied(), n)
+	}
+}
+
+// TestAuditingWritersOfSeveralTables ensures an operation fanned out to two
+// tables sharing an auditor is not reported as a duplicate, while applying it
+// to one of them again is.
+func TestAuditingWritersOfSeveralTables(t *testing.T) {
+	a := NewDuplicateAuditor(filepath.Join(t.TempDir(), "digests"))
+	if err := a.Open(10); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	orders := NewWriter(&failingWriter{}, a, "orders")
+	copies := NewWriter(&failingWriter{}, a, "orders-copy")
+	ops := []itemimage.Operation{deleteOp("a", 1)}
+	for _, w := range []*AuditingWriter{orders, copies, copies} {
+		if err := w.WriteBatch(context.Background(), ops); err != nil {
+			t.Fatalf("WriteBatch: %v", err)
+		}
+	}
+	if n, samples := a.Duplicates(); n != 1 || samples[0] != "orders-copy: PK=S:a @1" {
+		t.Errorf("expected the second write to orders-copy as the only duplicate, got %d %v", n, samples)
+	}
+}
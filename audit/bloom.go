@@ -0,0 +1,59 @@
+package audit
+
+import "math"
+
+// bloomFalsePositiveRate is the target false-positive rate at the filter's
+// expected capacity. A false positive reports a possible duplicate that did not
+// happen, so the rate is kept low at ~29 bits per item.
+const bloomFalsePositiveRate = 1e-6
+
+// bloomFilter is a fixed-size Bloom filter over 128-bit digests. Probe positions
+// use double hashing of the two digest halves, so no further hashing is needed.
+type bloomFilter struct {
+	bits []uint64
+	m    uint64 // Number of bits
+	k    uint64 // Number of probes per digest
+}
+
+// newBloomFilter sizes a filter for n items at bloomFalsePositiveRate.
+func newBloomFilter(n int64) *bloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(bloomFalsePositiveRate) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) &^ 63
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{bits: make([]uint64, m/64), m: m, k: k}
+}
+
+// contains reports whether the digest may have been added.
+func (f *bloomFilter) contains(d digest) bool {
+	h1, h2 := d.halves()
+	bit, step := h1%f.m, h2%f.m
+	for i := uint64(0); i < f.k; i++ {
+		if f.bits[bit/64]&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+		bit = (bit + step) % f.m
+	}
+	return true
+}
+
+// testAndAdd adds the digest and reports whether it may have been added before.
+func (f *bloomFilter) testAndAdd(d digest) bool {
+	h1, h2 := d.halves()
+	bit, step := h1%f.m, h2%f.m
+	present := true
+	for i := uint64(0); i < f.k; i++ {
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if f.bits[word]&mask == 0 {
+			present = false
+			f.bits[word] |= mask
+		}
+		bit = (bit + step) % f.m
+	}
+	return present
+}
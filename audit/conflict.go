@@ -0,0 +1,189 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// minKeySetItems is the smallest capacity a KeySet is sized for, so a table
+// described as nearly empty does not get a filter that saturates at once.
+const minKeySetItems = 1 << 16
+
+// ScanClient is the subset of the DynamoDB client used to read a table's keys.
+type ScanClient interface {
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+}
+
+// HasItems reports whether table holds any item, reading at most one.
+// Example:
+//
+//	if nonEmpty, err := audit.HasItems(ctx, client, "orders"); err == nil && nonEmpty {
+//	    return fmt.Errorf("orders is not empty")
+//	}
+func HasItems(ctx context.Context, client ScanClient, table string) (bool, error) {
+	input := &dynamodb.ScanInput{TableName: awssdk.String(table), Limit: awssdk.Int32(1), Select: types.SelectCount}
+	for {
+		out, err := client.Scan(ctx, input)
+		if err != nil {
+			return false, fmt.Errorf("failed to scan table %s: %w", table, err)
+		}
+		if out.Count > 0 {
+			return true, nil
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			return false, nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// KeySet holds the primary keys of the items a table held before a restore in a
+// Bloom filter, so the operations of the restore can be told apart by whether
+// they overwrite an existing item. A small fraction of new items (about one in a
+// million at the expected capacity) is taken for existing ones.
+// Example:
+//
+//	set, err := audit.ScanKeys(ctx, client, "orders", []string{"pk", "sk"}, info.ItemCount, 8)
+//	if err != nil {
+//	    return err
+//	}
+//	var stats audit.ConflictStats
+//	stats.Record(set, op)
+type KeySet struct {
+	filter   *bloomFilter
+	keyAttrs []string // Primary key attributes, partition key first
+	items    int64    // Items scanned
+}
+
+// ScanKeys reads the primary key of every item of table with a parallel scan of
+// segments segments, projecting only keyAttrs. expectedItems sizes the filter;
+// DynamoDB's item count is up to six hours old, so the filter is sized a
+// quarter larger.
+func ScanKeys(ctx context.Context, client ScanClient, table string, keyAttrs []string, expectedItems int64, segments int) (*KeySet, error) {
+	if len(keyAttrs) == 0 {
+		return nil, fmt.Errorf("key attributes of table %s are required to scan its keys", table)
+	}
+	segments = max(segments, 1)
+	set := &KeySet{filter: newBloomFilter(max(expectedItems+expectedItems/4, minKeySetItems)), keyAttrs: keyAttrs}
+
+	names := make(map[string]string, len(keyAttrs))
+	projection := make([]string, 0, len(keyAttrs))
+	for i, attr := range keyAttrs {
+		name := "#k" + strconv.Itoa(i)
+		names[name] = attr
+		projection = append(projection, name)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make([]error, segments)
+	for segment := range segments {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			input := &dynamodb.ScanInput{
+				TableName:                awssdk.String(table),
+				ProjectionExpression:     awssdk.String(strings.Join(projection, ", ")),
+				ExpressionAttributeNames: names,
+			}
+			if segments > 1 {
+				input.Segment, input.TotalSegments = awssdk.Int32(int32(segment)), awssdk.Int32(int32(segments))
+			}
+			for {
+				out, err := client.Scan(ctx, input)
+				if err != nil {
+					errs[segment] = fmt.Errorf("failed to scan keys of table %s: %w", table, err)
+					return
+				}
+				mu.Lock()
+				for _, item := range out.Items {
+					set.filter.testAndAdd(keyDigest(item))
+					set.items++
+				}
+				mu.Unlock()
+				if len(out.LastEvaluatedKey) == 0 {
+					return
+				}
+				input.ExclusiveStartKey = out.LastEvaluatedKey
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// Len returns the number of items scanned.
+func (s *KeySet) Len() int64 {
+	return s.items
+}
+
+// Holds reports whether the item op writes was in the table when it was
+// scanned. ok is false when op has no key: its Keys are empty and its image
+// lacks a key attribute.
+func (s *KeySet) Holds(op itemimage.Operation) (held, ok bool) {
+	keys := op.Keys
+	if len(keys) == 0 {
+		image := op.NewImage
+		if image == nil {
+			image = op.OldImage
+		}
+		keys = make(map[string]types.AttributeValue, len(s.keyAttrs))
+		for _, attr := range s.keyAttrs {
+			v, found := image[attr]
+			if !found {
+				return false, false
+			}
+			keys[attr] = v
+		}
+	}
+	return s.filter.contains(keyDigest(keys)), true
+}
+
+// keyDigest hashes a primary key.
+func keyDigest(keys map[string]types.AttributeValue) digest {
+	sum := sha256.Sum256([]byte(itemimage.KeyFingerprint(keys)))
+	var d digest
+	copy(d[:], sum[:digestSize])
+	return d
+}
+
+// ConflictStats counts the operations of a restore by their effect on the
+// items a table held before it.
+type ConflictStats struct {
+	Inserts    int64 // Puts and updates of items the table did not hold
+	Overwrites int64 // Puts and updates of items the table held
+	Deletes    int64 // Deletes of items the table held
+	Unkeyed    int64 // Operations without a key, which could not be told apart
+}
+
+// Record counts op by its effect on the items in set. Deletes of items the
+// table did not hold change nothing and are not counted.
+func (c *ConflictStats) Record(set *KeySet, op itemimage.Operation) {
+	held, ok := set.Holds(op)
+	switch {
+	case !ok:
+		c.Unkeyed++
+	case op.Type == itemimage.OpDelete:
+		if held {
+			c.Deletes++
+		}
+	case held:
+		c.Overwrites++
+	default:
+		c.Inserts++
+	}
+}
@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// scanTable serves scans of an in-memory table of items keyed by PK, one page
+// of pageSize items at a time, split into the requested segments.
+type scanTable struct {
+	mu       sync.Mutex
+	keys     []string
+	pageSize int
+	inputs   []*dynamodb.ScanInput
+}
+
+func (s *scanTable) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	s.mu.Lock()
+	in := *params
+	s.inputs = append(s.inputs, &in)
+	s.mu.Unlock()
+
+	segment, total := 0, 1
+	if params.TotalSegments != nil {
+		segment, total = int(*params.Segment), int(*params.TotalSegments)
+	}
+	start := 0
+	if pos, ok := params.ExclusiveStartKey["pos"].(*types.AttributeValueMemberN); ok {
+		start, _ = strconv.Atoi(pos.Value)
+	}
+	out := &dynamodb.ScanOutput{}
+	i := start
+	for ; i < len(s.keys) && int(out.ScannedCount) < s.pageSize; i++ {
+		if i%total != segment {
+			continue
+		}
+		out.ScannedCount++
+		out.Count++
+		if params.Select != types.SelectCount {
+			out.Items = append(out.Items, map[string]types.AttributeValue{"PK": &types.AttributeValueMemberS{Value: s.keys[i]}})
+		}
+	}
+	if i < len(s.keys) {
+		out.LastEvaluatedKey = map[string]types.AttributeValue{"pos": &types.AttributeValueMemberN{Value: strconv.Itoa(i)}}
+	}
+	return out, nil
+}
+
+func putOp(pk string) itemimage.Operation {
+	return itemimage.Operation{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{
+		"PK": &types.AttributeValueMemberS{Value: pk}, "v": &types.AttributeValueMemberN{Value: "1"},
+	}}
+}
+
+// TestKeySetCountsConflicts checks a parallel scan collects every key of the
+// table, projecting only the key, and that operations are counted as inserts,
+// overwrites and deletes of existing items, using the image for full export
+// puts that carry no separate key.
+func TestKeySetCountsConflicts(t *testing.T) {
+	table := &scanTable{keys: []string{"a", "b", "c", "d", "e"}, pageSize: 2}
+	set, err := ScanKeys(context.Background(), table, "orders", []string{"PK"}, 5, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Len() != 5 {
+		t.Fatalf("expected 5 scanned keys, got %d", set.Len())
+	}
+	for _, in := range table.inputs {
+		if *in.ProjectionExpression != "#k0" || in.ExpressionAttributeNames["#k0"] != "PK" || *in.TotalSegments != 2 {
+			t.Fatalf("unexpected scan input %+v", in)
+		}
+	}
+
+	var stats ConflictStats
+	for _, op := range []itemimage.Operation{
+		putOp("a"), putOp("x"), putOp("y"), deleteOp("b", 1), deleteOp("z", 1),
+		{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"v": &types.AttributeValueMemberN{Value: "1"}}},
+	} {
+		stats.Record(set, op)
+	}
+	want := ConflictStats{Inserts: 2, Overwrites: 1, Deletes: 1, Unkeyed: 1}
+	if stats != want {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+}
+
+// TestHasItems checks the probe tells an empty table from one with items.
+func TestHasItems(t *testing.T) {
+	for _, tt := range []struct {
+		keys []string
+		want bool
+	}{
+		{nil, false},
+		{[]string{"a"}, true},
+	} {
+		got, err := HasItems(context.Background(), &scanTable{keys: tt.keys, pageSize: 1}, "orders")
+		if err != nil || got != tt.want {
+			t.Errorf("HasItems(%v) = %v, %v; want %v", tt.keys, got, err, tt.want)
+		}
+	}
+}
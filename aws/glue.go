@@ -0,0 +1,186 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	json "github.com/goccy/go-json"
+)
+
+// GlueColumn is a column of a Glue Data Catalog table.
+type GlueColumn struct {
+	Name string `json:"Name"`
+	Type string `json:"Type"` // Hive type, e.g. string, bigint, double, boolean
+}
+
+// GlueSerDeInfo names the serializer reading a table's files.
+type GlueSerDeInfo struct {
+	SerializationLibrary string            `json:"SerializationLibrary"`
+	Parameters           map[string]string `json:"Parameters,omitempty"`
+}
+
+// GlueStorageDescriptor describes where a table's or partition's files are and
+// how they are read.
+type GlueStorageDescriptor struct {
+	Columns      []GlueColumn  `json:"Columns,omitempty"`
+	Location     string        `json:"Location"`
+	InputFormat  string        `json:"InputFormat,omitempty"`
+	OutputFormat string        `json:"OutputFormat,omitempty"`
+	SerdeInfo    GlueSerDeInfo `json:"SerdeInfo"`
+}
+
+// GlueTableInput is the definition of a table, as CreateTable and UpdateTable take it.
+type GlueTableInput struct {
+	Name              string                `json:"Name"`
+	TableType         string                `json:"TableType,omitempty"`
+	Parameters        map[string]string     `json:"Parameters,omitempty"`
+	StorageDescriptor GlueStorageDescriptor `json:"StorageDescriptor"`
+	PartitionKeys     []GlueColumn          `json:"PartitionKeys,omitempty"`
+}
+
+// GluePartitionInput is the definition of one partition of a table.
+type GluePartitionInput struct {
+	Values            []string              `json:"Values"`
+	StorageDescriptor GlueStorageDescriptor `json:"StorageDescriptor"`
+}
+
+// GluePartitionError is a partition BatchCreatePartition did not create.
+type GluePartitionError struct {
+	Values []string `json:"PartitionValues"`
+	Code   string   // Glue error code, e.g. AlreadyExistsException
+}
+
+// GlueError is an error returned by the Glue API.
+type GlueError struct {
+	Code    string // Exception name, e.g. EntityNotFoundException
+	Message string
+}
+
+// Error implements error.
+func (e *GlueError) Error() string {
+	return fmt.Sprintf("glue: %s: %s", e.Code, e.Message)
+}
+
+// IsGlueErrorCode reports whether err is a GlueError with the given code.
+func IsGlueErrorCode(err error, code string) bool {
+	var glueErr *GlueError
+	return errors.As(err, &glueErr) && glueErr.Code == code
+}
+
+// GlueClientImpl implements GlueClient by calling the Glue JSON API directly,
+// signed with the credentials of an AWS SDK configuration, as the SDK's Glue
+// module is not a dependency. Calls are not retried.
+type GlueClientImpl struct {
+	cfg      awssdk.Config
+	endpoint string // Glue API endpoint of the configuration's region
+	signer   *v4.Signer
+	http     *http.Client
+}
+
+// NewGlueClient creates a new GlueClientImpl for the region and credentials of cfg.
+// Example:
+//
+//	client := aws.NewGlueClient(awsCfg)
+//	err := client.CreateTable(ctx, "analytics", table)
+func NewGlueClient(cfg awssdk.Config) *GlueClientImpl {
+	return &GlueClientImpl{
+		cfg:      cfg,
+		endpoint: "https://glue." + cfg.Region + ".amazonaws.com/",
+		signer:   v4.NewSigner(),
+		http:     &http.Client{Timeout: time.Minute},
+	}
+}
+
+// CreateTable implements the GlueClient interface for creating a table
+func (c *GlueClientImpl) CreateTable(ctx context.Context, database string, table GlueTableInput) error {
+	return c.call(ctx, "CreateTable", map[string]any{"DatabaseName": database, "TableInput": table}, nil)
+}
+
+// UpdateTable implements the GlueClient interface for replacing a table's definition
+func (c *GlueClientImpl) UpdateTable(ctx context.Context, database string, table GlueTableInput) error {
+	return c.call(ctx, "UpdateTable", map[string]any{"DatabaseName": database, "TableInput": table}, nil)
+}
+
+// BatchCreatePartition implements the GlueClient interface for adding partitions
+func (c *GlueClientImpl) BatchCreatePartition(ctx context.Context, database, table string, partitions []GluePartitionInput) ([]GluePartitionError, error) {
+	var out struct {
+		Errors []struct {
+			PartitionValues []string
+			ErrorDetail     struct{ ErrorCode string }
+		}
+	}
+	in := map[string]any{"DatabaseName": database, "TableName": table, "PartitionInputList": partitions}
+	if err := c.call(ctx, "BatchCreatePartition", in, &out); err != nil {
+		return nil, err
+	}
+	var failed []GluePartitionError
+	for _, e := range out.Errors {
+		failed = append(failed, GluePartitionError{Values: e.PartitionValues, Code: e.ErrorDetail.ErrorCode})
+	}
+	return failed, nil
+}
+
+// call posts one signed Glue API request and decodes its response into out.
+func (c *GlueClientImpl) call(ctx context.Context, operation string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", operation, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AWSGlue."+operation)
+
+	if c.cfg.Credentials == nil {
+		return fmt.Errorf("no AWS credentials to sign %s with", operation)
+	}
+	creds, err := c.cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve credentials: %w", err)
+	}
+	hash := sha256.Sum256(body)
+	if err := c.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "glue", c.cfg.Region, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign %s request: %w", operation, err)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("glue %s failed: %w", operation, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s response: %w", operation, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string // Matches both message and Message, which Glue uses interchangeably
+		}
+		_ = json.Unmarshal(respBody, &apiErr)
+		// Types may be namespaced or carry a URL, e.g. aws.glue#Code or Code:http://...
+		code, _, _ := strings.Cut(apiErr.Type[strings.LastIndex(apiErr.Type, "#")+1:], ":")
+		if code == "" {
+			code = resp.Status
+		}
+		return &GlueError{Code: code, Message: apiErr.Message}
+	}
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("failed to decode %s response: %w", operation, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package aws
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+// HTTPOptions tunes the HTTP client shared by the AWS clients. Zero values keep
+// the SDK's defaults.
+type HTTPOptions struct {
+	ConnectTimeout      time.Duration // Timeout for dialing a connection
+	TLSHandshakeTimeout time.Duration // Timeout for the TLS handshake of a new connection
+	Recorder            ConnRecorder  // Optional; receives connection reuse and DNS lookups
+	MaxIdleConns        int           // Idle connections kept open, in total and per host, per shard
+	Shards              int           // Connection pools requests are spread over (0 or 1 = one pool)
+	DisableHTTP2        bool          // Use HTTP/1.1 only, one request per connection at a time
+}
+
+// ConnRecorder receives how each request got its connection and the DNS
+// lookups made for new connections.
+type ConnRecorder interface {
+	RecordConnection(reused bool, wait time.Duration)
+	RecordDNSLookup(d time.Duration)
+}
+
+// shardKey is the context key of the shard set by WithShard.
+type shardKey struct{}
+
+// WithShard pins the AWS requests made with ctx to one connection pool of a
+// client created with Shards, chosen by shard modulo the number of pools. The
+// coordinator pins each worker, so a slow response only holds up requests of
+// the workers sharing its pool. Requests without a shard are spread round-robin.
+func WithShard(ctx context.Context, shard int) context.Context {
+	return context.WithValue(ctx, shardKey{}, shard)
+}
+
+// NewHTTPClient returns an HTTP client for the AWS clients. The SDK keeps at
+// most 10 idle connections per host, so with more concurrent requests than that
+// most of them pay for a new TCP and TLS handshake; raising MaxIdleConns to
+// about twice the workers lets every request reuse a connection. With Shards
+// each pool has its own transport, and requests pick theirs by WithShard.
+// Example:
+//
+//	awsCfg, err := awsconfig.LoadDefaultConfig(ctx,
+//	    awsconfig.WithHTTPClient(aws.NewHTTPClient(aws.HTTPOptions{MaxIdleConns: 128})),
+//	)
+func NewHTTPClient(opts HTTPOptions) awssdk.HTTPClient {
+	var client awssdk.HTTPClient = newPool(opts)
+	if opts.Shards > 1 {
+		sharded := &shardedClient{}
+		for range opts.Shards {
+			sharded.pools = append(sharded.pools, newPool(opts))
+		}
+		client = sharded
+	}
+	if opts.Recorder != nil {
+		client = &tracedClient{client: client, rec: opts.Recorder}
+	}
+	return client
+}
+
+// newPool returns a client with its own transport, and so its own connections.
+func newPool(opts HTTPOptions) *awshttp.BuildableClient {
+	return awshttp.NewBuildableClient().
+		WithDialerOptions(func(d *net.Dialer) {
+			if opts.ConnectTimeout > 0 {
+				d.Timeout = opts.ConnectTimeout
+			}
+		}).
+		WithTransportOptions(func(tr *http.Transport) {
+			if opts.MaxIdleConns > 0 {
+				tr.MaxIdleConns = opts.MaxIdleConns
+				tr.MaxIdleConnsPerHost = opts.MaxIdleConns
+			}
+			if opts.TLSHandshakeTimeout > 0 {
+				tr.TLSHandshakeTimeout = opts.TLSHandshakeTimeout
+			}
+			if opts.DisableHTTP2 {
+				// A non-nil, empty TLSNextProto stops the transport from negotiating h2
+				tr.ForceAttemptHTTP2 = false
+				tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+			}
+		})
+}
+
+// shardedClient sends each request through the pool chosen by its shard.
+type shardedClient struct {
+	pools []*awshttp.BuildableClient
+	next  atomic.Uint64 // Round-robin counter for requests without a shard
+}
+
+// Do implements aws.HTTPClient.
+func (c *shardedClient) Do(req *http.Request) (*http.Response, error) {
+	return c.pools[c.pick(req.Context())].Do(req)
+}
+
+// pick returns the index of the pool for a request made with ctx.
+func (c *shardedClient) pick(ctx context.Context) int {
+	n := len(c.pools)
+	if shard, ok := ctx.Value(shardKey{}).(int); ok {
+		return (shard%n + n) % n
+	}
+	return int(c.next.Add(1) % uint64(n))
+}
+
+// tracedClient reports how requests got their connections.
+type tracedClient struct {
+	client awssdk.HTTPClient
+	rec    ConnRecorder
+}
+
+// Do implements aws.HTTPClient. The wait runs from asking the pool for a
+// connection until getting one, so it includes dialing and TLS for new
+// connections and queueing behind busy HTTP/2 connections.
+func (c *tracedClient) Do(req *http.Request) (*http.Response, error) {
+	var getConn, dnsStart time.Time
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) { getConn = time.Now() },
+		GotConn: func(info httptrace.GotConnInfo) {
+			c.rec.RecordConnection(info.Reused, time.Since(getConn))
+		},
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { c.rec.RecordDNSLookup(time.Since(dnsStart)) },
+	}
+	return c.client.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
@@ -0,0 +1,56 @@
+package aws
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type connRecorder struct {
+	mu     sync.Mutex
+	opened int
+	reused int
+}
+
+func (r *connRecorder) RecordConnection(reused bool, wait time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if reused {
+		r.reused++
+	} else {
+		r.opened++
+	}
+}
+
+func (r *connRecorder) RecordDNSLookup(d time.Duration) {}
+
+// TestShardedHTTPClientPinsPools verifies requests of one shard reuse their
+// pool's connection while another shard opens its own, which is what keeps a
+// worker's requests off connections busy with another worker's.
+func TestShardedHTTPClientPinsPools(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	rec := &connRecorder{}
+	client := NewHTTPClient(HTTPOptions{Shards: 2, Recorder: rec})
+
+	for _, shard := range []int{0, 0, 1, 3} {
+		req, err := http.NewRequestWithContext(WithShard(context.Background(), shard), http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("shard %d: %v", shard, err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	// Shard 3 maps to the pool of shard 1
+	if rec.opened != 2 || rec.reused != 2 {
+		t.Errorf("expected 2 opened and 2 reused connections, got %d and %d", rec.opened, rec.reused)
+	}
+}
@@ -7,14 +7,13 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"net/url"
-	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	json "github.com/goccy/go-json"
 	"github.com/gurre/ddb-pitr/metrics"
+	"github.com/gurre/ddb-pitr/s3uri"
 )
 
 // DynamoDBClientImpl implements DynamoDBClient using the AWS SDK as specified in section 4.6.
@@ -38,6 +37,46 @@ func (c *DynamoDBClientImpl) UpdateItem(ctx context.Context, params *dynamodb.Up
 	return c.client.UpdateItem(ctx, params, optFns...)
 }
 
+// DescribeTable returns the target table's description for preflight checks
+func (c *DynamoDBClientImpl) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	return c.client.DescribeTable(ctx, params, optFns...)
+}
+
+// DescribeTimeToLive returns a table's TTL setting for plan mode's schema drift report
+func (c *DynamoDBClientImpl) DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	return c.client.DescribeTimeToLive(ctx, params, optFns...)
+}
+
+// UpdateTable enables the stream of a target table for -enable-stream
+func (c *DynamoDBClientImpl) UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error) {
+	return c.client.UpdateTable(ctx, params, optFns...)
+}
+
+// ListTagsOfResource reads the exported table's tags for -copy-tags
+func (c *DynamoDBClientImpl) ListTagsOfResource(ctx context.Context, params *dynamodb.ListTagsOfResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTagsOfResourceOutput, error) {
+	return c.client.ListTagsOfResource(ctx, params, optFns...)
+}
+
+// TagResource tags the target tables for -copy-tags and -tags
+func (c *DynamoDBClientImpl) TagResource(ctx context.Context, params *dynamodb.TagResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TagResourceOutput, error) {
+	return c.client.TagResource(ctx, params, optFns...)
+}
+
+// BatchGetItem reads the target tables' current items for -skip-unchanged
+func (c *DynamoDBClientImpl) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	return c.client.BatchGetItem(ctx, params, optFns...)
+}
+
+// Scan reads a target table's keys for overwrite checks
+func (c *DynamoDBClientImpl) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return c.client.Scan(ctx, params, optFns...)
+}
+
+// BatchExecuteStatement runs PartiQL statements for the PartiQL write mode
+func (c *DynamoDBClientImpl) BatchExecuteStatement(ctx context.Context, params *dynamodb.BatchExecuteStatementInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchExecuteStatementOutput, error) {
+	return c.client.BatchExecuteStatement(ctx, params, optFns...)
+}
+
 // S3ClientImpl implements S3Client using the AWS SDK as specified in sections 4.3 and 4.4.
 // It provides concrete implementations for reading manifest files and data files.
 type S3ClientImpl struct {
@@ -83,26 +122,39 @@ func (c *IAMClientImpl) SimulatePrincipalPolicy(ctx context.Context, params *iam
 // S3ReportUploader uploads metrics reports to S3.
 type S3ReportUploader struct {
 	client S3Client
+	tags   map[string]string // Object tags of the uploaded reports
+}
+
+// ReportUploaderOption configures optional S3ReportUploader behavior.
+type ReportUploaderOption func(*S3ReportUploader)
+
+// WithReportTags tags every uploaded report with tags.
+// Example:
+//
+//	uploader := aws.NewS3ReportUploader(client, aws.WithReportTags(map[string]string{aws.RunIDTag: runID}))
+func WithReportTags(tags map[string]string) ReportUploaderOption {
+	return func(u *S3ReportUploader) {
+		u.tags = tags
+	}
 }
 
 // NewS3ReportUploader creates a new S3ReportUploader instance.
-func NewS3ReportUploader(client S3Client) *S3ReportUploader {
-	return &S3ReportUploader{client: client}
+func NewS3ReportUploader(client S3Client, opts ...ReportUploaderOption) *S3ReportUploader {
+	u := &S3ReportUploader{client: client}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
 }
 
 // UploadReport uploads a metrics report to the specified S3 URI.
 // The URI must be in the format s3://bucket/key.
 func (u *S3ReportUploader) UploadReport(ctx context.Context, uri string, report metrics.Report) error {
-	parsed, err := url.Parse(uri)
+	parsed, err := s3uri.ParseObject(uri)
 	if err != nil {
-		return fmt.Errorf("invalid S3 URI: %w", err)
+		return err
 	}
-	if parsed.Scheme != "s3" {
-		return fmt.Errorf("invalid S3 URI scheme: %s", parsed.Scheme)
-	}
-
-	bucket := parsed.Host
-	key := strings.TrimPrefix(parsed.Path, "/")
+	bucket, key := parsed.Bucket, parsed.Key
 
 	data, err := json.Marshal(report)
 	if err != nil {
@@ -115,6 +167,7 @@ func (u *S3ReportUploader) UploadReport(ctx context.Context, uri string, report
 		Key:         &key,
 		Body:        bytes.NewReader(data),
 		ContentType: &contentType,
+		Tagging:     Tagging(u.tags),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to upload report: %w", err)
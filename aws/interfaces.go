@@ -32,11 +32,20 @@ type IAMClient interface {
 	SimulatePrincipalPolicy(ctx context.Context, params *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error)
 }
 
+// GlueClient defines the interface for the Glue Data Catalog operations used to
+// register materialized exports as Athena tables.
+type GlueClient interface {
+	CreateTable(ctx context.Context, database string, table GlueTableInput) error
+	UpdateTable(ctx context.Context, database string, table GlueTableInput) error
+	BatchCreatePartition(ctx context.Context, database, table string, partitions []GluePartitionInput) ([]GluePartitionError, error)
+}
+
 // Compile-time interface checks to ensure implementations satisfy interfaces
 var (
 	_ DynamoDBClient = (*DynamoDBClientImpl)(nil)
 	_ S3Client       = (*S3ClientImpl)(nil)
 	_ IAMClient      = (*IAMClientImpl)(nil)
+	_ GlueClient     = (*GlueClientImpl)(nil)
 
 	// AWS SDK interface checks to ensure SDK clients satisfy interfaces
 	_ DynamoDBClient = (*dynamodb.Client)(nil)
@@ -0,0 +1,64 @@
+package aws
+
+import (
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+// sdkMaxAttempts is how many times the SDK tries a request before returning its
+// error. Throttling outlasting these attempts is retried by the caller.
+const sdkMaxAttempts = 5
+
+// throttles classifies errors as the SDK's adaptive retry mode does.
+var throttles = retry.IsErrorThrottles(retry.DefaultThrottles)
+
+// IsThrottle reports whether err is a throttling error by the SDK's definition,
+// which covers DynamoDB's ProvisionedThroughputExceededException and
+// RequestLimitExceeded as well as the throttling codes of other services.
+func IsThrottle(err error) bool {
+	return throttles.IsErrorThrottle(err) == awssdk.TrueTernary
+}
+
+// RetryRecorder receives every retry a client makes, and whether the failed
+// attempt was throttled.
+type RetryRecorder interface {
+	RecordRetry(throttled bool)
+}
+
+// NewAdaptiveRetryer returns the SDK's adaptive retry mode, which retries
+// transient errors with backoff and slows the client's request rate while it
+// is throttled, reporting each retry to rec. A request is tried up to
+// sdkMaxAttempts times.
+// Example:
+//
+//	client := dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
+//	    o.Retryer = aws.NewAdaptiveRetryer(m)
+//	})
+func NewAdaptiveRetryer(rec RetryRecorder) awssdk.RetryerV2 {
+	return &recordingRetryer{
+		RetryerV2: retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+			o.StandardOptions = append(o.StandardOptions, func(so *retry.StandardOptions) {
+				so.MaxAttempts = sdkMaxAttempts
+			})
+		}),
+		rec: rec,
+	}
+}
+
+// recordingRetryer reports the retries of the retryer it wraps.
+type recordingRetryer struct {
+	awssdk.RetryerV2
+	rec RetryRecorder
+}
+
+// RetryDelay implements aws.Retryer. The SDK asks for a delay once per retry
+// it is about to make.
+func (r *recordingRetryer) RetryDelay(attempt int, err error) (time.Duration, error) {
+	delay, delayErr := r.RetryerV2.RetryDelay(attempt, err)
+	if delayErr == nil {
+		r.rec.RecordRetry(IsThrottle(err))
+	}
+	return delay, delayErr
+}
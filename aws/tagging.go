@@ -0,0 +1,24 @@
+package aws
+
+import "net/url"
+
+// RunIDTag is the S3 object tag holding the run ID of the restore that wrote a
+// checkpoint or report, for lifecycle rules and cleanup scripts.
+const RunIDTag = "ddb-pitr:run-id"
+
+// Tagging encodes tags as the URL query string s3.PutObjectInput.Tagging
+// takes, or returns nil for no tags.
+// Example:
+//
+//	input.Tagging = aws.Tagging(map[string]string{aws.RunIDTag: runID})
+func Tagging(tags map[string]string) *string {
+	if len(tags) == 0 {
+		return nil
+	}
+	values := make(url.Values, len(tags))
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+	tagging := values.Encode()
+	return &tagging
+}
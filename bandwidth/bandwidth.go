@@ -0,0 +1,177 @@
+// Package bandwidth implements a shared token bucket that caps the number of bytes
+// read from S3 per second across all workers. It exists so a restore can run next
+// to production traffic without saturating a shared NAT gateway or VPC endpoint.
+package bandwidth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gurre/ddb-pitr/clock"
+	"github.com/gurre/s3streamer"
+)
+
+// Limiter is a token bucket shared by every reader it wraps.
+// Tokens are bytes; the bucket refills at bytesPerSec and holds at most burst tokens.
+// Example:
+//
+//	limiter := bandwidth.NewLimiter(bandwidth.MbpsToBytes(100))
+//	if err := limiter.WaitN(ctx, 4096); err != nil {
+//	    return err
+//	}
+type Limiter struct {
+	last        time.Time
+	mu          sync.Mutex
+	clock       clock.Clock
+	bytesPerSec float64
+	tokens      float64
+	burst       int
+}
+
+// Option configures optional Limiter behavior.
+type Option func(*Limiter)
+
+// WithClock sets the time source for refilling and waiting.
+// Example:
+//
+//	limiter := bandwidth.NewLimiter(12_500_000, bandwidth.WithClock(clock.NewFake(start)))
+func WithClock(c clock.Clock) Option {
+	return func(l *Limiter) {
+		l.clock = c
+	}
+}
+
+// MbpsToBytes converts megabits per second to bytes per second.
+func MbpsToBytes(mbps float64) float64 {
+	return mbps * 1_000_000 / 8
+}
+
+// NewLimiter creates a Limiter refilling at bytesPerSec.
+// The burst is one second worth of tokens, with a floor of 32KiB so a single
+// S3 read buffer can always be satisfied.
+// Example:
+//
+//	limiter := bandwidth.NewLimiter(12_500_000) // 100 Mbit/s
+func NewLimiter(bytesPerSec float64, opts ...Option) *Limiter {
+	burst := int(bytesPerSec)
+	if burst < 32*1024 {
+		burst = 32 * 1024
+	}
+	l := &Limiter{
+		clock:       clock.Real,
+		bytesPerSec: bytesPerSec,
+		burst:       burst,
+		tokens:      float64(burst),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.last = l.clock.Now()
+	return l
+}
+
+// Burst returns the maximum number of bytes a single WaitN call may request.
+func (l *Limiter) Burst() int {
+	return l.burst
+}
+
+// WaitN blocks until n bytes may be consumed or the context is cancelled.
+// Requests larger than Burst are rejected because they could never be satisfied.
+// Example:
+//
+//	if err := limiter.WaitN(ctx, len(buf)); err != nil {
+//	    return err
+//	}
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if n > l.burst {
+		return fmt.Errorf("requested %d bytes exceeds limiter burst of %d", n, l.burst)
+	}
+
+	l.mu.Lock()
+	now := l.clock.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.bytesPerSec
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+
+	// Reserve the tokens up front; a negative balance is the debt later callers wait behind.
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.bytesPerSec * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+
+	select {
+	case <-l.clock.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reader charges every read against the shared limiter before returning data.
+type reader struct {
+	ctx     context.Context
+	body    io.ReadCloser
+	limiter *Limiter
+}
+
+// Read reads at most Burst bytes and then waits for the limiter to admit them.
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > r.limiter.burst {
+		p = p[:r.limiter.burst]
+	}
+	n, err := r.body.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// Close closes the underlying body.
+func (r *reader) Close() error {
+	return r.body.Close()
+}
+
+// S3Client wraps the S3 client used by the streamer so that every GetObject body is
+// rate limited by a shared Limiter. All other operations pass through unchanged.
+// Example:
+//
+//	limiter := bandwidth.NewLimiter(bandwidth.MbpsToBytes(200))
+//	streamer := s3streamer.NewS3Streamer(bandwidth.NewS3Client(s3.NewFromConfig(cfg), limiter))
+type S3Client struct {
+	s3streamer.S3Client
+	limiter *Limiter
+}
+
+// NewS3Client creates an S3Client that throttles object bodies through limiter.
+func NewS3Client(client s3streamer.S3Client, limiter *Limiter) *S3Client {
+	return &S3Client{S3Client: client, limiter: limiter}
+}
+
+// GetObject fetches the object and wraps its body with the shared limiter.
+func (c *S3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	out, err := c.S3Client.GetObject(ctx, params, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	if out.Body != nil {
+		out.Body = &reader{ctx: ctx, body: out.Body, limiter: c.limiter}
+	}
+	return out, nil
+}
+
+// Compile-time check that the wrapper can be handed to s3streamer.
+var _ s3streamer.S3Client = (*S3Client)(nil)
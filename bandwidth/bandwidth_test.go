@@ -0,0 +1,98 @@
+package bandwidth
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gurre/ddb-pitr/clock"
+	"github.com/gurre/s3streamer"
+)
+
+// TestLimiterThrottlesAfterBurst verifies that consuming more than the burst
+// forces callers to wait until the bucket has refilled what they asked for,
+// which is the whole point of the limiter, and that an idle bucket refills.
+func TestLimiterThrottlesAfterBurst(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	limiter := NewLimiter(64*1024, WithClock(clk)) // 64KiB/s, burst 64KiB
+	ctx := context.Background()
+
+	if err := limiter.WaitN(ctx, limiter.Burst()); err != nil {
+		t.Fatalf("first wait failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- limiter.WaitN(ctx, 16*1024) }()
+
+	// 16KiB at 64KiB/s takes 250ms
+	clk.BlockUntil(1)
+	clk.Advance(249 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("expected the second wait to block until 250ms, returned %v", err)
+	default:
+	}
+	clk.Advance(time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatalf("second wait failed: %v", err)
+	}
+
+	// A second idle refills the whole burst, which is then taken without waiting
+	clk.Advance(time.Second)
+	if err := limiter.WaitN(ctx, limiter.Burst()); err != nil {
+		t.Fatalf("wait after refill failed: %v", err)
+	}
+}
+
+// TestLimiterRejectsOversizedRequest ensures a request that can never be
+// satisfied fails immediately instead of blocking forever.
+func TestLimiterRejectsOversizedRequest(t *testing.T) {
+	limiter := NewLimiter(1024)
+	if err := limiter.WaitN(context.Background(), limiter.Burst()+1); err == nil {
+		t.Error("expected error for request larger than burst")
+	}
+}
+
+// TestLimiterHonorsContext verifies that cancelled restores do not hang on the limiter.
+func TestLimiterHonorsContext(t *testing.T) {
+	limiter := NewLimiter(1024)
+	ctx, cancel := context.WithCancel(context.Background())
+	_ = limiter.WaitN(ctx, limiter.Burst())
+	cancel()
+
+	if err := limiter.WaitN(ctx, limiter.Burst()); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+// TestS3ClientWrapsBody verifies GetObject bodies are fully readable through the limiter.
+func TestS3ClientWrapsBody(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 100*1024)
+	client := NewS3Client(&fakeS3Client{body: payload}, NewLimiter(10*1024*1024))
+
+	out, err := client.GetObject(context.Background(), &s3.GetObjectInput{})
+	if err != nil {
+		t.Fatalf("GetObject failed: %v", err)
+	}
+	defer out.Body.Close()
+
+	got, err := io.ReadAll(out.Body)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if len(got) != len(payload) {
+		t.Errorf("expected %d bytes, got %d", len(payload), len(got))
+	}
+}
+
+// fakeS3Client returns a fixed body for every GetObject call.
+type fakeS3Client struct {
+	s3streamer.S3Client
+	body []byte
+}
+
+func (f *fakeS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(f.body))}, nil
+}
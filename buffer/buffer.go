@@ -0,0 +1,202 @@
+// Package buffer decouples reading an export from writing it. A Publisher sends
+// decoded operations to an SQS FIFO queue in place of the target table, and a
+// Consumer drains the queue into the table. S3 reads then run at their own
+// speed while the writes follow the table's capacity, and the writing side can
+// be stopped and restarted without touching the reading side.
+package buffer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/oprecord"
+	"github.com/gurre/ddb-pitr/writer"
+)
+
+const (
+	maxBatchEntries = 10         // Messages per SendMessageBatch call, the maximum SQS allows
+	maxBatchBytes   = 256 * 1024 // Total body size of a batch and largest message SQS accepts
+	maxSendRetries  = 5          // Attempts to resend entries SQS failed without a sender fault
+)
+
+// Encode serialises op as a queue message body, an oprecord.Record, which has
+// the shape of an incremental export line so the consumer decodes it with the
+// export decoder.
+// Example:
+//
+//	body, err := buffer.Encode(op)
+func Encode(op itemimage.Operation) ([]byte, error) {
+	rec, err := oprecord.New(op)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(rec)
+}
+
+// Decode parses a message body written by Encode, decoding its images with decoder.
+// Example:
+//
+//	op, err := buffer.Decode([]byte(*msg.Body), itemimage.NewJSONDecoder())
+func Decode(body []byte, decoder itemimage.Decoder) (itemimage.Operation, error) {
+	var rec oprecord.Record
+	if err := json.Unmarshal(body, &rec); err != nil {
+		return itemimage.Operation{}, fmt.Errorf("%w: %v", itemimage.ErrCorrupt, err)
+	}
+	// The message names its operation, so one carrying only Keys is a delete
+	op, err := itemimage.ForView(decoder, itemimage.ViewNewAndOld).Decode(body)
+	if err != nil {
+		return itemimage.Operation{}, err
+	}
+	if op.Type, err = oprecord.ParseType(rec.Operation); err != nil {
+		return itemimage.Operation{}, fmt.Errorf("%w: %v", itemimage.ErrCorrupt, err)
+	}
+	op.SourceFile, op.ByteOffset = rec.SourceFile, rec.ByteOffset
+	return op, nil
+}
+
+// PublishClient is the subset of the SQS client used to publish operations.
+type PublishClient interface {
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+}
+
+// Publisher implements writer.Writer by sending operations to an SQS FIFO
+// queue instead of writing them. Each operation's message group is its item's
+// primary key, so changes to one item are consumed in order while different
+// items are consumed in parallel. Each message gets a deduplication ID unique
+// to the publisher, so SQS drops copies resent by SDK retries but not an item
+// legitimately set to the same value twice. It is safe for concurrent use.
+// Example:
+//
+//	pub := buffer.NewPublisher(sqs.NewFromConfig(awsCfg), queueURL, []string{"pk", "sk"})
+//	err := pub.WriteBatch(ctx, ops)
+type Publisher struct {
+	client   PublishClient
+	queueURL string
+	keyAttrs []string     // Primary key attributes of the target table, partition key first
+	runID    string       // Random prefix of the deduplication IDs of this publisher
+	seq      atomic.Int64 // Number of the last deduplication ID
+}
+
+// NewPublisher creates a Publisher sending to the FIFO queue at queueURL. keyAttrs
+// names the target table's primary key attributes, which full exports carry only
+// in the item image.
+func NewPublisher(client PublishClient, queueURL string, keyAttrs []string) *Publisher {
+	var id [8]byte
+	rand.Read(id[:])
+	return &Publisher{client: client, queueURL: queueURL, keyAttrs: keyAttrs, runID: hex.EncodeToString(id[:])}
+}
+
+// WriteBatch implements writer.Writer by publishing ops in batches of up to ten
+// messages. It fails on an operation too large for one message.
+func (p *Publisher) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	var entries []sqstypes.SendMessageBatchRequestEntry
+	size := 0
+	for _, op := range ops {
+		body, err := Encode(op)
+		if err != nil {
+			return err
+		}
+		if len(body) > maxBatchBytes {
+			return fmt.Errorf("%s operation from %s at offset %d is %d bytes, more than the %d bytes of an SQS message",
+				op.Type, op.SourceFile, op.ByteOffset, len(body), maxBatchBytes)
+		}
+		if len(entries) == maxBatchEntries || size+len(body) > maxBatchBytes {
+			if err := p.send(ctx, entries); err != nil {
+				return err
+			}
+			entries, size = nil, 0
+		}
+		entries = append(entries, sqstypes.SendMessageBatchRequestEntry{
+			Id:                     strPtr(strconv.Itoa(len(entries))),
+			MessageBody:            strPtr(string(body)),
+			MessageGroupId:         strPtr(p.groupID(op)),
+			MessageDeduplicationId: strPtr(p.runID + "-" + strconv.FormatInt(p.seq.Add(1), 10)),
+		})
+		size += len(body)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return p.send(ctx, entries)
+}
+
+// Flush implements writer.Writer. Batches are sent as they are written.
+func (p *Publisher) Flush(ctx context.Context) error {
+	return nil
+}
+
+// send publishes entries, resending those SQS failed on its side with backoff.
+// Entries failed as the sender's fault, such as invalid messages, are not retried.
+func (p *Publisher) send(ctx context.Context, entries []sqstypes.SendMessageBatchRequestEntry) error {
+	for attempt := 0; ; attempt++ {
+		out, err := p.client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{QueueUrl: &p.queueURL, Entries: entries})
+		if err != nil {
+			return fmt.Errorf("failed to publish to queue %s: %w", p.queueURL, err)
+		}
+		if len(out.Failed) == 0 {
+			return nil
+		}
+		failed := make(map[string]bool, len(out.Failed))
+		for _, f := range out.Failed {
+			if f.SenderFault || attempt+1 == maxSendRetries {
+				return fmt.Errorf("failed to publish to queue %s: %s: %s", p.queueURL, deref(f.Code), deref(f.Message))
+			}
+			failed[deref(f.Id)] = true
+		}
+		var retry []sqstypes.SendMessageBatchRequestEntry
+		for _, e := range entries {
+			if failed[*e.Id] {
+				retry = append(retry, e)
+			}
+		}
+		entries = retry
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond << attempt):
+		}
+	}
+}
+
+// groupID returns the message group of op: a digest of its primary key, taken
+// from Keys or, for full exports that carry only the item, from NewImage. The
+// digest fits the 128 characters and the character set SQS allows.
+func (p *Publisher) groupID(op itemimage.Operation) string {
+	image := op.Keys
+	if image == nil {
+		image = op.NewImage
+	}
+	keys := make(map[string]types.AttributeValue, len(p.keyAttrs))
+	for _, attr := range p.keyAttrs {
+		if v, ok := image[attr]; ok {
+			keys[attr] = v
+		}
+	}
+	sum := sha256.Sum256([]byte(itemimage.KeyFingerprint(keys)))
+	return hex.EncodeToString(sum[:])
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// Compile-time check that Publisher can replace the DynamoDB writer.
+var _ writer.Writer = (*Publisher)(nil)
@@ -0,0 +1,141 @@
+package buffer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+func s(v string) types.AttributeValue { return &types.AttributeValueMemberS{Value: v} }
+
+// TestEncodeDecodeRoundTrip checks every operation type survives the queue with
+// its images, provenance and write timestamp, including keys-only deletes that
+// the images alone would not distinguish from other operations.
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	ops := []itemimage.Operation{
+		{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"pk": s("a"), "n": &types.AttributeValueMemberN{Value: "1.50"}},
+			SourceFile: "data/x.json.gz", ByteOffset: 42},
+		{Type: itemimage.OpPut, Keys: map[string]types.AttributeValue{"pk": s("a")}, NewImage: map[string]types.AttributeValue{"pk": s("a")},
+			OldImage: map[string]types.AttributeValue{"pk": s("a"), "old": s("x")}, WriteTimestampMicros: 1736848800000000},
+		{Type: itemimage.OpUpdate, Keys: map[string]types.AttributeValue{"pk": s("b")}, NewImage: map[string]types.AttributeValue{"pk": s("b"), "v": s("2")},
+			OldImage: map[string]types.AttributeValue{"pk": s("b"), "v": s("1")}},
+		{Type: itemimage.OpDelete, Keys: map[string]types.AttributeValue{"pk": s("c")}},
+	}
+	for _, op := range ops {
+		body, err := Encode(op)
+		if err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		got, err := Decode(body, itemimage.NewJSONDecoder())
+		if err != nil {
+			t.Fatalf("Decode(%s): %v", body, err)
+		}
+		if got.Type != op.Type || got.SourceFile != op.SourceFile || got.ByteOffset != op.ByteOffset ||
+			got.WriteTimestampMicros != op.WriteTimestampMicros || len(got.Keys) != len(op.Keys) ||
+			len(got.NewImage) != len(op.NewImage) || len(got.OldImage) != len(op.OldImage) {
+			t.Errorf("round trip of %s = %+v, want %+v", body, got, op)
+		}
+	}
+	if n := ops[0].NewImage["n"]; n.(*types.AttributeValueMemberN).Value != "1.50" {
+		t.Errorf("number changed to %v", n)
+	}
+
+	if _, err := Decode([]byte(`{"Operation":"TRUNCATE","Keys":{"pk":{"S":"a"}}}`), itemimage.NewJSONDecoder()); err == nil {
+		t.Error("expected error for an unknown operation")
+	}
+}
+
+type fakeSQS struct {
+	sent     []*sqs.SendMessageBatchInput
+	failOnce map[string]bool // Entry IDs failed without sender fault on their first send
+	received []*sqs.ReceiveMessageOutput
+	deleted  []*sqs.DeleteMessageBatchInput
+}
+
+func (f *fakeSQS) SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	f.sent = append(f.sent, params)
+	out := &sqs.SendMessageBatchOutput{}
+	for _, e := range params.Entries {
+		if f.failOnce[*e.Id] {
+			delete(f.failOnce, *e.Id)
+			out.Failed = append(out.Failed, sqstypes.BatchResultErrorEntry{Id: e.Id, Code: strPtr("InternalError")})
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeSQS) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	if len(f.received) == 0 {
+		return &sqs.ReceiveMessageOutput{}, nil
+	}
+	out := f.received[0]
+	f.received = f.received[1:]
+	return out, nil
+}
+
+func (f *fakeSQS) DeleteMessageBatch(ctx context.Context, params *sqs.DeleteMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error) {
+	f.deleted = append(f.deleted, params)
+	return &sqs.DeleteMessageBatchOutput{}, nil
+}
+
+// TestPublisherGroupsByKey checks messages of one item share a message group
+// whether the key comes from Keys or, for full exports, from the item, so the
+// FIFO queue keeps their order, and that batches respect the SQS entry limit.
+func TestPublisherGroupsByKey(t *testing.T) {
+	client := &fakeSQS{}
+	pub := NewPublisher(client, "https://sqs.eu-west-1.amazonaws.com/123456789012/restore.fifo", []string{"pk"})
+	var ops []itemimage.Operation
+	for i := 0; i < 12; i++ {
+		ops = append(ops, itemimage.Operation{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"pk": s(strings.Repeat("k", i)), "v": s("1")}})
+	}
+	ops = append(ops, itemimage.Operation{Type: itemimage.OpDelete, Keys: map[string]types.AttributeValue{"pk": s("kk")}})
+	if err := pub.WriteBatch(context.Background(), ops); err != nil {
+		t.Fatalf("WriteBatch: %v", err)
+	}
+	if len(client.sent) != 2 || len(client.sent[0].Entries) != 10 || len(client.sent[1].Entries) != 3 {
+		t.Fatalf("sent %d batches, want 10 and 3 entries", len(client.sent))
+	}
+	put, del := client.sent[0].Entries[2], client.sent[1].Entries[2]
+	if *put.MessageGroupId != *del.MessageGroupId {
+		t.Errorf("put and delete of one item are in groups %s and %s", *put.MessageGroupId, *del.MessageGroupId)
+	}
+	if *put.MessageGroupId == *client.sent[0].Entries[3].MessageGroupId {
+		t.Error("different items share a message group")
+	}
+	if *put.MessageDeduplicationId == *del.MessageDeduplicationId {
+		t.Error("messages share a deduplication ID")
+	}
+}
+
+// TestPublisherRetriesFailedEntries checks entries SQS failed on its side are
+// resent alone, with their deduplication ID, so the others are not duplicated.
+func TestPublisherRetriesFailedEntries(t *testing.T) {
+	client := &fakeSQS{failOnce: map[string]bool{"1": true}}
+	pub := NewPublisher(client, "https://sqs.eu-west-1.amazonaws.com/123456789012/restore.fifo", []string{"pk"})
+	ops := []itemimage.Operation{
+		{Type: itemimage.OpDelete, Keys: map[string]types.AttributeValue{"pk": s("a")}},
+		{Type: itemimage.OpDelete, Keys: map[string]types.AttributeValue{"pk": s("b")}},
+	}
+	if err := pub.WriteBatch(context.Background(), ops); err != nil {
+		t.Fatalf("WriteBatch: %v", err)
+	}
+	if len(client.sent) != 2 || len(client.sent[1].Entries) != 1 ||
+		*client.sent[1].Entries[0].MessageDeduplicationId != *client.sent[0].Entries[1].MessageDeduplicationId {
+		t.Errorf("sent %+v, want the failed entry resent alone", client.sent)
+	}
+}
+
+// TestPublisherRejectsOversizedOperations checks an operation larger than an
+// SQS message fails instead of being truncated or dropped.
+func TestPublisherRejectsOversizedOperations(t *testing.T) {
+	pub := NewPublisher(&fakeSQS{}, "https://sqs.eu-west-1.amazonaws.com/123456789012/restore.fifo", []string{"pk"})
+	op := itemimage.Operation{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"pk": s("a"), "blob": s(strings.Repeat("x", maxBatchBytes))}}
+	if err := pub.WriteBatch(context.Background(), []itemimage.Operation{op}); err == nil || !strings.Contains(err.Error(), "SQS message") {
+		t.Errorf("WriteBatch() error = %v, want a size error", err)
+	}
+}
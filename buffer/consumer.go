@@ -0,0 +1,156 @@
+package buffer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/writer"
+)
+
+const (
+	receiveWaitSeconds = 20 // SQS long-poll duration, the maximum SQS allows
+	receiveBatchSize   = 10 // Messages received per poll, the maximum SQS allows
+)
+
+// ConsumeClient is the subset of the SQS client used to drain operations.
+type ConsumeClient interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessageBatch(ctx context.Context, params *sqs.DeleteMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error)
+}
+
+// Stats counts the operations a Consumer has applied.
+type Stats struct {
+	Messages int64 // Messages received and deleted
+	Puts     int64 // Puts written to each target
+	Deletes  int64 // Deletes written to each target
+	Updates  int64 // Updates written to each target
+}
+
+// Consumer drains operations published by a Publisher into one or more tables.
+// Messages are deleted only after their operations are written to every table,
+// so a consumer stopped at any point loses nothing; a restarted consumer writes
+// the undeleted messages again, which is safe because each is the state of an
+// item at one point in time.
+// Example:
+//
+//	c := buffer.NewConsumer(sqs.NewFromConfig(awsCfg), queueURL, []writer.Writer{w}, decoder, 10*time.Minute)
+//	stats, err := c.Run(ctx)
+type Consumer struct {
+	client   ConsumeClient
+	queueURL string
+	writers  []writer.Writer   // One writer per target table
+	decoder  itemimage.Decoder // Decoder of the images in each message
+	idle     time.Duration     // Stop after receiving nothing for this long (0 = run until cancelled)
+}
+
+// NewConsumer creates a Consumer draining queueURL into writers.
+func NewConsumer(client ConsumeClient, queueURL string, writers []writer.Writer, decoder itemimage.Decoder, idle time.Duration) *Consumer {
+	return &Consumer{client: client, queueURL: queueURL, writers: writers, decoder: decoder, idle: idle}
+}
+
+// Run receives and applies messages until the queue has been empty for the idle
+// duration or ctx is cancelled, which ends Run without an error. A message that
+// cannot be decoded or written fails Run and stays in the queue, to be
+// received again or moved to the queue's dead-letter queue by its redrive policy.
+func (c *Consumer) Run(ctx context.Context) (Stats, error) {
+	var stats Stats
+	lastMessage := time.Now()
+	for {
+		out, err := c.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:                    &c.queueURL,
+			MaxNumberOfMessages:         receiveBatchSize,
+			WaitTimeSeconds:             receiveWaitSeconds,
+			MessageSystemAttributeNames: []sqstypes.MessageSystemAttributeName{sqstypes.MessageSystemAttributeNameMessageGroupId},
+		})
+		if ctx.Err() != nil {
+			return stats, nil
+		}
+		if err != nil {
+			return stats, fmt.Errorf("failed to receive from queue %s: %w", c.queueURL, err)
+		}
+		if len(out.Messages) == 0 {
+			if c.idle > 0 && time.Since(lastMessage) >= c.idle {
+				return stats, nil
+			}
+			continue
+		}
+		lastMessage = time.Now()
+		if err := c.apply(ctx, out.Messages, &stats); err != nil {
+			if ctx.Err() != nil {
+				return stats, nil // Unfinished messages are received again
+			}
+			return stats, err
+		}
+	}
+}
+
+// apply writes the operations of msgs in order and deletes the messages. FIFO
+// queues deliver the messages of one group, one item, in order; a batch is
+// written before a second message of the same group joins the next, since
+// BatchWriteItem rejects two writes to one item.
+func (c *Consumer) apply(ctx context.Context, msgs []sqstypes.Message, stats *Stats) error {
+	var batch []itemimage.Operation
+	groups := make(map[string]bool, len(msgs))
+	write := func() error {
+		for _, w := range c.writers {
+			if err := w.WriteBatch(ctx, batch); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		clear(groups)
+		return nil
+	}
+	for _, msg := range msgs {
+		op, err := Decode([]byte(deref(msg.Body)), c.decoder)
+		if err != nil {
+			return fmt.Errorf("message %s: %w", deref(msg.MessageId), err)
+		}
+		group := msg.Attributes[string(sqstypes.MessageSystemAttributeNameMessageGroupId)]
+		if group == "" {
+			group = deref(msg.MessageId) // Standard queues have no groups
+		}
+		if groups[group] {
+			if err := write(); err != nil {
+				return err
+			}
+		}
+		batch = append(batch, op)
+		groups[group] = true
+		switch op.Type {
+		case itemimage.OpPut:
+			stats.Puts++
+		case itemimage.OpDelete:
+			stats.Deletes++
+		case itemimage.OpUpdate:
+			stats.Updates++
+		}
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	for _, w := range c.writers {
+		if err := w.Flush(ctx); err != nil {
+			return err
+		}
+	}
+
+	entries := make([]sqstypes.DeleteMessageBatchRequestEntry, len(msgs))
+	for i, msg := range msgs {
+		entries[i] = sqstypes.DeleteMessageBatchRequestEntry{Id: msg.MessageId, ReceiptHandle: msg.ReceiptHandle}
+	}
+	out, err := c.client.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{QueueUrl: &c.queueURL, Entries: entries})
+	if err != nil {
+		return fmt.Errorf("failed to delete messages from queue %s: %w", c.queueURL, err)
+	}
+	if len(out.Failed) > 0 {
+		// The messages are received and written again, which is safe but worth knowing
+		return fmt.Errorf("failed to delete %d messages from queue %s: %s", len(out.Failed), c.queueURL, deref(out.Failed[0].Message))
+	}
+	stats.Messages += int64(len(msgs))
+	return nil
+}
@@ -0,0 +1,95 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/writer"
+)
+
+type recordingWriter struct {
+	batches [][]itemimage.Operation
+	err     error
+}
+
+func (w *recordingWriter) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.batches = append(w.batches, append([]itemimage.Operation(nil), ops...))
+	return nil
+}
+
+func (w *recordingWriter) Flush(ctx context.Context) error { return nil }
+
+// messages encodes ops as received messages in the given groups.
+func messages(t *testing.T, ops []itemimage.Operation, groups []string) *sqs.ReceiveMessageOutput {
+	t.Helper()
+	out := &sqs.ReceiveMessageOutput{}
+	for i, op := range ops {
+		body, err := Encode(op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.Messages = append(out.Messages, sqstypes.Message{
+			MessageId:     strPtr(strconv.Itoa(i)),
+			ReceiptHandle: strPtr("receipt-" + strconv.Itoa(i)),
+			Body:          strPtr(string(body)),
+			Attributes:    map[string]string{"MessageGroupId": groups[i]},
+		})
+	}
+	return out
+}
+
+// TestConsumerAppliesInGroupOrder checks two messages of one item received
+// together are written in separate batches, in order, to every table, and that
+// messages are deleted only after being written.
+func TestConsumerAppliesInGroupOrder(t *testing.T) {
+	ops := []itemimage.Operation{
+		{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"pk": s("a"), "v": s("1")}},
+		{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"pk": s("b")}},
+		{Type: itemimage.OpDelete, Keys: map[string]types.AttributeValue{"pk": s("a")}},
+	}
+	client := &fakeSQS{received: []*sqs.ReceiveMessageOutput{messages(t, ops, []string{"ga", "gb", "ga"})}}
+	w1, w2 := &recordingWriter{}, &recordingWriter{}
+	c := NewConsumer(client, "https://sqs.eu-west-1.amazonaws.com/123456789012/restore.fifo",
+		[]writer.Writer{w1, w2}, itemimage.NewJSONDecoder(), time.Nanosecond)
+	stats, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if stats != (Stats{Messages: 3, Puts: 2, Deletes: 1}) {
+		t.Errorf("stats = %+v", stats)
+	}
+	for _, w := range []*recordingWriter{w1, w2} {
+		if len(w.batches) != 2 || len(w.batches[0]) != 2 || w.batches[1][0].Type != itemimage.OpDelete {
+			t.Errorf("batches = %v, want the delete of a after its put", w.batches)
+		}
+	}
+	if len(client.deleted) != 1 || len(client.deleted[0].Entries) != 3 {
+		t.Errorf("deleted %v, want all three messages", client.deleted)
+	}
+}
+
+// TestConsumerKeepsUnwrittenMessages checks a failed write stops the consumer
+// without deleting the messages, so they are received again.
+func TestConsumerKeepsUnwrittenMessages(t *testing.T) {
+	ops := []itemimage.Operation{{Type: itemimage.OpDelete, Keys: map[string]types.AttributeValue{"pk": s("a")}}}
+	client := &fakeSQS{received: []*sqs.ReceiveMessageOutput{messages(t, ops, []string{"ga"})}}
+	writeErr := errors.New("table not found")
+	c := NewConsumer(client, "https://sqs.eu-west-1.amazonaws.com/123456789012/restore.fifo",
+		[]writer.Writer{&recordingWriter{err: writeErr}}, itemimage.NewJSONDecoder(), time.Nanosecond)
+	if _, err := c.Run(context.Background()); !errors.Is(err, writeErr) {
+		t.Errorf("Run() error = %v, want %v", err, writeErr)
+	}
+	if len(client.deleted) != 0 {
+		t.Errorf("deleted %v after a failed write", client.deleted)
+	}
+}
@@ -0,0 +1,102 @@
+// Package buildinfo describes the ddb-pitr build: the version stamped into
+// release binaries, the commit and date they were built from, and the Go
+// toolchain. Reports, logs and checkpoints record it, so support can tell which
+// build produced them and later versions can tell what a checkpoint holds.
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Stamped into release builds with -ldflags:
+//
+//	go build -ldflags "-X github.com/gurre/ddb-pitr/buildinfo.version=v1.4.0 \
+//	    -X github.com/gurre/ddb-pitr/buildinfo.commit=$(git rev-parse HEAD) \
+//	    -X github.com/gurre/ddb-pitr/buildinfo.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/ddb-pitr
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// Info describes a build.
+type Info struct {
+	Version   string `json:"version"`             // Semantic version, e.g. v1.4.0; "devel" for builds without one
+	Commit    string `json:"commit,omitempty"`    // VCS revision built from; empty if unknown
+	Modified  bool   `json:"modified,omitempty"`  // Built from a tree with uncommitted changes
+	BuildDate string `json:"buildDate,omitempty"` // RFC 3339 time of the build, or of the commit for unstamped builds
+	GoVersion string `json:"goVersion"`           // Go toolchain, e.g. go1.24.2
+}
+
+// Get returns the build of the running binary. Fields not stamped with
+// -ldflags are taken from the build information the Go toolchain embeds: the
+// module version for go install, and the VCS revision and commit time for
+// builds from a checkout.
+// Example:
+//
+//	fmt.Printf("ddb-pitr %s\n", buildinfo.Get())
+func Get() Info {
+	return current()
+}
+
+// current reads the build information once; checkpoints record it on every save.
+var current = sync.OnceValue(func() Info {
+	bi, _ := debug.ReadBuildInfo()
+	return fromBuildInfo(bi)
+})
+
+// fromBuildInfo returns the build described by the stamped variables and bi,
+// which may be nil.
+func fromBuildInfo(bi *debug.BuildInfo) Info {
+	info := Info{Version: version, Commit: commit, BuildDate: date, GoVersion: runtime.Version()}
+	if bi == nil {
+		if info.Version == "" {
+			info.Version = "devel"
+		}
+		return info
+	}
+	if bi.GoVersion != "" {
+		info.GoVersion = bi.GoVersion
+	}
+	if v := bi.Main.Version; info.Version == "" && v != "" && v != "(devel)" {
+		info.Version = v
+	}
+	if info.Version == "" {
+		info.Version = "devel"
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = s.Value
+			}
+		case "vcs.time":
+			if info.BuildDate == "" {
+				info.BuildDate = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+// String formats the build on one line, e.g.
+// "v1.4.0 (commit 3f2a9c1e0b7d, built 2026-10-15T12:00:00Z, go1.24.2)".
+func (i Info) String() string {
+	s := i.Version + " ("
+	if i.Commit != "" {
+		s += fmt.Sprintf("commit %.12s", i.Commit)
+		if i.Modified {
+			s += "-dirty"
+		}
+		s += ", "
+	}
+	if i.BuildDate != "" {
+		s += "built " + i.BuildDate + ", "
+	}
+	return s + i.GoVersion + ")"
+}
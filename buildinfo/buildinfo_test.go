@@ -0,0 +1,50 @@
+package buildinfo
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+// vcsBuild is the build information of a go build from a checkout.
+var vcsBuild = &debug.BuildInfo{
+	GoVersion: "go1.24.2",
+	Main:      debug.Module{Path: "github.com/gurre/ddb-pitr", Version: "(devel)"},
+	Settings: []debug.BuildSetting{
+		{Key: "vcs.revision", Value: "3f2a9c1e0b7d4e58a1b2c3d4e5f60718293a4b5c"},
+		{Key: "vcs.time", Value: "2026-10-14T09:30:00Z"},
+		{Key: "vcs.modified", Value: "true"},
+	},
+}
+
+// TestUnstampedBuild checks a build from a checkout is identified by its
+// commit, so support can tell unreleased builds apart.
+func TestUnstampedBuild(t *testing.T) {
+	info := fromBuildInfo(vcsBuild)
+	want := Info{Version: "devel", Commit: "3f2a9c1e0b7d4e58a1b2c3d4e5f60718293a4b5c", Modified: true, BuildDate: "2026-10-14T09:30:00Z", GoVersion: "go1.24.2"}
+	if info != want {
+		t.Errorf("got %+v, want %+v", info, want)
+	}
+	if s := info.String(); s != "devel (commit 3f2a9c1e0b7d-dirty, built 2026-10-14T09:30:00Z, go1.24.2)" {
+		t.Errorf("unexpected string %q", s)
+	}
+}
+
+// TestStampedBuild checks the values stamped with -ldflags take precedence over
+// the toolchain's, and go install's module version is used when unstamped.
+func TestStampedBuild(t *testing.T) {
+	version, commit, date = "v1.4.0", "a1b2c3d4e5f6", "2026-10-15T12:00:00Z"
+	defer func() { version, commit, date = "", "", "" }()
+	info := fromBuildInfo(vcsBuild)
+	if info.Version != "v1.4.0" || info.Commit != "a1b2c3d4e5f6" || info.BuildDate != "2026-10-15T12:00:00Z" {
+		t.Errorf("expected the stamped values, got %+v", info)
+	}
+
+	version, commit, date = "", "", ""
+	installed := &debug.BuildInfo{GoVersion: "go1.24.2", Main: debug.Module{Version: "v1.3.0"}}
+	if s := fromBuildInfo(installed).String(); s != "v1.3.0 (go1.24.2)" {
+		t.Errorf("unexpected string %q", s)
+	}
+	if info := fromBuildInfo(nil); info.Version != "devel" || info.GoVersion == "" {
+		t.Errorf("expected a devel build, got %+v", info)
+	}
+}
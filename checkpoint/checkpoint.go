@@ -10,12 +10,14 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	json "github.com/goccy/go-json"
 	"github.com/gurre/ddb-pitr/aws"
+	"github.com/gurre/ddb-pitr/s3uri"
 )
 
 // State represents the current state of the restore operation as defined in section 4.7.
@@ -28,11 +30,31 @@ import (
 //	}
 //	fmt.Printf("Last processed file: %s\n", state.LastFile)
 type State struct {
-	ExportID       string `json:"exportId"`       // ID of the export being processed
-	LastFile       string `json:"lastFile"`       // Last file that was processed
-	LastByteOffset int64  `json:"lastByteOffset"` // Byte offset within the last file
+	ExportID       string           `json:"exportId"`                 // ID of the export being processed
+	LastFile       string           `json:"lastFile"`                 // Last file that was processed
+	LastByteOffset int64            `json:"lastByteOffset"`           // Byte offset within the last file
+	SavedAt        time.Time        `json:"savedAt"`                  // When the checkpoint was saved; zero in checkpoints written before it was recorded
+	CompletedFiles []string         `json:"completedFiles,omitempty"` // Files fully processed, in the order they completed
+	InProgress     map[string]int64 `json:"inProgress,omitempty"`     // Byte offset reached in each file started but not completed
+	Elapsed        time.Duration    `json:"elapsed,omitempty"`        // Time spent restoring up to SavedAt, over every run
+	Version        string           `json:"version,omitempty"`        // Version of ddb-pitr that saved the checkpoint; empty before it was recorded
+	Owner          string           `json:"owner,omitempty"`          // Restore the checkpoint belongs to, when saved by a store WithOwner
 }
 
+// Complete reports whether the state marks LastFile as fully processed.
+func (s State) Complete() bool {
+	return s.LastByteOffset == CompletedOffset
+}
+
+// Legacy reports whether the state was saved before completed files were
+// tracked, so only LastFile is known to have been processed.
+func (s State) Legacy() bool {
+	return s.LastFile != "" && s.CompletedFiles == nil && s.InProgress == nil
+}
+
+// CompletedOffset is the LastByteOffset saved once a file has been fully processed.
+const CompletedOffset = int64(-1)
+
 // Store interface defines the contract for saving and loading checkpoint state.
 // Example:
 //
@@ -58,6 +80,42 @@ type S3Store struct {
 	client aws.S3Client
 	bucket string
 	key    string
+	tags   map[string]string // Object tags of the checkpoint and its history; see WithTags
+	owner  string            // Restore the checkpoint belongs to; see WithOwner
+
+	// Rolling history; see WithHistory
+	history     HistoryClient
+	historySize int
+	historyKeys []string // Known history keys, oldest first; nil until listed
+	historyMu   sync.Mutex
+}
+
+// Option configures optional S3Store behavior.
+type Option func(*S3Store)
+
+// WithTags tags the checkpoint object and its history entries with tags, e.g.
+// the run ID of the restore saving them.
+// Example:
+//
+//	store, err := checkpoint.NewS3Store(client, "s3://my-bucket/checkpoints/restore-123.json",
+//	    checkpoint.WithTags(map[string]string{aws.RunIDTag: runID}))
+func WithTags(tags map[string]string) Option {
+	return func(s *S3Store) {
+		s.tags = tags
+	}
+}
+
+// WithOwner records owner in every checkpoint saved and refuses to load a
+// checkpoint with progress saved by another owner, or by none. It guards keys
+// derived from the export and target tables, which another restore must not
+// resume from.
+// Example:
+//
+//	store, err := checkpoint.NewS3Store(client, uri, checkpoint.WithOwner("arn:aws:dynamodb:...:export/01 into orders in us-west-2"))
+func WithOwner(owner string) Option {
+	return func(s *S3Store) {
+		s.owner = owner
+	}
 }
 
 // NewS3Store creates a new S3Store instance from an S3 URI.
@@ -68,20 +126,21 @@ type S3Store struct {
 //	if err != nil {
 //	    log.Fatal(err)
 //	}
-func NewS3Store(client aws.S3Client, uri string) (*S3Store, error) {
-	u, err := url.Parse(uri)
+func NewS3Store(client aws.S3Client, uri string, opts ...Option) (*S3Store, error) {
+	u, err := s3uri.ParseObject(uri)
 	if err != nil {
-		return nil, fmt.Errorf("invalid S3 URI: %w", err)
-	}
-	if u.Scheme != "s3" {
-		return nil, fmt.Errorf("invalid S3 URI scheme: %s", u.Scheme)
+		return nil, err
 	}
 
-	return &S3Store{
+	s := &S3Store{
 		client: client,
-		bucket: u.Host,
-		key:    strings.TrimPrefix(u.Path, "/"),
-	}, nil
+		bucket: u.Bucket,
+		key:    u.Key,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
 }
 
 // Load implements the checkpoint loading requirements from section 4.7.
@@ -118,6 +177,13 @@ func (s *S3Store) Load(ctx context.Context) (State, error) {
 	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
 		return State{}, fmt.Errorf("failed to decode checkpoint: %w", err)
 	}
+	if s.owner != "" && state.LastFile != "" && state.Owner != s.owner {
+		owner := state.Owner
+		if owner == "" {
+			owner = "a restore that did not record its owner"
+		}
+		return State{}, fmt.Errorf("checkpoint s3://%s/%s belongs to %s, not %s", s.bucket, s.key, owner, s.owner)
+	}
 
 	return state, nil
 }
@@ -136,6 +202,9 @@ func (s *S3Store) Load(ctx context.Context) (State, error) {
 //	    log.Fatal(err)
 //	}
 func (s *S3Store) Save(ctx context.Context, state State) error {
+	if s.owner != "" {
+		state.Owner = s.owner
+	}
 	data, err := json.Marshal(state)
 	if err != nil {
 		return fmt.Errorf("failed to encode checkpoint: %w", err)
@@ -143,14 +212,18 @@ func (s *S3Store) Save(ctx context.Context, state State) error {
 
 	// Use bytes.NewReader to avoid extra allocation from string conversion
 	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: &s.bucket,
-		Key:    &s.key,
-		Body:   bytes.NewReader(data),
+		Bucket:  &s.bucket,
+		Key:     &s.key,
+		Body:    bytes.NewReader(data),
+		Tagging: aws.Tagging(s.tags),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to save checkpoint: %w", err)
 	}
 
+	if s.history != nil {
+		return s.saveHistory(ctx, state, data)
+	}
 	return nil
 }
 
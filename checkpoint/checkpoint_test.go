@@ -171,12 +171,26 @@ func TestS3Store_NewValidURI(t *testing.T) {
 	}
 }
 
+// TestS3Store_LiteralKeys checks that keys with spaces, plus signs and percent
+// signs are used as written; decoding them would read and write another object.
+func TestS3Store_LiteralKeys(t *testing.T) {
+	store, err := NewS3Store(nil, "s3://my-bucket/run 1/a+b%20c.json")
+	if err != nil {
+		t.Fatalf("failed to create S3 store: %v", err)
+	}
+	if store.key != "run 1/a+b%20c.json" {
+		t.Errorf("key mismatch: got %q, want %q", store.key, "run 1/a+b%20c.json")
+	}
+}
+
 func TestS3Store_InvalidURI(t *testing.T) {
 	testCases := []string{
 		"http://bucket/key",
 		"https://bucket/key",
 		"file:///path/to/file",
 		"bucket/key",
+		"s3://bucket",
+		"s3://bucket/checkpoints/",
 	}
 
 	for _, uri := range testCases {
@@ -215,3 +229,38 @@ func TestMemoryStore_Overwrite(t *testing.T) {
 		t.Errorf("expected ExportID 'second', got %s", loaded.ExportID)
 	}
 }
+
+// TestFileStore_LegacyState checks a checkpoint written before completed files
+// were tracked loads as legacy, while one tracking them round-trips its files
+// and offsets.
+func TestFileStore_LegacyState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	if err := os.WriteFile(path, []byte(`{"exportId":"a","lastFile":"a","lastByteOffset":-1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewFileStore("file://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	state, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Legacy() {
+		t.Errorf("expected %+v to be legacy", state)
+	}
+
+	state.CompletedFiles = []string{"a"}
+	state.InProgress = map[string]int64{"b": 10}
+	if err := store.Save(ctx, state); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Legacy() || len(loaded.CompletedFiles) != 1 || loaded.InProgress["b"] != 10 {
+		t.Errorf("unexpected state after round trip: %+v", loaded)
+	}
+}
@@ -0,0 +1,144 @@
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/aws"
+	"github.com/gurre/ddb-pitr/s3uri"
+)
+
+// historySuffix is appended to the checkpoint key to form the prefix of its history.
+const historySuffix = ".history/"
+
+// historyTimeFormat names history objects so they sort by the time they were saved.
+const historyTimeFormat = "20060102T150405.000000000Z"
+
+// HistoryClient is the subset of the S3 client used to keep and read checkpoint history.
+type HistoryClient interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// WithHistory keeps a copy of each of the last n saved checkpoints next to the
+// checkpoint, under <key>.history/<timestamp>.json, for debugging resumes. Older
+// copies are deleted as new ones are saved.
+// Example:
+//
+//	store, err := checkpoint.NewS3Store(client, "s3://my-bucket/checkpoints/restore-123.json",
+//	    checkpoint.WithHistory(s3.NewFromConfig(cfg), 20))
+func WithHistory(client HistoryClient, n int) Option {
+	return func(s *S3Store) {
+		if n > 0 {
+			s.history = client
+			s.historySize = n
+		}
+	}
+}
+
+// saveHistory writes data as the newest history entry and deletes the entries
+// beyond historySize, oldest first.
+func (s *S3Store) saveHistory(ctx context.Context, state State, data []byte) error {
+	savedAt := state.SavedAt
+	if savedAt.IsZero() {
+		savedAt = time.Now()
+	}
+	key := s.key + historySuffix + savedAt.UTC().Format(historyTimeFormat) + ".json"
+
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+	if s.historyKeys == nil {
+		keys, err := listHistory(ctx, s.history, s3uri.URI{Bucket: s.bucket, Key: s.key})
+		if err != nil {
+			return err
+		}
+		s.historyKeys = keys
+	}
+
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:  &s.bucket,
+		Key:     &key,
+		Body:    bytes.NewReader(data),
+		Tagging: aws.Tagging(s.tags),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint history: %w", err)
+	}
+	if n := len(s.historyKeys); n == 0 || s.historyKeys[n-1] != key {
+		s.historyKeys = append(s.historyKeys, key)
+	}
+
+	for len(s.historyKeys) > s.historySize {
+		old := s.historyKeys[0]
+		if _, err := s.history.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &s.bucket, Key: &old}); err != nil {
+			return fmt.Errorf("failed to delete checkpoint history %s: %w", old, err)
+		}
+		s.historyKeys = s.historyKeys[1:]
+	}
+	return nil
+}
+
+// listHistory returns the history keys of the checkpoint at u, oldest first.
+func listHistory(ctx context.Context, client HistoryClient, u s3uri.URI) ([]string, error) {
+	keys := []string{}
+	input := &s3.ListObjectsV2Input{
+		Bucket: awssdk.String(u.Bucket),
+		Prefix: awssdk.String(u.Key + historySuffix),
+	}
+	for {
+		out, err := client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list checkpoint history: %w", err)
+		}
+		for _, obj := range out.Contents {
+			if key := awssdk.ToString(obj.Key); strings.HasSuffix(key, ".json") {
+				keys = append(keys, key)
+			}
+		}
+		if !awssdk.ToBool(out.IsTruncated) {
+			break
+		}
+		input.ContinuationToken = out.NextContinuationToken
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// LoadHistory returns the history kept by WithHistory for the checkpoint at uri,
+// oldest first.
+// Example:
+//
+//	states, err := checkpoint.LoadHistory(ctx, s3.NewFromConfig(cfg), "s3://my-bucket/checkpoints/restore-123.json")
+func LoadHistory(ctx context.Context, client HistoryClient, uri string) ([]State, error) {
+	u, err := s3uri.ParseObject(uri)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := listHistory(ctx, client, u)
+	if err != nil {
+		return nil, err
+	}
+	states := make([]State, 0, len(keys))
+	for _, key := range keys {
+		resp, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: awssdk.String(u.Bucket), Key: awssdk.String(key)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get checkpoint history %s: %w", key, err)
+		}
+		var state State
+		err = json.NewDecoder(resp.Body).Decode(&state)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode checkpoint history %s: %w", key, err)
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
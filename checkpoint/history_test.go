@@ -0,0 +1,203 @@
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// memS3 is an in-memory bucket implementing the S3 calls used by S3Store.
+type memS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	tagging map[string]string // Tagging of each put object, by key
+}
+
+func newMemS3() *memS3 {
+	return &memS3{objects: make(map[string][]byte), tagging: make(map[string]string)}
+}
+
+func (m *memS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[*params.Key]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (m *memS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[*params.Key] = data
+	m.tagging[*params.Key] = awssdk.ToString(params.Tagging)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (m *memS3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{}, nil
+}
+
+func (m *memS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for key := range m.objects {
+		if strings.HasPrefix(key, awssdk.ToString(params.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	out := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		out.Contents = append(out.Contents, types.Object{Key: awssdk.String(key)})
+	}
+	return out, nil
+}
+
+func (m *memS3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, *params.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// TestS3Store_History verifies that the last n checkpoints are kept under
+// timestamped keys, older ones are pruned, and a later run picks up the history
+// written by an earlier one.
+func TestS3Store_History(t *testing.T) {
+	ctx := context.Background()
+	client := newMemS3()
+	const uri = "s3://my-bucket/checkpoints/run.json"
+	start := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	store, err := NewS3Store(client, uri, WithHistory(client, 3))
+	if err != nil {
+		t.Fatalf("NewS3Store failed: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		state := State{LastFile: "data/a.json.gz", LastByteOffset: int64(i * 100), SavedAt: start.Add(time.Duration(i) * time.Minute)}
+		if err := store.Save(ctx, state); err != nil {
+			t.Fatalf("Save %d failed: %v", i, err)
+		}
+	}
+
+	// A new store, as on resume, continues the same history
+	store, err = NewS3Store(client, uri, WithHistory(client, 3))
+	if err != nil {
+		t.Fatalf("NewS3Store failed: %v", err)
+	}
+	if err := store.Save(ctx, State{LastFile: "data/b.json.gz", LastByteOffset: CompletedOffset, SavedAt: start.Add(time.Hour)}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	history, err := LoadHistory(ctx, client, uri)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("expected 3 history entries, got %d: %+v", len(history), history)
+	}
+	if history[0].LastByteOffset != 200 || history[1].LastByteOffset != 300 || !history[2].Complete() {
+		t.Errorf("expected the last three checkpoints oldest first, got %+v", history)
+	}
+	if _, ok := client.objects["checkpoints/run.json.history/20261015T120300.000000000Z.json"]; !ok {
+		t.Errorf("expected a timestamped history key, got %v", client.objects)
+	}
+
+	latest, err := store.Load(ctx)
+	if err != nil || latest.LastFile != "data/b.json.gz" || !latest.SavedAt.Equal(start.Add(time.Hour)) {
+		t.Errorf("expected the latest checkpoint with its save time, got %+v (%v)", latest, err)
+	}
+}
+
+// TestS3Store_NoHistoryByDefault checks that without WithHistory only the
+// checkpoint itself is written.
+func TestS3Store_NoHistoryByDefault(t *testing.T) {
+	client := newMemS3()
+	store, err := NewS3Store(client, "s3://my-bucket/run.json")
+	if err != nil {
+		t.Fatalf("NewS3Store failed: %v", err)
+	}
+	if err := store.Save(context.Background(), State{LastFile: "f", LastByteOffset: 1}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if len(client.objects) != 1 {
+		t.Errorf("expected only the checkpoint, got %v", client.objects)
+	}
+}
+
+// TestS3Store_Tags verifies the checkpoint and its history entries carry the
+// store's tags, so cleanup automation can find the objects of one run.
+func TestS3Store_Tags(t *testing.T) {
+	client := newMemS3()
+	store, err := NewS3Store(client, "s3://my-bucket/checkpoints/run.json",
+		WithHistory(client, 1), WithTags(map[string]string{"ddb-pitr:run-id": "4f9c2a1b"}))
+	if err != nil {
+		t.Fatalf("NewS3Store failed: %v", err)
+	}
+	if err := store.Save(context.Background(), State{LastFile: "data/a.json.gz", SavedAt: time.Now()}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if len(client.tagging) != 2 {
+		t.Fatalf("expected a checkpoint and a history entry, got %v", client.tagging)
+	}
+	for key, tagging := range client.tagging {
+		if tagging != "ddb-pitr%3Arun-id=4f9c2a1b" {
+			t.Errorf("unexpected tagging of %s: %q", key, tagging)
+		}
+	}
+}
+
+// TestS3Store_Owner verifies a store WithOwner stamps its checkpoints and refuses
+// to resume progress saved by another restore, or by one that recorded no owner,
+// while an empty checkpoint is free to take over.
+func TestS3Store_Owner(t *testing.T) {
+	ctx := context.Background()
+	client := newMemS3()
+	const uri = "s3://my-bucket/ddb-pitr/checkpoints/us-west-2/01-orders.json"
+	mine, err := NewS3Store(client, uri, WithOwner("export/01 into orders in us-west-2"))
+	if err != nil {
+		t.Fatalf("NewS3Store failed: %v", err)
+	}
+	if _, err := mine.Load(ctx); err != nil {
+		t.Fatalf("Load of a missing checkpoint failed: %v", err)
+	}
+	if err := mine.Save(ctx, State{LastFile: "data/a.json.gz", SavedAt: time.Now()}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	state, err := mine.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if state.Owner != "export/01 into orders in us-west-2" {
+		t.Errorf("Owner = %q", state.Owner)
+	}
+
+	other, _ := NewS3Store(client, uri, WithOwner("export/02 into orders in us-west-2"))
+	if _, err := other.Load(ctx); err == nil || !strings.Contains(err.Error(), "belongs to export/01") {
+		t.Errorf("expected another owner's checkpoint to be refused, got %v", err)
+	}
+
+	plain, _ := NewS3Store(client, uri)
+	if err := plain.Save(ctx, State{LastFile: "data/b.json.gz", SavedAt: time.Now()}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := mine.Load(ctx); err == nil || !strings.Contains(err.Error(), "did not record its owner") {
+		t.Errorf("expected an ownerless checkpoint to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFakeAfter checks that timers fire only once the clock reaches their
+// deadline, and that Now reports the advanced time.
+func TestFakeAfter(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clk := NewFake(start)
+	ch := clk.After(10 * time.Second)
+
+	clk.Advance(9 * time.Second)
+	select {
+	case <-ch:
+		t.Fatal("timer fired before its deadline")
+	default:
+	}
+
+	clk.Advance(time.Second)
+	select {
+	case at := <-ch:
+		if !at.Equal(start.Add(10 * time.Second)) {
+			t.Errorf("timer fired at %v, want %v", at, start.Add(10*time.Second))
+		}
+	default:
+		t.Fatal("timer did not fire at its deadline")
+	}
+	if got := clk.Now(); !got.Equal(start.Add(10 * time.Second)) {
+		t.Errorf("Now = %v after advancing 10s", got)
+	}
+	if immediate := clk.After(0); len(immediate) != 1 {
+		t.Error("expected a zero duration timer to fire at once")
+	}
+}
+
+// TestFakeTicker checks that a ticker keeps firing every period until stopped,
+// and that BlockUntil sees it as pending.
+func TestFakeTicker(t *testing.T) {
+	clk := NewFake(time.Unix(0, 0))
+	ticker := clk.NewTicker(5 * time.Second)
+	clk.BlockUntil(1)
+
+	for i := 0; i < 3; i++ {
+		clk.Advance(5 * time.Second)
+		select {
+		case <-ticker.C():
+		default:
+			t.Fatalf("tick %d missing", i)
+		}
+	}
+
+	ticker.Stop()
+	clk.Advance(time.Minute)
+	select {
+	case <-ticker.C():
+		t.Error("stopped ticker fired")
+	default:
+	}
+}
+
+// TestFakeBlockUntil checks that BlockUntil returns once another goroutine
+// starts waiting, which is how tests synchronise with code under test.
+func TestFakeBlockUntil(t *testing.T) {
+	clk := NewFake(time.Unix(0, 0))
+	done := make(chan struct{})
+	go func() {
+		<-clk.After(time.Hour)
+		close(done)
+	}()
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Hour)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter was not released by Advance")
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	json "github.com/goccy/go-json"
+)
+
+// minIncrementalWindow is the shortest period DynamoDB accepts for an incremental export.
+const minIncrementalWindow = 15 * time.Minute
+
+// exportPollInterval is how often generate-chain checks on running exports.
+const exportPollInterval = 30 * time.Second
+
+// ChainExport describes one export of a generated chain.
+type ChainExport struct {
+	Type        string    `json:"type"`        // FULL_EXPORT or INCREMENTAL_EXPORT
+	ARN         string    `json:"arn"`         // Export ARN
+	From        time.Time `json:"from"`        // Start of an incremental export's window; zero for FULL
+	To          time.Time `json:"to"`          // Export time of a FULL export, end of an incremental window
+	ManifestURI string    `json:"manifestUri"` // s3:// URI of the export's manifest-summary.json
+}
+
+// ChainExpected describes the final state of the table after the last export.
+type ChainExpected struct {
+	ItemCount int      `json:"itemCount"` // Items present
+	Updated   []string `json:"updated"`   // "PK/SK" keys whose data attribute is "updated-<i>"
+	Deleted   []string `json:"deleted"`   // "PK/SK" keys deleted after the FULL export
+}
+
+// ChainManifest is written by generate-chain mode. Restoring the FULL export and
+// then the incremental exports in order must produce Expected, which verify mode
+// checks with VerifyArgs.
+type ChainManifest struct {
+	Table       string        `json:"table"`
+	TableARN    string        `json:"tableArn"`
+	Seed        int64         `json:"seed"`
+	Items       int           `json:"items"`
+	UpdateCount int           `json:"updateCount"`
+	DeleteCount int           `json:"deleteCount"`
+	GSI         bool          `json:"gsi"`
+	LSI         bool          `json:"lsi"`
+	Exports     []ChainExport `json:"exports"`
+	Expected    ChainExpected `json:"expected"`
+	VerifyArgs  string        `json:"verifyArgs"` // ddb-datagen flags verifying a restored copy
+}
+
+// chainStep returns the range [from, to) of n operations done in step s of steps.
+func chainStep(n, s, steps int) (int, int) {
+	return n * s / steps, n * (s + 1) / steps
+}
+
+// runChainMode writes cfg.NumItems items, takes a FULL export and then, for each
+// of cfg.ChainSteps windows of cfg.ChainInterval, updates and deletes a share of
+// cfg.UpdateCount and cfg.DeleteCount items and takes an incremental export of
+// the window. Once every export has completed it writes a ChainManifest to
+// cfg.ChainManifest. The final state matches lifecycle mode with the same counts.
+func runChainMode(ctx context.Context, client DataGenerator, cfg Config, r *rand.Rand) error {
+	desc, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(cfg.TableName)})
+	if err != nil {
+		return fmt.Errorf("failed to describe table: %w", err)
+	}
+	tableARN := aws.ToString(desc.Table.TableArn)
+
+	if err := runPutMode(ctx, client, cfg, r); err != nil {
+		return err
+	}
+
+	exportTime := time.Now().UTC().Truncate(time.Second)
+	fmt.Printf("Starting FULL export at %s...\n", exportTime.Format(time.RFC3339))
+	arn, err := startExport(ctx, client, cfg, tableARN, &dynamodb.ExportTableToPointInTimeInput{
+		ExportType: types.ExportTypeFullExport,
+		ExportTime: aws.Time(exportTime),
+	})
+	if err != nil {
+		return err
+	}
+	exports := []ChainExport{{Type: string(types.ExportTypeFullExport), ARN: arn, To: exportTime}}
+
+	from := exportTime
+	for s := 0; s < cfg.ChainSteps; s++ {
+		to := from.Add(cfg.ChainInterval)
+
+		uFrom, uTo := chainStep(cfg.UpdateCount, s, cfg.ChainSteps)
+		dFrom, dTo := chainStep(cfg.DeleteCount, s, cfg.ChainSteps)
+		deleteStart := cfg.NumItems - cfg.DeleteCount
+		fmt.Printf("Step %d/%d: updating %d items, deleting %d items\n", s+1, cfg.ChainSteps, uTo-uFrom, dTo-dFrom)
+		updated := updateItems(ctx, client, cfg, uFrom, uTo)
+		deleted := deleteItems(ctx, client, cfg, deleteStart+dFrom, deleteStart+dTo)
+		if updated != uTo-uFrom || deleted != dTo-dFrom {
+			return fmt.Errorf("step %d: %d of %d updates and %d of %d deletes succeeded", s+1, updated, uTo-uFrom, deleted, dTo-dFrom)
+		}
+
+		fmt.Printf("Waiting until %s to export the window...\n", to.Format(time.RFC3339))
+		select {
+		case <-time.After(time.Until(to)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		arn, err := startExport(ctx, client, cfg, tableARN, &dynamodb.ExportTableToPointInTimeInput{
+			ExportType: types.ExportTypeIncrementalExport,
+			IncrementalExportSpecification: &types.IncrementalExportSpecification{
+				ExportFromTime: aws.Time(from),
+				ExportToTime:   aws.Time(to),
+				ExportViewType: types.ExportViewTypeNewAndOldImages,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		exports = append(exports, ChainExport{Type: string(types.ExportTypeIncrementalExport), ARN: arn, From: from, To: to})
+		from = to
+	}
+
+	for i := range exports {
+		uri, err := waitForExport(ctx, client, exports[i].ARN)
+		if err != nil {
+			return err
+		}
+		exports[i].ManifestURI = uri
+		fmt.Printf("Export %s completed: %s\n", exports[i].ARN, uri)
+	}
+
+	manifest := ChainManifest{
+		Table:       cfg.TableName,
+		TableARN:    tableARN,
+		Seed:        cfg.Seed,
+		Items:       cfg.NumItems,
+		UpdateCount: cfg.UpdateCount,
+		DeleteCount: cfg.DeleteCount,
+		GSI:         cfg.EnableGSI,
+		LSI:         cfg.EnableLSI,
+		Exports:     exports,
+		Expected:    chainExpected(cfg),
+		VerifyArgs:  verifyArgs(cfg),
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode chain manifest: %w", err)
+	}
+	if err := os.WriteFile(cfg.ChainManifest, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write chain manifest: %w", err)
+	}
+	fmt.Printf("Chain manifest written to %s\n", cfg.ChainManifest)
+	return nil
+}
+
+// startExport starts an export of the table to cfg.ExportBucket and returns its ARN.
+func startExport(ctx context.Context, client DataGenerator, cfg Config, tableARN string, input *dynamodb.ExportTableToPointInTimeInput) (string, error) {
+	input.TableArn = aws.String(tableARN)
+	input.S3Bucket = aws.String(cfg.ExportBucket)
+	if cfg.ExportPrefix != "" {
+		input.S3Prefix = aws.String(cfg.ExportPrefix)
+	}
+	input.ExportFormat = types.ExportFormatDynamodbJson
+	out, err := client.ExportTableToPointInTime(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to start %s: %w", input.ExportType, err)
+	}
+	return aws.ToString(out.ExportDescription.ExportArn), nil
+}
+
+// waitForExport polls the export until it completes and returns the s3:// URI of
+// its manifest-summary.json.
+func waitForExport(ctx context.Context, client DataGenerator, arn string) (string, error) {
+	for {
+		out, err := client.DescribeExport(ctx, &dynamodb.DescribeExportInput{ExportArn: aws.String(arn)})
+		if err != nil {
+			return "", fmt.Errorf("failed to describe export %s: %w", arn, err)
+		}
+		desc := out.ExportDescription
+		switch desc.ExportStatus {
+		case types.ExportStatusCompleted:
+			return fmt.Sprintf("s3://%s/%s", aws.ToString(desc.S3Bucket), aws.ToString(desc.ExportManifest)), nil
+		case types.ExportStatusFailed:
+			return "", fmt.Errorf("export %s failed: %s: %s", arn, aws.ToString(desc.FailureCode), aws.ToString(desc.FailureMessage))
+		}
+		select {
+		case <-time.After(exportPollInterval):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// chainExpected lists the keys updated and deleted by the chain.
+func chainExpected(cfg Config) ChainExpected {
+	expected := ChainExpected{ItemCount: cfg.NumItems - cfg.DeleteCount}
+	for i := 0; i < cfg.UpdateCount; i++ {
+		expected.Updated = append(expected.Updated, cfg.itemKey(cfg.key(i)))
+	}
+	for i := cfg.NumItems - cfg.DeleteCount; i < cfg.NumItems; i++ {
+		expected.Deleted = append(expected.Deleted, cfg.itemKey(cfg.key(i)))
+	}
+	return expected
+}
+
+// verifyArgs returns the verify mode flags for a copy restored from the chain;
+// the copy's name is left for the caller to append with -table.
+func verifyArgs(cfg Config) string {
+	args := []string{
+		"-mode verify",
+		fmt.Sprintf("-seed %d", cfg.Seed),
+		fmt.Sprintf("-items %d", cfg.NumItems),
+		fmt.Sprintf("-update-count %d", cfg.UpdateCount),
+		fmt.Sprintf("-delete-count %d", cfg.DeleteCount),
+		"-origin-table " + cfg.TableName,
+	}
+	if cfg.EnableGSI {
+		args = append(args, "-gsi")
+	}
+	if cfg.EnableLSI {
+		args = append(args, "-lsi")
+	}
+	if p := cfg.Profile.String(); p != "default" {
+		args = append(args, "-profile "+p)
+	}
+	if cfg.SchemaPath != "" {
+		args = append(args, "-schema "+cfg.SchemaPath)
+	}
+	return strings.Join(args, " ")
+}
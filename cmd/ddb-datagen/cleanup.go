@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// createdByTag marks tables created by ddb-datagen, so cleanup never deletes a
+// table that merely shares the name prefix.
+const createdByTag = "created-by"
+
+// createdByValue is the value of createdByTag.
+const createdByValue = "ddb-datagen"
+
+// List prices in us-east-1, used for rough estimates only.
+const (
+	storagePricePerGBMonth = 0.25  // On-demand table storage
+	pitrPricePerGBMonth    = 0.20  // Continuous backups
+	writePricePerMillion   = 0.625 // On-demand write request units
+)
+
+// sizeSampleItems is how many items are generated to estimate the average item size.
+const sizeSampleItems = 100
+
+const bytesPerGB = 1 << 30
+
+// runCleanupMode finds tables carrying the ddb-datagen- prefix and created-by tag,
+// or just cfg.TableName when set, and reports their size and the monthly storage
+// and PITR cost they incur. With cfg.Confirm it disables PITR on each and deletes it.
+func runCleanupMode(ctx context.Context, client DataGenerator, cfg Config) error {
+	names := []string{cfg.TableName}
+	if cfg.TableName == "" {
+		var err error
+		if names, err = listDatagenTables(ctx, client); err != nil {
+			return err
+		}
+	}
+
+	var totalBytes int64
+	var found int
+	for _, name := range names {
+		desc, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(name)})
+		if err != nil {
+			return fmt.Errorf("failed to describe table %s: %w", name, err)
+		}
+		tags, err := client.ListTagsOfResource(ctx, &dynamodb.ListTagsOfResourceInput{ResourceArn: desc.Table.TableArn})
+		if err != nil {
+			return fmt.Errorf("failed to list tags of %s: %w", name, err)
+		}
+		if !hasCreatedByTag(tags.Tags) {
+			fmt.Printf("Skipping %s: not tagged %s=%s\n", name, createdByTag, createdByValue)
+			continue
+		}
+
+		found++
+		size := aws.ToInt64(desc.Table.TableSizeBytes)
+		totalBytes += size
+		fmt.Printf("%s: %d items, %.3f GB, ~$%.2f/month\n", name, aws.ToInt64(desc.Table.ItemCount),
+			float64(size)/bytesPerGB, monthlyCost(size))
+		if !cfg.Confirm {
+			continue
+		}
+
+		_, err = client.UpdateContinuousBackups(ctx, &dynamodb.UpdateContinuousBackupsInput{
+			TableName: aws.String(name),
+			PointInTimeRecoverySpecification: &types.PointInTimeRecoverySpecification{
+				PointInTimeRecoveryEnabled: aws.Bool(false),
+			},
+		})
+		if err != nil {
+			log.Printf("Warning: Failed to disable PITR on %s: %v", name, err)
+		}
+		if _, err := client.DeleteTable(ctx, &dynamodb.DeleteTableInput{TableName: aws.String(name)}); err != nil {
+			return fmt.Errorf("failed to delete table %s: %w", name, err)
+		}
+		fmt.Printf("Deleted %s\n", name)
+	}
+
+	fmt.Printf("\n%d tables, %.3f GB, ~$%.2f/month in storage and PITR\n", found, float64(totalBytes)/bytesPerGB, monthlyCost(totalBytes))
+	if !cfg.Confirm && found > 0 {
+		fmt.Println("Run again with -confirm to disable PITR and delete them")
+	}
+	return nil
+}
+
+// listDatagenTables returns the tables named with the ddb-datagen- prefix.
+func listDatagenTables(ctx context.Context, client DataGenerator) ([]string, error) {
+	var names []string
+	input := &dynamodb.ListTablesInput{}
+	for {
+		out, err := client.ListTables(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+		for _, name := range out.TableNames {
+			if strings.HasPrefix(name, tableNamePrefix) {
+				names = append(names, name)
+			}
+		}
+		if out.LastEvaluatedTableName == nil {
+			return names, nil
+		}
+		input.ExclusiveStartTableName = out.LastEvaluatedTableName
+	}
+}
+
+// hasCreatedByTag reports whether tags mark the table as created by ddb-datagen.
+func hasCreatedByTag(tags []types.Tag) bool {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == createdByTag && aws.ToString(tag.Value) == createdByValue {
+			return true
+		}
+	}
+	return false
+}
+
+// monthlyCost estimates the monthly storage and PITR cost of size bytes.
+func monthlyCost(size int64) float64 {
+	return float64(size) / bytesPerGB * (storagePricePerGBMonth + pitrPricePerGBMonth)
+}
+
+// checkCostGuard estimates the size and write cost of generating cfg.NumItems
+// items from a sample drawn with its own random source, and refuses to go on when
+// they exceed cfg.MaxItems or cfg.MaxSizeGB.
+func checkCostGuard(cfg Config) error {
+	r := rand.New(rand.NewSource(cfg.Seed))
+	var sampleBytes int64
+	sample := min(cfg.NumItems, sizeSampleItems)
+	for i := 0; i < sample; i++ {
+		sampleBytes += itemimage.ItemSize(generateItem(r, i, cfg))
+	}
+	var avg int64
+	if sample > 0 {
+		avg = sampleBytes / int64(sample)
+	}
+	size := avg * int64(cfg.NumItems)
+	// A write request unit covers 1KB of an item
+	writeUnits := (avg + 1023) / 1024 * int64(cfg.NumItems)
+	fmt.Printf("Estimated data: %d items of ~%d bytes, %.3f GB, ~$%.2f in writes, ~$%.2f/month in storage and PITR\n",
+		cfg.NumItems, avg, float64(size)/bytesPerGB, float64(writeUnits)/1e6*writePricePerMillion, monthlyCost(size))
+
+	if cfg.MaxItems > 0 && cfg.NumItems > cfg.MaxItems {
+		return fmt.Errorf("%d items exceeds -max-items %d", cfg.NumItems, cfg.MaxItems)
+	}
+	if cfg.MaxSizeGB > 0 && float64(size)/bytesPerGB > cfg.MaxSizeGB {
+		return fmt.Errorf("estimated %.3f GB exceeds -max-size %g GB", float64(size)/bytesPerGB, cfg.MaxSizeGB)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 // Package main provides a data generator for DynamoDB tables.
 // It supports creating tables with GSI/LSI, populating with test data,
-// and performing lifecycle operations (UPDATE/DELETE) for PITR verification.
+// performing lifecycle operations (UPDATE/DELETE) for PITR verification, and
+// generating chains of FULL and incremental exports as restore fixtures.
 package main
 
 import (
@@ -9,6 +10,8 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -23,11 +26,19 @@ const tableNamePrefix = "ddb-datagen-"
 // The AWS DynamoDB client satisfies this interface.
 type DataGenerator interface {
 	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
 	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
 	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
 	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
 	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
 	UpdateContinuousBackups(ctx context.Context, params *dynamodb.UpdateContinuousBackupsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateContinuousBackupsOutput, error)
+	UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error)
+	ListTables(ctx context.Context, params *dynamodb.ListTablesInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTablesOutput, error)
+	ListTagsOfResource(ctx context.Context, params *dynamodb.ListTagsOfResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTagsOfResourceOutput, error)
+	DeleteTable(ctx context.Context, params *dynamodb.DeleteTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteTableOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	ExportTableToPointInTime(ctx context.Context, params *dynamodb.ExportTableToPointInTimeInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ExportTableToPointInTimeOutput, error)
+	DescribeExport(ctx context.Context, params *dynamodb.DescribeExportInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeExportOutput, error)
 }
 
 // Compile-time check that dynamodb.Client satisfies DataGenerator
@@ -36,13 +47,33 @@ var _ DataGenerator = (*dynamodb.Client)(nil)
 // Config holds the command-line configuration for the data generator.
 type Config struct {
 	TableName   string
+	OriginTable string // Table the verified data was generated into, when verifying a copy
 	NumItems    int
-	Mode        string // "put" or "lifecycle"
+	Mode        string // "put", "lifecycle", "verify", "generate-chain", "synth" or "cleanup"
 	UpdateCount int
 	DeleteCount int
 	Seed        int64
 	EnableGSI   bool
 	EnableLSI   bool
+	Concurrency int     // BatchWriteItem workers in put mode
+	Rate        float64 // Maximum items written per second in put mode (0 = unlimited)
+	Profile     Profile // Generators shaping the data
+	SchemaPath  string  // Schema file, when set
+	Schema      *Schema // Keys and attributes loaded from SchemaPath
+	MaxItems    int     // Refuse to generate more items (0 = unlimited)
+	MaxSizeGB   float64 // Refuse to generate more estimated data (0 = unlimited)
+	Confirm     bool    // Let cleanup mode delete the tables it lists
+
+	ExportBucket  string        // S3 bucket receiving generate-chain exports
+	ExportPrefix  string        // S3 prefix of generate-chain exports
+	ChainSteps    int           // Incremental exports taken by generate-chain
+	ChainInterval time.Duration // Window of each incremental export
+	ChainManifest string        // Path the generate-chain manifest is written to
+
+	SynthDir    string // Directory synth mode writes exports to
+	InsertCount int    // Items inserted by synth mode's incremental exports
+	DataFiles   int    // Data files per export in synth mode
+	ItemBytes   int    // Payload size of synth mode's items
 }
 
 func randomString(r *rand.Rand, n int) string {
@@ -124,6 +155,42 @@ func generateUniqueBinaries(r *rand.Rand, n, minLen, maxLen int) [][]byte {
 	return binaries
 }
 
+// generateItem creates item id: the attributes of cfg.Schema, or the random
+// attributes of generateRandomItem, shaped by cfg.Profile.
+func generateItem(r *rand.Rand, id int, cfg Config) map[string]types.AttributeValue {
+	var item map[string]types.AttributeValue
+	if cfg.Schema != nil {
+		item = cfg.Schema.generate(r)
+	} else {
+		item = generateRandomItem(r, id, cfg.EnableGSI, cfg.EnableLSI)
+	}
+	cfg.Profile.apply(r, item)
+	for name, v := range cfg.key(id) {
+		item[name] = v
+	}
+	return item
+}
+
+// key returns the primary key of item id.
+func (cfg Config) key(id int) map[string]types.AttributeValue {
+	if cfg.Schema != nil {
+		return cfg.Schema.key(id)
+	}
+	pk, sk := cfg.Profile.Key(id)
+	return map[string]types.AttributeValue{
+		"PK": &types.AttributeValueMemberS{Value: pk},
+		"SK": &types.AttributeValueMemberS{Value: sk},
+	}
+}
+
+// keyNames returns the key attribute names; sk is empty without a sort key.
+func (cfg Config) keyNames() (pk, sk string) {
+	if cfg.Schema != nil {
+		return cfg.Schema.keyNames()
+	}
+	return "PK", "SK"
+}
+
 // generateRandomItem creates a random DynamoDB item with various attribute types.
 // When enableGSI or enableLSI is true, adds the required index attributes.
 func generateRandomItem(r *rand.Rand, id int, enableGSI, enableLSI bool) map[string]types.AttributeValue {
@@ -201,10 +268,10 @@ func generateRandomItem(r *rand.Rand, id int, enableGSI, enableLSI bool) map[str
 }
 
 // createTableWithIndexes creates a DynamoDB table with optional GSI and LSI.
-// Base schema: PK (string), SK (string)
+// Base schema: PK (string), SK (string), or the keys of schema when set
 // LSI "ByTimestamp": PK (string), timestamp (number)
 // GSI "ByCategory": category (string), createdAt (number)
-func createTableWithIndexes(ctx context.Context, client DataGenerator, tableName string, enableGSI, enableLSI bool) error {
+func createTableWithIndexes(ctx context.Context, client DataGenerator, tableName string, schema *Schema, enableGSI, enableLSI bool) error {
 	attrDefs := []types.AttributeDefinition{
 		{AttributeName: aws.String("PK"), AttributeType: types.ScalarAttributeTypeS},
 		{AttributeName: aws.String("SK"), AttributeType: types.ScalarAttributeTypeS},
@@ -215,11 +282,25 @@ func createTableWithIndexes(ctx context.Context, client DataGenerator, tableName
 		{AttributeName: aws.String("SK"), KeyType: types.KeyTypeRange},
 	}
 
+	if schema != nil {
+		attrDefs = []types.AttributeDefinition{
+			{AttributeName: aws.String(schema.PartitionKey.Name), AttributeType: types.ScalarAttributeType(schema.PartitionKey.Type)},
+		}
+		keySchema = []types.KeySchemaElement{
+			{AttributeName: aws.String(schema.PartitionKey.Name), KeyType: types.KeyTypeHash},
+		}
+		if sk := schema.SortKey; sk != nil {
+			attrDefs = append(attrDefs, types.AttributeDefinition{AttributeName: aws.String(sk.Name), AttributeType: types.ScalarAttributeType(sk.Type)})
+			keySchema = append(keySchema, types.KeySchemaElement{AttributeName: aws.String(sk.Name), KeyType: types.KeyTypeRange})
+		}
+	}
+
 	input := &dynamodb.CreateTableInput{
 		TableName:            aws.String(tableName),
 		AttributeDefinitions: attrDefs,
 		KeySchema:            keySchema,
 		BillingMode:          types.BillingModePayPerRequest,
+		Tags:                 []types.Tag{{Key: aws.String(createdByTag), Value: aws.String(createdByValue)}},
 	}
 
 	// Add LSI: ByTimestamp (same PK, timestamp as sort key)
@@ -259,29 +340,99 @@ func createTableWithIndexes(ctx context.Context, client DataGenerator, tableName
 	return err
 }
 
-// runPutMode creates new items in the table.
+// maxBatchWriteItems is the BatchWriteItem request limit.
+const maxBatchWriteItems = 25
+
+// progressInterval is how many written items pass between progress lines.
+const progressInterval = 1000
+
+// runPutMode creates new items in the table. Items are generated in order from r,
+// so a seed always produces the same dataset, and written in BatchWriteItem
+// requests by cfg.Concurrency workers, at most cfg.Rate items per second.
 func runPutMode(ctx context.Context, client DataGenerator, cfg Config, r *rand.Rand) error {
-	fmt.Printf("Generating %d items...\n", cfg.NumItems)
-	successCount := 0
+	fmt.Printf("Generating %d items with %d writers...\n", cfg.NumItems, cfg.Concurrency)
+
+	// Each worker waits for a tick per batch when rate limited
+	var ticks <-chan time.Time
+	if cfg.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) * maxBatchWriteItems / cfg.Rate))
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
 
+	batches := make(chan []map[string]types.AttributeValue, cfg.Concurrency)
+	var written, failed atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < cfg.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				if ticks != nil {
+					<-ticks
+				}
+				if err := batchPut(ctx, client, cfg.TableName, batch); err != nil {
+					log.Printf("Failed to write batch starting at %s: %v", cfg.itemKey(batch[0]), err)
+					failed.Add(int64(len(batch)))
+					continue
+				}
+				n := written.Add(int64(len(batch)))
+				if n/progressInterval != (n-int64(len(batch)))/progressInterval {
+					fmt.Printf("Written %d items...\n", n)
+				}
+			}
+		}()
+	}
+
+	batch := make([]map[string]types.AttributeValue, 0, maxBatchWriteItems)
 	for i := 0; i < cfg.NumItems; i++ {
-		item := generateRandomItem(r, i, cfg.EnableGSI, cfg.EnableLSI)
-		_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
-			TableName: aws.String(cfg.TableName),
-			Item:      item,
+		batch = append(batch, generateItem(r, i, cfg))
+		if len(batch) == maxBatchWriteItems || i == cfg.NumItems-1 {
+			batches <- batch
+			batch = make([]map[string]types.AttributeValue, 0, maxBatchWriteItems)
+		}
+	}
+	close(batches)
+	wg.Wait()
+
+	fmt.Printf("Items added: %d\n", written.Load())
+	if n := failed.Load(); n > 0 {
+		fmt.Printf("Items failed: %d\n", n)
+	}
+	return nil
+}
+
+// batchPut writes items with BatchWriteItem, retrying unprocessed items with
+// exponential backoff.
+func batchPut(ctx context.Context, client DataGenerator, tableName string, items []map[string]types.AttributeValue) error {
+	requests := make([]types.WriteRequest, len(items))
+	for i, item := range items {
+		requests[i] = types.WriteRequest{PutRequest: &types.PutRequest{Item: item}}
+	}
+
+	const maxAttempts = 8
+	backoff := 50 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		out, err := client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{tableName: requests},
 		})
 		if err != nil {
-			log.Printf("Failed to write item %d: %v", i, err)
-			continue
+			return err
 		}
-		successCount++
-		if (i+1)%10 == 0 {
-			fmt.Printf("Written %d items...\n", i+1)
+		requests = out.UnprocessedItems[tableName]
+		if len(requests) == 0 {
+			return nil
 		}
+		if attempt == maxAttempts {
+			return fmt.Errorf("%d items still unprocessed after %d attempts", len(requests), maxAttempts)
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
 	}
-
-	fmt.Printf("Items added: %d\n", successCount)
-	return nil
 }
 
 // runLifecycleMode performs UPDATE and DELETE operations on existing items.
@@ -290,23 +441,28 @@ func runLifecycleMode(ctx context.Context, client DataGenerator, cfg Config, r *
 	// Advance the random state to match where put mode left off
 	// This ensures lifecycle mode selects the same items regardless of when it's called
 	for i := 0; i < cfg.NumItems; i++ {
-		generateRandomItem(r, i, cfg.EnableGSI, cfg.EnableLSI)
+		generateItem(r, i, cfg)
 	}
 
 	fmt.Printf("Lifecycle mode: updating %d items, deleting %d items\n", cfg.UpdateCount, cfg.DeleteCount)
 
 	// Perform updates on first N items
-	updateSuccess := 0
-	for i := 0; i < cfg.UpdateCount; i++ {
-		pk := fmt.Sprintf("ITEM#%d", i)
-		sk := "METADATA"
+	fmt.Printf("Items updated: %d\n", updateItems(ctx, client, cfg, 0, cfg.UpdateCount))
 
+	// Delete last M items (from end of range to avoid overlap with updates)
+	fmt.Printf("Items deleted: %d\n", deleteItems(ctx, client, cfg, cfg.NumItems-cfg.DeleteCount, cfg.NumItems))
+
+	return nil
+}
+
+// updateItems sets the data attribute of items [from, to) to "updated-<i>" and
+// returns how many updates succeeded.
+func updateItems(ctx context.Context, client DataGenerator, cfg Config, from, to int) int {
+	updateSuccess := 0
+	for i := from; i < to; i++ {
 		_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
-			TableName: aws.String(cfg.TableName),
-			Key: map[string]types.AttributeValue{
-				"PK": &types.AttributeValueMemberS{Value: pk},
-				"SK": &types.AttributeValueMemberS{Value: sk},
-			},
+			TableName:        aws.String(cfg.TableName),
+			Key:              cfg.key(i),
 			UpdateExpression: aws.String("SET #data = :val, updatedAt = :ts"),
 			ExpressionAttributeNames: map[string]string{
 				"#data": "data",
@@ -322,21 +478,16 @@ func runLifecycleMode(ctx context.Context, client DataGenerator, cfg Config, r *
 		}
 		updateSuccess++
 	}
-	fmt.Printf("Items updated: %d\n", updateSuccess)
+	return updateSuccess
+}
 
-	// Delete last M items (from end of range to avoid overlap with updates)
+// deleteItems deletes items [from, to) and returns how many deletes succeeded.
+func deleteItems(ctx context.Context, client DataGenerator, cfg Config, from, to int) int {
 	deleteSuccess := 0
-	startDelete := cfg.NumItems - cfg.DeleteCount
-	for i := startDelete; i < cfg.NumItems; i++ {
-		pk := fmt.Sprintf("ITEM#%d", i)
-		sk := "METADATA"
-
+	for i := from; i < to; i++ {
 		_, err := client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
 			TableName: aws.String(cfg.TableName),
-			Key: map[string]types.AttributeValue{
-				"PK": &types.AttributeValueMemberS{Value: pk},
-				"SK": &types.AttributeValueMemberS{Value: sk},
-			},
+			Key:       cfg.key(i),
 		})
 		if err != nil {
 			log.Printf("Failed to delete item %d: %v", i, err)
@@ -344,9 +495,7 @@ func runLifecycleMode(ctx context.Context, client DataGenerator, cfg Config, r *
 		}
 		deleteSuccess++
 	}
-	fmt.Printf("Items deleted: %d\n", deleteSuccess)
-
-	return nil
+	return deleteSuccess
 }
 
 func main() {
@@ -354,14 +503,65 @@ func main() {
 
 	flag.StringVar(&cfg.TableName, "table", "", "Table name (creates new if empty)")
 	flag.IntVar(&cfg.NumItems, "items", 100, "Number of items (for put mode or reference for lifecycle)")
-	flag.StringVar(&cfg.Mode, "mode", "put", "Operation mode: put | lifecycle")
-	flag.IntVar(&cfg.UpdateCount, "update-count", 0, "Items to update (lifecycle mode)")
-	flag.IntVar(&cfg.DeleteCount, "delete-count", 0, "Items to delete (lifecycle mode)")
+	flag.StringVar(&cfg.Mode, "mode", "put", "Operation mode: put | lifecycle | verify | generate-chain | synth | cleanup")
+	flag.IntVar(&cfg.UpdateCount, "update-count", 0, "Items to update (lifecycle mode, or expected updates in verify mode)")
+	flag.IntVar(&cfg.InsertCount, "insert-count", 0, "Items to insert in incremental exports (synth mode)")
+	flag.IntVar(&cfg.DeleteCount, "delete-count", 0, "Items to delete (lifecycle mode, or expected deletes in verify mode)")
+	flag.StringVar(&cfg.OriginTable, "origin-table", "", "Table the data was generated into, when verifying a restored copy (verify mode)")
 	flag.Int64Var(&cfg.Seed, "seed", 0, "Random seed (0 = time-based)")
 	flag.BoolVar(&cfg.EnableGSI, "gsi", false, "Create table with GSI (ByCategory)")
 	flag.BoolVar(&cfg.EnableLSI, "lsi", false, "Create table with LSI (ByTimestamp)")
+	flag.IntVar(&cfg.Concurrency, "concurrency", 8, "Concurrent BatchWriteItem writers (put mode)")
+	flag.Float64Var(&cfg.Rate, "rate", 0, "Maximum items written per second (put mode, 0 = unlimited)")
+	flag.StringVar(&cfg.ExportBucket, "export-bucket", "", "S3 bucket for exports (generate-chain mode)")
+	flag.StringVar(&cfg.ExportPrefix, "export-prefix", "", "S3 prefix for exports (generate-chain mode)")
+	flag.IntVar(&cfg.ChainSteps, "chain-steps", 2, "Incremental exports to take (generate-chain mode)")
+	flag.DurationVar(&cfg.ChainInterval, "chain-interval", minIncrementalWindow, "Window of each incremental export (generate-chain mode)")
+	flag.StringVar(&cfg.ChainManifest, "chain-manifest", "chain-manifest.json", "Path of the chain manifest (generate-chain mode)")
+	flag.StringVar(&cfg.SynthDir, "output", "synthetic-exports", "Directory exports are written to (synth mode)")
+	flag.IntVar(&cfg.DataFiles, "data-files", 1, "Data files per export (synth mode)")
+	flag.IntVar(&cfg.ItemBytes, "item-size", 64, "Payload bytes per item (synth mode)")
+	profile := flag.String("profile", "default", "Data profiles, comma-separated: hot-partition | large | wide | ttl")
+	flag.StringVar(&cfg.SchemaPath, "schema", "", "JSON schema file defining the keys and attributes to generate")
+	flag.IntVar(&cfg.MaxItems, "max-items", 1000000, "Refuse to generate more items (0 = unlimited)")
+	flag.Float64Var(&cfg.MaxSizeGB, "max-size", 10, "Refuse to generate more estimated data, in GB (0 = unlimited)")
+	flag.BoolVar(&cfg.Confirm, "confirm", false, "Disable PITR on and delete the tables listed (cleanup mode)")
 	flag.Parse()
 
+	var err error
+	if cfg.Profile, err = ParseProfile(*profile); err != nil {
+		log.Fatalf("Invalid -profile: %v", err)
+	}
+	if cfg.SchemaPath != "" {
+		if cfg.Schema, err = LoadSchema(cfg.SchemaPath); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if cfg.EnableGSI || cfg.EnableLSI || cfg.Profile.HotPartition {
+			log.Fatalf("-schema defines the keys, so it cannot be combined with -gsi, -lsi or the hot-partition profile")
+		}
+	}
+
+	if cfg.Concurrency < 1 {
+		log.Fatalf("Concurrency must be at least 1")
+	}
+
+	// Verify mode regenerates the items of an earlier run, so it needs its seed and table
+	if cfg.Mode == "verify" && (cfg.Seed == 0 || cfg.TableName == "") {
+		log.Fatalf("Verify mode requires the -seed and -table of the run that generated the data")
+	}
+
+	if cfg.Mode == "generate-chain" {
+		if cfg.ExportBucket == "" {
+			log.Fatalf("Generate-chain mode requires -export-bucket")
+		}
+		if cfg.ChainSteps < 1 {
+			log.Fatalf("Chain steps must be at least 1")
+		}
+		if cfg.ChainInterval < minIncrementalWindow {
+			log.Fatalf("Chain interval must be at least %s, the shortest incremental export", minIncrementalWindow)
+		}
+	}
+
 	// Initialize random source
 	var seed int64
 	if cfg.Seed == 0 {
@@ -370,6 +570,23 @@ func main() {
 		seed = cfg.Seed
 	}
 	r := rand.New(rand.NewSource(seed))
+	cfg.Seed = seed
+
+	// Synth mode writes exports to disk and needs no AWS access
+	if cfg.Mode == "synth" {
+		fmt.Printf("Using seed: %d\n", seed)
+		if err := runSynthMode(cfg); err != nil {
+			log.Fatalf("Synth mode failed: %v", err)
+		}
+		return
+	}
+
+	// Check the cost guard before creating anything
+	if cfg.Mode == "put" || cfg.Mode == "generate-chain" {
+		if err := checkCostGuard(cfg); err != nil {
+			log.Fatalf("Cost guard: %v", err)
+		}
+	}
 	fmt.Printf("Using seed: %d\n", seed)
 
 	// Load AWS configuration
@@ -381,11 +598,19 @@ func main() {
 	client := dynamodb.NewFromConfig(awsCfg)
 	ctx := context.Background()
 
+	// Cleanup mode works on tables created earlier
+	if cfg.Mode == "cleanup" {
+		if err := runCleanupMode(ctx, client, cfg); err != nil {
+			log.Fatalf("Cleanup mode failed: %v", err)
+		}
+		return
+	}
+
 	// Handle table creation or validation
 	if cfg.TableName == "" {
 		cfg.TableName = tableNamePrefix + randomString(r, 8)
 
-		if err := createTableWithIndexes(ctx, client, cfg.TableName, cfg.EnableGSI, cfg.EnableLSI); err != nil {
+		if err := createTableWithIndexes(ctx, client, cfg.TableName, cfg.Schema, cfg.EnableGSI, cfg.EnableLSI); err != nil {
 			log.Fatalf("Failed to create table: %v", err)
 		}
 		fmt.Printf("Created table: %s\n", cfg.TableName)
@@ -412,6 +637,20 @@ func main() {
 		} else {
 			fmt.Println("PITR enabled successfully")
 		}
+
+		if cfg.Profile.TTL {
+			fmt.Printf("Enabling TTL on attribute %s...\n", ttlAttribute)
+			_, err = client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+				TableName: aws.String(cfg.TableName),
+				TimeToLiveSpecification: &types.TimeToLiveSpecification{
+					AttributeName: aws.String(ttlAttribute),
+					Enabled:       aws.Bool(true),
+				},
+			})
+			if err != nil {
+				log.Printf("Warning: Failed to enable TTL: %v", err)
+			}
+		}
 	} else {
 		// Verify table exists
 		_, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
@@ -433,8 +672,16 @@ func main() {
 		if err := runLifecycleMode(ctx, client, cfg, r); err != nil {
 			log.Fatalf("Lifecycle mode failed: %v", err)
 		}
+	case "verify":
+		if err := runVerifyMode(ctx, client, cfg); err != nil {
+			log.Fatalf("Verify mode failed: %v", err)
+		}
+	case "generate-chain":
+		if err := runChainMode(ctx, client, cfg, r); err != nil {
+			log.Fatalf("Generate-chain mode failed: %v", err)
+		}
 	default:
-		log.Fatalf("Unknown mode: %s (use 'put' or 'lifecycle')", cfg.Mode)
+		log.Fatalf("Unknown mode: %s (use 'put', 'lifecycle', 'verify', 'generate-chain', 'synth' or 'cleanup')", cfg.Mode)
 	}
 
 	fmt.Printf("\nTable: %s\n", cfg.TableName)
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	hotPartitions    = 100       // Partitions items are spread over by the hot-partition profile
+	largeItemMinSize = 100 << 10 // Smallest payload of the large profile
+	largeItemMaxSize = 390 << 10 // Largest payload, leaving room under the 400KB item limit
+	wideItemMinAttrs = 200       // Fewest extra attributes of the wide profile
+	wideItemMaxAttrs = 500       // Most extra attributes of the wide profile
+	ttlAttribute     = "ttl"     // Attribute holding the expiry of the ttl profile
+)
+
+// Profile selects generators shaping the data beyond the default random attributes.
+// Profiles combine, e.g. "hot-partition,large".
+type Profile struct {
+	HotPartition bool // Items share a few skewed partition keys, to reproduce throttling
+	Large        bool // Each item carries a 100-390KB binary payload
+	Wide         bool // Each item has hundreds of attributes, to exercise expression limits
+	TTL          bool // Each item has a ttl attribute, some already expired
+}
+
+// ParseProfile parses a comma-separated list of profile names.
+// Example:
+//
+//	p, err := ParseProfile("hot-partition,ttl")
+func ParseProfile(s string) (Profile, error) {
+	var p Profile
+	for _, name := range strings.Split(s, ",") {
+		switch strings.TrimSpace(name) {
+		case "", "default":
+		case "hot-partition":
+			p.HotPartition = true
+		case "large":
+			p.Large = true
+		case "wide":
+			p.Wide = true
+		case "ttl":
+			p.TTL = true
+		default:
+			return Profile{}, fmt.Errorf("unknown profile %q (use hot-partition, large, wide or ttl)", name)
+		}
+	}
+	return p, nil
+}
+
+// String returns the profile as accepted by ParseProfile.
+func (p Profile) String() string {
+	var names []string
+	for _, f := range []struct {
+		on   bool
+		name string
+	}{{p.HotPartition, "hot-partition"}, {p.Large, "large"}, {p.Wide, "wide"}, {p.TTL, "ttl"}} {
+		if f.on {
+			names = append(names, f.name)
+		}
+	}
+	if len(names) == 0 {
+		return "default"
+	}
+	return strings.Join(names, ",")
+}
+
+// Key returns the primary key of item id. The hot-partition profile puts items
+// under PART#<n> keys, where n is skewed so that partition 0 holds about 15% of
+// the items and partitions 0-9 about half. The key depends only on id, so
+// lifecycle mode can address an item without regenerating it.
+func (p Profile) Key(id int) (pk, sk string) {
+	if !p.HotPartition {
+		return fmt.Sprintf("ITEM#%d", id), "METADATA"
+	}
+	u := float64(splitmix64(uint64(id))>>11) / (1 << 53)
+	partition := int(math.Pow(hotPartitions, u)) - 1
+	return fmt.Sprintf("PART#%d", partition), fmt.Sprintf("ITEM#%d", id)
+}
+
+// apply adds the profile's attributes to item, drawing from r after the default
+// attributes so a seed reproduces the same data with the same profile.
+func (p Profile) apply(r *rand.Rand, item map[string]types.AttributeValue) {
+	if p.Large {
+		payload := make([]byte, randomNumber(r, largeItemMinSize, largeItemMaxSize))
+		r.Read(payload)
+		item["payload"] = &types.AttributeValueMemberB{Value: payload}
+	}
+	if p.Wide {
+		n := randomNumber(r, wideItemMinAttrs, wideItemMaxAttrs)
+		for i := 0; i < n; i++ {
+			item[fmt.Sprintf("Wide%03d", i)] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", randomNumber(r, 1, 1000))}
+		}
+	}
+	if p.TTL {
+		// Between a day ago and 30 days ahead, so DynamoDB expires some items
+		offset := randomNumber(r, -24*3600, 30*24*3600)
+		item[ttlAttribute] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", time.Now().Unix()+int64(offset))}
+	}
+}
+
+// splitmix64 scrambles x into a well-distributed 64-bit hash.
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	json "github.com/goccy/go-json"
+)
+
+// Schema describes the table and items to generate in place of the default
+// PK/SK keys and random attributes, so generated data follows an application's
+// model. It is read from a JSON file:
+//
+//	{
+//	  "partitionKey": {"name": "customerId", "type": "S", "format": "CUSTOMER#%d", "cardinality": 1000},
+//	  "sortKey":      {"name": "orderId", "type": "S", "format": "ORDER#%08d"},
+//	  "attributes": [
+//	    {"name": "status", "type": "S", "values": ["PENDING", "SHIPPED", "DELIVERED"]},
+//	    {"name": "total", "type": "N", "min": 1, "max": 5000},
+//	    {"name": "coupon", "type": "S", "cardinality": 50, "optional": 0.8},
+//	    {"name": "lines", "type": "L", "minLength": 1, "maxLength": 5,
+//	     "element": {"type": "M", "attributes": [
+//	       {"name": "sku", "type": "S", "cardinality": 500},
+//	       {"name": "quantity", "type": "N", "min": 1, "max": 10}]}}
+//	  ]
+//	}
+type Schema struct {
+	PartitionKey KeySpec         `json:"partitionKey"`
+	SortKey      *KeySpec        `json:"sortKey,omitempty"`
+	Attributes   []AttributeSpec `json:"attributes"`
+}
+
+// KeySpec describes a key attribute. Its value is derived from the item id alone,
+// so lifecycle mode can address an item without regenerating it.
+type KeySpec struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`        // S or N
+	Format      string `json:"format"`      // fmt verb for the value of an S key (default "%d")
+	Cardinality int    `json:"cardinality"` // Distinct values, taking the item id modulo it (0 = one per item)
+}
+
+// AttributeSpec describes a non-key attribute.
+type AttributeSpec struct {
+	Name        string          `json:"name"`
+	Type        string          `json:"type"`        // S, N, B, BOOL, NULL, SS, NS, BS, L or M
+	Values      []string        `json:"values"`      // Choices for S and N values or SS and NS members
+	Cardinality int             `json:"cardinality"` // Distinct "<name>-<n>" S values or SS members (0 = random strings)
+	Min         int             `json:"min"`         // Smallest N value or NS member (default 1)
+	Max         int             `json:"max"`         // Largest N value or NS member (default 1000)
+	MinLength   int             `json:"minLength"`   // Shortest S or B value, or fewest set members or list elements
+	MaxLength   int             `json:"maxLength"`   // Longest S or B value, or most set members or list elements
+	Optional    float64         `json:"optional"`    // Probability the attribute is absent
+	Element     *AttributeSpec  `json:"element"`     // Element of an L attribute
+	Attributes  []AttributeSpec `json:"attributes"`  // Members of an M attribute
+}
+
+// LoadSchema reads and validates a schema file.
+// Example:
+//
+//	schema, err := LoadSchema("orders.json")
+func LoadSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// validate checks the schema and fills in defaults.
+func (s *Schema) validate() error {
+	names := make(map[string]bool)
+	keys := []*KeySpec{&s.PartitionKey}
+	if s.SortKey != nil {
+		keys = append(keys, s.SortKey)
+	}
+	for _, k := range keys {
+		if k.Name == "" {
+			return fmt.Errorf("key name is required")
+		}
+		if names[k.Name] {
+			return fmt.Errorf("duplicate attribute %s", k.Name)
+		}
+		names[k.Name] = true
+		switch k.Type {
+		case "S":
+			if k.Format == "" {
+				k.Format = "%d"
+			}
+			if strings.Count(k.Format, "%") != 1 {
+				return fmt.Errorf("key %s: format must contain exactly one %%d verb", k.Name)
+			}
+		case "N":
+			if k.Format != "" {
+				return fmt.Errorf("key %s: format applies only to S keys", k.Name)
+			}
+		default:
+			return fmt.Errorf("key %s: type must be S or N", k.Name)
+		}
+		if k.Cardinality < 0 {
+			return fmt.Errorf("key %s: cardinality must not be negative", k.Name)
+		}
+	}
+	if s.SortKey == nil && s.PartitionKey.Cardinality > 0 {
+		return fmt.Errorf("key %s: cardinality needs a sort key to keep items unique", s.PartitionKey.Name)
+	}
+	if s.SortKey != nil && s.PartitionKey.Cardinality > 0 && s.SortKey.Cardinality > 0 {
+		return fmt.Errorf("key %s: at most one key may set a cardinality", s.SortKey.Name)
+	}
+	for i := range s.Attributes {
+		a := &s.Attributes[i]
+		if names[a.Name] {
+			return fmt.Errorf("duplicate attribute %s", a.Name)
+		}
+		names[a.Name] = true
+		if err := a.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks the attribute and fills in defaults.
+func (a *AttributeSpec) validate() error {
+	if a.Name == "" {
+		return fmt.Errorf("attribute name is required")
+	}
+	if a.Optional < 0 || a.Optional >= 1 {
+		return fmt.Errorf("attribute %s: optional must be in [0, 1)", a.Name)
+	}
+	if a.Cardinality < 0 {
+		return fmt.Errorf("attribute %s: cardinality must not be negative", a.Name)
+	}
+	if a.Min == 0 && a.Max == 0 {
+		a.Min, a.Max = 1, 1000
+	}
+	if a.Min > a.Max {
+		return fmt.Errorf("attribute %s: min exceeds max", a.Name)
+	}
+	if a.MinLength == 0 && a.MaxLength == 0 {
+		switch a.Type {
+		case "SS", "NS", "BS", "L":
+			a.MinLength, a.MaxLength = 1, 5
+		default:
+			a.MinLength, a.MaxLength = 5, 20
+		}
+	}
+	if a.MinLength < 0 || a.MinLength > a.MaxLength {
+		return fmt.Errorf("attribute %s: minLength must be between 0 and maxLength", a.Name)
+	}
+	if len(a.Values) > 0 && a.Type != "S" && a.Type != "N" && a.Type != "SS" && a.Type != "NS" {
+		return fmt.Errorf("attribute %s: values apply only to S, N, SS and NS", a.Name)
+	}
+
+	switch a.Type {
+	case "S", "N", "B", "BOOL", "NULL":
+	case "SS", "NS", "BS":
+		if a.MinLength < 1 {
+			return fmt.Errorf("attribute %s: sets need at least one member", a.Name)
+		}
+		if pool := len(a.Values); pool > 0 && pool < a.MaxLength {
+			return fmt.Errorf("attribute %s: maxLength exceeds the %d values", a.Name, pool)
+		}
+		if a.Type == "SS" && len(a.Values) == 0 && a.Cardinality > 0 && a.Cardinality < a.MaxLength {
+			return fmt.Errorf("attribute %s: maxLength exceeds the cardinality", a.Name)
+		}
+		if a.Type == "NS" && len(a.Values) == 0 && a.Max-a.Min+1 < a.MaxLength {
+			return fmt.Errorf("attribute %s: maxLength exceeds the min-max range", a.Name)
+		}
+	case "L":
+		if a.Element == nil {
+			return fmt.Errorf("attribute %s: L needs an element", a.Name)
+		}
+		a.Element.Name = a.Name + "[]"
+		if err := a.Element.validate(); err != nil {
+			return err
+		}
+	case "M":
+		if len(a.Attributes) == 0 {
+			return fmt.Errorf("attribute %s: M needs attributes", a.Name)
+		}
+		for i := range a.Attributes {
+			if err := a.Attributes[i].validate(); err != nil {
+				return fmt.Errorf("attribute %s: %w", a.Name, err)
+			}
+		}
+	default:
+		return fmt.Errorf("attribute %s: unknown type %q", a.Name, a.Type)
+	}
+	return nil
+}
+
+// keyNames returns the key attribute names; sk is empty without a sort key.
+func (s *Schema) keyNames() (pk, sk string) {
+	if s.SortKey != nil {
+		sk = s.SortKey.Name
+	}
+	return s.PartitionKey.Name, sk
+}
+
+// key returns the primary key of item id.
+func (s *Schema) key(id int) map[string]types.AttributeValue {
+	key := map[string]types.AttributeValue{s.PartitionKey.Name: s.PartitionKey.value(id)}
+	if s.SortKey != nil {
+		key[s.SortKey.Name] = s.SortKey.value(id)
+	}
+	return key
+}
+
+// value returns the key value of item id.
+func (k KeySpec) value(id int) types.AttributeValue {
+	if k.Cardinality > 0 {
+		id %= k.Cardinality
+	}
+	if k.Type == "N" {
+		return &types.AttributeValueMemberN{Value: strconv.Itoa(id)}
+	}
+	return &types.AttributeValueMemberS{Value: fmt.Sprintf(k.Format, id)}
+}
+
+// generate creates the non-key attributes of an item.
+func (s *Schema) generate(r *rand.Rand) map[string]types.AttributeValue {
+	return generateAttributes(r, s.Attributes)
+}
+
+// generateAttributes creates values for specs, leaving out optional attributes
+// by chance.
+func generateAttributes(r *rand.Rand, specs []AttributeSpec) map[string]types.AttributeValue {
+	item := make(map[string]types.AttributeValue, len(specs))
+	for _, spec := range specs {
+		if spec.Optional > 0 && r.Float64() < spec.Optional {
+			continue
+		}
+		item[spec.Name] = spec.generate(r)
+	}
+	return item
+}
+
+// generate creates one value for the attribute.
+func (a *AttributeSpec) generate(r *rand.Rand) types.AttributeValue {
+	length := randomNumber(r, a.MinLength, a.MaxLength)
+	switch a.Type {
+	case "S":
+		return &types.AttributeValueMemberS{Value: a.scalar(r, length)}
+	case "N":
+		if len(a.Values) > 0 {
+			return &types.AttributeValueMemberN{Value: a.Values[r.Intn(len(a.Values))]}
+		}
+		return &types.AttributeValueMemberN{Value: strconv.Itoa(randomNumber(r, a.Min, a.Max))}
+	case "B":
+		return &types.AttributeValueMemberB{Value: []byte(randomString(r, length))}
+	case "BOOL":
+		return &types.AttributeValueMemberBOOL{Value: r.Intn(2) == 1}
+	case "NULL":
+		return &types.AttributeValueMemberNULL{Value: true}
+	case "SS":
+		if len(a.Values) > 0 {
+			return &types.AttributeValueMemberSS{Value: pickDistinct(r, a.Values, length)}
+		}
+		if a.Cardinality > 0 {
+			members := make([]string, a.Cardinality)
+			for i := range members {
+				members[i] = fmt.Sprintf("%s-%d", a.Name, i)
+			}
+			return &types.AttributeValueMemberSS{Value: pickDistinct(r, members, length)}
+		}
+		return &types.AttributeValueMemberSS{Value: generateUniqueStrings(r, length, 5, 20)}
+	case "NS":
+		if len(a.Values) > 0 {
+			return &types.AttributeValueMemberNS{Value: pickDistinct(r, a.Values, length)}
+		}
+		return &types.AttributeValueMemberNS{Value: generateUniqueNumbers(r, length, a.Min, a.Max)}
+	case "BS":
+		return &types.AttributeValueMemberBS{Value: generateUniqueBinaries(r, length, 5, 10)}
+	case "L":
+		list := make([]types.AttributeValue, length)
+		for i := range list {
+			list[i] = a.Element.generate(r)
+		}
+		return &types.AttributeValueMemberL{Value: list}
+	default: // M
+		return &types.AttributeValueMemberM{Value: generateAttributes(r, a.Attributes)}
+	}
+}
+
+// scalar returns an S value: one of Values, one of Cardinality names, or a random
+// string of length characters.
+func (a *AttributeSpec) scalar(r *rand.Rand, length int) string {
+	switch {
+	case len(a.Values) > 0:
+		return a.Values[r.Intn(len(a.Values))]
+	case a.Cardinality > 0:
+		return fmt.Sprintf("%s-%d", a.Name, r.Intn(a.Cardinality))
+	default:
+		return randomString(r, length)
+	}
+}
+
+// pickDistinct returns n distinct members of values in random order.
+func pickDistinct(r *rand.Rand, values []string, n int) []string {
+	picked := make([]string, n)
+	for i, j := range r.Perm(len(values))[:n] {
+		picked[i] = values[j]
+	}
+	return picked
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// volatileAttributes hold wall-clock times, so verify only checks they are present.
+var volatileAttributes = map[string]bool{
+	"timestamp":  true,
+	"createdAt":  true,
+	"updatedAt":  true,
+	ttlAttribute: true,
+}
+
+// expectedItems regenerates the items put and lifecycle modes wrote with cfg.Seed,
+// keyed by "PK/SK". Deleted items are absent.
+func expectedItems(cfg Config) map[string]map[string]types.AttributeValue {
+	r := rand.New(rand.NewSource(cfg.Seed))
+
+	// A table created by put mode consumed the first random values for its name
+	origin := cfg.TableName
+	if cfg.OriginTable != "" {
+		origin = cfg.OriginTable
+	}
+	if origin != tableNamePrefix+randomString(r, 8) {
+		r = rand.New(rand.NewSource(cfg.Seed))
+	}
+
+	expected := make(map[string]map[string]types.AttributeValue, cfg.NumItems)
+	for i := 0; i < cfg.NumItems; i++ {
+		item := generateRandomItem(r, i, cfg.EnableGSI, cfg.EnableLSI)
+		if i < cfg.UpdateCount {
+			item["data"] = &types.AttributeValueMemberS{Value: fmt.Sprintf("updated-%d", i)}
+			item["updatedAt"] = &types.AttributeValueMemberN{}
+		}
+		if i >= cfg.NumItems-cfg.DeleteCount {
+			continue
+		}
+		expected[cfg.itemKey(item)] = item
+	}
+	return expected
+}
+
+// itemKey returns the "PK/SK" key of an item, or just the partition key value
+// when the table has no sort key.
+func (cfg Config) itemKey(item map[string]types.AttributeValue) string {
+	pkName, skName := cfg.keyNames()
+	pk, ok := scalarString(item[pkName])
+	if !ok {
+		return "<no key>"
+	}
+	if skName == "" {
+		return pk
+	}
+	sk, ok := scalarString(item[skName])
+	if !ok {
+		return "<no key>"
+	}
+	return pk + "/" + sk
+}
+
+// scalarString returns the value of an S or N attribute.
+func scalarString(v types.AttributeValue) (string, bool) {
+	switch v := v.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value, true
+	case *types.AttributeValueMemberN:
+		return v.Value, true
+	}
+	return "", false
+}
+
+// runVerifyMode regenerates the expected items from the seed and compares them
+// with a scan of the table, reporting every missing, unexpected or differing item.
+func runVerifyMode(ctx context.Context, client DataGenerator, cfg Config) error {
+	expected := expectedItems(cfg)
+	fmt.Printf("Verifying %d expected items in %s...\n", len(expected), cfg.TableName)
+
+	var mismatches []string
+	seen := make(map[string]bool, len(expected))
+	input := &dynamodb.ScanInput{TableName: aws.String(cfg.TableName), ConsistentRead: aws.Bool(true)}
+	for {
+		out, err := client.Scan(ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to scan table: %w", err)
+		}
+		for _, actual := range out.Items {
+			key := cfg.itemKey(actual)
+			seen[key] = true
+			want, ok := expected[key]
+			if !ok {
+				mismatches = append(mismatches, fmt.Sprintf("%s: unexpected item", key))
+				continue
+			}
+			for _, diff := range compareItems(want, actual) {
+				mismatches = append(mismatches, fmt.Sprintf("%s: %s", key, diff))
+			}
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+	for key := range expected {
+		if !seen[key] {
+			mismatches = append(mismatches, fmt.Sprintf("%s: missing", key))
+		}
+	}
+
+	sort.Strings(mismatches)
+	for _, m := range mismatches {
+		fmt.Println(m)
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%d mismatches between %d expected items and the table", len(mismatches), len(expected))
+	}
+	fmt.Printf("Verified %d items: table matches the seed\n", len(expected))
+	return nil
+}
+
+// compareItems describes how actual differs from expected.
+func compareItems(expected, actual map[string]types.AttributeValue) []string {
+	var diffs []string
+	for name, want := range expected {
+		got, ok := actual[name]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("attribute %s missing", name))
+		case volatileAttributes[name]:
+		case !itemimage.AttributeEqual(want, got):
+			diffs = append(diffs, fmt.Sprintf("attribute %s differs", name))
+		}
+	}
+	for name := range actual {
+		if _, ok := expected[name]; !ok {
+			diffs = append(diffs, fmt.Sprintf("attribute %s unexpected", name))
+		}
+	}
+	sort.Strings(diffs)
+	return diffs
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/journal"
+	"github.com/gurre/ddb-pitr/plan"
+	"github.com/gurre/ddb-pitr/replay"
+	"github.com/gurre/ddb-pitr/writer"
+)
+
+// applyJournal replays the journal at -apply-journal into each target table, or
+// with -invert applies its compensating operations newest first. Each table
+// receives the entries journaled for it. The writes are journaled too, when
+// -journal is given.
+func (s *session) applyJournal(ctx context.Context) error {
+	cfg := s.cfg
+	mode := journal.Replay
+	if cfg.InvertJournal {
+		mode = journal.Invert
+	}
+	writerOpts := []writer.Option{writer.WithUpdateParallelism(cfg.UpdateParallelism)}
+	for _, table := range cfg.TargetTables() {
+		var writers []writer.Writer
+		if !cfg.DryRun {
+			writers = append(writers, journaled(writer.NewDynamoDBWriter(s.dynamoClient, table, cfg.BatchSize, writerOpts...), s.journal, table, nil))
+		}
+		if err := applyJournalTo(ctx, s.out, s.rawS3Client, s.jsonDecoder, cfg.ApplyJournalURI, table, mode, writers, cfg.BatchSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyJournalTo applies the entries of the journal at uri that were journaled
+// for table to writers, which may be empty to only count them.
+func applyJournalTo(ctx context.Context, out io.Writer, client journal.ReadClient, decoder itemimage.Decoder,
+	uri, table string, mode journal.Mode, writers []writer.Writer, batchSize int) error {
+	src, err := journal.Open(ctx, client, uri, table, mode, decoder)
+	if err != nil {
+		return err
+	}
+	verb := "Replaying"
+	if mode == journal.Invert {
+		verb = "Inverting"
+	}
+	fmt.Fprintf(out, "%s journal %s into %s\n", verb, uri, table)
+	stats, err := replay.NewApplier(writers, batchSize).Apply(ctx, src)
+	if err != nil {
+		return fmt.Errorf("failed to apply journal to %s after %d operations: %w", table, stats.Records, err)
+	}
+	entries := src.Stats()
+	fmt.Fprintf(out, "Applied %d operations to %s: %d puts, %d deletes; %d of %d entries skipped, %d could not be inverted\n",
+		stats.Records, table, stats.Puts, stats.Deletes, entries.Skipped, entries.Entries, entries.Unrecoverable)
+	return nil
+}
+
+// journaled wraps w so its writes to table are journaled to j, or returns w
+// when no journal is kept. The key schema, when table could be described, lets
+// the journal record the keys of full export items.
+func journaled(w writer.Writer, j *journal.Journal, table string, infos []plan.TableInfo) writer.Writer {
+	if j == nil {
+		return w
+	}
+	return journal.NewWriter(w, j, table, keyAttrsOf(infos, table))
+}
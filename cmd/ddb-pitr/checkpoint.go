@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gurre/ddb-pitr/aws"
+	"github.com/gurre/ddb-pitr/checkpoint"
+)
+
+// runCheckpoint implements the checkpoint subcommands:
+//
+//	ddb-pitr checkpoint show [-history] [-region r] s3://bucket/checkpoint.json
+//	ddb-pitr checkpoint show file:///var/tmp/checkpoint.json
+func runCheckpoint(args []string) error {
+	if len(args) == 0 || args[0] != "show" {
+		return fmt.Errorf("usage: ddb-pitr checkpoint show [-history] [-region region] <s3://bucket/key | file:///path>")
+	}
+	fs := flag.NewFlagSet("checkpoint show", flag.ExitOnError)
+	region := fs.String("region", "", "AWS region (defaults to AWS_REGION env)")
+	history := fs.Bool("history", false, "Also print the earlier checkpoints kept by -checkpoint-history")
+	if err := fs.Parse(args[1:]); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected one checkpoint URI, got %d", fs.NArg())
+	}
+	uri := fs.Arg(0)
+	ctx := context.Background()
+
+	if strings.HasPrefix(uri, "file://") {
+		if *history {
+			return fmt.Errorf("history is only kept for s3:// checkpoints")
+		}
+		store, err := checkpoint.NewFileStore(uri)
+		if err != nil {
+			return err
+		}
+		state, err := store.Load(ctx)
+		if err != nil {
+			return err
+		}
+		printCheckpoint(os.Stdout, uri, state, nil, time.Now())
+		return nil
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(*region))
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	rawS3Client := s3.NewFromConfig(awsCfg)
+	store, err := checkpoint.NewS3Store(aws.NewS3Client(rawS3Client), uri)
+	if err != nil {
+		return err
+	}
+	state, err := store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	var earlier []checkpoint.State
+	if *history {
+		if earlier, err = checkpoint.LoadHistory(ctx, rawS3Client, uri); err != nil {
+			return err
+		}
+	}
+	printCheckpoint(os.Stdout, uri, state, earlier, time.Now())
+	return nil
+}
+
+// printCheckpoint writes state, and any earlier states oldest first, in human form.
+func printCheckpoint(out io.Writer, uri string, state checkpoint.State, earlier []checkpoint.State, now time.Time) {
+	fmt.Fprintf(out, "Checkpoint: %s\n", uri)
+	if state.LastFile == "" {
+		fmt.Fprintln(out, "No progress saved; a restore using it starts from the beginning")
+		return
+	}
+	fmt.Fprintf(out, "Saved:      %s\n", describeSavedAt(state.SavedAt, now))
+	fmt.Fprintf(out, "File:       %s\n", state.LastFile)
+	fmt.Fprintf(out, "Position:   %s\n", describePosition(state))
+	if !state.Legacy() {
+		fmt.Fprintf(out, "Completed:  %d files, %d more in progress\n", len(state.CompletedFiles), len(state.InProgress))
+	}
+	if state.Elapsed > 0 {
+		fmt.Fprintf(out, "Elapsed:    %s\n", state.Elapsed.Round(time.Second))
+	}
+	if state.Version != "" {
+		fmt.Fprintf(out, "Saved by:   ddb-pitr %s\n", state.Version)
+	}
+	if len(earlier) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "History (%d, oldest first):\n", len(earlier))
+	for _, s := range earlier {
+		fmt.Fprintf(out, "  %s  %s  %s\n", describeSavedAt(s.SavedAt, now), s.LastFile, describePosition(s))
+	}
+}
+
+// describeSavedAt formats when a checkpoint was saved and how long ago.
+func describeSavedAt(t, now time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s (%s ago)", t.UTC().Format(time.RFC3339), now.Sub(t).Round(time.Second))
+}
+
+// describePosition formats how far into LastFile the checkpoint is.
+func describePosition(s checkpoint.State) string {
+	if s.Complete() {
+		return "file complete"
+	}
+	return fmt.Sprintf("%.1f MiB into the decompressed file (byte %d)", float64(s.LastByteOffset)/(1<<20), s.LastByteOffset)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/gurre/ddb-pitr/buffer"
+	"github.com/gurre/ddb-pitr/deadletter"
+	"github.com/gurre/ddb-pitr/plan"
+	"github.com/gurre/ddb-pitr/writer"
+)
+
+// drain writes the operations published to the -drain queue into the target
+// tables until the queue stays empty for -drain-idle or the run is interrupted.
+func (s *session) drain(ctx context.Context) error {
+	cfg := s.cfg
+	writerOpts := []writer.Option{writer.WithUpdateParallelism(cfg.UpdateParallelism)}
+	if cfg.UnprocessedLimit > 0 {
+		writerOpts = append(writerOpts, writer.WithUnprocessedLimit(cfg.UnprocessedLimit, nil))
+	}
+	if cfg.DeadLetterURI != "" {
+		sink, err := deadletter.NewFileSink(cfg.DeadLetterURI)
+		if err != nil {
+			return fmt.Errorf("failed to open dead-letter sink: %w", err)
+		}
+		defer func() {
+			if n := sink.Count(); n > 0 {
+				fmt.Fprintf(s.out, "%d operations were dead-lettered to %s\n", n, cfg.DeadLetterURI)
+			}
+			if err := sink.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close dead-letter sink: %v\n", err)
+			}
+		}()
+		writerOpts = append(writerOpts, writer.WithDeadLetter(sink))
+	}
+	var writers []writer.Writer
+	for _, table := range cfg.TargetTables() {
+		writers = append(writers, writer.NewDynamoDBWriter(s.dynamoClient, table, cfg.BatchSize, writerOpts...))
+	}
+
+	drainCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	fmt.Fprintf(s.out, "Draining %s into %s; interrupt to stop\n", cfg.DrainQueueURL, cfg.TableName)
+	consumer := buffer.NewConsumer(sqs.NewFromConfig(s.awsCfg), cfg.DrainQueueURL, writers, s.jsonDecoder, cfg.DrainIdle)
+	stats, err := consumer.Run(drainCtx)
+	fmt.Fprintf(s.out, "Drained %d messages: %d puts, %d deletes, %d updates\n",
+		stats.Messages, stats.Puts, stats.Deletes, stats.Updates)
+	if err != nil {
+		return fmt.Errorf("drain failed: %w", err)
+	}
+	return nil
+}
+
+// publisher returns the writer publishing a restore's operations to the
+// -publish-queue queue instead of writing the first target table, so a -drain
+// run writes them at the table's pace. Full export items carry their key only
+// in the image, so the table's key schema is required.
+func (s *session) publisher(tableInfos []plan.TableInfo) (*buffer.Publisher, error) {
+	cfg := s.cfg
+	table := cfg.TargetTables()[0]
+	keyAttrs := keyAttrsOf(tableInfos, table)
+	if len(keyAttrs) == 0 {
+		return nil, fmt.Errorf("publishing to %s requires the key schema of table %s, which could not be described", cfg.PublishQueueURL, table)
+	}
+	fmt.Fprintf(s.out, "Publishing operations to %s instead of writing table %s\n", cfg.PublishQueueURL, table)
+	return buffer.NewPublisher(sqs.NewFromConfig(s.awsCfg), cfg.PublishQueueURL, keyAttrs), nil
+}
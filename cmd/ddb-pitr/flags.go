@@ -0,0 +1,249 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/gurre/ddb-pitr/config"
+)
+
+// parseFlags parses the flags of the restore command as specified in section 7
+// into a validated configuration.
+func parseFlags(args []string) (*config.Config, error) {
+	// Create a new flag set for the restore command as specified in section 7
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+
+	// Required flags as specified in section 4.1
+	tableName := fs.String("table", "", "DynamoDB table name to restore to; a comma-separated list restores into each table")
+	exportS3URI := fs.String("export", "", "S3 URI of the PITR export: its manifest-summary.json, export directory, or a prefix holding one export; a comma-separated list is applied as a chain in timeline order")
+
+	// Optional flags as specified in section 4.1
+	exportType := fs.String("type", "", "Export type (FULL|INCREMENTAL); checked against the export manifest (default: from the manifest)")
+	exportFormat := fs.String("export-format", "dynamodb", "Layout of the export in S3: dynamodb (ExportTableToPointInTime) or data-pipeline (Data Pipeline manifest and data files)")
+	viewType := fs.String("view", "", "View type (NEW|NEW_AND_OLD); checked against the export manifest (default: from the manifest)")
+	region := fs.String("region", "", "AWS region (defaults to AWS_REGION env)")
+	dynamoEndpoint := fs.String("dynamodb-endpoint", "", "Endpoint of a DynamoDB-compatible API serving the target tables, e.g. https://alternator.example.com:8043; exports are still read from S3")
+	dynamoProfile := fs.String("dynamodb-profile", "", "Shared config profile whose credentials sign DynamoDB requests, for targets with their own keys")
+	compat := fs.String("compat", "dynamodb", "API serving the target tables (dynamodb|alternator); alternator leaves out request parameters ScyllaDB Alternator does not support")
+	s3PathStyle := fs.Bool("s3-path-style", false, "Address S3 buckets in the request path rather than the host name, as S3-compatible stores such as MinIO expect")
+	resumeKey := fs.String("resume", "", "S3 URI for checkpoint file, or auto for one derived from the export and target tables in the export bucket")
+	checkpointEvery := fs.Duration("checkpoint-interval", 0, "Save each worker's checkpoint at least this often, besides every 100 batches, e.g. 30s for slow tables (0 = batch count only)")
+	checkpointHistory := fs.Int("checkpoint-history", 0, "Keep this many earlier checkpoints next to -resume, under <key>.history/")
+	maxWorkers := fs.Int("workers", 10, "Maximum number of concurrent workers")
+	batchSize := fs.Int("batch", 25, "Batch size for DynamoDB writes (max 25)")
+	updateParallelism := fs.Int("update-parallelism", 4, "Maximum concurrent UpdateItem calls per batch")
+	reportS3URI := fs.String("report", "", "S3 URI for the final report")
+	keyAttr := fs.String("key-attr", "", "Key attribute matched by -key-prefix/-key-equals")
+	keyPrefix := fs.String("key-prefix", "", "Restore only items whose key attribute starts with this value")
+	priorityFiles := fs.String("priority-files", "", "Comma-separated data file keys or names restored before the export's other files")
+	priorityKeyPrefix := fs.String("priority-key-prefix", "", "Restore the items whose partition key starts with this value in a first pass over the export, before the others")
+	keyEquals := fs.String("key-equals", "", "Restore only items whose key attribute equals this value")
+	keysFile := fs.String("keys", "", "JSON lines file of primary keys (DynamoDB JSON) to restore; other items are skipped")
+	driftReport := fs.String("drift-report", "", "File receiving -plan's schema drift reports of the target tables as JSON")
+	keysReport := fs.String("keys-report", "", "File receiving per-key results for -keys as JSON lines")
+	remapAttr := fs.String("remap-attr", "", "String key attribute to rewrite for side-by-side restores")
+	remapPrefix := fs.String("remap-prefix", "", "Prefix added to -remap-attr, e.g. RESTORED#")
+	remapSuffix := fs.String("remap-suffix", "", "Suffix added to -remap-attr")
+	reshardAttr := fs.String("reshard-attr", "", "String key attribute ending in a write shard number, e.g. pk of 2024-05-01#3, whose shard is recomputed for -reshard-count shards")
+	reshardCount := fs.Int("reshard-count", 0, "Shard count of the target's key design; shards are numbered from 0")
+	reshardSep := fs.String("reshard-separator", "", "Separator before the shard number of -reshard-attr (default: #)")
+	reshardBy := fs.String("reshard-by", "", "Attribute hashed to pick an item's new shard (default: the target table's sort key)")
+	includeAttrs := fs.String("include-attrs", "", "Comma-separated top-level attributes to restore besides the key attributes; others are left out, and removed from items a put overwrites")
+	excludeAttrs := fs.String("exclude-attrs", "", "Comma-separated top-level attributes left out of the restore, and removed from items a put overwrites; key attributes are always restored")
+	prefixStats := fs.String("prefix-stats", "", "Count the items restored per partition key prefix up to this delimiter, e.g. #, in the report")
+	restoreTo := fs.String("restore-to", "", "RFC 3339 time to restore the table as of: later exports of a chain are skipped and incremental records written later are left out")
+	shiftTimeAttrs := fs.String("shift-time-attrs", "", "Comma-separated timestamp attributes, epoch numbers or ISO 8601 strings, rewritten by -shift-time-by")
+	shiftTimeBy := fs.String("shift-time-by", "", "Duration added to -shift-time-attrs, e.g. 2160h or -24h, or now to set them to the current time")
+	redactRules := fs.String("redact-rules", "", "JSON rules file for redacting attributes before writing")
+	deadLetterURI := fs.String("dead-letter", "", "file:// URI for operations rejected with permanent errors (default: fail the restore)")
+	shadowTable := fs.String("shadow-table", "", "Also write every batch to this table, best effort, to compare it with the restored table; its failures are reported but never fail the restore")
+	dryRun := fs.Bool("dry-run", false, "Validate configuration without restoring")
+	planOnly := fs.Bool("plan", false, "Print the restore plan and estimated write units, then exit without writing")
+	planSample := fs.Int("plan-sample", 0, "Sample this many items of the export, spread over its data files, and print -plan's item size percentiles and per-attribute frequency, types, sizes and distinct values")
+	allowGlobalTable := fs.Bool("allow-global-table", false, "Restore into global tables, whose writes replicate to every replica region")
+	allowOverwrite := fs.Bool("allow-overwrite", false, "Restore into tables that already hold items, overwriting those with the keys of exported items")
+	fs.BoolVar(allowOverwrite, "allow-non-empty", false, "Same as -allow-overwrite")
+	auditPath := fs.String("audit-duplicates", "", "Local file logging digests of applied operations; warns about operations applied twice, e.g. after a resume")
+	schedule := fs.String("schedule", "file", "How writes are parallelized: file (each worker writes the batches of its file) or key (operations are routed to writers by partition key hash)")
+	keyWriters := fs.Int("key-writers", 0, "Writer goroutines per table with -schedule key (0 = -workers)")
+	writeHook := fs.String("write-hook", "", "Command, with space-separated arguments, receiving every batch as a JSON line on stdin before it is written and answering with the operations to write or an error")
+	writeHookTimeout := fs.Duration("write-hook-timeout", 0, "Kill -write-hook and fail the batch when it takes longer than this to answer (0 = 30s)")
+	enableStream := fs.String("enable-stream", "", "Enable DynamoDB Streams on the target tables before writing with this view type, or SOURCE for the exported table's, and report the stream ARNs")
+	tags := fs.String("tags", "", "Comma-separated key=value tags added to the target tables before writing, overriding copied ones")
+	copyTags := fs.Bool("copy-tags", false, "Copy the exported table's tags to the target tables before writing")
+	runID := fs.String("run-id", "", "ID of this run, tagged on the checkpoint and report objects as ddb-pitr:run-id")
+	writeMode := fs.String("write-mode", "dynamodb", "API the target tables are written with: dynamodb (BatchWriteItem and UpdateItem) or partiql (BatchExecuteStatement)")
+	collectionPolicy := fs.String("item-collection-policy", "abort", "Handling of a partition key whose item collection on a table with local secondary indexes reached the 10 GB limit: abort, or skip its operations (dead-lettered with -dead-letter) and report it")
+	onCorrupt := fs.String("on-corrupt", "skip", "Handling of lines that fail to decode: skip (count them), abort, or dead-letter (requires -dead-letter)")
+	maxCorruptPercent := fs.Float64("max-corrupt-percent", 0, "Abort when more than this percentage of lines are corrupt (0 = no limit)")
+	strictDecode := fs.Bool("strict-decode", false, "Count numbers and binary values DynamoDB would reject as corrupt lines instead of failing their writes")
+	sdkDecoder := fs.Bool("sdk-decoder", false, "Decode export lines with the AWS SDK instead of the built-in parser (slower)")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 5*time.Minute, "Graceful shutdown timeout")
+	followExports := fs.Bool("follow", false, "After the restore, keep applying new incremental exports of the table as they complete")
+	followQueue := fs.String("follow-queue", "", "SQS queue URL receiving S3 events for new manifest-summary.json files; -follow consumes it instead of listing the export prefix")
+	followInterval := fs.Duration("follow-interval", 5*time.Minute, "How often -follow checks for new incremental exports")
+	stallTimeout := fs.Duration("stall-timeout", 5*time.Minute, "Restart a file when its worker makes no progress for this long (0 = disabled)")
+	unprocessedLimit := fs.Int("max-unprocessed-retries", 20, "Consecutive batch write retries leaving items unprocessed, e.g. by a full item collection, before they are dead-lettered or fail their batch (0 = retry indefinitely)")
+	fileRequeues := fs.Int("file-requeues", 2, "Times a file that failed all its attempts is handed to the workers again, resuming from its last written batch, before the restore fails (0 = fail at once)")
+	fileTimeout := fs.Duration("file-timeout", 0, "Restart a file attempt that runs longer than this, resuming from its last written batch (0 = disabled)")
+	batchTimeout := fs.Duration("batch-timeout", 0, "Abandon a batch write that takes longer than this, including throttling retries, and retry the file from its last written batch (0 = disabled)")
+	controlSocket := fs.String("control-socket", "", "Unix socket serving a local HTTP API to pause, resume, resize or checkpoint the running restore")
+	notifyTarget := fs.String("notify", "", "SNS topic ARN or https:// webhook receiving the final report or failure")
+	progress := fs.String("progress", "text", "Progress output on stdout (text|ndjson)")
+	lockURI := fs.String("lock-uri", "", "S3 prefix for the per-table run locks (default: ddb-pitr-locks/ in the export bucket)")
+	replaySources := fs.String("replay", "", "Comma-separated files or s3:// objects of DynamoDB Streams or Kinesis records to apply after the restore, in order")
+	publishQueue := fs.String("publish-queue", "", "SQS FIFO queue URL receiving the decoded operations instead of the table; a -drain run writes them")
+	drainQueueURL := fs.String("drain", "", "SQS queue URL filled by -publish-queue to write into -table instead of restoring an export")
+	drainIdle := fs.Duration("drain-idle", 0, "Stop -drain once the queue has been empty this long (0 = run until interrupted)")
+	materializeURI := fs.String("materialize", "", "Write the restored items as CSV files under this s3:// prefix or file:// directory instead of a table")
+	materializeKeys := fs.String("materialize-keys", "", "Comma-separated primary key attributes of the exported table, required by -materialize")
+	partitionBy := fs.String("partition-by", "", "Partition -materialize files by this attribute's value, as <attr>=<value>/ directories")
+	glueTable := fs.String("glue-table", "", "Create or refresh this Glue table, as database.table, over the -materialize s3:// prefix")
+	traceEndpoint := fs.String("trace-endpoint", "", "OTLP/HTTP endpoint, e.g. http://localhost:4318, receiving trace spans of the restore and its AWS calls")
+	httpMaxIdleConns := fs.Int("http-max-idle-conns", 0, "Idle connections the AWS HTTP client keeps open per host; set to about twice -workers (0 = SDK default of 10)")
+	httpConnTimeout := fs.Duration("http-connect-timeout", 0, "Timeout for opening a connection to S3 or DynamoDB (0 = SDK default of 30s)")
+	httpTLSTimeout := fs.Duration("http-tls-timeout", 0, "Timeout for the TLS handshake of a new connection (0 = SDK default of 10s)")
+	clientShards := fs.Int("client-shards", 0, "Spread workers over this many AWS connection pools, each worker keeping to one; -workers gives each its own (0 = one shared pool)")
+	journalURI := fs.String("journal", "", "Record every operation written to the target tables, with its source and result, as JSON lines under this s3:// prefix")
+	journalRotate := fs.Int("journal-rotate-mb", 64, "Start a new -journal object once the current one reaches this many MiB")
+	offloadURI := fs.String("offload-uri", "", "Move the largest attributes of items over -offload-threshold-kb to objects under this s3:// prefix, leaving pointers of bucket, key and etag in their place")
+	offloadKiB := fs.Int("offload-threshold-kb", 350, "Item size, in KiB, above which -offload-uri offloads attributes")
+	applyJournalURI := fs.String("apply-journal", "", "Replay the operations of a -journal prefix into -table instead of restoring an export")
+	repairReport := fs.String("repair", "", "Report (-report) of an earlier run, as an s3:// URI or local path; restore only the files it lists as failed or with dead-lettered lines")
+	invertJournal := fs.Bool("invert", false, "With -apply-journal, undo the journaled operations, newest first, instead of replaying them")
+	disableHTTP2 := fs.Bool("disable-http2", false, "Use HTTP/1.1 only for AWS requests")
+	maxLineMiB := fs.Int("max-line-mb", 10, "Longest data file line in MiB; a longer line fails its file with the file and offset instead of being buffered whole")
+	cacheDir := fs.String("cache-dir", "", "Local directory caching downloaded data files, so a retried or resumed file is read from disk and an interrupted download continues where it stopped")
+	cacheMiB := fs.Int("cache-mb", 10240, "Size in MiB of the -cache-dir cache; the files read longest ago are evicted first")
+	readAhead := fs.Int("read-ahead", 0, "Read data files as 8 MiB byte ranges, fetching this many ranges ahead of the one being decoded to hide S3 latency (0 = one request per file)")
+	memoryBudget := fs.Int("memory-budget", 0, "Approximate memory in MiB for read buffers and batches across workers; read-ahead and batches shrink and files wait as it fills (0 = unlimited)")
+	noManifest := fs.Bool("no-manifest", false, "Read the data files -export lists, as a comma-separated list of objects, prefixes and globs, without a manifest; -type and -view describe them")
+	allowGaps := fs.Bool("allow-gaps", false, "Apply an export chain given to -export despite gaps or overlaps between its exports")
+	noLock := fs.Bool("no-lock", false, "Restore without locking the target tables against concurrent restores")
+	forceUnlock := fs.String("force-unlock", "", "Remove the target tables' locks held by this owner ID, left by a restore that is no longer running")
+	skipUnchanged := fs.Bool("skip-unchanged", false, "Read the current item of every put with strongly consistent BatchGetItem calls and skip the puts it already matches, trading read units for write units when rerunning a restore")
+	replaySpeed := fs.Float64("replay-speed", 0, "Write the operations of incremental exports at this multiple of the pace they were originally written at, e.g. 10 for ten times real time (0 = as fast as possible)")
+	maxDownloadMbps := fs.Float64("max-download-mbps", 0, "Cap S3 read bandwidth across all workers in Mbit/s (0 = unlimited)")
+
+	// Parse flags as specified in section 7
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	// Create and validate configuration as specified in section 4.1
+	cfg := &config.Config{
+		TableName:         *tableName,
+		ExportS3URI:       *exportS3URI,
+		ExportType:        *exportType,
+		ExportFormat:      *exportFormat,
+		ViewType:          *viewType,
+		Region:            *region,
+		ResumeKey:         *resumeKey,
+		CheckpointHistory: *checkpointHistory,
+		CheckpointEvery:   *checkpointEvery,
+		MaxWorkers:        *maxWorkers,
+		BatchSize:         *batchSize,
+		MemoryBudgetMiB:   *memoryBudget,
+		MaxLineMiB:        *maxLineMiB,
+		ReadAheadParts:    *readAhead,
+		CacheDir:          *cacheDir,
+		CacheMiB:          *cacheMiB,
+		HTTPMaxIdleConns:  *httpMaxIdleConns,
+		ClientShards:      *clientShards,
+		HTTPConnTimeout:   *httpConnTimeout,
+		HTTPTLSTimeout:    *httpTLSTimeout,
+		DisableHTTP2:      *disableHTTP2,
+		TraceEndpoint:     *traceEndpoint,
+		DynamoDBEndpoint:  *dynamoEndpoint,
+		DynamoDBProfile:   *dynamoProfile,
+		Compat:            *compat,
+		JournalURI:        *journalURI,
+		OffloadURI:        *offloadURI,
+		OffloadKiB:        *offloadKiB,
+		JournalRotateMiB:  *journalRotate,
+		ApplyJournalURI:   *applyJournalURI,
+		InvertJournal:     *invertJournal,
+		RepairReportURI:   *repairReport,
+		UpdateParallelism: *updateParallelism,
+		ReportS3URI:       *reportS3URI,
+		DeadLetterURI:     *deadLetterURI,
+		ShadowTable:       *shadowTable,
+		RedactRulesPath:   *redactRules,
+		KeyAttribute:      *keyAttr,
+		KeyPrefix:         *keyPrefix,
+		PriorityFiles:     *priorityFiles,
+		PriorityKeyPrefix: *priorityKeyPrefix,
+		KeyEquals:         *keyEquals,
+		KeysFile:          *keysFile,
+		KeysReportPath:    *keysReport,
+		DriftReportPath:   *driftReport,
+		RemapAttribute:    *remapAttr,
+		RemapPrefix:       *remapPrefix,
+		RemapSuffix:       *remapSuffix,
+		ReshardAttribute:  *reshardAttr,
+		ReshardCount:      *reshardCount,
+		ReshardSeparator:  *reshardSep,
+		ReshardBy:         *reshardBy,
+		ShiftTimeAttrs:    *shiftTimeAttrs,
+		IncludeAttrs:      *includeAttrs,
+		ExcludeAttrs:      *excludeAttrs,
+		PrefixStatsDelim:  *prefixStats,
+		RestoreTo:         *restoreTo,
+		ShiftTimeBy:       *shiftTimeBy,
+		DryRun:            *dryRun,
+		Plan:              *planOnly,
+		PlanSample:        *planSample,
+		AllowGlobalTable:  *allowGlobalTable,
+		AllowOverwrite:    *allowOverwrite,
+		AuditPath:         *auditPath,
+		SDKDecoder:        *sdkDecoder,
+		StrictDecode:      *strictDecode,
+		OnCorrupt:         *onCorrupt,
+		CollectionPolicy:  *collectionPolicy,
+		WriteMode:         *writeMode,
+		WriteHook:         *writeHook,
+		WriteHookTimeout:  *writeHookTimeout,
+		EnableStream:      *enableStream,
+		Tags:              *tags,
+		CopyTags:          *copyTags,
+		RunID:             *runID,
+		Schedule:          *schedule,
+		KeyWriters:        *keyWriters,
+		MaxCorruptPercent: *maxCorruptPercent,
+		ShutdownTimeout:   *shutdownTimeout,
+		StallTimeout:      *stallTimeout,
+		FileTimeout:       *fileTimeout,
+		FileRequeues:      *fileRequeues,
+		UnprocessedLimit:  *unprocessedLimit,
+		BatchTimeout:      *batchTimeout,
+		FollowInterval:    *followInterval,
+		S3PathStyle:       *s3PathStyle,
+		Follow:            *followExports,
+		ProgressFormat:    *progress,
+		NotifyTarget:      *notifyTarget,
+		ControlSocket:     *controlSocket,
+		FollowQueueURL:    *followQueue,
+		LockURI:           *lockURI,
+		NoLock:            *noLock,
+		ForceUnlock:       *forceUnlock,
+		MaxDownloadMbps:   *maxDownloadMbps,
+		ReplaySpeed:       *replaySpeed,
+		SkipUnchanged:     *skipUnchanged,
+		AllowGaps:         *allowGaps,
+		NoManifest:        *noManifest,
+		ReplaySources:     *replaySources,
+		PublishQueueURL:   *publishQueue,
+		DrainQueueURL:     *drainQueueURL,
+		DrainIdle:         *drainIdle,
+		MaterializeURI:    *materializeURI,
+		MaterializeKeys:   *materializeKeys,
+		PartitionBy:       *partitionBy,
+		GlueTable:         *glueTable,
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
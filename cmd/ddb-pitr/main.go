@@ -5,136 +5,852 @@ package main
 
 import (
 	"context"
-	"flag"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
-	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/audit"
 	"github.com/gurre/ddb-pitr/aws"
 	"github.com/gurre/ddb-pitr/checkpoint"
 	"github.com/gurre/ddb-pitr/config"
 	"github.com/gurre/ddb-pitr/coordinator"
+	"github.com/gurre/ddb-pitr/deadletter"
+	"github.com/gurre/ddb-pitr/hook"
 	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/lock"
 	"github.com/gurre/ddb-pitr/manifest"
+	"github.com/gurre/ddb-pitr/materialize"
+	"github.com/gurre/ddb-pitr/metrics"
+	"github.com/gurre/ddb-pitr/notify"
+	"github.com/gurre/ddb-pitr/plan"
+	"github.com/gurre/ddb-pitr/replay"
+	"github.com/gurre/ddb-pitr/s3uri"
+	"github.com/gurre/ddb-pitr/transform"
 	"github.com/gurre/ddb-pitr/writer"
 	"github.com/gurre/s3streamer"
 )
 
 func main() {
-	if err := run(); err != nil {
+	var err error
+	if len(os.Args) > 1 && os.Args[1] == "checkpoint" {
+		err = runCheckpoint(os.Args[2:])
+	} else if len(os.Args) > 1 && os.Args[1] == "rollback" {
+		err = runRollback(os.Args[2:])
+	} else if len(os.Args) > 1 && os.Args[1] == "version" {
+		err = runVersion()
+	} else {
+		err = run()
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
 // run implements the main restore command as specified in section 7.
-// It parses flags, validates configuration, and initializes the restore operation.
+// It parses flags, validates configuration, and runs the mode the flags select.
 func run() error {
-	// Create a new flag set for the restore command as specified in section 7
-	fs := flag.NewFlagSet("restore", flag.ExitOnError)
-
-	// Required flags as specified in section 4.1
-	tableName := fs.String("table", "", "DynamoDB table name to restore to")
-	exportS3URI := fs.String("export", "", "S3 URI of the PITR export (s3://bucket/prefix)")
-
-	// Optional flags as specified in section 4.1
-	exportType := fs.String("type", "FULL", "Export type (FULL|INCREMENTAL)")
-	viewType := fs.String("view", "NEW", "View type (NEW|NEW_AND_OLD)")
-	region := fs.String("region", "", "AWS region (defaults to AWS_REGION env)")
-	resumeKey := fs.String("resume", "", "S3 URI for checkpoint file")
-	maxWorkers := fs.Int("workers", 10, "Maximum number of concurrent workers")
-	batchSize := fs.Int("batch", 25, "Batch size for DynamoDB writes (max 25)")
-	reportS3URI := fs.String("report", "", "S3 URI for the final report")
-	dryRun := fs.Bool("dry-run", false, "Validate configuration without restoring")
-	shutdownTimeout := fs.Duration("shutdown-timeout", 5*time.Minute, "Graceful shutdown timeout")
-
-	// Parse flags as specified in section 7
-	if err := fs.Parse(os.Args[1:]); err != nil {
-		return fmt.Errorf("failed to parse flags: %w", err)
-	}
-
-	// Create and validate configuration as specified in section 4.1
-	cfg := &config.Config{
-		TableName:       *tableName,
-		ExportS3URI:     *exportS3URI,
-		ExportType:      *exportType,
-		ViewType:        *viewType,
-		Region:          *region,
-		ResumeKey:       *resumeKey,
-		MaxWorkers:      *maxWorkers,
-		BatchSize:       *batchSize,
-		ReportS3URI:     *reportS3URI,
-		DryRun:          *dryRun,
-		ShutdownTimeout: *shutdownTimeout,
-	}
-
-	if err := cfg.Validate(); err != nil {
-		return fmt.Errorf("invalid configuration: %w", err)
-	}
-
-	// Load AWS configuration as specified in section 3
-	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(),
-		awsconfig.WithRegion(cfg.Region),
-	)
+	cfg, err := parseFlags(os.Args[1:])
 	if err != nil {
-		return fmt.Errorf("failed to load AWS config: %w", err)
+		return err
 	}
 
-	// Initialize AWS clients as specified in section 3
-	dynamoClient := aws.NewDynamoDBClient(dynamodb.NewFromConfig(awsCfg))
-	rawS3Client := s3.NewFromConfig(awsCfg)
-	s3Client := aws.NewS3Client(rawS3Client)
-
 	// Create context with graceful shutdown handling
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	s, err := newSession(ctx, cfg, cancel)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	ctx, span := s.tracerProvider.Tracer("github.com/gurre/ddb-pitr").StartSpan(ctx, "Restore")
+	defer span.End()
+	span.SetProperty("export.uri", cfg.ExportS3URI)
+
+	switch {
+	case cfg.ApplyJournalURI != "":
+		// -apply-journal redoes or undoes the writes of an earlier run instead of reading an export
+		return s.applyJournal(ctx)
+	case cfg.DrainQueueURL != "":
+		// -drain writes operations published by another run instead of reading an export
+		return s.drain(ctx)
+	default:
+		return s.restore(ctx)
+	}
+}
+
+// metricsRecorder forwards the capacity consumed by the writers, the retries of
+// the DynamoDB client and the connections of the HTTP client to the metrics of
+// the running coordinator. The writers and clients outlive each coordinator,
+// since -follow applies every export with a new coordinator over the same writers.
+type metricsRecorder struct {
+	metrics atomic.Pointer[metrics.Metrics]
+	streams []metrics.StreamReport // Streams enabled before the first coordinator, reported by each
+	run     metrics.RunReport      // How the restore was run, reported by each coordinator
+}
+
+// next starts collecting into fresh metrics and returns the option handing them
+// to the next coordinator.
+func (r *metricsRecorder) next() coordinator.Option {
+	m := metrics.NewMetrics()
+	m.SetRun(r.run)
+	for _, st := range r.streams {
+		m.RecordStream(st.Table, st.StreamARN, st.ViewType)
+	}
+	r.metrics.Store(m)
+	return coordinator.WithMetrics(m)
+}
+
+// recordExport records the export a coordinator applies in its metrics. It is
+// the coordinator's summary hook.
+func (r *metricsRecorder) recordExport(s manifest.Summary) error {
+	if m := r.metrics.Load(); m != nil {
+		m.RecordExport(metrics.ExportReport{
+			ExportARN:      s.ExportARN,
+			TableARN:       s.TableARN,
+			ExportType:     s.ExportType,
+			ExportTime:     s.ExportTime,
+			ExportFromTime: s.ExportFromTime,
+			ExportToTime:   s.ExportToTime,
+			S3Bucket:       s.S3Bucket,
+			S3Prefix:       s.S3Prefix,
+			ItemCount:      s.ItemCount,
+		})
+	}
+	return nil
+}
+
+// RecordUnchanged implements writer.UnchangedRecorder.
+func (r *metricsRecorder) RecordUnchanged(n int64) {
+	if m := r.metrics.Load(); m != nil {
+		m.RecordUnchanged(n)
+	}
+}
+
+// RecordConsumedCapacity implements writer.CapacityRecorder.
+func (r *metricsRecorder) RecordConsumedCapacity(table string, units float64, indexes map[string]float64) {
+	if m := r.metrics.Load(); m != nil {
+		m.RecordConsumedCapacity(table, units, indexes)
+	}
+}
+
+// RecordTargetWrite implements writer.ShadowRecorder.
+func (r *metricsRecorder) RecordTargetWrite(table string, items int, d time.Duration) {
+	if m := r.metrics.Load(); m != nil {
+		m.RecordTargetWrite(table, items, d)
+	}
+}
+
+// RecordTargetError implements writer.ShadowRecorder.
+func (r *metricsRecorder) RecordTargetError(table string) {
+	if m := r.metrics.Load(); m != nil {
+		m.RecordTargetError(table)
+	}
+}
+
+// RecordUnprocessedLimit implements writer.UnprocessedRecorder.
+func (r *metricsRecorder) RecordUnprocessedLimit(table string, items int) {
+	if m := r.metrics.Load(); m != nil {
+		m.RecordUnprocessedLimit(table, items)
+	}
+}
+
+// RecordItemCollection implements writer.CollectionRecorder.
+func (r *metricsRecorder) RecordItemCollection(table, key string, bytes int64) {
+	if m := r.metrics.Load(); m != nil {
+		m.RecordItemCollection(table, key, bytes)
+	}
+}
+
+// RecordCollectionFull implements writer.CollectionRecorder.
+func (r *metricsRecorder) RecordCollectionFull(table, key string, skipped int) {
+	if m := r.metrics.Load(); m != nil {
+		m.RecordCollectionFull(table, key, skipped)
+	}
+}
+
+// deadLetterCounter counts the operations the writers dead-letter per export
+// file in the current metrics, so the report lists the files a -repair restores
+// again. Corrupt lines are counted by the coordinator.
+type deadLetterCounter struct {
+	deadletter.Sink
+	recorder *metricsRecorder
+}
+
+// Write implements writer.DeadLetterSink.
+func (d deadLetterCounter) Write(ctx context.Context, rec deadletter.Record) error {
+	if err := d.Sink.Write(ctx, rec); err != nil {
+		return err
+	}
+	if m := d.recorder.metrics.Load(); m != nil && rec.SourceFile != "" {
+		m.RecordDeadLettered(rec.SourceFile)
+	}
+	return nil
+}
+
+// RecordRetry implements aws.RetryRecorder.
+func (r *metricsRecorder) RecordRetry(throttled bool) {
+	if m := r.metrics.Load(); m != nil {
+		m.RecordRetry(throttled)
+	}
+}
+
+// RecordConnection implements aws.ConnRecorder.
+func (r *metricsRecorder) RecordConnection(reused bool, wait time.Duration) {
+	if m := r.metrics.Load(); m != nil {
+		m.RecordConnection(reused, wait)
+	}
+}
+
+// RecordDNSLookup implements aws.ConnRecorder.
+func (r *metricsRecorder) RecordDNSLookup(d time.Duration) {
+	if m := r.metrics.Load(); m != nil {
+		m.RecordDNSLookup(d)
+	}
+}
+
+// acquireLocks locks every target table, first removing the locks held by
+// cfg.ForceUnlock. On failure the locks already taken are released.
+func acquireLocks(ctx context.Context, out io.Writer, client lock.Client, cfg *config.Config) ([]*lock.Lock, error) {
+	var locks []*lock.Lock
+	var owner string // Shared by all tables so one -force-unlock clears them
+	for _, table := range cfg.TargetTables() {
+		uri := cfg.LockObjectURI(table)
+		if cfg.ForceUnlock != "" {
+			if err := lock.ForceUnlock(ctx, client, uri, cfg.ForceUnlock); err != nil {
+				releaseLocks(locks)
+				return nil, err
+			}
+		}
+		l, err := lock.New(client, uri, table, cfg.ExportS3URI, lock.WithOwner(owner))
+		if err == nil {
+			owner = l.Owner()
+			err = l.Acquire(ctx)
+		}
+		if err != nil {
+			releaseLocks(locks)
+			return nil, fmt.Errorf("failed to lock table %s: %w", table, err)
+		}
+		locks = append(locks, l)
+	}
+	if len(locks) > 0 {
+		fmt.Fprintf(out, "Locked target tables as owner %s\n", locks[0].Owner())
+	}
+	return locks, nil
+}
+
+// releaseLocks releases locks, reporting failures on stderr; an unreleased lock
+// expires on its own.
+func releaseLocks(locks []*lock.Lock) {
+	for _, l := range locks {
+		if err := l.Release(context.Background()); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+}
 
-	// Create and initialize required components for the coordinator
-	manifestLoader := manifest.NewS3Loader(s3Client)
-	streamer := s3streamer.NewS3Streamer(rawS3Client)
-	jsonDecoder := itemimage.NewJSONDecoder()
-	ddbWriter := writer.NewDynamoDBWriter(dynamoClient, cfg.TableName, cfg.BatchSize)
+// keySampleLines is how many lines of the first data file are checked against
+// the target tables' key schemas.
+const keySampleLines = 16
 
-	// Set up the checkpoint store based on ResumeKey
-	var checkpointStore checkpoint.Store
-	if cfg.ResumeKey != "" {
-		// Use S3Store if a resume key is provided
-		s3Store, err := checkpoint.NewS3Store(s3Client, cfg.ResumeKey)
+// errSampled stops streaming once enough lines were checked.
+var errSampled = errors.New("sampled")
+
+// writeMaterialized writes the items collected by -materialize as CSV files
+// under uri, a file:// directory or an s3:// prefix, and returns what it wrote.
+func writeMaterialized(ctx context.Context, out io.Writer, client materialize.PutClient, table *materialize.Table, uri string) (materialize.Stats, error) {
+	var output materialize.Output
+	if strings.HasPrefix(uri, "s3://") {
+		s3Output, err := materialize.NewS3Output(client, uri)
 		if err != nil {
-			return fmt.Errorf("failed to create checkpoint store: %w", err)
+			return materialize.Stats{}, fmt.Errorf("invalid materialize URI: %w", err)
 		}
-		checkpointStore = s3Store
+		output = s3Output
 	} else {
-		// Use in-memory store if no resume key provided
-		checkpointStore = checkpoint.NewMemoryStore()
+		u, err := url.Parse(uri)
+		if err != nil {
+			return materialize.Stats{}, fmt.Errorf("invalid materialize URI: %w", err)
+		}
+		output = materialize.NewDirOutput(u.Path)
+	}
+	stats, err := table.Close(ctx, output)
+	if err != nil {
+		return stats, fmt.Errorf("failed to materialize to %s: %w", uri, err)
+	}
+	fmt.Fprintf(out, "Materialized %d items (%d deleted) with columns %s in %d partitions under %s\n",
+		stats.Items, stats.Deleted, strings.Join(stats.Columns, ","), len(stats.Partitions), uri)
+	return stats, nil
+}
+
+// hooked wraps w so its batches for table pass through h first, or returns w
+// when no write hook runs. The journal, inside the hook, records what was written.
+func hooked(w writer.Writer, h *hook.Hook, table string) writer.Writer {
+	if h == nil {
+		return w
+	}
+	return hook.NewWriter(w, h, table)
+}
+
+// audited wraps w so the operations it writes to table are recorded by a, or
+// returns w when duplicate applies are not audited.
+func audited(w writer.Writer, a *audit.DuplicateAuditor, table string) writer.Writer {
+	if a == nil {
+		return w
 	}
+	return audit.NewWriter(w, a, table)
+}
 
-	// Create report uploader if report URI is provided
-	var reportUploader *aws.S3ReportUploader
-	if cfg.ReportS3URI != "" {
-		reportUploader = aws.NewS3ReportUploader(s3Client)
+// keyAttrsOf returns the key attributes of table, partition key first, or nil
+// when table could not be described.
+func keyAttrsOf(infos []plan.TableInfo, table string) []string {
+	var keyAttrs []string
+	for _, info := range infos {
+		if info.Name == table {
+			for _, k := range info.KeySchema {
+				keyAttrs = append(keyAttrs, k.Name)
+			}
+		}
 	}
+	return keyAttrs
+}
+
+// splitAttrs returns the attributes of a comma-separated list, or nil when it
+// is empty.
+func splitAttrs(list string) []string {
+	if list == "" {
+		return nil
+	}
+	var attrs []string
+	for _, attr := range strings.Split(list, ",") {
+		attrs = append(attrs, strings.TrimSpace(attr))
+	}
+	return attrs
+}
+
+// noManifestListing returns what a manifest would say about the data files of
+// a -no-manifest restore, taken from -type and -view, and the view their lines
+// are decoded as.
+func noManifestListing(cfg *config.Config, format manifest.Format) (manifest.Listing, itemimage.View) {
+	listing := manifest.Listing{ExportType: manifest.ExportTypeFull, OutputFormat: format.OutputFormat()}
+	if cfg.ExportType != "INCREMENTAL" {
+		return listing, itemimage.ViewFull
+	}
+	listing.ExportType = manifest.ExportTypeIncremental
+	if cfg.ViewType == "NEW_AND_OLD" {
+		listing.OutputView = "NEW_AND_OLD_IMAGES"
+		return listing, itemimage.ViewNewAndOld
+	}
+	listing.OutputView = "NEW_IMAGE"
+	return listing, itemimage.ViewNew
+}
 
-	// Create the coordinator with all dependencies
-	coord := coordinator.NewCoordinator(
-		cfg,
-		manifestLoader,
-		streamer,
-		jsonDecoder,
-		ddbWriter,
-		checkpointStore,
-		reportUploader,
-	)
+// exportViewDecoder returns decoder reading the lines of the export summary
+// describes, so records with only Keys are deletes in the NEW_IMAGE view, as the
+// coordinator reads them.
+func exportViewDecoder(decoder itemimage.Decoder, summary manifest.Summary) itemimage.Decoder {
+	if summary.OutputView == "NEW_IMAGE" {
+		return itemimage.ForView(decoder, itemimage.ViewNew)
+	}
+	return decoder
+}
 
-	// Run the coordinator
-	fmt.Printf("Starting restore of table %s from %s\n", cfg.TableName, cfg.ExportS3URI)
-	if err := coord.Run(ctx); err != nil {
-		return fmt.Errorf("restore operation failed: %w", err)
+// tableWriter returns the writer of table for cfg.WriteMode. PartiQL statements
+// name the item's key, so that mode requires table's key schema.
+func tableWriter(client *aws.DynamoDBClientImpl, table string, cfg *config.Config, infos []plan.TableInfo, opts []writer.Option) (writer.Writer, error) {
+	if cfg.WriteMode != "partiql" {
+		return writer.NewDynamoDBWriter(client, table, cfg.BatchSize, opts...), nil
 	}
+	keyAttrs := keyAttrsOf(infos, table)
+	if len(keyAttrs) == 0 {
+		return nil, fmt.Errorf("write mode partiql requires the key schema of table %s, which could not be described", table)
+	}
+	return writer.NewPartiQLWriter(client, table, keyAttrs, cfg.BatchSize, opts...), nil
+}
 
-	fmt.Println("Restore operation completed successfully")
+// replayStreams applies the stream records of each source in turn. Sources are
+// applied in the order given, which must be the order the records were made.
+func replayStreams(ctx context.Context, out io.Writer, client replay.ObjectGetter, applier *replay.Applier,
+	decoder itemimage.Decoder, sources string) error {
+	for _, source := range strings.Split(sources, ",") {
+		source = strings.TrimSpace(source)
+		f, err := replay.Open(ctx, client, source)
+		if err != nil {
+			return fmt.Errorf("failed to open replay source: %w", err)
+		}
+		fmt.Fprintf(out, "Replaying stream records from %s\n", source)
+		stats, err := applier.Apply(ctx, replay.NewReader(f, decoder))
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to replay %s after %d records: %w", source, stats.Records, err)
+		}
+		fmt.Fprintf(out, "Replayed %d records from %s: %d puts, %d deletes, %d dropped\n",
+			stats.Records, source, stats.Puts, stats.Deletes, stats.Dropped)
+	}
 	return nil
 }
+
+// loadChain resolves and loads the exports of an export chain, orders them and
+// prints the timeline. Gaps and overlaps between the exports lose or repeat
+// changes, so they fail the restore unless -allow-gaps is set.
+func loadChain(ctx context.Context, out io.Writer, client manifest.ObjectFinder, loader manifest.Loader, cfg *config.Config) (plan.Chain, error) {
+	var exports []plan.ChainExport
+	for _, uri := range cfg.ExportURIs() {
+		resolvedURI, err := manifest.ResolveURI(ctx, client, uri)
+		if err != nil {
+			return plan.Chain{}, fmt.Errorf("failed to resolve export URI %s: %w", uri, err)
+		}
+		summary, err := loader.LoadSummary(ctx, resolvedURI)
+		if err != nil {
+			return plan.Chain{}, fmt.Errorf("failed to load manifest of %s: %w", resolvedURI, err)
+		}
+		exports = append(exports, plan.ChainExport{URI: resolvedURI, Summary: summary})
+	}
+	chain, err := plan.NewChain(exports)
+	if err != nil {
+		return plan.Chain{}, fmt.Errorf("invalid export chain: %w", err)
+	}
+	fmt.Fprintln(out, chain)
+	if err := chain.Check(); err != nil {
+		if !cfg.AllowGaps {
+			return plan.Chain{}, fmt.Errorf("%w. Pass -allow-gaps to restore anyway", err)
+		}
+		fmt.Fprintf(out, "Warning: %v\n", err)
+	}
+	return chain, nil
+}
+
+// checkKeySchemas fails when the exported table, if it can still be described,
+// or the first decoded items do not have the key of a target table. Tables that
+// could not be described are not checked, and a failure to read the sample is
+// only reported, since the restore retries its reads.
+func checkKeySchemas(ctx context.Context, out io.Writer, client plan.TableDescriber, loader manifest.Loader, streamer s3streamer.Streamer,
+	decoder itemimage.Decoder, cfg *config.Config, targets []plan.TableInfo) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	summary, err := loader.LoadSummary(ctx, cfg.ExportS3URI)
+	if err != nil {
+		return fmt.Errorf("failed to load manifest: %w", err)
+	}
+	decoder = exportViewDecoder(decoder, summary)
+
+	// The exported table may be gone or in another account; then only items are checked
+	if summary.TableARN != "" {
+		if source, err := plan.DescribeTable(ctx, client, summary.TableARN, cfg.Region); err == nil {
+			for _, target := range targets {
+				if err := plan.CompareKeySchemas(source, target); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for file, err := range loader.Files(ctx, summary) {
+		if err != nil {
+			return fmt.Errorf("failed to load manifest: %w", err)
+		}
+		// Only DynamoDB's manifests, which also hold checksums, count the items of a file
+		if file.ItemCount == 0 && file.MD5Base64 != "" {
+			continue
+		}
+		lines := 0
+		var mismatch error
+		err := streamer.Stream(ctx, cfg.GetExportBucketName(), file.Key, 0, func(line []byte, offset int64) error {
+			op, err := decoder.Decode(line)
+			if err != nil {
+				return nil // Corrupt lines are handled by the restore
+			}
+			for _, target := range targets {
+				if err := target.CheckKeys(op); err != nil {
+					mismatch = fmt.Errorf("%s at %s@%d: %w", op.Type, file.Key, offset, err)
+					return errSampled
+				}
+			}
+			if lines++; lines == keySampleLines {
+				return errSampled
+			}
+			return nil
+		})
+		if mismatch != nil {
+			return mismatch
+		}
+		if err != nil && !errors.Is(err, errSampled) {
+			fmt.Fprintf(out, "Warning: could not check the export's keys against the target tables: %v\n", err)
+		}
+		return nil
+	}
+	return nil
+}
+
+// reportSample prints statistics of up to n items of the export at uri, taking
+// an equal share from each data file so the sample is not only the first file's
+// items.
+func reportSample(ctx context.Context, out io.Writer, loader manifest.Loader, streamer s3streamer.Streamer,
+	decoder itemimage.Decoder, uri string, n int) error {
+	u, err := s3uri.Parse(uri)
+	if err != nil {
+		return err
+	}
+	summary, err := loader.LoadSummary(ctx, uri)
+	if err != nil {
+		return fmt.Errorf("failed to load manifest: %w", err)
+	}
+	decoder = exportViewDecoder(decoder, summary)
+	perFile := n
+	if files := len(summary.DataFiles); files > 0 {
+		perFile = max((n+files-1)/files, 1)
+	}
+
+	sampler := plan.NewSampler()
+	sampled := 0
+	for file, err := range loader.Files(ctx, summary) {
+		if err != nil {
+			return fmt.Errorf("failed to load manifest: %w", err)
+		}
+		taken, limit := 0, min(perFile, n-sampled)
+		err := streamer.Stream(ctx, u.Bucket, file.Key, 0, func(line []byte, offset int64) error {
+			op, err := decoder.Decode(line)
+			if err != nil || len(op.NewImage) == 0 {
+				return nil // Corrupt lines are handled by the restore, deletes hold no item
+			}
+			sampler.Add(op.NewImage)
+			if taken++; taken == limit {
+				return errSampled
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errSampled) {
+			return fmt.Errorf("failed to read %s: %w", file.Key, err)
+		}
+		if sampled += taken; sampled >= n {
+			break
+		}
+	}
+	fmt.Fprintln(out, sampler.Stats())
+	return nil
+}
+
+// repairFiles returns the files the report at uri lists as needing repair.
+func repairFiles(ctx context.Context, client replay.ObjectGetter, uri string) ([]string, error) {
+	f, err := replay.Open(ctx, client, uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repair report: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	files, err := metrics.LoadFileReports(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repair report %s: %w", uri, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("repair report %s has no file statuses; it was written by an older version", uri)
+	}
+	var repair []string
+	for _, file := range files {
+		if file.NeedsRepair() {
+			repair = append(repair, file.File)
+		}
+	}
+	return repair, nil
+}
+
+// resuming reports whether cfg resumes a restore that saved progress, whose
+// target tables hold the items it already wrote.
+func resuming(ctx context.Context, client aws.S3Client, cfg *config.Config, owner string) bool {
+	if cfg.ResumeKey == "" {
+		return false
+	}
+	store, err := checkpoint.NewS3Store(client, cfg.ResumeKey, checkpoint.WithOwner(owner))
+	if err != nil {
+		return false
+	}
+	state, err := store.Load(ctx)
+	return err == nil && state.LastFile != ""
+}
+
+// tagTables adds the exported table's tags, with -copy-tags, and cfg.TableTags
+// to each target table. -copy-tags fails when the exported table's tags cannot
+// be listed, e.g. when its region is down, so the tables are not left untagged
+// unnoticed.
+func tagTables(ctx context.Context, out io.Writer, client plan.TableTagger, loader manifest.Loader, cfg *config.Config) error {
+	tags := make(map[string]string)
+	if cfg.CopyTags {
+		summary, err := loader.LoadSummary(ctx, cfg.ExportS3URI)
+		if err != nil {
+			return fmt.Errorf("failed to load manifest: %w", err)
+		}
+		if summary.TableARN == "" {
+			return fmt.Errorf("copy tags requires the exported table, which the manifest does not name; pass -tags instead")
+		}
+		if tags, err = plan.TableTags(ctx, client, summary.TableARN); err != nil {
+			return fmt.Errorf("copy tags: %w", err)
+		}
+	}
+	maps.Copy(tags, cfg.TableTags())
+	if len(tags) == 0 {
+		fmt.Fprintln(out, "No tags to add to the target tables")
+		return nil
+	}
+	for _, table := range cfg.TargetTables() {
+		if err := plan.TagTable(ctx, client, table, tags); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Tagged %s with %d tags\n", table, len(tags))
+	}
+	return nil
+}
+
+// enableStreams enables the stream of each target table with cfg.EnableStream,
+// or the view type of the exported table's stream for SOURCE, and records the
+// stream ARNs for the report. SOURCE fails when the exported table cannot be
+// described, and enables nothing when it has no stream.
+func enableStreams(ctx context.Context, out io.Writer, client plan.StreamEnabler, loader manifest.Loader, recorder *metricsRecorder, cfg *config.Config) error {
+	viewType := cfg.EnableStream
+	if viewType == "SOURCE" {
+		summary, err := loader.LoadSummary(ctx, cfg.ExportS3URI)
+		if err != nil {
+			return fmt.Errorf("failed to load manifest: %w", err)
+		}
+		if summary.TableARN == "" {
+			return fmt.Errorf("enable stream SOURCE requires the exported table, which the manifest does not name; pass a view type instead")
+		}
+		if viewType, err = plan.StreamViewType(ctx, client, summary.TableARN); err != nil {
+			return fmt.Errorf("enable stream SOURCE: %w; pass a view type instead", err)
+		}
+		if viewType == "" {
+			fmt.Fprintf(out, "Exported table %s has no stream; leaving the streams of the target tables unchanged\n", summary.TableARN)
+			return nil
+		}
+	}
+	for _, table := range cfg.TargetTables() {
+		arn, err := plan.EnableStream(ctx, client, table, viewType)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Stream of %s (%s): %s\n", table, viewType, arn)
+		recorder.streams = append(recorder.streams, metrics.StreamReport{Table: table, StreamARN: arn, ViewType: viewType})
+	}
+	return nil
+}
+
+// checkOverwrites refuses to restore into a target table that already holds
+// items. DynamoDB's item count of a described table is up to six hours old, so
+// a table it counts as empty is scanned for one item. A table that can be
+// neither described nor scanned is reported and restored without the check.
+func checkOverwrites(ctx context.Context, out io.Writer, client audit.ScanClient, cfg *config.Config, infos []plan.TableInfo) error {
+	counts := make(map[string]int64, len(infos))
+	for _, info := range infos {
+		counts[info.Name] = info.ItemCount
+	}
+	for _, table := range cfg.TargetTables() {
+		nonEmpty := counts[table] > 0
+		if !nonEmpty {
+			var err error
+			if nonEmpty, err = audit.HasItems(ctx, client, table); err != nil {
+				fmt.Fprintf(out, "Warning: could not check whether table %s is empty: %v\n", table, err)
+				continue
+			}
+		}
+		if nonEmpty {
+			return fmt.Errorf("table %s already holds items; the restore overwrites those with the key of an exported item. "+
+				"Run with -plan to count them, and pass -allow-non-empty to restore anyway", table)
+		}
+	}
+	return nil
+}
+
+// reportConflicts scans the keys of every target table that holds items and
+// counts the operations of the exports at uris that would overwrite, delete or
+// add to them. Key filters and remapping are not applied to the operations.
+func reportConflicts(ctx context.Context, out io.Writer, client audit.ScanClient, loader manifest.Loader, streamer s3streamer.Streamer,
+	decoder itemimage.Decoder, uris []string, cfg *config.Config, infos []plan.TableInfo) error {
+	type target struct {
+		table string
+		set   *audit.KeySet
+		stats audit.ConflictStats
+	}
+	var targets []*target
+	for _, info := range infos {
+		nonEmpty := info.ItemCount > 0
+		if !nonEmpty {
+			var err error
+			if nonEmpty, err = audit.HasItems(ctx, client, info.Name); err != nil {
+				return err
+			}
+		}
+		if !nonEmpty {
+			fmt.Fprintf(out, "Table %s is empty; the restore overwrites no items\n", info.Name)
+			continue
+		}
+		var keyAttrs []string
+		for _, k := range info.KeySchema {
+			keyAttrs = append(keyAttrs, k.Name)
+		}
+		fmt.Fprintf(out, "Table %s holds items; scanning their keys\n", info.Name)
+		set, err := audit.ScanKeys(ctx, client, info.Name, keyAttrs, info.ItemCount, cfg.MaxWorkers)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, &target{table: info.Name, set: set})
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	for _, uri := range uris {
+		u, err := s3uri.Parse(uri)
+		if err != nil {
+			return err
+		}
+		summary, err := loader.LoadSummary(ctx, uri)
+		if err != nil {
+			return fmt.Errorf("failed to load manifest: %w", err)
+		}
+		decoder := exportViewDecoder(decoder, summary)
+		for file, err := range loader.Files(ctx, summary) {
+			if err != nil {
+				return fmt.Errorf("failed to load manifest: %w", err)
+			}
+			err := streamer.Stream(ctx, u.Bucket, file.Key, 0, func(line []byte, offset int64) error {
+				op, err := decoder.Decode(line)
+				if err != nil {
+					return nil // Corrupt lines are handled by the restore
+				}
+				for _, t := range targets {
+					t.stats.Record(t.set, op)
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", file.Key, err)
+			}
+		}
+	}
+	for _, t := range targets {
+		fmt.Fprintf(out, "Table %s: the restore overwrites %d of its %d items, deletes %d and adds %d new items",
+			t.table, t.stats.Overwrites, t.set.Len(), t.stats.Deletes, t.stats.Inserts)
+		if t.stats.Unkeyed > 0 {
+			fmt.Fprintf(out, "; %d operations without the table's key were not counted", t.stats.Unkeyed)
+		}
+		fmt.Fprintln(out)
+	}
+	return nil
+}
+
+// describeTargets looks up every target table. In plan mode a failed lookup is an
+// error; otherwise it is reported and the table is restored without the check.
+func describeTargets(ctx context.Context, out io.Writer, client plan.TableDescriber, cfg *config.Config) ([]plan.TableInfo, error) {
+	var infos []plan.TableInfo
+	for _, table := range cfg.TargetTables() {
+		info, err := plan.DescribeTable(ctx, client, table, cfg.Region)
+		if err != nil {
+			if cfg.Plan {
+				return nil, err
+			}
+			fmt.Fprintf(out, "Warning: could not check whether %s is a global table: %v\n", table, err)
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// reportKeys prints how many requested keys were found and optionally writes the
+// per-key results to path.
+func reportKeys(out io.Writer, keys *transform.KeyList, path string) error {
+	results := keys.Results()
+	found := 0
+	for _, r := range results {
+		if r.Found {
+			found++
+		}
+	}
+	fmt.Fprintf(out, "Found %d of %d requested keys\n", found, len(results))
+
+	if path == "" {
+		return nil
+	}
+	if err := keys.WriteResults(path); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Key report written to %s\n", path)
+	return nil
+}
+
+// reportDrift prints how the settings of each target table differ from those of
+// the exported table, and writes the reports to cfg.DriftReportPath. The drift
+// is skipped when the exported table is unknown or cannot be described, e.g.
+// after it was deleted or from another account.
+func reportDrift(ctx context.Context, out io.Writer, client plan.SchemaDescriber, tableARN string, cfg *config.Config) error {
+	reports := []plan.DriftReport{}
+	if tableARN == "" {
+		fmt.Fprintln(out, "Schema drift not checked: the manifest does not name the exported table")
+	} else if source, err := plan.DescribeSchema(ctx, client, tableARN); err != nil {
+		fmt.Fprintf(out, "Schema drift not checked: %v\n", err)
+	} else {
+		for _, table := range cfg.TargetTables() {
+			target, err := plan.DescribeSchema(ctx, client, table)
+			if err != nil {
+				return err
+			}
+			report := plan.CompareSchemas(source, target)
+			fmt.Fprintln(out, report)
+			reports = append(reports, report)
+		}
+	}
+
+	if cfg.DriftReportPath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(cfg.DriftReportPath, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write drift report: %w", err)
+	}
+	fmt.Fprintf(out, "Drift report written to %s\n", cfg.DriftReportPath)
+	return nil
+}
+
+// reportDuplicates prints how many operations the audit saw applied more than once.
+func reportDuplicates(out io.Writer, auditor *audit.DuplicateAuditor, path string) {
+	n, samples := auditor.Duplicates()
+	if n == 0 {
+		fmt.Fprintf(out, "Audit: %d operations applied, no duplicates (log: %s)\n", auditor.Applied(), path)
+		return
+	}
+	fmt.Fprintf(out, "Warning: %d of %d operations had already been applied, e.g. after a resume (e.g. %v)\n",
+		n, auditor.Applied(), samples)
+}
+
+// notifyTimeout bounds notification delivery, which runs after the restore context
+// may already have been cancelled.
+const notifyTimeout = 30 * time.Second
+
+// sendNotification delivers the outcome to cfg.NotifyTarget. Delivery failures are
+// reported on stderr but never change the restore's exit status.
+func sendNotification(cfg *config.Config, awsCfg awssdk.Config, report metrics.Report, runErr error) {
+	var notifier notify.Notifier
+	if notify.IsSNSTarget(cfg.NotifyTarget) {
+		notifier = notify.NewSNSNotifier(sns.NewFromConfig(awsCfg), cfg.NotifyTarget)
+	} else {
+		notifier = notify.NewWebhookNotifier(&http.Client{Timeout: notifyTimeout}, cfg.NotifyTarget)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	n := notify.NewNotification(cfg.TableName, cfg.ExportS3URI, &report, runErr)
+	if err := notifier.Notify(ctx, n); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to send notification: %v\n", err)
+	}
+}
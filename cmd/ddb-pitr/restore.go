@@ -0,0 +1,813 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/gurre/ddb-pitr/audit"
+	"github.com/gurre/ddb-pitr/aws"
+	"github.com/gurre/ddb-pitr/bandwidth"
+	"github.com/gurre/ddb-pitr/checkpoint"
+	"github.com/gurre/ddb-pitr/config"
+	"github.com/gurre/ddb-pitr/control"
+	"github.com/gurre/ddb-pitr/coordinator"
+	"github.com/gurre/ddb-pitr/deadletter"
+	"github.com/gurre/ddb-pitr/follow"
+	"github.com/gurre/ddb-pitr/hook"
+	"github.com/gurre/ddb-pitr/lock"
+	"github.com/gurre/ddb-pitr/manifest"
+	"github.com/gurre/ddb-pitr/materialize"
+	"github.com/gurre/ddb-pitr/metrics"
+	"github.com/gurre/ddb-pitr/plan"
+	"github.com/gurre/ddb-pitr/replay"
+	"github.com/gurre/ddb-pitr/stream"
+	"github.com/gurre/ddb-pitr/transform"
+	"github.com/gurre/ddb-pitr/writer"
+	"github.com/gurre/s3streamer"
+)
+
+// restore holds what the steps of restoring exports into the target tables
+// build for the steps after them. Each step fills in its fields from the
+// session and the fields of the steps before it.
+type restore struct {
+	*session
+	chain          plan.Chain // Exports to apply in order; empty for a single export
+	restoreTime    time.Time  // -restore-to; zero without it
+	resumeOwner    string     // Owner of the -resume auto checkpoint
+	tableInfos     []plan.TableInfo
+	streamer       s3streamer.Streamer
+	repair         []string // Files of a -repair run
+	coordOpts      []coordinator.Option
+	restoreWriter  audit.Writer // Writes the first target table, or collects -materialize items
+	targetWriters  []writer.Writer
+	materialized   *materialize.Table
+	shadowWriter   *writer.ShadowWriter
+	auditor        *audit.DuplicateAuditor
+	reportUploader *aws.S3ReportUploader
+	transformers   transform.Chain
+	lineFilters    transform.LineFilters
+	keyList        *transform.KeyList
+	remapper       *transform.KeyRemapper
+	timeShifter    *transform.TimeShifter
+	restored       manifest.Summary // First export applied, where -follow continues from
+}
+
+// restore applies the export, or the chain of exports, to the target tables,
+// then replays stream records and follows new exports when asked to.
+func (s *session) restore(ctx context.Context) error {
+	cfg := s.cfg
+	r := &restore{session: s}
+	if err := r.resolveExports(ctx); err != nil {
+		return err
+	}
+
+	// Global tables replicate every write, multiplying the cost of a restore
+	var err error
+	if r.tableInfos, err = describeTargets(ctx, s.out, s.dynamoClient, cfg); err != nil {
+		return err
+	}
+	if cfg.Plan {
+		return r.printPlan(ctx)
+	}
+	for _, info := range r.tableInfos {
+		if !info.IsGlobal() {
+			continue
+		}
+		if !cfg.AllowGlobalTable {
+			return fmt.Errorf("table %s is a global table replicating to %v; every write is paid in each region. "+
+				"Run with -plan to see the cost, and pass -allow-global-table to restore anyway", info.Name, info.Regions)
+		}
+		fmt.Fprintf(s.out, "Warning: table %s is a global table; writes replicate to %v\n", info.Name, info.Regions)
+	}
+
+	if err := r.openStreamer(ctx); err != nil {
+		return err
+	}
+
+	// A repair restores again files an earlier run wrote into the target tables
+	if cfg.RepairReportURI != "" {
+		if r.repair, err = repairFiles(ctx, s.rawS3Client, cfg.RepairReportURI); err != nil {
+			return err
+		}
+		if len(r.repair) == 0 {
+			fmt.Fprintf(s.out, "Nothing to repair: every file in %s completed without dead-lettered lines\n", cfg.RepairReportURI)
+			return nil
+		}
+		fmt.Fprintf(s.out, "Repairing %d files listed in %s\n", len(r.repair), cfg.RepairReportURI)
+	}
+
+	if err := r.prepareTables(ctx); err != nil {
+		return err
+	}
+	if err := r.buildWriters(ctx); err != nil {
+		return err
+	}
+	if cfg.ReportS3URI != "" {
+		r.reportUploader = aws.NewS3ReportUploader(s.s3Client, aws.WithReportTags(s.runTags))
+	}
+	if err := r.buildTransformers(ctx); err != nil {
+		return err
+	}
+	if err := r.applyFirst(ctx); err != nil {
+		return err
+	}
+
+	// Later exports of a chain are applied the same way as those found by -follow
+	for i := 1; i < len(r.chain.Exports); i++ {
+		if err := r.applyExport(ctx, r.chain.Exports[i].URI, r.chain.Exports[i].Summary); err != nil {
+			return err
+		}
+	}
+
+	// Stream records made after the last export bring the table up to date
+	if cfg.ReplaySources != "" {
+		targetWriters := r.targetWriters
+		if cfg.DryRun {
+			targetWriters = nil // Decode and count only
+		}
+		applier := replay.NewApplier(targetWriters, cfg.BatchSize, replay.WithTransformer(r.transformers))
+		if err := replayStreams(ctx, s.out, s.rawS3Client, applier, s.jsonDecoder, cfg.ReplaySources); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(s.out, "Restore operation completed successfully")
+	if !cfg.Follow {
+		return nil
+	}
+	return r.followExports(ctx)
+}
+
+// resolveExports finds the manifest of the export, or the chain of exports,
+// named by the config, and the checkpoint a -resume auto run continues from.
+func (r *restore) resolveExports(ctx context.Context) error {
+	cfg := r.cfg
+	var err error
+	// Accept an export directory or prefix as well as the manifest summary itself
+	if len(cfg.ExportURIs()) > 1 && !cfg.NoManifest {
+		if r.chain, err = loadChain(ctx, r.out, r.rawS3Client, r.manifestLoader, cfg); err != nil {
+			return err
+		}
+		cfg.ExportS3URI = r.chain.Exports[0].URI
+	} else if r.format == manifest.FormatDynamoDB && !cfg.NoManifest {
+		resolvedURI, err := manifest.ResolveURI(ctx, r.rawS3Client, cfg.ExportS3URI)
+		if err != nil {
+			return fmt.Errorf("failed to resolve export URI: %w", err)
+		}
+		if resolvedURI != cfg.ExportS3URI {
+			fmt.Fprintf(r.out, "Resolved export URI to %s\n", resolvedURI)
+			cfg.ExportS3URI = resolvedURI
+		}
+	}
+
+	// -resume auto keeps progress under a key derived from the export and target
+	// tables, owned by them so no other restore resumes from it
+	if cfg.ResumeKey == config.ResumeAuto {
+		summary, err := r.manifestLoader.LoadSummary(ctx, cfg.ExportS3URI)
+		if err != nil {
+			return fmt.Errorf("failed to load manifest: %w", err)
+		}
+		export := summary.ExportARN
+		if export == "" {
+			export = cfg.ExportS3URI
+		}
+		cfg.ResumeKey, r.resumeOwner = cfg.AutoResumeKey(export)
+		store, err := checkpoint.NewS3Store(r.s3Client, cfg.ResumeKey, checkpoint.WithOwner(r.resumeOwner))
+		if err != nil {
+			return err
+		}
+		if _, err := store.Load(ctx); err != nil {
+			return fmt.Errorf("cannot resume automatically: %w", err)
+		}
+		fmt.Fprintf(r.out, "Checkpointing to %s\n", cfg.ResumeKey)
+	}
+
+	// -restore-to leaves out the exports starting after it; the last one applied is filtered by write time
+	if cfg.RestoreTo != "" {
+		r.restoreTime, _ = time.Parse(time.RFC3339, cfg.RestoreTo) // Checked by Validate
+		if len(r.chain.Exports) == 0 {
+			summary, err := r.manifestLoader.Load(ctx, cfg.ExportS3URI)
+			if err != nil {
+				return fmt.Errorf("failed to load manifest: %w", err)
+			}
+			if r.chain, err = plan.NewChain([]plan.ChainExport{{URI: cfg.ExportS3URI, Summary: summary}}); err != nil {
+				return err
+			}
+		}
+		exports := len(r.chain.Exports)
+		if r.chain, err = r.chain.Until(r.restoreTime); err != nil {
+			return err
+		}
+		fmt.Fprintf(r.out, "Restoring to %s: applying %d of %d exports, skipping records written later\n",
+			cfg.RestoreTo, len(r.chain.Exports), exports)
+	}
+	return nil
+}
+
+// printPlan prints what restoring each export would cost and change, without
+// writing anything.
+func (r *restore) printPlan(ctx context.Context) error {
+	cfg := r.cfg
+	uris := []string{cfg.ExportS3URI}
+	if len(r.chain.Exports) > 0 {
+		uris = nil
+		for _, e := range r.chain.Exports {
+			uris = append(uris, e.URI)
+		}
+	}
+	var tableARN string
+	for _, uri := range uris {
+		summary, err := r.manifestLoader.Load(ctx, uri)
+		if err != nil {
+			return fmt.Errorf("failed to load manifest: %w", err)
+		}
+		fmt.Fprintln(r.out, plan.New(summary, r.tableInfos))
+		tableARN = summary.TableARN
+	}
+	if err := reportDrift(ctx, r.out, r.dynamoClient, tableARN, cfg); err != nil {
+		return err
+	}
+	if cfg.PlanSample > 0 {
+		// The first export of a chain is the full one, holding every item
+		if err := reportSample(ctx, r.out, r.manifestLoader, stream.NewS3Streamer(r.rawS3Client), r.exportDecoder, uris[0], cfg.PlanSample); err != nil {
+			return err
+		}
+	}
+	return reportConflicts(ctx, r.out, r.dynamoClient, r.manifestLoader, stream.NewS3Streamer(r.rawS3Client), r.exportDecoder, uris, cfg, r.tableInfos)
+}
+
+// openStreamer creates the streamer reading the export's data files within
+// -max-download-mbps and through -cache-dir, and checks with it that the
+// export's key matches the target tables'.
+func (r *restore) openStreamer(ctx context.Context) error {
+	cfg := r.cfg
+	var streamClient s3streamer.S3Client = r.rawS3Client
+	if cfg.MaxDownloadMbps > 0 {
+		// All workers share one limiter so the cap applies to the process as a whole
+		limiter := bandwidth.NewLimiter(bandwidth.MbpsToBytes(cfg.MaxDownloadMbps))
+		streamClient = bandwidth.NewS3Client(r.rawS3Client, limiter)
+	}
+	streamOpts := []stream.Option{stream.WithMaxLineSize(cfg.MaxLineMiB << 20), stream.WithReadAhead(cfg.ReadAheadParts)}
+	if cfg.CacheDir != "" {
+		cache, err := stream.NewDiskCache(cfg.CacheDir, int64(cfg.CacheMiB)<<20)
+		if err != nil {
+			return err
+		}
+		streamOpts = append(streamOpts, stream.WithDiskCache(cache))
+	}
+	r.streamer = stream.NewS3Streamer(streamClient, streamOpts...)
+
+	// Catch exports of a table with a different key before any write fails
+	return checkKeySchemas(ctx, r.out, r.dynamoClient, r.manifestLoader, r.streamer, r.exportDecoder, cfg, r.tableInfos)
+}
+
+// prepareTables checks the target tables can be written and readies them:
+// it locks them, tags them and enables their streams as the config asks. The
+// locks are held until the session closes.
+func (r *restore) prepareTables(ctx context.Context) error {
+	cfg := r.cfg
+	// Items already in a target table are overwritten by exported items with their key
+	if !cfg.AllowOverwrite && cfg.PublishQueueURL == "" && cfg.RepairReportURI == "" && !resuming(ctx, r.s3Client, cfg, r.resumeOwner) {
+		if err := checkOverwrites(ctx, r.out, r.dynamoClient, cfg, r.tableInfos); err != nil {
+			return err
+		}
+	}
+
+	// Keep other restores out of the target tables until this one ends
+	if !cfg.NoLock && !cfg.DryRun {
+		locks, err := acquireLocks(ctx, r.out, r.rawS3Client, cfg)
+		if err != nil {
+			return err
+		}
+		r.onClose(func() { releaseLocks(locks) })
+		for _, l := range locks {
+			go l.KeepAlive(ctx, func(err error) {
+				fmt.Fprintf(os.Stderr, "Error: %v; stopping the restore\n", err)
+				r.cancel(err)
+			})
+		}
+	}
+
+	// Cost allocation and cleanup automation find the target tables by their tags
+	if (cfg.CopyTags || cfg.TableTags() != nil) && !cfg.DryRun {
+		if err := tagTables(ctx, r.out, r.dynamoClient, r.manifestLoader, cfg); err != nil {
+			return err
+		}
+	}
+
+	// Stream consumers of the target tables see every restored write
+	if cfg.EnableStream != "" && !cfg.DryRun {
+		if err := enableStreams(ctx, r.out, r.dynamoClient, r.manifestLoader, r.recorder, cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildWriters creates the writer of each target table, wrapped by the
+// journal, the write hook and the duplicate auditor, or the writer collecting
+// -materialize items or publishing to -publish-queue instead.
+func (r *restore) buildWriters(ctx context.Context) error {
+	cfg := r.cfg
+	// Alternator does not support returning consumed capacity or the items of failed condition checks
+	alternator := cfg.Compat == "alternator"
+	writerOpts := []writer.Option{writer.WithUpdateParallelism(cfg.UpdateParallelism)}
+	if !alternator {
+		writerOpts = append(writerOpts, writer.WithCapacityRecorder(r.recorder))
+	}
+	if cfg.UnprocessedLimit > 0 {
+		writerOpts = append(writerOpts, writer.WithUnprocessedLimit(cfg.UnprocessedLimit, r.recorder))
+	}
+	r.coordOpts = []coordinator.Option{
+		coordinator.WithTracerProvider(r.tracerProvider),
+		coordinator.WithSummaryHook(r.recorder.recordExport),
+	}
+	if r.repair != nil {
+		r.coordOpts = append(r.coordOpts, coordinator.WithFiles(r.repair))
+	}
+	if cfg.DeadLetterURI != "" {
+		sink, err := deadletter.NewFileSink(cfg.DeadLetterURI)
+		if err != nil {
+			return fmt.Errorf("failed to open dead-letter sink: %w", err)
+		}
+		r.onClose(func() {
+			if n := sink.Count(); n > 0 {
+				fmt.Fprintf(r.out, "%d operations were dead-lettered to %s\n", n, cfg.DeadLetterURI)
+			}
+			if err := sink.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close dead-letter sink: %v\n", err)
+			}
+		})
+		writerOpts = append(writerOpts, writer.WithDeadLetter(deadLetterCounter{Sink: sink, recorder: r.recorder}))
+		if !alternator {
+			writerOpts = append(writerOpts, writer.WithReturnValuesOnConditionCheckFailure(types.ReturnValuesOnConditionCheckFailureAllOld))
+		}
+		r.coordOpts = append(r.coordOpts, coordinator.WithDeadLetter(sink))
+	}
+	tables := cfg.TargetTables()
+
+	// -write-hook sees every batch, after the transformers, before it is written
+	var batchHook *hook.Hook
+	if cfg.WriteHook != "" {
+		var err error
+		batchHook, err = hook.New(strings.Fields(cfg.WriteHook), hook.WithTimeout(cfg.WriteHookTimeout))
+		if err != nil {
+			return err
+		}
+		r.onClose(func() {
+			if err := batchHook.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		})
+	}
+
+	// -schedule key writes each table through writer goroutines chosen by partition key
+	newTableWriter := func(table string) (writer.Writer, error) {
+		opts := writerOpts
+		if cfg.SkipUnchanged {
+			keyAttrs := keyAttrsOf(r.tableInfos, table)
+			if len(keyAttrs) == 0 {
+				return nil, fmt.Errorf("skip unchanged requires the key schema of table %s, which could not be described", table)
+			}
+			opts = append(opts[:len(opts):len(opts)], writer.WithSkipUnchanged(r.dynamoClient, keyAttrs, r.recorder))
+		}
+		for _, info := range r.tableInfos {
+			// Item collections are only limited on tables with local secondary indexes
+			if info.Name == table && len(info.LocalIndexes) > 0 && len(info.KeySchema) > 0 {
+				policy := writer.CollectionPolicy(cfg.CollectionPolicy)
+				opts = append(opts[:len(opts):len(opts)], writer.WithItemCollections(info.KeySchema[0].Name, policy, r.recorder))
+			}
+		}
+		w, err := tableWriter(r.dynamoClient, table, cfg, r.tableInfos, opts)
+		if err != nil || cfg.Schedule != "key" {
+			return w, err
+		}
+		keyAttrs := keyAttrsOf(r.tableInfos, table)
+		if len(keyAttrs) == 0 {
+			return nil, fmt.Errorf("schedule key requires the key schema of table %s, which could not be described", table)
+		}
+		writers := cfg.KeyWriters
+		if writers == 0 {
+			writers = cfg.MaxWorkers
+		}
+		router := writer.NewKeyRouter(w, keyAttrs, writers, cfg.BatchSize)
+		r.onClose(router.Close)
+		return router, nil
+	}
+
+	if cfg.MaterializeURI != "" {
+		// Items are collected and written as files once every export is applied
+		r.materialized = materialize.NewTable(splitAttrs(cfg.MaterializeKeys), cfg.PartitionBy)
+		r.restoreWriter = r.materialized
+	} else {
+		w, err := newTableWriter(tables[0])
+		if err != nil {
+			return err
+		}
+		r.restoreWriter = hooked(journaled(w, r.journal, tables[0], r.tableInfos), batchHook, tables[0])
+	}
+	if cfg.ShadowTable != "" {
+		// Describing the shadow fails fast when it is missing and gives PartiQL its keys
+		info, err := plan.DescribeTable(ctx, r.dynamoClient, cfg.ShadowTable, cfg.Region)
+		if err != nil {
+			return fmt.Errorf("failed to describe shadow table: %w", err)
+		}
+		// Without the dead-letter sink, an operation the shadow rejects fails its batch
+		// and is counted, rather than being listed for -repair
+		shadowOpts := []writer.Option{writer.WithUpdateParallelism(cfg.UpdateParallelism)}
+		w, err := tableWriter(r.dynamoClient, cfg.ShadowTable, cfg, []plan.TableInfo{info}, shadowOpts)
+		if err != nil {
+			return err
+		}
+		r.shadowWriter = writer.NewShadowWriter(r.restoreWriter, w, cfg.ShadowTable, r.recorder)
+		r.restoreWriter = r.shadowWriter
+		fmt.Fprintf(r.out, "Mirroring writes to shadow table %s\n", cfg.ShadowTable)
+	}
+	if cfg.PublishQueueURL != "" {
+		publisher, err := r.publisher(r.tableInfos)
+		if err != nil {
+			return err
+		}
+		r.restoreWriter = publisher
+	}
+
+	// The audit log is sized from the manifest, so it is opened by a summary hook
+	if cfg.AuditPath != "" {
+		auditor := audit.NewDuplicateAuditor(cfg.AuditPath)
+		r.auditor = auditor
+		r.onClose(func() {
+			if err := auditor.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close audit log: %v\n", err)
+			}
+		})
+		var table string // Materialized items are written to no table
+		if len(tables) > 0 {
+			table = tables[0]
+		}
+		r.restoreWriter = audit.NewWriter(r.restoreWriter, auditor, table)
+		auditOpen := false
+		r.coordOpts = append(r.coordOpts, coordinator.WithSummaryHook(func(s manifest.Summary) error {
+			// Exports applied by -follow share the log opened for the first
+			if auditOpen {
+				return nil
+			}
+			auditOpen = true
+			return auditor.Open(s.ItemCount)
+		}))
+	}
+
+	// Further tables get their own writer so their retries are independent
+	r.targetWriters = []writer.Writer{r.restoreWriter}
+	for _, table := range tables[min(1, len(tables)):] {
+		w, err := newTableWriter(table)
+		if err != nil {
+			return err
+		}
+		w = audited(hooked(journaled(w, r.journal, table, r.tableInfos), batchHook, table), r.auditor, table)
+		r.coordOpts = append(r.coordOpts, coordinator.WithTarget(table, w))
+		r.targetWriters = append(r.targetWriters, w)
+	}
+	return nil
+}
+
+// buildTransformers creates the filters and transformers the config asks for,
+// in the order they apply to each operation.
+func (r *restore) buildTransformers(ctx context.Context) error {
+	cfg := r.cfg
+	tables := cfg.TargetTables()
+	// Filters run before redaction so they match the original key values
+	if cfg.KeyPrefix != "" || cfg.KeyEquals != "" {
+		var keyFilter *transform.KeyFilter
+		if cfg.KeyPrefix != "" {
+			keyFilter = transform.NewKeyPrefixFilter(cfg.KeyAttribute, cfg.KeyPrefix)
+		} else {
+			keyFilter = transform.NewKeyEqualsFilter(cfg.KeyAttribute, cfg.KeyEquals)
+		}
+		r.lineFilters = append(r.lineFilters, keyFilter)
+		r.transformers = append(r.transformers, keyFilter)
+	}
+	if cfg.RestoreTo != "" {
+		timeFilter := transform.NewTimeFilter(r.restoreTime)
+		r.lineFilters = append(r.lineFilters, timeFilter)
+		r.transformers = append(r.transformers, timeFilter)
+	}
+	if len(r.lineFilters) > 0 {
+		r.coordOpts = append(r.coordOpts, coordinator.WithLineFilter(r.lineFilters))
+	}
+	if cfg.KeysFile != "" {
+		keyList, err := transform.LoadKeyList(cfg.KeysFile)
+		if err != nil {
+			return err
+		}
+		r.keyList = keyList
+		r.transformers = append(r.transformers, keyList)
+		r.coordOpts = append(r.coordOpts, coordinator.WithSummaryHook(func(s manifest.Summary) error {
+			keyList.SetExportTime(s.PointInTime())
+			return nil
+		}))
+	}
+	if cfg.IncludeAttrs != "" || cfg.ExcludeAttrs != "" {
+		// Full export items carry their key in the image only, so the key schema tells the keys apart
+		keyAttrs := splitAttrs(cfg.MaterializeKeys)
+		for _, table := range tables {
+			attrs := keyAttrsOf(r.tableInfos, table)
+			if len(attrs) == 0 {
+				return fmt.Errorf("attribute projection requires the key schema of table %s, which could not be described", table)
+			}
+			keyAttrs = append(keyAttrs, attrs...)
+		}
+		r.transformers = append(r.transformers, transform.NewProjection(splitAttrs(cfg.IncludeAttrs), splitAttrs(cfg.ExcludeAttrs), keyAttrs))
+	}
+	if cfg.ReshardAttribute != "" {
+		sep, by := cfg.ReshardSeparator, cfg.ReshardBy
+		if sep == "" {
+			sep = "#"
+		}
+		if by == "" {
+			// The sort key tells apart the items sharing a base value
+			keyAttrs := keyAttrsOf(r.tableInfos, tables[0])
+			if len(keyAttrs) < 2 {
+				return fmt.Errorf("resharding requires -reshard-by or a sort key on table %s, which could not be described or has none", tables[0])
+			}
+			by = keyAttrs[1]
+		}
+		r.transformers = append(r.transformers, transform.NewResharder(cfg.ReshardAttribute, sep, by, cfg.ReshardCount))
+	}
+	if cfg.RemapAttribute != "" {
+		r.remapper = transform.NewKeyRemapper(cfg.RemapAttribute, cfg.RemapPrefix, cfg.RemapSuffix)
+		r.transformers = append(r.transformers, r.remapper)
+	}
+	if cfg.ShiftTimeAttrs != "" {
+		attrs := splitAttrs(cfg.ShiftTimeAttrs)
+		if cfg.ShiftTimeBy == "now" {
+			r.timeShifter = transform.NewTimeSetter(attrs, time.Now())
+		} else {
+			delta, _ := time.ParseDuration(cfg.ShiftTimeBy) // Checked by Validate
+			r.timeShifter = transform.NewTimeShifter(attrs, delta)
+		}
+		r.transformers = append(r.transformers, r.timeShifter)
+	}
+	if cfg.RedactRulesPath != "" {
+		rules, err := transform.LoadRedactionRules(cfg.RedactRulesPath)
+		if err != nil {
+			return err
+		}
+		r.transformers = append(r.transformers, transform.NewRedactor(rules))
+	}
+	// Offloading runs last, so payloads hold the values as written
+	if cfg.OffloadURI != "" {
+		var keyAttrs []string
+		for _, table := range tables {
+			attrs := keyAttrsOf(r.tableInfos, table)
+			if len(attrs) == 0 {
+				return fmt.Errorf("offloading requires the key schema of table %s, which could not be described", table)
+			}
+			keyAttrs = append(keyAttrs, attrs...)
+		}
+		threshold := int64(transform.DefaultOffloadThreshold)
+		if cfg.OffloadKiB > 0 {
+			threshold = int64(cfg.OffloadKiB) << 10
+		}
+		offloader, err := transform.NewOffloader(ctx, r.rawS3Client, cfg.OffloadURI, threshold, keyAttrs)
+		if err != nil {
+			return err
+		}
+		r.transformers = append(r.transformers, offloader)
+	}
+	if len(r.transformers) > 0 {
+		r.coordOpts = append(r.coordOpts, coordinator.WithTransformer(r.transformers))
+	}
+
+	if cfg.PrefixStatsDelim != "" {
+		keyAttrs := splitAttrs(cfg.MaterializeKeys)
+		if len(keyAttrs) == 0 {
+			keyAttrs = keyAttrsOf(r.tableInfos, tables[0])
+		}
+		if len(keyAttrs) == 0 {
+			return fmt.Errorf("prefix stats require the key schema of table %s, which could not be described", tables[0])
+		}
+		r.coordOpts = append(r.coordOpts, coordinator.WithKeyPrefixStats(keyAttrs[0], cfg.PrefixStatsDelim))
+	}
+
+	if cfg.ProgressFormat == "ndjson" {
+		r.coordOpts = append(r.coordOpts, coordinator.WithEventEmitter(metrics.NewNDJSONEmitter(os.Stdout)))
+	}
+
+	// -follow continues from the table and time of the restored export
+	if cfg.Follow {
+		r.coordOpts = append(r.coordOpts, coordinator.WithSummaryHook(func(s manifest.Summary) error {
+			r.restored = s
+			return nil
+		}))
+	}
+	return nil
+}
+
+// applyFirst applies the first export, after the -priority-key-prefix items
+// when given, and reports what the transformers and writers noticed.
+func (r *restore) applyFirst(ctx context.Context) error {
+	cfg := r.cfg
+	var checkpointStore checkpoint.Store
+	if cfg.ResumeKey != "" {
+		// Use S3Store if a resume key is provided
+		s3Store, err := checkpoint.NewS3Store(r.s3Client, cfg.ResumeKey,
+			checkpoint.WithHistory(r.rawS3Client, cfg.CheckpointHistory), checkpoint.WithTags(r.runTags), checkpoint.WithOwner(r.resumeOwner))
+		if err != nil {
+			return fmt.Errorf("failed to create checkpoint store: %w", err)
+		}
+		checkpointStore = s3Store
+	} else {
+		// Use in-memory store if no resume key provided
+		checkpointStore = checkpoint.NewMemoryStore()
+	}
+
+	// Priority files and items only reorder the first export; a chain's later
+	// exports and -follow apply theirs in manifest order. Both passes over it
+	// collect into the same metrics, so the report counts every item restored
+	coordOpts := r.coordOpts
+	firstMetrics := r.recorder.next()
+	mainOpts := append(coordOpts[:len(coordOpts):len(coordOpts)], firstMetrics)
+	if cfg.PriorityFiles != "" {
+		mainOpts = append(mainOpts, coordinator.WithPriorityFiles(splitAttrs(cfg.PriorityFiles)))
+	}
+	var priorityDone time.Time
+	if cfg.PriorityKeyPrefix != "" {
+		tables := cfg.TargetTables()
+		keyAttrs := keyAttrsOf(r.tableInfos, tables[0])
+		if len(keyAttrs) == 0 {
+			return fmt.Errorf("priority key prefix requires the key schema of table %s, which could not be described", tables[0])
+		}
+		priorityFilter := transform.NewKeyPrefixFilter(keyAttrs[0], cfg.PriorityKeyPrefix)
+		mainOpts = append(mainOpts, coordinator.WithTransformer(append(transform.Chain{transform.Not(priorityFilter)}, r.transformers...)))
+
+		// A resumed restore finished the priority pass before saving progress
+		if !resuming(ctx, r.s3Client, cfg, r.resumeOwner) {
+			priorityCfg := *cfg
+			priorityCfg.ReportS3URI = "" // Reported with the main pass
+			priorityOpts := append(coordOpts[:len(coordOpts):len(coordOpts)],
+				coordinator.WithLineFilter(append(r.lineFilters[:len(r.lineFilters):len(r.lineFilters)], priorityFilter)),
+				coordinator.WithTransformer(append(transform.Chain{priorityFilter}, r.transformers...)),
+				firstMetrics)
+			coord := coordinator.NewCoordinator(&priorityCfg, r.manifestLoader, r.streamer, r.exportDecoder, r.restoreWriter,
+				checkpoint.NewMemoryStore(), nil, priorityOpts...)
+			fmt.Fprintf(r.out, "Restoring items whose %s starts with %q first\n", keyAttrs[0], cfg.PriorityKeyPrefix)
+			if err := coord.Run(ctx); err != nil {
+				return fmt.Errorf("priority pass failed: %w", err)
+			}
+			priorityDone = time.Now()
+			fmt.Fprintf(r.out, "Priority items restored at %s; restoring the others\n", priorityDone.Format(time.RFC3339))
+		}
+	}
+
+	// Create the coordinator with all dependencies
+	coord := coordinator.NewCoordinator(
+		cfg,
+		r.manifestLoader,
+		r.streamer,
+		r.exportDecoder,
+		r.restoreWriter,
+		checkpointStore,
+		r.reportUploader,
+		mainOpts...,
+	)
+	if !priorityDone.IsZero() {
+		r.recorder.metrics.Load().RecordPriorityComplete(priorityDone)
+	}
+
+	if cfg.ControlSocket != "" {
+		srv, err := control.Listen(cfg.ControlSocket, coord)
+		if err != nil {
+			return err
+		}
+		r.onClose(func() {
+			if err := srv.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close control socket: %v\n", err)
+			}
+		})
+		fmt.Fprintf(r.out, "Control API listening on unix socket %s\n", cfg.ControlSocket)
+	}
+
+	// Run the coordinator
+	if r.materialized != nil {
+		fmt.Fprintf(r.out, "Materializing %s to %s\n", cfg.ExportS3URI, cfg.MaterializeURI)
+	} else {
+		fmt.Fprintf(r.out, "Starting restore of table %s from %s\n", cfg.TableName, cfg.ExportS3URI)
+	}
+	runErr := coord.Run(ctx)
+	if cause := context.Cause(ctx); runErr != nil && errors.Is(cause, lock.ErrLocked) {
+		runErr = cause
+	}
+	if cfg.NotifyTarget != "" {
+		sendNotification(cfg, r.awsCfg, coord.Report(), runErr)
+	}
+	if runErr != nil {
+		return fmt.Errorf("restore operation failed: %w", runErr)
+	}
+
+	if r.materialized != nil {
+		stats, err := writeMaterialized(ctx, r.out, r.rawS3Client, r.materialized, cfg.MaterializeURI)
+		if err != nil {
+			return err
+		}
+		if cfg.GlueTable != "" {
+			if err := materialize.Register(ctx, aws.NewGlueClient(r.awsCfg), cfg.GlueTable, cfg.MaterializeURI, stats, cfg.PartitionBy); err != nil {
+				return err
+			}
+			fmt.Fprintf(r.out, "Registered Glue table %s over %s\n", cfg.GlueTable, cfg.MaterializeURI)
+		}
+	}
+
+	if r.shadowWriter != nil {
+		if err := r.shadowWriter.Err(); err != nil {
+			fmt.Fprintf(r.out, "Warning: %v; the shadow table is incomplete\n", err)
+		}
+	}
+
+	if r.remapper != nil {
+		if n, samples := r.remapper.Collisions(); n > 0 {
+			fmt.Fprintf(r.out, "Warning: %d source keys already start with %q and end with %q; "+
+				"their remapped copies may have overwritten live items (e.g. %v)\n",
+				n, cfg.RemapPrefix, cfg.RemapSuffix, samples)
+		}
+	}
+
+	if r.timeShifter != nil {
+		if n := r.timeShifter.Unchanged(); n > 0 {
+			fmt.Fprintf(r.out, "Warning: %d values of %s were neither epoch numbers nor ISO 8601 times and were not shifted\n",
+				n, cfg.ShiftTimeAttrs)
+		}
+	}
+
+	if r.auditor != nil {
+		reportDuplicates(r.out, r.auditor, cfg.AuditPath)
+	}
+
+	if r.keyList != nil {
+		if err := reportKeys(r.out, r.keyList, cfg.KeysReportPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyExport applies a later export of a chain, or one found by -follow.
+// Each has its own data files, so progress is tracked per export.
+func (r *restore) applyExport(ctx context.Context, uri string, summary manifest.Summary) error {
+	exportCfg := *r.cfg
+	exportCfg.ExportS3URI = uri
+	exportCfg.ExportType = ""
+	exportCfg.ViewType = r.viewType
+	coord := coordinator.NewCoordinator(&exportCfg, r.manifestLoader, r.streamer, r.exportDecoder, r.restoreWriter,
+		checkpoint.NewMemoryStore(), r.reportUploader, append(r.coordOpts[:len(r.coordOpts):len(r.coordOpts)], r.recorder.next())...)
+	fmt.Fprintf(r.out, "Applying incremental export %s (%s to %s)\n",
+		uri, summary.ExportFromTime, summary.ExportToTime)
+	runErr := coord.Run(ctx)
+	if r.cfg.NotifyTarget != "" {
+		sendNotification(&exportCfg, r.awsCfg, coord.Report(), runErr)
+	}
+	if runErr != nil {
+		return fmt.Errorf("failed to apply export %s: %w", uri, runErr)
+	}
+	return nil
+}
+
+// followExports keeps applying incremental exports of the same table as they
+// complete, found by listing the export prefix or from S3 events delivered to
+// a queue, until the run is interrupted.
+func (r *restore) followExports(ctx context.Context) error {
+	cfg := r.cfg
+	var source follow.Source
+	interval := cfg.FollowInterval
+	if cfg.FollowQueueURL != "" {
+		source = follow.NewQueue(sqs.NewFromConfig(r.awsCfg), r.manifestLoader, cfg.FollowQueueURL, r.restored.TableARN)
+		interval = 0 // Receiving long-polls the queue
+		fmt.Fprintf(r.out, "Following new incremental exports from %s; interrupt to stop\n", cfg.FollowQueueURL)
+	} else {
+		finder, err := follow.NewFinder(r.rawS3Client, r.manifestLoader, cfg.ExportS3URI, r.restored.TableARN)
+		if err != nil {
+			return err
+		}
+		source = finder
+		fmt.Fprintf(r.out, "Following new incremental exports every %s; interrupt to stop\n", cfg.FollowInterval)
+	}
+	watermark, err := follow.ParseTime(r.restored.PointInTime())
+	if err != nil {
+		return err
+	}
+	followCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	return follow.Follow(followCtx, source, interval, watermark, func(ctx context.Context, e follow.Export) error {
+		if e.Gap > 0 {
+			fmt.Fprintf(r.out, "Warning: no export covers the %s before %s; changes made then are missing\n",
+				e.Gap, e.Summary.ExportFromTime)
+		}
+		return r.applyExport(ctx, e.URI, e.Summary)
+	})
+}
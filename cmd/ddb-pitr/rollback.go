@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gurre/ddb-pitr/aws"
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/journal"
+	"github.com/gurre/ddb-pitr/manifest"
+	"github.com/gurre/ddb-pitr/s3uri"
+	"github.com/gurre/ddb-pitr/stream"
+	"github.com/gurre/ddb-pitr/writer"
+)
+
+// runRollback implements the rollback subcommand, which undoes a restore into
+// a table from the journal the restore kept, or undoes applying an incremental
+// export from the old images it carries:
+//
+//	ddb-pitr rollback -table t -journal s3://audit-bucket/restores/20261015T093000.000000000Z/ [-dry-run]
+//	ddb-pitr rollback -table t -export s3://bucket/AWSDynamoDB/01234567890-abcdef/ [-dry-run]
+func runRollback(args []string) error {
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	table := fs.String("table", "", "DynamoDB table to roll back")
+	journalURI := fs.String("journal", "", "s3:// prefix of the journal written by the restore's -journal")
+	exportURI := fs.String("export", "", "s3:// URI of an incremental export with old images that was applied to -table")
+	region := fs.String("region", "", "AWS region (defaults to AWS_REGION env)")
+	batchSize := fs.Int("batch-size", 25, "Write batch size (max 25)")
+	dryRun := fs.Bool("dry-run", false, "Count the operations that would roll back the table without writing them")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if *table == "" {
+		return fmt.Errorf("table name is required")
+	}
+	if (*journalURI == "") == (*exportURI == "") {
+		return fmt.Errorf("exactly one of journal and export is required")
+	}
+	if *batchSize < 1 || *batchSize > 25 {
+		return fmt.Errorf("batch size must be between 1 and 25")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(*region))
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	dynamoClient := aws.NewDynamoDBClient(dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
+		o.Retryer = aws.NewAdaptiveRetryer(&metricsRecorder{})
+	}))
+	rawS3Client := s3.NewFromConfig(awsCfg)
+	decoder := itemimage.NewJSONDecoder()
+
+	var w writer.Writer
+	if !*dryRun {
+		w = writer.NewDynamoDBWriter(dynamoClient, *table, *batchSize)
+	}
+	if *journalURI != "" {
+		var writers []writer.Writer
+		if w != nil {
+			writers = append(writers, w)
+		}
+		return applyJournalTo(ctx, os.Stdout, rawS3Client, decoder, *journalURI, *table, journal.Invert, writers, *batchSize)
+	}
+	return rollbackExport(ctx, os.Stdout, rawS3Client, decoder, w, *exportURI, *table, *batchSize)
+}
+
+// rollbackExport writes the operations compensating for every record of an
+// incremental export, or only counts them when w is nil. Each item appears
+// once in an incremental export, so the order of the writes does not matter.
+func rollbackExport(ctx context.Context, out io.Writer, client *s3.Client, decoder itemimage.Decoder, w writer.Writer,
+	uri, table string, batchSize int) error {
+	resolvedURI, err := manifest.ResolveURI(ctx, client, uri)
+	if err != nil {
+		return fmt.Errorf("failed to resolve export URI: %w", err)
+	}
+	exportURI, err := s3uri.Parse(resolvedURI)
+	if err != nil {
+		return err
+	}
+	loader := manifest.NewS3Loader(aws.NewS3Client(client))
+	summary, err := loader.LoadSummary(ctx, resolvedURI)
+	if err != nil {
+		return fmt.Errorf("failed to load manifest: %w", err)
+	}
+	// Without old images every record looks like a newly created item
+	if !summary.IsIncremental() || summary.OutputView != "NEW_AND_OLD_IMAGES" {
+		return fmt.Errorf("export %s cannot be rolled back: only incremental exports with the NEW_AND_OLD_IMAGES view carry the items as they were; "+
+			"roll back from the restore's -journal instead", resolvedURI)
+	}
+
+	fmt.Fprintf(out, "Rolling back %s from the old images of %s\n", table, resolvedURI)
+	streamer := stream.NewS3Streamer(client)
+	var batch []itemimage.Operation
+	var written, puts, deletes, unrecoverable int64
+	flush := func() error {
+		if w != nil && len(batch) > 0 {
+			if err := w.WriteBatch(ctx, batch); err != nil {
+				return fmt.Errorf("failed to roll back %s after %d operations: %w", table, written, err)
+			}
+		}
+		written += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+	for file, err := range loader.Files(ctx, summary) {
+		if err != nil {
+			return fmt.Errorf("failed to load manifest: %w", err)
+		}
+		err := streamer.Stream(ctx, exportURI.Bucket, file.Key, 0, func(line []byte, offset int64) error {
+			op, err := decoder.Decode(line)
+			if err != nil {
+				return fmt.Errorf("%s@%d: %w", file.Key, offset, err)
+			}
+			undo, ok := journal.Compensate(op)
+			if !ok {
+				unrecoverable++
+				return nil
+			}
+			if undo.Type == itemimage.OpDelete {
+				deletes++
+			} else {
+				puts++
+			}
+			if batch = append(batch, undo); len(batch) == batchSize {
+				return flush()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if w != nil {
+		if err := w.Flush(ctx); err != nil {
+			return fmt.Errorf("failed to roll back %s: %w", table, err)
+		}
+	}
+	fmt.Fprintf(out, "Applied %d operations to %s: %d puts, %d deletes; %d deletes could not be undone\n",
+		written, table, puts, deletes, unrecoverable)
+	return nil
+}
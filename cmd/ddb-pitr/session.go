@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/tracing"
+	"github.com/gurre/ddb-pitr/aws"
+	"github.com/gurre/ddb-pitr/buildinfo"
+	"github.com/gurre/ddb-pitr/config"
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/journal"
+	"github.com/gurre/ddb-pitr/manifest"
+	"github.com/gurre/ddb-pitr/metrics"
+	"github.com/gurre/ddb-pitr/trace"
+)
+
+// session holds what every mode of the restore command shares: the
+// configuration, the AWS clients, the decoders and the metrics recorder. The
+// modes register cleanups on it, which close runs in reverse order once the
+// command ends, so resources opened by one step outlive the steps after it.
+type session struct {
+	cfg            *config.Config
+	out            io.Writer // Informational messages; stderr when stdout carries ndjson events
+	awsCfg         awssdk.Config
+	recorder       *metricsRecorder
+	tracerProvider tracing.TracerProvider
+	dynamoClient   *aws.DynamoDBClientImpl
+	rawS3Client    *s3.Client
+	s3Client       *aws.S3ClientImpl
+	format         manifest.Format
+	manifestLoader manifest.Loader
+	jsonDecoder    itemimage.Decoder // Journals, queues and stream records hold DynamoDB JSON whatever the export format
+	exportDecoder  itemimage.Decoder
+	journal        *journal.Journal // Records every operation written; nil without -journal
+	runTags        map[string]string
+	viewType       string                  // -view as given, not the view derived from the first export
+	cancel         context.CancelCauseFunc // Stops the command, e.g. when a table lock is lost
+	cleanups       []func()
+}
+
+// newSession loads the AWS configuration and creates the clients and decoders
+// for cfg. Call close once the command ends.
+func newSession(ctx context.Context, cfg *config.Config, cancel context.CancelCauseFunc) (*session, error) {
+	s := &session{cfg: cfg, viewType: cfg.ViewType, cancel: cancel, recorder: &metricsRecorder{}}
+
+	// The snapshot is taken before later steps fill in the config from the manifest
+	run := metrics.RunReport{Build: buildinfo.Get(), RunID: cfg.RunID, Region: cfg.Region, Config: cfg.Snapshot()}
+
+	// Tagging needs s3:PutObjectTagging, so only runs given an ID tag their objects
+	if cfg.RunID != "" {
+		s.runTags = map[string]string{aws.RunIDTag: cfg.RunID}
+	}
+
+	// In ndjson mode stdout carries only events, so informational messages go to stderr
+	s.out = os.Stdout
+	if cfg.ProgressFormat == "ndjson" {
+		s.out = os.Stderr
+	}
+	fmt.Fprintf(s.out, "ddb-pitr %s\n", buildinfo.Get())
+
+	// Load AWS configuration as specified in section 3. The report counts how
+	// requests got their connections, and the retries of the DynamoDB client.
+	var err error
+	s.awsCfg, err = awsconfig.LoadDefaultConfig(context.Background(),
+		awsconfig.WithRegion(cfg.Region),
+		awsconfig.WithHTTPClient(aws.NewHTTPClient(aws.HTTPOptions{
+			ConnectTimeout:      cfg.HTTPConnTimeout,
+			TLSHandshakeTimeout: cfg.HTTPTLSTimeout,
+			Recorder:            s.recorder,
+			MaxIdleConns:        cfg.HTTPMaxIdleConns,
+			Shards:              cfg.ClientShards,
+			DisableHTTP2:        cfg.DisableHTTP2,
+		})),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	// -trace-endpoint traces the pipeline and its DynamoDB and S3 calls
+	s.tracerProvider = tracing.NopTracerProvider{}
+	if cfg.TraceEndpoint != "" {
+		provider := trace.NewProvider(trace.NewOTLPExporter(cfg.TraceEndpoint))
+		s.onClose(func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+			defer cancel()
+			if err := provider.Shutdown(shutdownCtx); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to export trace: %v\n", err)
+			}
+		})
+		s.tracerProvider = provider
+	}
+
+	// Initialize AWS clients as specified in section 3. DynamoDB uses the SDK's
+	// adaptive retry mode; the writer keeps retrying throttling the SDK gives up on.
+	// -dynamodb-endpoint and -dynamodb-profile point only the writes elsewhere; exports stay in S3.
+	dynamoCfg := s.awsCfg
+	if cfg.DynamoDBProfile != "" {
+		profileCfg, err := awsconfig.LoadDefaultConfig(context.Background(),
+			awsconfig.WithRegion(cfg.Region), awsconfig.WithSharedConfigProfile(cfg.DynamoDBProfile))
+		if err != nil {
+			s.close()
+			return nil, fmt.Errorf("failed to load DynamoDB profile %s: %w", cfg.DynamoDBProfile, err)
+		}
+		dynamoCfg.Credentials = profileCfg.Credentials
+	}
+	s.dynamoClient = aws.NewDynamoDBClient(dynamodb.NewFromConfig(dynamoCfg, func(o *dynamodb.Options) {
+		o.TracerProvider = s.tracerProvider
+		o.Retryer = aws.NewAdaptiveRetryer(s.recorder)
+		if cfg.DynamoDBEndpoint != "" {
+			o.BaseEndpoint = &cfg.DynamoDBEndpoint
+		}
+	}))
+	s.rawS3Client = s3.NewFromConfig(s.awsCfg, func(o *s3.Options) {
+		o.TracerProvider = s.tracerProvider
+		o.UsePathStyle = cfg.S3PathStyle
+	})
+	s.s3Client = aws.NewS3Client(s.rawS3Client)
+
+	// Reports name the account restored into, which only STS knows
+	if cfg.ReportS3URI != "" || cfg.NotifyTarget != "" {
+		identity, err := sts.NewFromConfig(s.awsCfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to identify the AWS account for the report: %v\n", err)
+		} else {
+			run.AccountID, run.CallerARN = awssdk.ToString(identity.Account), awssdk.ToString(identity.Arn)
+		}
+	}
+	s.recorder.run = run
+
+	if err := s.openDecoders(); err != nil {
+		s.close()
+		return nil, err
+	}
+
+	// -journal records every operation written to the target tables
+	if cfg.JournalURI != "" {
+		if s.journal, err = journal.New(s.rawS3Client, cfg.JournalURI, cfg.JournalRotateMiB<<20); err != nil {
+			s.close()
+			return nil, fmt.Errorf("failed to open journal: %w", err)
+		}
+		s.onClose(func() {
+			// Upload the last entries even when the restore was interrupted
+			closeCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+			defer cancel()
+			if err := s.journal.Close(closeCtx); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to close journal: %v\n", err)
+				return
+			}
+			fmt.Fprintf(s.out, "Journaled %d operations to %s\n", s.journal.Count(), s.journal.URI())
+		})
+	}
+	return s, nil
+}
+
+// openDecoders creates the manifest loader of the export format and the
+// decoders of export lines and of DynamoDB JSON records.
+func (s *session) openDecoders() error {
+	cfg := s.cfg
+	var err error
+	if s.format, err = manifest.ParseFormat(cfg.ExportFormat); err != nil {
+		return err
+	}
+	s.manifestLoader = s.format.NewLoader(s.s3Client)
+
+	var decoderOpts []itemimage.DecoderOption
+	if cfg.SDKDecoder {
+		decoderOpts = append(decoderOpts, itemimage.WithSDKDecoding())
+	}
+	if cfg.StrictDecode {
+		decoderOpts = append(decoderOpts, itemimage.WithStrictDecoding())
+	}
+	s.jsonDecoder = itemimage.NewJSONDecoder(decoderOpts...)
+	exportDecoderOpts := decoderOpts
+	// -no-manifest lists the data files itself and reads them as -type and -view describe
+	if cfg.NoManifest {
+		listing, view := noManifestListing(cfg, s.format)
+		s.manifestLoader = manifest.NewListingLoader(s.rawS3Client, listing)
+		exportDecoderOpts = append(decoderOpts[:len(decoderOpts):len(decoderOpts)], itemimage.WithView(view))
+	}
+	s.exportDecoder, err = itemimage.NewDecoder(s.format.OutputFormat(), exportDecoderOpts...)
+	return err
+}
+
+// onClose registers fn to run when the session closes, after the cleanups
+// registered later.
+func (s *session) onClose(fn func()) {
+	s.cleanups = append(s.cleanups, fn)
+}
+
+// close runs the registered cleanups, the last registered first.
+func (s *session) close() {
+	for i := len(s.cleanups) - 1; i >= 0; i-- {
+		s.cleanups[i]()
+	}
+	s.cleanups = nil
+}
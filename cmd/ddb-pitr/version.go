@@ -0,0 +1,14 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gurre/ddb-pitr/buildinfo"
+)
+
+// runVersion implements "ddb-pitr version", printing the version, commit,
+// build date and Go version of the binary.
+func runVersion() error {
+	fmt.Printf("ddb-pitr %s\n", buildinfo.Get())
+	return nil
+}
@@ -4,30 +4,135 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/url"
+	"reflect"
+	"slices"
 	"strings"
 	"time"
+
+	"github.com/gurre/ddb-pitr/s3uri"
 )
 
 // Config holds all configuration for the restore operation as defined in section 4.1
 // of the design specification. All fields correspond to the required configuration
 // parameters for the restore operation.
 type Config struct {
-	TableName       string        // Target DynamoDB table name
-	ExportS3URI     string        // S3 URI for the PITR export (s3://bucket/prefix)
-	ExportType      string        // "FULL"|"INCREMENTAL" - matches DynamoDB export types
-	ViewType        string        // "NEW"|"NEW_AND_OLD" - matches DynamoDB view types
-	Region          string        // AWS region for the operation
-	ResumeKey       string        // S3 URI for checkpoint file (s3://bucket/key)
-	ReportS3URI     string        // S3 URI for the final report
-	ShutdownTimeout time.Duration // Graceful shutdown timeout
-	MaxWorkers      int           // Maximum number of concurrent workers
-	BatchSize       int           // Batch size for DynamoDB writes (≤25)
-	DryRun          bool          // If true, don't actually write to DynamoDB
+	TableName         string        // Target DynamoDB table name, or a comma-separated list to fan out to
+	ExportS3URI       string        // S3 URI of the PITR export's manifest summary, directory or prefix, or a comma-separated chain of them
+	ExportType        string        // "FULL"|"INCREMENTAL" - matches DynamoDB export types ("" = from the manifest, FULL with NoManifest)
+	ExportFormat      string        // "dynamodb"|"data-pipeline" - layout of the export in S3 ("" = dynamodb)
+	ViewType          string        // "NEW"|"NEW_AND_OLD" - matches DynamoDB view types ("" = from the manifest)
+	Region            string        // AWS region for the operation
+	ResumeKey         string        // S3 URI for checkpoint file (s3://bucket/key), or ResumeAuto
+	CheckpointHistory int           // Number of earlier checkpoints kept next to ResumeKey (0 = none)
+	ReportS3URI       string        // S3 URI for the final report
+	DeadLetterURI     string        // file:// URI receiving operations rejected with permanent errors
+	ShadowTable       string        // Table receiving a best-effort copy of every batch written to the primary table ("" = none)
+	RedactRulesPath   string        // Local JSON rules file for the redaction transformer
+	KeyAttribute      string        // Key attribute matched by KeyPrefix/KeyEquals
+	KeyPrefix         string        // Restore only items whose KeyAttribute starts with this value
+	PriorityFiles     string        // Comma-separated data file keys or names restored before the other files
+	PriorityKeyPrefix string        // Restore items whose partition key starts with this value in a first pass
+	KeyEquals         string        // Restore only items whose KeyAttribute equals this value
+	KeysFile          string        // Local JSON lines file of primary keys to restore
+	KeysReportPath    string        // Local file receiving per-key found/not-found results
+	DriftReportPath   string        // Local file receiving the plan's schema drift reports as JSON
+	AuditPath         string        // Local file logging digests of applied operations to detect duplicate applies
+	RemapAttribute    string        // String key attribute rewritten by RemapPrefix/RemapSuffix
+	RemapPrefix       string        // Prefix added to RemapAttribute for side-by-side restores
+	RemapSuffix       string        // Suffix added to RemapAttribute for side-by-side restores
+	ReshardAttribute  string        // String key attribute whose shard suffix is recomputed for ReshardCount shards
+	ReshardSeparator  string        // Separator before the shard number of ReshardAttribute ("" = "#")
+	ReshardBy         string        // Attribute hashed to pick the new shard ("" = the target table's sort key)
+	ShiftTimeAttrs    string        // Comma-separated timestamp attributes rewritten by ShiftTimeBy
+	IncludeAttrs      string        // Comma-separated attributes restored besides the keys ("" = every attribute)
+	ExcludeAttrs      string        // Comma-separated non-key attributes left out of the restore
+	OffloadURI        string        // s3:// prefix receiving the largest attributes of items over OffloadKiB ("" = no offloading)
+	RestoreTo         string        // RFC 3339 time the table is restored as of ("" = the end of the last export)
+	PrefixStatsDelim  string        // Report items written per partition key prefix up to this delimiter ("" = no prefix stats)
+	ShiftTimeBy       string        // Duration added to ShiftTimeAttrs, or "now" to set them to the current time
+	ShutdownTimeout   time.Duration // Graceful shutdown timeout
+	StallTimeout      time.Duration // Restart a file after this long without worker progress (0 = disabled)
+	FileTimeout       time.Duration // Restart a file attempt that runs longer than this (0 = disabled)
+	CheckpointEvery   time.Duration // Save a worker's checkpoint at least this often besides every 100 batches (0 = batch count only)
+	BatchTimeout      time.Duration // Fail a batch write that takes longer than this, retrying the file (0 = disabled)
+	WriteHookTimeout  time.Duration // Time WriteHook has to answer a batch (0 = hook.DefaultTimeout)
+	FollowInterval    time.Duration // How often Follow polls for new incremental exports
+	DrainIdle         time.Duration // Stop draining after the queue has been empty this long (0 = until interrupted)
+	HTTPConnTimeout   time.Duration // Dial timeout of the AWS HTTP client (0 = SDK default)
+	HTTPTLSTimeout    time.Duration // TLS handshake timeout of the AWS HTTP client (0 = SDK default)
+	ProgressFormat    string        // "text"|"ndjson" - progress output on stdout ("" = text)
+	NotifyTarget      string        // SNS topic ARN or https:// webhook receiving the outcome
+	ControlSocket     string        // Unix socket path serving the runtime control API
+	FollowQueueURL    string        // SQS queue receiving S3 events for new exports; replaces listing in Follow
+	LockURI           string        // S3 prefix holding the per-table run locks ("" = ddb-pitr-locks/ in the export bucket)
+	ForceUnlock       string        // Owner ID of a stale lock to remove before acquiring
+	OnCorrupt         string        // "skip"|"abort"|"dead-letter" - handling of lines that fail to decode ("" = skip)
+	CollectionPolicy  string        // "abort"|"skip" - handling of partition keys whose LSI item collection is full ("" = abort)
+	WriteMode         string        // "dynamodb"|"partiql" - API the target tables are written with ("" = dynamodb)
+	WriteHook         string        // Command, split on spaces, that every batch passes through before it is written ("" = none)
+	EnableStream      string        // Stream view type enabled on the target tables before writing, or "SOURCE" for the exported table's ("" = unchanged)
+	Tags              string        // Comma-separated key=value tags added to the target tables before writing
+	RunID             string        // ID of this run, tagged on the checkpoint and report objects ("" = untagged)
+	Schedule          string        // "file"|"key" - write each worker's batches, or route operations to writers by partition key ("" = file)
+	ReplaySources     string        // Comma-separated local files or s3:// objects of stream records applied after the restore
+	PublishQueueURL   string        // SQS FIFO queue receiving decoded operations instead of the target table
+	DrainQueueURL     string        // SQS queue whose operations are written to the target tables instead of an export's
+	MaterializeURI    string        // s3:// prefix or file:// directory receiving the restored items as CSV instead of a table
+	MaterializeKeys   string        // Comma-separated primary key attributes of the exported table, for MaterializeURI
+	PartitionBy       string        // Attribute whose values partition the MaterializeURI files ("" = one file)
+	GlueTable         string        // Glue table, as database.table, registered over an s3:// MaterializeURI
+	TraceEndpoint     string        // OTLP/HTTP endpoint receiving trace spans ("" = tracing disabled)
+	DynamoDBEndpoint  string        // Endpoint of the target tables' DynamoDB-compatible API ("" = AWS DynamoDB of Region)
+	DynamoDBProfile   string        // Shared config profile whose credentials sign DynamoDB requests ("" = the default chain)
+	Compat            string        // "dynamodb"|"alternator" - API the target tables are served by ("" = dynamodb)
+	JournalURI        string        // s3:// prefix receiving a journal of every applied operation ("" = no journal)
+	ApplyJournalURI   string        // s3:// prefix of a journal whose operations are replayed or inverted instead of an export's
+	RepairReportURI   string        // Report of an earlier run; only its failed and dead-lettered files are restored ("" = every file)
+	MaxDownloadMbps   float64       // Cap on S3 read bandwidth across all workers (0 = unlimited)
+	MaxCorruptPercent float64       // Abort once more than this percentage of lines are corrupt (0 = no limit)
+	ReplaySpeed       float64       // Write incremental export operations at this multiple of their original pace (0 = unpaced)
+	MaxWorkers        int           // Maximum number of concurrent workers
+	PlanSample        int           // Items the plan samples for attribute statistics (0 = no sampling)
+	KeyWriters        int           // Writer goroutines per table with Schedule "key" (0 = MaxWorkers)
+	UpdateParallelism int           // Maximum concurrent UpdateItem calls per batch
+	BatchSize         int           // Batch size for DynamoDB writes (≤25)
+	MemoryBudgetMiB   int           // Approximate memory for read buffers and batches across workers (0 = unlimited)
+	MaxLineMiB        int           // Longest data file line accepted (0 = stream.DefaultMaxLineSize)
+	CacheDir          string        // Local directory caching data files for retries and resumes ("" = no cache)
+	CacheMiB          int           // Size of the data file cache in CacheDir
+	ReshardCount      int           // Shard count of the target's key design, with ReshardAttribute
+	ReadAheadParts    int           // Byte ranges of a data file fetched ahead of the one being read (0 = one request per file)
+	HTTPMaxIdleConns  int           // Idle connections the AWS HTTP client keeps per host (0 = SDK default)
+	JournalRotateMiB  int           // Size of one journal object (0 = journal.DefaultRotateBytes)
+	OffloadKiB        int           // Item size above which attributes are offloaded to OffloadURI (0 = transform.DefaultOffloadThreshold)
+	ClientShards      int           // Connection pools the workers are spread over (0 = one shared pool)
+	FileRequeues      int           // Times a file that failed every attempt is handed to the workers again (0 = fail its worker)
+	UnprocessedLimit  int           // Consecutive BatchWriteItem retries leaving items unprocessed before they are dead-lettered or fail their batch (0 = retry indefinitely)
+	DryRun            bool          // If true, don't actually write to DynamoDB
+	Plan              bool          // Print the restore plan and cost estimate, then exit without writing
+	AllowGlobalTable  bool          // Restore into global tables despite replicated write costs
+	AllowOverwrite    bool          // Restore into tables that already hold items
+	S3PathStyle       bool          // Address S3 buckets in the request path, as S3-compatible stores expect
+	Follow            bool          // After the restore, keep applying new incremental exports of the table
+	SDKDecoder        bool          // Decode with the AWS SDK instead of the built-in parser
+	StrictDecode      bool          // Treat numbers and binary values DynamoDB would reject as corrupt
+	NoLock            bool          // Restore without taking the per-table run lock
+	AllowGaps         bool          // Apply an export chain despite gaps or overlaps between its exports
+	NoManifest        bool          // ExportS3URI lists or globs data files without a manifest; ExportType and ViewType describe them
+	DisableHTTP2      bool          // Restrict the AWS HTTP client to HTTP/1.1
+	InvertJournal     bool          // Apply the compensating operations of ApplyJournalURI, newest first
+	CopyTags          bool          // Copy the exported table's tags to the target tables before writing
+	SkipUnchanged     bool          // Read the current item of every put and skip the puts that would not change it
 
 	// Internal fields
-	exportBucketName string // Bucket name parsed from ExportS3URI
+	exportBucketName string            // Bucket name parsed from ExportS3URI
+	exportURIs       []string          // Export URIs parsed from ExportS3URI
+	targetTables     []string          // Table names parsed from TableName
+	tableTags        map[string]string // Tags parsed from Tags
 }
 
 // GetExportBucketName returns the bucket name parsed from ExportS3URI
@@ -35,38 +140,209 @@ func (c *Config) GetExportBucketName() string {
 	return c.exportBucketName
 }
 
+// TableTags returns the tags parsed from Tags by Validate, or nil for none.
+func (c *Config) TableTags() map[string]string {
+	return c.tableTags
+}
+
+// TargetTables returns the tables parsed from TableName by Validate. The first
+// is the primary target; any others receive a copy of every write.
+func (c *Config) TargetTables() []string {
+	return c.targetTables
+}
+
+// ExportURIs returns the exports parsed from ExportS3URI by Validate. A single
+// export is restored on its own; several form a chain restored in timeline order.
+func (c *Config) ExportURIs() []string {
+	return c.exportURIs
+}
+
+// ResumeAuto is the ResumeKey that has the checkpoint key derived from the
+// export and target tables by AutoResumeKey, so rerunning a command resumes it.
+const ResumeAuto = "auto"
+
+// AutoResumeKey returns the checkpoint URI ResumeAuto stands for, and the owner
+// recorded in its checkpoints. export is the export's ARN, or its URI for
+// exports without one; the checkpoint is kept in the export bucket under the
+// ID at the end of the ARN, or a hash of the URI.
+// Example:
+//
+//	uri, owner := cfg.AutoResumeKey("arn:aws:dynamodb:eu-west-1:123456789012:table/orders/export/01700000000000-a1b2c3d4")
+//	// uri: s3://my-bucket/ddb-pitr/checkpoints/eu-west-1/01700000000000-a1b2c3d4-orders.json
+func (c *Config) AutoResumeKey(export string) (uri, owner string) {
+	id := export[strings.LastIndex(export, "/")+1:]
+	if !strings.HasPrefix(export, "arn:") || id == "" {
+		sum := sha256.Sum256([]byte(export))
+		id = hex.EncodeToString(sum[:8])
+	}
+	tables := strings.Join(c.targetTables, "+")
+	key := s3uri.URI{Bucket: c.exportBucketName, Key: "ddb-pitr/checkpoints/"}
+	return key.Join(c.Region, id+"-"+tables+".json").String(),
+		fmt.Sprintf("%s into %s in %s", export, strings.Join(c.targetTables, ", "), c.Region)
+}
+
+// LockObjectURI returns the S3 URI of the run lock for table. Locks live under LockURI,
+// or under ddb-pitr-locks/ in the export bucket, so restores of the same table
+// from any export in that bucket exclude each other.
+// Example:
+//
+//	cfg.LockObjectURI("orders") // s3://my-bucket/ddb-pitr-locks/eu-west-1/orders.json
+func (c *Config) LockObjectURI(table string) string {
+	prefix := s3uri.URI{Bucket: c.exportBucketName, Key: "ddb-pitr-locks/"}
+	if c.LockURI != "" {
+		prefix, _ = s3uri.Parse(c.LockURI)
+	}
+	return prefix.Join(c.Region, table+".json").String()
+}
+
+// ApplyExport reconciles ExportType and ViewType with the exportType and
+// outputView declared by the export's manifest summary. Empty fields are filled
+// in from the manifest; fields that contradict it are an error, since restoring
+// an export as the wrong type or view silently applies the wrong changes.
+// Example:
+//
+//	if err := cfg.ApplyExport(summary.ExportType, summary.OutputView); err != nil {
+//	    return err
+//	}
+func (c *Config) ApplyExport(exportType, outputView string) error {
+	// Full exports, including those from before exportType existed, hold the
+	// current image of every item
+	manifestType, manifestView := "FULL", "NEW"
+	if exportType == "INCREMENTAL_EXPORT" {
+		manifestType = "INCREMENTAL"
+		if outputView == "NEW_AND_OLD_IMAGES" {
+			manifestView = "NEW_AND_OLD"
+		}
+	}
+
+	if c.ExportType != "" && c.ExportType != manifestType {
+		return fmt.Errorf("export type %s does not match the manifest, which describes a %s export", c.ExportType, manifestType)
+	}
+	if c.ViewType != "" && c.ViewType != manifestView {
+		if manifestType == "FULL" {
+			return fmt.Errorf("view type %s does not match the manifest: full exports have only new images", c.ViewType)
+		}
+		return fmt.Errorf("view type %s does not match the manifest, which has output view %s", c.ViewType, outputView)
+	}
+	c.ExportType, c.ViewType = manifestType, manifestView
+	return nil
+}
+
+// readsExport reports whether the run reads an export, rather than writing the
+// operations of an earlier run from a drained queue or an applied journal.
+func (c *Config) readsExport() bool {
+	return c.DrainQueueURL == "" && c.ApplyJournalURI == ""
+}
+
+// writesTables reports whether the run writes an export into the target tables,
+// rather than draining a queue, applying a journal, publishing to a queue or
+// materializing files, each of which writes through its own path. Options
+// acting on the writes of a restore require it.
+func (c *Config) writesTables() bool {
+	return c.readsExport() && c.PublishQueueURL == "" && c.MaterializeURI == ""
+}
+
 // Validate implements the validation requirements from section 4.1 of the spec.
 // It ensures all required fields are present and have valid values.
 func (c *Config) Validate() error {
-	if c.TableName == "" {
+	// Materializing writes files instead of tables
+	var tables []string
+	if c.MaterializeURI != "" {
+		if c.TableName != "" {
+			return fmt.Errorf("materialize cannot be combined with a table name")
+		}
+	} else if c.TableName == "" {
 		return fmt.Errorf("table name is required")
+	} else {
+		tables = strings.Split(c.TableName, ",")
+	}
+	c.targetTables = nil
+	for _, name := range tables {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return fmt.Errorf("table name list must not contain empty names")
+		}
+		if slices.Contains(c.targetTables, name) {
+			return fmt.Errorf("table %s is listed more than once", name)
+		}
+		c.targetTables = append(c.targetTables, name)
 	}
 
-	if c.ExportS3URI == "" {
+	// Draining a queue or applying a journal writes operations of an earlier run, not an export
+	var uris []string
+	if !c.readsExport() {
+		if c.ExportS3URI != "" {
+			return fmt.Errorf("drain queue and apply journal cannot be combined with an export")
+		}
+	} else if c.ExportS3URI == "" {
 		return fmt.Errorf("export S3 URI is required")
-	}
-	if !strings.HasPrefix(c.ExportS3URI, "s3://") {
-		return fmt.Errorf("export S3 URI must start with s3://")
+	} else {
+		uris = strings.Split(c.ExportS3URI, ",")
 	}
 
-	// Parse the ExportS3URI to extract the bucket name
-	u, err := url.Parse(c.ExportS3URI)
-	if err != nil {
-		return fmt.Errorf("invalid export S3 URI: %w", err)
+	// Parse the ExportS3URI to extract the bucket name of the first export
+	c.exportURIs = nil
+	for _, uri := range uris {
+		uri = strings.TrimSpace(uri)
+		u, err := s3uri.Parse(uri)
+		if err != nil {
+			return fmt.Errorf("invalid export S3 URI: %w", err)
+		}
+		if slices.Contains(c.exportURIs, uri) {
+			return fmt.Errorf("export %s is listed more than once", uri)
+		}
+		if c.exportURIs == nil {
+			c.exportBucketName = u.Bucket
+		}
+		c.exportURIs = append(c.exportURIs, uri)
 	}
-	if u.Scheme != "s3" {
-		return fmt.Errorf("export S3 URI must use s3 scheme")
+	if c.NoManifest {
+		// The URIs are data files of one export; nothing orders them as a chain
+		for _, uri := range c.exportURIs {
+			if u, _ := s3uri.Parse(uri); u.Bucket != c.exportBucketName {
+				return fmt.Errorf("no manifest data files must be in one bucket")
+			}
+		}
+		if c.AllowGaps || c.Follow || c.RestoreTo != "" {
+			return fmt.Errorf("no manifest cannot be combined with allow gaps, follow or restore to")
+		}
+		if c.ExportType == "INCREMENTAL" && c.ViewType == "" {
+			return fmt.Errorf("no manifest incremental exports require a view type")
+		}
+		if c.ExportType != "INCREMENTAL" && c.ViewType == "NEW_AND_OLD" {
+			return fmt.Errorf("no manifest full exports have only new images")
+		}
+	} else {
+		if len(c.exportURIs) > 1 && (c.ExportType != "" || c.ViewType != "") {
+			return fmt.Errorf("export and view types are taken from each export's manifest in an export chain")
+		}
+		if c.AllowGaps && len(c.exportURIs) < 2 {
+			return fmt.Errorf("allow gaps requires an export chain")
+		}
 	}
-	c.exportBucketName = u.Host
 
-	if c.ExportType != "FULL" && c.ExportType != "INCREMENTAL" {
+	if c.ExportType != "" && c.ExportType != "FULL" && c.ExportType != "INCREMENTAL" {
 		return fmt.Errorf("export type must be FULL or INCREMENTAL")
 	}
 
-	if c.ViewType != "NEW" && c.ViewType != "NEW_AND_OLD" {
+	if c.ViewType != "" && c.ViewType != "NEW" && c.ViewType != "NEW_AND_OLD" {
 		return fmt.Errorf("view type must be NEW or NEW_AND_OLD")
 	}
 
+	switch c.ExportFormat {
+	case "", "dynamodb":
+	case "data-pipeline":
+		// Data Pipeline exports are single full exports without write timestamps
+		if len(c.exportURIs) != 1 && !c.NoManifest {
+			return fmt.Errorf("export format data-pipeline requires a single export")
+		}
+		if c.ExportType == "INCREMENTAL" || c.Follow || c.RestoreTo != "" {
+			return fmt.Errorf("export format data-pipeline cannot be combined with incremental exports, follow or restore to")
+		}
+	default:
+		return fmt.Errorf("export format must be dynamodb or data-pipeline")
+	}
+
 	if c.Region == "" {
 		return fmt.Errorf("region is required")
 	}
@@ -79,13 +355,500 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("batch size must be between 1 and 25")
 	}
 
-	if c.ReportS3URI != "" && !strings.HasPrefix(c.ReportS3URI, "s3://") {
-		return fmt.Errorf("report S3 URI must start with s3://")
+	if c.UpdateParallelism < 0 {
+		return fmt.Errorf("update parallelism must not be negative")
+	}
+
+	if c.MaxLineMiB < 0 {
+		return fmt.Errorf("max line size must not be negative")
+	}
+
+	if c.CacheDir != "" && c.CacheMiB <= 0 {
+		return fmt.Errorf("cache size must be positive with a cache directory")
+	}
+
+	if c.ReadAheadParts < 0 {
+		return fmt.Errorf("read ahead parts must not be negative")
+	}
+
+	if c.MemoryBudgetMiB < 0 {
+		return fmt.Errorf("memory budget must not be negative")
+	}
+
+	if c.TraceEndpoint != "" {
+		if u, err := url.Parse(c.TraceEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("trace endpoint must be an http:// or https:// URL")
+		}
+	}
+
+	if c.DynamoDBEndpoint != "" {
+		if u, err := url.Parse(c.DynamoDBEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("dynamodb endpoint must be an http:// or https:// URL")
+		}
+	}
+
+	if c.ReportS3URI != "" {
+		if _, err := s3uri.ParseObject(c.ReportS3URI); err != nil {
+			return fmt.Errorf("invalid report S3 URI: %w", err)
+		}
+	}
+
+	if c.KeyPrefix != "" && c.KeyEquals != "" {
+		return fmt.Errorf("key prefix and key equals are mutually exclusive")
+	}
+	if (c.KeyPrefix != "" || c.KeyEquals != "") && c.KeyAttribute == "" {
+		return fmt.Errorf("key attribute is required with a key condition")
+	}
+
+	if (c.RemapPrefix != "" || c.RemapSuffix != "") && c.RemapAttribute == "" {
+		return fmt.Errorf("remap attribute is required with a remap prefix or suffix")
+	}
+	if c.RemapAttribute != "" && c.RemapPrefix == "" && c.RemapSuffix == "" {
+		return fmt.Errorf("remap attribute requires a remap prefix or suffix")
+	}
+
+	if (c.ReshardAttribute == "") != (c.ReshardCount == 0) {
+		return fmt.Errorf("reshard attribute and reshard count must be given together")
+	}
+	if c.ReshardCount < 0 {
+		return fmt.Errorf("reshard count must be positive")
+	}
+	if (c.ReshardSeparator != "" || c.ReshardBy != "") && c.ReshardAttribute == "" {
+		return fmt.Errorf("reshard attribute is required with a reshard separator or reshard by")
+	}
+	if c.ReshardAttribute != "" && c.ReshardAttribute == c.ReshardBy {
+		return fmt.Errorf("reshard by must be another attribute than the resharded one")
+	}
+
+	if (c.ShiftTimeAttrs == "") != (c.ShiftTimeBy == "") {
+		return fmt.Errorf("shift time attributes and shift time by must be given together")
+	}
+	if c.ShiftTimeBy != "" && c.ShiftTimeBy != "now" {
+		if _, err := time.ParseDuration(c.ShiftTimeBy); err != nil {
+			return fmt.Errorf("shift time by must be a duration or now: %w", err)
+		}
+	}
+
+	if c.IncludeAttrs != "" && c.ExcludeAttrs != "" {
+		return fmt.Errorf("include attrs and exclude attrs cannot be combined")
+	}
+
+	if c.RestoreTo != "" {
+		if _, err := time.Parse(time.RFC3339, c.RestoreTo); err != nil {
+			return fmt.Errorf("restore to must be an RFC 3339 time: %w", err)
+		}
+		// Records after the restored exports would move the table past the time
+		if c.Follow || c.ReplaySources != "" || !c.readsExport() {
+			return fmt.Errorf("restore to cannot be combined with follow, replay, drain or apply journal")
+		}
+	}
+
+	if c.PrefixStatsDelim != "" && !c.readsExport() {
+		return fmt.Errorf("prefix stats cannot be combined with drain or apply journal")
+	}
+
+	if c.DriftReportPath != "" && !c.Plan {
+		return fmt.Errorf("drift report requires plan")
+	}
+	if (c.PriorityFiles != "" || c.PriorityKeyPrefix != "") && !c.readsExport() {
+		return fmt.Errorf("priority files and priority key prefix cannot be combined with drain or apply journal")
+	}
+
+	if c.PlanSample < 0 {
+		return fmt.Errorf("plan sample must not be negative")
+	}
+	if c.PlanSample > 0 && !c.Plan {
+		return fmt.Errorf("plan sample requires plan")
+	}
+
+	if c.KeysReportPath != "" && c.KeysFile == "" {
+		return fmt.Errorf("keys report requires a keys file")
+	}
+
+	if c.DeadLetterURI != "" && !strings.HasPrefix(c.DeadLetterURI, "file://") {
+		return fmt.Errorf("dead-letter URI must start with file://")
+	}
+
+	switch c.OnCorrupt {
+	case "", "skip", "abort":
+	case "dead-letter":
+		if c.DeadLetterURI == "" {
+			return fmt.Errorf("on-corrupt dead-letter requires a dead-letter URI")
+		}
+	default:
+		return fmt.Errorf("on-corrupt must be skip, abort or dead-letter")
+	}
+	switch c.CollectionPolicy {
+	case "", "abort", "skip":
+	default:
+		return fmt.Errorf("item collection policy must be abort or skip")
+	}
+	if c.MaxCorruptPercent < 0 || c.MaxCorruptPercent >= 100 {
+		return fmt.Errorf("max corrupt percent must be at least 0 and below 100")
+	}
+
+	if c.ProgressFormat != "" && c.ProgressFormat != "text" && c.ProgressFormat != "ndjson" {
+		return fmt.Errorf("progress format must be text or ndjson")
+	}
+
+	switch c.Schedule {
+	case "", "file":
+		if c.KeyWriters != 0 {
+			return fmt.Errorf("key writers require schedule key")
+		}
+	case "key":
+		if c.KeyWriters < 0 {
+			return fmt.Errorf("key writers must not be negative")
+		}
+		// Routing applies to the writes of a restore into tables
+		if !c.writesTables() {
+			return fmt.Errorf("schedule key cannot be combined with drain, apply journal, publish or materialize")
+		}
+	default:
+		return fmt.Errorf("schedule must be file or key")
+	}
+
+	switch c.WriteMode {
+	case "", "dynamodb":
+	case "partiql":
+		// PartiQL writes restore an export's items; the other sources and sinks write through their own paths
+		if !c.writesTables() {
+			return fmt.Errorf("write mode partiql cannot be combined with drain, apply journal, publish or materialize")
+		}
+	default:
+		return fmt.Errorf("write mode must be dynamodb or partiql")
+	}
+
+	switch c.EnableStream {
+	case "", "SOURCE", "NEW_IMAGE", "OLD_IMAGE", "NEW_AND_OLD_IMAGES", "KEYS_ONLY":
+	default:
+		return fmt.Errorf("enable stream must be SOURCE, NEW_IMAGE, OLD_IMAGE, NEW_AND_OLD_IMAGES or KEYS_ONLY")
+	}
+	// Only a restore of an export writes the target tables through the stream-enabled path
+	if c.EnableStream != "" && !c.writesTables() {
+		return fmt.Errorf("enable stream cannot be combined with drain, apply journal, publish or materialize")
+	}
+
+	if c.WriteHookTimeout < 0 {
+		return fmt.Errorf("write hook timeout must not be negative")
+	}
+	if c.WriteHook == "" && c.WriteHookTimeout != 0 {
+		return fmt.Errorf("write hook timeout requires a write hook")
+	}
+	// The hook sits in front of the writers of a restore into tables
+	if c.WriteHook != "" && !c.writesTables() {
+		return fmt.Errorf("write hook cannot be combined with drain, apply journal, publish or materialize")
+	}
+
+	// Only a restore into tables reads them back
+	if c.SkipUnchanged && !c.writesTables() {
+		return fmt.Errorf("skip unchanged cannot be combined with drain, apply journal, publish or materialize")
+	}
+
+	// The shadow mirrors the writes of a restore into tables
+	if c.ShadowTable != "" {
+		if slices.Contains(c.targetTables, c.ShadowTable) {
+			return fmt.Errorf("shadow table %s must not be a target table", c.ShadowTable)
+		}
+		if !c.writesTables() {
+			return fmt.Errorf("shadow table cannot be combined with drain, apply journal, publish or materialize")
+		}
+	}
+
+	if c.ReplaySpeed < 0 {
+		return fmt.Errorf("replay speed must not be negative")
+	}
+	// Only the operations of incremental exports carry write timestamps
+	if c.ReplaySpeed > 0 && c.ExportType == "FULL" {
+		return fmt.Errorf("replay speed requires an incremental export")
+	}
+	if c.ReplaySpeed > 0 && !c.writesTables() {
+		return fmt.Errorf("replay speed cannot be combined with drain, apply journal, publish or materialize")
+	}
+
+	switch c.Compat {
+	case "", "dynamodb":
+	case "alternator":
+		// Alternator serves its own endpoint and lacks PartiQL and enabling streams on existing tables
+		if c.DynamoDBEndpoint == "" {
+			return fmt.Errorf("compat alternator requires a dynamodb endpoint")
+		}
+		if c.WriteMode == "partiql" {
+			return fmt.Errorf("compat alternator cannot be combined with write mode partiql")
+		}
+		if c.EnableStream != "" {
+			return fmt.Errorf("compat alternator cannot be combined with enable stream")
+		}
+	default:
+		return fmt.Errorf("compat must be dynamodb or alternator")
+	}
+
+	c.tableTags = nil
+	for _, tag := range strings.Split(c.Tags, ",") {
+		if strings.TrimSpace(tag) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(tag, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("tag %q must be key=value", tag)
+		}
+		// AWS reserves the aws: prefix for the tags it sets
+		if strings.HasPrefix(key, "aws:") {
+			return fmt.Errorf("tag %s must not start with aws:", key)
+		}
+		if _, dup := c.tableTags[key]; dup {
+			return fmt.Errorf("tag %s is listed more than once", key)
+		}
+		if c.tableTags == nil {
+			c.tableTags = make(map[string]string)
+		}
+		c.tableTags[key] = strings.TrimSpace(value)
+	}
+	if (c.tableTags != nil || c.CopyTags) && !c.writesTables() {
+		return fmt.Errorf("tags and copy tags cannot be combined with drain, apply journal, publish or materialize")
+	}
+	// The run ID is an S3 object tag value
+	if len(c.RunID) > 256 || strings.ContainsFunc(c.RunID, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || strings.ContainsRune(" +-=._:/@", r))
+	}) {
+		return fmt.Errorf("run ID must be at most 256 letters, digits, spaces or + - = . _ : / @")
+	}
+
+	if c.NotifyTarget != "" && !strings.HasPrefix(c.NotifyTarget, "https://") &&
+		!(strings.HasPrefix(c.NotifyTarget, "arn:") && strings.Contains(c.NotifyTarget, ":sns:")) {
+		return fmt.Errorf("notify target must be an SNS topic ARN or an https:// URL")
 	}
 
 	if c.ShutdownTimeout < time.Second {
 		return fmt.Errorf("shutdown timeout must be at least 1 second")
 	}
 
+	if c.StallTimeout < 0 {
+		return fmt.Errorf("stall timeout must not be negative")
+	}
+
+	if c.CheckpointHistory < 0 {
+		return fmt.Errorf("checkpoint history must not be negative")
+	}
+	if c.CheckpointHistory > 0 && c.ResumeKey == "" {
+		return fmt.Errorf("checkpoint history requires resume")
+	}
+
+	if c.CheckpointEvery < 0 {
+		return fmt.Errorf("checkpoint interval must not be negative")
+	}
+
+	if c.FileTimeout < 0 || c.BatchTimeout < 0 {
+		return fmt.Errorf("file and batch timeouts must not be negative")
+	}
+	if c.FileRequeues < 0 {
+		return fmt.Errorf("file requeues must not be negative")
+	}
+	if c.UnprocessedLimit < 0 {
+		return fmt.Errorf("unprocessed retries must not be negative")
+	}
+
+	if c.HTTPMaxIdleConns < 0 || c.HTTPConnTimeout < 0 || c.HTTPTLSTimeout < 0 || c.ClientShards < 0 {
+		return fmt.Errorf("HTTP client settings must not be negative")
+	}
+
+	if c.FollowQueueURL != "" {
+		if !c.Follow {
+			return fmt.Errorf("follow queue requires follow")
+		}
+		if !strings.HasPrefix(c.FollowQueueURL, "https://") {
+			return fmt.Errorf("follow queue must be an https:// SQS queue URL")
+		}
+	}
+	if c.Follow {
+		if c.Plan {
+			return fmt.Errorf("follow cannot be combined with plan")
+		}
+		if c.FollowInterval < time.Second {
+			return fmt.Errorf("follow interval must be at least 1 second")
+		}
+	}
+
+	if c.ReplaySources != "" {
+		if c.Follow {
+			// An export applied after the replay would revert the newer changes
+			return fmt.Errorf("replay cannot be combined with follow")
+		}
+		for _, source := range strings.Split(c.ReplaySources, ",") {
+			source = strings.TrimSpace(source)
+			if source == "" {
+				return fmt.Errorf("replay source list must not contain empty sources")
+			}
+			if strings.HasPrefix(source, "s3://") {
+				if _, err := s3uri.ParseObject(source); err != nil {
+					return fmt.Errorf("invalid replay source: %w", err)
+				}
+			}
+		}
+	}
+
+	if c.PublishQueueURL != "" {
+		if !strings.HasPrefix(c.PublishQueueURL, "https://") || !strings.HasSuffix(c.PublishQueueURL, ".fifo") {
+			return fmt.Errorf("publish queue must be the https:// URL of an SQS FIFO queue")
+		}
+		if len(c.targetTables) > 1 {
+			return fmt.Errorf("publish queue requires a single table; list the tables when draining")
+		}
+	}
+	if c.DrainQueueURL != "" {
+		if !strings.HasPrefix(c.DrainQueueURL, "https://") {
+			return fmt.Errorf("drain queue must be an https:// SQS queue URL")
+		}
+		if c.PublishQueueURL != "" || c.Follow || c.Plan || c.ReplaySources != "" || c.ResumeKey != "" {
+			return fmt.Errorf("drain queue cannot be combined with publish queue, follow, plan, replay or resume")
+		}
+	}
+	if c.DrainIdle < 0 {
+		return fmt.Errorf("drain idle must not be negative")
+	}
+
+	if c.JournalURI != "" {
+		if _, err := s3uri.Parse(c.JournalURI); err != nil {
+			return fmt.Errorf("invalid journal URI: %w", err)
+		}
+		if c.DrainQueueURL != "" || c.PublishQueueURL != "" || c.MaterializeURI != "" {
+			return fmt.Errorf("journal cannot be combined with drain, publish queue or materialize")
+		}
+	}
+	if c.OffloadURI != "" {
+		if _, err := s3uri.Parse(c.OffloadURI); err != nil {
+			return fmt.Errorf("invalid offload URI: %w", err)
+		}
+	}
+	if c.OffloadKiB < 0 || c.OffloadKiB > 400 {
+		return fmt.Errorf("offload threshold must be between 0 and DynamoDB's 400 KB item limit")
+	}
+	if c.JournalRotateMiB < 0 {
+		return fmt.Errorf("journal rotate size must not be negative")
+	}
+	if c.ApplyJournalURI != "" {
+		if _, err := s3uri.Parse(c.ApplyJournalURI); err != nil {
+			return fmt.Errorf("invalid apply journal URI: %w", err)
+		}
+		if c.DrainQueueURL != "" || c.PublishQueueURL != "" || c.MaterializeURI != "" || c.Follow || c.Plan || c.ReplaySources != "" || c.ResumeKey != "" {
+			return fmt.Errorf("apply journal cannot be combined with drain, publish queue, materialize, follow, plan, replay or resume")
+		}
+	} else if c.InvertJournal {
+		return fmt.Errorf("invert requires apply journal")
+	}
+	if c.RepairReportURI != "" {
+		if c.DrainQueueURL != "" || c.PublishQueueURL != "" || c.ApplyJournalURI != "" || c.Follow || c.ReplaySources != "" || c.ResumeKey != "" {
+			// A checkpoint marks files with dead-lettered lines complete, so a resumed repair would skip them
+			return fmt.Errorf("repair cannot be combined with drain, publish queue, apply journal, follow, replay or resume")
+		}
+	}
+
+	if c.MaterializeURI != "" {
+		if !strings.HasPrefix(c.MaterializeURI, "s3://") && !strings.HasPrefix(c.MaterializeURI, "file://") {
+			return fmt.Errorf("materialize URI must be an s3:// prefix or a file:// directory")
+		}
+		if _, err := url.Parse(c.MaterializeURI); err != nil {
+			return fmt.Errorf("invalid materialize URI: %w", err)
+		}
+		if c.MaterializeKeys == "" {
+			return fmt.Errorf("materialize keys are required with materialize")
+		}
+		if c.Follow || c.ResumeKey != "" || c.DrainQueueURL != "" || c.PublishQueueURL != "" {
+			// Items are held in memory until the end, so a resumed run would lose them
+			return fmt.Errorf("materialize cannot be combined with follow, resume, drain or publish queue")
+		}
+	} else if c.MaterializeKeys != "" || c.PartitionBy != "" {
+		return fmt.Errorf("materialize keys and partition by require materialize")
+	}
+	if c.GlueTable != "" {
+		if !strings.HasPrefix(c.MaterializeURI, "s3://") {
+			return fmt.Errorf("glue table requires materialize to an s3:// prefix")
+		}
+		if database, table, ok := strings.Cut(c.GlueTable, "."); !ok || database == "" || table == "" || strings.Contains(table, ".") {
+			return fmt.Errorf("glue table must be database.table")
+		}
+	}
+
+	if c.StrictDecode && c.SDKDecoder {
+		return fmt.Errorf("strict decode requires the built-in parser, not the SDK decoder")
+	}
+
+	if c.LockURI != "" {
+		if _, err := s3uri.Parse(c.LockURI); err != nil {
+			return fmt.Errorf("invalid lock URI: %w", err)
+		}
+	}
+	if c.NoLock && (c.LockURI != "" || c.ForceUnlock != "") {
+		return fmt.Errorf("no lock cannot be combined with a lock URI or force unlock")
+	}
+
+	if c.MaxDownloadMbps < 0 {
+		return fmt.Errorf("max download Mbps must not be negative")
+	}
+
 	return nil
 }
+
+// redacted replaces credentials and tokens in the URLs of a Snapshot.
+const redacted = "REDACTED"
+
+// Snapshot returns the fields of c that are set, by field name, so a report can
+// record how a restore was run. Durations are formatted like "5m0s". URLs keep
+// their scheme, host and path, but their user info and query values, which may
+// hold credentials, are redacted, as is the path of an https:// NotifyTarget,
+// since webhook URLs carry their token there.
+// Example:
+//
+//	snapshot := cfg.Snapshot()
+//	fmt.Println(snapshot["TableName"])
+func (c *Config) Snapshot() map[string]any {
+	snapshot := make(map[string]any)
+	v := reflect.ValueOf(*c)
+	t := v.Type()
+	for i := range t.NumField() {
+		field, value := t.Field(i), v.Field(i)
+		if !field.IsExported() || value.IsZero() {
+			continue
+		}
+		switch x := value.Interface().(type) {
+		case time.Duration:
+			snapshot[field.Name] = x.String()
+		case string:
+			snapshot[field.Name] = redactURL(x, field.Name == "NotifyTarget")
+		default:
+			snapshot[field.Name] = x
+		}
+	}
+	return snapshot
+}
+
+// redactURL redacts the user info and query values of s if it is a URL, and its
+// path too if redactPath is set. Other strings are returned as they are.
+func redactURL(s string, redactPath bool) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return s
+	}
+	changed := false
+	if u.User != nil {
+		u.User = url.User(redacted)
+		changed = true
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for k := range query {
+			query[k] = []string{redacted}
+		}
+		u.RawQuery = query.Encode()
+		changed = true
+	}
+	if redactPath && u.Scheme == "https" && u.Path != "" && u.Path != "/" {
+		u.Path, u.RawPath = "/"+redacted, ""
+		changed = true
+	}
+	if !changed {
+		return s
+	}
+	return u.String()
+}
@@ -0,0 +1,147 @@
+// Package control exposes a running restore's runtime controls over HTTP on a
+// local unix socket, so an operator can pause, resume, resize or checkpoint a
+// restore without restarting it:
+//
+//	curl --unix-socket /tmp/ddb-pitr.sock -X POST http://localhost/pause
+package control
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/coordinator"
+)
+
+// Controller is the subset of *coordinator.Coordinator driven by the server.
+type Controller interface {
+	Pause()
+	Resume()
+	SetWorkers(n int) error
+	RequestCheckpoint()
+	ControlStatus() coordinator.ControlStatus
+}
+
+// Server serves the control API.
+//
+//	GET  /status                current ControlStatus
+//	POST /pause                 stop taking files and hold workers before their next write
+//	POST /resume                release a pause
+//	POST /workers?count=N       change the worker count
+//	POST /checkpoint            write partial batches and save checkpoints now
+//
+// Every endpoint responds with the resulting ControlStatus as JSON.
+// Example:
+//
+//	srv, err := control.Listen("/tmp/ddb-pitr.sock", coord)
+//	if err != nil {
+//	    return err
+//	}
+//	defer srv.Close()
+type Server struct {
+	ctrl     Controller
+	http     *http.Server
+	listener net.Listener
+	path     string
+}
+
+// NewServer creates a Server for ctrl. Use Listen to serve it on a socket, or
+// Handler to mount it elsewhere.
+func NewServer(ctrl Controller) *Server {
+	return &Server{ctrl: ctrl}
+}
+
+// Listen serves the control API for ctrl on a unix socket at path, readable and
+// writable by the current user only. A stale socket left by a crashed run is
+// replaced; a live one is an error.
+func Listen(path string, ctrl Controller) (*Server, error) {
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("control socket path %s exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("control socket %s is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale control socket: %w", err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		_ = l.Close()
+		return nil, fmt.Errorf("failed to restrict control socket permissions: %w", err)
+	}
+
+	s := NewServer(ctrl)
+	s.path = path
+	s.listener = l
+	s.http = &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() { _ = s.http.Serve(l) }()
+	return s, nil
+}
+
+// Close stops serving and removes the socket.
+func (s *Server) Close() error {
+	if s.http == nil {
+		return nil
+	}
+	err := s.http.Close()
+	if rmErr := os.Remove(s.path); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// Handler returns the HTTP handler for the control API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		s.writeStatus(w)
+	})
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		s.ctrl.Pause()
+		s.writeStatus(w)
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		s.ctrl.Resume()
+		s.writeStatus(w)
+	})
+	mux.HandleFunc("POST /checkpoint", func(w http.ResponseWriter, r *http.Request) {
+		s.ctrl.RequestCheckpoint()
+		s.writeStatus(w)
+	})
+	mux.HandleFunc("POST /workers", func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(r.URL.Query().Get("count"))
+		if err != nil {
+			http.Error(w, "count must be an integer", http.StatusBadRequest)
+			return
+		}
+		if err := s.ctrl.SetWorkers(n); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		s.writeStatus(w)
+	})
+	return mux
+}
+
+// writeStatus responds with the current ControlStatus.
+func (s *Server) writeStatus(w http.ResponseWriter) {
+	data, err := json.Marshal(s.ctrl.ControlStatus())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(append(data, '\n'))
+}
@@ -0,0 +1,123 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gurre/ddb-pitr/coordinator"
+)
+
+type fakeController struct {
+	status      coordinator.ControlStatus
+	setErr      error
+	checkpoints int
+}
+
+func (f *fakeController) Pause()  { f.status.Paused = true }
+func (f *fakeController) Resume() { f.status.Paused = false }
+func (f *fakeController) SetWorkers(n int) error {
+	if f.setErr != nil {
+		return f.setErr
+	}
+	f.status.TargetWorkers = n
+	return nil
+}
+func (f *fakeController) RequestCheckpoint() { f.checkpoints++ }
+func (f *fakeController) ControlStatus() coordinator.ControlStatus {
+	return f.status
+}
+
+func do(t *testing.T, h http.Handler, method, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+// TestHandlerRoutesCommands verifies each endpoint reaches the controller and
+// answers with the resulting status.
+func TestHandlerRoutesCommands(t *testing.T) {
+	ctrl := &fakeController{}
+	h := NewServer(ctrl).Handler()
+
+	if rec := do(t, h, http.MethodPost, "/pause"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"paused":true`) {
+		t.Errorf("pause: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(t, h, http.MethodPost, "/resume"); !strings.Contains(rec.Body.String(), `"paused":false`) {
+		t.Errorf("resume: %s", rec.Body)
+	}
+	if rec := do(t, h, http.MethodPost, "/workers?count=4"); !strings.Contains(rec.Body.String(), `"targetWorkers":4`) {
+		t.Errorf("workers: %s", rec.Body)
+	}
+	do(t, h, http.MethodPost, "/checkpoint")
+	if ctrl.checkpoints != 1 {
+		t.Errorf("expected 1 checkpoint request, got %d", ctrl.checkpoints)
+	}
+}
+
+// TestHandlerRejectsBadRequests ensures mistakes are reported to the operator
+// rather than silently ignored, and that state changes require POST.
+func TestHandlerRejectsBadRequests(t *testing.T) {
+	ctrl := &fakeController{}
+	h := NewServer(ctrl).Handler()
+
+	if rec := do(t, h, http.MethodPost, "/workers?count=many"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a non-numeric count, got %d", rec.Code)
+	}
+	ctrl.setErr = errors.New("restore has finished")
+	if rec := do(t, h, http.MethodPost, "/workers?count=2"); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 when the controller refuses, got %d", rec.Code)
+	}
+	if rec := do(t, h, http.MethodGet, "/pause"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET /pause, got %d", rec.Code)
+	}
+	if ctrl.status.Paused {
+		t.Error("GET /pause must not pause")
+	}
+}
+
+// TestListenServesOnUnixSocket exercises the socket end to end, including the
+// owner-only permissions and cleanup on Close.
+func TestListenServesOnUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctl.sock")
+	srv, err := Listen(path, &fakeController{})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected socket with mode 0600, got %v (%v)", info.Mode(), err)
+	}
+	if _, err := Listen(path, &fakeController{}); err == nil {
+		t.Error("expected a second Listen on a live socket to fail")
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://localhost/status")
+	if err != nil {
+		t.Fatalf("GET /status: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"runningWorkers":0`) {
+		t.Errorf("unexpected status %s", body)
+	}
+
+	if err := srv.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected socket to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gurre/ddb-pitr/manifest"
+)
+
+// maxControlWorkers caps the worker count that can be set while running.
+const maxControlWorkers = 1000
+
+// errRetired is returned by a worker that exits because the worker count was lowered.
+var errRetired = errors.New("worker retired")
+
+// ControlStatus describes the runtime controls of a running restore.
+type ControlStatus struct {
+	TargetWorkers      int   `json:"targetWorkers"`      // Worker count requested
+	RunningWorkers     int   `json:"runningWorkers"`     // Workers currently running
+	CheckpointRequests int64 `json:"checkpointRequests"` // Immediate checkpoints requested so far
+	Paused             bool  `json:"paused"`             // True while dispatching and writes are paused
+}
+
+// workerPool tracks the worker goroutines of one Run so the worker count can be
+// changed while it runs. Workers exit when the task channel closes, on error, or
+// at a file boundary when there are more of them than target.
+type workerPool struct {
+	tasks    <-chan manifest.FileMeta
+	done     chan struct{}           // Closed once the last worker exits
+	errs     []error                 // Worker failures
+	abort    context.CancelCauseFunc // Cancels the Run when a worker exceeds the corrupt line limit
+	target   int
+	running  int
+	retiring int  // Workers that have decided to retire but not yet exited
+	nextID   int  // ID of the next spawned worker
+	finished bool // True once done is closed; no more workers may start
+	mu       sync.Mutex
+}
+
+// startWorkers creates the pool for one Run and spawns MaxWorkers workers.
+func (c *Coordinator) startWorkers(ctx context.Context, tasks <-chan manifest.FileMeta, abort context.CancelCauseFunc) *workerPool {
+	pool := &workerPool{tasks: tasks, done: make(chan struct{}), abort: abort}
+	c.ctrlMu.Lock()
+	c.pool = pool
+	c.ctrlMu.Unlock()
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.target = c.cfg.MaxWorkers
+	for pool.running < pool.target {
+		c.spawnLocked(ctx, pool)
+	}
+	return pool
+}
+
+// spawnLocked starts one worker. pool.mu must be held.
+func (c *Coordinator) spawnLocked(ctx context.Context, pool *workerPool) {
+	id := pool.nextID
+	pool.nextID++
+	pool.running++
+	go func() {
+		c.initWorker(id)
+		err := c.worker(ctx, id, pool.tasks)
+
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		pool.running--
+		switch {
+		case errors.Is(err, errRetired):
+			pool.retiring--
+		case err != nil:
+			pool.errs = append(pool.errs, fmt.Errorf("worker %d failed: %w", id, err))
+			if errors.Is(err, ErrCorruptLimit) {
+				pool.abort(err)
+			}
+		}
+		if pool.running == 0 {
+			pool.finished = true
+			close(pool.done)
+		}
+	}()
+}
+
+// shouldRetire reports whether the worker should exit to honour a lowered worker count.
+func (pool *workerPool) shouldRetire() bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if pool.running-pool.retiring > pool.target {
+		pool.retiring++
+		return true
+	}
+	return false
+}
+
+// SetWorkers changes the number of workers of a running restore. Extra workers
+// start at once; surplus workers exit after finishing their current file.
+// Example:
+//
+//	if err := coord.SetWorkers(4); err != nil {
+//	    log.Print(err)
+//	}
+func (c *Coordinator) SetWorkers(n int) error {
+	if n < 1 || n > maxControlWorkers {
+		return fmt.Errorf("worker count must be between 1 and %d", maxControlWorkers)
+	}
+	c.ctrlMu.Lock()
+	pool, ctx := c.pool, c.runCtx
+	c.ctrlMu.Unlock()
+	if pool == nil {
+		return fmt.Errorf("restore is not running")
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if pool.finished {
+		return fmt.Errorf("restore has finished")
+	}
+	pool.target = n
+	for pool.running-pool.retiring < pool.target {
+		c.spawnLocked(ctx, pool)
+	}
+	return nil
+}
+
+// Pause stops dispatching files and holds every worker before its next batch
+// write. Open S3 streams may time out while paused; they are retried from the
+// last written batch after Resume.
+func (c *Coordinator) Pause() {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+	if c.resumeCh == nil {
+		c.resumeCh = make(chan struct{})
+	}
+}
+
+// Resume releases a Pause.
+func (c *Coordinator) Resume() {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+	if c.resumeCh != nil {
+		close(c.resumeCh)
+		c.resumeCh = nil
+	}
+}
+
+// isPaused reports whether the restore is paused.
+func (c *Coordinator) isPaused() bool {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+	return c.resumeCh != nil
+}
+
+// waitIfPaused blocks while the restore is paused. The worker's LastActive is
+// refreshed afterwards so the stall watchdog does not count the pause.
+func (c *Coordinator) waitIfPaused(ctx context.Context, id int) error {
+	c.ctrlMu.Lock()
+	ch := c.resumeCh
+	c.ctrlMu.Unlock()
+	if ch == nil {
+		return nil
+	}
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	c.updateWorkerStatus(id, func(*WorkerStatus) {})
+	return nil
+}
+
+// RequestCheckpoint asks every busy worker to write its partial batch and save a
+// checkpoint as soon as it reads its next line.
+func (c *Coordinator) RequestCheckpoint() {
+	c.checkpointRequests.Add(1)
+}
+
+// ControlStatus returns the current runtime control state.
+func (c *Coordinator) ControlStatus() ControlStatus {
+	status := ControlStatus{
+		CheckpointRequests: c.checkpointRequests.Load(),
+		Paused:             c.isPaused(),
+	}
+	c.ctrlMu.Lock()
+	pool := c.pool
+	c.ctrlMu.Unlock()
+	if pool != nil {
+		pool.mu.Lock()
+		status.TargetWorkers = pool.target
+		status.RunningWorkers = pool.running
+		pool.mu.Unlock()
+	}
+	return status
+}
@@ -5,18 +5,30 @@ package coordinator
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/url"
+	"maps"
+	"math/rand/v2"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/tracing"
+	"github.com/gurre/ddb-pitr/aws"
 	"github.com/gurre/ddb-pitr/checkpoint"
+	"github.com/gurre/ddb-pitr/clock"
 	"github.com/gurre/ddb-pitr/config"
+	"github.com/gurre/ddb-pitr/deadletter"
 	"github.com/gurre/ddb-pitr/itemimage"
 	"github.com/gurre/ddb-pitr/manifest"
 	"github.com/gurre/ddb-pitr/metrics"
+	"github.com/gurre/ddb-pitr/s3uri"
+	"github.com/gurre/ddb-pitr/stream"
 	"github.com/gurre/ddb-pitr/writer"
 	"github.com/gurre/s3streamer"
 )
@@ -31,8 +43,36 @@ type WorkerStatus struct {
 	LastError     error     // Last error encountered (16 bytes - interface)
 	CurrentFile   string    // Currently processing file (16 bytes - string header)
 	ItemsWritten  int64     // Number of items written (8 bytes)
+	CurrentOffset int64     // Stream offset of the last line seen (8 bytes)
 	BatchesCount  int64     // Number of batches processed (8 bytes)
 	ID            int       // Worker identifier (8 bytes on 64-bit)
+
+	cancel  context.CancelCauseFunc // Cancels the current file attempt; nil while idle
+	backoff *writer.BackoffTimer    // Backoff of the worker's writes; nil until it starts
+}
+
+// errStalled is the cancellation cause used by the stall watchdog.
+var errStalled = errors.New("worker stalled")
+
+// errFileTimeout is the cancellation cause of a file attempt exceeding FileTimeout.
+var errFileTimeout = errors.New("file timeout")
+
+// errBatchTimeout is the cancellation cause of a batch write exceeding BatchTimeout.
+var errBatchTimeout = errors.New("batch timeout")
+
+// ErrCorruptLimit is returned by Run when corrupt lines exceed the configured
+// policy: any corrupt line with OnCorrupt "abort", or more than MaxCorruptPercent.
+var ErrCorruptLimit = errors.New("corrupt line limit exceeded")
+
+// minCorruptSample is the number of lines seen before MaxCorruptPercent is
+// enforced mid-run, so a corrupt first line does not abort the restore on its
+// own. Run checks the limit again once every file is done.
+const minCorruptSample = 1000
+
+// isTimeout reports whether err ended an attempt because it ran out of time
+// rather than because of a failure, so a retry can pick up where it left off.
+func isTimeout(err error) bool {
+	return errors.Is(err, errStalled) || errors.Is(err, errFileTimeout) || errors.Is(err, errBatchTimeout)
 }
 
 // ReportUploader uploads reports to S3.
@@ -40,6 +80,23 @@ type ReportUploader interface {
 	UploadReport(ctx context.Context, uri string, report metrics.Report) error
 }
 
+// Transformer rewrites or drops decoded operations before they are batched.
+// Returning keep=false drops the operation.
+type Transformer interface {
+	Transform(op itemimage.Operation) (itemimage.Operation, bool, error)
+}
+
+// LineFilter rejects raw lines before they are decoded. Keep returning false
+// drops the line; true lines are decoded as usual.
+type LineFilter interface {
+	Keep(line []byte) bool
+}
+
+// EventEmitter receives machine-readable progress events.
+type EventEmitter interface {
+	Emit(ev metrics.Event)
+}
+
 // Coordinator implements the worker pool pattern from section 5.
 // It manages the restore process, including worker coordination,
 // checkpoint management, and progress reporting.
@@ -48,16 +105,188 @@ type Coordinator struct {
 	manifest       manifest.Loader
 	streamer       s3streamer.Streamer
 	parser         itemimage.Decoder
-	writer         writer.Writer
+	targets        []Target // Primary writer first, then any added by WithTarget
 	store          checkpoint.Store
+	progress       *progress // Completed and partly restored files; set by Run
 	metrics        *metrics.Metrics
 	reportUploader ReportUploader
+	retryBackoff   time.Duration                  // Base delay between file attempts, doubled per retry
+	clock          clock.Clock                    // Time source for backoff, progress, stall detection and metrics
+	transformer    Transformer                    // Optional; nil leaves operations unchanged
+	lineFilter     LineFilter                     // Optional; nil decodes every line
+	onSummary      []func(manifest.Summary) error // Optional; called once the manifest is loaded
+	files          map[string]bool                // Optional; restores only these data files when set
+	events         EventEmitter                   // Optional; replaces text progress output when set
+	deadLetter     deadletter.Sink                // Optional; receives corrupt lines with OnCorrupt "dead-letter"
+	memory         *memoryBudget                  // Optional; nil leaves memory use unbounded
+	tracer         tracing.Tracer                 // Creates the pipeline's spans; no-op unless WithTracerProvider
+	prefixAttr     string                         // Optional; partition key whose prefixes are counted in the report
+	prefixDelim    string                         // Ends the prefix counted for prefixAttr
+	pacer          *pacer                         // Optional; spaces writes by write time with ReplaySpeed
+	priority       *prioritySet                   // Optional; files dispatched before the others
+	requeue        *requeue                       // Files handed to the workers again; nil without FileRequeues, set by Run
+
+	// Runtime controls; see control.go
+	runCtx             context.Context // Context of the current Run, for workers started by SetWorkers
+	pool               *workerPool     // Workers of the current Run
+	resumeCh           chan struct{}   // Non-nil while paused; closed by Resume
+	checkpointRequests atomic.Int64    // Incremented by RequestCheckpoint
+	ctrlMu             sync.Mutex
 
 	// Worker management as specified in section 5
 	workerStatus map[int]*WorkerStatus
 	statusMu     sync.RWMutex
 }
 
+// Option configures optional Coordinator dependencies.
+type Option func(*Coordinator)
+
+// WithTransformer runs every decoded operation through t before batching.
+// Example:
+//
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil,
+//	    coordinator.WithTransformer(transform.NewRedactor(rules)),
+//	)
+func WithTransformer(t Transformer) Option {
+	return func(c *Coordinator) {
+		c.transformer = t
+	}
+}
+
+// WithLineFilter skips lines rejected by f without decoding them.
+// Example:
+//
+//	f := transform.NewKeyPrefixFilter("pk", "TENANT#42")
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil,
+//	    coordinator.WithLineFilter(f),
+//	)
+func WithLineFilter(f LineFilter) Option {
+	return func(c *Coordinator) {
+		c.lineFilter = f
+	}
+}
+
+// WithSummaryHook calls fn with the export manifest once it is loaded, before any
+// workers start. Components that report per-export details or size themselves by
+// the export use it. Hooks run in the order given; an error aborts the restore.
+// Example:
+//
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil,
+//	    coordinator.WithSummaryHook(func(s manifest.Summary) error {
+//	        keys.SetExportTime(s.PointInTime())
+//	        return nil
+//	    }),
+//	)
+func WithSummaryHook(fn func(manifest.Summary) error) Option {
+	return func(c *Coordinator) {
+		c.onSummary = append(c.onSummary, fn)
+	}
+}
+
+// WithFiles restores only the data files of the export with the given keys,
+// such as the files an earlier run's report lists as needing repair.
+// Example:
+//
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil,
+//	    coordinator.WithFiles([]string{"AWSDynamoDB/01234-abcd/data/x7k2.json.gz"}),
+//	)
+func WithFiles(keys []string) Option {
+	return func(c *Coordinator) {
+		c.files = make(map[string]bool, len(keys))
+		for _, key := range keys {
+			c.files[key] = true
+		}
+	}
+}
+
+// WithEventEmitter sends progress ticks, checkpoint saves, file completions, errors
+// and the final report to e instead of printing text progress to stdout.
+// Example:
+//
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil,
+//	    coordinator.WithEventEmitter(metrics.NewNDJSONEmitter(os.Stdout)),
+//	)
+func WithEventEmitter(e EventEmitter) Option {
+	return func(c *Coordinator) {
+		c.events = e
+	}
+}
+
+// WithDeadLetter writes lines that fail to decode to sink when the configured
+// OnCorrupt policy is "dead-letter".
+// Example:
+//
+//	sink, err := deadletter.NewFileSink(cfg.DeadLetterURI)
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil,
+//	    coordinator.WithDeadLetter(sink),
+//	)
+func WithDeadLetter(sink deadletter.Sink) Option {
+	return func(c *Coordinator) {
+		c.deadLetter = sink
+	}
+}
+
+// WithMetrics collects the restore's metrics in m instead of a fresh instance, so
+// components created before the coordinator, such as writers recording consumed
+// capacity, can contribute to its report.
+// Example:
+//
+//	m := metrics.NewMetrics()
+//	w := writer.NewDynamoDBWriter(client, "my-table", 25, writer.WithCapacityRecorder(m))
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil,
+//	    coordinator.WithMetrics(m),
+//	)
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(c *Coordinator) {
+		c.metrics = m
+	}
+}
+
+// WithClock sets the time source for retry backoff, progress reports, stall
+// detection and metrics. Tests pass a clock.Fake to drive them without sleeping.
+// Example:
+//
+//	clk := clock.NewFake(time.Now())
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil,
+//	    coordinator.WithClock(clk),
+//	)
+func WithClock(clk clock.Clock) Option {
+	return func(c *Coordinator) {
+		c.clock = clk
+	}
+}
+
+// WithTracerProvider records spans for the manifest load, every file attempt,
+// decode batch and batch write with tracers from tp. Spans are started on the
+// contexts passed to the streamer and writers, so AWS SDK clients given the
+// same provider trace their calls as children.
+// Example:
+//
+//	provider := trace.NewProvider(trace.NewOTLPExporter("http://localhost:4318"))
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil,
+//	    coordinator.WithTracerProvider(provider),
+//	)
+func WithTracerProvider(tp tracing.TracerProvider) Option {
+	return func(c *Coordinator) {
+		c.tracer = tp.Tracer("github.com/gurre/ddb-pitr/coordinator")
+	}
+}
+
+// WithKeyPrefixStats counts the items written per prefix of the partition key
+// attr, up to the first delim, in the report, so operators can confirm every
+// tenant or entity type was restored.
+// Example:
+//
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil,
+//	    coordinator.WithKeyPrefixStats("pk", "#"),
+//	)
+func WithKeyPrefixStats(attr, delim string) Option {
+	return func(c *Coordinator) {
+		c.prefixAttr = attr
+		c.prefixDelim = delim
+	}
+}
+
 // NewCoordinator creates a new Coordinator instance with all required dependencies
 func NewCoordinator(
 	cfg *config.Config,
@@ -67,18 +296,32 @@ func NewCoordinator(
 	writer writer.Writer,
 	store checkpoint.Store,
 	reportUploader ReportUploader,
+	opts ...Option,
 ) *Coordinator {
-	return &Coordinator{
+	c := &Coordinator{
 		cfg:            cfg,
 		manifest:       manifest,
 		streamer:       streamer,
 		parser:         parser,
-		writer:         writer,
 		store:          store,
-		metrics:        metrics.NewMetrics(),
 		reportUploader: reportUploader,
+		retryBackoff:   time.Second,
+		clock:          clock.Real,
 		workerStatus:   make(map[int]*WorkerStatus),
+		memory:         newMemoryBudget(int64(cfg.MemoryBudgetMiB) << 20),
+		tracer:         tracing.NopTracerProvider{}.Tracer(""),
+	}
+	if cfg.ReplaySpeed > 0 {
+		c.pacer = &pacer{speed: cfg.ReplaySpeed}
 	}
+	c.targets = []Target{{Table: c.primaryTable(), Writer: writer}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.metrics == nil {
+		c.metrics = metrics.NewMetrics(metrics.WithClock(c.clock))
+	}
+	return c
 }
 
 // Run implements the main restore process as specified in section 5.
@@ -90,131 +333,323 @@ func (c *Coordinator) Run(ctx context.Context) error {
 	defer cancel()
 
 	// Parse S3 URI to validate it
-	u, err := url.Parse(c.cfg.ExportS3URI)
-	if err != nil {
-		return fmt.Errorf("invalid S3 URI: %w", err)
-	}
-	if u.Scheme != "s3" {
-		return fmt.Errorf("invalid S3 URI scheme: %s", u.Scheme)
+	if _, err := s3uri.Parse(c.cfg.ExportS3URI); err != nil {
+		return err
 	}
 
-	// Load manifest
-	summary, err := c.manifest.Load(ctx, c.cfg.ExportS3URI)
+	// Load the manifest summary; the file list is streamed to the workers below
+	loadCtx, span := c.tracer.StartSpan(ctx, "LoadManifest")
+	span.SetProperty("export.uri", c.cfg.ExportS3URI)
+	summary, err := c.manifest.LoadSummary(loadCtx, c.cfg.ExportS3URI)
+	endSpan(span, err)
 	if err != nil {
 		return fmt.Errorf("failed to load manifest: %w", err)
 	}
+	for _, w := range summary.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	if err := c.cfg.ApplyExport(summary.ExportType, summary.OutputView); err != nil {
+		return err
+	}
+	// Records with only Keys are deletes in the NEW_IMAGE view and corrupt in others
+	if summary.OutputView == "NEW_IMAGE" {
+		c.parser = itemimage.ForView(c.parser, itemimage.ViewNew)
+	}
+	for _, hook := range c.onSummary {
+		if err := hook(summary); err != nil {
+			return err
+		}
+	}
 
 	// Load checkpoint
 	state, err := c.store.Load(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to load checkpoint: %w", err)
 	}
-
-	// Set up worker pool
-	tasks := make(chan manifest.FileMeta)
-	results := make(chan error, c.cfg.MaxWorkers)
-	var wg sync.WaitGroup
+	c.progress = newProgress(c.store, state, c.clock.Now())
+	if state.Legacy() {
+		fmt.Fprintf(os.Stderr, "Warning: checkpoint was saved by an older version that did not track completed files; files other than %s are restored again\n", state.LastFile)
+	}
+	if state.LastFile != "" {
+		// Reading the file list once more up front is cheap next to the restore
+		resume, err := c.progress.summarize(c.manifest.Files(ctx, summary))
+		if err != nil {
+			return fmt.Errorf("failed to load manifest: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Resuming: %s\n", resume)
+	}
 
 	// Start progress reporter
 	if !c.cfg.DryRun {
 		go c.reportProgress(ctx)
 	}
-
-	// Start workers
-	for i := 0; i < c.cfg.MaxWorkers; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			c.initWorker(workerID)
-			if err := c.worker(ctx, workerID, tasks); err != nil {
-				results <- fmt.Errorf("worker %d failed: %w", workerID, err)
-			}
-		}(i)
+	if c.cfg.StallTimeout > 0 {
+		go c.watchStalls(ctx)
 	}
 
-	// Send tasks
-	remainingFiles := 0
-	for _, file := range summary.DataFiles {
-		// Skip files we've already processed
-		if file.Key < state.LastFile {
-			continue
-		}
-		remainingFiles++
+	// Start workers. The pool can grow or shrink while running; see SetWorkers.
+	// A worker exceeding the corrupt line limit aborts the others through ctx.
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	c.ctrlMu.Lock()
+	c.runCtx = ctx
+	c.ctrlMu.Unlock()
+	tasks := make(chan manifest.FileMeta)
+	c.requeue = newRequeue(c.cfg.FileRequeues)
+	pool := c.startWorkers(ctx, tasks, abort)
 
+	// send hands file to a worker, returning false once every worker has
+	// exited; their errors are returned below
+	send := func(file manifest.FileMeta) (bool, error) {
 		select {
 		case tasks <- file:
+			c.requeue.dispatch()
+			return true, nil
+		case <-pool.done:
+			return false, nil
 		case <-ctx.Done():
-			return ctx.Err()
+			return false, abortCause(ctx)
 		}
 	}
-	close(tasks)
-
-	// Wait for workers to finish and collect errors
-	done := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
 
-	// Collect worker errors until all workers complete
-	var errs []error
-	for {
-		select {
-		case err := <-results:
+	// Send tasks as manifest-files.json is read, so the first writes do not wait
+	// for a large manifest to be parsed in full. With priority files the manifest
+	// is read twice: first for the priority files, then for the others, so the
+	// others need not be held in memory until every priority file has been sent.
+	var filesErr error
+	var selected, prioritized int
+	sending := true
+	// sendFiles sends the files for which take is true, given whether they are
+	// priority files. The first pass counts the selected and priority files.
+	sendFiles := func(first bool, take func(isPriority bool) bool) error {
+		for file, err := range c.manifest.Files(ctx, summary) {
 			if err != nil {
-				errs = append(errs, err)
+				filesErr = err
+				return nil
 			}
-		case <-done:
-			// Workers are done, drain any remaining results
-			for {
-				select {
-				case err := <-results:
-					if err != nil {
-						errs = append(errs, err)
-					}
-				default:
-					goto finish
+			if c.files != nil {
+				if !c.files[file.Key] {
+					continue
 				}
+				if first {
+					selected++
+				}
+			}
+			isPriority := c.priority != nil && c.priority.match(file.Key)
+			if isPriority && first {
+				prioritized++
+			}
+			if !take(isPriority) {
+				continue
+			}
+			// Skip files completed by an earlier run
+			if _, ok := c.progress.resumeAt(file.Key); !ok {
+				continue
+			}
+
+			if isPriority {
+				c.priority.dispatch()
+			}
+			ok, err := send(file)
+			if err != nil {
+				return err
+			}
+			if sending = ok; !sending {
+				return nil
+			}
+		}
+		return nil
+	}
+	err = sendFiles(true, func(isPriority bool) bool {
+		return c.priority == nil || isPriority
+	})
+	if err != nil {
+		return err
+	}
+	if c.priority != nil && filesErr == nil && sending {
+		if prioritized == 0 {
+			fmt.Fprintf(os.Stderr, "Warning: none of the priority files are in the export\n")
+		}
+		if c.priority.seal() {
+			c.metrics.RecordPriorityComplete(c.clock.Now())
+		}
+		err = sendFiles(false, func(isPriority bool) bool {
+			return !isPriority
+		})
+		if err != nil {
+			return err
+		}
+	}
+	// Files requeued by failing workers are sent again, after the others, until
+	// every file sent is restored or has failed for good
+	for sending && filesErr == nil {
+		files, busy := c.requeue.take()
+		if !busy {
+			break
+		}
+		for _, file := range files {
+			ok, err := send(file)
+			if err != nil {
+				return err
+			}
+			if sending = ok; !sending {
+				break
 			}
+		}
+		select {
+		case <-c.requeue.notify:
+		case <-pool.done:
+			sending = false
 		case <-ctx.Done():
-			// Wait for workers to acknowledge cancellation
-			<-done
-			return ctx.Err()
+			sending = false
 		}
 	}
+	close(tasks)
+	if filesErr == nil && selected < len(c.files) {
+		fmt.Fprintf(os.Stderr, "Warning: %d of %d selected files are not in the export\n", len(c.files)-selected, len(c.files))
+	}
+	if filesErr != nil {
+		// Workers stop; files they were restoring resume from their last checkpoint
+		cancel()
+		<-pool.done
+		return fmt.Errorf("failed to load manifest: %w", filesErr)
+	}
+
+	// Wait for workers to finish
+	select {
+	case <-pool.done:
+	case <-ctx.Done():
+		// Wait for workers to acknowledge cancellation
+		<-pool.done
+		return abortCause(ctx)
+	}
+	if errors.Is(context.Cause(ctx), ErrCorruptLimit) {
+		c.uploadFailedReport(ctx)
+		return context.Cause(ctx)
+	}
 
-finish:
+	pool.mu.Lock()
+	errs := pool.errs
+	pool.mu.Unlock()
 	if len(errs) > 0 {
-		return fmt.Errorf("some workers failed: %v", errs)
+		c.uploadFailedReport(ctx)
+		return &WorkerErrors{Errors: errs}
 	}
 
 	// Flush any remaining items
-	if err := c.writer.Flush(ctx); err != nil {
+	if err := c.flushTargets(ctx); err != nil {
 		return fmt.Errorf("failed to flush writer: %w", err)
 	}
+	if err := c.checkCorruptLimit(0); err != nil {
+		return err
+	}
 
 	// Generate and print report
 	report := c.metrics.GenerateReport()
-	fmt.Println(report)
+	if c.events != nil {
+		ev := c.newEvent(metrics.EventComplete)
+		ev.Report = &report
+		c.events.Emit(ev)
+	} else {
+		fmt.Println(report)
+	}
 
 	// Upload report to S3 if configured
 	if c.cfg.ReportS3URI != "" && c.reportUploader != nil {
 		if err := c.reportUploader.UploadReport(ctx, c.cfg.ReportS3URI, report); err != nil {
 			return fmt.Errorf("failed to upload report: %w", err)
 		}
-		fmt.Printf("Report uploaded to %s\n", c.cfg.ReportS3URI)
+		if c.events == nil {
+			fmt.Printf("Report uploaded to %s\n", c.cfg.ReportS3URI)
+		}
 	}
 
 	return nil
 }
 
+// uploadFailedReport uploads the report of a failed restore, if configured, so
+// the files it lists as failed can be repaired. Failing to upload it only warns,
+// as the restore has already failed.
+func (c *Coordinator) uploadFailedReport(ctx context.Context) {
+	if c.cfg.ReportS3URI == "" || c.reportUploader == nil {
+		return
+	}
+	report := c.metrics.GenerateReport()
+	if err := c.reportUploader.UploadReport(context.WithoutCancel(ctx), c.cfg.ReportS3URI, report); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to upload report of the failed restore: %v\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Report of the failed restore uploaded to %s\n", c.cfg.ReportS3URI)
+}
+
+// abortCause returns the corrupt line limit error that aborted ctx, or ctx.Err().
+func abortCause(ctx context.Context) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrCorruptLimit) {
+		return cause
+	}
+	return ctx.Err()
+}
+
+// handleCorrupt applies the OnCorrupt policy to a line at offset of file that
+// failed to decode with cause.
+func (c *Coordinator) handleCorrupt(ctx context.Context, file string, offset int64, line []byte, cause error) error {
+	c.metrics.RecordCorruptLine(file, offset, cause)
+	switch c.cfg.OnCorrupt {
+	case "abort":
+		return fmt.Errorf("%w: line at %s@%d: %w", ErrCorruptLimit, file, offset, cause)
+	case "dead-letter":
+		if c.deadLetter == nil {
+			return fmt.Errorf("corrupt line at %s@%d cannot be dead-lettered: no dead-letter sink", file, offset)
+		}
+		if err := c.deadLetter.Write(ctx, deadletter.NewCorruptRecord(file, offset, line, cause)); err != nil {
+			return fmt.Errorf("failed to dead-letter corrupt line at %s@%d: %w", file, offset, err)
+		}
+		c.metrics.RecordDeadLettered(file)
+	}
+	return c.checkCorruptLimit(minCorruptSample)
+}
+
+// checkCorruptLimit returns ErrCorruptLimit if more than MaxCorruptPercent of
+// the lines seen are corrupt, once at least minLines lines have been seen.
+func (c *Coordinator) checkCorruptLimit(minLines int64) error {
+	if c.cfg.MaxCorruptPercent <= 0 {
+		return nil
+	}
+	corrupt, total := c.metrics.CorruptLines()
+	if total == 0 || total < minLines {
+		return nil
+	}
+	if percent := float64(corrupt) * 100 / float64(total); percent > c.cfg.MaxCorruptPercent {
+		return fmt.Errorf("%w: %d of %d lines (%.2f%%) are corrupt, above the limit of %g%%",
+			ErrCorruptLimit, corrupt, total, percent, c.cfg.MaxCorruptPercent)
+	}
+	return nil
+}
+
+// Report returns the metrics report for the restore so far. After Run returns it
+// reflects the final (or, on failure, partial) state.
+// Example:
+//
+//	err := coord.Run(ctx)
+//	report := coord.Report()
+func (c *Coordinator) Report() metrics.Report {
+	return c.metrics.GenerateReport()
+}
+
+// newEvent creates an event of type t stamped with the coordinator's clock.
+func (c *Coordinator) newEvent(t metrics.EventType) metrics.Event {
+	ev := metrics.NewEvent(t)
+	ev.Time = c.clock.Now().UTC()
+	return ev
+}
+
 // initWorker initializes a worker's status tracking as required by section 5
 func (c *Coordinator) initWorker(id int) {
 	c.statusMu.Lock()
 	defer c.statusMu.Unlock()
 	c.workerStatus[id] = &WorkerStatus{
 		ID:        id,
-		StartTime: time.Now(),
+		StartTime: c.clock.Now(),
 	}
 }
 
@@ -224,33 +659,66 @@ func (c *Coordinator) updateWorkerStatus(id int, fn func(*WorkerStatus)) {
 	defer c.statusMu.Unlock()
 	if status, ok := c.workerStatus[id]; ok {
 		fn(status)
-		status.LastActive = time.Now()
+		status.LastActive = c.clock.Now()
 	}
 }
 
 // reportProgress implements the progress reporting requirements from section 5.
 // It periodically reports progress to stdout.
+//
+// Each report includes the share of the interval every throttled worker spent
+// backing off, which shows when the table's capacity rather than the tool
+// limits the restore.
 func (c *Coordinator) reportProgress(ctx context.Context) {
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := c.clock.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
+	lastTick := c.clock.Now()
+	lastBackoff := make(map[int]time.Duration)
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
+			now := c.clock.Now()
+			interval := now.Sub(lastTick)
+			lastTick = now
 			c.statusMu.RLock()
 			var totalItems, totalBatches int64
 			activeWorkers := 0
-			for _, status := range c.workerStatus {
-				if time.Since(status.LastActive) < 10*time.Second {
+			var throttled map[int]float64
+			for id, status := range c.workerStatus {
+				if now.Sub(status.LastActive) < 10*time.Second {
 					activeWorkers++
 				}
 				totalItems += status.ItemsWritten
 				totalBatches += status.BatchesCount
+				if status.backoff == nil {
+					continue
+				}
+				backoff := status.backoff.Total()
+				if d := backoff - lastBackoff[id]; d > 0 && interval > 0 {
+					if throttled == nil {
+						throttled = make(map[int]float64)
+					}
+					throttled[id] = min(float64(d)/float64(interval), 1)
+				}
+				lastBackoff[id] = backoff
 			}
 			c.statusMu.RUnlock()
 
+			if c.events != nil {
+				ev := c.newEvent(metrics.EventProgress)
+				ev.ItemsWritten = totalItems
+				ev.Batches = totalBatches
+				ev.ActiveWorkers = activeWorkers
+				ev.Throttled = throttled
+				c.events.Emit(ev)
+				continue
+			}
 			fmt.Printf("Progress: %d items written in %d batches (%d active workers)\n",
 				totalItems, totalBatches, activeWorkers)
+			for _, id := range slices.Sorted(maps.Keys(throttled)) {
+				fmt.Printf("  worker %d: %.0f%% time throttled\n", id, 100*throttled[id])
+			}
 
 		case <-ctx.Done():
 			return
@@ -258,150 +726,500 @@ func (c *Coordinator) reportProgress(ctx context.Context) {
 	}
 }
 
+// watchStalls cancels the current file attempt of any worker that has shown no
+// activity for StallTimeout, e.g. because an S3 read hangs. The worker then
+// restarts the file from its last checkpoint.
+func (c *Coordinator) watchStalls(ctx context.Context) {
+	ticker := c.clock.NewTicker(c.cfg.StallTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			if !c.isPaused() {
+				c.cancelStalled()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// cancelStalled cancels every busy worker whose LastActive is older than StallTimeout.
+func (c *Coordinator) cancelStalled() {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	for _, status := range c.workerStatus {
+		if status.cancel == nil {
+			continue
+		}
+		idle := c.clock.Now().Sub(status.LastActive)
+		if idle < c.cfg.StallTimeout {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Warning: worker %d stalled for %s on %s at offset %d; restarting the file\n",
+			status.ID, idle.Round(time.Second), status.CurrentFile, status.CurrentOffset)
+		c.metrics.RecordStall()
+		status.cancel(errStalled)
+		status.cancel = nil
+	}
+}
+
 // checkpointInterval controls how often checkpoints are saved (every N batches).
 // This balances durability (frequent saves) with performance (fewer S3 API calls).
+// With cfg.CheckpointEvery a worker also saves once that much time has passed.
 const checkpointInterval = 100
 
+// nextCheckpointDue returns when a worker that just saved a checkpoint is due
+// to save the next one by time: after cfg.CheckpointEvery less up to a fifth
+// of it at random, so workers that started together spread their saves instead
+// of writing to S3 at once. It is zero without an interval.
+func (c *Coordinator) nextCheckpointDue() time.Time {
+	d := c.cfg.CheckpointEvery
+	if d <= 0 {
+		return time.Time{}
+	}
+	return c.clock.Now().Add(d - time.Duration(rand.Int64N(int64(d/5)+1)))
+}
+
 // completedFileOffset is a sentinel value indicating a file has been fully processed.
 // Using -1 distinguishes "completed" from "start at offset 0".
-const completedFileOffset = int64(-1)
+const completedFileOffset = checkpoint.CompletedOffset
+
+// decodeBatchLines is how many raw lines a worker accumulates before decoding
+// them with a single DecodeBatch call.
+const decodeBatchLines = 64
+
+// lineBatch accumulates raw lines for batch decoding. Streamed lines are only
+// valid during the callback, so they are copied into one reused buffer rather
+// than allocated individually.
+type lineBatch struct {
+	data    []byte   // Concatenated line bytes
+	ends    []int    // End of each line in data
+	offsets []int64  // Stream offset just past each line
+	lines   [][]byte // Views into data, rebuilt by views
+}
+
+// add copies line into the batch.
+func (b *lineBatch) add(line []byte, offset int64) {
+	b.data = append(b.data, line...)
+	b.ends = append(b.ends, len(b.data))
+	b.offsets = append(b.offsets, offset)
+}
+
+// len returns the number of accumulated lines.
+func (b *lineBatch) len() int {
+	return len(b.ends)
+}
+
+// views returns the accumulated lines. They alias the batch buffer and are
+// valid until the next reset.
+func (b *lineBatch) views() [][]byte {
+	b.lines = b.lines[:0]
+	start := 0
+	for _, end := range b.ends {
+		b.lines = append(b.lines, b.data[start:end:end])
+		start = end
+	}
+	return b.lines
+}
+
+// reset empties the batch, keeping its buffers for reuse.
+func (b *lineBatch) reset() {
+	b.data = b.data[:0]
+	b.ends = b.ends[:0]
+	b.offsets = b.offsets[:0]
+}
 
 // worker implements the worker pool pattern from section 5.
 // It processes files from the task channel, handling batching,
 // checkpointing, and error reporting.
 //
 // HOT PATH: Core processing loop that orchestrates the data pipeline.
-// Each worker runs: Stream S3 -> Decode JSON -> Batch -> Write DynamoDB
+// Each worker runs: Stream S3 -> Accumulate lines -> Decode JSON -> Transform -> Batch -> Write DynamoDB
 //
 // The main performance bottlenecks in order are:
-//  1. JSON decoding in parser.Decode (~27% CPU, ~99% memory)
+//  1. JSON decoding in parser.DecodeBatch (~27% CPU, ~99% memory)
 //  2. Network I/O to S3 and DynamoDB
 //  3. Checkpoint saves (mitigated by batching every checkpointInterval batches)
 //
-// Concurrency is controlled by c.cfg.MaxWorkers.
+// Concurrency is controlled by c.cfg.MaxWorkers. With a memory budget, read-ahead
+// and batches shrink as the budget fills, and a worker waits for room before
+// taking the next file.
 func (c *Coordinator) worker(ctx context.Context, id int, tasks <-chan manifest.FileMeta) error {
 	batch := make([]itemimage.Operation, 0, c.cfg.BatchSize)
+	pending := &lineBatch{}
 	const maxRetries = 3
+	lease := &memoryLease{budget: c.memory, file: fileBufferBytes(c.cfg.ReadAheadParts)}
+	defer lease.release()
+	var batchBytes int64 // Approximate size of the decoded operations in batch
+
+	// Reads and writes of this worker use its own connection pool when the AWS
+	// HTTP client is sharded, so one slow response cannot stall every worker
+	ctx = aws.WithShard(ctx, id)
+
+	// Time the worker's writes back off is reported live and in the report
+	backoff := &writer.BackoffTimer{}
+	ctx = writer.WithBackoffTimer(ctx, backoff)
+	c.updateWorkerStatus(id, func(s *WorkerStatus) {
+		s.backoff = backoff
+	})
+	started := c.clock.Now()
+	defer func() {
+		c.metrics.RecordBackoff(id, backoff.Total(), c.clock.Now().Sub(started))
+	}()
 
 	// Use the bucket from the config
 	bucket := c.cfg.GetExportBucketName()
 
-	for file := range tasks {
+	var checkpointsSeen int64
+	checkpointDue := c.nextCheckpointDue()
+	for {
+		lease.release() // The previous file's buffers are no longer in use
+		// Honour a lowered worker count and a pause before taking the next file
+		if c.pool != nil && c.pool.shouldRetire() {
+			return errRetired
+		}
+		if err := c.waitIfPaused(ctx, id); err != nil {
+			return err
+		}
+		if err := lease.reserve(ctx); err != nil {
+			return err
+		}
+		file, ok := <-tasks
+		if !ok {
+			return nil
+		}
+
 		c.updateWorkerStatus(id, func(s *WorkerStatus) {
 			s.CurrentFile = file.Key
 		})
 
-		// Load checkpoint for this file - fail fast on persistent errors
-		state, err := c.store.Load(ctx)
-		if err != nil {
-			c.recordError(id, err)
-			return fmt.Errorf("failed to load checkpoint for file %s: %w", file.Key, err)
+		// Determine starting offset. Checkpoints store the offset just past the last
+		// written line, and offset advances the same way after every written batch
+		// so a retry resumes at the last batch boundary instead of the file start.
+		offset, ok := c.progress.resumeAt(file.Key)
+		if !ok {
+			c.requeue.finish()
+			continue
 		}
 
-		// Determine starting offset
-		offset := int64(0)
-		if file.Key == state.LastFile {
-			// If file was completed (sentinel value), skip it entirely
-			if state.LastByteOffset == completedFileOffset {
-				continue
-			}
-			offset = state.LastByteOffset
+		// fail records why the file failed for the report before returning err
+		fail := func(err error) error {
+			c.metrics.RecordFileFailed(file.Key, err)
+			c.requeue.finish()
+			return err
+		}
+
+		// Per-target offset just past the last line written, so a retried batch
+		// is only sent to the targets that did not write it
+		written := make([]int64, len(c.targets))
+		for i := range written {
+			written[i] = offset
 		}
 
 		// Track current byte offset and batch count for checkpointing
 		var currentOffset int64
 		var batchesSinceCheckpoint int
 
-		// Stream and process the file with retries
+		// attemptCtx is cancelled by the stall watchdog; it is replaced on every attempt
+		attemptCtx := ctx
+
+		// handleOp transforms a decoded operation and adds it to the write batch.
+		// nextOffset is the stream offset just past the line it was decoded from.
+		handleOp := func(op itemimage.Operation, nextOffset int64, lineBytes int) error {
+			if c.transformer != nil {
+				var keep bool
+				var err error
+				op, keep, err = c.transformer.Transform(op)
+				if err != nil {
+					c.metrics.RecordError()
+					return inStage(CategoryTransform, fmt.Errorf("failed to transform record: %w", err))
+				}
+				if !keep {
+					c.metrics.RecordSkipped()
+					return nil
+				}
+			}
+
+			batch = append(batch, op)
+			batchBytes += int64(lineBytes) * decodedBytesFactor
+			c.metrics.RecordProcessed()
+
+			if len(batch) >= c.memory.scale(c.cfg.BatchSize) {
+				if err := c.waitIfPaused(attemptCtx, id); err != nil {
+					return err
+				}
+				batchesSinceCheckpoint++
+				shouldCheckpoint := batchesSinceCheckpoint >= checkpointInterval ||
+					(!checkpointDue.IsZero() && !c.clock.Now().Before(checkpointDue))
+				if err := c.writeBatch(attemptCtx, id, batch, file, written, nextOffset, shouldCheckpoint); err != nil {
+					return err
+				}
+				if shouldCheckpoint {
+					batchesSinceCheckpoint = 0
+					checkpointDue = c.nextCheckpointDue()
+				}
+				batch = batch[:0]
+				batchBytes = 0
+				lease.set(int64(len(pending.data)))
+				offset = nextOffset
+			}
+			return nil
+		}
+
+		// flushPending decodes the accumulated lines in one DecodeBatch call per run
+		// of good lines. Corrupt lines are handled by the OnCorrupt policy.
+		flushPending := func() error {
+			lines := pending.views()
+			for base := 0; base < len(lines); {
+				// Decode is the main CPU/memory bottleneck (~27% CPU, ~99% memory)
+				_, span := c.tracer.StartSpan(attemptCtx, "DecodeBatch")
+				span.SetProperty("decode.lines", len(lines)-base)
+				ops, err := c.parser.DecodeBatch(lines[base:])
+				span.End() // A corrupt line is handled by policy, not a failed decode
+				for i, op := range ops {
+					// Lines end with a newline, so the line starts just past the previous one
+					n := base + i
+					op.SourceFile = file.Key
+					op.ByteOffset = pending.offsets[n] - int64(len(lines[n])) - 1
+					if err := handleOp(op, pending.offsets[n], len(lines[n])); err != nil {
+						return err
+					}
+				}
+				if err == nil {
+					break
+				}
+				if !errors.Is(err, itemimage.ErrCorrupt) {
+					c.metrics.RecordError()
+					return err
+				}
+				n := base + len(ops)
+				if err := c.handleCorrupt(attemptCtx, file.Key, pending.offsets[n]-int64(len(lines[n]))-1, lines[n], err); err != nil {
+					return err
+				}
+				base = n + 1
+			}
+			pending.reset()
+			lease.set(batchBytes)
+			return nil
+		}
+
+		// checkpointNow writes everything read so far and saves a checkpoint at currentOffset
+		checkpointNow := func() error {
+			if err := flushPending(); err != nil {
+				return err
+			}
+			if len(batch) > 0 {
+				if err := c.writeBatch(attemptCtx, id, batch, file, written, currentOffset, true); err != nil {
+					return err
+				}
+				batch = batch[:0]
+				batchBytes = 0
+				lease.set(0)
+			} else if err := c.saveCheckpoint(attemptCtx, id, file.Key, currentOffset); err != nil {
+				return err
+			}
+			batchesSinceCheckpoint = 0
+			checkpointDue = c.nextCheckpointDue()
+			offset = currentOffset
+			return nil
+		}
+
+		// Stream and process the file with retries. A timed out attempt that wrote
+		// at least one batch is not counted, so a slow file keeps making progress
+		// instead of failing the run
 		var streamErr error
 		for retry := 0; retry < maxRetries; retry++ {
-			if retry > 0 {
+			// A stalled or timed out attempt is restarted at once; backoff is for service errors
+			if retry > 0 && !isTimeout(streamErr) {
 				select {
-				case <-time.After(time.Duration(1<<uint(retry)) * time.Second):
+				case <-c.clock.After(time.Duration(1<<uint(retry)) * c.retryBackoff):
 				case <-ctx.Done():
-					return ctx.Err()
+					return fail(ctx.Err())
 				}
 			}
 
+			var cancelAttempt context.CancelCauseFunc
+			attemptCtx, cancelAttempt = context.WithCancelCause(ctx)
+			c.updateWorkerStatus(id, func(s *WorkerStatus) {
+				s.cancel = cancelAttempt
+			})
+			cancelTimeout := context.CancelFunc(func() {})
+			if c.cfg.FileTimeout > 0 {
+				attemptCtx, cancelTimeout = context.WithTimeoutCause(attemptCtx, c.cfg.FileTimeout, errFileTimeout)
+			}
+			attemptOffset := offset
+			var fileSpan tracing.Span
+			attemptCtx, fileSpan = c.tracer.StartSpan(attemptCtx, "StreamFile")
+			fileSpan.SetProperty("file.key", file.Key)
+			fileSpan.SetProperty("file.offset", offset)
+			fileSpan.SetProperty("file.attempt", retry+1)
+
+			// Lines decoded but not written by a failed attempt are streamed again
+			// from offset, so drop them rather than write them twice
+			pending.reset()
+			batch = batch[:0]
+			batchBytes = 0
+			lease.set(0)
+
 			// HOT PATH: Inner loop - callback invoked for every JSON line from S3
-			streamErr = c.streamer.Stream(ctx, bucket, file.Key, offset, func(line []byte, byteOffset int64) error {
-				// Track the current position for checkpoint saves
-				currentOffset = byteOffset
+			linesSeen := 0
+			streamErr = c.streamer.Stream(attemptCtx, bucket, file.Key, offset, func(line []byte, byteOffset int64) error {
+				// Track the position after this line for checkpoint saves
+				currentOffset = byteOffset + int64(len(line)) + 1
 
-				// Decode is the main CPU/memory bottleneck (~27% CPU, ~99% memory)
-				op, err := c.parser.Decode(line)
-				if err == itemimage.ErrCorrupt {
-					c.metrics.RecordCorrupt()
-					return nil
-				}
-				if err != nil {
-					c.metrics.RecordError()
-					return err
+				// Heartbeat for the stall watchdog, including for lines that are filtered out
+				linesSeen++
+				if linesSeen%decodeBatchLines == 0 {
+					c.updateWorkerStatus(id, func(s *WorkerStatus) {
+						s.CurrentOffset = byteOffset
+					})
 				}
 
-				batch = append(batch, op)
-				c.metrics.RecordProcessed()
+				// Cheap byte-level rejection before the expensive decode
+				if c.lineFilter != nil && !c.lineFilter.Keep(line) {
+					c.metrics.RecordSkipped()
+					return nil
+				}
 
-				if len(batch) >= c.cfg.BatchSize {
-					batchesSinceCheckpoint++
-					shouldCheckpoint := batchesSinceCheckpoint >= checkpointInterval
-					if err := c.writeBatch(ctx, id, batch, file, currentOffset, shouldCheckpoint); err != nil {
+				pending.add(line, currentOffset)
+				lease.set(int64(len(pending.data)) + batchBytes)
+				if pending.len() >= c.memory.scale(decodeBatchLines) {
+					if err := flushPending(); err != nil {
 						return err
 					}
-					if shouldCheckpoint {
-						batchesSinceCheckpoint = 0
-					}
-					batch = batch[:0]
 				}
 
+				// Checkpoint immediately if requested through RequestCheckpoint
+				if requests := c.checkpointRequests.Load(); requests != checkpointsSeen {
+					checkpointsSeen = requests
+					return checkpointNow()
+				}
 				return nil
 			})
+			if streamErr == nil {
+				streamErr = flushPending()
+			}
+
+			// Write any remaining items with checkpoint, within the attempt so a
+			// failed or timed out write is retried like any other batch
+			if streamErr == nil && len(batch) > 0 {
+				streamErr = c.writeBatch(attemptCtx, id, batch, file, written, currentOffset, true)
+				if streamErr == nil {
+					batch = batch[:0]
+					batchBytes = 0
+					lease.set(0)
+				}
+			}
+			c.updateWorkerStatus(id, func(s *WorkerStatus) {
+				s.cancel = nil
+			})
+			endSpan(fileSpan, streamErr)
+			cause := context.Cause(attemptCtx)
+			cancelTimeout()
+			cancelAttempt(nil)
+			if streamErr != nil && !isTimeout(streamErr) {
+				switch {
+				case errors.Is(cause, errStalled):
+					streamErr = fmt.Errorf("%w: no progress for %s", errStalled, c.cfg.StallTimeout)
+				case errors.Is(cause, errFileTimeout):
+					streamErr = fmt.Errorf("%w: attempt took longer than %s", errFileTimeout, c.cfg.FileTimeout)
+				}
+			}
 
 			if streamErr == nil {
 				break
 			}
 
 			c.recordError(id, streamErr)
+			c.metrics.RecordErrorCategory(string(Categorize(streamErr)), streamErr)
+			if errors.Is(streamErr, ErrCorruptLimit) {
+				// Reading the file again finds the same lines
+				return fail(fmt.Errorf("failed to process file %s: %w", file.Key, streamErr))
+			}
+			if errors.Is(streamErr, stream.ErrLineTooLong) {
+				c.metrics.RecordOversizedLine()
+				return fail(fmt.Errorf("failed to process file %s: %w", file.Key, streamErr))
+			}
+			if isTimeout(streamErr) && offset > attemptOffset && ctx.Err() == nil {
+				retry--
+			}
 		}
 
 		if streamErr != nil {
-			return fmt.Errorf("failed to process file %s after %d retries: %w",
-				file.Key, maxRetries, streamErr)
+			err := fmt.Errorf("failed to process file %s after %d retries: %w", file.Key, maxRetries, streamErr)
+			// Another worker may restore the file; it resumes from its last checkpoint
+			if ctx.Err() == nil && c.requeue.push(file) {
+				c.metrics.RecordFileRequeued(file.Key, err)
+				fmt.Fprintf(os.Stderr, "Warning: %v; requeued\n", err)
+				continue
+			}
+			return fail(err)
 		}
 
-		// Write any remaining items with checkpoint
-		if len(batch) > 0 {
-			if err := c.writeBatch(ctx, id, batch, file, currentOffset, true); err != nil {
-				return err
+		// Save final checkpoint marking file as complete using sentinel value. The
+		// file is written, so a failed save is retried alone rather than with it
+		var saveErr error
+		for retry := 0; retry < maxRetries; retry++ {
+			if retry > 0 {
+				select {
+				case <-c.clock.After(time.Duration(1<<uint(retry)) * c.retryBackoff):
+				case <-ctx.Done():
+					return fail(ctx.Err())
+				}
 			}
-			batch = batch[:0]
+			if saveErr = c.progress.save(ctx, file.Key, completedFileOffset, c.clock.Now()); saveErr == nil {
+				break
+			}
+			saveErr = inStage(CategoryCheckpoint, saveErr)
+			c.recordError(id, saveErr)
+			c.metrics.RecordErrorCategory(string(CategoryCheckpoint), saveErr)
 		}
-
-		// Save final checkpoint marking file as complete using sentinel value
-		if err := c.store.Save(ctx, checkpoint.State{
-			ExportID:       file.Key,
-			LastFile:       file.Key,
-			LastByteOffset: completedFileOffset,
-		}); err != nil {
-			c.recordError(id, err)
-			return fmt.Errorf("failed to save completion checkpoint for file %s: %w", file.Key, err)
+		if saveErr != nil {
+			return fail(fmt.Errorf("failed to save completion checkpoint for file %s: %w", file.Key, saveErr))
+		}
+		c.metrics.RecordFileComplete(file.Key)
+		if c.priority.complete(file.Key) {
+			c.metrics.RecordPriorityComplete(c.clock.Now())
 		}
+		c.emitCheckpoint(id, file.Key, completedFileOffset)
+		c.emitFileComplete(id, file.Key)
+		c.requeue.finish()
 	}
-
-	return nil
 }
 
-// writeBatch writes a batch of operations with metrics.
+// writeBatch writes a batch of operations to every target with metrics. written
+// and offset are passed to writeTargets.
 // If shouldCheckpoint is true, saves progress to checkpoint store.
 func (c *Coordinator) writeBatch(ctx context.Context, id int, batch []itemimage.Operation,
-	file manifest.FileMeta, offset int64, shouldCheckpoint bool) error {
-	start := time.Now()
-	if err := c.writer.WriteBatch(ctx, batch); err != nil {
-		c.recordError(id, err)
+	file manifest.FileMeta, written []int64, offset int64, shouldCheckpoint bool) error {
+	if err := c.pace(ctx, id, batch); err != nil {
 		return err
 	}
-	c.metrics.RecordProcessingTime(time.Since(start))
+	start := c.clock.Now()
+	writeCtx := ctx
+	if c.cfg.BatchTimeout > 0 {
+		var cancel context.CancelFunc
+		writeCtx, cancel = context.WithTimeoutCause(ctx, c.cfg.BatchTimeout, errBatchTimeout)
+		defer cancel()
+	}
+	writeCtx, span := c.tracer.StartSpan(writeCtx, "WriteBatch")
+	span.SetProperty("batch.items", len(batch))
+	err := c.writeTargets(writeCtx, batch, written, offset)
+	endSpan(span, err)
+	if err != nil {
+		if ctx.Err() == nil && errors.Is(context.Cause(writeCtx), errBatchTimeout) {
+			err = fmt.Errorf("%w: write took longer than %s: %w", errBatchTimeout, c.cfg.BatchTimeout, err)
+		}
+		c.recordError(id, err)
+		return inStage(CategoryWrite, err)
+	}
+	c.metrics.RecordProcessingTime(c.clock.Now().Sub(start))
 	c.metrics.RecordBatchWritten()
+	if c.prefixAttr != "" {
+		c.metrics.RecordKeyPrefixes(c.countKeyPrefixes(batch))
+	}
 
 	c.updateWorkerStatus(id, func(s *WorkerStatus) {
 		s.ItemsWritten += int64(len(batch))
@@ -410,24 +1228,94 @@ func (c *Coordinator) writeBatch(ctx context.Context, id int, batch []itemimage.
 
 	// Only save checkpoint at intervals to reduce S3 API calls
 	if shouldCheckpoint {
-		if err := c.store.Save(ctx, checkpoint.State{
-			ExportID:       file.Key,
-			LastFile:       file.Key,
-			LastByteOffset: offset,
-		}); err != nil {
-			c.recordError(id, err)
-			return err
+		return c.saveCheckpoint(ctx, id, file.Key, offset)
+	}
+
+	return nil
+}
+
+// countKeyPrefixes counts the items batch writes per partition key prefix.
+// Deletes write no item and are left out; keys that are neither strings nor
+// numbers are counted under an empty prefix.
+func (c *Coordinator) countKeyPrefixes(batch []itemimage.Operation) map[string]int64 {
+	counts := make(map[string]int64)
+	for _, op := range batch {
+		if op.Type == itemimage.OpDelete {
+			continue
+		}
+		key, ok := op.Keys[c.prefixAttr]
+		if !ok {
+			key = op.NewImage[c.prefixAttr]
 		}
+		var value string
+		switch v := key.(type) {
+		case *types.AttributeValueMemberS:
+			value = v.Value
+		case *types.AttributeValueMemberN:
+			value = v.Value
+		}
+		prefix, _, _ := strings.Cut(value, c.prefixDelim)
+		counts[prefix]++
 	}
+	return counts
+}
 
+// saveCheckpoint records that file has been written up to offset.
+func (c *Coordinator) saveCheckpoint(ctx context.Context, id int, file string, offset int64) error {
+	if err := c.progress.save(ctx, file, offset, c.clock.Now()); err != nil {
+		c.recordError(id, err)
+		return inStage(CategoryCheckpoint, err)
+	}
+	c.emitCheckpoint(id, file, offset)
 	return nil
 }
 
+// endSpan ends span with an error status if err is set.
+func endSpan(span tracing.Span, err error) {
+	if err != nil {
+		span.SetStatus(tracing.SpanStatusError)
+		span.SetProperty("error", err.Error())
+	}
+	span.End()
+}
+
 // recordError records a worker error
 func (c *Coordinator) recordError(id int, err error) {
 	c.metrics.RecordError()
+	var file string
 	c.updateWorkerStatus(id, func(s *WorkerStatus) {
 		s.LastError = err
-		s.LastErrorTime = time.Now()
+		s.LastErrorTime = c.clock.Now()
+		file = s.CurrentFile
 	})
+	if c.events != nil {
+		ev := c.newEvent(metrics.EventError)
+		ev.Worker = &id
+		ev.File = file
+		ev.Error = err.Error()
+		c.events.Emit(ev)
+	}
+}
+
+// emitFileComplete emits a file completion event, if events are enabled.
+func (c *Coordinator) emitFileComplete(id int, file string) {
+	if c.events == nil {
+		return
+	}
+	ev := c.newEvent(metrics.EventFileComplete)
+	ev.Worker = &id
+	ev.File = file
+	c.events.Emit(ev)
+}
+
+// emitCheckpoint emits a checkpoint event, if events are enabled.
+func (c *Coordinator) emitCheckpoint(id int, file string, offset int64) {
+	if c.events == nil {
+		return
+	}
+	ev := c.newEvent(metrics.EventCheckpoint)
+	ev.Worker = &id
+	ev.File = file
+	ev.Offset = &offset
+	c.events.Emit(ev)
 }
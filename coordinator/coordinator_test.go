@@ -2,14 +2,31 @@ package coordinator
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/buildinfo"
 	"github.com/gurre/ddb-pitr/checkpoint"
+	"github.com/gurre/ddb-pitr/clock"
 	"github.com/gurre/ddb-pitr/config"
+	"github.com/gurre/ddb-pitr/deadletter"
 	"github.com/gurre/ddb-pitr/itemimage"
 	"github.com/gurre/ddb-pitr/manifest"
+	"github.com/gurre/ddb-pitr/metrics"
+	"github.com/gurre/ddb-pitr/stream"
+	"github.com/gurre/ddb-pitr/trace"
+	"github.com/gurre/ddb-pitr/transform"
+	"github.com/gurre/ddb-pitr/writer"
 )
 
 type mockLoader struct {
@@ -20,6 +37,22 @@ func (m *mockLoader) Load(ctx context.Context, manifestS3URI string) (manifest.S
 	return m.summary, nil
 }
 
+func (m *mockLoader) LoadSummary(ctx context.Context, manifestS3URI string) (manifest.Summary, error) {
+	summary := m.summary
+	summary.DataFiles = nil
+	return summary, nil
+}
+
+func (m *mockLoader) Files(ctx context.Context, summary manifest.Summary) iter.Seq2[manifest.FileMeta, error] {
+	return func(yield func(manifest.FileMeta, error) bool) {
+		for _, file := range m.summary.DataFiles {
+			if !yield(file, nil) {
+				return
+			}
+		}
+	}
+}
+
 func (m *mockLoader) VerifyChecksums(ctx context.Context, summary manifest.Summary) error {
 	return nil
 }
@@ -52,6 +85,15 @@ func (m *mockDecoder) Decode(line []byte) (itemimage.Operation, error) {
 	}, nil
 }
 
+func (m *mockDecoder) DecodeBatch(lines [][]byte) ([]itemimage.Operation, error) {
+	ops := make([]itemimage.Operation, 0, len(lines))
+	for _, line := range lines {
+		op, _ := m.Decode(line)
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
 type mockWriter struct {
 	batches [][]itemimage.Operation
 }
@@ -135,3 +177,1925 @@ func TestCoordinatorHappyPath(t *testing.T) {
 		t.Errorf("expected 2 operations in batch, got %d", len(writer.batches[0]))
 	}
 }
+
+// TestCoordinatorAppliesTransformer verifies that the transformer runs between
+// decode and write, and that dropped operations are not written.
+func TestCoordinatorAppliesTransformer(t *testing.T) {
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket:  "test-bucket",
+			DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: 3}},
+		},
+	}
+	streamer := &mockStreamer{data: [][]byte{[]byte(`{}`), []byte(`{}`), []byte(`{}`)}}
+	writer := &mockWriter{}
+
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       10,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	// Rename every item and drop every second one
+	calls := 0
+	transformer := transform.Func(func(op itemimage.Operation) (itemimage.Operation, bool, error) {
+		calls++
+		op.NewImage["name"] = &types.AttributeValueMemberS{Value: "redacted"}
+		return op, calls%2 == 1, nil
+	})
+
+	coord := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, writer, &mockStore{}, nil, WithTransformer(transformer))
+	if err := coord.Run(context.Background()); err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+
+	if len(writer.batches) != 1 || len(writer.batches[0]) != 2 {
+		t.Fatalf("expected one batch of 2 operations, got %v", writer.batches)
+	}
+	for _, op := range writer.batches[0] {
+		if name := op.NewImage["name"].(*types.AttributeValueMemberS).Value; name != "redacted" {
+			t.Errorf("expected transformed name, got %q", name)
+		}
+	}
+	if report := coord.metrics.GenerateReport(); report.SkippedCount != 1 {
+		t.Errorf("expected 1 skipped item, got %d", report.SkippedCount)
+	}
+}
+
+// recordingEmitter collects emitted events for assertions.
+type recordingEmitter struct {
+	events []metrics.Event
+	mu     sync.Mutex
+}
+
+func (r *recordingEmitter) Emit(ev metrics.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, ev)
+}
+
+// TestCoordinatorEmitsEvents verifies the event sequence for a single file:
+// a checkpoint for the final batch, a completion checkpoint, file completion and
+// the final report.
+func TestCoordinatorEmitsEvents(t *testing.T) {
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket:  "test-bucket",
+			DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: 2}},
+		},
+	}
+	streamer := &mockStreamer{data: [][]byte{[]byte(`{}`), []byte(`{}`)}}
+
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       10,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	emitter := &recordingEmitter{}
+	coord := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, &mockWriter{}, &mockStore{}, nil, WithEventEmitter(emitter))
+	if err := coord.Run(context.Background()); err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+
+	var types []metrics.EventType
+	for _, ev := range emitter.events {
+		if ev.Type != metrics.EventProgress {
+			types = append(types, ev.Type)
+		}
+	}
+	want := []metrics.EventType{metrics.EventCheckpoint, metrics.EventCheckpoint, metrics.EventFileComplete, metrics.EventComplete}
+	if len(types) != len(want) {
+		t.Fatalf("expected events %v, got %v", want, types)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Errorf("event %d = %s, want %s", i, types[i], want[i])
+		}
+	}
+
+	last := emitter.events[len(emitter.events)-1]
+	if last.Report == nil || last.Report.TotalItems != 2 {
+		t.Errorf("expected final report with 2 items, got %+v", last.Report)
+	}
+	if off := emitter.events[1].Offset; off == nil || *off != -1 {
+		t.Errorf("expected completion checkpoint offset -1, got %v", off)
+	}
+}
+
+// TestCoordinatorBatchDecodeSkipsCorruptLines verifies that lines accumulated for
+// DecodeBatch are all written, across more than one decode batch, and that a
+// corrupt line in the middle of a batch is counted without losing the lines after it.
+func TestCoordinatorBatchDecodeSkipsCorruptLines(t *testing.T) {
+	var data [][]byte
+	for i := 0; i < decodeBatchLines+10; i++ {
+		if i == 3 || i == decodeBatchLines+1 {
+			data = append(data, []byte(`{"Item":`))
+			continue
+		}
+		data = append(data, []byte(fmt.Sprintf(`{"Item":{"id":{"S":"%d"}}}`, i)))
+	}
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket:  "test-bucket",
+			DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: int64(len(data))}},
+		},
+	}
+	writer := &mockWriter{}
+
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       25,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	coord := NewCoordinator(cfg, loader, &mockStreamer{data: data}, itemimage.NewJSONDecoder(), writer, &mockStore{}, nil)
+	if err := coord.Run(context.Background()); err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+
+	written := 0
+	for _, b := range writer.batches {
+		written += len(b)
+	}
+	if want := len(data) - 2; written != want {
+		t.Errorf("expected %d written operations, got %d", want, written)
+	}
+	if report := coord.Report(); report.CorruptCount != 2 {
+		t.Errorf("expected 2 corrupt lines, got %d", report.CorruptCount)
+	}
+}
+
+// TestCoordinatorCorruptPolicy checks each OnCorrupt policy and the corrupt
+// percentage limit against an export with 2 corrupt lines out of 74.
+func TestCoordinatorCorruptPolicy(t *testing.T) {
+	var data [][]byte
+	for i := 0; i < decodeBatchLines+10; i++ {
+		if i == 3 || i == decodeBatchLines+1 {
+			data = append(data, []byte(`{"Item":`))
+			continue
+		}
+		data = append(data, []byte(fmt.Sprintf(`{"Item":{"id":{"S":"%d"}}}`, i)))
+	}
+
+	tests := []struct {
+		name       string
+		onCorrupt  string
+		maxPercent float64
+		wantErr    bool // Run fails with ErrCorruptLimit
+		deadLetter int  // Corrupt lines expected in the dead-letter sink
+	}{
+		{name: "skip", onCorrupt: "skip"},
+		{name: "abort", onCorrupt: "abort", wantErr: true},
+		{name: "dead-letter", onCorrupt: "dead-letter", deadLetter: 2},
+		{name: "under limit", maxPercent: 5},
+		{name: "over limit", maxPercent: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				TableName:         "test-table",
+				ExportS3URI:       "s3://test-bucket/test-prefix",
+				ExportType:        "FULL",
+				ViewType:          "NEW",
+				Region:            "us-west-2",
+				MaxWorkers:        1,
+				BatchSize:         25,
+				ShutdownTimeout:   time.Second,
+				OnCorrupt:         tt.onCorrupt,
+				MaxCorruptPercent: tt.maxPercent,
+			}
+			if tt.onCorrupt == "dead-letter" {
+				cfg.DeadLetterURI = "file:///unused.jsonl"
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("failed to validate config: %v", err)
+			}
+			loader := &mockLoader{
+				summary: manifest.Summary{
+					S3Bucket:  "test-bucket",
+					DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: int64(len(data))}},
+				},
+			}
+			sink := deadletter.NewMemorySink()
+			coord := NewCoordinator(cfg, loader, &mockStreamer{data: data}, itemimage.NewJSONDecoder(), &mockWriter{}, &mockStore{}, nil,
+				WithDeadLetter(sink))
+
+			err := coord.Run(context.Background())
+			if tt.wantErr != errors.Is(err, ErrCorruptLimit) {
+				t.Fatalf("Run error = %v, want ErrCorruptLimit: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("coordinator failed: %v", err)
+			}
+			records := sink.Records()
+			if len(records) != tt.deadLetter {
+				t.Fatalf("got %d dead-letter records, want %d", len(records), tt.deadLetter)
+			}
+			for _, rec := range records {
+				if rec.Operation != "CORRUPT" || rec.Line != `{"Item":` || rec.SourceFile != "file1" {
+					t.Errorf("unexpected dead-letter record: %+v", rec)
+				}
+			}
+		})
+	}
+}
+
+// TestCoordinatorRejectsExportTypeMismatch checks that a -type contradicting the
+// manifest fails the restore before anything is written.
+func TestCoordinatorRejectsExportTypeMismatch(t *testing.T) {
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket:       "test-bucket",
+			ExportType:     manifest.ExportTypeIncremental,
+			OutputView:     "NEW_AND_OLD_IMAGES",
+			ExportFromTime: "2026-01-14T10:20:00.000Z",
+			ExportToTime:   "2026-01-14T10:35:00.000Z",
+			DataFiles:      []manifest.FileMeta{{Key: "file1", ItemCount: 1}},
+		},
+	}
+	writer := &mockWriter{}
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       25,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	data := [][]byte{[]byte(`{"Keys":{"id":{"S":"1"}},"NewImage":{"id":{"S":"1"}}}`)}
+	coord := NewCoordinator(cfg, loader, &mockStreamer{data: data}, itemimage.NewJSONDecoder(), writer, &mockStore{}, nil)
+	err := coord.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "export type FULL does not match") {
+		t.Fatalf("Run error = %v, want an export type mismatch", err)
+	}
+	if len(writer.batches) != 0 {
+		t.Errorf("expected no writes, got %d batches", len(writer.batches))
+	}
+}
+
+// TestCoordinatorDecodesKeysOnlyByOutputView checks a record with only Keys is
+// written as a delete in a NEW_IMAGE export and counted as corrupt in a
+// NEW_AND_OLD_IMAGES one, where it is damaged, rather than deleting the item.
+func TestCoordinatorDecodesKeysOnlyByOutputView(t *testing.T) {
+	data := [][]byte{
+		[]byte(`{"Keys":{"id":{"S":"1"}},"NewImage":{"id":{"S":"1"}}}`),
+		[]byte(`{"Keys":{"id":{"S":"2"}}}`),
+	}
+	for view, want := range map[string]string{"NEW_IMAGE": "PUT DELETE", "NEW_AND_OLD_IMAGES": "PUT"} {
+		loader := &mockLoader{
+			summary: manifest.Summary{
+				S3Bucket:       "test-bucket",
+				ExportType:     manifest.ExportTypeIncremental,
+				OutputView:     view,
+				ExportFromTime: "2026-01-14T10:20:00.000Z",
+				ExportToTime:   "2026-01-14T10:35:00.000Z",
+				DataFiles:      []manifest.FileMeta{{Key: "file1", ItemCount: 2}},
+			},
+		}
+		writer := &mockWriter{}
+		cfg := &config.Config{
+			TableName:       "test-table",
+			ExportS3URI:     "s3://test-bucket/test-prefix",
+			Region:          "us-west-2",
+			MaxWorkers:      1,
+			BatchSize:       25,
+			ShutdownTimeout: time.Second,
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("failed to validate config: %v", err)
+		}
+
+		coord := NewCoordinator(cfg, loader, &mockStreamer{data: data}, itemimage.NewJSONDecoder(), writer, &mockStore{}, nil)
+		if err := coord.Run(context.Background()); err != nil {
+			t.Fatalf("%s: coordinator failed: %v", view, err)
+		}
+		var kinds []string
+		for _, b := range writer.batches {
+			for _, op := range b {
+				kinds = append(kinds, op.Type.String())
+			}
+		}
+		if got := strings.Join(kinds, " "); got != want {
+			t.Errorf("%s: wrote %q, want %q", view, got, want)
+		}
+	}
+}
+
+// hangingStreamer blocks its first Stream call until the context is cancelled,
+// simulating an S3 read that never returns, then streams data normally.
+type hangingStreamer struct {
+	mockStreamer
+	calls int
+}
+
+func (h *hangingStreamer) Stream(ctx context.Context, bucket, key string, offset int64, fn func([]byte, int64) error) error {
+	h.calls++
+	if h.calls == 1 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return h.mockStreamer.Stream(ctx, bucket, key, offset, fn)
+}
+
+// TestCoordinatorRestartsStalledWorker verifies that the watchdog cancels a hung
+// stream, the file is restarted and completed, and the stall is reported.
+func TestCoordinatorRestartsStalledWorker(t *testing.T) {
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket:  "test-bucket",
+			DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: 2}},
+		},
+	}
+	streamer := &hangingStreamer{mockStreamer: mockStreamer{data: [][]byte{[]byte(`{}`), []byte(`{}`)}}}
+	writer := &mockWriter{}
+
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       10,
+		ShutdownTimeout: time.Second,
+		StallTimeout:    40 * time.Millisecond,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	coord := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, writer, &mockStore{}, nil)
+	if err := coord.Run(context.Background()); err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+
+	if streamer.calls != 2 {
+		t.Errorf("expected the file to be streamed twice, got %d", streamer.calls)
+	}
+	if len(writer.batches) != 1 || len(writer.batches[0]) != 2 {
+		t.Errorf("expected one batch of 2 operations, got %v", writer.batches)
+	}
+	if report := coord.Report(); report.StallCount != 1 {
+		t.Errorf("expected 1 stall, got %d", report.StallCount)
+	}
+}
+
+// flakyStreamer honours resume offsets like the S3 streamer and fails its first
+// call partway through the file.
+type flakyStreamer struct {
+	data    [][]byte
+	offsets []int64 // Resume offset of each call
+	failAt  int     // Line index at which the first call fails
+}
+
+func (f *flakyStreamer) Stream(ctx context.Context, bucket, key string, offset int64, fn func([]byte, int64) error) error {
+	f.offsets = append(f.offsets, offset)
+	var pos int64
+	for i, line := range f.data {
+		lineOffset := pos
+		pos += int64(len(line)) + 1
+		if lineOffset < offset {
+			continue
+		}
+		if len(f.offsets) == 1 && i == f.failAt {
+			return fmt.Errorf("connection reset")
+		}
+		if err := fn(line, lineOffset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// oversizedStreamer fails every call like the S3 streamer does at a line over
+// its maximum line size.
+type oversizedStreamer struct {
+	calls int
+}
+
+func (o *oversizedStreamer) Stream(ctx context.Context, bucket, key string, offset int64, fn func([]byte, int64) error) error {
+	o.calls++
+	return fmt.Errorf("%w: line 1 of %s at byte 0 is longer than 10 bytes", stream.ErrLineTooLong, key)
+}
+
+// TestCoordinatorFailsOversizedLinesWithoutRetry checks a file with a line over
+// the maximum line size fails at once with its offset and is counted, since
+// reading it again finds the same line.
+func TestCoordinatorFailsOversizedLinesWithoutRetry(t *testing.T) {
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket:  "test-bucket",
+			DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: 1}},
+		},
+	}
+	streamer := &oversizedStreamer{}
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       25,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	coord := NewCoordinator(cfg, loader, streamer, itemimage.NewJSONDecoder(), &copyingWriter{}, &mockStore{}, nil)
+	coord.retryBackoff = time.Millisecond
+	err := coord.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "line 1 of file1 at byte 0") {
+		t.Fatalf("expected the error to name the line and offset, got %v", err)
+	}
+	if streamer.calls != 1 {
+		t.Errorf("expected one attempt, got %d", streamer.calls)
+	}
+	if n := coord.Report().Oversized; n != 1 {
+		t.Errorf("expected 1 oversized line in the report, got %d", n)
+	}
+}
+
+// copyingWriter records the id of every written operation. Unlike mockWriter it
+// copies, since the coordinator reuses its batch slice.
+type copyingWriter struct {
+	ids     []string
+	sources []string // SourceFile@ByteOffset of every operation
+}
+
+func (w *copyingWriter) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	for _, op := range ops {
+		w.ids = append(w.ids, op.NewImage["id"].(*types.AttributeValueMemberS).Value)
+		w.sources = append(w.sources, fmt.Sprintf("%s@%d", op.SourceFile, op.ByteOffset))
+	}
+	return nil
+}
+
+func (w *copyingWriter) Flush(ctx context.Context) error {
+	return nil
+}
+
+// TestCoordinatorRetryResumesFromLastBatch verifies that a stream failing mid-file
+// is retried from just past the last written batch, so no operation is written
+// twice or lost, and that every operation still names the line it came from.
+func TestCoordinatorRetryResumesFromLastBatch(t *testing.T) {
+	var data [][]byte
+	for i := 0; i < 150; i++ {
+		data = append(data, []byte(fmt.Sprintf(`{"Item":{"id":{"S":"%03d"}}}`, i)))
+	}
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket:  "test-bucket",
+			DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: int64(len(data))}},
+		},
+	}
+	streamer := &flakyStreamer{data: data, failAt: 100}
+	writer := &copyingWriter{}
+
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       25,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	coord := NewCoordinator(cfg, loader, streamer, itemimage.NewJSONDecoder(), writer, &mockStore{}, nil)
+	coord.retryBackoff = time.Millisecond
+	if err := coord.Run(context.Background()); err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+
+	// The first decode batch (64 lines) wrote lines 0-49; the retry starts at line 50
+	lineLen := int64(len(data[0])) + 1
+	if len(streamer.offsets) != 2 || streamer.offsets[1] != 50*lineLen {
+		t.Errorf("expected retry from offset %d, got offsets %v", 50*lineLen, streamer.offsets)
+	}
+	if len(writer.ids) != len(data) {
+		t.Fatalf("expected %d writes, got %d", len(data), len(writer.ids))
+	}
+	for i, id := range writer.ids {
+		if want := fmt.Sprintf("%03d", i); id != want {
+			t.Fatalf("write %d: expected id %s, got %s", i, want, id)
+		}
+		if want := fmt.Sprintf("file1@%d", int64(i)*lineLen); writer.sources[i] != want {
+			t.Fatalf("write %d: expected source %s, got %s", i, want, writer.sources[i])
+		}
+	}
+}
+
+// countingWriter counts written operations and is safe for concurrent workers.
+type countingWriter struct {
+	ops atomic.Int64
+}
+
+func (w *countingWriter) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	w.ops.Add(int64(len(ops)))
+	return nil
+}
+
+func (w *countingWriter) Flush(ctx context.Context) error {
+	return nil
+}
+
+// waitFor polls cond until it holds or the test times out.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestCoordinatorPauseAndResize verifies that a paused restore writes nothing,
+// that workers can be added while it runs, and that all files are written once
+// it is resumed.
+func TestCoordinatorPauseAndResize(t *testing.T) {
+	var files []manifest.FileMeta
+	for i := 0; i < 6; i++ {
+		files = append(files, manifest.FileMeta{Key: fmt.Sprintf("file%d", i), ItemCount: 2})
+	}
+	loader := &mockLoader{summary: manifest.Summary{S3Bucket: "test-bucket", DataFiles: files}}
+	streamer := &mockStreamer{data: [][]byte{[]byte(`{}`), []byte(`{}`)}}
+	writer := &countingWriter{}
+
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       10,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	coord := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, writer, &recordingStore{}, nil)
+	coord.Pause()
+	errCh := make(chan error, 1)
+	go func() { errCh <- coord.Run(context.Background()) }()
+
+	waitFor(t, "the first worker", func() bool { return coord.ControlStatus().RunningWorkers == 1 })
+	if err := coord.SetWorkers(3); err != nil {
+		t.Fatalf("SetWorkers: %v", err)
+	}
+	waitFor(t, "three workers", func() bool { return coord.ControlStatus().RunningWorkers == 3 })
+
+	time.Sleep(20 * time.Millisecond)
+	if n := writer.ops.Load(); n != 0 {
+		t.Fatalf("expected no writes while paused, got %d", n)
+	}
+	if status := coord.ControlStatus(); !status.Paused || status.TargetWorkers != 3 {
+		t.Errorf("unexpected status while paused: %+v", status)
+	}
+
+	coord.Resume()
+	if err := <-errCh; err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+	if n := writer.ops.Load(); n != 12 {
+		t.Errorf("expected 12 operations written, got %d", n)
+	}
+	if err := coord.SetWorkers(2); err == nil {
+		t.Error("expected SetWorkers to fail after the restore finished")
+	}
+	if err := coord.SetWorkers(0); err == nil {
+		t.Error("expected SetWorkers(0) to fail")
+	}
+}
+
+// requestingStreamer asks for a checkpoint after streaming its first line.
+type requestingStreamer struct {
+	data  [][]byte
+	coord *Coordinator
+}
+
+func (r *requestingStreamer) Stream(ctx context.Context, bucket, key string, offset int64, fn func([]byte, int64) error) error {
+	var pos int64
+	for i, line := range r.data {
+		if err := fn(line, pos); err != nil {
+			return err
+		}
+		pos += int64(len(line)) + 1
+		if i == 0 {
+			r.coord.RequestCheckpoint()
+		}
+	}
+	return nil
+}
+
+// recordingStore keeps every saved checkpoint and is safe for concurrent workers.
+type recordingStore struct {
+	saves []checkpoint.State
+	mu    sync.Mutex
+}
+
+func (r *recordingStore) Load(ctx context.Context) (checkpoint.State, error) {
+	return checkpoint.State{}, nil
+}
+
+func (r *recordingStore) Save(ctx context.Context, s checkpoint.State) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.saves = append(r.saves, s)
+	return nil
+}
+
+// TestCoordinatorRequestCheckpoint verifies that a requested checkpoint writes
+// the partial batch and saves the offset mid-file instead of at the file's end.
+func TestCoordinatorRequestCheckpoint(t *testing.T) {
+	data := [][]byte{[]byte(`{"a":1}`), []byte(`{"a":2}`), []byte(`{"a":3}`), []byte(`{"a":4}`)}
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket:  "test-bucket",
+			DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: int64(len(data))}},
+		},
+	}
+	streamer := &requestingStreamer{data: data}
+	writer := &mockWriter{}
+	store := &recordingStore{}
+
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       10,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	coord := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, writer, store, nil)
+	streamer.coord = coord
+	if err := coord.Run(context.Background()); err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+
+	// The request is seen on the second line, so lines 0-1 are written and saved
+	lineLen := int64(len(data[0])) + 1
+	if len(store.saves) == 0 || store.saves[0].LastByteOffset != 2*lineLen {
+		t.Fatalf("expected a checkpoint at offset %d first, got %+v", 2*lineLen, store.saves)
+	}
+	if len(writer.batches) != 2 || len(writer.batches[0]) != 2 {
+		t.Errorf("expected a partial batch of 2 then the rest, got %d batches", len(writer.batches))
+	}
+	if got := coord.ControlStatus().CheckpointRequests; got != 1 {
+		t.Errorf("expected 1 checkpoint request, got %d", got)
+	}
+}
+
+// tickingWriter advances clk by step on every write, like a slow table.
+type tickingWriter struct {
+	mockWriter
+	clk  *clock.Fake
+	step time.Duration
+}
+
+func (w *tickingWriter) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	w.clk.Advance(w.step)
+	return w.mockWriter.WriteBatch(ctx, ops)
+}
+
+// TestCoordinatorCheckpointInterval verifies a worker writing batches slowly
+// saves its checkpoint once the interval has passed, long before the batch
+// count would trigger a save.
+func TestCoordinatorCheckpointInterval(t *testing.T) {
+	var data [][]byte
+	for i := 0; i < 20; i++ {
+		data = append(data, []byte(fmt.Sprintf(`{"a":%d}`, i)))
+	}
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket:  "test-bucket",
+			DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: int64(len(data))}},
+		},
+	}
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       1,
+		ShutdownTimeout: time.Second,
+		CheckpointEvery: 30 * time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	clk := clock.NewFake(time.Unix(0, 0))
+	store := &recordingStore{}
+	w := &tickingWriter{clk: clk, step: 30 * time.Second}
+	coord := NewCoordinator(cfg, loader, &flakyStreamer{data: data, failAt: -1}, &mockDecoder{}, w, store, nil, WithClock(clk))
+	if err := coord.Run(context.Background()); err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+
+	// The checkpoint is due 24s to 30s after the last save, so every other write of 30s saves
+	if len(store.saves) < 10 {
+		t.Errorf("expected a checkpoint every other batch, got %d saves", len(store.saves))
+	}
+}
+
+// failingFileStreamer fails the first fails calls for the file failKey and
+// streams every other call like mockStreamer.
+type failingFileStreamer struct {
+	data    [][]byte
+	failKey string
+	fails   int
+
+	mu    sync.Mutex
+	calls int // Calls for failKey
+}
+
+func (f *failingFileStreamer) Stream(ctx context.Context, bucket, key string, offset int64, fn func([]byte, int64) error) error {
+	if key == f.failKey {
+		f.mu.Lock()
+		f.calls++
+		failed := f.calls <= f.fails
+		f.mu.Unlock()
+		if failed {
+			return fmt.Errorf("connection reset")
+		}
+	}
+	for i, line := range f.data {
+		if err := fn(line, int64(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestCoordinatorRequeuesFailedFiles verifies a file that fails every attempt
+// of a worker is handed to the workers again within its requeue budget, so the
+// run completes, and that a file failing beyond its budget fails the run.
+func TestCoordinatorRequeuesFailedFiles(t *testing.T) {
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket: "test-bucket",
+			DataFiles: []manifest.FileMeta{
+				{Key: "file1", ItemCount: 1},
+				{Key: "file2", ItemCount: 1},
+				{Key: "file3", ItemCount: 1},
+			},
+		},
+	}
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      2,
+		BatchSize:       25,
+		ShutdownTimeout: time.Second,
+		FileRequeues:    1,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	// Three failed attempts exhaust one worker; the requeued file then succeeds
+	streamer := &failingFileStreamer{data: [][]byte{[]byte(`{}`)}, failKey: "file2", fails: 3}
+	coord := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, &copyingWriter{}, &mockStore{}, nil)
+	coord.retryBackoff = time.Millisecond
+	if err := coord.Run(context.Background()); err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+	for _, f := range coord.Report().Files {
+		if f.Status != metrics.FileComplete {
+			t.Errorf("expected %s to complete, got %+v", f.File, f)
+		}
+		if wantRequeues := map[string]int{"file2": 1}[f.File]; f.Requeues != wantRequeues {
+			t.Errorf("expected %s to be requeued %d times, got %d", f.File, wantRequeues, f.Requeues)
+		}
+	}
+
+	// The requeued file fails again and has no budget left
+	streamer = &failingFileStreamer{data: [][]byte{[]byte(`{}`)}, failKey: "file2", fails: 6}
+	coord = NewCoordinator(cfg, loader, streamer, &mockDecoder{}, &copyingWriter{}, &mockStore{}, nil)
+	coord.retryBackoff = time.Millisecond
+	if err := coord.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "file2") {
+		t.Errorf("expected file2 to fail the run, got %v", err)
+	}
+	if streamer.calls != 6 {
+		t.Errorf("expected 6 attempts at file2, got %d", streamer.calls)
+	}
+}
+
+// TestCategorize verifies errors of file attempts are classified by the stage
+// that failed, with unmarked streamer errors counted as S3 reads and throttled
+// writes told apart from other write failures.
+func TestCategorize(t *testing.T) {
+	slowDown := "slow down"
+	throttled := &types.ProvisionedThroughputExceededException{Message: &slowDown}
+	tests := []struct {
+		err  error
+		want ErrorCategory
+	}{
+		{fmt.Errorf("connection reset"), CategoryS3Read},
+		{fmt.Errorf("file x: %w", ErrCorruptLimit), CategoryDecode},
+		{fmt.Errorf("%w: line 1", stream.ErrLineTooLong), CategoryDecode},
+		{inStage(CategoryTransform, fmt.Errorf("bad item")), CategoryTransform},
+		{inStage(CategoryWrite, fmt.Errorf("batch: %w", throttled)), CategoryThrottling},
+		{inStage(CategoryWrite, fmt.Errorf("access denied")), CategoryWrite},
+		{inStage(CategoryCheckpoint, fmt.Errorf("failed to save checkpoint")), CategoryCheckpoint},
+		{inStage(CategoryWrite, fmt.Errorf("%w: write took longer than 1s", errBatchTimeout)), CategoryTimeout},
+		{fmt.Errorf("%w: no progress for 5m", errStalled), CategoryTimeout},
+		{inStage(CategoryWrite, context.Canceled), CategoryInterrupted},
+	}
+	for _, tt := range tests {
+		if got := Categorize(tt.err); got != tt.want {
+			t.Errorf("Categorize(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+	if err := inStage(CategoryWrite, fmt.Errorf("access denied")); err.Error() != "access denied" {
+		t.Errorf("expected marking to keep the message, got %q", err)
+	}
+}
+
+// TestWorkerErrors verifies the error of failed workers counts them by
+// category, most frequent first, quotes a bounded number of each and still
+// matches each worker's error.
+func TestWorkerErrors(t *testing.T) {
+	err := &WorkerErrors{Errors: []error{
+		fmt.Errorf("worker 0 failed: %w", inStage(CategoryCheckpoint, fmt.Errorf("access denied"))),
+		fmt.Errorf("worker 1 failed: reset 1"),
+		fmt.Errorf("worker 2 failed: reset 2"),
+		fmt.Errorf("worker 3 failed: reset 3"),
+		fmt.Errorf("worker 4 failed: reset 4"),
+		fmt.Errorf("worker 5 failed: %w", ErrCorruptLimit),
+	}}
+	want := "some workers failed: 4 s3_read (worker 1 failed: reset 1; worker 2 failed: reset 2; worker 3 failed: reset 3; and 1 more), " +
+		"1 checkpoint (worker 0 failed: access denied), 1 decode (worker 5 failed: corrupt line limit exceeded)"
+	if err.Error() != want {
+		t.Errorf("unexpected message:\n got %s\nwant %s", err, want)
+	}
+	if !errors.Is(err, ErrCorruptLimit) {
+		t.Error("expected the errors of the workers to match")
+	}
+	if n := len(err.ByCategory()[CategoryS3Read]); n != 4 {
+		t.Errorf("expected 4 S3 read errors, got %d", n)
+	}
+}
+
+// TestCoordinatorReportsErrorCategories verifies a run whose workers fail
+// returns WorkerErrors and reports every failed attempt by category.
+func TestCoordinatorReportsErrorCategories(t *testing.T) {
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket:  "test-bucket",
+			DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: 1}},
+		},
+	}
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       25,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	streamer := &failingFileStreamer{data: [][]byte{[]byte(`{}`)}, failKey: "file1", fails: 3}
+	coord := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, &copyingWriter{}, &mockStore{}, nil)
+	coord.retryBackoff = time.Millisecond
+	err := coord.Run(context.Background())
+	var werr *WorkerErrors
+	if !errors.As(err, &werr) || len(werr.ByCategory()[CategoryS3Read]) != 1 {
+		t.Fatalf("expected one worker failing on an S3 read, got %v", err)
+	}
+	categories := coord.Report().ErrorCategories
+	if len(categories) != 1 || categories[0].Category != "s3_read" || categories[0].Count != 3 || categories[0].Samples[0] != "connection reset" {
+		t.Errorf("expected 3 failed S3 reads in the report, got %+v", categories)
+	}
+}
+
+// failOnceWriter fails its first WriteBatch call and records the ids it writes.
+type failOnceWriter struct {
+	copyingWriter
+	failed bool
+}
+
+func (w *failOnceWriter) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	if !w.failed {
+		w.failed = true
+		return fmt.Errorf("throttled")
+	}
+	return w.copyingWriter.WriteBatch(ctx, ops)
+}
+
+// TestCoordinatorFanOutRetriesTargetsIndependently verifies that every target
+// receives every operation exactly once when one target fails a batch: the
+// retry only goes to the target that failed.
+func TestCoordinatorFanOutRetriesTargetsIndependently(t *testing.T) {
+	var data [][]byte
+	for i := 0; i < 30; i++ {
+		data = append(data, []byte(fmt.Sprintf(`{"Item":{"id":{"S":"%03d"}}}`, i)))
+	}
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket:  "test-bucket",
+			DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: int64(len(data))}},
+		},
+	}
+	streamer := &flakyStreamer{data: data, failAt: -1}
+	primary := &copyingWriter{}
+	staging := &failOnceWriter{}
+
+	cfg := &config.Config{
+		TableName:       "prod-shadow,staging",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       10,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	coord := NewCoordinator(cfg, loader, streamer, itemimage.NewJSONDecoder(), primary, &mockStore{}, nil,
+		WithTarget("staging", staging))
+	coord.retryBackoff = time.Millisecond
+	if err := coord.Run(context.Background()); err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+
+	if len(streamer.offsets) != 2 {
+		t.Errorf("expected the failed batch to be retried once, got offsets %v", streamer.offsets)
+	}
+	for name, ids := range map[string][]string{"prod-shadow": primary.ids, "staging": staging.ids} {
+		if len(ids) != len(data) {
+			t.Fatalf("%s: expected %d writes, got %d", name, len(data), len(ids))
+		}
+		for i, id := range ids {
+			if want := fmt.Sprintf("%03d", i); id != want {
+				t.Fatalf("%s: write %d: expected id %s, got %s", name, i, want, id)
+			}
+		}
+	}
+
+	report := coord.Report()
+	if len(report.Targets) != 2 || report.Targets[1].Table != "staging" || report.Targets[1].Errors != 1 ||
+		report.Targets[0].ItemsWritten != int64(len(data)) {
+		t.Errorf("unexpected per-target report %+v", report.Targets)
+	}
+}
+
+// signallingStreamer hangs on its first call like hangingStreamer, closing
+// started once it does so a test knows the worker is busy.
+type signallingStreamer struct {
+	hangingStreamer
+	started chan struct{}
+}
+
+func (s *signallingStreamer) Stream(ctx context.Context, bucket, key string, offset int64, fn func([]byte, int64) error) error {
+	if s.calls == 0 {
+		close(s.started)
+	}
+	return s.hangingStreamer.Stream(ctx, bucket, key, offset, fn)
+}
+
+// TestCoordinatorStallDetectionUsesClock verifies that the stall watchdog and
+// the report measure time on the injected clock, so a stall is detected exactly
+// when the fake clock passes StallTimeout and not by wall-clock time.
+func TestCoordinatorStallDetectionUsesClock(t *testing.T) {
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket:  "test-bucket",
+			DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: 2}},
+		},
+	}
+	streamer := &signallingStreamer{
+		hangingStreamer: hangingStreamer{mockStreamer: mockStreamer{data: [][]byte{[]byte(`{}`), []byte(`{}`)}}},
+		started:         make(chan struct{}),
+	}
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       10,
+		ShutdownTimeout: time.Second,
+		StallTimeout:    time.Minute,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	clk := clock.NewFake(time.Unix(0, 0))
+	coord := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, &mockWriter{}, &mockStore{}, nil, WithClock(clk))
+	done := make(chan error, 1)
+	go func() { done <- coord.Run(context.Background()) }()
+
+	// Wait for the progress ticker, the watchdog ticker and the hung stream
+	clk.BlockUntil(2)
+	<-streamer.started
+	clk.Advance(45 * time.Second)
+	select {
+	case err := <-done:
+		t.Fatalf("restore finished before the stall timeout: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clk.Advance(30 * time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+	report := coord.Report()
+	if report.StallCount != 1 {
+		t.Errorf("expected 1 stall, got %d", report.StallCount)
+	}
+	if report.Duration != 75*time.Second {
+		t.Errorf("expected the report to span 75s of fake time, got %s", report.Duration)
+	}
+}
+
+// slowStreamer honours resume offsets and hangs after perCall lines of every
+// call until its context ends, like a file that is read too slowly to finish
+// within one attempt.
+type slowStreamer struct {
+	data    [][]byte
+	perCall int
+	calls   int
+}
+
+func (s *slowStreamer) Stream(ctx context.Context, bucket, key string, offset int64, fn func([]byte, int64) error) error {
+	s.calls++
+	var pos int64
+	sent := 0
+	for _, line := range s.data {
+		lineOffset := pos
+		pos += int64(len(line)) + 1
+		if lineOffset < offset {
+			continue
+		}
+		if sent == s.perCall {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		if err := fn(line, lineOffset); err != nil {
+			return err
+		}
+		sent++
+	}
+	return nil
+}
+
+// TestCoordinatorFileTimeoutKeepsProgress verifies that a file attempt exceeding
+// FileTimeout is restarted from its last written batch, and that attempts which
+// made progress do not use up the retries, so a slow file still completes.
+func TestCoordinatorFileTimeoutKeepsProgress(t *testing.T) {
+	var data [][]byte
+	for i := 0; i < 300; i++ {
+		data = append(data, []byte(fmt.Sprintf(`{"Item":{"id":{"S":"%03d"}}}`, i)))
+	}
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket:  "test-bucket",
+			DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: int64(len(data))}},
+		},
+	}
+	// Each attempt decodes 64 lines, writes 60 of them and then hangs
+	streamer := &slowStreamer{data: data, perCall: decodeBatchLines + 6}
+	writer := &copyingWriter{}
+
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       10,
+		ShutdownTimeout: time.Second,
+		FileTimeout:     20 * time.Millisecond,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	coord := NewCoordinator(cfg, loader, streamer, itemimage.NewJSONDecoder(), writer, &mockStore{}, nil)
+	if err := coord.Run(context.Background()); err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+	if streamer.calls != 5 {
+		t.Errorf("expected 5 attempts, got %d", streamer.calls)
+	}
+	if len(writer.ids) != len(data) {
+		t.Fatalf("expected %d writes, got %d", len(data), len(writer.ids))
+	}
+	for i, id := range writer.ids {
+		if want := fmt.Sprintf("%03d", i); id != want {
+			t.Fatalf("write %d: expected id %s, got %s", i, want, id)
+		}
+	}
+}
+
+// hangingWriter blocks its first write until the context ends.
+type hangingWriter struct {
+	mockWriter
+	calls int
+}
+
+func (w *hangingWriter) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	w.calls++
+	if w.calls == 1 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return w.mockWriter.WriteBatch(ctx, append([]itemimage.Operation(nil), ops...))
+}
+
+// TestCoordinatorBatchTimeoutRetries verifies that a write exceeding BatchTimeout
+// is abandoned and retried with the file at once, without backoff, instead of
+// hanging the worker or failing the run.
+func TestCoordinatorBatchTimeoutRetries(t *testing.T) {
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket:  "test-bucket",
+			DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: 2}},
+		},
+	}
+	streamer := &mockStreamer{data: [][]byte{[]byte(`{}`), []byte(`{}`)}}
+	writer := &hangingWriter{}
+
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       10,
+		ShutdownTimeout: time.Second,
+		BatchTimeout:    20 * time.Millisecond,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	coord := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, writer, &mockStore{}, nil)
+	// A timed out attempt is restarted at once, so the backoff is never waited for
+	coord.retryBackoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := coord.Run(ctx); err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+	if writer.calls != 2 || len(writer.batches) != 1 || len(writer.batches[0]) != 2 {
+		t.Errorf("expected the batch to be written on the second call, got %d calls and %v", writer.calls, writer.batches)
+	}
+}
+
+// pipelinedLoader yields its first file, then waits for a signal before
+// yielding the rest or failing, like a manifest still being read.
+type pipelinedLoader struct {
+	mockLoader
+	proceed <-chan struct{}
+	err     error // Yielded after the files, if set
+}
+
+func (l *pipelinedLoader) Files(ctx context.Context, summary manifest.Summary) iter.Seq2[manifest.FileMeta, error] {
+	return func(yield func(manifest.FileMeta, error) bool) {
+		for i, file := range l.summary.DataFiles {
+			if i == 1 {
+				select {
+				case <-l.proceed:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if !yield(file, nil) {
+				return
+			}
+		}
+		if l.err != nil {
+			yield(manifest.FileMeta{}, l.err)
+		}
+	}
+}
+
+// notifyingWriter closes written after its first batch.
+type notifyingWriter struct {
+	mu      sync.Mutex
+	written chan struct{}
+	batches int
+}
+
+func (w *notifyingWriter) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.batches == 0 {
+		close(w.written)
+	}
+	w.batches++
+	return nil
+}
+
+func (w *notifyingWriter) Flush(ctx context.Context) error {
+	return nil
+}
+
+// TestCoordinatorStartsBeforeManifestIsRead verifies that files are written as
+// soon as their manifest entries arrive: the loader only yields the second file
+// after the first has been written, which would deadlock if Run waited for the
+// whole list. A manifest error after that fails the run.
+func TestCoordinatorStartsBeforeManifestIsRead(t *testing.T) {
+	for _, listErr := range []error{nil, fmt.Errorf("connection reset")} {
+		w := &notifyingWriter{written: make(chan struct{})}
+		loader := &pipelinedLoader{
+			mockLoader: mockLoader{summary: manifest.Summary{
+				S3Bucket:  "test-bucket",
+				DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: 1}, {Key: "file2", ItemCount: 1}},
+			}},
+			proceed: w.written,
+			err:     listErr,
+		}
+		cfg := &config.Config{
+			TableName:       "test-table",
+			ExportS3URI:     "s3://test-bucket/test-prefix",
+			ExportType:      "FULL",
+			ViewType:        "NEW",
+			Region:          "us-west-2",
+			MaxWorkers:      2,
+			BatchSize:       25,
+			ShutdownTimeout: time.Second,
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		streamer := &mockStreamer{data: [][]byte{[]byte(`{"id":"1"}`)}}
+		coord := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, w, &mockStore{}, nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := coord.Run(ctx)
+		cancel()
+		if listErr == nil {
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if w.batches != 2 {
+				t.Errorf("wrote %d batches, want 2", w.batches)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), "connection reset") {
+			t.Errorf("Run error = %v, want the manifest error", err)
+		}
+	}
+}
+
+type concurrencyStreamer struct {
+	mockStreamer
+	open, maxOpen atomic.Int64
+}
+
+func (s *concurrencyStreamer) Stream(ctx context.Context, bucket, key string, offset int64, fn func([]byte, int64) error) error {
+	n := s.open.Add(1)
+	defer s.open.Add(-1)
+	for {
+		m := s.maxOpen.Load()
+		if n <= m || s.maxOpen.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond) // Give other workers time to open their files
+	return s.mockStreamer.Stream(ctx, bucket, key, offset, fn)
+}
+
+// TestCoordinatorMemoryBudgetLimitsOpenFiles verifies that workers wait for
+// room in the memory budget before opening a file: a budget smaller than one
+// file's buffers restores every file, one at a time, instead of deadlocking or
+// opening them all.
+func TestCoordinatorMemoryBudgetLimitsOpenFiles(t *testing.T) {
+	var files []manifest.FileMeta
+	for i := range 8 {
+		files = append(files, manifest.FileMeta{Key: fmt.Sprintf("file%d", i), ItemCount: 1})
+	}
+	loader := &mockLoader{summary: manifest.Summary{S3Bucket: "test-bucket", DataFiles: files}}
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      4,
+		BatchSize:       25,
+		MemoryBudgetMiB: 1,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	streamer := &concurrencyStreamer{mockStreamer: mockStreamer{data: [][]byte{[]byte(`{"id":"1"}`)}}}
+	w := &countingWriter{}
+	coord := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, w, &mockStore{}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := coord.Run(ctx); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := streamer.maxOpen.Load(); got != 1 {
+		t.Errorf("%d files open at once, want 1", got)
+	}
+	if got := w.ops.Load(); got != 8 {
+		t.Errorf("wrote %d items, want 8", got)
+	}
+}
+
+// TestCoordinatorMemoryBudgetShrinksBatches verifies that batches get smaller
+// as large items fill the memory budget, while every item is still written.
+func TestCoordinatorMemoryBudgetShrinksBatches(t *testing.T) {
+	line := []byte(`{"id":"` + strings.Repeat("x", 100*1024) + `"}`)
+	data := make([][]byte, 50)
+	for i := range data {
+		data[i] = line
+	}
+	loader := &mockLoader{summary: manifest.Summary{S3Bucket: "test-bucket", DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: 50}}}}
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       25,
+		MemoryBudgetMiB: 4,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	w := &mockWriter{}
+	coord := NewCoordinator(cfg, loader, &mockStreamer{data: data}, &mockDecoder{}, w, &mockStore{}, nil)
+	if err := coord.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	total, largest := 0, 0
+	for _, b := range w.batches {
+		total += len(b)
+		largest = max(largest, len(b))
+	}
+	if total != 50 || largest >= cfg.BatchSize {
+		t.Errorf("wrote %d items in batches of at most %d, want 50 in batches under %d", total, largest, cfg.BatchSize)
+	}
+}
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []trace.SpanData
+}
+
+func (r *spanRecorder) Export(ctx context.Context, spans []trace.SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+// TestCoordinatorTracesPipeline verifies that the manifest load, file attempt,
+// decode and write spans are recorded, with writes nested under their file so
+// the DynamoDB calls they make land in the same part of the trace.
+func TestCoordinatorTracesPipeline(t *testing.T) {
+	loader := &mockLoader{summary: manifest.Summary{S3Bucket: "test-bucket", DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: 1}}}}
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       25,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	recorder := &spanRecorder{}
+	provider := trace.NewProvider(recorder)
+	streamer := &mockStreamer{data: [][]byte{[]byte(`{"id":"1"}`)}}
+	coord := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, &mockWriter{}, &mockStore{}, nil,
+		WithTracerProvider(provider))
+	if err := coord.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	byName := make(map[string]trace.SpanData)
+	for _, s := range recorder.spans {
+		byName[s.Name] = s
+	}
+	for _, name := range []string{"LoadManifest", "StreamFile", "DecodeBatch", "WriteBatch"} {
+		if _, ok := byName[name]; !ok {
+			t.Errorf("no %s span in %v", name, recorder.spans)
+		}
+	}
+	if byName["WriteBatch"].ParentID != byName["StreamFile"].SpanID {
+		t.Error("WriteBatch span is not a child of its StreamFile span")
+	}
+}
+
+// offsetStreamer records the offset each file is streamed from.
+type offsetStreamer struct {
+	mu      sync.Mutex
+	offsets map[string]int64
+}
+
+func (o *offsetStreamer) Stream(ctx context.Context, bucket, key string, offset int64, fn func([]byte, int64) error) error {
+	o.mu.Lock()
+	o.offsets[key] = offset
+	o.mu.Unlock()
+	return fn([]byte(`{"a":1}`), offset+8)
+}
+
+// TestCoordinatorResumesFromCompletedFiles verifies a resumed restore skips
+// exactly the files the checkpoint lists as completed, whatever their order,
+// continues partly restored files at their offset, and keeps both in the
+// checkpoints it saves so concurrent workers do not lose each other's progress.
+func TestCoordinatorResumesFromCompletedFiles(t *testing.T) {
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket: "test-bucket",
+			DataFiles: []manifest.FileMeta{
+				{Key: "data/9.json.gz", ItemCount: 1},
+				{Key: "data/10.json.gz", ItemCount: 1},
+				{Key: "data/2.json.gz", ItemCount: 1},
+				{Key: "data/1.json.gz", ItemCount: 1},
+			},
+		},
+	}
+	store := &mockStore{state: checkpoint.State{
+		LastFile:       "data/2.json.gz",
+		LastByteOffset: 64,
+		CompletedFiles: []string{"data/9.json.gz"},
+		InProgress:     map[string]int64{"data/2.json.gz": 64},
+		Elapsed:        time.Minute,
+	}}
+	streamer := &offsetStreamer{offsets: make(map[string]int64)}
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       25,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	coord := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, &mockWriter{}, store, nil)
+	if err := coord.Run(context.Background()); err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+
+	want := map[string]int64{"data/10.json.gz": 0, "data/2.json.gz": 64, "data/1.json.gz": 0}
+	if len(streamer.offsets) != len(want) {
+		t.Fatalf("streamed %v, want %v", streamer.offsets, want)
+	}
+	for key, offset := range want {
+		if got, ok := streamer.offsets[key]; !ok || got != offset {
+			t.Errorf("%s streamed from %d (streamed: %v), want %d", key, got, ok, offset)
+		}
+	}
+	if got := store.state.CompletedFiles; len(got) != 4 || got[0] != "data/9.json.gz" {
+		t.Errorf("expected all 4 files completed, earlier ones first, got %v", got)
+	}
+	if len(store.state.InProgress) != 0 {
+		t.Errorf("expected no files in progress, got %v", store.state.InProgress)
+	}
+	if store.state.Elapsed < time.Minute {
+		t.Errorf("expected elapsed time to include earlier runs, got %s", store.state.Elapsed)
+	}
+	if store.state.Version != buildinfo.Get().Version {
+		t.Errorf("expected the checkpoint to record the version saving it, got %q", store.state.Version)
+	}
+}
+
+// TestProgressSummarize checks the resume summary counts done and remaining
+// files and items from the manifest, and estimates the remaining time from the
+// rate of earlier runs.
+func TestProgressSummarize(t *testing.T) {
+	p := newProgress(&mockStore{}, checkpoint.State{
+		LastFile:       "b",
+		CompletedFiles: []string{"a"},
+		InProgress:     map[string]int64{"b": 10},
+		Elapsed:        10 * time.Minute,
+	}, time.Now())
+	files := (&mockLoader{summary: manifest.Summary{DataFiles: []manifest.FileMeta{
+		{Key: "a", ItemCount: 100}, {Key: "b", ItemCount: 150}, {Key: "c", ItemCount: 50},
+	}}}).Files(context.Background(), manifest.Summary{})
+	got, err := p.summarize(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ResumeSummary{FilesDone: 1, FilesRemaining: 2, ItemsDone: 100, ItemsRemaining: 200, Remaining: 20 * time.Minute}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// TestProgressLegacyCheckpoint checks a checkpoint saved before completed files
+// were tracked resumes only its last file and restores every other file again,
+// rather than guessing from key order.
+func TestProgressLegacyCheckpoint(t *testing.T) {
+	p := newProgress(&mockStore{}, checkpoint.State{LastFile: "data/5", LastByteOffset: checkpoint.CompletedOffset}, time.Now())
+	if _, ok := p.resumeAt("data/5"); ok {
+		t.Error("expected the completed last file to be skipped")
+	}
+	if offset, ok := p.resumeAt("data/10"); !ok || offset != 0 {
+		t.Errorf("expected data/10 to be restored from the start, got %d, %v", offset, ok)
+	}
+
+	p = newProgress(&mockStore{}, checkpoint.State{LastFile: "data/5", LastByteOffset: 42}, time.Now())
+	if offset, ok := p.resumeAt("data/5"); !ok || offset != 42 {
+		t.Errorf("expected data/5 to resume at 42, got %d, %v", offset, ok)
+	}
+}
+
+// TestCoordinatorRestoresSelectedFiles verifies WithFiles restores only the
+// listed files of the export.
+func TestCoordinatorRestoresSelectedFiles(t *testing.T) {
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket: "test-bucket",
+			DataFiles: []manifest.FileMeta{
+				{Key: "data/1.json.gz", ItemCount: 1},
+				{Key: "data/2.json.gz", ItemCount: 1},
+				{Key: "data/3.json.gz", ItemCount: 1},
+			},
+		},
+	}
+	streamer := &offsetStreamer{offsets: make(map[string]int64)}
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      2,
+		BatchSize:       25,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	coord := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, &copyingWriter{}, &recordingStore{}, nil,
+		WithFiles([]string{"data/2.json.gz", "data/9.json.gz"}))
+	if err := coord.Run(context.Background()); err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+	if _, ok := streamer.offsets["data/2.json.gz"]; !ok || len(streamer.offsets) != 1 {
+		t.Errorf("expected only data/2.json.gz to be restored, got %v", streamer.offsets)
+	}
+	files := coord.Report().Files
+	if len(files) != 1 || files[0].Status != metrics.FileComplete {
+		t.Errorf("expected data/2.json.gz to be reported complete, got %+v", files)
+	}
+}
+
+// orderStreamer records the order files are streamed in.
+type orderStreamer struct {
+	mu    sync.Mutex
+	order []string
+}
+
+func (o *orderStreamer) Stream(ctx context.Context, bucket, key string, offset int64, fn func([]byte, int64) error) error {
+	o.mu.Lock()
+	o.order = append(o.order, key)
+	o.mu.Unlock()
+	return fn([]byte(`{"a":1}`), offset+8)
+}
+
+// TestCoordinatorRestoresPriorityFilesFirst verifies WithPriorityFiles, given
+// keys or file names, dispatches those files before the others and reports
+// when they were restored.
+func TestCoordinatorRestoresPriorityFilesFirst(t *testing.T) {
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket: "test-bucket",
+			DataFiles: []manifest.FileMeta{
+				{Key: "data/1.json.gz", ItemCount: 1},
+				{Key: "data/2.json.gz", ItemCount: 1},
+				{Key: "data/3.json.gz", ItemCount: 1},
+				{Key: "data/4.json.gz", ItemCount: 1},
+			},
+		},
+	}
+	streamer := &orderStreamer{}
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       25,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	coord := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, &copyingWriter{}, &recordingStore{}, nil,
+		WithPriorityFiles([]string{"4.json.gz", "data/3.json.gz"}))
+	if err := coord.Run(context.Background()); err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+	want := []string{"data/3.json.gz", "data/4.json.gz", "data/1.json.gz", "data/2.json.gz"}
+	if !slices.Equal(streamer.order, want) {
+		t.Errorf("expected files in order %v, got %v", want, streamer.order)
+	}
+	if coord.Report().PriorityComplete == nil {
+		t.Error("expected the report to record when the priority files were restored")
+	}
+}
+
+// TestCoordinatorPassesShareMetrics verifies that a priority pass and the main
+// pass over one export, given the same metrics, report every item either
+// restored, as the main pass's report is the only one uploaded.
+func TestCoordinatorPassesShareMetrics(t *testing.T) {
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket:  "test-bucket",
+			DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: 3}},
+		},
+	}
+	streamer := &mockStreamer{data: [][]byte{[]byte(`{}`), []byte(`{}`), []byte(`{}`)}}
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       10,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	// The first item of the file is the priority item
+	line := 0
+	priority := transform.Func(func(op itemimage.Operation) (itemimage.Operation, bool, error) {
+		line++
+		return op, line%3 == 1, nil
+	})
+	m := metrics.NewMetrics()
+	w := &mockWriter{}
+	first := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, w, &mockStore{}, nil,
+		WithTransformer(priority), WithMetrics(m))
+	if err := first.Run(context.Background()); err != nil {
+		t.Fatalf("priority pass failed: %v", err)
+	}
+	rest := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, w, &mockStore{}, nil,
+		WithTransformer(transform.Not(priority)), WithMetrics(m))
+	if err := rest.Run(context.Background()); err != nil {
+		t.Fatalf("main pass failed: %v", err)
+	}
+	if report := rest.Report(); report.TotalItems != 3 {
+		t.Errorf("expected the main pass to report 3 items, including the priority item, got %d", report.TotalItems)
+	}
+}
+
+// unprocessedClient leaves every item of its first BatchWriteItem call
+// unprocessed, as a throttled table does.
+type unprocessedClient struct {
+	calls atomic.Int32
+}
+
+func (c *unprocessedClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	if c.calls.Add(1) == 1 {
+		return &dynamodb.BatchWriteItemOutput{UnprocessedItems: params.RequestItems}, nil
+	}
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+func (c *unprocessedClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+// TestCoordinatorReportsWorkerBackoff verifies the time a worker's writes back
+// off from throttling is added up per worker for the report, so a restore
+// limited by the table's capacity can be told from one limited by the tool.
+func TestCoordinatorReportsWorkerBackoff(t *testing.T) {
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket:  "test-bucket",
+			DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: 1}},
+		},
+	}
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       25,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	w := writer.NewDynamoDBWriter(&unprocessedClient{}, "test-table", 25)
+	streamer := &mockStreamer{data: [][]byte{[]byte(`{"id":"1"}`)}}
+	coord := NewCoordinator(cfg, loader, streamer, &mockDecoder{}, w, &mockStore{}, nil)
+	if err := coord.Run(context.Background()); err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+	workers := coord.Report().Workers
+	if len(workers) != 1 || workers[0].BackoffTime < 100*time.Millisecond || workers[0].RunTime < workers[0].BackoffTime {
+		t.Errorf("expected one worker backing off at least 100ms of its run, got %+v", workers)
+	}
+}
+
+// recordingUploader keeps the last uploaded report.
+type recordingUploader struct {
+	report *metrics.Report
+}
+
+func (r *recordingUploader) UploadReport(ctx context.Context, uri string, report metrics.Report) error {
+	r.report = &report
+	return nil
+}
+
+// TestCoordinatorUploadsReportOfFailedRestore checks a failed restore still
+// uploads its report, listing the failed file with its error, so the file can
+// be repaired without rerunning the export.
+func TestCoordinatorUploadsReportOfFailedRestore(t *testing.T) {
+	loader := &mockLoader{
+		summary: manifest.Summary{
+			S3Bucket:  "test-bucket",
+			DataFiles: []manifest.FileMeta{{Key: "file1", ItemCount: 1}},
+		},
+	}
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		ReportS3URI:     "s3://test-bucket/report.json",
+		MaxWorkers:      1,
+		BatchSize:       25,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	uploader := &recordingUploader{}
+	coord := NewCoordinator(cfg, loader, &oversizedStreamer{}, itemimage.NewJSONDecoder(), &copyingWriter{}, &mockStore{}, uploader)
+	if err := coord.Run(context.Background()); err == nil {
+		t.Fatal("expected the restore to fail")
+	}
+	if uploader.report == nil {
+		t.Fatal("expected the report of the failed restore to be uploaded")
+	}
+	files := uploader.report.Files
+	if len(files) != 1 || files[0].File != "file1" || files[0].Status != metrics.FileFailed || !strings.Contains(files[0].Error, "longer than") {
+		t.Errorf("expected file1 to be reported failed with its error, got %+v", files)
+	}
+}
+
+// TestCountKeyPrefixes checks items are counted by their partition key up to
+// the delimiter, whether the key comes from the keys of an incremental record
+// or the image of a full export item, and that deletes are not counted.
+func TestCountKeyPrefixes(t *testing.T) {
+	c := &Coordinator{prefixAttr: "pk", prefixDelim: "#"}
+	s := func(v string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: v}}
+	}
+	batch := []itemimage.Operation{
+		{Type: itemimage.OpPut, NewImage: s("TENANT#1#ORDER#7")},
+		{Type: itemimage.OpPut, NewImage: s("TENANT#2")},
+		{Type: itemimage.OpUpdate, Keys: s("USER#9"), NewImage: s("USER#9")},
+		{Type: itemimage.OpDelete, Keys: s("USER#3")},
+		{Type: itemimage.OpPut, NewImage: s("config")},
+		{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"pk": &types.AttributeValueMemberN{Value: "42"}}},
+	}
+	got := c.countKeyPrefixes(batch)
+	want := map[string]int64{"TENANT": 2, "USER": 1, "config": 1, "42": 1}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// TestPace verifies -replay-speed holds each batch until its latest write is
+// due on the scaled timeline started by the first batch, never holds batches
+// without write timestamps, and refreshes the worker during long waits so the
+// stall watchdog does not restart a paced file.
+func TestPace(t *testing.T) {
+	cfg := &config.Config{ReplaySpeed: 10, StallTimeout: 2 * time.Second}
+	clk := clock.NewFake(time.Unix(0, 0))
+	coord := NewCoordinator(cfg, nil, nil, nil, &mockWriter{}, &mockStore{}, nil, WithClock(clk))
+	coord.workerStatus[0] = &WorkerStatus{ID: 0}
+	ctx := context.Background()
+	at := func(sec int64) []itemimage.Operation {
+		return []itemimage.Operation{{WriteTimestampMicros: 1_700_000_000_000_000 + sec*1_000_000}}
+	}
+
+	// The first batch starts the timeline; earlier writes and full export items are not held
+	for _, batch := range [][]itemimage.Operation{at(0), at(-5), {{Type: itemimage.OpPut}}} {
+		if err := coord.pace(ctx, 0, batch); err != nil {
+			t.Fatalf("pace failed: %v", err)
+		}
+	}
+
+	// A write 10s later is due after 1s at 10x
+	done := make(chan error, 1)
+	go func() { done <- coord.pace(ctx, 0, at(10)) }()
+	clk.BlockUntil(1)
+	clk.Advance(500 * time.Millisecond)
+	clk.BlockUntil(1)
+	coord.statusMu.RLock()
+	lastActive := coord.workerStatus[0].LastActive
+	coord.statusMu.RUnlock()
+	if !lastActive.Equal(clk.Now()) {
+		t.Errorf("expected the worker to be refreshed during the wait, last active at %s", lastActive)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("batch was written before it was due: %v", err)
+	default:
+	}
+	clk.Advance(500 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatalf("pace failed: %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := coord.pace(cancelled, 0, at(3600)); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled wait to fail, got %v", err)
+	}
+}
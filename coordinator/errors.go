@@ -0,0 +1,127 @@
+package coordinator
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gurre/ddb-pitr/aws"
+	"github.com/gurre/ddb-pitr/stream"
+)
+
+// ErrorCategory classifies the errors of failed file attempts by the stage
+// that failed, for the report and WorkerErrors.
+type ErrorCategory string
+
+const (
+	CategoryS3Read      ErrorCategory = "s3_read"          // Reading a data file from S3
+	CategoryDecode      ErrorCategory = "decode"           // Corrupt line limit exceeded or a line too long
+	CategoryTransform   ErrorCategory = "transform"        // A transformer rejected an operation
+	CategoryThrottling  ErrorCategory = "write_throttling" // Writes still throttled after their retries
+	CategoryWrite       ErrorCategory = "write"            // Other write failures
+	CategoryCheckpoint  ErrorCategory = "checkpoint"       // Saving a checkpoint
+	CategoryTimeout     ErrorCategory = "timeout"          // Stalled or timed out attempts and batches
+	CategoryInterrupted ErrorCategory = "interrupted"      // The restore was cancelled
+)
+
+// stageError marks err with the category of the stage it came from. Its
+// message is err's, so marking an error does not change how it reads.
+type stageError struct {
+	category ErrorCategory
+	err      error
+}
+
+func (e *stageError) Error() string { return e.err.Error() }
+
+func (e *stageError) Unwrap() error { return e.err }
+
+// inStage marks err as coming from the stage of category; nil stays nil.
+func inStage(category ErrorCategory, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &stageError{category: category, err: err}
+}
+
+// Categorize returns the category of an error returned by a file attempt.
+// Errors of the streamer that no later stage marked are reads from S3.
+// Example:
+//
+//	var werr *coordinator.WorkerErrors
+//	if errors.As(err, &werr) {
+//	    for _, e := range werr.Errors {
+//	        fmt.Println(coordinator.Categorize(e), e)
+//	    }
+//	}
+func Categorize(err error) ErrorCategory {
+	var stage *stageError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return CategoryInterrupted
+	case isTimeout(err) || errors.Is(err, context.DeadlineExceeded):
+		return CategoryTimeout
+	case errors.Is(err, ErrCorruptLimit) || errors.Is(err, stream.ErrLineTooLong):
+		return CategoryDecode
+	case errors.As(err, &stage):
+		if stage.category == CategoryWrite && aws.IsThrottle(err) {
+			return CategoryThrottling
+		}
+		return stage.category
+	}
+	return CategoryS3Read
+}
+
+// maxErrorSamples bounds the errors WorkerErrors quotes per category.
+const maxErrorSamples = 3
+
+// WorkerErrors is returned by Run when workers failed. It holds the error of
+// every failed worker, and its message counts them by category and quotes a
+// few of each. errors.Is and errors.As match any of them.
+type WorkerErrors struct {
+	Errors []error // Error of every failed worker, in the order they failed
+}
+
+// ByCategory groups the errors by Categorize.
+func (e *WorkerErrors) ByCategory() map[ErrorCategory][]error {
+	groups := make(map[ErrorCategory][]error)
+	for _, err := range e.Errors {
+		category := Categorize(err)
+		groups[category] = append(groups[category], err)
+	}
+	return groups
+}
+
+// Error counts the errors by category, most frequent first, e.g.
+// "some workers failed: 2 write_throttling (worker 0 failed: ...; worker 3 failed: ...)".
+func (e *WorkerErrors) Error() string {
+	groups := e.ByCategory()
+	categories := make([]ErrorCategory, 0, len(groups))
+	for category := range groups {
+		categories = append(categories, category)
+	}
+	slices.SortFunc(categories, func(a, b ErrorCategory) int {
+		return cmp.Or(cmp.Compare(len(groups[b]), len(groups[a])), cmp.Compare(a, b))
+	})
+
+	parts := make([]string, len(categories))
+	for i, category := range categories {
+		errs := groups[category]
+		samples := make([]string, 0, maxErrorSamples)
+		for _, err := range errs[:min(len(errs), maxErrorSamples)] {
+			samples = append(samples, err.Error())
+		}
+		if n := len(errs) - maxErrorSamples; n > 0 {
+			samples = append(samples, fmt.Sprintf("and %d more", n))
+		}
+		parts[i] = fmt.Sprintf("%d %s (%s)", len(errs), category, strings.Join(samples, "; "))
+	}
+	return "some workers failed: " + strings.Join(parts, ", ")
+}
+
+// Unwrap returns the errors of the failed workers.
+func (e *WorkerErrors) Unwrap() []error {
+	return e.Errors
+}
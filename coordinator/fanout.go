@@ -0,0 +1,89 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/writer"
+)
+
+// Target is a table receiving the restored operations and the writer for it.
+type Target struct {
+	Table  string
+	Writer writer.Writer
+}
+
+// WithTarget adds a table that receives a copy of every batch written to the
+// primary writer, for restoring one export into several tables at once. Each
+// target is written concurrently and retried independently: when a batch fails
+// for one target, the targets that already wrote it are skipped on retry.
+// Example:
+//
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, prodShadow, store, nil,
+//	    coordinator.WithTarget("staging", writer.NewDynamoDBWriter(client, "staging", 25)),
+//	)
+func WithTarget(table string, w writer.Writer) Option {
+	return func(c *Coordinator) {
+		c.targets = append(c.targets, Target{Table: table, Writer: w})
+	}
+}
+
+// primaryTable returns the name of the table given to the primary writer.
+func (c *Coordinator) primaryTable() string {
+	if tables := c.cfg.TargetTables(); len(tables) > 0 {
+		return tables[0]
+	}
+	return c.cfg.TableName
+}
+
+// writeTargets writes batch to every target that has not yet been written up to
+// offset, the stream offset just past the batch's last line. written holds that
+// offset per target for the current file and is advanced on success.
+func (c *Coordinator) writeTargets(ctx context.Context, batch []itemimage.Operation, written []int64, offset int64) error {
+	if len(c.targets) == 1 {
+		if written[0] >= offset {
+			return nil
+		}
+		if err := c.targets[0].Writer.WriteBatch(ctx, batch); err != nil {
+			return err
+		}
+		written[0] = offset
+		return nil
+	}
+
+	errs := make([]error, len(c.targets))
+	var wg sync.WaitGroup
+	for i, t := range c.targets {
+		if written[i] >= offset {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := c.clock.Now()
+			if err := t.Writer.WriteBatch(ctx, batch); err != nil {
+				c.metrics.RecordTargetError(t.Table)
+				errs[i] = fmt.Errorf("table %s: %w", t.Table, err)
+				return
+			}
+			c.metrics.RecordTargetWrite(t.Table, len(batch), c.clock.Now().Sub(start))
+			written[i] = offset
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// flushTargets flushes every target's writer.
+func (c *Coordinator) flushTargets(ctx context.Context) error {
+	var errs []error
+	for _, t := range c.targets {
+		if err := t.Writer.Flush(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("table %s: %w", t.Table, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,136 @@
+package coordinator
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gurre/ddb-pitr/stream"
+)
+
+const (
+	// streamBufferBytes approximates the read and line buffers a streamer holds
+	// for one open file.
+	streamBufferBytes = 1280 * 1024
+
+	// decodedBytesFactor approximates how much larger a decoded operation is than
+	// the JSON line it was decoded from, as attribute values are boxed in maps.
+	decodedBytesFactor = 3
+)
+
+// fileBufferBytes approximates the memory a streamer holds for one open file
+// when it reads readAheadParts parts ahead of the one being read.
+func fileBufferBytes(readAheadParts int) int64 {
+	if readAheadParts <= 0 {
+		return streamBufferBytes
+	}
+	return streamBufferBytes + int64(readAheadParts+1)*stream.PartSize
+}
+
+// memoryBudget tracks the approximate memory held by the workers of a Run:
+// the stream buffers of each open file, raw lines waiting to be decoded and
+// decoded operations waiting to be written. Workers consult it to shrink
+// their read-ahead and batches as it fills, and wait for room before opening
+// another file. A nil budget is unlimited.
+type memoryBudget struct {
+	limit int64
+	used  atomic.Int64
+
+	mu       sync.Mutex
+	released chan struct{} // Closed and replaced whenever memory is released
+}
+
+// newMemoryBudget creates a budget of limit bytes, or nil for limit 0.
+func newMemoryBudget(limit int64) *memoryBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &memoryBudget{limit: limit, released: make(chan struct{})}
+}
+
+// reserve waits until n more bytes fit in the budget and takes them. A
+// reservation always succeeds when nothing is held, so a budget smaller than
+// one file still restores, one file at a time.
+func (b *memoryBudget) reserve(ctx context.Context, n int64) error {
+	for {
+		b.mu.Lock()
+		released := b.released
+		b.mu.Unlock()
+		used := b.used.Load()
+		if used == 0 || used+n <= b.limit {
+			if b.used.CompareAndSwap(used, used+n) {
+				return nil
+			}
+			continue
+		}
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// add changes the bytes held by delta, waking reservations when it is negative.
+func (b *memoryBudget) add(delta int64) {
+	b.used.Add(delta)
+	if delta < 0 {
+		b.mu.Lock()
+		close(b.released)
+		b.released = make(chan struct{})
+		b.mu.Unlock()
+	}
+}
+
+// scale returns n, such as a read-ahead or batch size, reduced as the budget
+// fills: unchanged up to half the budget, then in proportion to the room left,
+// and never below 1.
+func (b *memoryBudget) scale(n int) int {
+	if b == nil {
+		return n
+	}
+	left := 1 - float64(b.used.Load())/float64(b.limit)
+	if left >= 0.5 {
+		return n
+	}
+	return max(int(float64(n)*left*2), 1)
+}
+
+// memoryLease is the part of a memoryBudget held by one worker: a fixed
+// reservation for its open file and a varying amount for its lines and batch.
+type memoryLease struct {
+	budget   *memoryBudget
+	file     int64 // Reserved for each open file
+	reserved int64 // Taken by reserve, for the open file
+	held     int64 // Set by set, for lines and operations
+}
+
+// reserve waits for room for one more open file and takes it.
+func (l *memoryLease) reserve(ctx context.Context) error {
+	if l.budget == nil {
+		return nil
+	}
+	if err := l.budget.reserve(ctx, l.file); err != nil {
+		return err
+	}
+	l.reserved += l.file
+	return nil
+}
+
+// set records that the worker's lines and operations hold n bytes.
+func (l *memoryLease) set(n int64) {
+	if l.budget == nil || n == l.held {
+		return
+	}
+	l.budget.add(n - l.held)
+	l.held = n
+}
+
+// release returns everything the lease holds to the budget.
+func (l *memoryLease) release() {
+	if l.budget == nil || l.reserved+l.held == 0 {
+		return
+	}
+	l.budget.add(-(l.reserved + l.held))
+	l.reserved, l.held = 0, 0
+}
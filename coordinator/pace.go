@@ -0,0 +1,62 @@
+package coordinator
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// pacer spaces the batch writes of an incremental export by the write
+// timestamps of their operations, scaled by ReplaySpeed. The timeline starts
+// with the first batch paced, so a resumed restore does not wait out the part
+// of the export it already applied.
+type pacer struct {
+	speed float64 // Multiple of the original write rate
+
+	mu     sync.Mutex
+	origin int64     // Write timestamp, in microseconds, the timeline starts at
+	start  time.Time // When the first batch was paced; zero before
+}
+
+// due returns when a batch whose latest write was at micros is written.
+func (p *pacer) due(micros int64, now time.Time) time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.start.IsZero() {
+		p.start, p.origin = now, micros
+	}
+	return p.start.Add(time.Duration(float64(micros-p.origin) * float64(time.Microsecond) / p.speed))
+}
+
+// pace blocks until batch is due. Batches without write timestamps are never
+// held. Long waits refresh the worker so the stall watchdog does not count them.
+func (c *Coordinator) pace(ctx context.Context, id int, batch []itemimage.Operation) error {
+	if c.pacer == nil {
+		return nil
+	}
+	var latest int64
+	for _, op := range batch {
+		latest = max(latest, op.WriteTimestampMicros)
+	}
+	if latest == 0 {
+		return nil
+	}
+	due := c.pacer.due(latest, c.clock.Now())
+	for {
+		wait := due.Sub(c.clock.Now())
+		if wait <= 0 {
+			return nil
+		}
+		if c.cfg.StallTimeout > 0 {
+			wait = min(wait, c.cfg.StallTimeout/4)
+		}
+		select {
+		case <-c.clock.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		c.updateWorkerStatus(id, func(*WorkerStatus) {})
+	}
+}
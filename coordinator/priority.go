@@ -0,0 +1,69 @@
+package coordinator
+
+import (
+	"path"
+	"sync"
+)
+
+// prioritySet tracks the files of WithPriorityFiles, which are dispatched
+// before every other file, until the last of them is restored.
+type prioritySet struct {
+	names map[string]bool // Keys or file names of the priority files
+
+	mu     sync.Mutex
+	left   int  // Priority files dispatched and not yet complete
+	sent   int  // Priority files dispatched
+	sealed bool // Every priority file has been dispatched
+}
+
+// WithPriorityFiles restores the data files with the given keys, or file
+// names, before every other file of the export, so the most important data is
+// back first. The report records when the last of them completed. Files
+// completed by an earlier run are not restored again.
+// Example:
+//
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil,
+//	    coordinator.WithPriorityFiles([]string{"x7k2.json.gz", "AWSDynamoDB/01234-abcd/data/q9p1.json.gz"}),
+//	)
+func WithPriorityFiles(names []string) Option {
+	return func(c *Coordinator) {
+		c.priority = &prioritySet{names: make(map[string]bool, len(names))}
+		for _, name := range names {
+			c.priority.names[name] = true
+		}
+	}
+}
+
+// match reports whether the file key is a priority file.
+func (p *prioritySet) match(key string) bool {
+	return p.names[key] || p.names[path.Base(key)]
+}
+
+// dispatch counts a priority file handed to a worker.
+func (p *prioritySet) dispatch() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.left++
+	p.sent++
+}
+
+// complete counts the restored file key and reports whether it was the last
+// priority file. It is safe to call on a nil set.
+func (p *prioritySet) complete(key string) bool {
+	if p == nil || !p.match(key) {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.left--
+	return p.sealed && p.left == 0
+}
+
+// seal marks every priority file dispatched and reports whether they were all
+// restored already.
+func (p *prioritySet) seal() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sealed = true
+	return p.sent > 0 && p.left == 0
+}
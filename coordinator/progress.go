@@ -0,0 +1,146 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"sync"
+	"time"
+
+	"github.com/gurre/ddb-pitr/buildinfo"
+	"github.com/gurre/ddb-pitr/checkpoint"
+	"github.com/gurre/ddb-pitr/manifest"
+)
+
+// progress tracks which files of the export are complete and how far the
+// others have been written. Every checkpoint holds all of it, so the saves of
+// concurrent workers do not overwrite each other's progress.
+type progress struct {
+	mu         sync.Mutex // Held while saving, so a later state is never overwritten by an earlier one
+	store      checkpoint.Store
+	completed  map[string]bool
+	order      []string         // Completed files in the order they completed
+	inProgress map[string]int64 // Offset just past the last written line of each started file
+	elapsed    time.Duration    // Restore time of earlier runs
+	start      time.Time        // When this run started
+}
+
+// newProgress resumes from state. A legacy state only records its last file;
+// every other file is restored again.
+func newProgress(store checkpoint.Store, state checkpoint.State, start time.Time) *progress {
+	p := &progress{
+		store:      store,
+		completed:  make(map[string]bool, len(state.CompletedFiles)),
+		inProgress: make(map[string]int64, len(state.InProgress)),
+		elapsed:    state.Elapsed,
+		start:      start,
+	}
+	for _, file := range state.CompletedFiles {
+		p.markCompleted(file)
+	}
+	for file, offset := range state.InProgress {
+		p.inProgress[file] = offset
+	}
+	if state.Legacy() {
+		if state.Complete() {
+			p.markCompleted(state.LastFile)
+		} else {
+			p.inProgress[state.LastFile] = state.LastByteOffset
+		}
+	}
+	return p
+}
+
+// markCompleted records file as complete. The caller holds mu or owns p.
+func (p *progress) markCompleted(file string) {
+	if !p.completed[file] {
+		p.completed[file] = true
+		p.order = append(p.order, file)
+	}
+	delete(p.inProgress, file)
+}
+
+// resumeAt returns the offset to start file at, or false when it is complete.
+func (p *progress) resumeAt(file string) (int64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.completed[file] {
+		return 0, false
+	}
+	return p.inProgress[file], true
+}
+
+// save records that file has been written up to offset, or completely when
+// offset is checkpoint.CompletedOffset, and saves the state.
+func (p *progress) save(ctx context.Context, file string, offset int64, now time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if offset == checkpoint.CompletedOffset {
+		p.markCompleted(file)
+	} else {
+		p.inProgress[file] = offset
+	}
+	return p.store.Save(ctx, p.stateLocked(file, offset, now))
+}
+
+// stateLocked returns the checkpoint of the progress so far, with file and
+// offset as its last position. The caller holds mu.
+func (p *progress) stateLocked(file string, offset int64, now time.Time) checkpoint.State {
+	state := checkpoint.State{
+		ExportID:       file,
+		LastFile:       file,
+		LastByteOffset: offset,
+		SavedAt:        now.UTC(),
+		CompletedFiles: append([]string{}, p.order...),
+		InProgress:     make(map[string]int64, len(p.inProgress)),
+		Elapsed:        p.elapsed + now.Sub(p.start),
+		Version:        buildinfo.Get().Version,
+	}
+	for f, o := range p.inProgress {
+		state.InProgress[f] = o
+	}
+	return state
+}
+
+// ResumeSummary describes the work a resumed restore skips and what is left.
+type ResumeSummary struct {
+	FilesDone      int           // Files completed by earlier runs
+	FilesRemaining int           // Files left to restore, including partly restored ones
+	ItemsDone      int64         // Items of the completed files
+	ItemsRemaining int64         // Items expected in the remaining files
+	Remaining      time.Duration // Estimated time left at the rate of earlier runs; 0 when unknown
+}
+
+// String formats the summary on one line.
+func (s ResumeSummary) String() string {
+	eta := "unknown"
+	if s.Remaining > 0 {
+		eta = s.Remaining.Round(time.Second).String()
+	}
+	return fmt.Sprintf("%d files already done (%d items), %d files remaining (%d items expected), estimated remaining time %s",
+		s.FilesDone, s.ItemsDone, s.FilesRemaining, s.ItemsRemaining, eta)
+}
+
+// summarize counts the files of the export done and remaining. The remaining
+// time assumes the rest is restored at the rate the completed files were.
+func (p *progress) summarize(files iter.Seq2[manifest.FileMeta, error]) (ResumeSummary, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var s ResumeSummary
+	for file, err := range files {
+		if err != nil {
+			return ResumeSummary{}, err
+		}
+		if p.completed[file.Key] {
+			s.FilesDone++
+			s.ItemsDone += file.ItemCount
+		} else {
+			s.FilesRemaining++
+			s.ItemsRemaining += file.ItemCount
+		}
+	}
+	if s.ItemsDone > 0 && p.elapsed > 0 {
+		s.Remaining = time.Duration(float64(p.elapsed) * float64(s.ItemsRemaining) / float64(s.ItemsDone))
+	}
+	return s, nil
+}
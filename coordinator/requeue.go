@@ -0,0 +1,91 @@
+package coordinator
+
+import (
+	"sync"
+
+	"github.com/gurre/ddb-pitr/manifest"
+)
+
+// requeue hands files that failed every attempt back to the workers, up to
+// FileRequeues times each, so a worker that keeps failing on a file does not
+// end the run while another might restore it. Run dispatches requeued files
+// and keeps the task channel open until no dispatched file is left.
+type requeue struct {
+	budget int // Times a file may be requeued
+
+	mu          sync.Mutex
+	requeued    map[string]int      // Times each file was requeued
+	pending     []manifest.FileMeta // Requeued files waiting to be dispatched
+	outstanding int                 // Files dispatched or pending and not yet finished
+	notify      chan struct{}       // Signalled when a file is requeued or finished
+}
+
+// newRequeue returns a requeue allowing budget requeues per file, or nil when
+// budget is zero and failed files fail their worker.
+func newRequeue(budget int) *requeue {
+	if budget <= 0 {
+		return nil
+	}
+	return &requeue{budget: budget, requeued: make(map[string]int), notify: make(chan struct{}, 1)}
+}
+
+// dispatch counts a file handed to the workers. It is safe to call on a nil
+// requeue, as are the other methods.
+func (r *requeue) dispatch() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outstanding++
+}
+
+// push queues file for another attempt and reports whether its budget allowed
+// it. A file that was not queued is finished.
+func (r *requeue) push(file manifest.FileMeta) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.requeued[file.Key] >= r.budget {
+		return false
+	}
+	r.requeued[file.Key]++
+	r.outstanding-- // Dispatching it again counts it anew
+	r.pending = append(r.pending, file)
+	r.signal()
+	return true
+}
+
+// finish counts a dispatched file restored, skipped or failed for good.
+func (r *requeue) finish() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outstanding--
+	r.signal()
+}
+
+// take returns the files waiting to be dispatched, and whether any file is
+// still being restored or waiting.
+func (r *requeue) take() ([]manifest.FileMeta, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	files := r.pending
+	r.pending = nil
+	return files, len(files) > 0 || r.outstanding > 0
+}
+
+// signal wakes Run without blocking. r.mu must be held.
+func (r *requeue) signal() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
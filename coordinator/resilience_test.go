@@ -0,0 +1,129 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gurre/ddb-pitr/checkpoint"
+	"github.com/gurre/ddb-pitr/config"
+	"github.com/gurre/ddb-pitr/fault"
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/manifest"
+)
+
+// resilienceFiles are the data files of every resilience scenario; each holds
+// the same 150 items.
+var resilienceFiles = []string{"file1", "file2"}
+
+// runWithFaults restores resilienceFiles with one worker, injecting the faults
+// of inj into the streamer, writer and checkpoint store. It returns the error
+// of Run, the ids written and the last checkpoint saved.
+func runWithFaults(t *testing.T, inj *fault.Injector) (error, []string, checkpoint.State) {
+	t.Helper()
+	var data [][]byte
+	for i := 0; i < 150; i++ {
+		data = append(data, []byte(fmt.Sprintf(`{"Item":{"id":{"S":"%03d"}}}`, i)))
+	}
+	var files []manifest.FileMeta
+	for _, key := range resilienceFiles {
+		files = append(files, manifest.FileMeta{Key: key, ItemCount: int64(len(data))})
+	}
+	loader := &mockLoader{summary: manifest.Summary{S3Bucket: "test-bucket", DataFiles: files}}
+	cfg := &config.Config{
+		TableName:       "test-table",
+		ExportS3URI:     "s3://test-bucket/test-prefix",
+		ExportType:      "FULL",
+		ViewType:        "NEW",
+		Region:          "us-west-2",
+		MaxWorkers:      1,
+		BatchSize:       25,
+		ShutdownTimeout: time.Second,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("failed to validate config: %v", err)
+	}
+
+	writer := &copyingWriter{}
+	store := checkpoint.NewMemoryStore()
+	coord := NewCoordinator(cfg, loader,
+		fault.NewStreamer(&flakyStreamer{data: data, failAt: -1}, inj),
+		itemimage.NewJSONDecoder(),
+		fault.NewWriter(writer, inj),
+		fault.NewStore(store, inj),
+		nil)
+	coord.retryBackoff = time.Millisecond
+	err := coord.Run(context.Background())
+	state, _ := store.Load(context.Background())
+	return err, writer.ids, state
+}
+
+// assertWrittenOnce fails unless every item was written once per file.
+func assertWrittenOnce(t *testing.T, ids []string) {
+	t.Helper()
+	counts := make(map[string]int)
+	for _, id := range ids {
+		counts[id]++
+	}
+	for i := 0; i < 150; i++ {
+		if id := fmt.Sprintf("%03d", i); counts[id] != len(resilienceFiles) {
+			t.Fatalf("item %s written %d times, want %d", id, counts[id], len(resilienceFiles))
+		}
+	}
+}
+
+// TestResilienceMidFileCrash verifies a stream that breaks midway through a
+// file is resumed after its last written batch, so no item is lost or written
+// twice and both files are checkpointed complete.
+func TestResilienceMidFileCrash(t *testing.T) {
+	inj := fault.New(1, fault.MidFileCrash(100))
+	err, ids, state := runWithFaults(t, inj)
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if inj.Injected(fault.PointLine) != 1 {
+		t.Fatalf("expected one crash, got %d", inj.Injected(fault.PointLine))
+	}
+	assertWrittenOnce(t, ids)
+	if len(state.CompletedFiles) != len(resilienceFiles) {
+		t.Errorf("expected every file checkpointed complete, got %+v", state)
+	}
+}
+
+// TestResilienceCheckpointOutage checks failed checkpoint saves are retried
+// with the file, and the restore still finishes with every file checkpointed
+// complete, rewriting at most the batches whose checkpoint was lost.
+func TestResilienceCheckpointOutage(t *testing.T) {
+	inj := fault.New(1, fault.CheckpointOutage(0, 2))
+	err, ids, state := runWithFaults(t, inj)
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if inj.Injected(fault.PointSave) != 2 {
+		t.Fatalf("expected two failed saves, got %d", inj.Injected(fault.PointSave))
+	}
+	if len(ids) < 2*150 {
+		t.Errorf("expected every item written, got %d writes", len(ids))
+	}
+	if len(state.CompletedFiles) != len(resilienceFiles) {
+		t.Errorf("expected every file checkpointed complete, got %+v", state)
+	}
+}
+
+// TestResilienceThrottlingStorm verifies a storm of throttled writes shorter
+// than the file retries is ridden out without losing or duplicating items, and
+// that a storm outlasting them fails the restore instead of skipping data.
+func TestResilienceThrottlingStorm(t *testing.T) {
+	inj := fault.New(1, fault.ThrottlingStorm(1, 2))
+	err, ids, _ := runWithFaults(t, inj)
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	assertWrittenOnce(t, ids)
+
+	inj = fault.New(1, fault.ThrottlingStorm(1, 0))
+	if err, _, _ := runWithFaults(t, inj); err == nil {
+		t.Error("expected an endless storm to fail the restore")
+	}
+}
@@ -0,0 +1,381 @@
+// Package ddbpitrtest provides in-memory S3 and DynamoDB clients for testing
+// code that embeds the restore library. S3 serves objects, including export
+// fixtures loaded from disk, to manifest loaders and streamers; DynamoDB
+// applies the batch writes and updates of writer.DynamoDBWriter to in-memory
+// tables that tests assert on. Both can be told to fail calls, so retry and
+// error paths can be tested too. Both are safe for concurrent use.
+package ddbpitrtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/aws"
+	"github.com/gurre/s3streamer"
+)
+
+// ErrInjected is returned by calls failed by FailNext or FailKey without an
+// error of their own.
+var ErrInjected = errors.New("ddbpitrtest: injected failure")
+
+// Compile-time checks that the clients satisfy the interfaces the library takes
+var (
+	_ aws.DynamoDBClient  = (*DynamoDB)(nil)
+	_ aws.S3Client        = (*S3)(nil)
+	_ s3streamer.S3Client = (*S3)(nil)
+)
+
+// defaultPartitionKeys and defaultSortKeys are tried in order as key names of
+// tables without a key schema set with SetKeySchema.
+var (
+	defaultPartitionKeys = []string{"pk", "PK", "id", "ID", "partition_key"}
+	defaultSortKeys      = []string{"sk", "SK", "sort", "sort_key", "range_key"}
+)
+
+// DynamoDB is an in-memory DynamoDB client implementing BatchWriteItem and
+// UpdateItem. Items are stored by their key attributes, set per table with
+// SetKeySchema or else guessed from common names such as pk and sk.
+// Example:
+//
+//	ddb := ddbpitrtest.NewDynamoDB()
+//	ddb.SetKeySchema("orders", "pk", "sk")
+//	w := writer.NewDynamoDBWriter(ddb, "orders", 25)
+type DynamoDB struct {
+	mu          sync.Mutex
+	keys        map[string][]string                                   // Key attribute names by table
+	tables      map[string]map[string]map[string]types.AttributeValue // Items by table and key
+	batchWrites []dynamodb.BatchWriteItemInput
+	updates     []dynamodb.UpdateItemInput
+	failures    []error // Errors of the next calls to fail
+	unprocessed int     // BatchWriteItem calls left to return a request unprocessed
+}
+
+// NewDynamoDB creates a DynamoDB without tables; tables are created by their
+// first write.
+// Example:
+//
+//	ddb := ddbpitrtest.NewDynamoDB()
+func NewDynamoDB() *DynamoDB {
+	return &DynamoDB{
+		keys:   make(map[string][]string),
+		tables: make(map[string]map[string]map[string]types.AttributeValue),
+	}
+}
+
+// Key returns a key of string attributes from name and value pairs.
+// Example:
+//
+//	key := ddbpitrtest.Key("pk", "1", "sk", "2")
+func Key(pairs ...string) map[string]types.AttributeValue {
+	key := make(map[string]types.AttributeValue, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		key[pairs[i]] = &types.AttributeValueMemberS{Value: pairs[i+1]}
+	}
+	return key
+}
+
+// SetKeySchema sets the key attributes of table, partition key first.
+// Example:
+//
+//	ddb.SetKeySchema("orders", "customer", "order")
+func (d *DynamoDB) SetKeySchema(table string, keys ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.keys[table] = keys
+}
+
+// FailNext fails the next n write calls, BatchWriteItem or UpdateItem, with
+// err, or ErrInjected when err is nil. Failed calls write nothing.
+// Example:
+//
+//	ddb.FailNext(2, &types.ProvisionedThroughputExceededException{})
+func (d *DynamoDB) FailNext(n int, err error) {
+	if err == nil {
+		err = ErrInjected
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for range n {
+		d.failures = append(d.failures, err)
+	}
+}
+
+// LeaveUnprocessed makes the next n BatchWriteItem calls skip the last request
+// of each table and return it in UnprocessedItems, as DynamoDB does when
+// throttled.
+// Example:
+//
+//	ddb.LeaveUnprocessed(1)
+func (d *DynamoDB) LeaveUnprocessed(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.unprocessed += n
+}
+
+// nextFailure returns the error of a call set to fail, or nil. d.mu is held.
+func (d *DynamoDB) nextFailure() error {
+	if len(d.failures) == 0 {
+		return nil
+	}
+	err := d.failures[0]
+	d.failures = d.failures[1:]
+	return err
+}
+
+// BatchWriteItem applies the put and delete requests of params.
+func (d *DynamoDB) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.batchWrites = append(d.batchWrites, *params)
+	if err := d.nextFailure(); err != nil {
+		return nil, err
+	}
+
+	unprocessed := make(map[string][]types.WriteRequest)
+	leave := d.unprocessed > 0
+	if leave {
+		d.unprocessed--
+	}
+	for table, requests := range params.RequestItems {
+		if leave && len(requests) > 0 {
+			unprocessed[table] = requests[len(requests)-1:]
+			requests = requests[:len(requests)-1]
+		}
+		items := d.table(table)
+		for _, req := range requests {
+			if req.PutRequest != nil {
+				items[d.itemKey(table, req.PutRequest.Item)] = req.PutRequest.Item
+			}
+			if req.DeleteRequest != nil {
+				delete(items, d.itemKey(table, req.DeleteRequest.Key))
+			}
+		}
+	}
+	return &dynamodb.BatchWriteItemOutput{UnprocessedItems: unprocessed}, nil
+}
+
+// UpdateItem applies the SET and REMOVE clauses of params' update expression,
+// creating the item when it does not exist. Other clauses and condition
+// expressions are ignored.
+func (d *DynamoDB) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.updates = append(d.updates, *params)
+	if err := d.nextFailure(); err != nil {
+		return nil, err
+	}
+
+	items := d.table(*params.TableName)
+	key := d.itemKey(*params.TableName, params.Key)
+	item, ok := items[key]
+	if !ok {
+		item = make(map[string]types.AttributeValue, len(params.Key))
+		for k, v := range params.Key {
+			item[k] = v
+		}
+		items[key] = item
+	}
+	if params.UpdateExpression == nil {
+		return &dynamodb.UpdateItemOutput{}, nil
+	}
+
+	name := func(ref string) string {
+		if resolved, ok := params.ExpressionAttributeNames[ref]; ok {
+			return resolved
+		}
+		return ref
+	}
+	expr := *params.UpdateExpression
+	if idx := strings.Index(expr, "SET "); idx != -1 {
+		set := expr[idx+4:]
+		if end := strings.Index(set, " REMOVE"); end != -1 {
+			set = set[:end]
+		}
+		for _, assignment := range strings.Split(set, ", ") {
+			parts := strings.Split(strings.TrimSpace(assignment), " = ")
+			if len(parts) != 2 {
+				continue
+			}
+			if val, ok := params.ExpressionAttributeValues[strings.TrimSpace(parts[1])]; ok {
+				item[name(strings.TrimSpace(parts[0]))] = val
+			}
+		}
+	}
+	if idx := strings.Index(expr, "REMOVE "); idx != -1 {
+		remove := expr[idx+7:]
+		if end := strings.Index(remove, " SET"); end != -1 {
+			remove = remove[:end]
+		}
+		for _, attr := range strings.Split(remove, ", ") {
+			delete(item, name(strings.TrimSpace(attr)))
+		}
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+// table returns the items of table, creating it. d.mu is held.
+func (d *DynamoDB) table(name string) map[string]map[string]types.AttributeValue {
+	items, ok := d.tables[name]
+	if !ok {
+		items = make(map[string]map[string]types.AttributeValue)
+		d.tables[name] = items
+	}
+	return items
+}
+
+// itemKey returns the storage key of item in table from its key attributes.
+// d.mu is held.
+func (d *DynamoDB) itemKey(table string, item map[string]types.AttributeValue) string {
+	names := d.keys[table]
+	if len(names) == 0 {
+		names = guessKeyNames(item)
+	}
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+"="+attributeString(item[name]))
+	}
+	return strings.Join(parts, "#")
+}
+
+// guessKeyNames returns the first common partition and sort key names item
+// has, or else up to two of its string and number attributes by name.
+func guessKeyNames(item map[string]types.AttributeValue) []string {
+	var names []string
+	for _, candidates := range [][]string{defaultPartitionKeys, defaultSortKeys} {
+		for _, name := range candidates {
+			if attributeString(item[name]) != "" {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	if len(names) > 0 {
+		return names
+	}
+	for name, v := range item {
+		if attributeString(v) != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) > 2 {
+		names = names[:2]
+	}
+	return names
+}
+
+// attributeString returns the value of a string or number attribute, or "".
+func attributeString(av types.AttributeValue) string {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value
+	case *types.AttributeValueMemberN:
+		return v.Value
+	default:
+		return ""
+	}
+}
+
+// Item returns the item of table with key, or nil.
+// Example:
+//
+//	item := ddb.Item("orders", ddbpitrtest.Key("pk", "1", "sk", "2"))
+func (d *DynamoDB) Item(table string, key map[string]types.AttributeValue) map[string]types.AttributeValue {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tables[table][d.itemKey(table, key)]
+}
+
+// ItemExists reports whether table has an item with key.
+// Example:
+//
+//	if ddb.ItemExists("orders", ddbpitrtest.Key("pk", "1", "sk", "2")) { ... }
+func (d *DynamoDB) ItemExists(table string, key map[string]types.AttributeValue) bool {
+	return d.Item(table, key) != nil
+}
+
+// Items returns the items of table in no particular order.
+// Example:
+//
+//	items := ddb.Items("orders")
+func (d *DynamoDB) Items(table string) []map[string]types.AttributeValue {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	items := make([]map[string]types.AttributeValue, 0, len(d.tables[table]))
+	for _, item := range d.tables[table] {
+		items = append(items, item)
+	}
+	return items
+}
+
+// AssertItem fails t unless table has an item with key, and returns it.
+// Example:
+//
+//	item := ddb.AssertItem(t, "orders", ddbpitrtest.Key("pk", "1", "sk", "2"))
+func (d *DynamoDB) AssertItem(t testing.TB, table string, key map[string]types.AttributeValue) map[string]types.AttributeValue {
+	t.Helper()
+	item := d.Item(table, key)
+	if item == nil {
+		t.Fatalf("%s: expected item %s to exist", table, d.describeKey(table, key))
+	}
+	return item
+}
+
+// AssertNoItem fails t if table has an item with key.
+// Example:
+//
+//	ddb.AssertNoItem(t, "orders", ddbpitrtest.Key("pk", "1", "sk", "1"))
+func (d *DynamoDB) AssertNoItem(t testing.TB, table string, key map[string]types.AttributeValue) {
+	t.Helper()
+	if d.Item(table, key) != nil {
+		t.Fatalf("%s: expected item %s not to exist", table, d.describeKey(table, key))
+	}
+}
+
+// AssertItemCount fails t unless table has n items.
+// Example:
+//
+//	ddb.AssertItemCount(t, "orders", 3)
+func (d *DynamoDB) AssertItemCount(t testing.TB, table string, n int) {
+	t.Helper()
+	if got := len(d.Items(table)); got != n {
+		t.Fatalf("%s: expected %d items, got %d", table, n, got)
+	}
+}
+
+// describeKey formats key for assertion messages.
+func (d *DynamoDB) describeKey(table string, key map[string]types.AttributeValue) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return fmt.Sprintf("{%s}", strings.ReplaceAll(d.itemKey(table, key), "#", ", "))
+}
+
+// BatchWrites returns the BatchWriteItem calls made, including failed ones.
+func (d *DynamoDB) BatchWrites() []dynamodb.BatchWriteItemInput {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]dynamodb.BatchWriteItemInput(nil), d.batchWrites...)
+}
+
+// Updates returns the UpdateItem calls made, including failed ones.
+func (d *DynamoDB) Updates() []dynamodb.UpdateItemInput {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]dynamodb.UpdateItemInput(nil), d.updates...)
+}
+
+// Reset removes every item and recorded call and cancels pending failures.
+// Key schemas are kept.
+func (d *DynamoDB) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tables = make(map[string]map[string]map[string]types.AttributeValue)
+	d.batchWrites, d.updates, d.failures, d.unprocessed = nil, nil, nil, 0
+}
@@ -0,0 +1,429 @@
+package ddbpitrtest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	json "github.com/goccy/go-json"
+)
+
+// ExportSpec describes a synthetic export chain: a FULL export of Items items
+// followed by Incrementals INCREMENTAL exports of contiguous windows. The
+// inserts, updates and deletes are spread evenly over the incremental exports,
+// and each touches a distinct item of its export, as DynamoDB writes one record
+// per changed item. Zero values take the defaults noted.
+type ExportSpec struct {
+	Bucket       string        // Bucket the manifests name (default "ddbpitrtest")
+	Prefix       string        // S3 prefix of the exports, without the AWSDynamoDB/ part
+	Table        string        // Table name of the ARNs (default "synthetic")
+	Items        int           // Items of the FULL export
+	Incrementals int           // INCREMENTAL exports after the FULL one
+	Inserts      int           // New items across the incremental exports
+	Updates      int           // Updated items across the incremental exports
+	Deletes      int           // Deleted items across the incremental exports
+	DataFiles    int           // Data files per export (default 1)
+	ItemBytes    int           // Size of each item's payload attribute (default 64)
+	Seed         uint64        // Seed of the generated keys and values
+	ExportTime   time.Time     // Point in time of the FULL export (default 2026-01-01T00:00:00Z)
+	Interval     time.Duration // Window of each incremental export (default 15m)
+}
+
+// GeneratedExport is one export written by GenerateExports.
+type GeneratedExport struct {
+	ID          string // Export ID, such as 01767225600000-1a2b3c4d
+	Type        string // FULL_EXPORT or INCREMENTAL_EXPORT
+	ManifestKey string // S3 key of its manifest-summary.json
+	Records     int    // Records in its data files
+}
+
+// URI returns the export's manifest-summary.json URI in bucket.
+// Example:
+//
+//	uri := export.URI("my-bucket") // s3://my-bucket/AWSDynamoDB/.../manifest-summary.json
+func (e GeneratedExport) URI(bucket string) string {
+	return "s3://" + bucket + "/" + e.ManifestKey
+}
+
+// GeneratedExports lists the exports GenerateExports wrote, FULL first, and
+// the table's items after the last one.
+type GeneratedExports struct {
+	Exports []GeneratedExport
+	Final   map[string]map[string]types.AttributeValue // Items by pk
+}
+
+// generatorEpoch is the default FULL export time, fixed so generated trees
+// are reproducible.
+var generatorEpoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// dataFileName encodes data file names like DynamoDB's: 26 base32 characters.
+var dataFileName = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// GenerateExports writes the export chain of spec under dir in the layout
+// DynamoDB writes to S3, keyed from dir as from the bucket root: manifests with
+// their .md5 files and _started markers, and gzipped DYNAMODB_JSON data files
+// whose md5Checksum matches. Uploaded without multipart, the ETags S3 gives
+// the data files match the manifests too. The same spec writes the same bytes.
+// Example:
+//
+//	gen, err := ddbpitrtest.GenerateExports(dir, ddbpitrtest.ExportSpec{Items: 10000, Incrementals: 2, Updates: 500})
+//	s3c := ddbpitrtest.NewS3()
+//	err = s3c.LoadExports("ddbpitrtest", dir)
+//	uris := []string{gen.Exports[0].URI("ddbpitrtest"), gen.Exports[1].URI("ddbpitrtest")}
+func GenerateExports(dir string, spec ExportSpec) (GeneratedExports, error) {
+	if spec.Items < 0 || spec.Incrementals < 0 || spec.Inserts < 0 || spec.Updates < 0 || spec.Deletes < 0 {
+		return GeneratedExports{}, fmt.Errorf("export spec counts must not be negative")
+	}
+	if spec.Incrementals == 0 && spec.Inserts+spec.Updates+spec.Deletes > 0 {
+		return GeneratedExports{}, fmt.Errorf("inserts, updates and deletes need at least one incremental export")
+	}
+	if spec.Bucket == "" {
+		spec.Bucket = "ddbpitrtest"
+	}
+	if spec.Table == "" {
+		spec.Table = "synthetic"
+	}
+	if spec.DataFiles <= 0 {
+		spec.DataFiles = 1
+	}
+	if spec.ItemBytes <= 0 {
+		spec.ItemBytes = 64
+	}
+	if spec.ExportTime.IsZero() {
+		spec.ExportTime = generatorEpoch
+	}
+	if spec.Interval <= 0 {
+		spec.Interval = 15 * time.Minute
+	}
+
+	g := &generator{
+		dir:  dir,
+		spec: spec,
+		rng:  rand.New(rand.NewPCG(spec.Seed, spec.Seed^0x9e3779b97f4a7c15)),
+		live: make(map[string]map[string]types.AttributeValue, spec.Items),
+	}
+	var out GeneratedExports
+	full, err := g.full()
+	if err != nil {
+		return GeneratedExports{}, err
+	}
+	out.Exports = append(out.Exports, full)
+	for i := range spec.Incrementals {
+		inc, err := g.incremental(i)
+		if err != nil {
+			return GeneratedExports{}, err
+		}
+		out.Exports = append(out.Exports, inc)
+	}
+	out.Final = g.live
+	return out, nil
+}
+
+// generator holds the state of GenerateExports between exports.
+type generator struct {
+	dir    string
+	spec   ExportSpec
+	rng    *rand.Rand
+	live   map[string]map[string]types.AttributeValue // Items by pk
+	nextID int                                        // Number of the next inserted item
+}
+
+// item returns a new item n at version.
+func (g *generator) item(n, version int) map[string]types.AttributeValue {
+	payload := make([]byte, g.spec.ItemBytes)
+	for i := range payload {
+		payload[i] = "abcdefghijklmnopqrstuvwxyz0123456789"[g.rng.IntN(36)]
+	}
+	return map[string]types.AttributeValue{
+		"pk":      &types.AttributeValueMemberS{Value: fmt.Sprintf("ITEM#%08d", n)},
+		"sk":      &types.AttributeValueMemberS{Value: "DATA"},
+		"version": &types.AttributeValueMemberN{Value: strconv.Itoa(version)},
+		"payload": &types.AttributeValueMemberS{Value: string(payload)},
+		"tags":    &types.AttributeValueMemberSS{Value: []string{"gen", fmt.Sprintf("bucket-%d", n%16)}},
+	}
+}
+
+// keys returns the key attributes of item.
+func keys(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{"pk": item["pk"], "sk": item["sk"]}
+}
+
+// exportID returns a DynamoDB-style export ID for an export started at t.
+func (g *generator) exportID(t time.Time) string {
+	return fmt.Sprintf("%013d-%08x", t.UnixMilli(), g.rng.Uint32())
+}
+
+// prefixed returns key under the spec's prefix.
+func (g *generator) prefixed(key string) string {
+	if g.spec.Prefix == "" {
+		return key
+	}
+	return path.Join(strings.Trim(g.spec.Prefix, "/"), key)
+}
+
+// full writes the FULL export of spec.Items items.
+func (g *generator) full() (GeneratedExport, error) {
+	records := make([][]byte, 0, g.spec.Items)
+	for range g.spec.Items {
+		item := g.item(g.nextID, 1)
+		g.nextID++
+		g.live[pk(item)] = item
+		line, err := json.Marshal(map[string]any{"Item": dynamoJSON(item)})
+		if err != nil {
+			return GeneratedExport{}, err
+		}
+		records = append(records, line)
+	}
+	at := g.spec.ExportTime
+	id := g.exportID(at)
+	return g.write(id, "FULL_EXPORT", "AWSDynamoDB/"+id+"/data/", records, exportSummary{
+		StartTime:  formatExportTime(at),
+		EndTime:    formatExportTime(at.Add(5 * time.Minute)),
+		ExportTime: formatExportTime(at),
+	})
+}
+
+// incremental writes incremental export i of the window after the previous
+// export.
+func (g *generator) incremental(i int) (GeneratedExport, error) {
+	share := func(total int) int {
+		n := total / g.spec.Incrementals
+		if i < total%g.spec.Incrementals {
+			n++
+		}
+		return n
+	}
+	inserts, updates, deletes := share(g.spec.Inserts), share(g.spec.Updates), share(g.spec.Deletes)
+
+	// Updates and deletes touch distinct items that existed before the window
+	existing := make([]string, 0, len(g.live))
+	for k := range g.live {
+		existing = append(existing, k)
+	}
+	sort.Strings(existing)
+	g.rng.Shuffle(len(existing), func(a, b int) { existing[a], existing[b] = existing[b], existing[a] })
+	if updates+deletes > len(existing) {
+		return GeneratedExport{}, fmt.Errorf("incremental export %d updates and deletes %d items, but only %d exist", i+1, updates+deletes, len(existing))
+	}
+
+	type change struct {
+		old, new map[string]types.AttributeValue
+	}
+	var changes []change
+	for _, k := range existing[:updates] {
+		old := g.live[k]
+		version, _ := strconv.Atoi(old["version"].(*types.AttributeValueMemberN).Value)
+		n, _ := strconv.Atoi(strings.TrimPrefix(k, "ITEM#"))
+		changes = append(changes, change{old: old, new: g.item(n, version+1)})
+	}
+	for _, k := range existing[updates : updates+deletes] {
+		changes = append(changes, change{old: g.live[k]})
+	}
+	for range inserts {
+		changes = append(changes, change{new: g.item(g.nextID, 1)})
+		g.nextID++
+	}
+	g.rng.Shuffle(len(changes), func(a, b int) { changes[a], changes[b] = changes[b], changes[a] })
+
+	from := g.spec.ExportTime.Add(time.Duration(i) * g.spec.Interval)
+	to := from.Add(g.spec.Interval)
+	records := make([][]byte, 0, len(changes))
+	for n, c := range changes {
+		written := from.Add(g.spec.Interval * time.Duration(n+1) / time.Duration(len(changes)+1))
+		record := map[string]any{
+			"Metadata": map[string]any{"WriteTimestampMicros": map[string]string{"N": strconv.FormatInt(written.UnixMicro(), 10)}},
+		}
+		item := c.new
+		if item == nil {
+			item = c.old
+		}
+		record["Keys"] = dynamoJSON(keys(item))
+		if c.old != nil {
+			record["OldImage"] = dynamoJSON(c.old)
+		}
+		if c.new != nil {
+			record["NewImage"] = dynamoJSON(c.new)
+			g.live[pk(c.new)] = c.new
+		} else {
+			delete(g.live, pk(c.old))
+		}
+		line, err := json.Marshal(record)
+		if err != nil {
+			return GeneratedExport{}, err
+		}
+		records = append(records, line)
+	}
+	id := g.exportID(to)
+	return g.write(id, "INCREMENTAL_EXPORT", "AWSDynamoDB/data/", records, exportSummary{
+		StartTime:      formatExportTime(to),
+		EndTime:        formatExportTime(to.Add(5 * time.Minute)),
+		ExportFromTime: formatExportTime(from),
+		ExportToTime:   formatExportTime(to),
+		OutputView:     "NEW_AND_OLD_IMAGES",
+	})
+}
+
+// pk returns the partition key value of item.
+func pk(item map[string]types.AttributeValue) string {
+	return item["pk"].(*types.AttributeValueMemberS).Value
+}
+
+// exportSummary is manifest-summary.json, with fields in DynamoDB's order.
+type exportSummary struct {
+	Version            string  `json:"version"`
+	ExportArn          string  `json:"exportArn"`
+	StartTime          string  `json:"startTime"`
+	EndTime            string  `json:"endTime"`
+	TableArn           string  `json:"tableArn"`
+	TableID            string  `json:"tableId"`
+	ExportTime         string  `json:"exportTime,omitempty"`
+	ExportFromTime     string  `json:"exportFromTime,omitempty"`
+	ExportToTime       string  `json:"exportToTime,omitempty"`
+	S3Bucket           string  `json:"s3Bucket"`
+	S3Prefix           *string `json:"s3Prefix"`
+	S3SseAlgorithm     string  `json:"s3SseAlgorithm"`
+	S3SseKmsKeyID      *string `json:"s3SseKmsKeyId"`
+	ManifestFilesS3Key string  `json:"manifestFilesS3Key"`
+	BilledSizeBytes    int64   `json:"billedSizeBytes"`
+	ItemCount          int     `json:"itemCount"`
+	OutputFormat       string  `json:"outputFormat"`
+	OutputView         string  `json:"outputView,omitempty"`
+	ExportType         string  `json:"exportType"`
+}
+
+// write writes export id: its records spread over the spec's data files under
+// dataDir, manifest-files.json, manifest-summary.json completed from summary,
+// their .md5 files and _started.
+func (g *generator) write(id, exportType, dataDir string, records [][]byte, summary exportSummary) (GeneratedExport, error) {
+	exportDir := g.prefixed("AWSDynamoDB/" + id + "/")
+	var files bytes.Buffer
+	var billed int64
+	for f := range g.spec.DataFiles {
+		lo, hi := f*len(records)/g.spec.DataFiles, (f+1)*len(records)/g.spec.DataFiles
+		var raw bytes.Buffer
+		for _, line := range records[lo:hi] {
+			raw.Write(line)
+			raw.WriteByte('\n')
+		}
+		billed += int64(raw.Len())
+		var gz bytes.Buffer
+		zw := gzip.NewWriter(&gz)
+		if _, err := zw.Write(raw.Bytes()); err != nil {
+			return GeneratedExport{}, err
+		}
+		if err := zw.Close(); err != nil {
+			return GeneratedExport{}, err
+		}
+		name := make([]byte, 16)
+		for i := range name {
+			name[i] = byte(g.rng.Uint32())
+		}
+		key := g.prefixed(dataDir + dataFileName.EncodeToString(name)[:26] + ".json.gz")
+		if err := g.writeFile(key, gz.Bytes()); err != nil {
+			return GeneratedExport{}, err
+		}
+		sum := md5.Sum(gz.Bytes())
+		entry, err := json.Marshal(struct {
+			ItemCount     int    `json:"itemCount"`
+			MD5Checksum   string `json:"md5Checksum"`
+			ETag          string `json:"etag"`
+			DataFileS3Key string `json:"dataFileS3Key"`
+		}{hi - lo, base64.StdEncoding.EncodeToString(sum[:]), fmt.Sprintf("%x", sum), key})
+		if err != nil {
+			return GeneratedExport{}, err
+		}
+		files.Write(entry)
+		files.WriteByte('\n')
+	}
+
+	tableArn := "arn:aws:dynamodb:us-east-1:123456789012:table/" + g.spec.Table
+	summary.Version = "2023-08-01"
+	summary.ExportArn = tableArn + "/export/" + id
+	summary.TableArn = tableArn
+	summary.TableID = fmt.Sprintf("%08x-0000-4000-8000-%012x", uint32(g.spec.Seed), g.spec.Seed&0xffffffffffff)
+	summary.S3Bucket = g.spec.Bucket
+	if g.spec.Prefix != "" {
+		prefix := strings.Trim(g.spec.Prefix, "/")
+		summary.S3Prefix = &prefix
+	}
+	summary.S3SseAlgorithm = "AES256"
+	summary.ManifestFilesS3Key = exportDir + "manifest-files.json"
+	summary.BilledSizeBytes = billed
+	summary.ItemCount = len(records)
+	summary.OutputFormat = "DYNAMODB_JSON"
+	summary.ExportType = exportType
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		return GeneratedExport{}, err
+	}
+
+	for name, body := range map[string][]byte{
+		"manifest-files.json":   files.Bytes(),
+		"manifest-summary.json": summaryJSON,
+		"_started":              nil,
+	} {
+		if err := g.writeFile(exportDir+name, body); err != nil {
+			return GeneratedExport{}, err
+		}
+		if name != "_started" {
+			sum := md5.Sum(body)
+			if err := g.writeFile(exportDir+strings.TrimSuffix(name, ".json")+".md5", []byte(base64.StdEncoding.EncodeToString(sum[:]))); err != nil {
+				return GeneratedExport{}, err
+			}
+		}
+	}
+	return GeneratedExport{ID: id, Type: exportType, ManifestKey: exportDir + "manifest-summary.json", Records: len(records)}, nil
+}
+
+// writeFile writes body to the file of S3 key under g.dir.
+func (g *generator) writeFile(key string, body []byte) error {
+	p := filepath.Join(g.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", key, err)
+	}
+	if err := os.WriteFile(p, body, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return nil
+}
+
+// formatExportTime formats t as manifests do, in UTC with milliseconds.
+func formatExportTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// dynamoJSON returns item in DynamoDB JSON, the format of export records.
+func dynamoJSON(item map[string]types.AttributeValue) map[string]any {
+	out := make(map[string]any, len(item))
+	for name, v := range item {
+		out[name] = attributeJSON(v)
+	}
+	return out
+}
+
+// attributeJSON returns the DynamoDB JSON of the attribute types the
+// generator writes.
+func attributeJSON(v types.AttributeValue) map[string]any {
+	switch v := v.(type) {
+	case *types.AttributeValueMemberS:
+		return map[string]any{"S": v.Value}
+	case *types.AttributeValueMemberN:
+		return map[string]any{"N": v.Value}
+	case *types.AttributeValueMemberSS:
+		return map[string]any{"SS": v.Value}
+	default:
+		panic(fmt.Sprintf("ddbpitrtest: unsupported attribute type %T", v))
+	}
+}
@@ -0,0 +1,287 @@
+package ddbpitrtest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	json "github.com/goccy/go-json"
+)
+
+// S3 is an in-memory S3 client implementing GetObject, PutObject and
+// HeadObject. GetObject honors byte ranges and IfMatch, so streamers reading
+// ahead or resuming mid-file behave as against S3.
+// Example:
+//
+//	s3c := ddbpitrtest.NewS3()
+//	if err := s3c.LoadExports("my-bucket", "testdata"); err != nil { ... }
+//	loader := manifest.NewS3Loader(s3c)
+type S3 struct {
+	mu       sync.Mutex
+	objects  map[string]object // Objects by bucket/key
+	failures map[string]error  // Errors of failing objects by bucket/key
+}
+
+// object is an object's content and ETag.
+type object struct {
+	body     []byte
+	etag     string
+	metadata map[string]string
+}
+
+// NewS3 creates an S3 without objects.
+// Example:
+//
+//	s3c := ddbpitrtest.NewS3()
+func NewS3() *S3 {
+	return &S3{
+		objects:  make(map[string]object),
+		failures: make(map[string]error),
+	}
+}
+
+// Put stores body as the object key of bucket, with an ETag of its MD5 like
+// S3 gives single-part uploads.
+// Example:
+//
+//	s3c.Put("my-bucket", "AWSDynamoDB/0123-abcd/manifest-summary.json", summary)
+func (s *S3) Put(bucket, key string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[bucket+"/"+key] = object{body: body, etag: fmt.Sprintf("%x", md5.Sum(body))}
+}
+
+// LoadExports stores every file under dir in bucket, keyed by its path
+// relative to dir, so a directory holding AWSDynamoDB/<export id>/ trees as
+// DynamoDB writes them serves those exports. Data files get the ETags their
+// manifest-files.json lists, which the manifest loader checks. Exports name
+// their bucket in manifest-summary.json; bucket should match it.
+// Example:
+//
+//	err := s3c.LoadExports("my-bucket", "../s3exportdata")
+func (s *S3) LoadExports(bucket, dir string) error {
+	var manifests []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		s.Put(bucket, filepath.ToSlash(rel), body)
+		if d.Name() == "manifest-files.json" {
+			manifests = append(manifests, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load exports from %s: %w", dir, err)
+	}
+	for _, path := range manifests {
+		if err := s.setManifestETags(bucket, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setManifestETags sets the ETags of the data files listed in the
+// manifest-files.json at path.
+func (s *S3) setManifestETags(bucket, path string) error {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var file struct {
+			ETag          string `json:"etag"`
+			DataFileS3Key string `json:"dataFileS3Key"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &file); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if obj, ok := s.objects[bucket+"/"+file.DataFileS3Key]; ok && file.ETag != "" {
+			obj.etag = file.ETag
+			s.objects[bucket+"/"+file.DataFileS3Key] = obj
+		}
+	}
+	return scanner.Err()
+}
+
+// FailKey makes calls for the object key of bucket fail with err, or with
+// ErrInjected when err is nil, until RecoverKey is called.
+// Example:
+//
+//	s3c.FailKey("my-bucket", "AWSDynamoDB/data/a.json.gz", nil)
+func (s *S3) FailKey(bucket, key string, err error) {
+	if err == nil {
+		err = ErrInjected
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[bucket+"/"+key] = err
+}
+
+// RecoverKey ends the failures of the object key of bucket set by FailKey.
+// Example:
+//
+//	s3c.RecoverKey("my-bucket", "AWSDynamoDB/data/a.json.gz")
+func (s *S3) RecoverKey(bucket, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failures, bucket+"/"+key)
+}
+
+// Object returns the content of the object key of bucket, and whether it
+// exists.
+// Example:
+//
+//	body, ok := s3c.Object("my-bucket", "checkpoints/restore.json")
+func (s *S3) Object(bucket, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[bucket+"/"+key]
+	return obj.body, ok
+}
+
+// lookup returns the object of bucket and key, or the error S3 would return.
+func (s *S3) lookup(bucket, key *string, head bool) (object, error) {
+	name := aws.ToString(bucket) + "/" + aws.ToString(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err, ok := s.failures[name]; ok {
+		return object{}, err
+	}
+	obj, ok := s.objects[name]
+	if !ok {
+		if head {
+			return object{}, &types.NotFound{Message: aws.String("Not Found")}
+		}
+		return object{}, &types.NoSuchKey{Message: aws.String("The specified key does not exist: " + aws.ToString(key))}
+	}
+	return obj, nil
+}
+
+// GetObject returns the object, or the bytes of params.Range.
+func (s *S3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	obj, err := s.lookup(params.Bucket, params.Key, false)
+	if err != nil {
+		return nil, err
+	}
+	etag := `"` + obj.etag + `"`
+	if params.IfMatch != nil && *params.IfMatch != etag {
+		return nil, &smithy.GenericAPIError{Code: "PreconditionFailed", Message: "At least one of the pre-conditions you specified did not hold"}
+	}
+	out := &s3.GetObjectOutput{ETag: aws.String(etag), Metadata: obj.metadata}
+	body := obj.body
+	if params.Range != nil {
+		start, end, err := parseRange(*params.Range, int64(len(body)))
+		if err != nil {
+			return nil, err
+		}
+		out.ContentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end, len(body)))
+		body = body[start : end+1]
+	}
+	out.ContentLength = aws.Int64(int64(len(body)))
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	return out, nil
+}
+
+// parseRange returns the first and last byte of a range such as "bytes=10-"
+// or "bytes=10-19" in an object of size bytes.
+func parseRange(r string, size int64) (int64, int64, error) {
+	first, last, ok := strings.Cut(strings.TrimPrefix(r, "bytes="), "-")
+	start, err := strconv.ParseInt(first, 10, 64)
+	if !ok || err != nil {
+		return 0, 0, fmt.Errorf("ddbpitrtest: unsupported range %q", r)
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("ddbpitrtest: unsupported range %q", r)
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return 0, 0, &smithy.GenericAPIError{Code: "InvalidRange", Message: "The requested range is not satisfiable"}
+	}
+	return start, end, nil
+}
+
+// PutObject stores the object.
+func (s *S3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	name := aws.ToString(params.Bucket) + "/" + aws.ToString(params.Key)
+	s.mu.Lock()
+	err, fail := s.failures[name]
+	s.mu.Unlock()
+	if fail {
+		return nil, err
+	}
+	var body []byte
+	if params.Body != nil {
+		if body, err = io.ReadAll(params.Body); err != nil {
+			return nil, err
+		}
+	}
+	s.Put(aws.ToString(params.Bucket), aws.ToString(params.Key), body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj := s.objects[name]
+	obj.metadata = params.Metadata
+	s.objects[name] = obj
+	return &s3.PutObjectOutput{ETag: aws.String(`"` + obj.etag + `"`)}, nil
+}
+
+// HeadObject returns the object's size, ETag and metadata.
+func (s *S3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	obj, err := s.lookup(params.Bucket, params.Key, true)
+	if err != nil {
+		return nil, err
+	}
+	return &s3.HeadObjectOutput{
+		ETag:          aws.String(`"` + obj.etag + `"`),
+		ContentLength: aws.Int64(int64(len(obj.body))),
+		Metadata:      obj.metadata,
+	}, nil
+}
+
+// CreateMultipartUpload fails; it exists so S3 satisfies s3streamer.S3Client.
+func (s *S3) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return nil, errors.New("ddbpitrtest: multipart uploads are not supported")
+}
+
+// UploadPart fails; it exists so S3 satisfies s3streamer.S3Client.
+func (s *S3) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	return nil, errors.New("ddbpitrtest: multipart uploads are not supported")
+}
+
+// CompleteMultipartUpload fails; it exists so S3 satisfies s3streamer.S3Client.
+func (s *S3) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return nil, errors.New("ddbpitrtest: multipart uploads are not supported")
+}
+
+// AbortMultipartUpload fails; it exists so S3 satisfies s3streamer.S3Client.
+func (s *S3) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return nil, errors.New("ddbpitrtest: multipart uploads are not supported")
+}
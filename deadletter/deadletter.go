@@ -0,0 +1,189 @@
+// Package deadletter records operations that could not be applied to the target
+// table. A dead-letter record carries enough data to retry or triage the failure
+// later without re-reading the export, so a single bad item does not stop a restore.
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/oprecord"
+)
+
+// Record is a single dead-lettered operation. Its operation fields have the
+// shape of an incremental export line, so records can be fed back through
+// itemimage.JSONDecoder.
+type Record struct {
+	oprecord.Record
+	Time         time.Time       `json:"Time"`                   // When the operation was dead-lettered
+	Table        string          `json:"Table,omitempty"`        // Table that rejected the operation
+	CurrentImage json.RawMessage `json:"CurrentImage,omitempty"` // Item as stored when a condition check failed, DynamoDB JSON
+	Error        string          `json:"Error"`                  // Error that caused the dead-letter
+	Line         string          `json:"Line,omitempty"`         // Raw export line of a CORRUPT record
+}
+
+// NewRecord builds a Record from an operation and the error that rejected it.
+// When cause is a conditional check failure that returned the stored item, the
+// item is kept as CurrentImage.
+// Example:
+//
+//	rec, err := deadletter.NewRecord(op, writeErr)
+//	if err != nil {
+//	    return err
+//	}
+//	err = sink.Write(ctx, rec)
+func NewRecord(op itemimage.Operation, cause error) (Record, error) {
+	r, err := oprecord.New(op)
+	if err != nil {
+		return Record{}, err
+	}
+	rec := Record{Record: r, Time: time.Now().UTC(), Error: cause.Error()}
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(cause, &conditionErr) {
+		if rec.CurrentImage, err = oprecord.MarshalImage(conditionErr.Item); err != nil {
+			return Record{}, fmt.Errorf("failed to encode current image: %w", err)
+		}
+	}
+	return rec, nil
+}
+
+// NewCorruptRecord builds a Record for an export line that failed to decode,
+// keeping the raw line so it can be repaired and replayed.
+// Example:
+//
+//	err = sink.Write(ctx, deadletter.NewCorruptRecord(file.Key, offset, line, decodeErr))
+func NewCorruptRecord(sourceFile string, offset int64, line []byte, cause error) Record {
+	return Record{
+		Record: oprecord.Record{Operation: "CORRUPT", SourceFile: sourceFile, ByteOffset: offset},
+		Time:   time.Now().UTC(),
+		Error:  cause.Error(),
+		Line:   string(line),
+	}
+}
+
+// Sink receives dead-lettered records.
+// Example:
+//
+//	var sink deadletter.Sink
+//	err := sink.Write(ctx, rec)
+type Sink interface {
+	Write(ctx context.Context, rec Record) error
+}
+
+// FileSink appends records as JSON lines to a local file.
+// It is safe for concurrent use by multiple workers.
+// Example:
+//
+//	sink, err := deadletter.NewFileSink("file:///var/tmp/restore-001.deadletter.jsonl")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer sink.Close()
+type FileSink struct {
+	file  *os.File
+	mu    sync.Mutex
+	count int64
+}
+
+// NewFileSink opens (or creates) the file referenced by a file:// URI for appending.
+// The path must be absolute.
+// Example:
+//
+//	sink, err := deadletter.NewFileSink("file:///var/tmp/restore-001.deadletter.jsonl")
+func NewFileSink(uri string) (*FileSink, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dead-letter URI: %w", err)
+	}
+	if u.Scheme != "file" {
+		return nil, fmt.Errorf("invalid dead-letter URI scheme: %s", u.Scheme)
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		// file://relative/path parses "relative" as the host
+		return nil, fmt.Errorf("dead-letter path must be absolute: %s", uri)
+	}
+
+	path := filepath.Clean(u.Path)
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("dead-letter path must be absolute: %s", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead-letter file: %w", err)
+	}
+	return &FileSink{file: f}, nil
+}
+
+// Write appends rec as one JSON line.
+func (s *FileSink) Write(ctx context.Context, rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead-letter record: %w", err)
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(data); err != nil {
+		return fmt.Errorf("failed to write dead-letter record: %w", err)
+	}
+	s.count++
+	return nil
+}
+
+// Count returns the number of records written so far.
+func (s *FileSink) Count() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Close flushes and closes the underlying file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.file.Sync(); err != nil {
+		_ = s.file.Close()
+		return fmt.Errorf("failed to sync dead-letter file: %w", err)
+	}
+	return s.file.Close()
+}
+
+// MemorySink keeps records in memory. It is primarily intended for testing.
+type MemorySink struct {
+	records []Record
+	mu      sync.Mutex
+}
+
+// NewMemorySink creates a new MemorySink.
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Write stores rec in memory.
+func (s *MemorySink) Write(ctx context.Context, rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, rec)
+	return nil
+}
+
+// Records returns a copy of all stored records.
+func (s *MemorySink) Records() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Record(nil), s.records...)
+}
@@ -0,0 +1,94 @@
+package deadletter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// TestFileSinkRoundTrip writes records through a FileSink and decodes them back,
+// ensuring the images can be fed into itemimage.JSONDecoder for a retry.
+func TestFileSinkRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "dl.jsonl")
+	sink, err := NewFileSink("file://" + path)
+	if err != nil {
+		t.Fatalf("NewFileSink failed: %v", err)
+	}
+
+	op := itemimage.Operation{
+		Type: itemimage.OpPut,
+		Keys: map[string]types.AttributeValue{"PK": &types.AttributeValueMemberS{Value: "a"}},
+		NewImage: map[string]types.AttributeValue{
+			"PK":  &types.AttributeValueMemberS{Value: "a"},
+			"Qty": &types.AttributeValueMemberN{Value: "3"},
+		},
+		SourceFile:           "data/a.json.gz",
+		ByteOffset:           4096,
+		WriteTimestampMicros: 1746609560577628,
+	}
+	rec, err := NewRecord(op, errors.New("ValidationException: item too large"))
+	if err != nil {
+		t.Fatalf("NewRecord failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := sink.Write(context.Background(), rec); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if sink.Count() != 2 {
+		t.Errorf("expected count 2, got %d", sink.Count())
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open output: %v", err)
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines++
+		var got Record
+		if err := json.Unmarshal(scanner.Bytes(), &got); err != nil {
+			t.Fatalf("failed to decode line %d: %v", lines, err)
+		}
+		if got.Operation != "PUT" || got.OldImage != nil {
+			t.Errorf("unexpected record: %+v", got)
+		}
+
+		// The stored record must be a valid export record
+		decoded, err := itemimage.NewJSONDecoder().Decode(scanner.Bytes())
+		if err != nil {
+			t.Fatalf("dead-letter records are not decodable: %v", err)
+		}
+		if decoded.WriteTimestampMicros != 1746609560577628 || got.SourceFile != "data/a.json.gz" || got.ByteOffset != 4096 {
+			t.Errorf("expected the operation's provenance, got %+v", got)
+		}
+		if qty, ok := decoded.NewImage["Qty"].(*types.AttributeValueMemberN); !ok || qty.Value != "3" {
+			t.Errorf("unexpected Qty after round trip: %#v", decoded.NewImage["Qty"])
+		}
+	}
+	if lines != 2 {
+		t.Errorf("expected 2 lines, got %d", lines)
+	}
+}
+
+// TestNewFileSinkRejectsInvalidURIs ensures only absolute file:// URIs are accepted.
+func TestNewFileSinkRejectsInvalidURIs(t *testing.T) {
+	for _, uri := range []string{"s3://bucket/key", "file://relative/path", "::bad"} {
+		if _, err := NewFileSink(uri); err == nil {
+			t.Errorf("expected error for %q", uri)
+		}
+	}
+}
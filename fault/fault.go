@@ -0,0 +1,291 @@
+// Package fault injects failures into the dependencies of a restore, so its
+// behavior under S3, DynamoDB and checkpoint failures can be tested without
+// those services. An Injector decides which calls fail from a list of rules;
+// the Streamer, Decoder, Writer and Store wrappers consult it before passing
+// each call on. The wrappers satisfy the interfaces coordinator.NewCoordinator
+// takes, so tests outside this module can inject faults the same way.
+package fault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/checkpoint"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// ErrInjected is returned by calls failed by a rule without an error of its own.
+var ErrInjected = errors.New("injected fault")
+
+// Point names the calls a rule applies to.
+type Point string
+
+const (
+	PointOpen   Point = "open"   // Streamer.Stream, before the first line
+	PointLine   Point = "line"   // Each line a Streamer passes on
+	PointDecode Point = "decode" // Decoder.Decode and Decoder.DecodeBatch
+	PointWrite  Point = "write"  // Writer.WriteBatch
+	PointFlush  Point = "flush"  // Writer.Flush
+	PointLoad   Point = "load"   // Store.Load
+	PointSave   Point = "save"   // Store.Save
+)
+
+// Rule fails calls at a point. The first After calls pass; from then on each
+// call fails with Probability, until Times calls have failed.
+type Rule struct {
+	Point       Point
+	After       int     // Calls passed before the rule applies
+	Times       int     // Calls failed before the rule expires (0 = never expires)
+	Probability float64 // Chance an applicable call fails (0 = every call)
+	Err         error   // Error of failed calls (nil = ErrInjected)
+}
+
+// MidFileCrash fails a stream after lines lines have been read, once, like a
+// connection reset midway through a data file.
+// Example:
+//
+//	inj := fault.New(1, fault.MidFileCrash(15))
+func MidFileCrash(lines int) Rule {
+	return Rule{Point: PointLine, After: lines, Times: 1, Err: fmt.Errorf("%w: connection reset", ErrInjected)}
+}
+
+// CheckpointOutage fails times checkpoint saves after the first after, like an
+// S3 outage of the checkpoint bucket.
+// Example:
+//
+//	inj := fault.New(1, fault.CheckpointOutage(0, 2))
+func CheckpointOutage(after, times int) Rule {
+	return Rule{Point: PointSave, After: after, Times: times, Err: fmt.Errorf("%w: checkpoint bucket unavailable", ErrInjected)}
+}
+
+// ThrottlingStorm fails times batch writes after the first after with
+// DynamoDB's throughput exceeded error.
+// Example:
+//
+//	inj := fault.New(1, fault.ThrottlingStorm(1, 5))
+func ThrottlingStorm(after, times int) Rule {
+	msg := "injected throttling"
+	return Rule{Point: PointWrite, After: after, Times: times, Err: &types.ProvisionedThroughputExceededException{Message: &msg}}
+}
+
+// Injector decides which calls fail. It is safe for concurrent use; with
+// probabilistic rules, concurrent calls make which call fails vary between
+// runs even with the same seed.
+// Example:
+//
+//	inj := fault.New(42, fault.Rule{Point: fault.PointWrite, Probability: 0.1})
+//	w := fault.NewWriter(writer, inj)
+type Injector struct {
+	mu       sync.Mutex
+	rng      *rand.Rand
+	rules    []rule
+	calls    map[Point]int
+	injected map[Point]int
+}
+
+// rule is a Rule and the calls it has failed.
+type rule struct {
+	Rule
+	failed int
+}
+
+// New creates an Injector applying rules, drawing probabilities from seed.
+// Example:
+//
+//	inj := fault.New(1, fault.MidFileCrash(100), fault.CheckpointOutage(0, 1))
+func New(seed uint64, rules ...Rule) *Injector {
+	inj := &Injector{
+		rng:      rand.New(rand.NewPCG(seed, seed)),
+		calls:    make(map[Point]int),
+		injected: make(map[Point]int),
+	}
+	for _, r := range rules {
+		inj.rules = append(inj.rules, rule{Rule: r})
+	}
+	return inj
+}
+
+// Check counts a call at p and returns the error of the first rule failing it,
+// or nil. The wrappers call it; custom test doubles can too.
+// Example:
+//
+//	if err := inj.Check(fault.PointWrite); err != nil {
+//	    return err
+//	}
+func (i *Injector) Check(p Point) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	call := i.calls[p]
+	i.calls[p]++
+	for n := range i.rules {
+		r := &i.rules[n]
+		if r.Point != p || call < r.After || (r.Times > 0 && r.failed >= r.Times) {
+			continue
+		}
+		if r.Probability > 0 && i.rng.Float64() >= r.Probability {
+			continue
+		}
+		r.failed++
+		i.injected[p]++
+		if r.Err != nil {
+			return r.Err
+		}
+		return ErrInjected
+	}
+	return nil
+}
+
+// Calls returns the calls made at p.
+func (i *Injector) Calls(p Point) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.calls[p]
+}
+
+// Injected returns the calls failed at p.
+func (i *Injector) Injected(p Point) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.injected[p]
+}
+
+// LineStreamer streams the lines of a data file, like s3streamer.Streamer.
+type LineStreamer interface {
+	Stream(ctx context.Context, bucket, key string, offset int64, fn func([]byte, int64) error) error
+}
+
+// Streamer fails streams at PointOpen and PointLine.
+type Streamer struct {
+	next LineStreamer
+	inj  *Injector
+}
+
+// NewStreamer wraps next.
+// Example:
+//
+//	streamer := fault.NewStreamer(stream.NewS3Streamer(client), inj)
+func NewStreamer(next LineStreamer, inj *Injector) *Streamer {
+	return &Streamer{next: next, inj: inj}
+}
+
+// Stream streams key with next, failing before the first line or a line when
+// the injector says so.
+func (s *Streamer) Stream(ctx context.Context, bucket, key string, offset int64, fn func([]byte, int64) error) error {
+	if err := s.inj.Check(PointOpen); err != nil {
+		return err
+	}
+	return s.next.Stream(ctx, bucket, key, offset, func(line []byte, lineOffset int64) error {
+		if err := s.inj.Check(PointLine); err != nil {
+			return err
+		}
+		return fn(line, lineOffset)
+	})
+}
+
+// Decoder fails decodes at PointDecode.
+type Decoder struct {
+	next itemimage.Decoder
+	inj  *Injector
+}
+
+// NewDecoder wraps next.
+// Example:
+//
+//	decoder := fault.NewDecoder(itemimage.NewJSONDecoder(), inj)
+func NewDecoder(next itemimage.Decoder, inj *Injector) *Decoder {
+	return &Decoder{next: next, inj: inj}
+}
+
+// Decode decodes line with next unless the injector fails it.
+func (d *Decoder) Decode(line []byte) (itemimage.Operation, error) {
+	if err := d.inj.Check(PointDecode); err != nil {
+		return itemimage.Operation{}, err
+	}
+	return d.next.Decode(line)
+}
+
+// DecodeBatch decodes lines with next unless the injector fails the batch.
+func (d *Decoder) DecodeBatch(lines [][]byte) ([]itemimage.Operation, error) {
+	if err := d.inj.Check(PointDecode); err != nil {
+		return nil, err
+	}
+	return d.next.DecodeBatch(lines)
+}
+
+// BatchWriter writes batches of operations, like writer.Writer.
+type BatchWriter interface {
+	WriteBatch(ctx context.Context, ops []itemimage.Operation) error
+	Flush(ctx context.Context) error
+}
+
+// Writer fails writes at PointWrite and flushes at PointFlush.
+type Writer struct {
+	next BatchWriter
+	inj  *Injector
+}
+
+// NewWriter wraps next.
+// Example:
+//
+//	w := fault.NewWriter(writer.NewDynamoDBWriter(client, table, 25), inj)
+func NewWriter(next BatchWriter, inj *Injector) *Writer {
+	return &Writer{next: next, inj: inj}
+}
+
+// WriteBatch writes ops with next unless the injector fails the write, in
+// which case nothing is written.
+func (w *Writer) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	if err := w.inj.Check(PointWrite); err != nil {
+		return err
+	}
+	return w.next.WriteBatch(ctx, ops)
+}
+
+// Flush flushes next unless the injector fails it.
+func (w *Writer) Flush(ctx context.Context) error {
+	if err := w.inj.Check(PointFlush); err != nil {
+		return err
+	}
+	return w.next.Flush(ctx)
+}
+
+// StateStore loads and saves checkpoints, like checkpoint.Store.
+type StateStore interface {
+	Load(ctx context.Context) (checkpoint.State, error)
+	Save(ctx context.Context, s checkpoint.State) error
+}
+
+// Store fails loads at PointLoad and saves at PointSave.
+type Store struct {
+	next StateStore
+	inj  *Injector
+}
+
+// NewStore wraps next.
+// Example:
+//
+//	store := fault.NewStore(checkpoint.NewMemoryStore(), inj)
+func NewStore(next StateStore, inj *Injector) *Store {
+	return &Store{next: next, inj: inj}
+}
+
+// Load loads the checkpoint with next unless the injector fails it.
+func (s *Store) Load(ctx context.Context) (checkpoint.State, error) {
+	if err := s.inj.Check(PointLoad); err != nil {
+		return checkpoint.State{}, err
+	}
+	return s.next.Load(ctx)
+}
+
+// Save saves st with next unless the injector fails it, in which case nothing
+// is saved.
+func (s *Store) Save(ctx context.Context, st checkpoint.State) error {
+	if err := s.inj.Check(PointSave); err != nil {
+		return err
+	}
+	return s.next.Save(ctx, st)
+}
@@ -0,0 +1,82 @@
+package fault
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/checkpoint"
+)
+
+// TestRuleWindow verifies a rule passes its first After calls and then fails
+// Times calls, so scripted scenarios fail exactly the calls they describe.
+func TestRuleWindow(t *testing.T) {
+	inj := New(1, Rule{Point: PointSave, After: 2, Times: 3})
+	var failed []int
+	for call := range 8 {
+		if err := inj.Check(PointSave); err != nil {
+			if !errors.Is(err, ErrInjected) {
+				t.Fatalf("expected ErrInjected, got %v", err)
+			}
+			failed = append(failed, call)
+		}
+	}
+	if len(failed) != 3 || failed[0] != 2 || failed[2] != 4 {
+		t.Errorf("expected calls 2-4 to fail, got %v", failed)
+	}
+	if inj.Calls(PointSave) != 8 || inj.Injected(PointSave) != 3 || inj.Calls(PointWrite) != 0 {
+		t.Errorf("unexpected counts: %d calls, %d injected", inj.Calls(PointSave), inj.Injected(PointSave))
+	}
+}
+
+// TestProbabilityIsSeeded checks a probabilistic rule fails about its share of
+// calls and the same calls for the same seed, so a failing scenario can be
+// replayed.
+func TestProbabilityIsSeeded(t *testing.T) {
+	run := func(seed uint64) []bool {
+		inj := New(seed, Rule{Point: PointWrite, Probability: 0.25})
+		out := make([]bool, 1000)
+		for i := range out {
+			out[i] = inj.Check(PointWrite) != nil
+		}
+		return out
+	}
+	a, b := run(7), run(7)
+	failed := 0
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("call %d differs between runs with one seed", i)
+		}
+		if a[i] {
+			failed++
+		}
+	}
+	if failed < 200 || failed > 300 {
+		t.Errorf("expected about 250 of 1000 calls to fail, got %d", failed)
+	}
+}
+
+// TestWrappersFailBeforeCalling verifies a failed call does not reach the
+// wrapped dependency, so an injected save leaves no checkpoint and an
+// injected throttle writes nothing.
+func TestWrappersFailBeforeCalling(t *testing.T) {
+	inj := New(1, CheckpointOutage(0, 1), ThrottlingStorm(0, 1))
+	mem := checkpoint.NewMemoryStore()
+	store := NewStore(mem, inj)
+	if err := store.Save(context.Background(), checkpoint.State{LastFile: "a"}); err == nil {
+		t.Fatal("expected the first save to fail")
+	}
+	if st, _ := mem.Load(context.Background()); st.LastFile != "" {
+		t.Errorf("expected nothing saved, got %+v", st)
+	}
+	if err := store.Save(context.Background(), checkpoint.State{LastFile: "b"}); err != nil {
+		t.Errorf("expected the outage to be over, got %v", err)
+	}
+
+	err := NewWriter(nil, inj).WriteBatch(context.Background(), nil)
+	var throttled *types.ProvisionedThroughputExceededException
+	if !errors.As(err, &throttled) {
+		t.Errorf("expected a throughput exceeded error, got %v", err)
+	}
+}
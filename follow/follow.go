@@ -0,0 +1,232 @@
+// Package follow finds incremental exports that complete after a restore so they
+// can be applied in turn, keeping a standby table close to its source between
+// periodic exports.
+package follow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gurre/ddb-pitr/manifest"
+	"github.com/gurre/ddb-pitr/s3uri"
+)
+
+// ObjectLister is the subset of the S3 client used to discover export directories.
+type ObjectLister interface {
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// Export is a completed incremental export found by a Finder.
+type Export struct {
+	URI     string           // S3 URI of the export's manifest-summary.json
+	Summary manifest.Summary // Loaded manifest
+	From    time.Time        // Parsed ExportFromTime
+	To      time.Time        // Parsed ExportToTime
+	Gap     time.Duration    // Time between the previous export and From whose changes are missing; 0 if contiguous
+
+	receipt string // SQS receipt handle of the event announcing the export; "" for listed exports
+}
+
+// Source discovers completed incremental exports for Follow.
+type Source interface {
+	// Find returns new exports whose ExportToTime is after after, ordered by ExportFromTime.
+	Find(ctx context.Context, after time.Time) ([]Export, error)
+	// Ack is called once an export returned by Find has been applied or skipped.
+	Ack(ctx context.Context, e Export) error
+}
+
+// Finder discovers completed incremental exports of one table next to a known export.
+// Example:
+//
+//	finder, err := follow.NewFinder(s3Client, loader, cfg.ExportS3URI, summary.TableARN)
+//	if err != nil {
+//	    return err
+//	}
+//	exports, err := finder.Find(ctx, watermark)
+type Finder struct {
+	client   ObjectLister
+	loader   manifest.Loader
+	bucket   string
+	prefix   string          // Prefix holding one directory per export, e.g. AWSDynamoDB/
+	tableARN string          // Only exports of this table are returned; "" accepts all
+	seen     map[string]bool // Export directories already loaded
+}
+
+// NewFinder creates a Finder for the exports stored beside exportURI, the
+// manifest-summary.json URI of a restored export. Only exports of tableARN are
+// returned, since several tables may export to the same prefix.
+func NewFinder(client ObjectLister, loader manifest.Loader, exportURI, tableARN string) (*Finder, error) {
+	u, err := s3uri.ParseObject(exportURI)
+	if err != nil {
+		return nil, err
+	}
+	if u.Name() != manifest.SummaryFile || u.Dir().Key == "" {
+		return nil, fmt.Errorf("export URI %s does not point at a %s in an export directory", exportURI, manifest.SummaryFile)
+	}
+
+	// Strip manifest-summary.json and the export directory
+	dir := u.Dir()
+	return &Finder{
+		client:   client,
+		loader:   loader,
+		bucket:   u.Bucket,
+		prefix:   dir.Dir().Key,
+		tableARN: tableARN,
+		seen:     map[string]bool{dir.Key: true},
+	}, nil
+}
+
+// Find returns the completed incremental exports not returned before whose
+// ExportToTime is after after, ordered by ExportFromTime. Exports still being
+// written have no manifest summary yet and are picked up by a later call.
+func (f *Finder) Find(ctx context.Context, after time.Time) ([]Export, error) {
+	dirs, err := f.listExportDirs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var exports []Export
+	for _, dir := range dirs {
+		if f.seen[dir] {
+			continue
+		}
+		uri := s3uri.URI{Bucket: f.bucket, Key: dir}.Join(manifest.SummaryFile).String()
+		summary, err := f.loader.LoadSummary(ctx, uri)
+		if err != nil {
+			var missing *s3types.NoSuchKey
+			if errors.As(err, &missing) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to load export %s: %w", uri, err)
+		}
+		f.seen[dir] = true
+
+		e, ok, err := newExport(uri, summary, f.tableARN, after)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			exports = append(exports, e)
+		}
+	}
+	sort.Slice(exports, func(i, j int) bool { return exports[i].From.Before(exports[j].From) })
+	return exports, nil
+}
+
+// newExport returns the Export for summary if it is an incremental export of
+// tableARN ending after after.
+func newExport(uri string, summary manifest.Summary, tableARN string, after time.Time) (Export, bool, error) {
+	if !summary.IsIncremental() || (tableARN != "" && summary.TableARN != tableARN) {
+		return Export{}, false, nil
+	}
+	from, err := ParseTime(summary.ExportFromTime)
+	if err != nil {
+		return Export{}, false, fmt.Errorf("export %s: %w", uri, err)
+	}
+	to, err := ParseTime(summary.ExportToTime)
+	if err != nil {
+		return Export{}, false, fmt.Errorf("export %s: %w", uri, err)
+	}
+	if !to.After(after) {
+		return Export{}, false, nil
+	}
+	return Export{URI: uri, Summary: summary, From: from, To: to}, true, nil
+}
+
+// Ack implements Source. Listed exports need no acknowledgement.
+func (f *Finder) Ack(ctx context.Context, e Export) error {
+	return nil
+}
+
+// listExportDirs returns every directory directly under the export prefix.
+func (f *Finder) listExportDirs(ctx context.Context) ([]string, error) {
+	var dirs []string
+	input := &s3.ListObjectsV2Input{
+		Bucket:    &f.bucket,
+		Prefix:    &f.prefix,
+		Delimiter: awssdk.String("/"),
+	}
+	for {
+		out, err := f.client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list exports under %s: %w", s3uri.URI{Bucket: f.bucket, Key: f.prefix}, err)
+		}
+		for _, p := range out.CommonPrefixes {
+			if p.Prefix != nil {
+				dirs = append(dirs, *p.Prefix)
+			}
+		}
+		if out.IsTruncated == nil || !*out.IsTruncated {
+			return dirs, nil
+		}
+		input.ContinuationToken = out.NextContinuationToken
+	}
+}
+
+// Follow polls source every interval and calls apply for each new export in
+// order, starting after the time the restored data reflects. An export that
+// starts later than the previous one ended is still applied, with Gap set so the
+// caller can warn about the missing changes. Follow returns nil once ctx is
+// cancelled and the first error from source or apply otherwise.
+// Example:
+//
+//	err := follow.Follow(ctx, finder, 5*time.Minute, watermark, func(ctx context.Context, e follow.Export) error {
+//	    return restore(ctx, e.URI)
+//	})
+func Follow(ctx context.Context, source Source, interval time.Duration, after time.Time,
+	apply func(context.Context, Export) error) error {
+	for {
+		exports, err := source.Find(ctx, after)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		for _, e := range exports {
+			// An earlier export in this round may already cover this one
+			if e.To.After(after) {
+				if e.From.After(after) {
+					e.Gap = e.From.Sub(after)
+				}
+				if err := apply(ctx, e); err != nil {
+					if ctx.Err() != nil {
+						return nil
+					}
+					return err
+				}
+				after = e.To
+			}
+			if err := source.Ack(ctx, e); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// ParseTime parses an RFC 3339 manifest timestamp such as ExportTime or ExportToTime.
+// Example:
+//
+//	watermark, err := follow.ParseTime(summary.PointInTime())
+func ParseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid manifest time %q: %w", s, err)
+	}
+	return t, nil
+}
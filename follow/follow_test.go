@@ -0,0 +1,171 @@
+package follow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gurre/ddb-pitr/manifest"
+)
+
+const testTable = "arn:aws:dynamodb:eu-north-1:123456789123:table/test"
+
+// fakeLister returns dirs one per page to exercise pagination.
+type fakeLister struct {
+	dirs []string
+}
+
+func (f *fakeLister) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	i := 0
+	if params.ContinuationToken != nil {
+		fmt.Sscan(*params.ContinuationToken, &i)
+	}
+	out := &s3.ListObjectsV2Output{}
+	if i < len(f.dirs) {
+		out.CommonPrefixes = []s3types.CommonPrefix{{Prefix: awssdk.String(*params.Prefix + f.dirs[i])}}
+	}
+	if i+1 < len(f.dirs) {
+		out.IsTruncated = awssdk.Bool(true)
+		out.NextContinuationToken = awssdk.String(fmt.Sprint(i + 1))
+	}
+	return out, nil
+}
+
+// fakeLoader serves summaries by URI; missing ones fail like S3 GetObject.
+type fakeLoader struct {
+	summaries map[string]manifest.Summary
+	loads     int
+}
+
+func (f *fakeLoader) Load(ctx context.Context, uri string) (manifest.Summary, error) {
+	return f.LoadSummary(ctx, uri)
+}
+
+func (f *fakeLoader) LoadSummary(ctx context.Context, uri string) (manifest.Summary, error) {
+	f.loads++
+	s, ok := f.summaries[uri]
+	if !ok {
+		return manifest.Summary{}, fmt.Errorf("failed to get manifest summary: %w", &s3types.NoSuchKey{})
+	}
+	return s, nil
+}
+
+func (f *fakeLoader) Files(ctx context.Context, summary manifest.Summary) iter.Seq2[manifest.FileMeta, error] {
+	return func(yield func(manifest.FileMeta, error) bool) {}
+}
+
+func (f *fakeLoader) VerifyChecksums(ctx context.Context, summary manifest.Summary) error {
+	return nil
+}
+
+func incremental(table, from, to string) manifest.Summary {
+	return manifest.Summary{
+		TableARN:       table,
+		ExportType:     manifest.ExportTypeIncremental,
+		ExportFromTime: from,
+		ExportToTime:   to,
+	}
+}
+
+func uri(dir string) string {
+	return "s3://bucket/exports/AWSDynamoDB/" + dir + "/manifest-summary.json"
+}
+
+// TestFinderSelectsNewIncrementalExports verifies that only completed incremental
+// exports of the restored table that end after the watermark are returned, in
+// order, and that an export still in progress is found once it completes.
+func TestFinderSelectsNewIncrementalExports(t *testing.T) {
+	lister := &fakeLister{dirs: []string{"001-full/", "002-old/", "003-b/", "004-a/", "005-other/", "006-running/", "data/"}}
+	loader := &fakeLoader{summaries: map[string]manifest.Summary{
+		uri("002-old"):   incremental(testTable, "2026-01-14T09:00:00.000Z", "2026-01-14T10:00:00.000Z"),
+		uri("003-b"):     incremental(testTable, "2026-01-14T10:35:00.000Z", "2026-01-14T10:50:00.000Z"),
+		uri("004-a"):     incremental(testTable, "2026-01-14T10:20:00.000Z", "2026-01-14T10:35:00.000Z"),
+		uri("005-other"): incremental("arn:aws:dynamodb:eu-north-1:123456789123:table/other", "2026-01-14T10:20:00.000Z", "2026-01-14T10:35:00.000Z"),
+	}}
+	finder, err := NewFinder(lister, loader, uri("001-full"), testTable)
+	if err != nil {
+		t.Fatalf("NewFinder: %v", err)
+	}
+
+	watermark, _ := ParseTime("2026-01-14T10:18:50.622Z")
+	exports, err := finder.Find(context.Background(), watermark)
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if len(exports) != 2 || exports[0].URI != uri("004-a") || exports[1].URI != uri("003-b") {
+		t.Fatalf("expected 004-a then 003-b, got %+v", exports)
+	}
+
+	loader.summaries[uri("006-running")] = incremental(testTable, "2026-01-14T10:50:00.000Z", "2026-01-14T11:05:00.000Z")
+	loads := loader.loads
+	exports, err = finder.Find(context.Background(), exports[1].To)
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if len(exports) != 1 || exports[0].URI != uri("006-running") {
+		t.Fatalf("expected the completed export, got %+v", exports)
+	}
+	// Only the two directories without a summary are loaded again
+	if got := loader.loads - loads; got != 2 {
+		t.Errorf("expected 2 loads, got %d", got)
+	}
+}
+
+// TestNewFinderRejectsNonManifestURIs ensures the export prefix is only derived
+// from a manifest-summary.json URI.
+func TestNewFinderRejectsNonManifestURIs(t *testing.T) {
+	for _, u := range []string{"s3://bucket/AWSDynamoDB/001/", "https://bucket/001/manifest-summary.json", "s3://bucket"} {
+		if _, err := NewFinder(&fakeLister{}, &fakeLoader{}, u, ""); err == nil {
+			t.Errorf("expected error for %s", u)
+		}
+	}
+}
+
+// TestFollowAppliesExportsInOrder verifies exports are applied in order with
+// gaps reported, and that cancellation ends following without an error.
+func TestFollowAppliesExportsInOrder(t *testing.T) {
+	lister := &fakeLister{dirs: []string{"001-full/", "002/", "003/"}}
+	loader := &fakeLoader{summaries: map[string]manifest.Summary{
+		uri("002"): incremental(testTable, "2026-01-14T10:20:00.000Z", "2026-01-14T10:35:00.000Z"),
+		uri("003"): incremental(testTable, "2026-01-14T10:35:00.000Z", "2026-01-14T10:50:00.000Z"),
+	}}
+	finder, err := NewFinder(lister, loader, uri("001-full"), testTable)
+	if err != nil {
+		t.Fatalf("NewFinder: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var applied []Export
+	watermark, _ := ParseTime("2026-01-14T10:19:00Z")
+	err = Follow(ctx, finder, time.Millisecond, watermark, func(ctx context.Context, e Export) error {
+		applied = append(applied, e)
+		if len(applied) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Follow: %v", err)
+	}
+	if len(applied) != 2 || applied[0].URI != uri("002") || applied[1].URI != uri("003") {
+		t.Fatalf("unexpected exports applied: %+v", applied)
+	}
+	if applied[0].Gap != time.Minute || applied[1].Gap != 0 {
+		t.Errorf("expected a 1m gap before the first export only, got %s and %s", applied[0].Gap, applied[1].Gap)
+	}
+
+	// A failed apply stops following
+	finder, _ = NewFinder(lister, loader, uri("001-full"), testTable)
+	boom := errors.New("throttled")
+	err = Follow(context.Background(), finder, time.Millisecond, watermark, func(context.Context, Export) error { return boom })
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected the apply error, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package follow
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/manifest"
+	"github.com/gurre/ddb-pitr/s3uri"
+)
+
+// queueWaitSeconds is the SQS long-poll duration, the maximum SQS allows.
+const queueWaitSeconds = 20
+
+// queueBatchSize is the number of messages received per poll, the maximum SQS allows.
+const queueBatchSize = 10
+
+// QueueClient is the subset of the SQS client used to receive export events.
+type QueueClient interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+// s3Event is the body of an S3 event notification delivered to SQS.
+type s3Event struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key string `json:"key"` // URL-encoded
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// Queue is a Source fed by S3 ObjectCreated events for manifest-summary.json
+// files, delivered to an SQS queue. It reacts to new exports as soon as they
+// complete, without listing the export prefix. A message is deleted once its
+// export has been applied or skipped; messages for other objects, full exports
+// or other tables are deleted as soon as they are received.
+// Example:
+//
+//	queue := follow.NewQueue(sqs.NewFromConfig(awsCfg), loader, queueURL, summary.TableARN)
+//	err := follow.Follow(ctx, queue, 0, watermark, apply)
+type Queue struct {
+	client   QueueClient
+	loader   manifest.Loader
+	queueURL string
+	tableARN string // Only exports of this table are returned; "" accepts all
+}
+
+// NewQueue creates a Queue receiving events from queueURL.
+func NewQueue(client QueueClient, loader manifest.Loader, queueURL, tableARN string) *Queue {
+	return &Queue{client: client, loader: loader, queueURL: queueURL, tableARN: tableARN}
+}
+
+// Find implements Source. It long-polls the queue for up to 20 seconds and
+// returns the exports announced by the received messages.
+func (q *Queue) Find(ctx context.Context, after time.Time) ([]Export, error) {
+	out, err := q.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            &q.queueURL,
+		MaxNumberOfMessages: queueBatchSize,
+		WaitTimeSeconds:     queueWaitSeconds,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive from queue %s: %w", q.queueURL, err)
+	}
+
+	var exports []Export
+	for _, msg := range out.Messages {
+		var found []Export
+		if msg.Body != nil {
+			for _, uri := range summaryURIs(*msg.Body) {
+				summary, err := q.loader.LoadSummary(ctx, uri)
+				if err != nil {
+					// The message is redelivered after its visibility timeout
+					return nil, fmt.Errorf("failed to load export %s: %w", uri, err)
+				}
+				e, ok, err := newExport(uri, summary, q.tableARN, after)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					e.receipt = *msg.ReceiptHandle
+					found = append(found, e)
+				}
+			}
+		}
+		if len(found) == 0 {
+			if err := q.deleteMessage(ctx, *msg.ReceiptHandle); err != nil {
+				return nil, err
+			}
+		}
+		exports = append(exports, found...)
+	}
+	sort.Slice(exports, func(i, j int) bool { return exports[i].From.Before(exports[j].From) })
+	return exports, nil
+}
+
+// Ack implements Source by deleting the message that announced e.
+func (q *Queue) Ack(ctx context.Context, e Export) error {
+	if e.receipt == "" {
+		return nil
+	}
+	return q.deleteMessage(ctx, e.receipt)
+}
+
+// deleteMessage removes a handled message from the queue.
+func (q *Queue) deleteMessage(ctx context.Context, receipt string) error {
+	if _, err := q.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      &q.queueURL,
+		ReceiptHandle: &receipt,
+	}); err != nil {
+		return fmt.Errorf("failed to delete message from queue %s: %w", q.queueURL, err)
+	}
+	return nil
+}
+
+// summaryURIs returns the manifest-summary.json objects created according to an
+// S3 event notification. Test events and unparseable bodies yield none.
+func summaryURIs(body string) []string {
+	var ev s3Event
+	if err := json.Unmarshal([]byte(body), &ev); err != nil {
+		return nil
+	}
+	var uris []string
+	for _, r := range ev.Records {
+		if !strings.HasPrefix(r.EventName, "ObjectCreated:") {
+			continue
+		}
+		key, err := s3uri.DecodeEventKey(r.S3.Object.Key)
+		if err != nil || !strings.HasSuffix(key, "/"+manifest.SummaryFile) {
+			continue
+		}
+		uris = append(uris, s3uri.URI{Bucket: r.S3.Bucket.Name, Key: key}.String())
+	}
+	return uris
+}
@@ -0,0 +1,90 @@
+package follow
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/gurre/ddb-pitr/manifest"
+)
+
+// fakeQueue delivers its messages once and records deletions.
+type fakeQueue struct {
+	messages []sqstypes.Message
+	deleted  []string
+}
+
+func (f *fakeQueue) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	out := &sqs.ReceiveMessageOutput{Messages: f.messages}
+	f.messages = nil
+	return out, nil
+}
+
+func (f *fakeQueue) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	f.deleted = append(f.deleted, *params.ReceiptHandle)
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func s3EventMessage(receipt, eventName, key string) sqstypes.Message {
+	body := fmt.Sprintf(`{"Records":[{"eventName":%q,"s3":{"bucket":{"name":"bucket"},"object":{"key":%q}}}]}`, eventName, key)
+	return sqstypes.Message{ReceiptHandle: awssdk.String(receipt), Body: awssdk.String(body)}
+}
+
+// TestQueueAppliesAnnouncedExports verifies that S3 events for completed
+// incremental exports of the table are returned in order and deleted only once
+// applied, while unrelated events are deleted straight away.
+func TestQueueAppliesAnnouncedExports(t *testing.T) {
+	loader := &fakeLoader{summaries: map[string]manifest.Summary{
+		uri("002"):   incremental(testTable, "2026-01-14T10:20:00.000Z", "2026-01-14T10:35:00.000Z"),
+		uri("003"):   incremental(testTable, "2026-01-14T10:35:00.000Z", "2026-01-14T10:50:00.000Z"),
+		uri("other"): incremental("arn:aws:dynamodb:eu-north-1:123456789123:table/other", "2026-01-14T10:20:00.000Z", "2026-01-14T10:35:00.000Z"),
+	}}
+	client := &fakeQueue{messages: []sqstypes.Message{
+		s3EventMessage("r3", "ObjectCreated:Put", "exports/AWSDynamoDB/003/manifest-summary.json"),
+		s3EventMessage("r2", "ObjectCreated:CompleteMultipartUpload", "exports/AWSDynamoDB/002/manifest-summary.json"),
+		s3EventMessage("r-other", "ObjectCreated:Put", "exports/AWSDynamoDB/other/manifest-summary.json"),
+		s3EventMessage("r-data", "ObjectCreated:Put", "exports/AWSDynamoDB/002/data/a.json.gz"),
+		s3EventMessage("r-removed", "ObjectRemoved:Delete", "exports/AWSDynamoDB/002/manifest-summary.json"),
+		{ReceiptHandle: awssdk.String("r-test"), Body: awssdk.String(`{"Service":"Amazon S3","Event":"s3:TestEvent"}`)},
+	}}
+	queue := NewQueue(client, loader, "https://sqs.eu-north-1.amazonaws.com/123456789123/exports", testTable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var applied []string
+	watermark, _ := ParseTime("2026-01-14T10:20:00Z")
+	err := Follow(ctx, queue, 0, watermark, func(ctx context.Context, e Export) error {
+		applied = append(applied, e.URI)
+		if len(applied) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Follow: %v", err)
+	}
+
+	if len(applied) != 2 || applied[0] != uri("002") || applied[1] != uri("003") {
+		t.Fatalf("expected 002 then 003, got %v", applied)
+	}
+	want := []string{"r-other", "r-data", "r-removed", "r-test", "r2", "r3"}
+	if fmt.Sprint(client.deleted) != fmt.Sprint(want) {
+		t.Errorf("expected deletions %v, got %v", want, client.deleted)
+	}
+}
+
+// TestSummaryURIsDecodesKeys checks object keys, which S3 URL-encodes in events,
+// are decoded before loading.
+func TestSummaryURIsDecodesKeys(t *testing.T) {
+	body := `{"Records":[{"eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"b"},"object":{"key":"my+exports/AWSDynamoDB/01%3Da/manifest-summary.json"}}}]}`
+	uris := summaryURIs(body)
+	if len(uris) != 1 || uris[0] != "s3://b/my exports/AWSDynamoDB/01=a/manifest-summary.json" {
+		t.Errorf("unexpected URIs %v", uris)
+	}
+	if uris := summaryURIs("not json"); uris != nil {
+		t.Errorf("expected no URIs for a malformed body, got %v", uris)
+	}
+}
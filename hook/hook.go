@@ -0,0 +1,300 @@
+// Package hook runs a user-supplied command on every batch before it is written,
+// for validation, enrichment or logging a restore cannot express otherwise. The
+// command is a long-running subprocess speaking JSON lines: ddb-pitr writes one
+// request line per batch to its stdin and reads one response line from its
+// stdout.
+//
+// A request names the table and lists the batch's operations as
+// oprecord.Records, shaped like incremental export lines:
+//
+//	{"Table":"orders","Operations":[{"Operation":"PUT","Keys":{...},"NewImage":{...},"SourceFile":"data/a.json.gz","ByteOffset":120}]}
+//
+// Images and keys are DynamoDB JSON, as in an export. The response either
+// replaces the batch with the operations to write, which may be fewer or
+// rewritten, leaves it unchanged by omitting them, or rejects it:
+//
+//	{"Operations":[...]}
+//	{}
+//	{"Error":"order 42 has no customer"}
+//
+// Anything the command writes to stderr is passed through.
+package hook
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/oprecord"
+)
+
+// DefaultTimeout is how long the command has to answer a batch.
+const DefaultTimeout = 30 * time.Second
+
+// ErrRejected wraps the error of a batch the command rejected.
+var ErrRejected = errors.New("write hook rejected the batch")
+
+// request is the line sent for one batch.
+type request struct {
+	Table      string            `json:"Table"`
+	Operations []oprecord.Record `json:"Operations"`
+}
+
+// response is the line the command answers a request with.
+type response struct {
+	Operations *[]oprecord.Record `json:"Operations"` // Operations to write instead of the batch; nil leaves it unchanged
+	Error      string             `json:"Error"`      // Reason the batch is rejected; empty accepts it
+}
+
+// Hook runs the command and exchanges batches with it. Batches are sent one at
+// a time, so a slow command limits the restore's write rate. A command that
+// exits, or misses the timeout and is killed, is started again for the next
+// batch.
+type Hook struct {
+	argv    []string      // Command and its arguments
+	timeout time.Duration // Time the command has to answer a batch
+	stderr  io.Writer     // Receives the command's stderr
+
+	mu     sync.Mutex     // Serializes batches; guards the fields below
+	cmd    *exec.Cmd      // Running command, nil before the first batch or after it failed
+	stdin  io.WriteCloser // Requests to the command
+	stdout *bufio.Reader  // Responses of the command
+}
+
+// Option configures a Hook.
+type Option func(*Hook)
+
+// WithTimeout sets how long the command has to answer a batch before it is
+// killed and the batch fails (default DefaultTimeout).
+// Example:
+//
+//	h, err := hook.New([]string{"./validate"}, hook.WithTimeout(5*time.Second))
+func WithTimeout(d time.Duration) Option {
+	return func(h *Hook) {
+		if d > 0 {
+			h.timeout = d
+		}
+	}
+}
+
+// WithStderr sets where the command's stderr goes (default os.Stderr).
+// Example:
+//
+//	h, err := hook.New([]string{"./validate"}, hook.WithStderr(io.Discard))
+func WithStderr(w io.Writer) Option {
+	return func(h *Hook) {
+		h.stderr = w
+	}
+}
+
+// New returns a hook running argv, the command and its arguments. The command
+// is started with the first batch.
+// Example:
+//
+//	h, err := hook.New([]string{"python3", "enrich.py"})
+//	if err != nil {
+//	    return err
+//	}
+//	defer h.Close()
+func New(argv []string, opts ...Option) (*Hook, error) {
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("write hook command is empty")
+	}
+	h := &Hook{argv: argv, timeout: DefaultTimeout, stderr: os.Stderr}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h, nil
+}
+
+// start runs the command. The caller holds h.mu.
+func (h *Hook) start() error {
+	cmd := exec.Command(h.argv[0], h.argv[1:]...)
+	cmd.Stderr = h.stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to start write hook: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to start write hook: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start write hook %s: %w", h.argv[0], err)
+	}
+	h.cmd, h.stdin, h.stdout = cmd, stdin, bufio.NewReader(stdout)
+	return nil
+}
+
+// stop kills the command so the next batch starts it again. The caller holds h.mu.
+func (h *Hook) stop() {
+	if h.cmd == nil {
+		return
+	}
+	_ = h.cmd.Process.Kill()
+	_ = h.cmd.Wait()
+	h.cmd, h.stdin, h.stdout = nil, nil, nil
+}
+
+// Apply sends the batch of ops written to table to the command and returns the
+// operations to write instead. It fails with ErrRejected when the command
+// rejects the batch, and with the cause when the command fails, answers
+// something other than a response, or misses the timeout.
+// Example:
+//
+//	ops, err := h.Apply(ctx, "orders", ops)
+func (h *Hook) Apply(ctx context.Context, table string, ops []itemimage.Operation) ([]itemimage.Operation, error) {
+	req := request{Table: table, Operations: make([]oprecord.Record, 0, len(ops))}
+	for _, op := range ops {
+		o, err := oprecord.New(op)
+		if err != nil {
+			return nil, err
+		}
+		req.Operations = append(req.Operations, o)
+	}
+	line, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode write hook request: %w", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cmd == nil {
+		if err := h.start(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := h.exchange(ctx, append(line, '\n'))
+	if err != nil {
+		h.stop()
+		return nil, err
+	}
+
+	var resp response
+	if err := json.Unmarshal(reply, &resp); err != nil {
+		h.stop()
+		return nil, fmt.Errorf("write hook answered with an invalid response: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%w: %s", ErrRejected, resp.Error)
+	}
+	if resp.Operations == nil {
+		return ops, nil
+	}
+	out := make([]itemimage.Operation, 0, len(*resp.Operations))
+	for i, o := range *resp.Operations {
+		op, err := o.Decode()
+		if err != nil {
+			return nil, fmt.Errorf("write hook operation %d: %w", i, err)
+		}
+		out = append(out, op)
+	}
+	return out, nil
+}
+
+// exchange writes line to the command and reads its response line within the
+// timeout. The caller holds h.mu and stops the command when it fails.
+func (h *Hook) exchange(ctx context.Context, line []byte) ([]byte, error) {
+	type result struct {
+		line []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	stdin, stdout := h.stdin, h.stdout
+	go func() {
+		if _, err := stdin.Write(line); err != nil {
+			done <- result{err: fmt.Errorf("failed to send batch to write hook: %w", err)}
+			return
+		}
+		reply, err := stdout.ReadBytes('\n')
+		if err != nil {
+			done <- result{err: fmt.Errorf("failed to read write hook response: %w", err)}
+			return
+		}
+		done <- result{line: reply}
+	}()
+
+	timer := time.NewTimer(h.timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.line, r.err
+	case <-timer.C:
+		return nil, fmt.Errorf("write hook did not answer within %s", h.timeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close closes the command's stdin and waits for it to exit, killing it after
+// the timeout.
+func (h *Hook) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cmd == nil {
+		return nil
+	}
+	cmd := h.cmd
+	_ = h.stdin.Close()
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	var err error
+	select {
+	case err = <-exited:
+	case <-time.After(h.timeout):
+		_ = cmd.Process.Kill()
+		err = <-exited
+	}
+	h.cmd, h.stdin, h.stdout = nil, nil, nil
+	if err != nil {
+		return fmt.Errorf("write hook exited: %w", err)
+	}
+	return nil
+}
+
+// BatchWriter is the subset of writer.Writer wrapped by Writer.
+type BatchWriter interface {
+	WriteBatch(ctx context.Context, ops []itemimage.Operation) error
+	Flush(ctx context.Context) error
+}
+
+// Writer passes every batch through a Hook before writing it.
+// Example:
+//
+//	w := hook.NewWriter(writer.NewDynamoDBWriter(client, table, 25), h, table)
+type Writer struct {
+	next  BatchWriter
+	hook  *Hook
+	table string
+}
+
+// NewWriter wraps next so each batch written to table goes through h first.
+func NewWriter(next BatchWriter, h *Hook, table string) *Writer {
+	return &Writer{next: next, hook: h, table: table}
+}
+
+// WriteBatch writes the operations h returns for ops. A batch the hook empties
+// is not written.
+func (w *Writer) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	ops, err := w.hook.Apply(ctx, w.table, ops)
+	if err != nil {
+		return err
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	return w.next.WriteBatch(ctx, ops)
+}
+
+// Flush flushes the wrapped writer.
+func (w *Writer) Flush(ctx context.Context) error {
+	return w.next.Flush(ctx)
+}
@@ -0,0 +1,225 @@
+package hook
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/oprecord"
+)
+
+// TestMain lets the test binary act as the write hook command: with
+// HOOK_TEST_MODE set it speaks the protocol on stdin and stdout instead of
+// running the tests.
+func TestMain(m *testing.M) {
+	if mode := os.Getenv("HOOK_TEST_MODE"); mode != "" {
+		serveHook(mode)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// serveHook answers every request the way mode describes.
+func serveHook(mode string) {
+	in := bufio.NewScanner(os.Stdin)
+	in.Buffer(nil, 1<<20)
+	for in.Scan() {
+		switch mode {
+		case "enrich":
+			// Drops deletes and stamps the puts, as an enrichment hook would
+			var req request
+			if err := json.Unmarshal(in.Bytes(), &req); err != nil {
+				fmt.Fprintf(os.Stderr, "bad request: %v\n", err)
+				os.Exit(1)
+			}
+			var ops []oprecord.Record
+			for _, o := range req.Operations {
+				if o.Operation == "DELETE" {
+					continue
+				}
+				o.NewImage = json.RawMessage(strings.Replace(string(o.NewImage), "{", `{"restoredBy":{"S":"`+req.Table+`"},`, 1))
+				ops = append(ops, o)
+			}
+			out, _ := json.Marshal(response{Operations: &ops})
+			fmt.Println(string(out))
+		case "accept":
+			fmt.Println("{}")
+		case "reject":
+			fmt.Println(`{"Error":"order 42 has no customer"}`)
+		case "garbage":
+			fmt.Println("not json")
+		case "hang":
+			time.Sleep(time.Minute)
+		}
+	}
+}
+
+// newTestHook returns a hook running the test binary in mode.
+func newTestHook(t *testing.T, mode string, opts ...Option) *Hook {
+	t.Helper()
+	t.Setenv("HOOK_TEST_MODE", mode)
+	h, err := New([]string{os.Args[0]}, append([]Option{WithStderr(io.Discard)}, opts...)...)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	t.Cleanup(func() { _ = h.Close() })
+	return h
+}
+
+func testBatch() []itemimage.Operation {
+	return []itemimage.Operation{
+		{
+			Type:       itemimage.OpPut,
+			Keys:       map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "order#1"}},
+			NewImage:   map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "order#1"}, "total": &types.AttributeValueMemberN{Value: "12.5"}},
+			SourceFile: "data/a.json.gz",
+			ByteOffset: 120,
+		},
+		{
+			Type: itemimage.OpDelete,
+			Keys: map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "order#2"}},
+		},
+	}
+}
+
+// TestApply_Rewrites verifies the operations a hook answers with replace the
+// batch, keeping their keys, images and provenance through the round trip.
+func TestApply_Rewrites(t *testing.T) {
+	h := newTestHook(t, "enrich")
+	ops, err := h.Apply(context.Background(), "orders", testBatch())
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if len(ops) != 1 {
+		t.Fatalf("expected the delete to be dropped, got %d operations", len(ops))
+	}
+	op := ops[0]
+	if op.Type != itemimage.OpPut || op.SourceFile != "data/a.json.gz" || op.ByteOffset != 120 {
+		t.Errorf("unexpected operation %+v", op)
+	}
+	if v, ok := op.NewImage["restoredBy"].(*types.AttributeValueMemberS); !ok || v.Value != "orders" {
+		t.Errorf("expected the hook's attribute, got %v", op.NewImage["restoredBy"])
+	}
+	if v, ok := op.NewImage["total"].(*types.AttributeValueMemberN); !ok || v.Value != "12.5" {
+		t.Errorf("expected the original attributes to be kept, got %v", op.NewImage["total"])
+	}
+	if _, ok := op.Keys["pk"]; !ok {
+		t.Errorf("expected the keys to be kept, got %v", op.Keys)
+	}
+}
+
+// TestApply_Accept verifies a response without operations writes the batch
+// unchanged, so logging hooks need not echo it.
+func TestApply_Accept(t *testing.T) {
+	h := newTestHook(t, "accept")
+	batch := testBatch()
+	ops, err := h.Apply(context.Background(), "orders", batch)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if len(ops) != len(batch) || ops[1].Type != itemimage.OpDelete {
+		t.Errorf("expected the batch unchanged, got %+v", ops)
+	}
+}
+
+// TestApply_Reject verifies a rejected batch fails with ErrRejected and the
+// hook's reason, while the hook keeps serving later batches.
+func TestApply_Reject(t *testing.T) {
+	h := newTestHook(t, "reject")
+	for range 2 {
+		_, err := h.Apply(context.Background(), "orders", testBatch())
+		if !errors.Is(err, ErrRejected) || !strings.Contains(err.Error(), "order 42 has no customer") {
+			t.Fatalf("expected a rejection, got %v", err)
+		}
+	}
+}
+
+// TestApply_InvalidResponse verifies a response that is not JSON fails the
+// batch rather than writing something the hook did not mean.
+func TestApply_InvalidResponse(t *testing.T) {
+	h := newTestHook(t, "garbage")
+	if _, err := h.Apply(context.Background(), "orders", testBatch()); err == nil || !strings.Contains(err.Error(), "invalid response") {
+		t.Errorf("expected an invalid response error, got %v", err)
+	}
+}
+
+// TestApply_Timeout verifies a hook that stops answering is killed after the
+// timeout instead of stalling the restore, and is started again for the next
+// batch.
+func TestApply_Timeout(t *testing.T) {
+	h := newTestHook(t, "hang", WithTimeout(200*time.Millisecond))
+	start := time.Now()
+	if _, err := h.Apply(context.Background(), "orders", testBatch()); err == nil || !strings.Contains(err.Error(), "did not answer") {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("timeout took %s", elapsed)
+	}
+	h.mu.Lock()
+	stopped := h.cmd == nil
+	h.mu.Unlock()
+	if !stopped {
+		t.Error("expected the hung command to be stopped")
+	}
+}
+
+// TestNew_MissingCommand verifies an empty command is refused up front and a
+// missing one fails the first batch.
+func TestNew_MissingCommand(t *testing.T) {
+	if _, err := New(nil); err == nil {
+		t.Error("expected an error for an empty command")
+	}
+	h, err := New([]string{"/nonexistent/ddb-pitr-hook"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if _, err := h.Apply(context.Background(), "orders", testBatch()); err == nil {
+		t.Error("expected an error for a missing command")
+	}
+}
+
+// countingWriter records the batches written through it.
+type countingWriter struct {
+	batches atomic.Int32
+	ops     atomic.Int32
+}
+
+func (w *countingWriter) WriteBatch(_ context.Context, ops []itemimage.Operation) error {
+	w.batches.Add(1)
+	w.ops.Add(int32(len(ops)))
+	return nil
+}
+
+func (w *countingWriter) Flush(context.Context) error { return nil }
+
+// TestWriter verifies the writer writes what the hook returns, and writes
+// nothing for a rejected batch.
+func TestWriter(t *testing.T) {
+	next := &countingWriter{}
+	w := NewWriter(next, newTestHook(t, "enrich"), "orders")
+	if err := w.WriteBatch(context.Background(), testBatch()); err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+	if next.batches.Load() != 1 || next.ops.Load() != 1 {
+		t.Errorf("expected one batch of one operation, got %d batches of %d operations", next.batches.Load(), next.ops.Load())
+	}
+
+	rejected := &countingWriter{}
+	w = NewWriter(rejected, newTestHook(t, "reject"), "orders")
+	if err := w.WriteBatch(context.Background(), testBatch()); !errors.Is(err, ErrRejected) {
+		t.Errorf("expected a rejection, got %v", err)
+	}
+	if rejected.batches.Load() != 0 {
+		t.Error("expected a rejected batch not to be written")
+	}
+}
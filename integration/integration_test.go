@@ -10,27 +10,31 @@ import (
 	"github.com/gurre/ddb-pitr/checkpoint"
 	"github.com/gurre/ddb-pitr/config"
 	"github.com/gurre/ddb-pitr/coordinator"
-	"github.com/gurre/ddb-pitr/integration/mock"
+	"github.com/gurre/ddb-pitr/ddbpitrtest"
 	"github.com/gurre/ddb-pitr/itemimage"
 	"github.com/gurre/ddb-pitr/manifest"
+	"github.com/gurre/ddb-pitr/stream"
 	"github.com/gurre/ddb-pitr/writer"
 	"github.com/gurre/s3streamer"
 )
 
+// fixtureBucket is the bucket the s3exportdata manifests name.
+const fixtureBucket = "test-1231x1x"
+
 func TestFullIntegrationFlow(t *testing.T) {
 	testDataDir, err := filepath.Abs("../s3exportdata")
 	if err != nil {
 		t.Fatalf("Failed to get absolute path to s3exportdata: %v", err)
 	}
 
-	mockS3 := mock.NewS3Client(testDataDir)
-	if err := mockS3.LoadTestFiles(); err != nil {
+	mockS3 := ddbpitrtest.NewS3()
+	if err := mockS3.LoadExports(fixtureBucket, testDataDir); err != nil {
 		t.Fatalf("Failed to load test files: %v", err)
 	}
 
 	cfg := &config.Config{
 		TableName:       "test-table",
-		ExportS3URI:     "s3://test-bucket/AWSDynamoDB/01768385930622-efd1a093/manifest-summary.json",
+		ExportS3URI:     "s3://test-1231x1x/AWSDynamoDB/01768385930622-efd1a093/manifest-summary.json",
 		ExportType:      "FULL",
 		ViewType:        "NEW",
 		Region:          "us-west-2",
@@ -107,16 +111,16 @@ func TestEndToEndWithCoordinator(t *testing.T) {
 		t.Fatalf("Failed to get absolute path to s3exportdata: %v", err)
 	}
 
-	mockS3 := mock.NewS3Client(testDataDir)
-	if err := mockS3.LoadTestFiles(); err != nil {
+	mockS3 := ddbpitrtest.NewS3()
+	if err := mockS3.LoadExports(fixtureBucket, testDataDir); err != nil {
 		t.Fatalf("Failed to load test files: %v", err)
 	}
 
-	mockDynamoDB := mock.NewDynamoDBClient()
+	mockDynamoDB := ddbpitrtest.NewDynamoDB()
 
 	cfg := &config.Config{
 		TableName:       "test-table",
-		ExportS3URI:     "s3://test-bucket/AWSDynamoDB/01768385930622-efd1a093/manifest-summary.json",
+		ExportS3URI:     "s3://test-1231x1x/AWSDynamoDB/01768385930622-efd1a093/manifest-summary.json",
 		ExportType:      "FULL",
 		ViewType:        "NEW",
 		Region:          "us-west-2",
@@ -169,10 +173,10 @@ func TestEndToEndWithCoordinator(t *testing.T) {
 		t.Fatal("Test timed out waiting for coordinator to complete")
 	}
 
-	tableContents := mockDynamoDB.GetTableContents(cfg.TableName)
+	tableContents := mockDynamoDB.Items(cfg.TableName)
 	t.Logf("Total items written to DynamoDB: %d", len(tableContents))
 
-	batchWrites := mockDynamoDB.GetBatchWrites()
+	batchWrites := mockDynamoDB.BatchWrites()
 	t.Logf("Total batch writes: %d", len(batchWrites))
 
 	// Verify 3 items were processed
@@ -192,8 +196,8 @@ func TestIncrementalExportWithCoordinator(t *testing.T) {
 		t.Fatalf("Failed to get absolute path to s3exportdata: %v", err)
 	}
 
-	mockS3 := mock.NewS3Client(testDataDir)
-	if err := mockS3.LoadTestFiles(); err != nil {
+	mockS3 := ddbpitrtest.NewS3()
+	if err := mockS3.LoadExports(fixtureBucket, testDataDir); err != nil {
 		t.Fatalf("Failed to load test files: %v", err)
 	}
 
@@ -202,7 +206,7 @@ func TestIncrementalExportWithCoordinator(t *testing.T) {
 
 	// Test the incremental export with 6 items
 	manifestLoader := manifest.NewS3Loader(mockS3)
-	exportURI := "s3://test-bucket/AWSDynamoDB/01768386924000-d339e52d/manifest-summary.json"
+	exportURI := "s3://test-1231x1x/AWSDynamoDB/01768386924000-d339e52d/manifest-summary.json"
 
 	manifestSummary, err := manifestLoader.Load(ctx, exportURI)
 	if err != nil {
@@ -265,15 +269,15 @@ func TestIncrementalExportWithCoordinator(t *testing.T) {
 	}
 }
 
-// TestAllExportsLoadable verifies all three exports can be loaded from mock S3.
+// TestAllExportsLoadable verifies all four exports can be loaded from mock S3.
 func TestAllExportsLoadable(t *testing.T) {
 	testDataDir, err := filepath.Abs("../s3exportdata")
 	if err != nil {
 		t.Fatalf("Failed to get absolute path to s3exportdata: %v", err)
 	}
 
-	mockS3 := mock.NewS3Client(testDataDir)
-	if err := mockS3.LoadTestFiles(); err != nil {
+	mockS3 := ddbpitrtest.NewS3()
+	if err := mockS3.LoadExports(fixtureBucket, testDataDir); err != nil {
 		t.Fatalf("Failed to load test files: %v", err)
 	}
 
@@ -290,22 +294,28 @@ func TestAllExportsLoadable(t *testing.T) {
 	}{
 		{
 			name:       "FULL export",
-			uri:        "s3://test-bucket/AWSDynamoDB/01768385930622-efd1a093/manifest-summary.json",
+			uri:        "s3://test-1231x1x/AWSDynamoDB/01768385930622-efd1a093/manifest-summary.json",
 			exportType: "FULL_EXPORT",
 			itemCount:  3,
 		},
 		{
 			name:       "INCREMENTAL export #1",
-			uri:        "s3://test-bucket/AWSDynamoDB/01768386924000-d339e52d/manifest-summary.json",
+			uri:        "s3://test-1231x1x/AWSDynamoDB/01768386924000-d339e52d/manifest-summary.json",
 			exportType: "INCREMENTAL_EXPORT",
 			itemCount:  6,
 		},
 		{
 			name:       "INCREMENTAL export #2",
-			uri:        "s3://test-bucket/AWSDynamoDB/01768388186000-4a2fc3ff/manifest-summary.json",
+			uri:        "s3://test-1231x1x/AWSDynamoDB/01768388186000-4a2fc3ff/manifest-summary.json",
 			exportType: "INCREMENTAL_EXPORT",
 			itemCount:  5,
 		},
+		{
+			name:       "INCREMENTAL export #3 (NEW_IMAGE)",
+			uri:        "s3://test-1231x1x/AWSDynamoDB/01768389300000-8c41d2e7/manifest-summary.json",
+			exportType: "INCREMENTAL_EXPORT",
+			itemCount:  4,
+		},
 	}
 
 	for _, exp := range exports {
@@ -334,12 +344,12 @@ func TestDataCorrectnessAfterOperations(t *testing.T) {
 		t.Fatalf("Failed to get absolute path: %v", err)
 	}
 
-	mockS3 := mock.NewS3Client(testDataDir)
-	if err := mockS3.LoadTestFiles(); err != nil {
+	mockS3 := ddbpitrtest.NewS3()
+	if err := mockS3.LoadExports(fixtureBucket, testDataDir); err != nil {
 		t.Fatalf("Failed to load test files: %v", err)
 	}
 
-	mockDynamoDB := mock.NewDynamoDBClient()
+	mockDynamoDB := ddbpitrtest.NewDynamoDB()
 	tableName := "test-table"
 
 	manifestLoader := manifest.NewS3Loader(mockS3)
@@ -363,6 +373,11 @@ func TestDataCorrectnessAfterOperations(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Failed to load manifest: %v", err)
 		}
+		// As the coordinator does, records with only Keys are deletes in the NEW_IMAGE view
+		var decoder itemimage.Decoder = decoder
+		if summary.OutputView == "NEW_IMAGE" {
+			decoder = itemimage.ForView(decoder, itemimage.ViewNew)
+		}
 
 		for _, file := range summary.DataFiles {
 			var ops []itemimage.Operation
@@ -388,9 +403,9 @@ func TestDataCorrectnessAfterOperations(t *testing.T) {
 
 	// Phase 1: Apply FULL export (3 items: pk=1/sk=1, pk=1/sk=2, pk=1/sk=3)
 	t.Run("Phase1_FullExport", func(t *testing.T) {
-		processExport(t, "s3://test-bucket/AWSDynamoDB/01768385930622-efd1a093/manifest-summary.json")
+		processExport(t, "s3://test-1231x1x/AWSDynamoDB/01768385930622-efd1a093/manifest-summary.json")
 
-		contents := mockDynamoDB.GetTableContents(tableName)
+		contents := mockDynamoDB.Items(tableName)
 		if len(contents) != 3 {
 			t.Errorf("Expected 3 items after FULL export, got %d", len(contents))
 		}
@@ -410,9 +425,9 @@ func TestDataCorrectnessAfterOperations(t *testing.T) {
 
 	// Phase 2: Apply INCREMENTAL #1 (6 PUTs: pk=2/sk=1,2,3 and pk=3/sk=1,2,3)
 	t.Run("Phase2_Incremental1", func(t *testing.T) {
-		processExport(t, "s3://test-bucket/AWSDynamoDB/01768386924000-d339e52d/manifest-summary.json")
+		processExport(t, "s3://test-1231x1x/AWSDynamoDB/01768386924000-d339e52d/manifest-summary.json")
 
-		contents := mockDynamoDB.GetTableContents(tableName)
+		contents := mockDynamoDB.Items(tableName)
 		if len(contents) != 9 {
 			t.Errorf("Expected 9 items after INCREMENTAL #1, got %d", len(contents))
 		}
@@ -438,9 +453,9 @@ func TestDataCorrectnessAfterOperations(t *testing.T) {
 	// UPDATEs: pk=1,sk=3 (adds bin_update) and pk=3,sk=2 (removes number)
 	// PUT: pk=4,sk=2
 	t.Run("Phase3_Incremental2", func(t *testing.T) {
-		processExport(t, "s3://test-bucket/AWSDynamoDB/01768388186000-4a2fc3ff/manifest-summary.json")
+		processExport(t, "s3://test-1231x1x/AWSDynamoDB/01768388186000-4a2fc3ff/manifest-summary.json")
 
-		contents := mockDynamoDB.GetTableContents(tableName)
+		contents := mockDynamoDB.Items(tableName)
 		// 9 - 2 deletes + 1 put = 8 items
 		if len(contents) != 8 {
 			t.Errorf("Expected 8 items after INCREMENTAL #2, got %d", len(contents))
@@ -460,7 +475,7 @@ func TestDataCorrectnessAfterOperations(t *testing.T) {
 		}
 
 		// Verify updated item pk=1,sk=3 has bin_update attribute
-		item13 := mockDynamoDB.GetItem(tableName, makeKey("1", "3"))
+		item13 := mockDynamoDB.Item(tableName, makeKey("1", "3"))
 		if item13 == nil {
 			t.Fatal("Expected item pk=1,sk=3 to exist")
 		}
@@ -469,7 +484,7 @@ func TestDataCorrectnessAfterOperations(t *testing.T) {
 		}
 
 		// Verify updated item pk=3,sk=2 no longer has number attribute
-		item32 := mockDynamoDB.GetItem(tableName, makeKey("3", "2"))
+		item32 := mockDynamoDB.Item(tableName, makeKey("3", "2"))
 		if item32 == nil {
 			t.Fatal("Expected item pk=3,sk=2 to exist")
 		}
@@ -480,20 +495,39 @@ func TestDataCorrectnessAfterOperations(t *testing.T) {
 		t.Logf("INCREMENTAL #2: %d items in table (2 deleted, 1 added, 2 updated)", len(contents))
 	})
 
+	// Phase 4: Apply INCREMENTAL #3 in the NEW_IMAGE view, which has no old images
+	// PUT: pk=5,sk=1; replace: pk=2,sk=1 (test becomes test3)
+	// DELETEs carrying only Keys: pk=3,sk=1 and pk=4,sk=2
+	t.Run("Phase4_Incremental3NewImage", func(t *testing.T) {
+		processExport(t, "s3://test-1231x1x/AWSDynamoDB/01768389300000-8c41d2e7/manifest-summary.json")
+
+		contents := mockDynamoDB.Items(tableName)
+		// 8 - 2 deletes + 1 put = 7 items
+		if len(contents) != 7 {
+			t.Errorf("Expected 7 items after INCREMENTAL #3, got %d", len(contents))
+		}
+		if mockDynamoDB.ItemExists(tableName, makeKey("3", "1")) || mockDynamoDB.ItemExists(tableName, makeKey("4", "2")) {
+			t.Error("Keys-only records should have deleted pk=3,sk=1 and pk=4,sk=2")
+		}
+		item21 := mockDynamoDB.Item(tableName, makeKey("2", "1"))
+		if v, ok := item21["test"].(*types.AttributeValueMemberS); !ok || v.Value != "test3" {
+			t.Errorf("Item pk=2,sk=1 should have been replaced by its new image, got %v", item21)
+		}
+	})
+
 	// Final state verification
 	t.Run("FinalState", func(t *testing.T) {
-		contents := mockDynamoDB.GetTableContents(tableName)
+		contents := mockDynamoDB.Items(tableName)
 		t.Logf("Final table state: %d items", len(contents))
 
 		expectedItems := []struct{ pk, sk string }{
 			{"1", "2"}, // Original from FULL
 			{"1", "3"}, // Original from FULL, updated in INCREMENTAL #2
-			{"2", "1"}, // From INCREMENTAL #1
+			{"2", "1"}, // From INCREMENTAL #1, replaced in INCREMENTAL #3
 			{"2", "2"}, // From INCREMENTAL #1
-			{"3", "1"}, // From INCREMENTAL #1
 			{"3", "2"}, // From INCREMENTAL #1, updated in INCREMENTAL #2
 			{"3", "3"}, // From INCREMENTAL #1
-			{"4", "2"}, // From INCREMENTAL #2
+			{"5", "1"}, // From INCREMENTAL #3
 		}
 
 		for _, exp := range expectedItems {
@@ -505,6 +539,8 @@ func TestDataCorrectnessAfterOperations(t *testing.T) {
 		deletedItems := []struct{ pk, sk string }{
 			{"1", "1"}, // Deleted in INCREMENTAL #2
 			{"2", "3"}, // Deleted in INCREMENTAL #2
+			{"3", "1"}, // Deleted in INCREMENTAL #3
+			{"4", "2"}, // Deleted in INCREMENTAL #3
 		}
 
 		for _, del := range deletedItems {
@@ -514,3 +550,43 @@ func TestDataCorrectnessAfterOperations(t *testing.T) {
 		}
 	})
 }
+
+// TestPooledStreamerReadsFixtures verifies the pooled streamer used by the CLI
+// decodes the real gzip fixtures identically to s3streamer.
+func TestPooledStreamerReadsFixtures(t *testing.T) {
+	testDataDir, err := filepath.Abs("../s3exportdata")
+	if err != nil {
+		t.Fatalf("Failed to get absolute path: %v", err)
+	}
+
+	mockS3 := ddbpitrtest.NewS3()
+	if err := mockS3.LoadExports(fixtureBucket, testDataDir); err != nil {
+		t.Fatalf("Failed to load test files: %v", err)
+	}
+
+	ctx := context.Background()
+	summary, err := manifest.NewS3Loader(mockS3).Load(ctx, "s3://test-1231x1x/AWSDynamoDB/01768385930622-efd1a093/manifest-summary.json")
+	if err != nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+
+	decoder := itemimage.NewJSONDecoder()
+	streamer := stream.NewS3Streamer(mockS3)
+	total := 0
+	for _, file := range summary.DataFiles {
+		err := streamer.Stream(ctx, summary.S3Bucket, file.Key, 0, func(line []byte, _ int64) error {
+			if _, err := decoder.Decode(line); err != nil {
+				return err
+			}
+			total++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to stream %s: %v", file.Key, err)
+		}
+	}
+
+	if total != 3 {
+		t.Errorf("Expected 3 items, got %d", total)
+	}
+}
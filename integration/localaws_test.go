@@ -0,0 +1,111 @@
+//go:build localaws
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/integration/localaws"
+)
+
+// exportURI returns the manifest URI of the fixture export id on fixtureBucket.
+func exportURI(id string) string {
+	return fmt.Sprintf("s3://%s/AWSDynamoDB/%s/manifest-summary.json", fixtureBucket, id)
+}
+
+// setupLocal uploads the fixtures and creates an empty table keyed like them.
+func setupLocal(t *testing.T, table string) (*localaws.Env, context.Context) {
+	t.Helper()
+	env := localaws.Setup(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	t.Cleanup(cancel)
+	if err := env.UploadDir(ctx, fixtureBucket, "../s3exportdata"); err != nil {
+		t.Fatalf("failed to upload fixtures: %v", err)
+	}
+	if err := env.CreateTable(ctx, table, "pk", "sk"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	return env, ctx
+}
+
+// scanKeys returns the items of table keyed by "pk/sk".
+func scanKeys(t *testing.T, env *localaws.Env, ctx context.Context, table string) map[string]map[string]types.AttributeValue {
+	t.Helper()
+	items, err := env.Scan(ctx, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyed := make(map[string]map[string]types.AttributeValue, len(items))
+	for _, item := range items {
+		pk, _ := item["pk"].(*types.AttributeValueMemberS)
+		sk, _ := item["sk"].(*types.AttributeValueMemberS)
+		if pk == nil || sk == nil {
+			t.Fatalf("item without string keys: %v", item)
+		}
+		keyed[pk.Value+"/"+sk.Value] = item
+	}
+	return keyed
+}
+
+// TestLocalFullRestore verifies the binary restores a full export end to end
+// through real S3 and DynamoDB APIs, which the mocked tests only simulate.
+func TestLocalFullRestore(t *testing.T) {
+	env, ctx := setupLocal(t, "localaws-full")
+	out, err := env.Run(ctx, "-export", exportURI("01768385930622-efd1a093"), "-table", "localaws-full")
+	if err != nil {
+		t.Fatalf("restore failed: %v\n%s", err, out)
+	}
+	items := scanKeys(t, env, ctx, "localaws-full")
+	for _, key := range []string{"1/1", "1/2", "1/3"} {
+		if _, ok := items[key]; !ok {
+			t.Errorf("expected item %s, got %d items", key, len(items))
+		}
+	}
+	if len(items) != 3 {
+		t.Errorf("expected 3 items, got %d", len(items))
+	}
+}
+
+// TestLocalChainRestore checks a full export followed by two incrementals
+// leaves the table in its final state with both write modes, so deletes,
+// UpdateItem expressions removing attributes and PartiQL statements are
+// applied with DynamoDB's own semantics.
+func TestLocalChainRestore(t *testing.T) {
+	want := []string{"1/2", "1/3", "2/1", "2/2", "3/1", "3/2", "3/3", "4/2"}
+	chain := strings.Join([]string{
+		exportURI("01768385930622-efd1a093"),
+		exportURI("01768386924000-d339e52d"),
+		exportURI("01768388186000-4a2fc3ff"),
+	}, ",")
+	for _, mode := range []string{"dynamodb", "partiql"} {
+		t.Run(mode, func(t *testing.T) {
+			table := "localaws-chain-" + mode
+			env, ctx := setupLocal(t, table)
+			// The full export ends before the first incremental begins
+			out, err := env.Run(ctx, "-export", chain, "-table", table, "-write-mode", mode, "-allow-gaps")
+			if err != nil {
+				t.Fatalf("restore failed: %v\n%s", err, out)
+			}
+			items := scanKeys(t, env, ctx, table)
+			if len(items) != len(want) {
+				t.Errorf("expected %d items, got %d", len(want), len(items))
+			}
+			for _, key := range want {
+				if _, ok := items[key]; !ok {
+					t.Errorf("expected item %s", key)
+				}
+			}
+			if _, ok := items["3/2"]["number"]; ok {
+				t.Error("expected the removed attribute number to be gone from 3/2")
+			}
+			if _, ok := items["1/3"]["bin_update"].(*types.AttributeValueMemberBS); !ok {
+				t.Errorf("expected 1/3 to hold the updated binary set, got %v", items["1/3"]["bin_update"])
+			}
+		})
+	}
+}
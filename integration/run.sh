@@ -0,0 +1,21 @@
+#!/usr/bin/env bash
+# Runs the integration tests, including the localaws suite against DynamoDB
+# Local and MinIO started with docker compose. Set KEEP=1 to leave the
+# containers running afterwards.
+set -euo pipefail
+
+cd "$(dirname "$0")/.."
+compose="docker compose -f integration/localaws/docker-compose.yml"
+
+$compose up -d --wait
+if [ "${KEEP:-0}" != "1" ]; then
+  trap '$compose down' EXIT
+fi
+
+export AWS_ENDPOINT_URL_DYNAMODB=http://localhost:8000
+export AWS_ENDPOINT_URL_S3=http://localhost:9000
+export AWS_ACCESS_KEY_ID=test
+export AWS_SECRET_ACCESS_KEY=testtest
+export AWS_REGION=us-east-1
+
+go test -tags localaws -count=1 "$@" ./integration/...
@@ -0,0 +1,87 @@
+package itemimage
+
+import "fmt"
+
+// pipelineTypeNames maps the type descriptors of Data Pipeline exports, the
+// lower-camel field names of the AWS SDK for Java's AttributeValue, to
+// DynamoDB JSON's.
+var pipelineTypeNames = map[string]string{
+	"s": "S", "n": "N", "b": "B", "bOOL": "BOOL", "nULLValue": "NULL",
+	"sS": "SS", "nS": "NS", "bS": "BS", "l": "L", "m": "M",
+}
+
+// pipelineTypeName returns the DynamoDB JSON type descriptor for the Data
+// Pipeline descriptor raw. DynamoDB JSON descriptors are accepted as they are,
+// since jobs rewriting the layout often emit them.
+func pipelineTypeName(raw []byte) string {
+	if typ, ok := pipelineTypeNames[string(raw)]; ok {
+		return typ
+	}
+	return typeName(raw)
+}
+
+// DataPipelineDecoder implements the Decoder interface for the data files of
+// Data Pipeline exports. Each line is a bare item, e.g.
+// {"pk":{"s":"ORDER#1"},"total":{"n":"12.5"},"paid":{"bOOL":true}}, and is
+// decoded as an OpPut of it; such exports are always full exports.
+type DataPipelineDecoder struct {
+	strict bool // Reject malformed numbers and binary values
+}
+
+// NewDataPipelineDecoder creates a DataPipelineDecoder. WithStrictDecoding
+// applies as for JSONDecoder; WithSDKDecoding has no effect.
+// Example:
+//
+//	decoder := itemimage.NewDataPipelineDecoder(itemimage.WithStrictDecoding())
+func NewDataPipelineDecoder(opts ...DecoderOption) *DataPipelineDecoder {
+	return &DataPipelineDecoder{strict: NewJSONDecoder(opts...).strict}
+}
+
+// Decode parses a Data Pipeline line into an OpPut of its item.
+// Example:
+//
+//	op, err := decoder.Decode([]byte(`{"pk":{"s":"ORDER#1"}}`))
+func (d *DataPipelineDecoder) Decode(line []byte) (Operation, error) {
+	p := parser{data: line, strict: d.strict, pipeline: true}
+	item, err := p.parseMap()
+	if err == nil {
+		err = p.end()
+	}
+	if err != nil {
+		return Operation{}, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if len(item) == 0 {
+		return Operation{}, fmt.Errorf("%w: empty item", ErrCorrupt)
+	}
+	return Operation{Type: OpPut, NewImage: item}, nil
+}
+
+// DecodeBatch decodes lines into a single preallocated slice. See Decoder for the
+// error contract.
+func (d *DataPipelineDecoder) DecodeBatch(lines [][]byte) ([]Operation, error) {
+	ops := make([]Operation, 0, len(lines))
+	for _, line := range lines {
+		op, err := d.Decode(line)
+		if err != nil {
+			return ops, err
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// NewDecoder returns the Decoder of data files in outputFormat, the
+// Summary.OutputFormat of their export: DYNAMODB_JSON or DATA_PIPELINE_JSON.
+// Example:
+//
+//	decoder, err := itemimage.NewDecoder(summary.OutputFormat, itemimage.WithStrictDecoding())
+func NewDecoder(outputFormat string, opts ...DecoderOption) (Decoder, error) {
+	switch outputFormat {
+	case "DYNAMODB_JSON":
+		return NewJSONDecoder(opts...), nil
+	case "DATA_PIPELINE_JSON":
+		return NewDataPipelineDecoder(opts...), nil
+	default:
+		return nil, fmt.Errorf("unsupported export output format %q", outputFormat)
+	}
+}
@@ -0,0 +1,53 @@
+package itemimage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestDataPipelineDecode checks every Data Pipeline type descriptor decodes to
+// the same AttributeValue as its DynamoDB JSON counterpart, so items restored
+// from either layout are written identically.
+func TestDataPipelineDecode(t *testing.T) {
+	line := `{"pk":{"s":"ORDER#1"},"total":{"n":"12.5"},"blob":{"b":"AQI="},"paid":{"bOOL":true},"note":{"nULLValue":true},` +
+		`"tags":{"sS":["a","b"]},"sizes":{"nS":["1","2"]},"blobs":{"bS":["AQ=="]},"lines":{"l":[{"m":{"sku":{"s":"X"}}}]},"legacy":{"S":"kept"}}`
+	op, err := NewDataPipelineDecoder().Decode([]byte(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op.Type != OpPut || op.Keys != nil {
+		t.Fatalf("expected a put without keys, got %v with keys %v", op.Type, op.Keys)
+	}
+	want, err := NewJSONDecoder().Decode([]byte(`{"Item":{"pk":{"S":"ORDER#1"},"total":{"N":"12.5"},"blob":{"B":"AQI="},"paid":{"BOOL":true},"note":{"NULL":true},` +
+		`"tags":{"SS":["a","b"]},"sizes":{"NS":["1","2"]},"blobs":{"BS":["AQ=="]},"lines":{"L":[{"M":{"sku":{"S":"X"}}}]},"legacy":{"S":"kept"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(op.NewImage, want.NewImage) {
+		t.Errorf("decoded %#v, want %#v", op.NewImage, want.NewImage)
+	}
+
+	for _, bad := range []string{`{}`, `{"pk":{"x":"1"}}`, `{"pk":{"s":"1"}} {}`} {
+		if _, err := NewDataPipelineDecoder().Decode([]byte(bad)); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("expected ErrCorrupt for %s, got %v", bad, err)
+		}
+	}
+	if _, err := NewDataPipelineDecoder(WithStrictDecoding()).Decode([]byte(`{"n":{"n":"0x10"}}`)); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected strict decoding to reject a hex number, got %v", err)
+	}
+}
+
+// TestNewDecoder checks decoders are chosen by the manifest's output format and
+// unknown formats fail before any line is read.
+func TestNewDecoder(t *testing.T) {
+	if d, err := NewDecoder("DYNAMODB_JSON"); err != nil || d.(*JSONDecoder) == nil {
+		t.Errorf("expected a JSONDecoder, got %T, %v", d, err)
+	}
+	if d, err := NewDecoder("DATA_PIPELINE_JSON"); err != nil || d.(*DataPipelineDecoder) == nil {
+		t.Errorf("expected a DataPipelineDecoder, got %T, %v", d, err)
+	}
+	if _, err := NewDecoder("ION"); err == nil {
+		t.Error("expected error for ION")
+	}
+}
@@ -0,0 +1,607 @@
+package itemimage
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// record holds the decoded top-level sections of an export line. A nil section
+// was absent or null.
+type record struct {
+	Item           map[string]types.AttributeValue
+	Keys           map[string]types.AttributeValue
+	NewImage       map[string]types.AttributeValue
+	OldImage       map[string]types.AttributeValue
+	WriteTimestamp int64 // Metadata.WriteTimestampMicros, 0 if absent
+}
+
+// parser decodes DynamoDB JSON directly into AttributeValues in a single pass
+// over the line. It replaces json.Unmarshal into RawMessages followed by
+// attributevalue.UnmarshalMapJSON, which parses every image twice and builds an
+// intermediate tree of interface values.
+type parser struct {
+	data   []byte
+	pos    int
+	strict bool // Validate number syntax and canonical base64; see WithStrictDecoding
+
+	// Read Data Pipeline type descriptors such as "s" and "bOOL"; see DataPipelineDecoder
+	pipeline bool
+}
+
+// parseRecord decodes one export line. Unknown sections such as Metadata are skipped.
+func parseRecord(line []byte, strict bool) (record, error) {
+	p := parser{data: line, strict: strict}
+	var rec record
+	if err := p.expect('{'); err != nil {
+		return rec, err
+	}
+	if p.consume('}') {
+		return rec, p.end()
+	}
+	for {
+		name, err := p.parseRawString()
+		if err != nil {
+			return rec, err
+		}
+		if err := p.expect(':'); err != nil {
+			return rec, err
+		}
+
+		var section *map[string]types.AttributeValue
+		switch string(name) {
+		case "Item":
+			section = &rec.Item
+		case "Keys":
+			section = &rec.Keys
+		case "NewImage":
+			section = &rec.NewImage
+		case "OldImage":
+			section = &rec.OldImage
+		}
+		if string(name) == "Metadata" {
+			rec.WriteTimestamp, err = p.parseMetadata()
+		} else if section == nil {
+			err = p.skipValue()
+		} else if p.consumeLiteral("null") {
+			*section = nil
+		} else if *section, err = p.parseMap(); err != nil {
+			err = fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		if err != nil {
+			return rec, err
+		}
+
+		if p.consume('}') {
+			return rec, p.end()
+		}
+		if err := p.expect(','); err != nil {
+			return rec, err
+		}
+	}
+}
+
+// parseMetadata decodes the Metadata section of an incremental export line and
+// returns its WriteTimestampMicros. Other metadata fields are skipped.
+func (p *parser) parseMetadata() (int64, error) {
+	if p.consumeLiteral("null") {
+		return 0, nil
+	}
+	if err := p.expect('{'); err != nil {
+		return 0, err
+	}
+	var ts int64
+	if p.consume('}') {
+		return ts, nil
+	}
+	for {
+		name, err := p.parseRawString()
+		if err != nil {
+			return 0, err
+		}
+		if err := p.expect(':'); err != nil {
+			return 0, err
+		}
+		if string(name) == "WriteTimestampMicros" {
+			av, err := p.parseValue()
+			if err != nil {
+				return 0, fmt.Errorf("WriteTimestampMicros: %w", err)
+			}
+			n, ok := av.(*types.AttributeValueMemberN)
+			if !ok {
+				return 0, fmt.Errorf("WriteTimestampMicros must be a number")
+			}
+			if ts, err = strconv.ParseInt(n.Value, 10, 64); err != nil {
+				return 0, fmt.Errorf("invalid WriteTimestampMicros: %w", err)
+			}
+		} else if err := p.skipValue(); err != nil {
+			return 0, err
+		}
+		if p.consume('}') {
+			return ts, nil
+		}
+		if err := p.expect(','); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// parseMap decodes an object of attribute name to typed value, e.g.
+// {"pk":{"S":"a"},"n":{"N":"1"}}.
+func (p *parser) parseMap() (map[string]types.AttributeValue, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	m := make(map[string]types.AttributeValue)
+	if p.consume('}') {
+		return m, nil
+	}
+	for {
+		name, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		av, err := p.parseValue()
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: %w", name, err)
+		}
+		m[name] = av
+		if p.consume('}') {
+			return m, nil
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseValue decodes one typed value such as {"S":"a"} or {"NS":["1","2"]}.
+func (p *parser) parseValue() (types.AttributeValue, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	raw, err := p.parseRawString()
+	if err != nil {
+		return nil, err
+	}
+	typ := typeName(raw)
+	if p.pipeline {
+		typ = pipelineTypeName(raw)
+	}
+	if err := p.expect(':'); err != nil {
+		return nil, err
+	}
+
+	var av types.AttributeValue
+	switch typ {
+	case "S":
+		var s string
+		s, err = p.parseString()
+		av = &types.AttributeValueMemberS{Value: s}
+	case "N":
+		var s string
+		if s, err = p.parseString(); err == nil && p.strict {
+			err = validateNumber(s)
+		}
+		av = &types.AttributeValueMemberN{Value: s}
+	case "B":
+		var b []byte
+		b, err = p.parseBinary()
+		av = &types.AttributeValueMemberB{Value: b}
+	case "BOOL":
+		var b bool
+		b, err = p.parseBool()
+		av = &types.AttributeValueMemberBOOL{Value: b}
+	case "NULL":
+		var b bool
+		b, err = p.parseBool()
+		av = &types.AttributeValueMemberNULL{Value: b}
+	case "SS":
+		var ss []string
+		ss, err = p.parseStringList()
+		av = &types.AttributeValueMemberSS{Value: ss}
+	case "NS":
+		var ns []string
+		if ns, err = p.parseStringList(); err == nil && p.strict {
+			for _, n := range ns {
+				if err = validateNumber(n); err != nil {
+					break
+				}
+			}
+		}
+		av = &types.AttributeValueMemberNS{Value: ns}
+	case "BS":
+		var bs [][]byte
+		bs, err = p.parseBinaryList()
+		av = &types.AttributeValueMemberBS{Value: bs}
+	case "L":
+		var l []types.AttributeValue
+		l, err = p.parseList()
+		av = &types.AttributeValueMemberL{Value: l}
+	case "M":
+		var m map[string]types.AttributeValue
+		m, err = p.parseMap()
+		av = &types.AttributeValueMemberM{Value: m}
+	default:
+		return nil, fmt.Errorf("unknown attribute type %q", typ)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s value: %w", typ, err)
+	}
+	if err := p.expect('}'); err != nil {
+		return nil, fmt.Errorf("%s value must be the only member: %w", typ, err)
+	}
+	return av, nil
+}
+
+// typeNames interns the attribute type descriptors so parseValue does not
+// allocate a string per attribute.
+var typeNames = []string{"S", "N", "B", "BOOL", "NULL", "SS", "NS", "BS", "L", "M"}
+
+// typeName returns the interned type descriptor for raw, or raw as a new string
+// if it is not a known type.
+func typeName(raw []byte) string {
+	for _, name := range typeNames {
+		if string(raw) == name {
+			return name
+		}
+	}
+	return string(raw)
+}
+
+// parseList decodes the array of an L value.
+func (p *parser) parseList() ([]types.AttributeValue, error) {
+	if err := p.expect('['); err != nil {
+		return nil, err
+	}
+	l := []types.AttributeValue{}
+	if p.consume(']') {
+		return l, nil
+	}
+	for {
+		av, err := p.parseValue()
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", len(l), err)
+		}
+		l = append(l, av)
+		if p.consume(']') {
+			return l, nil
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseStringList decodes the array of an SS or NS value.
+func (p *parser) parseStringList() ([]string, error) {
+	if err := p.expect('['); err != nil {
+		return nil, err
+	}
+	ss := []string{}
+	if p.consume(']') {
+		return ss, nil
+	}
+	for {
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+		if p.consume(']') {
+			return ss, nil
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseBinaryList decodes the array of a BS value.
+func (p *parser) parseBinaryList() ([][]byte, error) {
+	if err := p.expect('['); err != nil {
+		return nil, err
+	}
+	bs := [][]byte{}
+	if p.consume(']') {
+		return bs, nil
+	}
+	for {
+		b, err := p.parseBinary()
+		if err != nil {
+			return nil, err
+		}
+		bs = append(bs, b)
+		if p.consume(']') {
+			return bs, nil
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseBinary decodes a base64 string directly from the line without an
+// intermediate string.
+func (p *parser) parseBinary() ([]byte, error) {
+	raw, err := p.parseRawString()
+	if err != nil {
+		return nil, err
+	}
+	enc := base64.StdEncoding
+	if p.strict {
+		if err := checkStrictBase64(raw); err != nil {
+			return nil, err
+		}
+		enc = strictBase64
+	}
+	b := make([]byte, enc.DecodedLen(len(raw)))
+	n, err := enc.Decode(b, raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+	return b[:n], nil
+}
+
+// parseBool decodes true or false.
+func (p *parser) parseBool() (bool, error) {
+	p.skipWhitespace()
+	switch {
+	case p.consumeLiteral("true"):
+		return true, nil
+	case p.consumeLiteral("false"):
+		return false, nil
+	}
+	return false, p.errorf("expected true or false")
+}
+
+// parseString decodes a JSON string. Strings without escapes, which is nearly all
+// of them, cost a single allocation.
+func (p *parser) parseString() (string, error) {
+	raw, err := p.parseRawString()
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// parseRawString decodes a JSON string and returns its unescaped bytes. The result
+// aliases the line when the string has no escapes and must not be retained.
+func (p *parser) parseRawString() ([]byte, error) {
+	if err := p.expect('"'); err != nil {
+		return nil, err
+	}
+	start := p.pos
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case c == '"':
+			s := p.data[start:p.pos]
+			p.pos++
+			return s, nil
+		case c == '\\':
+			return p.parseEscapedString(start)
+		case c < 0x20:
+			return nil, p.errorf("control character in string")
+		}
+		p.pos++
+	}
+	return nil, p.errorf("unterminated string")
+}
+
+// parseEscapedString continues parseRawString from the first backslash.
+func (p *parser) parseEscapedString(start int) ([]byte, error) {
+	buf := make([]byte, 0, p.pos-start+16)
+	buf = append(buf, p.data[start:p.pos]...)
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return buf, nil
+		case c < 0x20:
+			return nil, p.errorf("control character in string")
+		case c != '\\':
+			buf = append(buf, c)
+			p.pos++
+			continue
+		}
+
+		p.pos++
+		if p.pos >= len(p.data) {
+			break
+		}
+		esc := p.data[p.pos]
+		p.pos++
+		switch esc {
+		case '"', '\\', '/':
+			buf = append(buf, esc)
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'u':
+			r, err := p.parseUnicodeEscape()
+			if err != nil {
+				return nil, err
+			}
+			buf = utf8.AppendRune(buf, r)
+		default:
+			return nil, p.errorf("invalid escape \\%c", esc)
+		}
+	}
+	return nil, p.errorf("unterminated string")
+}
+
+// parseUnicodeEscape decodes the hex digits of a \u escape, combining surrogate
+// pairs. Unpaired surrogates become U+FFFD, as in encoding/json.
+func (p *parser) parseUnicodeEscape() (rune, error) {
+	r, err := p.parseHex4()
+	if err != nil {
+		return 0, err
+	}
+	if !utf16.IsSurrogate(r) {
+		return r, nil
+	}
+	if p.pos+6 <= len(p.data) && p.data[p.pos] == '\\' && p.data[p.pos+1] == 'u' {
+		save := p.pos
+		p.pos += 2
+		r2, err := p.parseHex4()
+		if err != nil {
+			return 0, err
+		}
+		if combined := utf16.DecodeRune(r, r2); combined != utf8.RuneError {
+			return combined, nil
+		}
+		p.pos = save
+	}
+	return utf8.RuneError, nil
+}
+
+// parseHex4 decodes four hex digits.
+func (p *parser) parseHex4() (rune, error) {
+	if p.pos+4 > len(p.data) {
+		return 0, p.errorf("truncated \\u escape")
+	}
+	v, err := strconv.ParseUint(string(p.data[p.pos:p.pos+4]), 16, 32)
+	if err != nil {
+		return 0, p.errorf("invalid \\u escape")
+	}
+	p.pos += 4
+	return rune(v), nil
+}
+
+// skipValue skips any JSON value, used for sections the decoder does not need.
+func (p *parser) skipValue() error {
+	p.skipWhitespace()
+	if p.pos >= len(p.data) {
+		return p.errorf("unexpected end of input")
+	}
+	switch c := p.data[p.pos]; c {
+	case '"':
+		_, err := p.parseRawString()
+		return err
+	case '{', '[':
+		closing := byte('}')
+		if c == '[' {
+			closing = ']'
+		}
+		p.pos++
+		if p.consume(closing) {
+			return nil
+		}
+		for {
+			if c == '{' {
+				if _, err := p.parseRawString(); err != nil {
+					return err
+				}
+				if err := p.expect(':'); err != nil {
+					return err
+				}
+			}
+			if err := p.skipValue(); err != nil {
+				return err
+			}
+			if p.consume(closing) {
+				return nil
+			}
+			if err := p.expect(','); err != nil {
+				return err
+			}
+		}
+	case 't':
+		return p.expectLiteral("true")
+	case 'f':
+		return p.expectLiteral("false")
+	case 'n':
+		return p.expectLiteral("null")
+	default:
+		start := p.pos
+		for p.pos < len(p.data) && isNumberByte(p.data[p.pos]) {
+			p.pos++
+		}
+		if p.pos == start {
+			return p.errorf("unexpected character %q", c)
+		}
+		return nil
+	}
+}
+
+// isNumberByte reports whether c can appear in a JSON number.
+func isNumberByte(c byte) bool {
+	return (c >= '0' && c <= '9') || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E'
+}
+
+// skipWhitespace advances past JSON whitespace.
+func (p *parser) skipWhitespace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// consume advances past c if it is the next non-whitespace byte.
+func (p *parser) consume(c byte) bool {
+	p.skipWhitespace()
+	if p.pos < len(p.data) && p.data[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expect advances past c or fails.
+func (p *parser) expect(c byte) error {
+	if !p.consume(c) {
+		return p.errorf("expected %q", c)
+	}
+	return nil
+}
+
+// consumeLiteral advances past lit if it is next.
+func (p *parser) consumeLiteral(lit string) bool {
+	p.skipWhitespace()
+	if len(p.data)-p.pos >= len(lit) && string(p.data[p.pos:p.pos+len(lit)]) == lit {
+		p.pos += len(lit)
+		return true
+	}
+	return false
+}
+
+// expectLiteral advances past lit or fails.
+func (p *parser) expectLiteral(lit string) error {
+	if !p.consumeLiteral(lit) {
+		return p.errorf("expected %s", lit)
+	}
+	return nil
+}
+
+// end fails if anything but whitespace follows the record.
+func (p *parser) end() error {
+	p.skipWhitespace()
+	if p.pos != len(p.data) {
+		return p.errorf("unexpected data after record")
+	}
+	return nil
+}
+
+// errorf returns a parse error annotated with the current offset.
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,108 @@
+package itemimage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// parserCases cover every attribute type plus the JSON features the SDK path
+// handles implicitly: escapes, surrogate pairs, whitespace and skipped sections.
+var parserCases = []string{
+	`{"Item":{"pk":{"S":"a"},"n":{"N":"-1.5e3"},"b":{"B":"aGVsbG8="},"t":{"BOOL":true},"z":{"NULL":true}}}`,
+	`{"Item":{"ss":{"SS":["a","b"]},"ns":{"NS":["1","2"]},"bs":{"BS":["AQ==","Ag=="]}}}`,
+	`{"Item":{"l":{"L":[{"S":"x"},{"M":{"k":{"L":[]}}},{"NULL":true}]},"m":{"M":{}}}}`,
+	`{"Item":{"esc":{"S":"quote\" slash\\ tab\t nl\n unié pair😀 solidus\/"}}}`,
+	`{"Item":{"utf8":{"S":"héllo wörld ✓"}}}`,
+	` { "Metadata" : { "WriteTimestampMicros" : { "N" : "1" } , "x" : [1, -2.5, true, false, null, "s"] } ,
+	  "Keys" : { "pk" : { "S" : "a" } } , "NewImage" : { "pk" : { "S" : "a" } } } `,
+	`{"Keys":{"pk":{"S":"a"}},"OldImage":{"pk":{"S":"a"},"gone":{"BOOL":false}}}`,
+}
+
+// TestParserMatchesSDK guards the built-in parser against drifting from the SDK
+// decoding it replaces, on both hand-written edge cases and real export lines.
+func TestParserMatchesSDK(t *testing.T) {
+	fast := NewJSONDecoder()
+	sdk := NewJSONDecoder(WithSDKDecoding())
+
+	lines := make([][]byte, 0, len(parserCases)+len(testData))
+	for _, c := range parserCases {
+		lines = append(lines, []byte(c))
+	}
+	lines = append(lines, testData...)
+
+	for i, line := range lines {
+		want, err := sdk.Decode(line)
+		if err != nil {
+			t.Fatalf("case %d: SDK decode failed: %v", i, err)
+		}
+		got, err := fast.Decode(line)
+		if err != nil {
+			t.Fatalf("case %d: decode failed: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("case %d: decoded operation differs from SDK\n got: %#v\nwant: %#v", i, got, want)
+		}
+	}
+}
+
+// TestParserRejectsCorruptLines ensures malformed input surfaces as ErrCorrupt
+// instead of a partially decoded operation.
+func TestParserRejectsCorruptLines(t *testing.T) {
+	cases := []string{
+		``,
+		`{`,
+		`{"Item":{"pk":{"S":"a"}}`,
+		`{"Item":{"pk":{"S":"a"}}} trailing`,
+		`{"Item":{"pk":{"X":"a"}}}`,
+		`{"Item":{"pk":{"S":"a","N":"1"}}}`,
+		`{"Item":{"pk":{"B":"not base64!"}}}`,
+		`{"Item":{"pk":{"BOOL":"true"}}}`,
+		`{"Item":{"pk":{"S":"bad \x escape"}}}`,
+		`{"Item":{"pk":{"S":"unterminated}}}`,
+		`{"Metadata":{"x":tru},"Item":{}}`,
+		`{"Metadata":{}}`,
+	}
+	decoder := NewJSONDecoder()
+	for _, c := range cases {
+		if _, err := decoder.Decode([]byte(c)); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Decode(%q) error = %v, want ErrCorrupt", c, err)
+		}
+	}
+}
+
+// BenchmarkDecoders compares the built-in parser with the SDK path it replaces.
+func BenchmarkDecoders(b *testing.B) {
+	for _, bc := range []struct {
+		name    string
+		decoder *JSONDecoder
+	}{
+		{"parser", NewJSONDecoder()},
+		{"sdk", NewJSONDecoder(WithSDKDecoding())},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, data := range testData {
+					if _, err := bc.decoder.Decode(data); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestDecodeWriteTimestamp verifies Metadata.WriteTimestampMicros is carried on
+// incremental operations, which the duplicate audit keys on.
+func TestDecodeWriteTimestamp(t *testing.T) {
+	for _, d := range []*JSONDecoder{NewJSONDecoder(), NewJSONDecoder(WithSDKDecoding())} {
+		op, err := d.Decode(testData[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op.WriteTimestampMicros != 1746609560577628 {
+			t.Errorf("expected WriteTimestampMicros 1746609560577628, got %d", op.WriteTimestampMicros)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package itemimage
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ItemEqual reports whether two items have the same attributes with equal
+// values; see AttributeEqual.
+// Example:
+//
+//	if itemimage.ItemEqual(op.NewImage, current) {
+//	    continue // already restored
+//	}
+func ItemEqual(a, b map[string]types.AttributeValue) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, v := range a {
+		if other, ok := b[name]; !ok || !AttributeEqual(v, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// AttributeEqual compares attribute values. DynamoDB does not preserve the order
+// of set members, so sets compare as sorted. Numbers compare as written, so the
+// same number written two ways is unequal.
+// Example:
+//
+//	itemimage.AttributeEqual(&types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+//	    &types.AttributeValueMemberSS{Value: []string{"b", "a"}}) // true
+func AttributeEqual(a, b types.AttributeValue) bool {
+	switch av := a.(type) {
+	case *types.AttributeValueMemberS:
+		bv, ok := b.(*types.AttributeValueMemberS)
+		return ok && av.Value == bv.Value
+	case *types.AttributeValueMemberN:
+		bv, ok := b.(*types.AttributeValueMemberN)
+		return ok && av.Value == bv.Value
+	case *types.AttributeValueMemberB:
+		bv, ok := b.(*types.AttributeValueMemberB)
+		return ok && bytes.Equal(av.Value, bv.Value)
+	case *types.AttributeValueMemberBOOL:
+		bv, ok := b.(*types.AttributeValueMemberBOOL)
+		return ok && av.Value == bv.Value
+	case *types.AttributeValueMemberNULL:
+		_, ok := b.(*types.AttributeValueMemberNULL)
+		return ok
+	case *types.AttributeValueMemberSS:
+		bv, ok := b.(*types.AttributeValueMemberSS)
+		return ok && slices.Equal(sorted(av.Value), sorted(bv.Value))
+	case *types.AttributeValueMemberNS:
+		bv, ok := b.(*types.AttributeValueMemberNS)
+		return ok && slices.Equal(sorted(av.Value), sorted(bv.Value))
+	case *types.AttributeValueMemberBS:
+		bv, ok := b.(*types.AttributeValueMemberBS)
+		if !ok || len(av.Value) != len(bv.Value) {
+			return false
+		}
+		as, bs := make([]string, len(av.Value)), make([]string, len(bv.Value))
+		for i := range av.Value {
+			as[i], bs[i] = string(av.Value[i]), string(bv.Value[i])
+		}
+		return slices.Equal(sorted(as), sorted(bs))
+	case *types.AttributeValueMemberL:
+		bv, ok := b.(*types.AttributeValueMemberL)
+		if !ok || len(av.Value) != len(bv.Value) {
+			return false
+		}
+		for i := range av.Value {
+			if !AttributeEqual(av.Value[i], bv.Value[i]) {
+				return false
+			}
+		}
+		return true
+	case *types.AttributeValueMemberM:
+		bv, ok := b.(*types.AttributeValueMemberM)
+		return ok && ItemEqual(av.Value, bv.Value)
+	}
+	return false
+}
+
+// sorted returns a sorted copy of values.
+func sorted(values []string) []string {
+	out := slices.Clone(values)
+	slices.Sort(out)
+	return out
+}
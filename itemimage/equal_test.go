@@ -0,0 +1,37 @@
+package itemimage
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TestItemEqual verifies items compare by value, with set members in any order
+// and nested maps and lists compared deeply, so an item read back from
+// DynamoDB equals the image it was written from.
+func TestItemEqual(t *testing.T) {
+	item := func(tags []string, n string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{
+			"pk":   &types.AttributeValueMemberS{Value: "order#1"},
+			"tags": &types.AttributeValueMemberSS{Value: tags},
+			"lines": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+				&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{"qty": &types.AttributeValueMemberN{Value: n}}},
+			}},
+			"blobs": &types.AttributeValueMemberBS{Value: [][]byte{{1}, {2}}},
+		}
+	}
+	if !ItemEqual(item([]string{"a", "b"}, "1"), item([]string{"b", "a"}, "1")) {
+		t.Error("expected items differing in set order to be equal")
+	}
+	if ItemEqual(item([]string{"a", "b"}, "1"), item([]string{"a", "b"}, "2")) {
+		t.Error("expected items differing in a nested number to differ")
+	}
+	extra := item([]string{"a"}, "1")
+	extra["note"] = &types.AttributeValueMemberNULL{Value: true}
+	if ItemEqual(item([]string{"a"}, "1"), extra) || ItemEqual(extra, item([]string{"a"}, "1")) {
+		t.Error("expected items with different attributes to differ")
+	}
+	if AttributeEqual(&types.AttributeValueMemberS{Value: "1"}, &types.AttributeValueMemberN{Value: "1"}) {
+		t.Error("expected values of different types to differ")
+	}
+}
@@ -1,6 +1,7 @@
 package itemimage
 
 import (
+	"errors"
 	"testing"
 
 	stdjson "encoding/json"
@@ -98,3 +99,62 @@ func BenchmarkJSONComparison(b *testing.B) {
 		}
 	})
 }
+
+// TestDecodeBatchStopsAtFailingLine pins the DecodeBatch error contract that the
+// coordinator relies on to skip a corrupt line and resume after it.
+func TestDecodeBatchStopsAtFailingLine(t *testing.T) {
+	lines := [][]byte{testData[0], testData[1], []byte(`{"Item":`), testData[2]}
+	ops, err := NewJSONDecoder().DecodeBatch(lines)
+	if !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+	if len(ops) != 2 {
+		t.Fatalf("expected the 2 operations before the corrupt line, got %d", len(ops))
+	}
+
+	ops, err = NewJSONDecoder().DecodeBatch(testData)
+	if err != nil || len(ops) != len(testData) {
+		t.Fatalf("DecodeBatch() = %d ops, %v; want %d ops", len(ops), err, len(testData))
+	}
+}
+
+// BenchmarkDecodeBatch measures decoding all test lines in one call, for
+// comparison with BenchmarkDecode.
+func BenchmarkDecodeBatch(b *testing.B) {
+	decoder := NewJSONDecoder()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = decoder.DecodeBatch(testData)
+	}
+}
+
+// TestDecodeNewImageView checks records of the NEW_IMAGE view, which have no old
+// images: read for that view, a write is a put of its new image and a
+// keys-only record is a delete. Without the view a keys-only record is
+// corrupt, so a damaged NEW_AND_OLD_IMAGES line does not delete its item.
+func TestDecodeNewImageView(t *testing.T) {
+	write := []byte(`{"Metadata":{"WriteTimestampMicros":{"N":"1768388725118934"}},"Keys":{"pk":{"S":"2"}},"NewImage":{"pk":{"S":"2"},"test":{"S":"test3"}}}`)
+	del := []byte(`{"Metadata":{"WriteTimestampMicros":{"N":"1768388741770205"}},"Keys":{"pk":{"S":"3"}}}`)
+	for _, decoder := range []*JSONDecoder{NewJSONDecoder(), NewJSONDecoder(WithSDKDecoding())} {
+		if _, err := decoder.Decode(del); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Decode(delete) without a view: expected ErrCorrupt, got %v", err)
+		}
+
+		viewed := ForView(decoder, ViewNew)
+		if decoder.view != ViewAny {
+			t.Errorf("ForView changed the decoder it was given")
+		}
+		op, err := viewed.Decode(write)
+		if err != nil || op.Type != OpPut || op.NewImage == nil {
+			t.Errorf("Decode(write) = %v %v, want a put", op.Type, err)
+		}
+		op, err = viewed.Decode(del)
+		if err != nil || op.Type != OpDelete || len(op.Keys) != 1 || op.OldImage != nil {
+			t.Errorf("Decode(delete) = %+v %v, want a delete by key", op, err)
+		}
+		if op.WriteTimestampMicros != 1768388741770205 {
+			t.Errorf("WriteTimestampMicros = %d", op.WriteTimestampMicros)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package itemimage
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ItemSize approximates the size DynamoDB bills for item: attribute names plus
+// values, with numbers taking about one byte per two digits. It is compared
+// against the 400 KB item limit.
+// Example:
+//
+//	if itemimage.ItemSize(op.NewImage) > 400*1024 {
+//	    return errTooLarge
+//	}
+func ItemSize(item map[string]types.AttributeValue) int64 {
+	var n int64
+	for name, v := range item {
+		n += int64(len(name)) + AttributeSize(v)
+	}
+	return n
+}
+
+// AttributeSize approximates the stored size of one attribute value, without
+// its name.
+// Example:
+//
+//	n := itemimage.AttributeSize(item["payload"])
+func AttributeSize(v types.AttributeValue) int64 {
+	switch v := v.(type) {
+	case *types.AttributeValueMemberS:
+		return int64(len(v.Value))
+	case *types.AttributeValueMemberN:
+		return int64(len(v.Value)+1)/2 + 1
+	case *types.AttributeValueMemberB:
+		return int64(len(v.Value))
+	case *types.AttributeValueMemberSS:
+		var n int64
+		for _, s := range v.Value {
+			n += int64(len(s))
+		}
+		return n
+	case *types.AttributeValueMemberNS:
+		var n int64
+		for _, s := range v.Value {
+			n += int64(len(s)+1)/2 + 1
+		}
+		return n
+	case *types.AttributeValueMemberBS:
+		var n int64
+		for _, b := range v.Value {
+			n += int64(len(b))
+		}
+		return n
+	case *types.AttributeValueMemberL:
+		n := int64(3)
+		for _, e := range v.Value {
+			n += 1 + AttributeSize(e)
+		}
+		return n
+	case *types.AttributeValueMemberM:
+		return 3 + int64(len(v.Value)) + ItemSize(v.Value)
+	default: // BOOL, NULL
+		return 1
+	}
+}
@@ -0,0 +1,27 @@
+package itemimage
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TestItemSize verifies sizes count attribute names and values, numbers at
+// about a byte per two digits, and nested documents with their overhead, so
+// the estimate tracks DynamoDB's item size limit.
+func TestItemSize(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"pk":  &types.AttributeValueMemberS{Value: "order#1"}, // 2 + 7
+		"qty": &types.AttributeValueMemberN{Value: "1234"},    // 3 + 3
+		"ok":  &types.AttributeValueMemberBOOL{Value: true},   // 2 + 1
+		"m": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{ // 1 + 3 + 1 + (1 + 2)
+			"a": &types.AttributeValueMemberB{Value: []byte{1, 2}},
+		}},
+	}
+	if got := ItemSize(item); got != 26 {
+		t.Errorf("ItemSize = %d, want 26", got)
+	}
+	if got := AttributeSize(&types.AttributeValueMemberSS{Value: []string{"ab", "c"}}); got != 3 {
+		t.Errorf("AttributeSize of a string set = %d, want 3", got)
+	}
+}
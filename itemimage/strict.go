@@ -0,0 +1,114 @@
+package itemimage
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+)
+
+// DynamoDB number limits: 38 significant digits, and magnitudes from 1E-130 up
+// to 9.9999999999999999999999999999999999999E+125.
+const (
+	maxNumberDigits   = 38
+	minNumberExponent = -130
+	maxNumberExponent = 125
+)
+
+// strictBase64 rejects encodings whose padding bits are not zero, which the
+// standard decoder silently drops.
+var strictBase64 = base64.StdEncoding.Strict()
+
+// WithStrictDecoding makes the decoder reject numbers DynamoDB would refuse,
+// such as "1e999", "0x10" or values with more than 38 significant digits, and
+// binary values that are not canonical base64, including embedded line breaks
+// that the standard decoder skips. Such lines fail to decode with ErrCorrupt
+// instead of failing at write time. It has no effect with WithSDKDecoding.
+// Example:
+//
+//	decoder := itemimage.NewJSONDecoder(itemimage.WithStrictDecoding())
+func WithStrictDecoding() DecoderOption {
+	return func(d *JSONDecoder) {
+		d.strict = true
+	}
+}
+
+// validateNumber checks that s is a number DynamoDB accepts: an optionally
+// signed decimal with an optional exponent, at most 38 significant digits, and
+// zero or a magnitude between 1E-130 and 9.99…E+125.
+func validateNumber(s string) error {
+	i := 0
+	if i < len(s) && (s[i] == '-' || s[i] == '+') {
+		i++
+	}
+
+	// Mantissa digits, with the position of the decimal point
+	var digits []byte
+	point := -1
+	for ; i < len(s); i++ {
+		c := s[i]
+		if c == '.' && point < 0 {
+			point = len(digits)
+			continue
+		}
+		if c < '0' || c > '9' {
+			break
+		}
+		digits = append(digits, c)
+	}
+	if len(digits) == 0 {
+		return fmt.Errorf("invalid number %q", s)
+	}
+	if point < 0 {
+		point = len(digits)
+	}
+
+	exp := 0
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		e := s[i+1:]
+		if len(e) > 0 && (e[0] == '-' || e[0] == '+') {
+			e = e[1:]
+		}
+		// Longer exponents are out of range whatever the mantissa
+		if len(e) == 0 || len(e) > 6 {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		var err error
+		if exp, err = strconv.Atoi(s[i+1:]); err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		i = len(s)
+	}
+	if i != len(s) {
+		return fmt.Errorf("invalid number %q", s)
+	}
+
+	// Leading and trailing zeros are not significant
+	first := 0
+	for first < len(digits) && digits[first] == '0' {
+		first++
+	}
+	if first == len(digits) {
+		return nil // Zero
+	}
+	last := len(digits)
+	for digits[last-1] == '0' {
+		last--
+	}
+	if last-first > maxNumberDigits {
+		return fmt.Errorf("number %q has more than %d significant digits", s, maxNumberDigits)
+	}
+	if magnitude := point - first - 1 + exp; magnitude < minNumberExponent || magnitude > maxNumberExponent {
+		return fmt.Errorf("number %q is outside the range 1E%d to 9.9…E+%d", s, minNumberExponent, maxNumberExponent)
+	}
+	return nil
+}
+
+// checkStrictBase64 rejects characters the standard decoder skips.
+func checkStrictBase64(raw []byte) error {
+	for _, c := range raw {
+		if c == '\r' || c == '\n' {
+			return fmt.Errorf("invalid base64: line break in binary value")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package itemimage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TestNumberAndBinaryIntegrity verifies both decoders pass numbers through as
+// the exact strings in the export, so no precision is lost on 38-digit values
+// or exponent forms, and decode binary values to their exact bytes.
+func TestNumberAndBinaryIntegrity(t *testing.T) {
+	numbers := []string{
+		"12345678901234567890123456789012345678",
+		"-0.00000000000000000000000000000000000001",
+		"9.9999999999999999999999999999999999999E+125",
+		"1E-130",
+		"1.5e3",
+		"-0",
+	}
+	binary := []byte{0x00, 0xff, 0x10, 0x80, 0x7f, '\n', 0x00}
+	for _, d := range []*JSONDecoder{NewJSONDecoder(), NewJSONDecoder(WithStrictDecoding()), NewJSONDecoder(WithSDKDecoding())} {
+		for _, n := range numbers {
+			line := fmt.Sprintf(`{"Item":{"n":{"N":%q},"ns":{"NS":[%q]},"b":{"B":"AP8QgH8KAA=="}}}`, n, n)
+			op, err := d.Decode([]byte(line))
+			if err != nil {
+				t.Fatalf("Decode(%s): %v", line, err)
+			}
+			if got := op.NewImage["n"].(*types.AttributeValueMemberN).Value; got != n {
+				t.Errorf("N = %q, want %q", got, n)
+			}
+			if got := op.NewImage["ns"].(*types.AttributeValueMemberNS).Value; len(got) != 1 || got[0] != n {
+				t.Errorf("NS = %q, want [%q]", got, n)
+			}
+			if got := op.NewImage["b"].(*types.AttributeValueMemberB).Value; !bytes.Equal(got, binary) {
+				t.Errorf("B = %x, want %x", got, binary)
+			}
+		}
+	}
+}
+
+// TestStrictDecodingRejectsInvalidValues checks that strict mode classifies
+// values DynamoDB would reject as corrupt, naming the attribute, while the
+// default decoder passes them through to fail at write time.
+func TestStrictDecodingRejectsInvalidValues(t *testing.T) {
+	cases := map[string]string{
+		`{"Item":{"n":{"N":"1e999"}}}`:                                   "outside the range",
+		`{"Item":{"n":{"N":"1E126"}}}`:                                   "outside the range",
+		`{"Item":{"n":{"N":"9E-131"}}}`:                                  "outside the range",
+		`{"Item":{"n":{"N":"0x10"}}}`:                                    "invalid number",
+		`{"Item":{"n":{"N":""}}}`:                                        "invalid number",
+		`{"Item":{"n":{"N":"1.2.3"}}}`:                                   "invalid number",
+		`{"Item":{"n":{"N":"NaN"}}}`:                                     "invalid number",
+		`{"Item":{"n":{"N":"1e"}}}`:                                      "invalid number",
+		`{"Item":{"n":{"N":" 1"}}}`:                                      "invalid number",
+		`{"Item":{"ns":{"NS":["1","x"]}}}`:                               "invalid number",
+		`{"Item":{"n":{"N":"123456789012345678901234567890123456789"}}}`: "more than 38 significant digits",
+		`{"Item":{"m":{"M":{"b":{"B":"aGVsbG8=\n"}}}}}`:                  "line break",
+		`{"Item":{"b":{"B":"aGVsbG9="}}}`:                                "invalid base64",
+		`{"Item":{"bs":{"BS":["AQ==","AR=="]}}}`:                         "invalid base64",
+	}
+	strict := NewJSONDecoder(WithStrictDecoding())
+	lenient := NewJSONDecoder()
+	for line, want := range cases {
+		_, err := strict.Decode([]byte(line))
+		if !errors.Is(err, ErrCorrupt) || !strings.Contains(err.Error(), want) {
+			t.Errorf("strict Decode(%s) error = %v, want ErrCorrupt containing %q", line, err, want)
+		}
+		if strings.Contains(line, `"N"`) {
+			if _, err := lenient.Decode([]byte(line)); err != nil {
+				t.Errorf("lenient Decode(%s) error = %v, want the value passed through", line, err)
+			}
+		}
+	}
+
+	// Trailing zeros are not significant, so this is 1 digit of precision
+	if _, err := strict.Decode([]byte(`{"Item":{"n":{"N":"100000000000000000000000000000000000000000"}}}`)); err != nil {
+		t.Errorf("unexpected error for trailing zeros: %v", err)
+	}
+}
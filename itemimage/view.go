@@ -0,0 +1,97 @@
+package itemimage
+
+import "fmt"
+
+// View is the export type and view a JSONDecoder reads lines as; see WithView.
+type View int
+
+const (
+	ViewAny       View = iota // Infer each line's operation from the sections it holds
+	ViewFull                  // Full export items, wrapped in "Item" or bare
+	ViewNew                   // Incremental records of the NEW_IMAGE view
+	ViewNewAndOld             // Incremental records of the NEW_AND_OLD_IMAGES view
+)
+
+// WithView makes the decoder read every line as a record of view, for data
+// files whose manifest, and with it the export type and view, was lost when
+// downstream ETL split or converted them:
+//   - ViewFull: {"Item": {...}} or a bare item is an OpPut
+//   - ViewNew: a NewImage is an OpPut, any OldImage is ignored, and a record
+//     with only Keys is an OpDelete
+//   - ViewNewAndOld: as ViewAny for incremental records
+//
+// A line of the other export type fails with ErrCorrupt. Bare items are always
+// decoded with the built-in parser, and are read as records when they have a
+// top-level attribute named like a record section, such as "Keys".
+// Example:
+//
+//	decoder := itemimage.NewJSONDecoder(itemimage.WithView(itemimage.ViewFull))
+func WithView(view View) DecoderOption {
+	return func(d *JSONDecoder) {
+		d.view = view
+	}
+}
+
+// ForView returns d reading every line as a record of view, as WithView does,
+// for decoders chosen before the view was known. Decoders that are not a
+// JSONDecoder, or already read a view, are returned unchanged.
+// Example:
+//
+//	if summary.OutputView == "NEW_IMAGE" {
+//	    decoder = itemimage.ForView(decoder, itemimage.ViewNew)
+//	}
+func ForView(d Decoder, view View) Decoder {
+	jd, ok := d.(*JSONDecoder)
+	if !ok || jd.view != ViewAny {
+		return d
+	}
+	viewed := *jd
+	viewed.view = view
+	return &viewed
+}
+
+// decodeView returns the operation of rec, the record decoded from line, for
+// the decoder's view.
+func (d *JSONDecoder) decodeView(line []byte, rec record) (Operation, error) {
+	incremental := rec.Keys != nil || rec.NewImage != nil || rec.OldImage != nil
+	if d.view == ViewFull {
+		switch {
+		case rec.Item != nil:
+			return Operation{Type: OpPut, NewImage: rec.Item, WriteTimestampMicros: rec.WriteTimestamp}, nil
+		case incremental:
+			return Operation{}, fmt.Errorf("%w: incremental record in a full export", ErrCorrupt)
+		}
+		p := parser{data: line, strict: d.strict}
+		item, err := p.parseMap()
+		if err == nil {
+			err = p.end()
+		}
+		if err != nil {
+			return Operation{}, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		if len(item) == 0 {
+			return Operation{}, fmt.Errorf("%w: empty item", ErrCorrupt)
+		}
+		return Operation{Type: OpPut, NewImage: item}, nil
+	}
+
+	if rec.Item != nil {
+		return Operation{}, fmt.Errorf("%w: full export item in an incremental export", ErrCorrupt)
+	}
+	op := Operation{Keys: rec.Keys, NewImage: rec.NewImage, OldImage: rec.OldImage, WriteTimestampMicros: rec.WriteTimestamp}
+	switch {
+	case d.view == ViewNew && op.NewImage != nil:
+		op.Type, op.OldImage = OpPut, nil
+	case d.view == ViewNew && op.Keys != nil:
+		op.Type, op.OldImage = OpDelete, nil
+	case d.view == ViewNewAndOld && op.NewImage != nil && op.OldImage != nil:
+		op.Type = OpUpdate
+	case d.view == ViewNewAndOld && op.NewImage != nil:
+		op.Type = OpPut
+	case d.view == ViewNewAndOld && (op.OldImage != nil || op.Keys != nil):
+		op.Type = OpDelete
+	default:
+		return Operation{}, fmt.Errorf("%w: no image data found", ErrCorrupt)
+	}
+	return op, nil
+}
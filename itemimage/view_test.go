@@ -0,0 +1,47 @@
+package itemimage
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestDecodeWithView checks lines are read as the configured view rather than
+// guessed from their sections: bare items of converted full exports are puts,
+// the NEW view ignores old images kept by ETL, and lines of the other export
+// type are rejected instead of being applied with the wrong meaning.
+func TestDecodeWithView(t *testing.T) {
+	cases := []struct {
+		view View
+		line string
+		want OperationType
+		err  bool
+	}{
+		{ViewFull, `{"Item":{"pk":{"S":"a"}}}`, OpPut, false},
+		{ViewFull, `{"pk":{"S":"a"},"n":{"N":"1"}}`, OpPut, false},
+		{ViewFull, `{"Keys":{"pk":{"S":"a"}}}`, 0, true},
+		{ViewFull, `{}`, 0, true},
+		{ViewNew, `{"Keys":{"pk":{"S":"a"}},"NewImage":{"pk":{"S":"a"}},"OldImage":{"pk":{"S":"a"}}}`, OpPut, false},
+		{ViewNew, `{"Keys":{"pk":{"S":"a"}}}`, OpDelete, false},
+		{ViewNew, `{"Item":{"pk":{"S":"a"}}}`, 0, true},
+		{ViewNewAndOld, `{"Keys":{"pk":{"S":"a"}},"NewImage":{"pk":{"S":"a"}},"OldImage":{"pk":{"S":"a"}}}`, OpUpdate, false},
+		{ViewNewAndOld, `{"Keys":{"pk":{"S":"a"}},"OldImage":{"pk":{"S":"a"}}}`, OpDelete, false},
+		{ViewNewAndOld, `{"pk":{"S":"a"}}`, 0, true},
+	}
+	for _, tc := range cases {
+		for _, opts := range [][]DecoderOption{{WithView(tc.view)}, {WithView(tc.view), WithSDKDecoding()}} {
+			op, err := NewJSONDecoder(opts...).Decode([]byte(tc.line))
+			if tc.err {
+				if !errors.Is(err, ErrCorrupt) {
+					t.Errorf("view %d, %s: expected ErrCorrupt, got %v", tc.view, tc.line, err)
+				}
+				continue
+			}
+			if err != nil || op.Type != tc.want {
+				t.Errorf("view %d, %s: got %v, %v; want %v", tc.view, tc.line, op.Type, err, tc.want)
+			}
+			if tc.view == ViewNew && op.OldImage != nil {
+				t.Errorf("view %d, %s: expected the old image to be dropped", tc.view, tc.line)
+			}
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Package journal keeps an append-only record of every operation a restore
+// applied, for compliance reviews and for undoing or redoing a restore. Entries
+// are JSON lines uploaded to S3 in objects of bounded size; a Source reads them
+// back as the operations that replay the restore or compensate for it.
+package journal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/oprecord"
+	"github.com/gurre/ddb-pitr/s3uri"
+)
+
+// DefaultRotateBytes is the size at which a journal object is uploaded and the
+// next one started.
+const DefaultRotateBytes = 64 << 20
+
+// runTimeFormat names the objects of one run so runs sharing a prefix sort by
+// the time they started.
+const runTimeFormat = "20060102T150405.000000000Z"
+
+// Results of an entry.
+const (
+	ResultApplied = "applied" // The write succeeded
+	ResultFailed  = "failed"  // The write failed; the batch may be retried later
+)
+
+// Entry is one journal line. Its operation fields have the shape of an
+// incremental export line, so entries decode with the export decoder.
+type Entry struct {
+	oprecord.Record
+	Time   time.Time `json:"Time"`            // When the write returned
+	Table  string    `json:"Table"`           // Table written
+	Result string    `json:"Result"`          // ResultApplied or ResultFailed
+	Error  string    `json:"Error,omitempty"` // Write error of a failed entry
+}
+
+// NewEntry builds the entry of op written to table. writeErr is the error of
+// the write, or nil when it succeeded. keyAttrs names the table's primary key
+// attributes, used to record the key of operations that carry only an image,
+// such as the puts of full exports.
+// Example:
+//
+//	entry, err := journal.NewEntry("orders", []string{"pk"}, op, nil)
+func NewEntry(table string, keyAttrs []string, op itemimage.Operation, writeErr error) (Entry, error) {
+	if len(op.Keys) == 0 {
+		op.Keys = keysOf(op, keyAttrs)
+	}
+	rec, err := oprecord.New(op)
+	if err != nil {
+		return Entry{}, err
+	}
+	e := Entry{Record: rec, Time: time.Now().UTC(), Table: table, Result: ResultApplied}
+	if writeErr != nil {
+		e.Result, e.Error = ResultFailed, writeErr.Error()
+	}
+	return e, nil
+}
+
+// keysOf picks keyAttrs from the image of op, or returns nil when one is missing.
+func keysOf(op itemimage.Operation, keyAttrs []string) map[string]types.AttributeValue {
+	image := op.NewImage
+	if image == nil {
+		image = op.OldImage
+	}
+	if len(keyAttrs) == 0 || image == nil {
+		return nil
+	}
+	keys := make(map[string]types.AttributeValue, len(keyAttrs))
+	for _, attr := range keyAttrs {
+		v, ok := image[attr]
+		if !ok {
+			return nil
+		}
+		keys[attr] = v
+	}
+	return keys
+}
+
+// PutClient is the subset of the S3 client used to upload journal objects.
+type PutClient interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// Journal buffers entries and uploads them to S3 as JSON lines, one object per
+// rotateBytes, named <prefix><run start time>/<sequence>.jsonl so the objects
+// of a prefix list in the order they were written. Objects are never rewritten.
+// An upload holds up other appends, keeping the objects in order. It is safe
+// for concurrent use by multiple workers.
+// Example:
+//
+//	j, err := journal.New(s3.NewFromConfig(cfg), "s3://audit-bucket/restores/", journal.DefaultRotateBytes)
+//	if err != nil {
+//	    return err
+//	}
+//	defer j.Close(ctx)
+type Journal struct {
+	client      PutClient
+	prefix      s3uri.URI // Prefix of this run's objects
+	rotateBytes int       // Buffered size at which an object is uploaded
+
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	seq     int   // Sequence number of the next object
+	entries int64 // Entries appended
+}
+
+// New creates a Journal writing under the s3:// prefix uri.
+func New(client PutClient, uri string, rotateBytes int) (*Journal, error) {
+	u, err := s3uri.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if rotateBytes <= 0 {
+		rotateBytes = DefaultRotateBytes
+	}
+	run := time.Now().UTC().Format(runTimeFormat)
+	return &Journal{client: client, prefix: u.Join(run + "/"), rotateBytes: rotateBytes}, nil
+}
+
+// URI returns the prefix of this run's objects.
+func (j *Journal) URI() string {
+	return j.prefix.String()
+}
+
+// Append adds entries, uploading the buffered object once it reaches the
+// rotation size.
+func (j *Journal) Append(ctx context.Context, entries ...Entry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to encode journal entry: %w", err)
+		}
+		j.buf.Write(line)
+		j.buf.WriteByte('\n')
+		j.entries++
+	}
+	if j.buf.Len() >= j.rotateBytes {
+		return j.upload(ctx)
+	}
+	return nil
+}
+
+// Count returns the number of entries appended.
+func (j *Journal) Count() int64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.entries
+}
+
+// Close uploads the entries not yet uploaded.
+func (j *Journal) Close(ctx context.Context) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.buf.Len() == 0 {
+		return nil
+	}
+	return j.upload(ctx)
+}
+
+// upload writes the buffered entries as the next object. mu must be held.
+func (j *Journal) upload(ctx context.Context) error {
+	key := j.prefix.Join(fmt.Sprintf("%06d.jsonl", j.seq))
+	_, err := j.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      awssdk.String(key.Bucket),
+		Key:         awssdk.String(key.Key),
+		Body:        bytes.NewReader(j.buf.Bytes()),
+		ContentType: awssdk.String("application/x-ndjson"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload journal %s: %w", key, err)
+	}
+	j.seq++
+	j.buf.Reset()
+	return nil
+}
+
+// BatchWriter is the subset of writer.Writer wrapped by Writer.
+type BatchWriter interface {
+	WriteBatch(ctx context.Context, ops []itemimage.Operation) error
+	Flush(ctx context.Context) error
+}
+
+// Writer journals every operation written through it, with the write's result.
+// Example:
+//
+//	w := journal.NewWriter(writer.NewDynamoDBWriter(client, table, 25), j, table, []string{"pk"})
+type Writer struct {
+	next     BatchWriter
+	journal  *Journal
+	table    string
+	keyAttrs []string
+}
+
+// NewWriter wraps next so its writes to table are journaled. keyAttrs names the
+// table's primary key attributes; see NewEntry.
+func NewWriter(next BatchWriter, j *Journal, table string, keyAttrs []string) *Writer {
+	return &Writer{next: next, journal: j, table: table, keyAttrs: keyAttrs}
+}
+
+// WriteBatch writes ops and journals each of them. A batch that fails is
+// journaled as failed, since the operations it wrote before failing cannot be
+// told apart. Failing to journal fails the batch, so no write goes unrecorded.
+func (w *Writer) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	writeErr := w.next.WriteBatch(ctx, ops)
+	entries := make([]Entry, 0, len(ops))
+	for _, op := range ops {
+		e, err := NewEntry(w.table, w.keyAttrs, op, writeErr)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, e)
+	}
+	if err := w.journal.Append(ctx, entries...); err != nil {
+		return errors.Join(writeErr, err)
+	}
+	return writeErr
+}
+
+// Flush flushes the wrapped writer. Entries are uploaded by Journal.Close.
+func (w *Writer) Flush(ctx context.Context) error {
+	return w.next.Flush(ctx)
+}
@@ -0,0 +1,235 @@
+package journal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/replay"
+	"github.com/gurre/ddb-pitr/writer"
+)
+
+// memS3 stores objects in memory, keyed by bucket/key.
+type memS3 struct {
+	objects map[string][]byte
+}
+
+func (m *memS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.objects[*params.Bucket+"/"+*params.Key] = body
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (m *memS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	out := &s3.ListObjectsV2Output{}
+	for name := range m.objects {
+		if key, ok := strings.CutPrefix(name, *params.Bucket+"/"); ok && strings.HasPrefix(key, *params.Prefix) {
+			out.Contents = append(out.Contents, s3types.Object{Key: awssdk.String(key)})
+		}
+	}
+	// S3 lists in key order; list in reverse to check the source sorts
+	sort.Slice(out.Contents, func(i, j int) bool { return *out.Contents[i].Key > *out.Contents[j].Key })
+	return out, nil
+}
+
+func (m *memS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	body, ok := m.objects[*params.Bucket+"/"+*params.Key]
+	if !ok {
+		return nil, errors.New("no such key")
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(body))}, nil
+}
+
+// batchWriter records written batches, failing those containing a "bad" key.
+type batchWriter struct {
+	ops []itemimage.Operation
+}
+
+func (w *batchWriter) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	for _, op := range ops {
+		if pk(op) == "bad" {
+			return errors.New("ValidationException: item too large")
+		}
+	}
+	w.ops = append(w.ops, ops...)
+	return nil
+}
+
+func (w *batchWriter) Flush(ctx context.Context) error { return nil }
+
+func s(v string) types.AttributeValue { return &types.AttributeValueMemberS{Value: v} }
+
+func pk(op itemimage.Operation) string {
+	for _, image := range []map[string]types.AttributeValue{op.Keys, op.NewImage, op.OldImage} {
+		if v, ok := image["pk"].(*types.AttributeValueMemberS); ok {
+			return v.Value
+		}
+	}
+	return ""
+}
+
+// describe summarises operations as TYPE:pk:value, value being the v attribute
+// of the new image.
+func describe(ops []itemimage.Operation) string {
+	var parts []string
+	for _, op := range ops {
+		part := op.Type.String() + ":" + pk(op)
+		if v, ok := op.NewImage["v"].(*types.AttributeValueMemberS); ok {
+			part += ":" + v.Value
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+// journalRun writes a small restore through a journaled writer: a full export
+// put whose key comes from the key schema, incremental changes with old
+// images, a delete without one, and a failed batch.
+func journalRun(t *testing.T, client *memS3) string {
+	t.Helper()
+	j, err := New(client, "s3://audit/restores/", 200) // Small objects, to rotate
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWriter(&batchWriter{}, j, "orders", []string{"pk"})
+	batches := [][]itemimage.Operation{
+		{{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"pk": s("a"), "v": s("1")}, SourceFile: "data/1.json.gz", ByteOffset: 10}},
+		{{Type: itemimage.OpUpdate, Keys: map[string]types.AttributeValue{"pk": s("b")},
+			NewImage: map[string]types.AttributeValue{"pk": s("b"), "v": s("2")}, OldImage: map[string]types.AttributeValue{"pk": s("b"), "v": s("old")}}},
+		{{Type: itemimage.OpDelete, Keys: map[string]types.AttributeValue{"pk": s("c")}}},
+		{{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"pk": s("bad")}}},
+	}
+	for _, batch := range batches {
+		_ = w.WriteBatch(context.Background(), batch)
+	}
+	if err := j.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if j.Count() != 4 || len(client.objects) < 2 {
+		t.Fatalf("expected 4 entries over several objects, got %d in %d", j.Count(), len(client.objects))
+	}
+	return j.URI()
+}
+
+// TestWriterJournalsResults checks every write is journaled with its source and
+// result, including failed ones, and that the write error is still returned.
+func TestWriterJournalsResults(t *testing.T) {
+	client := &memS3{objects: map[string][]byte{}}
+	j, err := New(client, "s3://audit/restores", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWriter(&batchWriter{}, j, "orders", []string{"pk"})
+	if err := w.WriteBatch(context.Background(), []itemimage.Operation{{Type: itemimage.OpPut,
+		NewImage: map[string]types.AttributeValue{"pk": s("bad")}, SourceFile: "data/1.json.gz", ByteOffset: 42}}); err == nil {
+		t.Fatal("expected the write error")
+	}
+	if len(client.objects) != 0 {
+		t.Fatalf("expected entries to be buffered until Close, got %d objects", len(client.objects))
+	}
+	if err := j.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range client.objects {
+		if !strings.HasPrefix(name, "audit/restores/") || !strings.HasSuffix(name, "/000000.jsonl") {
+			t.Errorf("unexpected object name %s", name)
+		}
+		for _, want := range []string{`"Table":"orders"`, `"Result":"failed"`, `"Error":"ValidationException: item too large"`,
+			`"Operation":"PUT"`, `"Keys":{"pk":{"S":"bad"}}`, `"SourceFile":"data/1.json.gz"`, `"ByteOffset":42`} {
+			if !bytes.Contains(body, []byte(want)) {
+				t.Errorf("expected %s in %s", want, body)
+			}
+		}
+	}
+}
+
+// TestSourceReplaysAndInverts checks a journal spread over several objects is
+// read back in order: replaying repeats the applied writes, and inverting undoes
+// them newest first, restoring old images, deleting items that had none and
+// skipping deletes that cannot be undone.
+func TestSourceReplaysAndInverts(t *testing.T) {
+	client := &memS3{objects: map[string][]byte{}}
+	uri := journalRun(t, client)
+
+	tests := []struct {
+		mode Mode
+		want string
+	}{
+		{Replay, "PUT:a:1 UPDATE:b:2 DELETE:c"},
+		{Invert, "PUT:b:old DELETE:a"},
+	}
+	for _, tt := range tests {
+		src, err := Open(context.Background(), client, uri, "orders", tt.mode, itemimage.NewJSONDecoder())
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &batchWriter{}
+		if _, err := replay.NewApplier([]writer.Writer{w}, 25).Apply(context.Background(), src); err != nil {
+			t.Fatalf("mode %d: %v", tt.mode, err)
+		}
+		if got := describe(w.ops); got != tt.want {
+			t.Errorf("mode %d: got %q, want %q", tt.mode, got, tt.want)
+		}
+		stats := src.Stats()
+		if stats.Entries != 4 || stats.Skipped != 1 {
+			t.Errorf("mode %d: unexpected stats %+v", tt.mode, stats)
+		}
+		if tt.mode == Invert && stats.Unrecoverable != 1 {
+			t.Errorf("expected the delete to be unrecoverable, got %+v", stats)
+		}
+	}
+
+	// Entries of other tables are skipped
+	src, err := Open(context.Background(), client, uri, "invoices", Replay, itemimage.NewJSONDecoder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op, err := src.Next(); err != io.EOF {
+		t.Errorf("expected no operations for another table, got %v, %v", op, err)
+	}
+}
+
+// TestCompensateIncrementalExport checks the records of an incremental export
+// with old images undo the export: changed and deleted items get their old
+// image back, created items are deleted, and a key-only delete is reported as
+// not undoable rather than guessed at.
+func TestCompensateIncrementalExport(t *testing.T) {
+	lines := []string{
+		`{"Keys":{"pk":{"S":"a"}},"NewImage":{"pk":{"S":"a"},"v":{"S":"2"}},"OldImage":{"pk":{"S":"a"},"v":{"S":"1"}}}`,
+		`{"Keys":{"pk":{"S":"b"}},"NewImage":{"pk":{"S":"b"},"v":{"S":"new"}}}`,
+		`{"Keys":{"pk":{"S":"c"}},"OldImage":{"pk":{"S":"c"},"v":{"S":"gone"}}}`,
+		`{"Keys":{"pk":{"S":"d"}}}`,
+	}
+	decoder := itemimage.NewJSONDecoder(itemimage.WithView(itemimage.ViewNewAndOld))
+	var undo []itemimage.Operation
+	unrecoverable := 0
+	for _, line := range lines {
+		op, err := decoder.Decode([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inverse, ok := Compensate(op); ok {
+			undo = append(undo, inverse)
+		} else {
+			unrecoverable++
+		}
+	}
+	if got, want := describe(undo), "PUT:a:1 DELETE:b PUT:c:gone"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if unrecoverable != 1 {
+		t.Errorf("expected the key-only delete to be unrecoverable, got %d", unrecoverable)
+	}
+}
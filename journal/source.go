@@ -0,0 +1,220 @@
+package journal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/oprecord"
+	"github.com/gurre/ddb-pitr/replay"
+	"github.com/gurre/ddb-pitr/s3uri"
+)
+
+// maxEntryBytes bounds one journal line; DynamoDB items are at most 400 KB, and
+// an entry holds at most two images.
+const maxEntryBytes = 4 << 20
+
+// ReadClient is the subset of the S3 client used to read a journal.
+type ReadClient interface {
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// Mode selects the operations a Source derives from the journal.
+type Mode int
+
+const (
+	// Replay yields the applied operations again, in the order they were applied.
+	Replay Mode = iota
+	// Invert yields compensating operations, newest first: the old image is put
+	// back where the entry has one, an item without one is deleted, and a delete
+	// without one cannot be undone and is skipped.
+	Invert
+)
+
+// SourceStats counts the entries a Source read.
+type SourceStats struct {
+	Entries       int64 // Entries read
+	Skipped       int64 // Failed entries and entries of other tables
+	Unrecoverable int64 // Inverted deletes without an old image, and entries without a key
+}
+
+// Source reads the journal objects under a prefix, oldest first, and yields
+// the operations that replay or invert the entries applied to one table. It
+// implements replay.Source, so a replay.Applier writes them.
+// Example:
+//
+//	src, err := journal.Open(ctx, s3.NewFromConfig(cfg), "s3://audit-bucket/restores/", "orders", journal.Invert, decoder)
+//	if err != nil {
+//	    return err
+//	}
+//	stats, err := replay.NewApplier(writers, 25).Apply(ctx, src)
+type Source struct {
+	ctx     context.Context // Context for reading objects, as Next takes none
+	client  ReadClient
+	bucket  string
+	keys    []string // Objects still to read, in the order to read them
+	table   string
+	mode    Mode
+	decoder itemimage.Decoder
+	pending []itemimage.Operation // Operations of the object read last, in the order to yield them
+	stats   SourceStats
+}
+
+// Open lists the journal objects under the s3:// prefix uri. Objects are read
+// one at a time, and inverting reads them newest first, so memory is bounded
+// by one object.
+func Open(ctx context.Context, client ReadClient, uri, table string, mode Mode, decoder itemimage.Decoder) (*Source, error) {
+	u, err := s3uri.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	input := &s3.ListObjectsV2Input{Bucket: awssdk.String(u.Bucket), Prefix: awssdk.String(u.Key)}
+	for {
+		out, err := client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list journal %s: %w", uri, err)
+		}
+		for _, obj := range out.Contents {
+			if key := awssdk.ToString(obj.Key); strings.HasSuffix(key, ".jsonl") {
+				keys = append(keys, key)
+			}
+		}
+		if !awssdk.ToBool(out.IsTruncated) {
+			break
+		}
+		input.ContinuationToken = out.NextContinuationToken
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no journal objects under %s", uri)
+	}
+	sort.Strings(keys)
+	if mode == Invert {
+		slices.Reverse(keys)
+	}
+	// Entries name their operation, so one carrying only Keys is a delete
+	decoder = itemimage.ForView(decoder, itemimage.ViewNewAndOld)
+	return &Source{ctx: ctx, client: client, bucket: u.Bucket, keys: keys, table: table, mode: mode, decoder: decoder}, nil
+}
+
+// Stats returns the counts of the entries read so far.
+func (s *Source) Stats() SourceStats {
+	return s.stats
+}
+
+// Next returns the next operation, or io.EOF after the last.
+func (s *Source) Next() (itemimage.Operation, error) {
+	for len(s.pending) == 0 {
+		if len(s.keys) == 0 {
+			return itemimage.Operation{}, io.EOF
+		}
+		key := s.keys[0]
+		s.keys = s.keys[1:]
+		if err := s.read(key); err != nil {
+			return itemimage.Operation{}, fmt.Errorf("journal s3://%s/%s: %w", s.bucket, key, err)
+		}
+	}
+	op := s.pending[0]
+	s.pending = s.pending[1:]
+	return op, nil
+}
+
+// read loads the operations of one object into pending.
+func (s *Source) read(key string) error {
+	out, err := s.client.GetObject(s.ctx, &s3.GetObjectInput{Bucket: awssdk.String(s.bucket), Key: awssdk.String(key)})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+	scanner := bufio.NewScanner(out.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEntryBytes)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		op, ok, err := s.decode(scanner.Bytes())
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if ok {
+			s.pending = append(s.pending, op)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if s.mode == Invert {
+		slices.Reverse(s.pending)
+	}
+	return nil
+}
+
+// decode converts one entry into the operation to yield, reporting false for
+// entries that yield none.
+func (s *Source) decode(line []byte) (itemimage.Operation, bool, error) {
+	s.stats.Entries++
+	var e struct {
+		Table     string `json:"Table"`
+		Result    string `json:"Result"`
+		Operation string `json:"Operation"`
+	}
+	if err := json.Unmarshal(line, &e); err != nil {
+		return itemimage.Operation{}, false, fmt.Errorf("%w: %v", itemimage.ErrCorrupt, err)
+	}
+	if e.Result != ResultApplied || e.Table != s.table {
+		s.stats.Skipped++
+		return itemimage.Operation{}, false, nil
+	}
+	op, err := s.decoder.Decode(line)
+	if err != nil {
+		return itemimage.Operation{}, false, err
+	}
+	if op.Type, err = oprecord.ParseType(e.Operation); err != nil {
+		return itemimage.Operation{}, false, fmt.Errorf("%w: %v", itemimage.ErrCorrupt, err)
+	}
+	if s.mode == Replay {
+		return op, true, nil
+	}
+	inverse, ok := Compensate(op)
+	if !ok {
+		s.stats.Unrecoverable++
+	}
+	return inverse, ok, nil
+}
+
+// Compensate returns the operation undoing op: its old image is put back where
+// it has one, and an item written without one is deleted. It reports false for
+// deletes without an old image and operations without a key, which cannot be
+// undone. The operations of an incremental export exported with old images
+// compensate for applying that export.
+// Example:
+//
+//	if undo, ok := journal.Compensate(op); ok {
+//	    batch = append(batch, undo)
+//	}
+func Compensate(op itemimage.Operation) (itemimage.Operation, bool) {
+	if len(op.Keys) == 0 {
+		return itemimage.Operation{}, false
+	}
+	switch {
+	case op.OldImage != nil:
+		// The old image is the whole item as it was before the write
+		return itemimage.Operation{Type: itemimage.OpPut, Keys: op.Keys, NewImage: op.OldImage}, true
+	case op.Type != itemimage.OpDelete:
+		return itemimage.Operation{Type: itemimage.OpDelete, Keys: op.Keys}, true
+	default:
+		return itemimage.Operation{}, false
+	}
+}
+
+// Compile-time check that a Source can be applied by a replay.Applier.
+var _ replay.Source = (*Source)(nil)
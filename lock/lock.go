@@ -0,0 +1,367 @@
+// Package lock keeps two restores from writing to the same table at once. A lock
+// is an S3 object that is only created when absent, renewed by a heartbeat while
+// the restore runs and deleted when it ends. A lock whose holder stopped renewing
+// it expires and can be taken over.
+package lock
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/clock"
+	"github.com/gurre/ddb-pitr/s3uri"
+)
+
+// DefaultTTL is how long a lock stays valid without being renewed.
+const DefaultTTL = 2 * time.Minute
+
+// ErrLocked is matched by errors.Is when a lock is held by another restore.
+var ErrLocked = errors.New("locked by another restore")
+
+// Client is the subset of the S3 client used for locks.
+type Client interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// Info is the content of a lock object.
+type Info struct {
+	Owner      string    `json:"owner"`      // Random ID of the holding process, passed to -force-unlock
+	Host       string    `json:"host"`       // Host name of the holding process
+	PID        int       `json:"pid"`        // Process ID of the holding process
+	Table      string    `json:"table"`      // Table being restored
+	Export     string    `json:"export"`     // Export being restored
+	AcquiredAt time.Time `json:"acquiredAt"` // When the lock was acquired
+	ExpiresAt  time.Time `json:"expiresAt"`  // When the lock expires unless renewed
+}
+
+// LockedError reports the restore holding a lock.
+type LockedError struct {
+	URI    string // Lock object
+	Holder Info   // Current holder
+}
+
+// Error describes the holder and how to take the lock over.
+func (e *LockedError) Error() string {
+	h := e.Holder
+	return fmt.Sprintf("table %s is being restored from %s by %s (pid %d on %s) since %s; lock %s expires at %s unless renewed. "+
+		"If that restore is no longer running, pass -force-unlock %s",
+		h.Table, h.Export, h.Owner, h.PID, h.Host, h.AcquiredAt.Format(time.RFC3339), e.URI, h.ExpiresAt.Format(time.RFC3339), h.Owner)
+}
+
+// Is makes errors.Is(err, ErrLocked) match.
+func (e *LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// Lock is a lock on one table and export, held in an S3 object.
+// Example:
+//
+//	l, err := lock.New(s3Client, "s3://my-bucket/ddb-pitr-locks/eu-west-1/orders.json", "orders", exportURI)
+//	if err != nil {
+//	    return err
+//	}
+//	if err := l.Acquire(ctx); err != nil {
+//	    return err
+//	}
+//	defer l.Release(context.Background())
+//	go l.KeepAlive(ctx, func(err error) { cancel() })
+type Lock struct {
+	client Client
+	uri    s3uri.URI
+	ttl    time.Duration
+	clock  clock.Clock
+	info   Info
+
+	mu   sync.Mutex
+	etag string // ETag of the lock object while held
+}
+
+// Option configures optional Lock behavior.
+type Option func(*Lock)
+
+// WithTTL sets how long the lock stays valid without renewal. KeepAlive renews
+// it three times per TTL.
+func WithTTL(d time.Duration) Option {
+	return func(l *Lock) {
+		if d > 0 {
+			l.ttl = d
+		}
+	}
+}
+
+// WithClock sets the time source for expiry and renewal.
+func WithClock(c clock.Clock) Option {
+	return func(l *Lock) {
+		l.clock = c
+	}
+}
+
+// WithOwner sets the owner ID instead of a random one, so the locks taken by
+// one restore on several tables share an ID.
+func WithOwner(owner string) Option {
+	return func(l *Lock) {
+		if owner != "" {
+			l.info.Owner = owner
+		}
+	}
+}
+
+// New creates an unacquired lock on table and export stored at uri, with a new
+// random owner ID unless WithOwner is given.
+func New(client Client, uri, table, export string, opts ...Option) (*Lock, error) {
+	u, err := s3uri.ParseObject(uri)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate lock owner: %w", err)
+	}
+	host, _ := os.Hostname()
+	l := &Lock{
+		client: client,
+		uri:    u,
+		ttl:    DefaultTTL,
+		clock:  clock.Real,
+		info: Info{
+			Owner:  hex.EncodeToString(id),
+			Host:   host,
+			PID:    os.Getpid(),
+			Table:  table,
+			Export: export,
+		},
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l, nil
+}
+
+// Owner returns the owner ID written to the lock object.
+func (l *Lock) Owner() string {
+	return l.info.Owner
+}
+
+// Acquire creates the lock object. When another restore holds an unexpired lock
+// it returns a *LockedError; an expired lock is taken over.
+func (l *Lock) Acquire(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now().UTC()
+	l.info.AcquiredAt = now
+	l.info.ExpiresAt = now.Add(l.ttl)
+
+	// A lock deleted between the failed create and the read is retried once
+	for attempt := 0; attempt < 2; attempt++ {
+		etag, err := l.put(ctx, &s3.PutObjectInput{IfNoneMatch: awssdk.String("*")})
+		if err == nil {
+			l.etag = etag
+			return nil
+		}
+		if !isConflict(err) {
+			return fmt.Errorf("failed to create lock %s: %w", l.uri, err)
+		}
+
+		holder, holderETag, err := read(ctx, l.client, l.uri)
+		if errors.Is(err, errNoLock) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if now.Before(holder.ExpiresAt) {
+			return &LockedError{URI: l.uri.String(), Holder: holder}
+		}
+		etag, err = l.put(ctx, &s3.PutObjectInput{IfMatch: awssdk.String(holderETag)})
+		if err != nil {
+			if isConflict(err) {
+				return fmt.Errorf("lock %s was taken over by another restore at the same time: %w", l.uri, ErrLocked)
+			}
+			return fmt.Errorf("failed to take over expired lock %s: %w", l.uri, err)
+		}
+		l.etag = etag
+		return nil
+	}
+	return fmt.Errorf("lock %s keeps changing; retry the restore: %w", l.uri, ErrLocked)
+}
+
+// Renew extends the lock by its TTL. It fails if the lock was released, taken
+// over or force-unlocked since it was last written.
+func (l *Lock) Renew(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.etag == "" {
+		return fmt.Errorf("lock %s is not held", l.uri)
+	}
+	expires := l.info.ExpiresAt
+	l.info.ExpiresAt = l.clock.Now().UTC().Add(l.ttl)
+	etag, err := l.put(ctx, &s3.PutObjectInput{IfMatch: awssdk.String(l.etag)})
+	if err != nil {
+		l.info.ExpiresAt = expires
+		if isConflict(err) || isNotFound(err) {
+			l.etag = ""
+			return fmt.Errorf("lock %s is no longer held by this restore: %w", l.uri, ErrLocked)
+		}
+		return fmt.Errorf("failed to renew lock %s: %w", l.uri, err)
+	}
+	l.etag = etag
+	return nil
+}
+
+// KeepAlive renews the lock three times per TTL until ctx is done or the lock
+// is released. When the lock is lost, or cannot be renewed before it would
+// expire, it calls onLost and returns, so the caller can stop writing.
+func (l *Lock) KeepAlive(ctx context.Context, onLost func(error)) {
+	ticker := l.clock.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			err := l.Renew(ctx)
+			if err == nil || ctx.Err() != nil {
+				continue
+			}
+			l.mu.Lock()
+			released := l.etag == "" && !errors.Is(err, ErrLocked) // Renew found nothing to renew
+			expired := !l.clock.Now().Before(l.info.ExpiresAt.Add(-l.ttl / 3))
+			l.mu.Unlock()
+			if released {
+				return
+			}
+			if errors.Is(err, ErrLocked) || expired {
+				onLost(err)
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Release deletes the lock object if it is still held by this restore.
+func (l *Lock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.etag == "" {
+		return nil
+	}
+	_, err := l.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:  awssdk.String(l.uri.Bucket),
+		Key:     awssdk.String(l.uri.Key),
+		IfMatch: awssdk.String(l.etag),
+	})
+	l.etag = ""
+	if err != nil && !isConflict(err) && !isNotFound(err) {
+		return fmt.Errorf("failed to release lock %s: %w", l.uri, err)
+	}
+	return nil
+}
+
+// ForceUnlock deletes the lock at uri, but only while it is held by owner, so a
+// lock is never removed from a restore other than the one the operator checked.
+// Example:
+//
+//	err := lock.ForceUnlock(ctx, s3Client, lockURI, "3f9a0c2e7b1d4e58")
+func ForceUnlock(ctx context.Context, client Client, uri, owner string) error {
+	u, err := s3uri.ParseObject(uri)
+	if err != nil {
+		return err
+	}
+	holder, etag, err := read(ctx, client, u)
+	if errors.Is(err, errNoLock) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if holder.Owner != owner {
+		return fmt.Errorf("lock %s is held by %s, not %s; not unlocking", uri, holder.Owner, owner)
+	}
+	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:  awssdk.String(u.Bucket),
+		Key:     awssdk.String(u.Key),
+		IfMatch: awssdk.String(etag),
+	})
+	if err != nil {
+		if isConflict(err) {
+			return fmt.Errorf("lock %s changed while unlocking; check its holder again", uri)
+		}
+		return fmt.Errorf("failed to delete lock %s: %w", uri, err)
+	}
+	return nil
+}
+
+// put writes the lock info with the conditions set in input and returns the new ETag.
+func (l *Lock) put(ctx context.Context, input *s3.PutObjectInput) (string, error) {
+	data, err := json.Marshal(l.info)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode lock: %w", err)
+	}
+	input.Bucket = awssdk.String(l.uri.Bucket)
+	input.Key = awssdk.String(l.uri.Key)
+	input.Body = bytes.NewReader(data)
+	input.ContentType = awssdk.String("application/json")
+	out, err := l.client.PutObject(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	return awssdk.ToString(out.ETag), nil
+}
+
+// errNoLock is returned by read when the lock object does not exist.
+var errNoLock = errors.New("no lock")
+
+// read returns the lock at u and its ETag.
+func read(ctx context.Context, client Client, u s3uri.URI) (Info, string, error) {
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: awssdk.String(u.Bucket), Key: awssdk.String(u.Key)})
+	if err != nil {
+		if isNotFound(err) {
+			return Info{}, "", errNoLock
+		}
+		return Info{}, "", fmt.Errorf("failed to read lock %s: %w", u, err)
+	}
+	defer func() { _ = out.Body.Close() }()
+	var info Info
+	if err := json.NewDecoder(out.Body).Decode(&info); err != nil {
+		return Info{}, "", fmt.Errorf("failed to decode lock %s: %w", u, err)
+	}
+	return info, awssdk.ToString(out.ETag), nil
+}
+
+// isConflict reports whether a conditional request failed because the object
+// exists, changed, or is being written concurrently.
+func isConflict(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			return true
+		}
+	}
+	return false
+}
+
+// isNotFound reports whether err means the object does not exist.
+func isNotFound(err error) bool {
+	var noSuchKey *s3types.NoSuchKey
+	var notFound *s3types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return true
+	}
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchKey"
+}
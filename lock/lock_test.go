@@ -0,0 +1,239 @@
+package lock
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/gurre/ddb-pitr/clock"
+)
+
+const lockURI = "s3://bucket/locks/orders.json"
+
+// condS3 is an in-memory bucket that honors If-None-Match and If-Match like S3
+// conditional writes.
+type condS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	etags   map[string]string
+	version int
+}
+
+func newCondS3() *condS3 {
+	return &condS3{objects: make(map[string][]byte), etags: make(map[string]string)}
+}
+
+var preconditionFailed = &smithy.GenericAPIError{Code: "PreconditionFailed", Message: "At least one of the pre-conditions you specified did not hold"}
+
+func (m *condS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[*params.Key]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data)), ETag: awssdk.String(m.etags[*params.Key])}, nil
+}
+
+func (m *condS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	etag, exists := m.etags[*params.Key]
+	if params.IfNoneMatch != nil && exists {
+		return nil, preconditionFailed
+	}
+	if params.IfMatch != nil && (!exists || *params.IfMatch != etag) {
+		return nil, preconditionFailed
+	}
+	m.version++
+	m.objects[*params.Key] = data
+	m.etags[*params.Key] = fmt.Sprintf("%q", fmt.Sprint(m.version))
+	return &s3.PutObjectOutput{ETag: awssdk.String(m.etags[*params.Key])}, nil
+}
+
+func (m *condS3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if params.IfMatch != nil && *params.IfMatch != m.etags[*params.Key] {
+		return nil, preconditionFailed
+	}
+	delete(m.objects, *params.Key)
+	delete(m.etags, *params.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (m *condS3) exists(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.objects[key]
+	return ok
+}
+
+// TestLockExcludesSecondRestore verifies that a second restore of the same
+// table is refused with an error naming the holder and the owner ID to pass to
+// -force-unlock, and that the lock can be taken again once released.
+func TestLockExcludesSecondRestore(t *testing.T) {
+	ctx := context.Background()
+	client := newCondS3()
+	first, err := New(client, lockURI, "orders", "s3://bucket/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	second, _ := New(client, lockURI, "orders", "s3://bucket/export")
+	err = second.Acquire(ctx)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Acquire error = %v, want ErrLocked", err)
+	}
+	var locked *LockedError
+	if !errors.As(err, &locked) || locked.Holder.Owner != first.Owner() {
+		t.Fatalf("holder = %+v, want owner %s", locked, first.Owner())
+	}
+	if !strings.Contains(err.Error(), "-force-unlock "+first.Owner()) {
+		t.Errorf("error %q does not suggest -force-unlock", err)
+	}
+
+	if err := first.Release(ctx); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if client.exists("locks/orders.json") {
+		t.Fatal("lock object still exists after Release")
+	}
+	if err := second.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire after release: %v", err)
+	}
+}
+
+// TestLockTakesOverExpiredLock verifies that a lock whose holder stopped
+// renewing it can be acquired once it expires, and that the old holder then
+// learns it lost the lock instead of renewing over the new one.
+func TestLockTakesOverExpiredLock(t *testing.T) {
+	ctx := context.Background()
+	client := newCondS3()
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	stale, _ := New(client, lockURI, "orders", "export", WithTTL(time.Minute), WithClock(clk))
+	if err := stale.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	fresh, _ := New(client, lockURI, "orders", "export", WithTTL(time.Minute), WithClock(clk))
+	if err := fresh.Acquire(ctx); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Acquire before expiry = %v, want ErrLocked", err)
+	}
+	clk.Advance(time.Minute)
+	if err := fresh.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire after expiry: %v", err)
+	}
+	if err := stale.Renew(ctx); !errors.Is(err, ErrLocked) {
+		t.Fatalf("stale Renew = %v, want ErrLocked", err)
+	}
+	if err := stale.Release(ctx); err != nil {
+		t.Fatalf("stale Release: %v", err)
+	}
+	if !client.exists("locks/orders.json") {
+		t.Fatal("stale Release deleted the new holder's lock")
+	}
+}
+
+// TestKeepAliveRenewsAndReportsLoss verifies that the heartbeat keeps a lock
+// from expiring, and calls onLost once the lock is removed from under it.
+func TestKeepAliveRenewsAndReportsLoss(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := newCondS3()
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	l, _ := New(client, lockURI, "orders", "export", WithTTL(30*time.Second), WithClock(clk))
+	if err := l.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	lost := make(chan error, 1)
+	go l.KeepAlive(ctx, func(err error) { lost <- err })
+	clk.BlockUntil(1)
+
+	// Several TTLs pass; each tick must extend the lock before the next one
+	for i := 0; i < 6; i++ {
+		clk.Advance(10 * time.Second)
+		waitForExpiry(t, client, l, clk.Now().Add(30*time.Second))
+	}
+	other, _ := New(client, lockURI, "orders", "export", WithClock(clk))
+	if err := other.Acquire(ctx); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Acquire while renewed = %v, want ErrLocked", err)
+	}
+
+	info, _, err := read(ctx, client, l.uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ForceUnlock(ctx, client, lockURI, info.Owner); err != nil {
+		t.Fatalf("ForceUnlock: %v", err)
+	}
+	clk.Advance(10 * time.Second)
+	select {
+	case err := <-lost:
+		if !errors.Is(err, ErrLocked) {
+			t.Errorf("onLost error = %v, want ErrLocked", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("onLost was not called after the lock was removed")
+	}
+}
+
+// waitForExpiry waits until the heartbeat has extended the lock to want.
+func waitForExpiry(t *testing.T, client *condS3, l *Lock, want time.Time) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, _, err := read(context.Background(), client, l.uri)
+		if err == nil && !info.ExpiresAt.Before(want) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("lock was not renewed to %s: %+v, %v", want, info, err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestForceUnlockChecksOwner verifies that -force-unlock only deletes a lock
+// held by the owner the operator named, so a restore that started since the
+// operator looked is not unlocked by mistake.
+func TestForceUnlockChecksOwner(t *testing.T) {
+	ctx := context.Background()
+	client := newCondS3()
+	l, _ := New(client, lockURI, "orders", "export")
+	if err := l.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := ForceUnlock(ctx, client, lockURI, "someone-else"); err == nil {
+		t.Fatal("ForceUnlock with the wrong owner succeeded")
+	}
+	if !client.exists("locks/orders.json") {
+		t.Fatal("lock deleted by the wrong owner")
+	}
+	if err := ForceUnlock(ctx, client, lockURI, l.Owner()); err != nil {
+		t.Fatalf("ForceUnlock: %v", err)
+	}
+	if client.exists("locks/orders.json") {
+		t.Fatal("lock still exists after ForceUnlock")
+	}
+	if err := ForceUnlock(ctx, client, lockURI, l.Owner()); err != nil {
+		t.Errorf("ForceUnlock of a missing lock = %v, want nil", err)
+	}
+}
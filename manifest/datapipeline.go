@@ -0,0 +1,152 @@
+package manifest
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/aws"
+	"github.com/gurre/ddb-pitr/s3uri"
+)
+
+// DataPipelineManifest is the object listing the data files of an export
+// written by the AWS Data Pipeline "Export DynamoDB table to S3" template, and
+// by Glue and EMR jobs built on the same DynamoDB connector:
+//
+//	s3://bucket/prefix/2024-05-01-12-00-00/manifest
+//	s3://bucket/prefix/2024-05-01-12-00-00/_SUCCESS
+//	s3://bucket/prefix/2024-05-01-12-00-00/5d2bf6c0-2c7e-4cb6-9a2d-0b1e0f5f2a6c
+const DataPipelineManifest = "manifest"
+
+// dataPipelineTimeLayout is the format of the directory Data Pipeline names
+// after the scheduled start of the export.
+const dataPipelineTimeLayout = "2006-01-02-15-04-05"
+
+// dataPipelineManifest is the content of a Data Pipeline manifest object, e.g.
+// {"name":"DynamoDB-export","version":3,"entries":[{"url":"s3://b/p/5d2b…","mandatory":true}]}.
+type dataPipelineManifest struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+	Entries []struct {
+		URL       string `json:"url"`
+		Mandatory bool   `json:"mandatory"`
+	} `json:"entries"`
+}
+
+// DataPipelineLoader implements the Loader interface for exports in the Data
+// Pipeline layout. Such exports are always full exports. Their manifest lists
+// neither checksums nor item counts, so VerifyChecksums has nothing to check
+// and FileMeta.ItemCount is 0.
+// Example:
+//
+//	loader := manifest.NewDataPipelineLoader(client)
+//	summary, err := loader.Load(ctx, "s3://my-bucket/exports/2024-05-01-12-00-00/")
+type DataPipelineLoader struct {
+	s3 *S3Loader // Reads the manifest object with S3Loader's retries
+}
+
+// NewDataPipelineLoader creates a DataPipelineLoader. The options are those of
+// NewS3Loader.
+// Example:
+//
+//	loader := manifest.NewDataPipelineLoader(client, manifest.WithRetries(8, time.Second))
+func NewDataPipelineLoader(client aws.S3Client, opts ...Option) *DataPipelineLoader {
+	return &DataPipelineLoader{s3: NewS3Loader(client, opts...)}
+}
+
+// Load reads the manifest at manifestS3URI, which may also be the export
+// directory holding it, and returns the summary with its data files.
+// Example:
+//
+//	summary, err := loader.Load(ctx, "s3://my-bucket/exports/2024-05-01-12-00-00/manifest")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("Found %d data files\n", len(summary.DataFiles))
+func (l *DataPipelineLoader) Load(ctx context.Context, manifestS3URI string) (Summary, error) {
+	u, err := dataPipelineManifestURI(manifestS3URI)
+	if err != nil {
+		return Summary{}, err
+	}
+	data, err := l.s3.readObject(ctx, u.Bucket, u.Key)
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to get data pipeline manifest: %w", err)
+	}
+	var m dataPipelineManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Summary{}, fmt.Errorf("failed to decode data pipeline manifest: %w", err)
+	}
+
+	summary := Summary{
+		Version:            fmt.Sprintf("data-pipeline-%d", m.Version),
+		S3Bucket:           u.Bucket,
+		S3Prefix:           u.Dir().Key,
+		ManifestFilesS3Key: u.Key,
+		OutputFormat:       OutputFormatDataPipelineJSON,
+		ExportType:         ExportTypeFull,
+		DataFiles:          make([]FileMeta, 0, len(m.Entries)),
+		bucket:             u.Bucket,
+	}
+	// The directory name is the only record of when the export ran
+	if t, err := time.Parse(dataPipelineTimeLayout, u.Dir().Name()); err == nil {
+		summary.ExportTime = t.UTC().Format(time.RFC3339)
+	}
+	for i, entry := range m.Entries {
+		file, err := s3uri.ParseObject(entry.URL)
+		if err != nil {
+			return Summary{}, fmt.Errorf("data pipeline manifest entry %d: %w", i, err)
+		}
+		// The streamer reads every data file from the export's bucket
+		if file.Bucket != u.Bucket {
+			return Summary{}, fmt.Errorf("data pipeline manifest entry %d (%s) is not in bucket %s", i, entry.URL, u.Bucket)
+		}
+		summary.DataFiles = append(summary.DataFiles, FileMeta{Key: file.Key})
+	}
+	return summary, nil
+}
+
+// LoadSummary loads the manifest like Load; it lists the data files inline,
+// so there is no separate file list to defer reading.
+func (l *DataPipelineLoader) LoadSummary(ctx context.Context, manifestS3URI string) (Summary, error) {
+	return l.Load(ctx, manifestS3URI)
+}
+
+// Files yields the data files of summary, reading the manifest again when
+// summary came without them.
+func (l *DataPipelineLoader) Files(ctx context.Context, summary Summary) iter.Seq2[FileMeta, error] {
+	return func(yield func(FileMeta, error) bool) {
+		if summary.DataFiles == nil {
+			var err error
+			uri := s3uri.URI{Bucket: summary.manifestBucket(), Key: summary.ManifestFilesS3Key}
+			if summary, err = l.Load(ctx, uri.String()); err != nil {
+				yield(FileMeta{}, err)
+				return
+			}
+		}
+		for _, file := range summary.DataFiles {
+			if !yield(file, nil) {
+				return
+			}
+		}
+	}
+}
+
+// VerifyChecksums does nothing: the Data Pipeline manifest has no checksums.
+func (l *DataPipelineLoader) VerifyChecksums(ctx context.Context, summary Summary) error {
+	return nil
+}
+
+// dataPipelineManifestURI returns the manifest object of uri, the manifest
+// itself or the export directory holding it.
+func dataPipelineManifestURI(uri string) (s3uri.URI, error) {
+	u, err := s3uri.Parse(uri)
+	if err != nil {
+		return s3uri.URI{}, err
+	}
+	if u.IsPrefix() || u.Name() != DataPipelineManifest {
+		return u.Join(DataPipelineManifest), nil
+	}
+	return u, nil
+}
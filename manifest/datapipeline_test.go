@@ -0,0 +1,84 @@
+package manifest
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+const dataPipelineManifestJSON = `{"name":"DynamoDB-export","version":3,"entries":[` +
+	`{"url":"s3://test-bucket/exports/2024-05-01-12-00-00/5d2bf6c0","mandatory":true},` +
+	`{"url":"s3://test-bucket/exports/2024-05-01-12-00-00/9a1c44e2","mandatory":true}]}`
+
+// TestDataPipelineLoader checks a Data Pipeline manifest, named directly or by
+// its directory, becomes a full export summary listing its data files, and
+// takes its export time from the directory name since the manifest has none.
+func TestDataPipelineLoader(t *testing.T) {
+	ctx := context.Background()
+	client := &mockS3Client{data: map[string][]byte{
+		"exports/2024-05-01-12-00-00/manifest": []byte(dataPipelineManifestJSON),
+	}}
+	loader := FormatDataPipeline.NewLoader(client)
+	for _, uri := range []string{
+		"s3://test-bucket/exports/2024-05-01-12-00-00/manifest",
+		"s3://test-bucket/exports/2024-05-01-12-00-00/",
+		"s3://test-bucket/exports/2024-05-01-12-00-00",
+	} {
+		summary, err := loader.Load(ctx, uri)
+		if err != nil {
+			t.Fatalf("%s: %v", uri, err)
+		}
+		if summary.OutputFormat != OutputFormatDataPipelineJSON || summary.IsIncremental() || summary.S3Bucket != "test-bucket" {
+			t.Errorf("%s: unexpected summary %+v", uri, summary)
+		}
+		if summary.ExportTime != "2024-05-01T12:00:00Z" {
+			t.Errorf("%s: expected the export time of the directory, got %q", uri, summary.ExportTime)
+		}
+		if len(summary.DataFiles) != 2 || summary.DataFiles[1].Key != "exports/2024-05-01-12-00-00/9a1c44e2" {
+			t.Errorf("%s: unexpected data files %+v", uri, summary.DataFiles)
+		}
+		if err := loader.VerifyChecksums(ctx, summary); err != nil {
+			t.Errorf("%s: %v", uri, err)
+		}
+	}
+
+	// Files reads the list again for a summary passed around without it
+	summary, _ := loader.LoadSummary(ctx, "s3://test-bucket/exports/2024-05-01-12-00-00/")
+	summary.DataFiles = nil
+	var keys []string
+	for file, err := range loader.Files(ctx, summary) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, file.Key)
+	}
+	if len(keys) != 2 {
+		t.Errorf("expected 2 files, got %v", keys)
+	}
+}
+
+// TestDataPipelineLoaderRejectsForeignFiles checks entries in another bucket
+// fail at load time, since every data file is streamed from the export's bucket.
+func TestDataPipelineLoaderRejectsForeignFiles(t *testing.T) {
+	client := &mockS3Client{data: map[string][]byte{
+		"exports/manifest": []byte(`{"name":"DynamoDB-export","version":3,"entries":[{"url":"s3://other-bucket/exports/a","mandatory":true}]}`),
+	}}
+	_, err := NewDataPipelineLoader(client).Load(context.Background(), "s3://test-bucket/exports/")
+	if err == nil || !strings.Contains(err.Error(), "other-bucket") {
+		t.Errorf("expected error naming the foreign entry, got %v", err)
+	}
+}
+
+// TestParseFormat checks the default format is DynamoDB's own and unknown
+// names are rejected.
+func TestParseFormat(t *testing.T) {
+	if f, err := ParseFormat(""); err != nil || f != FormatDynamoDB || f.OutputFormat() != OutputFormatDynamoDBJSON {
+		t.Errorf("expected the dynamodb format by default, got %q, %v", f, err)
+	}
+	if f, err := ParseFormat("data-pipeline"); err != nil || f.OutputFormat() != OutputFormatDataPipelineJSON {
+		t.Errorf("expected the data-pipeline format, got %q, %v", f, err)
+	}
+	if _, err := ParseFormat("glue"); err == nil {
+		t.Error("expected error for an unknown format")
+	}
+}
@@ -0,0 +1,54 @@
+package manifest
+
+import (
+	"fmt"
+
+	"github.com/gurre/ddb-pitr/aws"
+)
+
+// Format is a layout of exports in S3: where the manifest is, how it lists the
+// data files and how their records are encoded.
+type Format string
+
+const (
+	FormatDynamoDB     Format = "dynamodb"      // ExportTableToPointInTime exports under AWSDynamoDB/
+	FormatDataPipeline Format = "data-pipeline" // Data Pipeline exports listed by a manifest object
+)
+
+// ParseFormat returns the format named name; an empty name is FormatDynamoDB.
+// Example:
+//
+//	format, err := manifest.ParseFormat("data-pipeline")
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case "", FormatDynamoDB:
+		return FormatDynamoDB, nil
+	case FormatDataPipeline:
+		return FormatDataPipeline, nil
+	default:
+		return "", fmt.Errorf("export format must be %s or %s", FormatDynamoDB, FormatDataPipeline)
+	}
+}
+
+// NewLoader returns the Loader of exports in the format. The options are those
+// of NewS3Loader.
+// Example:
+//
+//	loader := manifest.FormatDataPipeline.NewLoader(client)
+func (f Format) NewLoader(client aws.S3Client, opts ...Option) Loader {
+	if f == FormatDataPipeline {
+		return NewDataPipelineLoader(client, opts...)
+	}
+	return NewS3Loader(client, opts...)
+}
+
+// OutputFormat returns the Summary.OutputFormat of the format's data files.
+// Example:
+//
+//	decoder, err := itemimage.NewDecoder(format.OutputFormat())
+func (f Format) OutputFormat() string {
+	if f == FormatDataPipeline {
+		return OutputFormatDataPipelineJSON
+	}
+	return OutputFormatDynamoDBJSON
+}
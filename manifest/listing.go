@@ -0,0 +1,166 @@
+package manifest
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"path"
+	"strings"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gurre/ddb-pitr/s3uri"
+)
+
+// Listing describes exports read without a manifest: what the manifest would
+// have said about them, since their data files do not record it.
+type Listing struct {
+	ExportType   string // ExportTypeFull or ExportTypeIncremental
+	OutputView   string // NEW_IMAGE or NEW_AND_OLD_IMAGES for incremental exports
+	OutputFormat string // OutputFormatDynamoDBJSON or OutputFormatDataPipelineJSON
+}
+
+// ListingLoader implements the Loader interface for data files without a
+// manifest, such as exports split or renamed by downstream ETL. The URI passed
+// to Load is a comma-separated list of objects, prefixes and globs in one
+// bucket:
+//
+//	s3://bucket/etl/part-00000.json.gz,s3://bucket/etl/part-00001.json.gz
+//	s3://bucket/etl/2024-05-01/
+//	s3://bucket/etl/2024-05-01/part-*.json.gz
+//
+// A prefix matches every object below it, and a glob every object matching it
+// with path.Match, so "*" does not cross "/". Both skip empty objects and
+// objects whose name starts with "_" or ".", such as _SUCCESS markers and
+// checksum sidecars. Objects named explicitly are read as they are.
+// Example:
+//
+//	loader := manifest.NewListingLoader(s3Client, manifest.Listing{ExportType: manifest.ExportTypeFull, OutputFormat: manifest.OutputFormatDynamoDBJSON})
+//	summary, err := loader.Load(ctx, "s3://my-bucket/etl/2024-05-01/part-*.json.gz")
+type ListingLoader struct {
+	client  ObjectFinder
+	listing Listing
+}
+
+// NewListingLoader creates a ListingLoader describing the files it lists with
+// listing.
+// Example:
+//
+//	loader := manifest.NewListingLoader(s3Client, manifest.Listing{ExportType: manifest.ExportTypeIncremental, OutputView: "NEW_IMAGE", OutputFormat: manifest.OutputFormatDynamoDBJSON})
+func NewListingLoader(client ObjectFinder, listing Listing) *ListingLoader {
+	return &ListingLoader{client: client, listing: listing}
+}
+
+// Load lists the data files uri names and returns a summary of them with the
+// loader's Listing. It fails when nothing matches.
+// Example:
+//
+//	summary, err := loader.Load(ctx, "s3://my-bucket/etl/2024-05-01/")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("Found %d data files\n", len(summary.DataFiles))
+func (l *ListingLoader) Load(ctx context.Context, uri string) (Summary, error) {
+	var bucket string
+	var keys []string
+	for _, part := range strings.Split(uri, ",") {
+		u, err := s3uri.Parse(strings.TrimSpace(part))
+		if err != nil {
+			return Summary{}, err
+		}
+		if bucket != "" && u.Bucket != bucket {
+			return Summary{}, fmt.Errorf("data files must be in one bucket, got %s and %s", bucket, u.Bucket)
+		}
+		bucket = u.Bucket
+		matched, err := l.list(ctx, u)
+		if err != nil {
+			return Summary{}, err
+		}
+		if len(matched) == 0 {
+			return Summary{}, fmt.Errorf("no data files match %s", u)
+		}
+		keys = append(keys, matched...)
+	}
+
+	summary := Summary{
+		S3Bucket:     bucket,
+		OutputFormat: l.listing.OutputFormat,
+		OutputView:   l.listing.OutputView,
+		ExportType:   l.listing.ExportType,
+		DataFiles:    make([]FileMeta, 0, len(keys)),
+		bucket:       bucket,
+	}
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			summary.DataFiles = append(summary.DataFiles, FileMeta{Key: key})
+		}
+	}
+	return summary, nil
+}
+
+// list returns the keys of the data files u names, in the order S3 lists them.
+func (l *ListingLoader) list(ctx context.Context, u s3uri.URI) ([]string, error) {
+	wildcard := strings.IndexAny(u.Key, "*?[")
+	if wildcard < 0 && !u.IsPrefix() {
+		return []string{u.Key}, nil
+	}
+	if wildcard >= 0 {
+		if _, err := path.Match(u.Key, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %s: %w", u, err)
+		}
+	}
+	prefix := u.Key
+	if wildcard >= 0 {
+		prefix = u.Key[:wildcard]
+	}
+
+	var keys []string
+	input := &s3.ListObjectsV2Input{Bucket: &u.Bucket, Prefix: &prefix}
+	for {
+		out, err := l.client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", u, err)
+		}
+		for _, obj := range out.Contents {
+			key := awssdk.ToString(obj.Key)
+			name := key[strings.LastIndex(key, "/")+1:]
+			if name == "" || strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") || awssdk.ToInt64(obj.Size) == 0 {
+				continue
+			}
+			if wildcard >= 0 {
+				if ok, _ := path.Match(u.Key, key); !ok {
+					continue
+				}
+			}
+			keys = append(keys, key)
+		}
+		if !awssdk.ToBool(out.IsTruncated) || out.NextContinuationToken == nil {
+			return keys, nil
+		}
+		input.ContinuationToken = out.NextContinuationToken
+	}
+}
+
+// LoadSummary lists the data files like Load; the listing is the file list,
+// so there is nothing to defer reading.
+func (l *ListingLoader) LoadSummary(ctx context.Context, uri string) (Summary, error) {
+	return l.Load(ctx, uri)
+}
+
+// Files yields the data files listed by Load.
+func (l *ListingLoader) Files(ctx context.Context, summary Summary) iter.Seq2[FileMeta, error] {
+	return func(yield func(FileMeta, error) bool) {
+		for _, file := range summary.DataFiles {
+			if !yield(file, nil) {
+				return
+			}
+		}
+	}
+}
+
+// VerifyChecksums does nothing: without a manifest there are no checksums.
+func (l *ListingLoader) VerifyChecksums(ctx context.Context, summary Summary) error {
+	return nil
+}
@@ -0,0 +1,90 @@
+package manifest
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// listingS3Client lists its objects one per page, so ListingLoader must follow
+// continuation tokens to see them all.
+type listingS3Client struct {
+	sizes map[string]int64 // Object sizes by key
+}
+
+func (m *listingS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return nil, &types.NotFound{}
+}
+
+func (m *listingS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	var keys []string
+	for key := range m.sizes {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) && key > aws.ToString(params.ContinuationToken) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	if len(keys) == 0 {
+		return &s3.ListObjectsV2Output{}, nil
+	}
+	return &s3.ListObjectsV2Output{
+		Contents:              []types.Object{{Key: aws.String(keys[0]), Size: aws.Int64(m.sizes[keys[0]])}},
+		IsTruncated:           aws.Bool(len(keys) > 1),
+		NextContinuationToken: aws.String(keys[0]),
+	}, nil
+}
+
+// TestListingLoader checks prefixes and globs match the data files ETL wrote
+// while skipping markers and empty objects, explicit objects are taken as
+// named, and the summary describes them with the configured export type.
+func TestListingLoader(t *testing.T) {
+	client := &listingS3Client{sizes: map[string]int64{
+		"etl/day1/part-0.json.gz":      10,
+		"etl/day1/part-1.json.gz":      10,
+		"etl/day1/part-2.json":         10,
+		"etl/day1/_SUCCESS":            0,
+		"etl/day1/.part-0.json.gz.crc": 8,
+		"etl/day1/empty.json.gz":       0,
+		"etl/day1/sub/part-9.json.gz":  10,
+		"etl/day2/part-0.json.gz":      10,
+	}}
+	loader := NewListingLoader(client, Listing{ExportType: ExportTypeIncremental, OutputView: "NEW_IMAGE", OutputFormat: OutputFormatDynamoDBJSON})
+	cases := map[string][]string{
+		"s3://etl-bucket/etl/day1/part-*.json.gz": {"etl/day1/part-0.json.gz", "etl/day1/part-1.json.gz"},
+		"s3://etl-bucket/etl/day1/":               {"etl/day1/part-0.json.gz", "etl/day1/part-1.json.gz", "etl/day1/part-2.json", "etl/day1/sub/part-9.json.gz"},
+		"s3://etl-bucket/etl/*/part-0.json.gz":    {"etl/day1/part-0.json.gz", "etl/day2/part-0.json.gz"},
+		"s3://etl-bucket/etl/day2/part-0.json.gz, s3://etl-bucket/etl/day1/part-?.json.gz": {
+			"etl/day2/part-0.json.gz", "etl/day1/part-0.json.gz", "etl/day1/part-1.json.gz"},
+	}
+	for uri, want := range cases {
+		summary, err := loader.Load(context.Background(), uri)
+		if err != nil {
+			t.Errorf("%s: %v", uri, err)
+			continue
+		}
+		var got []string
+		for file, err := range loader.Files(context.Background(), summary) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, file.Key)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: got %v, want %v", uri, got, want)
+		}
+		if !summary.IsIncremental() || summary.OutputView != "NEW_IMAGE" || summary.S3Bucket != "etl-bucket" {
+			t.Errorf("%s: unexpected summary %+v", uri, summary)
+		}
+	}
+
+	for _, uri := range []string{"s3://etl-bucket/etl/day3/", "s3://etl-bucket/etl/day1/*.csv", "s3://etl-bucket/etl/[", "s3://etl-bucket/etl/day1/part-0.json.gz,s3://other-bucket/x"} {
+		if _, err := loader.Load(context.Background(), uri); err == nil {
+			t.Errorf("%s: expected error", uri)
+		}
+	}
+}
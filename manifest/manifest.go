@@ -6,19 +6,19 @@ package manifest
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"io"
-	"regexp"
+	"iter"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	json "github.com/goccy/go-json"
 	"github.com/gurre/ddb-pitr/aws"
+	"github.com/gurre/ddb-pitr/clock"
+	"github.com/gurre/ddb-pitr/s3uri"
 )
 
-// s3URIPattern is compiled once at package level to avoid recompilation per call.
-var s3URIPattern = regexp.MustCompile(`^s3://([^/]+)/(.+)$`)
-
 // Summary contains the export metadata as defined in section 4.3 of the spec.
 // Example:
 //
@@ -52,6 +52,33 @@ type Summary struct {
 
 	// Parsed from manifest-files.json
 	DataFiles []FileMeta // List of data files in the export
+
+	// Forward-compatibility warnings, e.g. fields this version does not know about
+	Warnings []string `json:"-"`
+
+	// Bucket the summary was read from, which holds the manifest files even when
+	// the export was copied away from S3Bucket
+	bucket string
+}
+
+// manifestBucket returns the bucket holding the summary's manifest files.
+func (s Summary) manifestBucket() string {
+	if s.bucket != "" {
+		return s.bucket
+	}
+	return s.S3Bucket
+}
+
+// PointInTime returns the time the export's data reflects: ExportToTime for
+// incremental exports and ExportTime for full exports.
+// Example:
+//
+//	fmt.Printf("Export reflects the table at %s\n", summary.PointInTime())
+func (s Summary) PointInTime() string {
+	if s.ExportToTime != "" {
+		return s.ExportToTime
+	}
+	return s.ExportTime
 }
 
 // FileMeta contains metadata for a single data file as defined in section 4.3.
@@ -67,7 +94,52 @@ type FileMeta struct {
 	ItemCount int64  `json:"itemCount"`     // Number of items in this file
 }
 
+// legacyFileMeta accepts both current and historical manifest-files.json field
+// names. Older exports used "key"/"s3Key" for the data file and "md5"/"eTag"
+// for the checksums.
+type legacyFileMeta struct {
+	DataFileS3Key string `json:"dataFileS3Key"`
+	Key           string `json:"key"`
+	S3Key         string `json:"s3Key"`
+	ETag          string `json:"etag"`
+	LegacyETag    string `json:"eTag"`
+	MD5Checksum   string `json:"md5Checksum"`
+	MD5           string `json:"md5"`
+	ItemCount     int64  `json:"itemCount"`
+}
+
+// legacyFileFields lists the historical field names understood by UnmarshalJSON.
+var legacyFileFields = []string{"key", "s3Key", "eTag", "md5"}
+
+// UnmarshalJSON decodes a manifest-files.json entry, preferring current field
+// names and falling back to legacy ones so old exports remain restorable.
+func (f *FileMeta) UnmarshalJSON(data []byte) error {
+	var raw legacyFileMeta
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*f = FileMeta{
+		Key:       firstNonEmpty(raw.DataFileS3Key, raw.Key, raw.S3Key),
+		ETag:      firstNonEmpty(raw.ETag, raw.LegacyETag),
+		MD5Base64: firstNonEmpty(raw.MD5Checksum, raw.MD5),
+		ItemCount: raw.ItemCount,
+	}
+	return nil
+}
+
+// firstNonEmpty returns the first non-empty value.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
 // Loader interface defines the contract for loading and verifying manifest files.
+// Load reads the summary and the full file list; LoadSummary and Files read them
+// separately, so the list can be consumed while it is read.
 // Example:
 //
 //	var loader manifest.Loader
@@ -78,6 +150,8 @@ type FileMeta struct {
 //	err = loader.VerifyChecksums(ctx, summary)
 type Loader interface {
 	Load(ctx context.Context, manifestS3URI string) (Summary, error)
+	LoadSummary(ctx context.Context, manifestS3URI string) (Summary, error)
+	Files(ctx context.Context, summary Summary) iter.Seq2[FileMeta, error]
 	VerifyChecksums(ctx context.Context, summary Summary) error
 }
 
@@ -88,7 +162,38 @@ type Loader interface {
 //	loader := manifest.NewS3Loader(client)
 //	summary, err := loader.Load(ctx, "s3://my-bucket/AWSDynamoDB/123456789012-cc964122/manifest-summary.json")
 type S3Loader struct {
-	client aws.S3Client
+	client   aws.S3Client
+	attempts int           // Attempts per manifest object before giving up
+	backoff  time.Duration // Delay before the first retry, doubled per retry
+	clock    clock.Clock   // Time source for retry backoff
+}
+
+// Option configures optional S3Loader behavior.
+type Option func(*S3Loader)
+
+// WithRetries sets how many times a manifest object is requested before Load
+// fails, and the delay before the first retry, doubled per retry. Reading
+// manifest-files.json resumes after the last decoded entry, and every retry
+// that gets further starts the count again.
+// Example:
+//
+//	loader := manifest.NewS3Loader(client, manifest.WithRetries(8, time.Second))
+func WithRetries(attempts int, backoff time.Duration) Option {
+	return func(l *S3Loader) {
+		if attempts > 0 {
+			l.attempts = attempts
+		}
+		if backoff >= 0 {
+			l.backoff = backoff
+		}
+	}
+}
+
+// WithClock sets the time source for retry backoff.
+func WithClock(c clock.Clock) Option {
+	return func(l *S3Loader) {
+		l.clock = c
+	}
 }
 
 // NewS3Loader creates a new S3Loader instance.
@@ -96,8 +201,17 @@ type S3Loader struct {
 //
 //	client := s3.NewFromConfig(cfg)
 //	loader := manifest.NewS3Loader(client)
-func NewS3Loader(client aws.S3Client) *S3Loader {
-	return &S3Loader{client: client}
+func NewS3Loader(client aws.S3Client, opts ...Option) *S3Loader {
+	l := &S3Loader{
+		client:   client,
+		attempts: defaultAttempts,
+		backoff:  defaultBackoff,
+		clock:    clock.Real,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
 }
 
 // Load implements the manifest loading requirements from section 4.3.
@@ -110,68 +224,109 @@ func NewS3Loader(client aws.S3Client) *S3Loader {
 //	}
 //	fmt.Printf("Found %d data files\n", len(summary.DataFiles))
 func (l *S3Loader) Load(ctx context.Context, manifestS3URI string) (Summary, error) {
-	var summary Summary
+	summary, err := l.LoadSummary(ctx, manifestS3URI)
+	if err != nil {
+		return Summary{}, err
+	}
 
-	// Extract bucket from the manifestS3URI using regex
-	bucket, err := extractBucketFromS3URI(manifestS3URI)
+	// Load manifest-files.json, one entry at a time so memory does not grow
+	// with the size of the file beyond the parsed list
+	summary.DataFiles = make([]FileMeta, 0, 64)
+	unknownFileFields := make(map[string]bool)
+	err = l.readFiles(ctx, summary.manifestBucket(), summary.ManifestFilesS3Key, func(file FileMeta, unknown []string) error {
+		for _, name := range unknown {
+			unknownFileFields[name] = true
+		}
+		summary.DataFiles = append(summary.DataFiles, file)
+		return nil
+	})
 	if err != nil {
 		return Summary{}, err
 	}
+	if len(unknownFileFields) > 0 {
+		summary.Warnings = append(summary.Warnings,
+			fmt.Sprintf("manifest files have unknown fields %v; they are ignored", sortedKeys(unknownFileFields)))
+	}
+
+	if err := summary.ValidateFiles(); err != nil {
+		return Summary{}, fmt.Errorf("invalid manifest files: %w", err)
+	}
+
+	return summary, nil
+}
+
+// LoadSummary reads and validates manifest-summary.json without reading the
+// file list; DataFiles is left empty. Use Files to stream the list.
+// Example:
+//
+//	summary, err := loader.LoadSummary(ctx, "s3://my-bucket/AWSDynamoDB/123456789012-cc964122/manifest-summary.json")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("Export of %s at %s\n", summary.TableARN, summary.PointInTime())
+func (l *S3Loader) LoadSummary(ctx context.Context, manifestS3URI string) (Summary, error) {
+	var summary Summary
 
-	// Extract the S3 key from the URI
-	s3Key, err := extractKeyFromS3URI(manifestS3URI)
+	u, err := s3uri.ParseObject(manifestS3URI)
 	if err != nil {
 		return Summary{}, err
 	}
 
-	// Load manifest-summary.json
-	resp, err := l.client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: &bucket,
-		Key:    &s3Key,
-	})
+	summaryData, err := l.readObject(ctx, u.Bucket, u.Key)
 	if err != nil {
 		return Summary{}, fmt.Errorf("failed to get manifest summary: %w", err)
 	}
-	if resp.Body == nil {
-		return Summary{}, fmt.Errorf("manifest summary response body is nil")
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+	if err := json.Unmarshal(summaryData, &summary); err != nil {
 		return Summary{}, fmt.Errorf("failed to decode manifest summary: %w", err)
 	}
-
-	// Load manifest-files.json
-	filesResp, err := l.client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: &bucket,
-		Key:    &summary.ManifestFilesS3Key,
-	})
-	if err != nil {
-		return Summary{}, fmt.Errorf("failed to get manifest files: %w", err)
+	if unknown, err := unknownFields(summaryData, knownSummaryFields); err == nil && len(unknown) > 0 {
+		summary.Warnings = append(summary.Warnings,
+			fmt.Sprintf("manifest summary has unknown fields %v; they are ignored", unknown))
 	}
-	if filesResp.Body == nil {
-		return Summary{}, fmt.Errorf("manifest files response body is nil")
+
+	// Fail on unsupported exports before touching any data file
+	if err := summary.Validate(); err != nil {
+		return Summary{}, fmt.Errorf("invalid manifest summary: %w", err)
 	}
-	defer func() { _ = filesResp.Body.Close() }()
+	summary.bucket = u.Bucket
+	return summary, nil
+}
 
-	// The manifest-files.json format has changed to use dataFileS3Key instead of Key.
-	// Preallocate slice with estimated capacity based on typical export patterns.
-	// Most exports have dozens to hundreds of files, so 64 is a reasonable default.
-	decoder := json.NewDecoder(filesResp.Body)
-	summary.DataFiles = make([]FileMeta, 0, 64)
-	for {
-		var file FileMeta
-		if err := decoder.Decode(&file); err == io.EOF {
-			break
-		} else if err != nil {
-			return Summary{}, fmt.Errorf("failed to decode manifest file entry: %w", err)
+// Files streams the data files listed in the summary's manifest-files.json as
+// they are parsed, so memory stays bounded however many files an export has.
+// Each entry is validated before it is yielded. On failure a single error is
+// yielded with a zero FileMeta and iteration ends. Unlike Load, Files does not
+// warn about unknown fields in the entries.
+// Example:
+//
+//	for file, err := range loader.Files(ctx, summary) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    fmt.Printf("File: %s, Items: %d\n", file.Key, file.ItemCount)
+//	}
+func (l *S3Loader) Files(ctx context.Context, summary Summary) iter.Seq2[FileMeta, error] {
+	return func(yield func(FileMeta, error) bool) {
+		i := 0
+		err := l.readFiles(ctx, summary.manifestBucket(), summary.ManifestFilesS3Key, func(file FileMeta, _ []string) error {
+			if err := file.validate(i); err != nil {
+				return fmt.Errorf("invalid manifest files: %w", err)
+			}
+			i++
+			if !yield(file, nil) {
+				return errStopped
+			}
+			return nil
+		})
+		if err != nil && err != errStopped {
+			yield(FileMeta{}, err)
 		}
-		summary.DataFiles = append(summary.DataFiles, file)
 	}
-
-	return summary, nil
 }
 
+// errStopped ends reading when the consumer of Files stops iterating.
+var errStopped = errors.New("iteration stopped")
+
 // VerifyChecksums implements the checksum verification requirements from section 4.3.
 // Example:
 //
@@ -229,29 +384,3 @@ func (l *S3Loader) VerifyChecksums(ctx context.Context, summary Summary) error {
 
 	return nil
 }
-
-// extractBucketFromS3URI extracts the bucket name from an S3 URI.
-// Uses package-level compiled regex for efficiency.
-func extractBucketFromS3URI(uri string) (string, error) {
-	matches := s3URIPattern.FindStringSubmatch(uri)
-
-	if len(matches) != 3 {
-		return "", fmt.Errorf("invalid S3 URI format: %s (must be s3://bucket/key)", uri)
-	}
-
-	// matches[0] is the full match, matches[1] is the bucket
-	return matches[1], nil
-}
-
-// extractKeyFromS3URI extracts the key from an S3 URI.
-// Uses package-level compiled regex for efficiency.
-func extractKeyFromS3URI(uri string) (string, error) {
-	matches := s3URIPattern.FindStringSubmatch(uri)
-
-	if len(matches) != 3 {
-		return "", fmt.Errorf("invalid S3 URI format: %s (must be s3://bucket/key)", uri)
-	}
-
-	// matches[0] is the full match, matches[2] is the key
-	return matches[2], nil
-}
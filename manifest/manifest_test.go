@@ -1,15 +1,21 @@
 package manifest
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
 // mockS3Client implements the aws.S3Client interface for testing
@@ -62,6 +68,24 @@ func (m *mockS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInpu
 	}, nil
 }
 
+// ListObjectsV2 lists the directories directly below Prefix, as S3 does with a "/" delimiter.
+func (m *mockS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	prefix := aws.ToString(params.Prefix)
+	seen := make(map[string]bool)
+	out := &s3.ListObjectsV2Output{}
+	for key := range m.data {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		if dir, _, ok := strings.Cut(rest, "/"); ok && !seen[dir] {
+			seen[dir] = true
+			out.CommonPrefixes = append(out.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(prefix + dir + "/")})
+		}
+	}
+	return out, nil
+}
+
 // mockReadCloser implements io.ReadCloser for testing
 type mockReadCloser struct {
 	data   []byte
@@ -212,3 +236,317 @@ func TestInvalidS3URI(t *testing.T) {
 		}
 	}
 }
+
+// loadFromStrings runs Load against an in-memory summary and files manifest.
+func loadFromStrings(t *testing.T, summaryJSON, filesJSON string) (Summary, error) {
+	t.Helper()
+	client := &mockS3Client{data: map[string][]byte{
+		"export/manifest-summary.json": []byte(summaryJSON),
+		"export/manifest-files.json":   []byte(filesJSON),
+	}}
+	return NewS3Loader(client).Load(context.Background(), "s3://test-bucket/export/manifest-summary.json")
+}
+
+const validFilesJSON = `{"itemCount":1,"md5Checksum":"y+zg5fVeudb3R3DOQ+RKgA==","etag":"x","dataFileS3Key":"export/data/a.json.gz"}`
+
+// TestManifestRejectsUnsupportedExports checks that exports this tool cannot
+// restore fail at load time with a message naming the offending field, instead
+// of failing later inside the stream.
+func TestManifestRejectsUnsupportedExports(t *testing.T) {
+	cases := map[string]string{
+		"unsupported manifest version": `{"version":"2099-01-01","outputFormat":"DYNAMODB_JSON","s3Bucket":"b","manifestFilesS3Key":"export/manifest-files.json","exportTime":"t"}`,
+		"ION":                          `{"version":"2020-06-30","outputFormat":"ION","s3Bucket":"b","manifestFilesS3Key":"export/manifest-files.json","exportTime":"t"}`,
+		"exportFromTime":               `{"version":"2023-08-01","exportType":"INCREMENTAL_EXPORT","outputFormat":"DYNAMODB_JSON","outputView":"NEW_AND_OLD_IMAGES","s3Bucket":"b","manifestFilesS3Key":"export/manifest-files.json","exportToTime":"t"}`,
+		"exportTime":                   `{"version":"2020-06-30","outputFormat":"DYNAMODB_JSON","s3Bucket":"b","manifestFilesS3Key":"export/manifest-files.json"}`,
+		"manifestFilesS3Key":           `{"version":"2020-06-30","outputFormat":"DYNAMODB_JSON","s3Bucket":"b","exportTime":"t"}`,
+	}
+	for want, summaryJSON := range cases {
+		_, err := loadFromStrings(t, summaryJSON, validFilesJSON)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error mentioning %q, got %v", want, err)
+		}
+	}
+}
+
+// TestManifestRejectsIncompleteFileEntries ensures data file entries without a key
+// or checksum are rejected up front.
+func TestManifestRejectsIncompleteFileEntries(t *testing.T) {
+	summaryJSON := `{"version":"2020-06-30","outputFormat":"DYNAMODB_JSON","s3Bucket":"b","manifestFilesS3Key":"export/manifest-files.json","exportTime":"t"}`
+	for _, filesJSON := range []string{
+		`{"itemCount":1,"md5Checksum":"y+zg5fVeudb3R3DOQ+RKgA=="}`,
+		`{"itemCount":1,"dataFileS3Key":"export/data/a.json.gz"}`,
+		`{"itemCount":1,"md5Checksum":"not base64!","dataFileS3Key":"export/data/a.json.gz"}`,
+	} {
+		if _, err := loadFromStrings(t, summaryJSON, filesJSON); err == nil {
+			t.Errorf("expected error for %s", filesJSON)
+		}
+	}
+}
+
+// TestManifestWarnsOnUnknownFields verifies that fields added by newer export
+// versions are tolerated but surfaced as warnings.
+func TestManifestWarnsOnUnknownFields(t *testing.T) {
+	summaryJSON := `{"version":"2020-06-30","outputFormat":"DYNAMODB_JSON","s3Bucket":"b","manifestFilesS3Key":"export/manifest-files.json","exportTime":"t","newField":1}`
+	filesJSON := `{"itemCount":1,"md5Checksum":"y+zg5fVeudb3R3DOQ+RKgA==","dataFileS3Key":"export/data/a.json.gz","sizeBytes":10}`
+
+	summary, err := loadFromStrings(t, summaryJSON, filesJSON)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(summary.Warnings) != 2 ||
+		!strings.Contains(summary.Warnings[0], "newField") ||
+		!strings.Contains(summary.Warnings[1], "sizeBytes") {
+		t.Errorf("unexpected warnings: %v", summary.Warnings)
+	}
+}
+
+// TestFixtureManifestsHaveNoWarnings guards against the known-field lists drifting
+// from real export manifests.
+func TestFixtureManifestsHaveNoWarnings(t *testing.T) {
+	for _, dir := range []string{"01768385930622-efd1a093", "01768386924000-d339e52d", "01768388186000-4a2fc3ff"} {
+		prefix := "AWSDynamoDB/" + dir + "/"
+		client := &mockS3Client{data: map[string][]byte{
+			prefix + "manifest-summary.json": loadTestFile(t, "../s3exportdata/"+prefix+"manifest-summary.json"),
+			prefix + "manifest-files.json":   loadTestFile(t, "../s3exportdata/"+prefix+"manifest-files.json"),
+		}}
+		summary, err := NewS3Loader(client).Load(context.Background(), "s3://test-bucket/"+prefix+"manifest-summary.json")
+		if err != nil {
+			t.Fatalf("%s: Load failed: %v", dir, err)
+		}
+		if len(summary.Warnings) > 0 {
+			t.Errorf("%s: unexpected warnings %v", dir, summary.Warnings)
+		}
+	}
+}
+
+// TestManifestFilesFormats loads the same files manifest written with current and
+// legacy field names and expects identical results without warnings.
+func TestManifestFilesFormats(t *testing.T) {
+	summaryJSON := `{"version":"2020-06-30","outputFormat":"DYNAMODB_JSON","s3Bucket":"b","manifestFilesS3Key":"export/manifest-files.json","exportTime":"t"}`
+
+	var loaded [][]FileMeta
+	for _, name := range []string{"manifest-files-current.json", "manifest-files-legacy.json"} {
+		summary, err := loadFromStrings(t, summaryJSON, string(loadTestFile(t, "testdata/"+name)))
+		if err != nil {
+			t.Fatalf("%s: Load failed: %v", name, err)
+		}
+		if len(summary.Warnings) > 0 {
+			t.Errorf("%s: unexpected warnings %v", name, summary.Warnings)
+		}
+		loaded = append(loaded, summary.DataFiles)
+	}
+
+	current, legacy := loaded[0], loaded[1]
+	if len(current) != 2 || len(legacy) != len(current) {
+		t.Fatalf("expected 2 files in both formats, got %d and %d", len(current), len(legacy))
+	}
+	for i := range current {
+		if current[i] != legacy[i] {
+			t.Errorf("file %d differs: current %+v, legacy %+v", i, current[i], legacy[i])
+		}
+	}
+}
+
+// flakyS3Client serves objects from mockS3Client, honoring Range, after failing
+// the first requests and cutting bodies short.
+type flakyS3Client struct {
+	*mockS3Client
+	failRequests int            // GetObject calls to fail before serving any
+	failErr      error          // Error returned by the failed calls
+	cutAfter     map[string]int // Bytes served per body before a read fails
+	calls        int
+	ranges       []string
+}
+
+func (m *flakyS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	m.calls++
+	if m.failRequests > 0 {
+		m.failRequests--
+		return nil, m.failErr
+	}
+	data, ok := m.data[*params.Key]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	if r := aws.ToString(params.Range); r != "" {
+		m.ranges = append(m.ranges, r)
+		var start int
+		if _, err := fmt.Sscanf(r, "bytes=%d-", &start); err != nil {
+			return nil, err
+		}
+		data = data[start:]
+	}
+	var body io.Reader = bytes.NewReader(data)
+	if n, ok := m.cutAfter[*params.Key]; ok {
+		delete(m.cutAfter, *params.Key)
+		body = io.MultiReader(bytes.NewReader(data[:n]), iotest.ErrReader(errors.New("connection reset by peer")))
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(body)}, nil
+}
+
+// TestLoaderRetriesTransientErrors verifies that a failed request and a body
+// cut off mid-way do not fail the load: the manifest files are requested again
+// from the first entry not yet decoded, and every entry is loaded once.
+func TestLoaderRetriesTransientErrors(t *testing.T) {
+	summaryJSON := `{"version":"2020-06-30","outputFormat":"DYNAMODB_JSON","s3Bucket":"b","manifestFilesS3Key":"export/manifest-files.json","exportTime":"t"}`
+	var lines []string
+	for i := 0; i < 100; i++ {
+		lines = append(lines, fmt.Sprintf(`{"itemCount":1,"md5Checksum":"y+zg5fVeudb3R3DOQ+RKgA==","etag":"x","dataFileS3Key":"export/data/%03d.json.gz"}`, i))
+	}
+	filesJSON := strings.Join(lines, "\n") + "\n"
+	lineLen := len(lines[0]) + 1
+
+	client := &flakyS3Client{
+		mockS3Client: &mockS3Client{data: map[string][]byte{
+			"export/manifest-summary.json": []byte(summaryJSON),
+			"export/manifest-files.json":   []byte(filesJSON),
+		}},
+		failRequests: 2,
+		failErr:      &smithy.GenericAPIError{Code: "InternalError", Message: "We encountered an internal error"},
+		cutAfter:     map[string]int{"export/manifest-files.json": 40*lineLen + 10},
+	}
+	loader := NewS3Loader(client, WithRetries(3, 0))
+	summary, err := loader.Load(context.Background(), "s3://test-bucket/export/manifest-summary.json")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(summary.DataFiles) != 100 {
+		t.Fatalf("loaded %d files, want 100", len(summary.DataFiles))
+	}
+	for i, f := range summary.DataFiles {
+		if want := fmt.Sprintf("export/data/%03d.json.gz", i); f.Key != want {
+			t.Fatalf("file %d = %s, want %s", i, f.Key, want)
+		}
+	}
+	if want := []string{fmt.Sprintf("bytes=%d-", 40*lineLen)}; !slices.Equal(client.ranges, want) {
+		t.Errorf("ranges = %v, want %v", client.ranges, want)
+	}
+}
+
+// TestLoaderDoesNotRetryPermanentErrors verifies that errors retrying cannot
+// fix, such as a denied request, fail the load at once.
+func TestLoaderDoesNotRetryPermanentErrors(t *testing.T) {
+	client := &flakyS3Client{
+		mockS3Client: &mockS3Client{},
+		failRequests: 5,
+		failErr:      &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"},
+	}
+	_, err := NewS3Loader(client, WithRetries(5, 0)).Load(context.Background(), "s3://test-bucket/export/manifest-summary.json")
+	if err == nil {
+		t.Fatal("expected error for a denied request")
+	}
+	if client.calls != 1 {
+		t.Errorf("GetObject called %d times, want 1", client.calls)
+	}
+
+	client = &flakyS3Client{
+		mockS3Client: &mockS3Client{},
+		failRequests: 5,
+		failErr:      &smithy.GenericAPIError{Code: "SlowDown", Message: "Please reduce your request rate"},
+	}
+	_, err = NewS3Loader(client, WithRetries(3, 0)).Load(context.Background(), "s3://test-bucket/export/manifest-summary.json")
+	if err == nil {
+		t.Fatal("expected error after exhausting retries")
+	}
+	if client.calls != 3 {
+		t.Errorf("GetObject called %d times, want 3", client.calls)
+	}
+}
+
+// pipeS3Client serves the summary from mockS3Client and the manifest files from
+// a pipe the test writes to.
+type pipeS3Client struct {
+	*mockS3Client
+	files *io.PipeReader
+}
+
+func (m *pipeS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if *params.Key == "export/manifest-files.json" {
+		return &s3.GetObjectOutput{Body: m.files}, nil
+	}
+	return m.mockS3Client.GetObject(ctx, params, optFns...)
+}
+
+// TestFilesStreamsEntries verifies that Files yields each entry as soon as its
+// line is read, before the rest of manifest-files.json has arrived, and that
+// LoadSummary does not read the file list at all.
+func TestFilesStreamsEntries(t *testing.T) {
+	summaryJSON := `{"version":"2020-06-30","outputFormat":"DYNAMODB_JSON","s3Bucket":"b","manifestFilesS3Key":"export/manifest-files.json","exportTime":"t"}`
+	pr, pw := io.Pipe()
+	client := &pipeS3Client{
+		mockS3Client: &mockS3Client{data: map[string][]byte{"export/manifest-summary.json": []byte(summaryJSON)}},
+		files:        pr,
+	}
+	loader := NewS3Loader(client)
+	ctx := context.Background()
+	summary, err := loader.LoadSummary(ctx, "s3://test-bucket/export/manifest-summary.json")
+	if err != nil {
+		t.Fatalf("LoadSummary: %v", err)
+	}
+	if len(summary.DataFiles) != 0 {
+		t.Fatalf("LoadSummary read %d files", len(summary.DataFiles))
+	}
+
+	entry := func(name string) string {
+		return fmt.Sprintf(`{"itemCount":1,"md5Checksum":"y+zg5fVeudb3R3DOQ+RKgA==","etag":"x","dataFileS3Key":"export/data/%s.json.gz"}`+"\n", name)
+	}
+	go func() {
+		_, _ = io.WriteString(pw, entry("a"))
+		_, _ = io.WriteString(pw, entry("b"))
+		// The last entry is only written once the first two were consumed
+	}()
+	var keys []string
+	for file, err := range loader.Files(ctx, summary) {
+		if err != nil {
+			t.Fatalf("Files: %v", err)
+		}
+		keys = append(keys, file.Key)
+		if len(keys) == 2 {
+			go func() {
+				_, _ = io.WriteString(pw, entry("c"))
+				_ = pw.Close()
+			}()
+		}
+	}
+	if want := []string{"export/data/a.json.gz", "export/data/b.json.gz", "export/data/c.json.gz"}; !slices.Equal(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+}
+
+// TestFilesReportsInvalidEntries verifies that an invalid entry ends the
+// iteration with an error naming it, after the valid entries before it, and
+// that stopping early is not reported as an error.
+func TestFilesReportsInvalidEntries(t *testing.T) {
+	summaryJSON := `{"version":"2020-06-30","outputFormat":"DYNAMODB_JSON","s3Bucket":"b","manifestFilesS3Key":"export/manifest-files.json","exportTime":"t"}`
+	filesJSON := validFilesJSON + "\n" + `{"itemCount":1,"etag":"x","dataFileS3Key":"export/data/b.json.gz"}` + "\n" + validFilesJSON + "\n"
+	client := &mockS3Client{data: map[string][]byte{
+		"export/manifest-summary.json": []byte(summaryJSON),
+		"export/manifest-files.json":   []byte(filesJSON),
+	}}
+	loader := NewS3Loader(client)
+	ctx := context.Background()
+	summary, err := loader.LoadSummary(ctx, "s3://test-bucket/export/manifest-summary.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files int
+	var iterErr error
+	for _, err := range loader.Files(ctx, summary) {
+		if err != nil {
+			iterErr = err
+			continue
+		}
+		files++
+	}
+	if files != 1 || iterErr == nil || !strings.Contains(iterErr.Error(), "entry 1") {
+		t.Errorf("got %d files and error %v, want 1 file and an error for entry 1", files, iterErr)
+	}
+
+	for _, err := range loader.Files(ctx, summary) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		break
+	}
+}
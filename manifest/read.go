@@ -0,0 +1,167 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	json "github.com/goccy/go-json"
+)
+
+const (
+	defaultAttempts = 5                      // Attempts per manifest object
+	defaultBackoff  = 500 * time.Millisecond // Delay before the first retry
+)
+
+// permanentS3Errors are S3 error codes that retrying cannot fix.
+var permanentS3Errors = map[string]bool{
+	"NoSuchKey":          true,
+	"NoSuchBucket":       true,
+	"AccessDenied":       true,
+	"InvalidObjectState": true,
+	"PreconditionFailed": true, // The object changed between ranged reads
+}
+
+// readError is a failure while reading an object body, as opposed to a failure
+// to decode what was read.
+type readError struct {
+	err error
+}
+
+func (e *readError) Error() string { return e.err.Error() }
+func (e *readError) Unwrap() error { return e.err }
+
+// retryable reports whether a failed GetObject or body read may succeed when
+// repeated.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return !permanentS3Errors[apiErr.ErrorCode()]
+	}
+	return true
+}
+
+// wait sleeps before retry number failures, doubling the backoff each time.
+func (l *S3Loader) wait(ctx context.Context, failures int) error {
+	select {
+	case <-l.clock.After(l.backoff << (failures - 1)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// readObject reads a small object whole, retrying transient failures.
+func (l *S3Loader) readObject(ctx context.Context, bucket, key string) ([]byte, error) {
+	for failures := 1; ; failures++ {
+		data, err := l.readOnce(ctx, bucket, key)
+		if err == nil {
+			return data, nil
+		}
+		if !retryable(err) || failures >= l.attempts {
+			return nil, err
+		}
+		if err := l.wait(ctx, failures); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (l *S3Loader) readOnce(ctx context.Context, bucket, key string) ([]byte, error) {
+	resp, err := l.client.GetObject(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: &key})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Body == nil {
+		return nil, fmt.Errorf("response body is nil")
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return io.ReadAll(resp.Body)
+}
+
+// readFiles streams the entries of a manifest-files.json object to fn. When a
+// request or read fails, the object is requested again from the byte after the
+// last decoded entry, so a large file is not read twice and fn sees every entry
+// once. fn also receives the entry's unknown field names.
+func (l *S3Loader) readFiles(ctx context.Context, bucket, key string, fn func(FileMeta, []string) error) error {
+	var offset int64 // Bytes of the object decoded so far
+	var etag string  // Pins ranged reads to the object first read
+	for failures := 0; ; {
+		input := &s3.GetObjectInput{Bucket: &bucket, Key: &key}
+		if offset > 0 {
+			input.Range = awssdk.String(fmt.Sprintf("bytes=%d-", offset))
+			if etag != "" {
+				input.IfMatch = awssdk.String(etag)
+			}
+		}
+		resp, err := l.client.GetObject(ctx, input)
+		if err == nil && resp.Body == nil {
+			return fmt.Errorf("manifest files response body is nil")
+		}
+		if err == nil {
+			if offset == 0 {
+				etag = awssdk.ToString(resp.ETag)
+			}
+			var n int64
+			n, err = decodeFiles(resp.Body, fn)
+			_ = resp.Body.Close()
+			offset += n
+			if err == nil {
+				return nil
+			}
+			var rerr *readError
+			if !errors.As(err, &rerr) {
+				return err
+			}
+			if n > 0 {
+				failures = 0
+			}
+		}
+
+		failures++
+		if !retryable(err) || failures >= l.attempts {
+			return fmt.Errorf("failed to get manifest files after %d bytes: %w", offset, err)
+		}
+		if err := l.wait(ctx, failures); err != nil {
+			return err
+		}
+	}
+}
+
+// decodeFiles decodes manifest-files.json lines from r and returns the number of
+// bytes consumed by complete entries. Read failures are returned as *readError.
+func decodeFiles(r io.Reader, fn func(FileMeta, []string) error) (int64, error) {
+	br := bufio.NewReader(r)
+	var consumed int64
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			// A partial line is read again on retry
+			return consumed, &readError{err: err}
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			var file FileMeta
+			if err := json.Unmarshal(trimmed, &file); err != nil {
+				return consumed, fmt.Errorf("failed to decode manifest file entry at byte %d: %w", consumed, err)
+			}
+			unknown, _ := unknownFields(trimmed, knownFileFields)
+			if err := fn(file, unknown); err != nil {
+				return consumed, err
+			}
+		}
+		consumed += int64(len(line))
+		if err == io.EOF {
+			return consumed, nil
+		}
+	}
+}
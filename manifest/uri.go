@@ -0,0 +1,134 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gurre/ddb-pitr/s3uri"
+)
+
+// SummaryFile is written last by an export, so its presence marks a completed export.
+const SummaryFile = "manifest-summary.json"
+
+// exportRoot is the directory DynamoDB writes exports to below the S3 prefix.
+const exportRoot = "AWSDynamoDB"
+
+// ObjectFinder is the subset of the S3 client used by ResolveURI.
+type ObjectFinder interface {
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// ResolveURI returns the manifest-summary.json URI of the export uri points at.
+// Like the S3 location asked for by the AWS console, uri may be any of:
+//
+//	s3://bucket/prefix/AWSDynamoDB/01234567890123-abcd1234/manifest-summary.json
+//	s3://bucket/prefix/AWSDynamoDB/01234567890123-abcd1234/
+//	s3://bucket/prefix/AWSDynamoDB/
+//	s3://bucket/prefix/
+//
+// The last two must hold exactly one completed export; otherwise the error lists
+// the exports found so the caller can pick one.
+// Example:
+//
+//	uri, err := manifest.ResolveURI(ctx, s3Client, "s3://my-bucket/exports/")
+//	if err != nil {
+//	    return err
+//	}
+//	summary, err := loader.Load(ctx, uri)
+func ResolveURI(ctx context.Context, client ObjectFinder, uri string) (string, error) {
+	u, err := s3uri.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Name() == SummaryFile && !u.IsPrefix() {
+		return uri, nil
+	}
+	dir := u
+	if !dir.IsPrefix() {
+		dir.Key += "/"
+	}
+
+	// An export directory holds the summary itself
+	if dir.Key != "" && dir.Name() != exportRoot {
+		summary := dir.Join(SummaryFile)
+		found, err := exists(ctx, client, summary)
+		if err != nil {
+			return "", err
+		}
+		if found {
+			return summary.String(), nil
+		}
+	}
+
+	// Otherwise look for exports one level down in the AWSDynamoDB directory
+	root := dir
+	if root.Name() != exportRoot {
+		root = root.Join(exportRoot + "/")
+	}
+	candidates, err := completedExports(ctx, client, root)
+	if err != nil {
+		return "", err
+	}
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("no completed export found at %s: expected %s in %s<export-id>/", uri, SummaryFile, root)
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("%s holds %d exports; pass one of them:\n  %s", uri, len(candidates), strings.Join(candidates, "\n  "))
+	}
+}
+
+// completedExports returns the summary URIs of the export directories below
+// root that have a manifest summary, sorted.
+func completedExports(ctx context.Context, client ObjectFinder, root s3uri.URI) ([]string, error) {
+	var uris []string
+	input := &s3.ListObjectsV2Input{
+		Bucket:    awssdk.String(root.Bucket),
+		Prefix:    awssdk.String(root.Key),
+		Delimiter: awssdk.String("/"),
+	}
+	for {
+		out, err := client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list exports in %s: %w", root, err)
+		}
+		for _, p := range out.CommonPrefixes {
+			summary := s3uri.URI{Bucket: root.Bucket, Key: awssdk.ToString(p.Prefix) + SummaryFile}
+			found, err := exists(ctx, client, summary)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				uris = append(uris, summary.String())
+			}
+		}
+		if !awssdk.ToBool(out.IsTruncated) {
+			break
+		}
+		input.ContinuationToken = out.NextContinuationToken
+	}
+	sort.Strings(uris)
+	return uris, nil
+}
+
+// exists reports whether the object exists.
+func exists(ctx context.Context, client ObjectFinder, u s3uri.URI) (bool, error) {
+	_, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: awssdk.String(u.Bucket), Key: awssdk.String(u.Key)})
+	if err == nil {
+		return true, nil
+	}
+	var notFound *s3types.NotFound
+	var noSuchKey *s3types.NoSuchKey
+	if errors.As(err, &notFound) || errors.As(err, &noSuchKey) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check %s: %w", u, err)
+}
@@ -0,0 +1,61 @@
+package manifest
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// TestResolveURIAcceptsPrefixes checks that an export directory, the AWSDynamoDB
+// root and the prefix above it resolve to the same manifest summary as the
+// explicit URI, so users can paste whichever location the console shows them.
+func TestResolveURIAcceptsPrefixes(t *testing.T) {
+	client := &mockS3Client{data: map[string][]byte{
+		"exports/AWSDynamoDB/0176-abcd/manifest-summary.json": []byte("{}"),
+		"exports/AWSDynamoDB/0176-abcd/manifest-files.json":   []byte(""),
+		"exports/AWSDynamoDB/0177-beef/data/part.json.gz":     []byte(""), // Still being written
+	}}
+	want := "s3://bucket/exports/AWSDynamoDB/0176-abcd/manifest-summary.json"
+
+	for _, uri := range []string{
+		want,
+		"s3://bucket/exports/AWSDynamoDB/0176-abcd/",
+		"s3://bucket/exports/AWSDynamoDB/0176-abcd",
+		"s3://bucket/exports/AWSDynamoDB/",
+		"s3://bucket/exports/",
+		"s3://bucket/exports",
+	} {
+		got, err := ResolveURI(context.Background(), client, uri)
+		if err != nil {
+			t.Errorf("ResolveURI(%s) failed: %v", uri, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ResolveURI(%s) = %s, want %s", uri, got, want)
+		}
+	}
+}
+
+// TestResolveURIRejectsAmbiguousAndEmptyPrefixes checks that a prefix holding
+// several exports, or none, is an error naming the candidates rather than a guess,
+// since restoring the wrong export silently would be far worse than asking.
+func TestResolveURIRejectsAmbiguousAndEmptyPrefixes(t *testing.T) {
+	client := &mockS3Client{data: map[string][]byte{
+		"AWSDynamoDB/0176-abcd/manifest-summary.json": []byte("{}"),
+		"AWSDynamoDB/0177-beef/manifest-summary.json": []byte("{}"),
+	}}
+
+	_, err := ResolveURI(context.Background(), client, "s3://bucket/")
+	if err == nil || !strings.Contains(err.Error(), "0176-abcd") || !strings.Contains(err.Error(), "0177-beef") {
+		t.Errorf("expected an error listing both exports, got %v", err)
+	}
+
+	_, err = ResolveURI(context.Background(), client, "s3://bucket/other/")
+	if err == nil || !strings.Contains(err.Error(), "no completed export") {
+		t.Errorf("expected a no export error, got %v", err)
+	}
+
+	if _, err := ResolveURI(context.Background(), client, "not-an-s3-uri"); err == nil {
+		t.Error("expected an error for a non-S3 URI")
+	}
+}
@@ -0,0 +1,153 @@
+package manifest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	json "github.com/goccy/go-json"
+)
+
+// Manifest versions this package understands. 2020-06-30 is used by full exports,
+// 2023-08-01 introduced incremental exports.
+var supportedVersions = map[string]bool{
+	"2020-06-30": true,
+	"2023-08-01": true,
+}
+
+// Export types found in manifest-summary.json. Older manifests omit the field,
+// which means a full export.
+const (
+	ExportTypeFull        = "FULL_EXPORT"
+	ExportTypeIncremental = "INCREMENTAL_EXPORT"
+)
+
+// Output formats of the data files. DynamoDB exports are written as
+// DYNAMODB_JSON; DATA_PIPELINE_JSON is set by DataPipelineLoader.
+const (
+	OutputFormatDynamoDBJSON     = "DYNAMODB_JSON"
+	OutputFormatDataPipelineJSON = "DATA_PIPELINE_JSON"
+)
+
+// knownSummaryFields lists the manifest-summary.json fields this version knows about.
+// Anything else produces a forward-compatibility warning.
+var knownSummaryFields = map[string]bool{
+	"version": true, "exportArn": true, "startTime": true, "endTime": true,
+	"tableArn": true, "tableId": true, "exportTime": true, "exportFromTime": true,
+	"exportToTime": true, "s3Bucket": true, "s3Prefix": true, "s3SseAlgorithm": true,
+	"s3SseKmsKeyId": true, "manifestFilesS3Key": true, "billedSizeBytes": true,
+	"itemCount": true, "outputFormat": true, "outputView": true, "exportType": true,
+}
+
+// knownFileFields lists the manifest-files.json entry fields this version knows
+// about, including the legacy names handled by FileMeta.UnmarshalJSON.
+var knownFileFields = func() map[string]bool {
+	known := map[string]bool{"itemCount": true, "md5Checksum": true, "etag": true, "dataFileS3Key": true}
+	for _, name := range legacyFileFields {
+		known[name] = true
+	}
+	return known
+}()
+
+// IsIncremental reports whether the summary describes an incremental export.
+func (s Summary) IsIncremental() bool {
+	return s.ExportType == ExportTypeIncremental
+}
+
+// Validate checks that the summary has the fields required for its export type
+// and uses a version and output format this tool can restore. It does not check
+// DataFiles; see ValidateFiles.
+// Example:
+//
+//	if err := summary.Validate(); err != nil {
+//	    log.Fatalf("cannot restore export: %v", err)
+//	}
+func (s Summary) Validate() error {
+	if s.Version == "" {
+		return fmt.Errorf("manifest summary is missing version")
+	}
+	if !supportedVersions[s.Version] {
+		return fmt.Errorf("unsupported manifest version %q (supported: %s)", s.Version, strings.Join(sortedKeys(supportedVersions), ", "))
+	}
+	if s.OutputFormat != OutputFormatDynamoDBJSON {
+		return fmt.Errorf("unsupported export output format %q (only %s is supported)", s.OutputFormat, OutputFormatDynamoDBJSON)
+	}
+	if s.ManifestFilesS3Key == "" {
+		return fmt.Errorf("manifest summary is missing manifestFilesS3Key")
+	}
+	if s.S3Bucket == "" {
+		return fmt.Errorf("manifest summary is missing s3Bucket")
+	}
+
+	switch s.ExportType {
+	case "", ExportTypeFull:
+		if s.ExportTime == "" {
+			return fmt.Errorf("full export manifest is missing exportTime")
+		}
+	case ExportTypeIncremental:
+		if s.ExportFromTime == "" || s.ExportToTime == "" {
+			return fmt.Errorf("incremental export manifest is missing exportFromTime or exportToTime")
+		}
+		if s.OutputView != "NEW_IMAGE" && s.OutputView != "NEW_AND_OLD_IMAGES" {
+			return fmt.Errorf("incremental export manifest has unsupported outputView %q", s.OutputView)
+		}
+	default:
+		return fmt.Errorf("unsupported export type %q", s.ExportType)
+	}
+	return nil
+}
+
+// ValidateFiles checks every data file entry for the fields needed to stream and
+// verify it.
+func (s Summary) ValidateFiles() error {
+	for i, f := range s.DataFiles {
+		if err := f.validate(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks entry i of manifest-files.json.
+func (f FileMeta) validate(i int) error {
+	if f.Key == "" {
+		return fmt.Errorf("manifest files entry %d is missing dataFileS3Key", i)
+	}
+	if f.ItemCount < 0 {
+		return fmt.Errorf("manifest files entry %d (%s) has negative itemCount", i, f.Key)
+	}
+	if f.MD5Base64 == "" {
+		return fmt.Errorf("manifest files entry %d (%s) is missing md5Checksum", i, f.Key)
+	}
+	if _, err := base64.StdEncoding.DecodeString(f.MD5Base64); err != nil {
+		return fmt.Errorf("manifest files entry %d (%s) has invalid md5Checksum: %w", i, f.Key, err)
+	}
+	return nil
+}
+
+// unknownFields returns the top-level field names in data that are not in known.
+func unknownFields(data []byte, known map[string]bool) ([]string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	var unknown []string
+	for name := range fields {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown, nil
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,99 @@
+package materialize
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gurre/ddb-pitr/aws"
+)
+
+const (
+	csvSerDe          = "org.apache.hadoop.hive.serde2.OpenCSVSerde"
+	textInputFormat   = "org.apache.hadoop.mapred.TextInputFormat"
+	textOutputFormat  = "org.apache.hadoop.hive.ql.io.HiveIgnoreKeyTextOutputFormat"
+	maxGluePartitions = 100 // Partitions per BatchCreatePartition call, the maximum Glue allows
+)
+
+// Register creates the Glue table name, given as database.table, over the files
+// Close wrote under the s3:// prefix uri, or replaces its definition if it
+// exists, so Athena can query them right away. Columns have the types Close
+// inferred and, with partitionBy, every partition Close wrote is added; ones
+// the table already has are kept. Partitions of earlier runs that this run did
+// not write are not removed.
+// Example:
+//
+//	stats, err := t.Close(ctx, out)
+//	err = materialize.Register(ctx, aws.NewGlueClient(awsCfg), "analytics.orders", "s3://athena-data/orders/", stats, "country")
+func Register(ctx context.Context, client aws.GlueClient, name, uri string, stats Stats, partitionBy string) error {
+	database, table, ok := strings.Cut(name, ".")
+	if !ok || database == "" || table == "" {
+		return fmt.Errorf("glue table %q must be database.table", name)
+	}
+	if !strings.HasSuffix(uri, "/") {
+		uri += "/"
+	}
+
+	// Athena folds column names to lower case
+	seen := make(map[string]string, len(stats.Columns))
+	columns := make([]aws.GlueColumn, len(stats.Columns))
+	for i, col := range stats.Columns {
+		if other, ok := seen[strings.ToLower(col)]; ok {
+			return fmt.Errorf("attributes %s and %s are the same column in Athena", other, col)
+		}
+		seen[strings.ToLower(col)] = col
+		columns[i] = aws.GlueColumn{Name: col, Type: stats.Types[i]}
+	}
+	input := aws.GlueTableInput{
+		Name:       table,
+		TableType:  "EXTERNAL_TABLE",
+		Parameters: map[string]string{"classification": "csv", "skip.header.line.count": "1", "EXTERNAL": "TRUE"},
+		StorageDescriptor: aws.GlueStorageDescriptor{
+			Columns:      columns,
+			Location:     uri,
+			InputFormat:  textInputFormat,
+			OutputFormat: textOutputFormat,
+			SerdeInfo:    aws.GlueSerDeInfo{SerializationLibrary: csvSerDe},
+		},
+	}
+	if partitionBy != "" {
+		input.PartitionKeys = []aws.GlueColumn{{Name: partitionBy, Type: "string"}}
+	}
+
+	err := client.UpdateTable(ctx, database, input)
+	if aws.IsGlueErrorCode(err, "EntityNotFoundException") {
+		err = client.CreateTable(ctx, database, input)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to register glue table %s: %w", name, err)
+	}
+	if partitionBy == "" {
+		return nil
+	}
+
+	var partitions []aws.GluePartitionInput
+	for _, dir := range stats.Partitions {
+		value, err := url.PathUnescape(strings.TrimSuffix(strings.TrimPrefix(dir, partitionBy+"="), "/"))
+		if err != nil {
+			return fmt.Errorf("invalid partition directory %s: %w", dir, err)
+		}
+		sd := input.StorageDescriptor
+		sd.Location = uri + dir
+		partitions = append(partitions, aws.GluePartitionInput{Values: []string{value}, StorageDescriptor: sd})
+	}
+	for len(partitions) > 0 {
+		n := min(len(partitions), maxGluePartitions)
+		failed, err := client.BatchCreatePartition(ctx, database, table, partitions[:n])
+		if err != nil {
+			return fmt.Errorf("failed to add partitions to glue table %s: %w", name, err)
+		}
+		for _, f := range failed {
+			if f.Code != "AlreadyExistsException" {
+				return fmt.Errorf("failed to add partition %v to glue table %s: %s", f.Values, name, f.Code)
+			}
+		}
+		partitions = partitions[n:]
+	}
+	return nil
+}
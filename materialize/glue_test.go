@@ -0,0 +1,113 @@
+package materialize
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/aws"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+type fakeGlue struct {
+	tables     map[string]aws.GlueTableInput
+	created    int
+	partitions map[string]aws.GluePartitionInput
+	calls      int // BatchCreatePartition calls
+}
+
+func (f *fakeGlue) CreateTable(ctx context.Context, database string, table aws.GlueTableInput) error {
+	f.created++
+	f.tables[database+"."+table.Name] = table
+	return nil
+}
+
+func (f *fakeGlue) UpdateTable(ctx context.Context, database string, table aws.GlueTableInput) error {
+	if _, ok := f.tables[database+"."+table.Name]; !ok {
+		return &aws.GlueError{Code: "EntityNotFoundException", Message: "table not found"}
+	}
+	f.tables[database+"."+table.Name] = table
+	return nil
+}
+
+func (f *fakeGlue) BatchCreatePartition(ctx context.Context, database, table string, partitions []aws.GluePartitionInput) ([]aws.GluePartitionError, error) {
+	f.calls++
+	var failed []aws.GluePartitionError
+	for _, p := range partitions {
+		if _, ok := f.partitions[p.Values[0]]; ok {
+			failed = append(failed, aws.GluePartitionError{Values: p.Values, Code: "AlreadyExistsException"})
+			continue
+		}
+		f.partitions[p.Values[0]] = p
+	}
+	return failed, nil
+}
+
+// TestRegisterCreatesThenRefreshes checks the first run creates the table with
+// the inferred column types and partitions, and a second run replaces the
+// definition and keeps the partitions it already has instead of failing.
+func TestRegisterCreatesThenRefreshes(t *testing.T) {
+	table := NewTable([]string{"pk"}, "city")
+	var ops []itemimage.Operation
+	for i := range 150 { // More partitions than one BatchCreatePartition call takes
+		ops = append(ops, itemimage.Operation{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{
+			"pk": s(strconv.Itoa(i)), "city": s("city " + strconv.Itoa(i)), "n": n(strconv.Itoa(i)),
+		}})
+	}
+	ops[0].NewImage["n"] = n("1.5")
+	ops[1].NewImage["active"] = &types.AttributeValueMemberBOOL{Value: true}
+	if err := table.WriteBatch(context.Background(), ops); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := table.Close(context.Background(), NewDirOutput(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	glue := &fakeGlue{tables: map[string]aws.GlueTableInput{}, partitions: map[string]aws.GluePartitionInput{}}
+	for range 2 {
+		if err := Register(context.Background(), glue, "analytics.orders", "s3://athena-data/orders", stats, "city"); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+	}
+	if glue.created != 1 || glue.calls != 4 || len(glue.partitions) != 150 {
+		t.Errorf("created %d tables in %d calls with %d partitions", glue.created, glue.calls, len(glue.partitions))
+	}
+	got := glue.tables["analytics.orders"]
+	want := []aws.GlueColumn{{Name: "pk", Type: "string"}, {Name: "active", Type: "boolean"}, {Name: "n", Type: "double"}}
+	if !slices.Equal(got.StorageDescriptor.Columns, want) {
+		t.Errorf("columns = %v, want %v", got.StorageDescriptor.Columns, want)
+	}
+	if got.StorageDescriptor.Location != "s3://athena-data/orders/" || got.PartitionKeys[0].Name != "city" {
+		t.Errorf("table = %+v", got)
+	}
+	if p := glue.partitions["city 7"]; p.StorageDescriptor.Location != "s3://athena-data/orders/city=city%207/" {
+		t.Errorf("partition location = %q", p.StorageDescriptor.Location)
+	}
+}
+
+// TestWidenType checks columns mixing types fall back to a type holding every value.
+func TestWidenType(t *testing.T) {
+	tests := []struct {
+		values []types.AttributeValue
+		want   string
+	}{
+		{[]types.AttributeValue{n("1"), nil, n("-2")}, "bigint"},
+		{[]types.AttributeValue{n("1"), n("1e3")}, "double"},
+		{[]types.AttributeValue{n("99999999999999999999")}, "double"},
+		{[]types.AttributeValue{n("1"), s("1")}, "string"},
+		{[]types.AttributeValue{&types.AttributeValueMemberBOOL{}, n("1")}, "string"},
+		{[]types.AttributeValue{&types.AttributeValueMemberNULL{Value: true}}, ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		for _, v := range tt.values {
+			got = widenType(got, v)
+		}
+		if got != tt.want {
+			t.Errorf("widenType(%v) = %q, want %q", tt.values, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,454 @@
+// Package materialize turns an export into CSV files instead of table writes.
+// It reconciles the operations of a full export and its incremental exports
+// into the items as of the last export, then writes them partitioned by an
+// attribute in the Hive layout Athena reads, so a point-in-time snapshot can be
+// queried without restoring it to DynamoDB.
+package materialize
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/s3uri"
+	"github.com/gurre/ddb-pitr/writer"
+)
+
+// DefaultPartition is the partition of items without the partition attribute,
+// named as Hive and Athena name the partition of null values.
+const DefaultPartition = "__HIVE_DEFAULT_PARTITION__"
+
+// entry is the reconciled state of one item.
+type entry struct {
+	item    map[string]types.AttributeValue // Latest image; nil once deleted
+	written int64                           // WriteTimestampMicros of the operation that set it
+}
+
+// Table implements writer.Writer by collecting operations into the items they
+// leave behind, in memory, instead of writing them. Operations on an item are
+// reconciled by their write timestamp, so the newest wins whatever order the
+// workers deliver them in; deletes are kept as tombstones until Close.
+// It is safe for concurrent use.
+// Example:
+//
+//	t := materialize.NewTable([]string{"pk", "sk"}, "country")
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, t, store, nil)
+//	if err := coord.Run(ctx); err != nil {
+//	    return err
+//	}
+//	stats, err := t.Close(ctx, materialize.NewDirOutput("/tmp/snapshot"))
+type Table struct {
+	keyAttrs    []string // Primary key attributes of the exported table, partition key first
+	partitionBy string   // Attribute whose value names each item's partition ("" = one partition)
+
+	mu    sync.Mutex
+	items map[string]*entry // Items by key fingerprint
+}
+
+// NewTable creates a Table for items with the primary key keyAttrs, written
+// partitioned by the value of partitionBy.
+func NewTable(keyAttrs []string, partitionBy string) *Table {
+	return &Table{keyAttrs: keyAttrs, partitionBy: partitionBy, items: make(map[string]*entry)}
+}
+
+// WriteBatch implements writer.Writer. Puts and updates replace the item with
+// their new image, which holds every attribute, and deletes remove it.
+func (t *Table) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, op := range ops {
+		image := op.NewImage
+		if op.Type == itemimage.OpDelete {
+			image = nil
+		}
+		key, err := t.key(op)
+		if err != nil {
+			return err
+		}
+		if e, ok := t.items[key]; ok && e.written > op.WriteTimestampMicros {
+			continue // A newer change of the item was applied first
+		}
+		t.items[key] = &entry{item: image, written: op.WriteTimestampMicros}
+	}
+	return nil
+}
+
+// Flush implements writer.Writer. Items are only written by Close, after the
+// last export of a chain.
+func (t *Table) Flush(ctx context.Context) error {
+	return nil
+}
+
+// key returns the fingerprint of op's primary key, taken from Keys or, for
+// full exports that carry only the item, from NewImage.
+func (t *Table) key(op itemimage.Operation) (string, error) {
+	image := op.Keys
+	if image == nil {
+		image = op.NewImage
+	}
+	keys := make(map[string]types.AttributeValue, len(t.keyAttrs))
+	for _, attr := range t.keyAttrs {
+		v, ok := image[attr]
+		if !ok {
+			return "", fmt.Errorf("%s operation from %s at offset %d has no key attribute %s",
+				op.Type, op.SourceFile, op.ByteOffset, attr)
+		}
+		keys[attr] = v
+	}
+	return itemimage.KeyFingerprint(keys), nil
+}
+
+// Stats counts what Close wrote.
+type Stats struct {
+	Items      int64    // Items written
+	Deleted    int64    // Items deleted by the exports, and not written
+	Columns    []string // Columns of every file, in order
+	Types      []string // Hive type of each column: bigint, double, boolean or string
+	Partitions []string // Partition directories written, sorted
+}
+
+// Output receives the files written by Close.
+type Output interface {
+	// Create returns a writer for the file at the slash-separated path,
+	// committed when closed.
+	Create(ctx context.Context, path string) (io.WriteCloser, error)
+}
+
+// Close writes the reconciled items to out as CSV files, one per partition at
+// <partitionBy>=<value>/part-00000.csv, or part-00000.csv without partitioning.
+// Every file has the same header: the key attributes, then every other
+// attribute found on any item, sorted. The partition attribute is not a
+// column, as Athena reads it from the path.
+func (t *Table) Close(ctx context.Context, out Output) (Stats, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var stats Stats
+	seen := make(map[string]bool)
+	partitions := make(map[string][]string) // Key fingerprints by partition directory
+	for key, e := range t.items {
+		if e.item == nil {
+			stats.Deleted++
+			continue
+		}
+		for name := range e.item {
+			if !slices.Contains(t.keyAttrs, name) && name != t.partitionBy {
+				seen[name] = true
+			}
+		}
+		dir := ""
+		if t.partitionBy != "" {
+			dir = t.partitionBy + "=" + partitionValue(e.item[t.partitionBy]) + "/"
+		}
+		partitions[dir] = append(partitions[dir], key)
+	}
+	others := make([]string, 0, len(seen))
+	for name := range seen {
+		others = append(others, name)
+	}
+	sort.Strings(others)
+	stats.Columns = append(slices.Clone(t.keyAttrs), others...)
+	stats.Types = t.columnTypes(stats.Columns)
+
+	for dir, keys := range partitions {
+		stats.Partitions = append(stats.Partitions, dir)
+		sort.Strings(keys) // Deterministic output
+		if err := t.writeFile(ctx, out, dir+"part-00000.csv", stats.Columns, keys); err != nil {
+			return stats, err
+		}
+		stats.Items += int64(len(keys))
+	}
+	sort.Strings(stats.Partitions)
+	return stats, nil
+}
+
+// columnTypes infers the Hive type of each column from the values the items
+// hold: bigint when every value is an integer number in range, double when
+// every value is a number, boolean when every value is one, and otherwise
+// string. Absent and NULL values do not count, and a column without values is
+// a string.
+func (t *Table) columnTypes(columns []string) []string {
+	colTypes := make([]string, len(columns))
+	for _, e := range t.items {
+		if e.item == nil {
+			continue
+		}
+		for i, name := range columns {
+			colTypes[i] = widenType(colTypes[i], e.item[name])
+		}
+	}
+	for i := range colTypes {
+		if colTypes[i] == "" {
+			colTypes[i] = "string"
+		}
+	}
+	return colTypes
+}
+
+// widenType returns the narrowest type holding both a column of type prev
+// ("" = no values yet) and v.
+func widenType(prev string, v types.AttributeValue) string {
+	var t string
+	switch v := v.(type) {
+	case nil, *types.AttributeValueMemberNULL:
+		return prev
+	case *types.AttributeValueMemberN:
+		t = "double"
+		if _, err := strconv.ParseInt(v.Value, 10, 64); err == nil {
+			t = "bigint"
+		}
+	case *types.AttributeValueMemberBOOL:
+		t = "boolean"
+	default:
+		t = "string"
+	}
+	switch {
+	case prev == "" || prev == t:
+		return t
+	case prev == "bigint" && t == "double", prev == "double" && t == "bigint":
+		return "double"
+	default:
+		return "string"
+	}
+}
+
+// writeFile writes the items with the given keys as one CSV file.
+func (t *Table) writeFile(ctx context.Context, out Output, path string, columns, keys []string) error {
+	f, err := out.Create(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	w := csv.NewWriter(f)
+	err = w.Write(columns)
+	row := make([]string, len(columns))
+	for _, key := range keys {
+		if err != nil {
+			break
+		}
+		item := t.items[key].item
+		for i, name := range columns {
+			if row[i], err = csvValue(item[name]); err != nil {
+				err = fmt.Errorf("attribute %s: %w", name, err)
+				break
+			}
+		}
+		if err == nil {
+			err = w.Write(row)
+		}
+	}
+	w.Flush()
+	if err == nil {
+		err = w.Error()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// partitionValue renders a scalar partition value for a Hive path, escaping
+// characters that are not safe in a path segment.
+func partitionValue(v types.AttributeValue) string {
+	var s string
+	switch v := v.(type) {
+	case *types.AttributeValueMemberS:
+		s = v.Value
+	case *types.AttributeValueMemberN:
+		s = v.Value
+	case *types.AttributeValueMemberBOOL:
+		s = fmt.Sprint(v.Value)
+	default:
+		return DefaultPartition
+	}
+	if s == "" {
+		return DefaultPartition
+	}
+	return url.PathEscape(s)
+}
+
+// csvValue renders an attribute as a CSV field: scalars as their value, binary
+// as base64, absent and NULL values as empty fields, and sets, lists and maps
+// as plain JSON that Athena's JSON functions can query.
+func csvValue(v types.AttributeValue) (string, error) {
+	switch v := v.(type) {
+	case nil, *types.AttributeValueMemberNULL:
+		return "", nil
+	case *types.AttributeValueMemberS:
+		return v.Value, nil
+	case *types.AttributeValueMemberN:
+		return v.Value, nil
+	case *types.AttributeValueMemberBOOL:
+		return fmt.Sprint(v.Value), nil
+	case *types.AttributeValueMemberB:
+		return base64.StdEncoding.EncodeToString(v.Value), nil
+	}
+	b, err := json.Marshal(plainValue(v))
+	return string(b), err
+}
+
+// plainValue converts an attribute to the plain JSON value it holds, keeping
+// numbers as their exact digits.
+func plainValue(v types.AttributeValue) any {
+	switch v := v.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value
+	case *types.AttributeValueMemberN:
+		return json.Number(v.Value)
+	case *types.AttributeValueMemberBOOL:
+		return v.Value
+	case *types.AttributeValueMemberB:
+		return base64.StdEncoding.EncodeToString(v.Value)
+	case *types.AttributeValueMemberSS:
+		return v.Value
+	case *types.AttributeValueMemberNS:
+		out := make([]json.Number, len(v.Value))
+		for i, n := range v.Value {
+			out[i] = json.Number(n)
+		}
+		return out
+	case *types.AttributeValueMemberBS:
+		out := make([]string, len(v.Value))
+		for i, b := range v.Value {
+			out[i] = base64.StdEncoding.EncodeToString(b)
+		}
+		return out
+	case *types.AttributeValueMemberL:
+		out := make([]any, len(v.Value))
+		for i, e := range v.Value {
+			out[i] = plainValue(e)
+		}
+		return out
+	case *types.AttributeValueMemberM:
+		out := make(map[string]any, len(v.Value))
+		for k, e := range v.Value {
+			out[k] = plainValue(e)
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+// DirOutput writes files under a local directory.
+type DirOutput struct {
+	dir string
+}
+
+// NewDirOutput creates an Output writing under dir, which is created as needed.
+// Example:
+//
+//	out := materialize.NewDirOutput("/tmp/snapshot")
+func NewDirOutput(dir string) *DirOutput {
+	return &DirOutput{dir: dir}
+}
+
+// Create implements Output.
+func (o *DirOutput) Create(ctx context.Context, path string) (io.WriteCloser, error) {
+	full := filepath.Join(o.dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(full)
+	if err != nil {
+		return nil, err
+	}
+	return &bufferedFile{Writer: bufio.NewWriter(f), file: f}, nil
+}
+
+// bufferedFile flushes its buffer before closing the file.
+type bufferedFile struct {
+	*bufio.Writer
+	file *os.File
+}
+
+// Close flushes and closes the file.
+func (f *bufferedFile) Close() error {
+	if err := f.Flush(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// PutClient is the subset of the S3 client used to upload files.
+type PutClient interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// S3Output writes files under an S3 prefix. Each file is staged in a local
+// temporary file and uploaded when closed.
+type S3Output struct {
+	client PutClient
+	prefix s3uri.URI
+}
+
+// NewS3Output creates an Output writing under the S3 prefix uri.
+// Example:
+//
+//	out, err := materialize.NewS3Output(s3.NewFromConfig(awsCfg), "s3://athena-data/orders/2025-01-14/")
+func NewS3Output(client PutClient, uri string) (*S3Output, error) {
+	prefix, err := s3uri.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if prefix.Key != "" && !strings.HasSuffix(prefix.Key, "/") {
+		prefix.Key += "/"
+	}
+	return &S3Output{client: client, prefix: prefix}, nil
+}
+
+// Create implements Output.
+func (o *S3Output) Create(ctx context.Context, path string) (io.WriteCloser, error) {
+	f, err := os.CreateTemp("", "ddb-pitr-materialize-*.csv")
+	if err != nil {
+		return nil, err
+	}
+	return &s3File{bufferedFile: bufferedFile{Writer: bufio.NewWriter(f), file: f}, ctx: ctx, output: o, key: o.prefix.Key + path}, nil
+}
+
+// s3File uploads its staged contents when closed.
+type s3File struct {
+	bufferedFile
+	ctx    context.Context
+	output *S3Output
+	key    string
+}
+
+// Close uploads the file and removes the staged copy.
+func (f *s3File) Close() error {
+	defer os.Remove(f.file.Name())
+	if err := f.Flush(); err != nil {
+		f.file.Close()
+		return err
+	}
+	defer f.file.Close()
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	bucket := f.output.prefix.Bucket
+	if _, err := f.output.client.PutObject(f.ctx, &s3.PutObjectInput{Bucket: &bucket, Key: &f.key, Body: f.file}); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", s3uri.URI{Bucket: bucket, Key: f.key}, err)
+	}
+	return nil
+}
+
+// Compile-time check that Table can replace the DynamoDB writer.
+var _ writer.Writer = (*Table)(nil)
@@ -0,0 +1,166 @@
+package materialize
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+func s(v string) types.AttributeValue { return &types.AttributeValueMemberS{Value: v} }
+func n(v string) types.AttributeValue { return &types.AttributeValueMemberN{Value: v} }
+
+func readCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+// TestTableReconcilesChanges checks the files hold each item as left by its
+// newest change: full export items replaced by later puts and updates, deleted
+// items absent, and an older change delivered late by another worker ignored.
+func TestTableReconcilesChanges(t *testing.T) {
+	table := NewTable([]string{"pk"}, "country")
+	ctx := context.Background()
+	batches := [][]itemimage.Operation{
+		{ // Full export
+			{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"pk": s("a"), "country": s("SE"), "v": n("1")}},
+			{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"pk": s("b"), "country": s("SE")}},
+			{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"pk": s("c"), "country": s("US")}},
+		},
+		{ // Incremental export
+			{Type: itemimage.OpUpdate, Keys: map[string]types.AttributeValue{"pk": s("a")}, WriteTimestampMicros: 20,
+				NewImage: map[string]types.AttributeValue{"pk": s("a"), "country": s("NO"), "v": n("2")}},
+			{Type: itemimage.OpDelete, Keys: map[string]types.AttributeValue{"pk": s("b")}, WriteTimestampMicros: 20},
+			{Type: itemimage.OpPut, Keys: map[string]types.AttributeValue{"pk": s("d")}, WriteTimestampMicros: 20,
+				NewImage: map[string]types.AttributeValue{"pk": s("d"), "tags": &types.AttributeValueMemberSS{Value: []string{"x", "y"}}}},
+		},
+		{ // Older changes delivered after newer ones
+			{Type: itemimage.OpPut, Keys: map[string]types.AttributeValue{"pk": s("b")}, WriteTimestampMicros: 10,
+				NewImage: map[string]types.AttributeValue{"pk": s("b"), "country": s("SE")}},
+			{Type: itemimage.OpUpdate, Keys: map[string]types.AttributeValue{"pk": s("a")}, WriteTimestampMicros: 10,
+				NewImage: map[string]types.AttributeValue{"pk": s("a"), "country": s("SE"), "v": n("1.5")}},
+		},
+	}
+	for _, batch := range batches {
+		if err := table.WriteBatch(ctx, batch); err != nil {
+			t.Fatalf("WriteBatch: %v", err)
+		}
+	}
+
+	dir := t.TempDir()
+	stats, err := table.Close(ctx, NewDirOutput(dir))
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if stats.Items != 3 || stats.Deleted != 1 {
+		t.Errorf("stats = %+v, want 3 items and 1 deleted", stats)
+	}
+	wantPartitions := []string{"country=NO/", "country=US/", "country=__HIVE_DEFAULT_PARTITION__/"}
+	if !slices.Equal(stats.Partitions, wantPartitions) {
+		t.Errorf("partitions = %v, want %v", stats.Partitions, wantPartitions)
+	}
+
+	// Every file has the same header, without the partition attribute
+	header := []string{"pk", "tags", "v"}
+	want := map[string][][]string{
+		"country=NO":                         {header, {"a", "", "2"}},
+		"country=US":                         {header, {"c", "", ""}},
+		"country=__HIVE_DEFAULT_PARTITION__": {header, {"d", `["x","y"]`, ""}},
+	}
+	for partition, rows := range want {
+		got := readCSV(t, filepath.Join(dir, partition, "part-00000.csv"))
+		if !slices.EqualFunc(got, rows, slices.Equal) {
+			t.Errorf("%s = %q, want %q", partition, got, rows)
+		}
+	}
+}
+
+// TestTableRequiresKeyAttributes checks an item without the configured key
+// fails instead of being merged with other keyless items.
+func TestTableRequiresKeyAttributes(t *testing.T) {
+	table := NewTable([]string{"pk", "sk"}, "")
+	op := itemimage.Operation{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"pk": s("a")}, SourceFile: "data/x.json.gz"}
+	err := table.WriteBatch(context.Background(), []itemimage.Operation{op})
+	if err == nil || !strings.Contains(err.Error(), "no key attribute sk") {
+		t.Errorf("WriteBatch() error = %v", err)
+	}
+}
+
+// TestCSVValues checks how each attribute type is rendered, with nested values
+// as plain JSON whose numbers keep their exact digits.
+func TestCSVValues(t *testing.T) {
+	tests := []struct {
+		v    types.AttributeValue
+		want string
+	}{
+		{nil, ""},
+		{&types.AttributeValueMemberNULL{Value: true}, ""},
+		{s("a,b\"c"), "a,b\"c"},
+		{n("12345678901234567890.123"), "12345678901234567890.123"},
+		{&types.AttributeValueMemberBOOL{Value: true}, "true"},
+		{&types.AttributeValueMemberB{Value: []byte{0xff, 0x00}}, "/wA="},
+		{&types.AttributeValueMemberNS{Value: []string{"1", "2.50"}}, "[1,2.50]"},
+		{&types.AttributeValueMemberL{Value: []types.AttributeValue{s("x"), &types.AttributeValueMemberNULL{Value: true}}}, `["x",null]`},
+		{&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{"n": n("1e3")}}, `{"n":1e3}`},
+	}
+	for _, tt := range tests {
+		if got, err := csvValue(tt.v); err != nil || got != tt.want {
+			t.Errorf("csvValue(%#v) = %q, %v; want %q", tt.v, got, err, tt.want)
+		}
+	}
+}
+
+type fakeS3 struct {
+	objects map[string]string
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	b, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[*params.Bucket+"/"+*params.Key] = string(b)
+	return &s3.PutObjectOutput{}, nil
+}
+
+// TestS3OutputUploadsFiles checks files are uploaded under the prefix, whether
+// or not it ends in a slash, and staged copies are removed.
+func TestS3OutputUploadsFiles(t *testing.T) {
+	client := &fakeS3{objects: map[string]string{}}
+	out, err := NewS3Output(client, "s3://athena-data/orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := NewTable([]string{"pk"}, "")
+	if err := table.WriteBatch(context.Background(), []itemimage.Operation{
+		{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"pk": s("a")}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := table.Close(context.Background(), out); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if got := client.objects["athena-data/orders/part-00000.csv"]; got != "pk\na\n" {
+		t.Errorf("uploaded %q", client.objects)
+	}
+	if staged, _ := filepath.Glob(filepath.Join(os.TempDir(), "ddb-pitr-materialize-*.csv")); len(staged) != 0 {
+		t.Errorf("staged files left behind: %v", staged)
+	}
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	json "github.com/goccy/go-json"
+)
+
+// EventSchemaVersion is the version of the Event schema. It is incremented only
+// on incompatible changes; new optional fields do not change it.
+const EventSchemaVersion = 1
+
+// EventType identifies what an Event reports.
+type EventType string
+
+// Event types emitted during a restore.
+const (
+	EventProgress     EventType = "progress"      // Periodic progress tick
+	EventCheckpoint   EventType = "checkpoint"    // Checkpoint saved
+	EventFileComplete EventType = "file_complete" // Data file fully processed
+	EventError        EventType = "error"         // Worker error, possibly retried
+	EventComplete     EventType = "complete"      // Restore finished; carries the final report
+)
+
+// Event is one machine-readable progress record. Fields that do not apply to a
+// type are omitted from the JSON encoding.
+// Example output:
+//
+//	{"time":"2024-01-01T00:00:05Z","worker":2,"offset":1048576,"type":"checkpoint","file":"AWSDynamoDB/.../data/a.json.gz","v":1}
+type Event struct {
+	Time          time.Time       `json:"time"`                    // When the event occurred (UTC)
+	Report        *Report         `json:"report,omitempty"`        // Final report (complete)
+	Worker        *int            `json:"worker,omitempty"`        // Worker ID (checkpoint, file_complete, error)
+	Offset        *int64          `json:"offset,omitempty"`        // Checkpointed offset; -1 marks a completed file (checkpoint)
+	Type          EventType       `json:"type"`                    // Event type
+	File          string          `json:"file,omitempty"`          // Data file key (checkpoint, file_complete, error)
+	Error         string          `json:"error,omitempty"`         // Error message (error)
+	ItemsWritten  int64           `json:"itemsWritten,omitempty"`  // Items written so far (progress)
+	Batches       int64           `json:"batches,omitempty"`       // Batches written so far (progress)
+	ActiveWorkers int             `json:"activeWorkers,omitempty"` // Workers active in the last 10s (progress)
+	Throttled     map[int]float64 `json:"throttled,omitempty"`     // Share of the last interval each throttled worker spent backing off, by worker ID (progress)
+	Version       int             `json:"v"`                       // EventSchemaVersion
+}
+
+// NewEvent creates an event of type t stamped with the current time and schema version.
+// Example:
+//
+//	ev := metrics.NewEvent(metrics.EventFileComplete)
+//	ev.File = file.Key
+//	emitter.Emit(ev)
+func NewEvent(t EventType) Event {
+	return Event{Time: time.Now().UTC(), Type: t, Version: EventSchemaVersion}
+}
+
+// NDJSONEmitter writes events as newline-delimited JSON. It is safe for concurrent
+// use; each event is written with a single Write call.
+// Example:
+//
+//	emitter := metrics.NewNDJSONEmitter(os.Stdout)
+//	emitter.Emit(metrics.NewEvent(metrics.EventProgress))
+type NDJSONEmitter struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// NewNDJSONEmitter creates an emitter writing to w.
+func NewNDJSONEmitter(w io.Writer) *NDJSONEmitter {
+	return &NDJSONEmitter{w: w}
+}
+
+// Emit writes ev as one JSON line. Write errors are ignored: progress output must
+// never fail a restore.
+func (e *NDJSONEmitter) Emit(ev Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		data = []byte(fmt.Sprintf(`{"v":%d,"type":"error","error":%q}`, EventSchemaVersion, err.Error()))
+	}
+	data = append(data, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, _ = e.w.Write(data)
+}
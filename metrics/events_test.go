@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	json "github.com/goccy/go-json"
+)
+
+// TestNDJSONEmitterSchema pins the wire format of events: one JSON object per
+// line, optional fields omitted, zero offsets and worker IDs kept. Wrappers parse
+// this output, so changes here are breaking.
+func TestNDJSONEmitterSchema(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewNDJSONEmitter(&buf)
+
+	worker := 0
+	offset := int64(0)
+	ev := NewEvent(EventCheckpoint)
+	ev.Worker = &worker
+	ev.Offset = &offset
+	ev.File = "data/a.json.gz"
+	e.Emit(ev)
+
+	report := NewMetrics().GenerateReport()
+	done := NewEvent(EventComplete)
+	done.Report = &report
+	e.Emit(done)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), buf.String())
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	want := map[string]any{"v": float64(EventSchemaVersion), "type": "checkpoint", "worker": float64(0), "offset": float64(0), "file": "data/a.json.gz"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("field %s = %v, want %v", k, got[k], v)
+		}
+	}
+	for _, k := range []string{"error", "report", "itemsWritten"} {
+		if _, ok := got[k]; ok {
+			t.Errorf("unexpected field %s in checkpoint event", k)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if r, ok := got["report"].(map[string]any); !ok || r["totalItems"] != float64(0) {
+		t.Errorf("expected embedded report, got %v", got["report"])
+	}
+}
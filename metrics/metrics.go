@@ -5,11 +5,17 @@ package metrics
 
 import (
 	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/buildinfo"
+	"github.com/gurre/ddb-pitr/clock"
 )
 
 // Metrics collects counters and histograms as defined in section 6 of the spec.
@@ -22,17 +28,94 @@ type Metrics struct {
 	batchesWritten   int64 // Number of batches written to DynamoDB
 	errors           int64 // Number of errors encountered
 	corruptCount     int64 // Number of corrupt records found
+	skippedCount     int64 // Number of records dropped by a filter or transformer
+	stallCount       int64 // Number of stalled file attempts cancelled by the watchdog
+	oversizedLines   int64 // Number of files failed by a line over the maximum line size
+	unchangedCount   int64 // Number of puts skipped because the target already held the item
+	retryCount       int64 // Number of requests the AWS SDK retried
+	throttleCount    int64 // Number of those retries that followed a throttling error
 
 	// Histograms for performance analysis
 	processingTime time.Duration // Total time spent processing records
 	startTime      time.Time     // When the restore operation started
+	clock          clock.Clock   // Time source for the start and end times
+
+	// Per-table counters of a fan-out restore, guarded by mu
+	targets map[string]*TargetReport
+
+	// Write capacity consumed per table and index, guarded by mu
+	capacity map[string]*CapacityReport
+
+	// Streams enabled on the target tables, guarded by mu
+	streams map[string]StreamReport
+
+	// How and on what the restore was run, guarded by mu; nil until set
+	run *RunReport
+
+	// First corrupt lines found, guarded by mu
+	corruptSamples []CorruptSample
+
+	// Connections of the AWS HTTP client, guarded by mu; nil until one is recorded
+	connections *ConnectionReport
+
+	// Status of every file started, guarded by mu
+	files map[string]*FileReport
+
+	// Items written per partition key prefix, guarded by mu
+	keyPrefixes       map[string]int64
+	keyPrefixOverflow int64 // Items whose prefix was first seen after maxKeyPrefixes were tracked
+
+	// When the priority files or items were restored, guarded by mu; zero until then
+	priorityComplete time.Time
+
+	// Run and backoff time of every worker that finished, guarded by mu
+	workers map[int]*WorkerReport
+
+	// Failed file attempts by category, guarded by mu
+	errorCategories map[string]*ErrorCategoryReport
+
+	// Items given up after staying unprocessed past the retry limit, by table, guarded by mu
+	unprocessed map[string]int64
+
+	// Item collections reported by the writers, by table and partition key, guarded by mu
+	collections map[[2]string]*ItemCollectionReport
+}
+
+// maxErrorSamples bounds the errors kept per category for the report.
+const maxErrorSamples = 3
+
+// maxCorruptSamples bounds the corrupt lines kept for the report.
+const maxCorruptSamples = 10
+
+// maxKeyPrefixes bounds the key prefixes counted, so a delimiter that occurs
+// in no key does not track every item.
+const maxKeyPrefixes = 10000
+
+// maxPrintedKeyPrefixes bounds the key prefixes listed by Report.String.
+const maxPrintedKeyPrefixes = 20
+
+// Option configures optional Metrics behavior.
+type Option func(*Metrics)
+
+// WithClock sets the time source for the report's start and end times and
+// throughput.
+// Example:
+//
+//	m := metrics.NewMetrics(metrics.WithClock(clock.NewFake(start)))
+func WithClock(c clock.Clock) Option {
+	return func(m *Metrics) {
+		m.clock = c
+	}
 }
 
 // NewMetrics creates a new Metrics instance with initialized counters
-func NewMetrics() *Metrics {
-	return &Metrics{
-		startTime: time.Now(),
+func NewMetrics(opts ...Option) *Metrics {
+	m := &Metrics{clock: clock.Real}
+	for _, opt := range opts {
+		opt(m)
 	}
+	m.startTime = m.clock.Now()
+	return m
 }
 
 // RecordProcessed increments the processed records counter
@@ -55,6 +138,223 @@ func (m *Metrics) RecordCorrupt() {
 	atomic.AddInt64(&m.corruptCount, 1)
 }
 
+// RecordCorruptLine counts a corrupt line like RecordCorrupt and keeps the first
+// few with their location and reason for the report.
+// Example:
+//
+//	m.RecordCorruptLine("AWSDynamoDB/01234-abcd/data/x7k2.json.gz", 4096, err)
+func (m *Metrics) RecordCorruptLine(file string, offset int64, reason error) {
+	atomic.AddInt64(&m.corruptCount, 1)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.corruptSamples) < maxCorruptSamples {
+		m.corruptSamples = append(m.corruptSamples, CorruptSample{File: file, Offset: offset, Reason: reason.Error()})
+	}
+}
+
+// CorruptLines returns the number of corrupt lines and of all lines decoded,
+// corrupt or skipped so far.
+func (m *Metrics) CorruptLines() (corrupt, total int64) {
+	corrupt = atomic.LoadInt64(&m.corruptCount)
+	return corrupt, corrupt + atomic.LoadInt64(&m.recordsProcessed) + atomic.LoadInt64(&m.skippedCount)
+}
+
+// RecordSkipped increments the skipped records counter
+func (m *Metrics) RecordSkipped() {
+	atomic.AddInt64(&m.skippedCount, 1)
+}
+
+// RecordUnchanged counts n puts skipped because the target already held their
+// item. It implements writer.UnchangedRecorder.
+func (m *Metrics) RecordUnchanged(n int64) {
+	atomic.AddInt64(&m.unchangedCount, n)
+}
+
+// RecordPriorityComplete records when the priority set of a restore, its
+// priority files or the items of its priority key prefix, was fully restored.
+// Example:
+//
+//	m.RecordPriorityComplete(time.Now())
+func (m *Metrics) RecordPriorityComplete(at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.priorityComplete = at
+}
+
+// RecordBackoff records that a worker ran for ran, of which it spent backoff
+// backing off from throttled and unprocessed writes.
+// Example:
+//
+//	m.RecordBackoff(3, timer.Total(), time.Since(start))
+func (m *Metrics) RecordBackoff(worker int, backoff, ran time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.workers == nil {
+		m.workers = make(map[int]*WorkerReport)
+	}
+	w, ok := m.workers[worker]
+	if !ok {
+		w = &WorkerReport{Worker: worker}
+		m.workers[worker] = w
+	}
+	w.RunTime += ran
+	w.BackoffTime += backoff
+}
+
+// RecordErrorCategory counts a failed file attempt under category, such as
+// "s3_read" or "write_throttling", keeping the first errors of each category
+// as samples.
+// Example:
+//
+//	m.RecordErrorCategory("checkpoint", err)
+func (m *Metrics) RecordErrorCategory(category string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.errorCategories == nil {
+		m.errorCategories = make(map[string]*ErrorCategoryReport)
+	}
+	c, ok := m.errorCategories[category]
+	if !ok {
+		c = &ErrorCategoryReport{Category: category}
+		m.errorCategories[category] = c
+	}
+	c.Count++
+	if len(c.Samples) < maxErrorSamples {
+		c.Samples = append(c.Samples, err.Error())
+	}
+}
+
+// RecordUnprocessedLimit counts items of table that DynamoDB left unprocessed
+// past the writer's retry limit, which were dead-lettered or failed their
+// batch. It implements writer.UnprocessedRecorder.
+func (m *Metrics) RecordUnprocessedLimit(table string, items int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.unprocessed == nil {
+		m.unprocessed = make(map[string]int64)
+	}
+	m.unprocessed[table] += int64(items)
+}
+
+// RecordItemCollection records that bytes were written to the item collection
+// of the partition key key of table. It implements writer.CollectionRecorder.
+func (m *Metrics) RecordItemCollection(table, key string, bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.collectionLocked(table, key)
+	c.Bytes = max(c.Bytes, bytes)
+}
+
+// RecordCollectionFull records that DynamoDB rejected the item collection of
+// the partition key key of table as full, and that skipped operations on it
+// were skipped. It implements writer.CollectionRecorder.
+func (m *Metrics) RecordCollectionFull(table, key string, skipped int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.collectionLocked(table, key)
+	c.Full = true
+	c.Skipped += int64(skipped)
+}
+
+// collectionLocked returns the report of an item collection, creating it.
+// The caller holds mu.
+func (m *Metrics) collectionLocked(table, key string) *ItemCollectionReport {
+	if m.collections == nil {
+		m.collections = make(map[[2]string]*ItemCollectionReport)
+	}
+	c, ok := m.collections[[2]string{table, key}]
+	if !ok {
+		c = &ItemCollectionReport{Table: table, Key: key}
+		m.collections[[2]string{table, key}] = c
+	}
+	return c
+}
+
+// RecordOversizedLine counts a file failed by a line over the maximum line size.
+func (m *Metrics) RecordOversizedLine() {
+	atomic.AddInt64(&m.oversizedLines, 1)
+}
+
+// RecordFileComplete marks file as fully restored.
+func (m *Metrics) RecordFileComplete(file string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f := m.fileLocked(file)
+	f.Status, f.Error = FileComplete, ""
+}
+
+// RecordFileFailed marks file as failed with err.
+// Example:
+//
+//	m.RecordFileFailed("AWSDynamoDB/01234-abcd/data/x7k2.json.gz", err)
+func (m *Metrics) RecordFileFailed(file string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f := m.fileLocked(file)
+	f.Status, f.Error = FileFailed, err.Error()
+}
+
+// RecordFileRequeued records that file failed every attempt of a worker with
+// err and was handed to the workers again.
+func (m *Metrics) RecordFileRequeued(file string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f := m.fileLocked(file)
+	f.Requeues++
+	f.Error = err.Error()
+}
+
+// RecordDeadLettered counts a line of file written to the dead-letter sink.
+func (m *Metrics) RecordDeadLettered(file string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fileLocked(file).DeadLettered++
+}
+
+// fileLocked returns the status of file, adding it if needed. m.mu must be held.
+func (m *Metrics) fileLocked(file string) *FileReport {
+	if m.files == nil {
+		m.files = make(map[string]*FileReport)
+	}
+	f, ok := m.files[file]
+	if !ok {
+		f = &FileReport{File: file}
+		m.files[file] = f
+	}
+	return f
+}
+
+// RecordKeyPrefixes adds the items written per partition key prefix. Items
+// of prefixes beyond the first maxKeyPrefixes are counted as overflow.
+func (m *Metrics) RecordKeyPrefixes(counts map[string]int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.keyPrefixes == nil {
+		m.keyPrefixes = make(map[string]int64)
+	}
+	for prefix, n := range counts {
+		if _, ok := m.keyPrefixes[prefix]; !ok && len(m.keyPrefixes) >= maxKeyPrefixes {
+			m.keyPrefixOverflow += n
+			continue
+		}
+		m.keyPrefixes[prefix] += n
+	}
+}
+
+// RecordStall increments the stalled workers counter
+func (m *Metrics) RecordStall() {
+	atomic.AddInt64(&m.stallCount, 1)
+}
+
+// RecordRetry counts a request the AWS SDK retried, and whether it was
+// throttled. It implements aws.RetryRecorder.
+func (m *Metrics) RecordRetry(throttled bool) {
+	atomic.AddInt64(&m.retryCount, 1)
+	if throttled {
+		atomic.AddInt64(&m.throttleCount, 1)
+	}
+}
+
 // RecordProcessingTime records the processing time for a batch
 func (m *Metrics) RecordProcessingTime(d time.Duration) {
 	m.mu.Lock()
@@ -62,21 +362,371 @@ func (m *Metrics) RecordProcessingTime(d time.Duration) {
 	m.processingTime += d
 }
 
+// RecordTargetWrite records a batch of items written to one target table of a
+// fan-out restore and the time the write took.
+func (m *Metrics) RecordTargetWrite(table string, items int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.target(table)
+	t.ItemsWritten += int64(items)
+	t.BatchesWritten++
+	t.WriteTime += d
+}
+
+// RecordTargetError records a failed batch write to one target table.
+func (m *Metrics) RecordTargetError(table string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.target(table).Errors++
+}
+
+// RecordConsumedCapacity adds the write capacity units one request consumed on
+// table itself and on each of its secondary indexes, keyed by index name.
+func (m *Metrics) RecordConsumedCapacity(table string, units float64, indexes map[string]float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.capacity == nil {
+		m.capacity = make(map[string]*CapacityReport)
+	}
+	c, ok := m.capacity[table]
+	if !ok {
+		c = &CapacityReport{Table: table}
+		m.capacity[table] = c
+	}
+	c.TableUnits += units
+	c.TotalUnits += units
+	for name, u := range indexes {
+		if c.Indexes == nil {
+			c.Indexes = make(map[string]float64)
+		}
+		c.Indexes[name] += u
+		c.TotalUnits += u
+	}
+}
+
+// RecordStream records the stream enabled on a target table before the
+// restore, so the report tells its consumers where to read from.
+func (m *Metrics) RecordStream(table, streamARN, viewType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.streams == nil {
+		m.streams = make(map[string]StreamReport)
+	}
+	m.streams[table] = StreamReport{Table: table, StreamARN: streamARN, ViewType: viewType}
+}
+
+// SetRun records how the restore was run, for the report. Exports recorded
+// before are kept.
+func (m *Metrics) SetRun(run RunReport) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.run != nil {
+		run.Exports = append(m.run.Exports, run.Exports...)
+	}
+	m.run = &run
+}
+
+// RecordExport records an export the restore applied, for the report. An
+// export already recorded is listed once, as when several passes apply it.
+func (m *Metrics) RecordExport(export ExportReport) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.run == nil {
+		m.run = &RunReport{}
+	}
+	if slices.Contains(m.run.Exports, export) {
+		return
+	}
+	m.run.Exports = append(m.run.Exports, export)
+}
+
+// RecordConnection counts a request's connection, whether it reused an idle
+// one, and how long the request waited for it. It implements aws.ConnRecorder.
+func (m *Metrics) RecordConnection(reused bool, wait time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.connectionReport()
+	if reused {
+		c.Reused++
+	} else {
+		c.Opened++
+	}
+	c.Wait += wait
+	c.MaxWait = max(c.MaxWait, wait)
+}
+
+// RecordDNSLookup counts a DNS lookup made to open a connection. It implements
+// aws.ConnRecorder.
+func (m *Metrics) RecordDNSLookup(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.connectionReport()
+	c.DNSLookups++
+	c.DNSTime += d
+}
+
+// connectionReport returns the connection counters, creating them if needed.
+// mu must be held.
+func (m *Metrics) connectionReport() *ConnectionReport {
+	if m.connections == nil {
+		m.connections = &ConnectionReport{}
+	}
+	return m.connections
+}
+
+// target returns the counters for table, creating them if needed. mu must be held.
+func (m *Metrics) target(table string) *TargetReport {
+	if m.targets == nil {
+		m.targets = make(map[string]*TargetReport)
+	}
+	t, ok := m.targets[table]
+	if !ok {
+		t = &TargetReport{Table: table}
+		m.targets[table] = t
+	}
+	return t
+}
+
+// TargetReport holds the write counters of one target table of a fan-out restore.
+type TargetReport struct {
+	Table          string        `json:"table"`          // Target table name
+	ItemsWritten   int64         `json:"itemsWritten"`   // Items written to the table
+	BatchesWritten int64         `json:"batchesWritten"` // Batches written to the table
+	Errors         int64         `json:"errors"`         // Failed batch writes, including ones that succeeded on retry
+	WriteTime      time.Duration `json:"writeTime"`      // Total time spent in successful writes
+}
+
+// MarshalJSON formats WriteTime as a duration string like Report.Duration.
+func (t TargetReport) MarshalJSON() ([]byte, error) {
+	type Alias TargetReport
+	return json.Marshal(&struct {
+		Alias
+		WriteTime string `json:"writeTime"`
+	}{
+		Alias:     Alias(t),
+		WriteTime: t.WriteTime.String(),
+	})
+}
+
+// WorkerReport holds how long one worker ran and how much of that it spent
+// backing off, so a restore limited by the table's capacity rather than by the
+// tool shows as workers that were mostly throttled.
+type WorkerReport struct {
+	Worker      int           `json:"worker"`      // Worker ID
+	RunTime     time.Duration `json:"runTime"`     // Time the worker ran
+	BackoffTime time.Duration `json:"backoffTime"` // Time the worker's writes backed off from throttling
+}
+
+// Throttled returns the share of the worker's run time spent backing off.
+func (w WorkerReport) Throttled() float64 {
+	if w.RunTime <= 0 {
+		return 0
+	}
+	return min(float64(w.BackoffTime)/float64(w.RunTime), 1)
+}
+
+// MarshalJSON formats the durations as strings like Report.Duration.
+func (w WorkerReport) MarshalJSON() ([]byte, error) {
+	type Alias WorkerReport
+	return json.Marshal(&struct {
+		Alias
+		RunTime     string `json:"runTime"`
+		BackoffTime string `json:"backoffTime"`
+	}{
+		Alias:       Alias(w),
+		RunTime:     w.RunTime.String(),
+		BackoffTime: w.BackoffTime.String(),
+	})
+}
+
+// ErrorCategoryReport counts the failed file attempts of one category, with
+// the first of their errors as samples, so a post-mortem starts from what
+// failed most rather than from a list of every error.
+type ErrorCategoryReport struct {
+	Category string   `json:"category"` // Stage that failed, e.g. s3_read, decode, write_throttling, write or checkpoint
+	Count    int64    `json:"count"`    // Failed attempts, including ones that succeeded on retry
+	Samples  []string `json:"samples"`  // First errors of the category
+}
+
+// CapacityReport holds the write capacity units a restore consumed on one table,
+// for reconciling the restore against the bill.
+type CapacityReport struct {
+	Table      string             `json:"table"`             // Table name
+	TotalUnits float64            `json:"totalUnits"`        // Units consumed on the table and all its indexes
+	TableUnits float64            `json:"tableUnits"`        // Units consumed on the base table
+	Indexes    map[string]float64 `json:"indexes,omitempty"` // Units consumed per secondary index
+}
+
+// RunReport records how a restore was run, so it can be audited and repeated
+// from its report alone.
+type RunReport struct {
+	Build     buildinfo.Info `json:"build"`               // Build of ddb-pitr
+	RunID     string         `json:"runId,omitempty"`     // ID given with -run-id
+	AccountID string         `json:"accountId,omitempty"` // AWS account of the credentials; empty if unknown
+	CallerARN string         `json:"callerArn,omitempty"` // Identity of the credentials; empty if unknown
+	Region    string         `json:"region"`              // AWS region of the target tables
+	Exports   []ExportReport `json:"exports,omitempty"`   // Exports applied, in order
+	Config    map[string]any `json:"config,omitempty"`    // Flags set, by config field name, with credentials redacted
+}
+
+// ExportReport identifies an export a restore applied.
+type ExportReport struct {
+	ExportARN      string `json:"exportArn,omitempty"`      // ARN of the export; empty without a DynamoDB manifest
+	TableARN       string `json:"tableArn,omitempty"`       // Exported table
+	ExportType     string `json:"exportType"`               // FULL or INCREMENTAL
+	ExportTime     string `json:"exportTime,omitempty"`     // Time a full export reflects
+	ExportFromTime string `json:"exportFromTime,omitempty"` // Start of an incremental export
+	ExportToTime   string `json:"exportToTime,omitempty"`   // End of an incremental export
+	S3Bucket       string `json:"s3Bucket"`                 // Bucket holding the export
+	S3Prefix       string `json:"s3Prefix,omitempty"`       // Prefix of the export in S3Bucket
+	ItemCount      int64  `json:"itemCount,omitempty"`      // Items in the export, per its manifest
+}
+
+// StreamReport is the stream enabled on a target table.
+type StreamReport struct {
+	Table     string `json:"table"`     // Table name
+	StreamARN string `json:"streamArn"` // ARN of the table's latest stream
+	ViewType  string `json:"viewType"`  // NEW_IMAGE, OLD_IMAGE, NEW_AND_OLD_IMAGES or KEYS_ONLY
+}
+
+// ConnectionReport describes how the AWS requests of a restore got their
+// connections. Many opened connections or long waits under high concurrency
+// point at too few idle connections or requests queueing behind slow ones.
+type ConnectionReport struct {
+	Opened     int64         `json:"opened"`     // Requests that opened a new connection
+	Reused     int64         `json:"reused"`     // Requests that reused an idle connection
+	Wait       time.Duration `json:"wait"`       // Total time requests waited for a connection
+	MaxWait    time.Duration `json:"maxWait"`    // Longest wait of one request
+	DNSLookups int64         `json:"dnsLookups"` // DNS lookups made to open connections
+	DNSTime    time.Duration `json:"dnsTime"`    // Total time spent in DNS lookups
+}
+
+// MarshalJSON formats the durations as strings like Report.Duration.
+func (c ConnectionReport) MarshalJSON() ([]byte, error) {
+	type Alias ConnectionReport
+	return json.Marshal(&struct {
+		Alias
+		Wait    string `json:"wait"`
+		MaxWait string `json:"maxWait"`
+		DNSTime string `json:"dnsTime"`
+	}{
+		Alias:   Alias(c),
+		Wait:    c.Wait.String(),
+		MaxWait: c.MaxWait.String(),
+		DNSTime: c.DNSTime.String(),
+	})
+}
+
+// CorruptSample locates a corrupt line and says why it could not be decoded.
+type CorruptSample struct {
+	File   string `json:"file"`   // Data file holding the line
+	Offset int64  `json:"offset"` // Offset of the line in the decompressed file
+	Reason string `json:"reason"` // Decode error
+}
+
+// Statuses of a FileReport.
+const (
+	FileComplete = "complete" // Every line was restored, dead-lettered or skipped
+	FileFailed   = "failed"   // The file failed; lines after its last checkpoint were not restored
+)
+
+// FileReport holds the outcome of one data file.
+type FileReport struct {
+	File         string `json:"file"`                   // Data file
+	Status       string `json:"status"`                 // FileComplete or FileFailed; empty while restoring
+	DeadLettered int64  `json:"deadLettered,omitempty"` // Lines written to the dead-letter sink
+	Requeues     int    `json:"requeues,omitempty"`     // Times the file failed every attempt of a worker and was handed out again
+	Error        string `json:"error,omitempty"`        // Why the file failed; while requeued, why it last failed
+}
+
+// NeedsRepair reports whether the file did not complete or dead-lettered
+// lines, so restoring it again may restore items the run did not.
+func (f FileReport) NeedsRepair() bool {
+	return f.Status != FileComplete || f.DeadLettered > 0
+}
+
+// LoadFileReports reads the file statuses of a JSON report written by an
+// earlier run.
+// Example:
+//
+//	files, err := metrics.LoadFileReports(f)
+//	for _, file := range files {
+//	    if file.NeedsRepair() {
+//	        fmt.Println(file.File)
+//	    }
+//	}
+func LoadFileReports(r io.Reader) ([]FileReport, error) {
+	var report struct {
+		Files []FileReport `json:"files"`
+	}
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to decode report: %w", err)
+	}
+	return report.Files, nil
+}
+
+// KeyPrefixReport holds the items written with one partition key prefix.
+type KeyPrefixReport struct {
+	Prefix string `json:"prefix"` // Partition key up to its first delimiter
+	Items  int64  `json:"items"`  // Items written with the prefix
+}
+
 // Report contains the final metrics report as defined in section 6 of the spec.
 // It includes all required fields for the JSON report output.
 type Report struct {
-	StartTime    time.Time     `json:"startTime"`    // When the restore operation started
-	EndTime      time.Time     `json:"endTime"`      // When the restore operation completed
-	TotalItems   int64         `json:"totalItems"`   // Total number of items processed
-	CorruptCount int64         `json:"corruptCount"` // Number of corrupt items found
-	Duration     time.Duration `json:"duration"`     // Total duration of the operation
-	Throughput   float64       `json:"throughput"`   // Items processed per second
+	StartTime    time.Time     `json:"startTime"`      // When the restore operation started
+	EndTime      time.Time     `json:"endTime"`        // When the restore operation completed
+	TotalItems   int64         `json:"totalItems"`     // Total number of items processed
+	CorruptCount int64         `json:"corruptCount"`   // Number of corrupt items found
+	SkippedCount int64         `json:"skippedCount"`   // Number of items dropped by a filter or transformer
+	StallCount   int64         `json:"stallCount"`     // Number of stalled file attempts that were restarted
+	Oversized    int64         `json:"oversizedLines"` // Number of files failed by a line over the maximum line size
+	Unchanged    int64         `json:"unchangedItems"` // Number of puts skipped because the target already held the item
+	RetryCount   int64         `json:"retryCount"`     // Number of requests the AWS SDK retried
+	Throttles    int64         `json:"throttles"`      // Number of those retries that followed a throttling error
+	Duration     time.Duration `json:"duration"`       // Total duration of the operation
+	Throughput   float64       `json:"throughput"`     // Items processed per second
+
+	Targets  []TargetReport   `json:"targets,omitempty"`          // Per-table counters of a fan-out restore, by table name
+	Capacity []CapacityReport `json:"consumedCapacity,omitempty"` // Write capacity consumed per table, by table name
+	Streams  []StreamReport   `json:"streams,omitempty"`          // Streams enabled on the target tables, by table name
+
+	Connections *ConnectionReport `json:"connections,omitempty"` // Connections of the AWS HTTP client, when traced
+
+	Run *RunReport `json:"run,omitempty"` // Version, identity, exports and config of the restore, when set
+
+	CorruptSamples []CorruptSample `json:"corruptSamples,omitempty"` // First corrupt lines, in the order found
+
+	Files []FileReport `json:"files,omitempty"` // Status of every file started, by file name
+
+	KeyPrefixes       []KeyPrefixReport `json:"keyPrefixes,omitempty"`       // Items written per partition key prefix, by prefix
+	KeyPrefixOverflow int64             `json:"keyPrefixOverflow,omitempty"` // Items of prefixes not counted, beyond the tracked limit
+
+	PriorityComplete *time.Time `json:"priorityCompleteTime,omitempty"` // When the priority files or items were restored, if any
+
+	Workers []WorkerReport `json:"workers,omitempty"` // Run and backoff time of every worker, by worker ID
+
+	ErrorCategories []ErrorCategoryReport `json:"errorCategories,omitempty"` // Failed file attempts by category, most frequent first
+
+	Unprocessed map[string]int64 `json:"unprocessedGivenUp,omitempty"` // Items left unprocessed past the retry limit, by table
+
+	ItemCollections []ItemCollectionReport `json:"itemCollections,omitempty"` // Large and full item collections, largest first
+}
+
+// ItemCollectionReport describes the item collection of one partition key of a
+// table with local secondary indexes, once it grew past a GiB or was full.
+type ItemCollectionReport struct {
+	Table   string `json:"table"`             // Table holding the collection
+	Key     string `json:"key"`               // Partition key value; binaries in base64
+	Bytes   int64  `json:"bytes"`             // Bytes of the items written to it, when last reported
+	Full    bool   `json:"full,omitempty"`    // Whether DynamoDB rejected a write as over the 10 GB limit
+	Skipped int64  `json:"skipped,omitempty"` // Operations on the key skipped once it was full
 }
 
 // GenerateReport generates a final report as specified in section 6.
 // It calculates all metrics and returns a Report struct ready for JSON output.
 func (m *Metrics) GenerateReport() Report {
-	endTime := time.Now()
+	endTime := m.clock.Now()
 	duration := endTime.Sub(m.startTime)
 
 	// Calculate throughput (items per second)
@@ -85,13 +735,127 @@ func (m *Metrics) GenerateReport() Report {
 		throughput = float64(atomic.LoadInt64(&m.recordsProcessed)) / duration.Seconds()
 	}
 
+	m.mu.RLock()
+	var targets []TargetReport
+	for _, t := range m.targets {
+		targets = append(targets, *t)
+	}
+	var capacity []CapacityReport
+	for _, c := range m.capacity {
+		report := *c
+		if c.Indexes != nil {
+			report.Indexes = make(map[string]float64, len(c.Indexes))
+			for name, u := range c.Indexes {
+				report.Indexes[name] = u
+			}
+		}
+		capacity = append(capacity, report)
+	}
+	var run *RunReport
+	if m.run != nil {
+		r := *m.run
+		r.Exports = append([]ExportReport(nil), m.run.Exports...)
+		run = &r
+	}
+	var streams []StreamReport
+	for _, st := range m.streams {
+		streams = append(streams, st)
+	}
+	corruptSamples := append([]CorruptSample(nil), m.corruptSamples...)
+	var connections *ConnectionReport
+	if m.connections != nil {
+		c := *m.connections
+		connections = &c
+	}
+	var files []FileReport
+	for _, f := range m.files {
+		files = append(files, *f)
+	}
+	var keyPrefixes []KeyPrefixReport
+	for prefix, n := range m.keyPrefixes {
+		keyPrefixes = append(keyPrefixes, KeyPrefixReport{Prefix: prefix, Items: n})
+	}
+	keyPrefixOverflow := m.keyPrefixOverflow
+	var priorityComplete *time.Time
+	if !m.priorityComplete.IsZero() {
+		at := m.priorityComplete
+		priorityComplete = &at
+	}
+	var workers []WorkerReport
+	for _, w := range m.workers {
+		workers = append(workers, *w)
+	}
+	var errorCategories []ErrorCategoryReport
+	for _, c := range m.errorCategories {
+		report := *c
+		report.Samples = append([]string(nil), c.Samples...)
+		errorCategories = append(errorCategories, report)
+	}
+	var unprocessed map[string]int64
+	if len(m.unprocessed) > 0 {
+		unprocessed = maps.Clone(m.unprocessed)
+	}
+	var collections []ItemCollectionReport
+	for _, c := range m.collections {
+		collections = append(collections, *c)
+	}
+	m.mu.RUnlock()
+	sort.Slice(collections, func(i, j int) bool {
+		if collections[i].Bytes != collections[j].Bytes {
+			return collections[i].Bytes > collections[j].Bytes
+		}
+		if collections[i].Table != collections[j].Table {
+			return collections[i].Table < collections[j].Table
+		}
+		return collections[i].Key < collections[j].Key
+	})
+	sort.Slice(errorCategories, func(i, j int) bool {
+		if errorCategories[i].Count != errorCategories[j].Count {
+			return errorCategories[i].Count > errorCategories[j].Count
+		}
+		return errorCategories[i].Category < errorCategories[j].Category
+	})
+	sort.Slice(workers, func(i, j int) bool { return workers[i].Worker < workers[j].Worker })
+	sort.Slice(files, func(i, j int) bool { return files[i].File < files[j].File })
+	sort.Slice(keyPrefixes, func(i, j int) bool { return keyPrefixes[i].Prefix < keyPrefixes[j].Prefix })
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Table < targets[j].Table })
+	sort.Slice(capacity, func(i, j int) bool { return capacity[i].Table < capacity[j].Table })
+	sort.Slice(streams, func(i, j int) bool { return streams[i].Table < streams[j].Table })
+
 	return Report{
 		StartTime:    m.startTime,
 		EndTime:      endTime,
 		TotalItems:   atomic.LoadInt64(&m.recordsProcessed),
 		CorruptCount: atomic.LoadInt64(&m.corruptCount),
+		SkippedCount: atomic.LoadInt64(&m.skippedCount),
+		StallCount:   atomic.LoadInt64(&m.stallCount),
+		Oversized:    atomic.LoadInt64(&m.oversizedLines),
+		Unchanged:    atomic.LoadInt64(&m.unchangedCount),
+		RetryCount:   atomic.LoadInt64(&m.retryCount),
+		Throttles:    atomic.LoadInt64(&m.throttleCount),
 		Duration:     duration,
 		Throughput:   throughput,
+		Targets:      targets,
+		Capacity:     capacity,
+		Streams:      streams,
+
+		Connections:    connections,
+		Run:            run,
+		CorruptSamples: corruptSamples,
+		Files:          files,
+
+		KeyPrefixes:       keyPrefixes,
+		KeyPrefixOverflow: keyPrefixOverflow,
+
+		PriorityComplete: priorityComplete,
+
+		Workers: workers,
+
+		ErrorCategories: errorCategories,
+
+		Unprocessed: unprocessed,
+
+		ItemCollections: collections,
 	}
 }
 
@@ -111,14 +875,111 @@ func (r Report) MarshalJSON() ([]byte, error) {
 // String returns a human-readable string representation of the report
 // as specified in section 6 for console output.
 func (r Report) String() string {
-	return fmt.Sprintf(
+	s := fmt.Sprintf(
 		"Restore completed in %s\n"+
 			"Total items: %d\n"+
 			"Corrupt items: %d\n"+
+			"Skipped items: %d\n"+
+			"Stalled workers: %d\n"+
+			"Retried requests: %d (%d throttled)\n"+
 			"Throughput: %.2f items/sec",
 		r.Duration,
 		r.TotalItems,
 		r.CorruptCount,
+		r.SkippedCount,
+		r.StallCount,
+		r.RetryCount,
+		r.Throttles,
 		r.Throughput,
 	)
+	if r.Oversized > 0 {
+		s += fmt.Sprintf("\nFiles with oversized lines: %d", r.Oversized)
+	}
+	if r.Unchanged > 0 {
+		s += fmt.Sprintf("\nUnchanged items not written: %d", r.Unchanged)
+	}
+	if r.PriorityComplete != nil {
+		s += fmt.Sprintf("\nPriority set restored at %s", r.PriorityComplete.Format(time.RFC3339))
+	}
+	var ran, backoff time.Duration
+	for _, w := range r.Workers {
+		ran += w.RunTime
+		backoff += w.BackoffTime
+	}
+	if backoff > 0 {
+		s += fmt.Sprintf("\nBacked off from throttling: %s, %.0f%% of worker time", backoff.Round(time.Millisecond), 100*float64(backoff)/float64(ran))
+		for _, w := range r.Workers {
+			if w.BackoffTime > 0 {
+				s += fmt.Sprintf("\n  worker %d: %.0f%% time throttled", w.Worker, 100*w.Throttled())
+			}
+		}
+	}
+	for _, c := range r.ErrorCategories {
+		s += fmt.Sprintf("\nFailed attempts (%s): %d, e.g. %s", c.Category, c.Count, c.Samples[0])
+	}
+	tables := make([]string, 0, len(r.Unprocessed))
+	for table := range r.Unprocessed {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, c := range r.ItemCollections {
+		if c.Full {
+			s += fmt.Sprintf("\nWarning: item collection %q on %s is full at the 10 GB limit, %d operations skipped", c.Key, c.Table, c.Skipped)
+		} else {
+			s += fmt.Sprintf("\nItem collection %q on %s: %.1f GiB written", c.Key, c.Table, float64(c.Bytes)/(1<<30))
+		}
+	}
+	for _, table := range tables {
+		s += fmt.Sprintf("\nWarning: %d items on %s stayed unprocessed past the retry limit and were dead-lettered or failed their batch",
+			r.Unprocessed[table], table)
+	}
+	var repair int
+	for _, f := range r.Files {
+		if f.NeedsRepair() {
+			repair++
+		}
+	}
+	if repair > 0 {
+		s += fmt.Sprintf("\nFiles needing repair: %d of %d", repair, len(r.Files))
+	}
+	for _, t := range r.Targets {
+		s += fmt.Sprintf("\nTable %s: %d items in %d batches, %d write errors, %s writing",
+			t.Table, t.ItemsWritten, t.BatchesWritten, t.Errors, t.WriteTime.Round(time.Millisecond))
+	}
+	for _, c := range r.Capacity {
+		s += fmt.Sprintf("\nConsumed capacity on %s: %.1f WCU (table %.1f", c.Table, c.TotalUnits, c.TableUnits)
+		names := make([]string, 0, len(c.Indexes))
+		for name := range c.Indexes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			s += fmt.Sprintf(", %s %.1f", name, c.Indexes[name])
+		}
+		s += ")"
+	}
+	for _, st := range r.Streams {
+		s += fmt.Sprintf("\nStream of %s (%s): %s", st.Table, st.ViewType, st.StreamARN)
+	}
+	if c := r.Connections; c != nil {
+		s += fmt.Sprintf("\nConnections: %d opened, %d reused, %s waiting (max %s), %d DNS lookups in %s",
+			c.Opened, c.Reused, c.Wait.Round(time.Millisecond), c.MaxWait.Round(time.Millisecond),
+			c.DNSLookups, c.DNSTime.Round(time.Millisecond))
+	}
+	for _, c := range r.CorruptSamples {
+		s += fmt.Sprintf("\nCorrupt line at %s@%d: %s", c.File, c.Offset, c.Reason)
+	}
+	if len(r.KeyPrefixes) > 0 {
+		s += fmt.Sprintf("\nItems by key prefix (%d prefixes):", len(r.KeyPrefixes))
+		for _, p := range r.KeyPrefixes[:min(len(r.KeyPrefixes), maxPrintedKeyPrefixes)] {
+			s += fmt.Sprintf("\n  %q: %d", p.Prefix, p.Items)
+		}
+		if n := len(r.KeyPrefixes) - maxPrintedKeyPrefixes; n > 0 {
+			s += fmt.Sprintf("\n  and %d more prefixes in the JSON report", n)
+		}
+		if r.KeyPrefixOverflow > 0 {
+			s += fmt.Sprintf("\n  %d items of further prefixes not counted", r.KeyPrefixOverflow)
+		}
+	}
+	return s
 }
@@ -1,8 +1,16 @@
 package metrics
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/buildinfo"
+	"github.com/gurre/ddb-pitr/clock"
 )
 
 func TestMetricsHappyPath(t *testing.T) {
@@ -41,3 +49,438 @@ func TestMetricsHappyPath(t *testing.T) {
 		t.Error("expected non-empty string representation")
 	}
 }
+
+// TestTargetMetrics verifies per-table counters are reported by table name and
+// left out of reports for single-table restores.
+func TestTargetMetrics(t *testing.T) {
+	m := NewMetrics()
+	if report := m.GenerateReport(); report.Targets != nil {
+		t.Errorf("expected no target counters, got %v", report.Targets)
+	}
+
+	m.RecordTargetWrite("staging", 25, 10*time.Millisecond)
+	m.RecordTargetWrite("prod-shadow", 25, 20*time.Millisecond)
+	m.RecordTargetWrite("staging", 5, 5*time.Millisecond)
+	m.RecordTargetError("staging")
+
+	report := m.GenerateReport()
+	if len(report.Targets) != 2 || report.Targets[0].Table != "prod-shadow" {
+		t.Fatalf("expected two targets sorted by name, got %v", report.Targets)
+	}
+	staging := report.Targets[1]
+	if staging.ItemsWritten != 30 || staging.BatchesWritten != 2 || staging.Errors != 1 || staging.WriteTime != 15*time.Millisecond {
+		t.Errorf("unexpected staging counters %+v", staging)
+	}
+	if !strings.Contains(report.String(), "Table staging: 30 items in 2 batches, 1 write errors") {
+		t.Errorf("expected per-table line in %q", report.String())
+	}
+
+	data, err := staging.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON: %v", err)
+	}
+	if !strings.Contains(string(data), `"writeTime":"15ms"`) {
+		t.Errorf("expected duration string in %s", data)
+	}
+}
+
+// TestConsumedCapacity verifies capacity is summed per table and per index so the
+// report can be reconciled against the bill, and left out when none was recorded.
+func TestConsumedCapacity(t *testing.T) {
+	m := NewMetrics()
+	if report := m.GenerateReport(); report.Capacity != nil {
+		t.Errorf("expected no capacity, got %v", report.Capacity)
+	}
+
+	m.RecordConsumedCapacity("orders", 25, map[string]float64{"by-customer": 25, "by-date": 10})
+	m.RecordConsumedCapacity("orders", 5, map[string]float64{"by-customer": 5})
+	m.RecordConsumedCapacity("audit", 2, nil)
+
+	report := m.GenerateReport()
+	if len(report.Capacity) != 2 || report.Capacity[0].Table != "audit" {
+		t.Fatalf("expected two tables sorted by name, got %v", report.Capacity)
+	}
+	orders := report.Capacity[1]
+	if orders.TableUnits != 30 || orders.TotalUnits != 70 || orders.Indexes["by-customer"] != 30 || orders.Indexes["by-date"] != 10 {
+		t.Errorf("unexpected orders capacity %+v", orders)
+	}
+	if !strings.Contains(report.String(), "Consumed capacity on orders: 70.0 WCU (table 30.0, by-customer 30.0, by-date 10.0)") {
+		t.Errorf("expected capacity line in %q", report.String())
+	}
+
+	data, err := report.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON: %v", err)
+	}
+	if !strings.Contains(string(data), `"consumedCapacity":[{"table":"audit","totalUnits":2,"tableUnits":2}`) {
+		t.Errorf("expected consumedCapacity in %s", data)
+	}
+}
+
+// TestStreams verifies the streams enabled on the target tables are listed in
+// the report with their ARNs, so consumers can be pointed at them after a DR
+// restore.
+func TestStreams(t *testing.T) {
+	m := NewMetrics()
+	m.RecordStream("orders", "arn:aws:dynamodb:us-west-2:123456789012:table/orders/stream/2024-05-01T12:00:00.000", "NEW_AND_OLD_IMAGES")
+	m.RecordStream("audit", "arn:aws:dynamodb:us-west-2:123456789012:table/audit/stream/2024-05-01T12:00:00.000", "KEYS_ONLY")
+
+	report := m.GenerateReport()
+	if len(report.Streams) != 2 || report.Streams[0].Table != "audit" {
+		t.Fatalf("expected two streams sorted by table, got %v", report.Streams)
+	}
+	if !strings.Contains(report.String(), "Stream of orders (NEW_AND_OLD_IMAGES): arn:aws:dynamodb:us-west-2:123456789012:table/orders/stream/") {
+		t.Errorf("expected stream line in %q", report.String())
+	}
+	data, err := report.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON: %v", err)
+	}
+	if !strings.Contains(string(data), `"streams":[{"table":"audit","streamArn":"arn:aws:dynamodb:us-west-2:123456789012:table/audit/stream/2024-05-01T12:00:00.000","viewType":"KEYS_ONLY"}`) {
+		t.Errorf("expected streams in %s", data)
+	}
+}
+
+// TestRunReport verifies the run and the exports recorded by the summary hook
+// are reported together, whichever is recorded first, so the report alone tells
+// what was restored from where.
+func TestRunReport(t *testing.T) {
+	m := NewMetrics()
+	if report := m.GenerateReport(); report.Run != nil {
+		t.Errorf("expected no run, got %+v", report.Run)
+	}
+
+	m.RecordExport(ExportReport{ExportARN: "arn:aws:dynamodb:us-west-2:123456789012:table/orders/export/01", ExportType: "FULL", S3Bucket: "exports"})
+	m.SetRun(RunReport{Build: buildinfo.Info{Version: "v1.4.0", GoVersion: "go1.24.2"}, Region: "us-west-2", Config: map[string]any{"TableName": "orders"}})
+	m.RecordExport(ExportReport{ExportARN: "arn:aws:dynamodb:us-west-2:123456789012:table/orders/export/02", ExportType: "INCREMENTAL", S3Bucket: "exports"})
+
+	report := m.GenerateReport()
+	if report.Run == nil || report.Run.Build.Version != "v1.4.0" || len(report.Run.Exports) != 2 || report.Run.Exports[1].ExportType != "INCREMENTAL" {
+		t.Fatalf("unexpected run %+v", report.Run)
+	}
+	data, err := report.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON: %v", err)
+	}
+	if !strings.Contains(string(data), `"run":{"build":{"version":"v1.4.0","goVersion":"go1.24.2"},"region":"us-west-2","exports":[{"exportArn":"arn:aws:dynamodb:us-west-2:123456789012:table/orders/export/01","exportType":"FULL","s3Bucket":"exports"}`) {
+		t.Errorf("expected run in %s", data)
+	}
+}
+
+// TestRecordExportListsExportOnce verifies an export recorded by each pass of a
+// priority restore is listed once, so the report does not claim it was applied
+// twice.
+func TestRecordExportListsExportOnce(t *testing.T) {
+	m := NewMetrics()
+	export := ExportReport{ExportARN: "arn:aws:dynamodb:us-west-2:123456789012:table/orders/export/01", ExportType: "FULL", S3Bucket: "exports"}
+	m.RecordExport(export)
+	m.RecordExport(export)
+	if report := m.GenerateReport(); len(report.Run.Exports) != 1 {
+		t.Errorf("expected the export listed once, got %+v", report.Run.Exports)
+	}
+}
+
+// TestMetricsUseClock verifies the report's times and throughput come from the
+// injected clock, so they can be asserted exactly.
+func TestMetricsUseClock(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	clk := clock.NewFake(start)
+	m := NewMetrics(WithClock(clk))
+	for i := 0; i < 100; i++ {
+		m.RecordProcessed()
+	}
+	clk.Advance(4 * time.Second)
+
+	report := m.GenerateReport()
+	if !report.StartTime.Equal(start) || !report.EndTime.Equal(start.Add(4*time.Second)) {
+		t.Errorf("unexpected times %v to %v", report.StartTime, report.EndTime)
+	}
+	if report.Duration != 4*time.Second || report.Throughput != 25 {
+		t.Errorf("expected 25 items/sec over 4s, got %.2f over %s", report.Throughput, report.Duration)
+	}
+}
+
+// TestCorruptSamples checks corrupt lines are counted and the first few are
+// reported with their location, so a run with many bad lines stays readable.
+func TestCorruptSamples(t *testing.T) {
+	m := NewMetrics()
+	for i := range maxCorruptSamples + 5 {
+		m.RecordCorruptLine("data/a.json.gz", int64(i*100), errors.New("invalid number \"1e999\""))
+	}
+	report := m.GenerateReport()
+	if report.CorruptCount != maxCorruptSamples+5 {
+		t.Errorf("CorruptCount = %d, want %d", report.CorruptCount, maxCorruptSamples+5)
+	}
+	if len(report.CorruptSamples) != maxCorruptSamples {
+		t.Fatalf("got %d samples, want %d", len(report.CorruptSamples), maxCorruptSamples)
+	}
+	if s := report.CorruptSamples[1]; s.File != "data/a.json.gz" || s.Offset != 100 {
+		t.Errorf("sample = %+v, want data/a.json.gz@100", s)
+	}
+	if !strings.Contains(report.String(), `Corrupt line at data/a.json.gz@0: invalid number "1e999"`) {
+		t.Errorf("report does not list the corrupt line:\n%s", report.String())
+	}
+}
+
+// TestRetries verifies SDK retries are counted with their throttled share and
+// shown in both report formats.
+func TestRetries(t *testing.T) {
+	m := NewMetrics()
+	m.RecordRetry(true)
+	m.RecordRetry(false)
+	m.RecordRetry(true)
+
+	report := m.GenerateReport()
+	if report.RetryCount != 3 || report.Throttles != 2 {
+		t.Errorf("expected 3 retries, 2 throttled, got %d and %d", report.RetryCount, report.Throttles)
+	}
+	if !strings.Contains(report.String(), "Retried requests: 3 (2 throttled)") {
+		t.Errorf("expected retry line in %q", report.String())
+	}
+	data, err := report.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON: %v", err)
+	}
+	if !strings.Contains(string(data), `"retryCount":3,"throttles":2`) {
+		t.Errorf("expected retry counts in %s", data)
+	}
+}
+
+// TestUnchanged verifies puts skipped as unchanged are summed and only shown in
+// the text report when there were any.
+func TestUnchanged(t *testing.T) {
+	m := NewMetrics()
+	if strings.Contains(m.GenerateReport().String(), "Unchanged") {
+		t.Error("expected no unchanged line without skipped puts")
+	}
+	m.RecordUnchanged(20)
+	m.RecordUnchanged(5)
+
+	report := m.GenerateReport()
+	if report.Unchanged != 25 {
+		t.Errorf("expected 25 unchanged items, got %d", report.Unchanged)
+	}
+	if !strings.Contains(report.String(), "Unchanged items not written: 25") {
+		t.Errorf("expected unchanged line in %q", report.String())
+	}
+}
+
+// TestPriorityComplete verifies the time the priority set was restored is
+// reported only once recorded, in the JSON report and its text.
+func TestPriorityComplete(t *testing.T) {
+	m := NewMetrics()
+	if report := m.GenerateReport(); report.PriorityComplete != nil || strings.Contains(report.String(), "Priority") {
+		t.Errorf("expected no priority completion, got %v", report.PriorityComplete)
+	}
+	at := time.Date(2026, 10, 15, 8, 30, 0, 0, time.UTC)
+	m.RecordPriorityComplete(at)
+
+	report := m.GenerateReport()
+	if report.PriorityComplete == nil || !report.PriorityComplete.Equal(at) {
+		t.Errorf("expected priority completion at %s, got %v", at, report.PriorityComplete)
+	}
+	if !strings.Contains(report.String(), "Priority set restored at 2026-10-15T08:30:00Z") {
+		t.Errorf("expected priority line in %q", report.String())
+	}
+	data, err := json.Marshal(report)
+	if err != nil || !strings.Contains(string(data), `"priorityCompleteTime":"2026-10-15T08:30:00Z"`) {
+		t.Errorf("expected priorityCompleteTime in %s (%v)", data, err)
+	}
+}
+
+// TestWorkerBackoff verifies each worker's backoff is reported with its share
+// of the worker's run time, and that the text report only lists throttled
+// workers and is silent when none were.
+func TestWorkerBackoff(t *testing.T) {
+	m := NewMetrics()
+	m.RecordBackoff(1, 0, 10*time.Second)
+	if s := m.GenerateReport().String(); strings.Contains(s, "Backed off") {
+		t.Errorf("expected no backoff lines without backoff, got %q", s)
+	}
+
+	m.RecordBackoff(3, 6*time.Second, 10*time.Second)
+	report := m.GenerateReport()
+	if len(report.Workers) != 2 || report.Workers[1].Worker != 3 || report.Workers[1].Throttled() != 0.6 {
+		t.Fatalf("unexpected workers: %+v", report.Workers)
+	}
+	s := report.String()
+	for _, want := range []string{"Backed off from throttling: 6s, 30% of worker time", "worker 3: 60% time throttled"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("expected %q in %q", want, s)
+		}
+	}
+	if strings.Contains(s, "worker 1:") {
+		t.Errorf("expected only throttled workers to be listed, got %q", s)
+	}
+	data, err := json.Marshal(report)
+	if err != nil || !strings.Contains(string(data), `{"worker":3,"runTime":"10s","backoffTime":"6s"}`) {
+		t.Errorf("expected worker 3 in %s (%v)", data, err)
+	}
+}
+
+// TestErrorCategories verifies failed attempts are counted per category, most
+// frequent first, with a bounded number of samples each.
+func TestErrorCategories(t *testing.T) {
+	m := NewMetrics()
+	for i := range 4 {
+		m.RecordErrorCategory("s3_read", fmt.Errorf("connection reset %d", i))
+	}
+	m.RecordErrorCategory("checkpoint", errors.New("access denied"))
+
+	report := m.GenerateReport()
+	if len(report.ErrorCategories) != 2 || report.ErrorCategories[0].Category != "s3_read" {
+		t.Fatalf("expected s3_read first, got %+v", report.ErrorCategories)
+	}
+	if c := report.ErrorCategories[0]; c.Count != 4 || len(c.Samples) != maxErrorSamples {
+		t.Errorf("expected 4 errors with %d samples, got %+v", maxErrorSamples, c)
+	}
+	if !strings.Contains(report.String(), "Failed attempts (checkpoint): 1, e.g. access denied") {
+		t.Errorf("expected checkpoint line in %q", report.String())
+	}
+}
+
+// TestUnprocessedLimit verifies items given up after staying unprocessed are
+// summed per table and warned about, and left out of a report without any.
+func TestUnprocessedLimit(t *testing.T) {
+	if r := NewMetrics().GenerateReport(); r.Unprocessed != nil || strings.Contains(r.String(), "unprocessed") {
+		t.Fatalf("expected no unprocessed items, got %v", r.Unprocessed)
+	}
+
+	m := NewMetrics()
+	m.RecordUnprocessedLimit("orders", 2)
+	m.RecordUnprocessedLimit("orders", 1)
+	report := m.GenerateReport()
+	if report.Unprocessed["orders"] != 3 {
+		t.Fatalf("expected 3 items on orders, got %v", report.Unprocessed)
+	}
+	if !strings.Contains(report.String(), "Warning: 3 items on orders stayed unprocessed past the retry limit") {
+		t.Errorf("expected a warning in %q", report.String())
+	}
+}
+
+// TestItemCollections verifies reported item collections are listed largest
+// first, keep their largest size, and warn once full.
+func TestItemCollections(t *testing.T) {
+	m := NewMetrics()
+	m.RecordItemCollection("orders", "small", 1<<30)
+	m.RecordItemCollection("orders", "big", 5<<30)
+	m.RecordItemCollection("orders", "big", 9<<30)
+	m.RecordCollectionFull("orders", "big", 0)
+	m.RecordCollectionFull("orders", "big", 2)
+
+	report := m.GenerateReport()
+	if len(report.ItemCollections) != 2 {
+		t.Fatalf("expected 2 collections, got %+v", report.ItemCollections)
+	}
+	if c := report.ItemCollections[0]; c.Key != "big" || c.Bytes != 9<<30 || !c.Full || c.Skipped != 2 {
+		t.Errorf("expected the full collection first, got %+v", c)
+	}
+	s := report.String()
+	if !strings.Contains(s, `Warning: item collection "big" on orders is full at the 10 GB limit, 2 operations skipped`) ||
+		!strings.Contains(s, `Item collection "small" on orders: 1.0 GiB written`) {
+		t.Errorf("expected both collections in %q", s)
+	}
+}
+
+// TestConnections verifies connection reuse and DNS lookups are summed for the
+// report, and left out when the HTTP client was not traced.
+func TestConnections(t *testing.T) {
+	m := NewMetrics()
+	if report := m.GenerateReport(); report.Connections != nil {
+		t.Errorf("expected no connections, got %+v", report.Connections)
+	}
+
+	m.RecordConnection(false, 40*time.Millisecond)
+	m.RecordConnection(true, time.Millisecond)
+	m.RecordConnection(true, 0)
+	m.RecordDNSLookup(5 * time.Millisecond)
+
+	report := m.GenerateReport()
+	want := ConnectionReport{Opened: 1, Reused: 2, Wait: 41 * time.Millisecond, MaxWait: 40 * time.Millisecond, DNSLookups: 1, DNSTime: 5 * time.Millisecond}
+	if report.Connections == nil || *report.Connections != want {
+		t.Fatalf("expected %+v, got %+v", want, report.Connections)
+	}
+	if !strings.Contains(report.String(), "Connections: 1 opened, 2 reused, 41ms waiting (max 40ms), 1 DNS lookups in 5ms") {
+		t.Errorf("expected connection line in %q", report.String())
+	}
+	data, err := report.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON: %v", err)
+	}
+	if !strings.Contains(string(data), `"connections":{"opened":1,"reused":2,"dnsLookups":1,"wait":"41ms","maxWait":"40ms","dnsTime":"5ms"}`) {
+		t.Errorf("expected connections in %s", data)
+	}
+}
+
+// TestFileReports verifies file statuses are reported sorted by file and read
+// back from the JSON report, so a later run can repair the files that did not
+// complete or dead-lettered lines.
+func TestFileReports(t *testing.T) {
+	m := NewMetrics()
+	m.RecordFileComplete("data/c.json.gz")
+	m.RecordDeadLettered("data/b.json.gz")
+	m.RecordFileComplete("data/b.json.gz")
+	m.RecordFileFailed("data/a.json.gz", errors.New("access denied"))
+	m.RecordDeadLettered("data/d.json.gz")
+
+	data, err := json.Marshal(m.GenerateReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := LoadFileReports(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileReport{
+		{File: "data/a.json.gz", Status: FileFailed, Error: "access denied"},
+		{File: "data/b.json.gz", Status: FileComplete, DeadLettered: 1},
+		{File: "data/c.json.gz", Status: FileComplete},
+		{File: "data/d.json.gz", DeadLettered: 1},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("got %+v, want %+v", files, want)
+	}
+	for i, f := range files {
+		if f != want[i] {
+			t.Errorf("file %d = %+v, want %+v", i, f, want[i])
+		}
+		if got := f.NeedsRepair(); got != (f.File != "data/c.json.gz") {
+			t.Errorf("%s NeedsRepair = %v", f.File, got)
+		}
+	}
+	if s := m.GenerateReport().String(); !strings.Contains(s, "Files needing repair: 3 of 4") {
+		t.Errorf("report does not count files needing repair:\n%s", s)
+	}
+}
+
+// TestKeyPrefixes verifies items are summed per key prefix and reported sorted,
+// and that prefixes beyond the tracked limit are counted as overflow instead
+// of growing the report without bound.
+func TestKeyPrefixes(t *testing.T) {
+	m := NewMetrics()
+	m.RecordKeyPrefixes(map[string]int64{"USER": 3, "ORDER": 2})
+	m.RecordKeyPrefixes(map[string]int64{"USER": 1})
+
+	report := m.GenerateReport()
+	want := []KeyPrefixReport{{Prefix: "ORDER", Items: 2}, {Prefix: "USER", Items: 4}}
+	if len(report.KeyPrefixes) != len(want) || report.KeyPrefixes[0] != want[0] || report.KeyPrefixes[1] != want[1] {
+		t.Fatalf("got %+v, want %+v", report.KeyPrefixes, want)
+	}
+	if s := report.String(); !strings.Contains(s, "Items by key prefix (2 prefixes):\n  \"ORDER\": 2\n  \"USER\": 4") {
+		t.Errorf("report does not list key prefixes:\n%s", s)
+	}
+
+	counts := make(map[string]int64, maxKeyPrefixes)
+	for i := range maxKeyPrefixes {
+		counts[fmt.Sprint("TENANT", i)] = 1
+	}
+	m.RecordKeyPrefixes(counts)
+	m.RecordKeyPrefixes(map[string]int64{"USER": 1})
+	report = m.GenerateReport()
+	if len(report.KeyPrefixes) != maxKeyPrefixes || report.KeyPrefixOverflow != 2 {
+		t.Errorf("expected %d prefixes and 2 overflowing items, got %d and %d", maxKeyPrefixes, len(report.KeyPrefixes), report.KeyPrefixOverflow)
+	}
+	if s := report.String(); !strings.Contains(s, "and 9980 more prefixes") || !strings.Contains(s, "2 items of further prefixes not counted") {
+		t.Errorf("report does not summarize further prefixes:\n%s", s)
+	}
+}
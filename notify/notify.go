@@ -0,0 +1,157 @@
+// Package notify delivers the outcome of a restore to an SNS topic or an HTTPS
+// webhook, so long-running restores do not need to be watched from a terminal.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/metrics"
+)
+
+// Restore outcomes reported in Notification.Status.
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Notification is the payload sent when a restore finishes.
+type Notification struct {
+	Time      time.Time       `json:"time"`             // When the restore finished
+	Report    *metrics.Report `json:"report,omitempty"` // Final (or partial, on failure) report
+	Status    string          `json:"status"`           // succeeded|failed
+	TableName string          `json:"tableName"`        // Target table
+	ExportURI string          `json:"exportUri"`        // Source export
+	Error     string          `json:"error,omitempty"`  // Failure details
+}
+
+// NewNotification builds a Notification from the result of a restore.
+// A nil runErr produces a succeeded notification.
+// Example:
+//
+//	report := coord.Report()
+//	n := notify.NewNotification(cfg.TableName, cfg.ExportS3URI, &report, runErr)
+func NewNotification(tableName, exportURI string, report *metrics.Report, runErr error) Notification {
+	n := Notification{
+		Time:      time.Now().UTC(),
+		Report:    report,
+		Status:    StatusSucceeded,
+		TableName: tableName,
+		ExportURI: exportURI,
+	}
+	if runErr != nil {
+		n.Status = StatusFailed
+		n.Error = runErr.Error()
+	}
+	return n
+}
+
+// subject returns a short human-readable summary line.
+func (n Notification) subject() string {
+	return fmt.Sprintf("ddb-pitr restore of %s %s", n.TableName, n.Status)
+}
+
+// Notifier delivers notifications.
+// Example:
+//
+//	var n notify.Notifier
+//	err := n.Notify(ctx, notification)
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// SNSClient is the subset of the SNS API used by SNSNotifier.
+type SNSClient interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// SNSNotifier publishes notifications as JSON messages to an SNS topic.
+// Example:
+//
+//	n := notify.NewSNSNotifier(sns.NewFromConfig(awsCfg), "arn:aws:sns:eu-west-1:123456789012:restores")
+type SNSNotifier struct {
+	client   SNSClient
+	topicARN string
+}
+
+// NewSNSNotifier creates an SNSNotifier for topicARN.
+func NewSNSNotifier(client SNSClient, topicARN string) *SNSNotifier {
+	return &SNSNotifier{client: client, topicARN: topicARN}
+}
+
+// Notify publishes n to the topic.
+func (s *SNSNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	_, err = s.client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(s.topicARN),
+		Subject:  aws.String(n.subject()),
+		Message:  aws.String(string(body)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish notification to %s: %w", s.topicARN, err)
+	}
+	return nil
+}
+
+// HTTPClient is the subset of *http.Client used by WebhookNotifier.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// WebhookNotifier POSTs notifications as JSON to an HTTPS endpoint.
+// Example:
+//
+//	n := notify.NewWebhookNotifier(&http.Client{Timeout: 10 * time.Second}, "https://hooks.example.com/restores")
+type WebhookNotifier struct {
+	client HTTPClient
+	url    string
+}
+
+// NewWebhookNotifier creates a WebhookNotifier for url.
+func NewWebhookNotifier(client HTTPClient, url string) *WebhookNotifier {
+	return &WebhookNotifier{client: client, url: url}
+}
+
+// Notify POSTs n to the webhook. Any non-2xx response is an error.
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// IsSNSTarget reports whether target is an SNS topic ARN rather than a webhook URL.
+// All partitions are accepted, e.g. arn:aws-cn:sns:cn-north-1:123456789012:topic.
+func IsSNSTarget(target string) bool {
+	parts := strings.SplitN(target, ":", 6)
+	return len(parts) == 6 && parts[0] == "arn" && parts[2] == "sns"
+}
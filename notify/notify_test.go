@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/metrics"
+)
+
+// mockSNSClient records published messages.
+type mockSNSClient struct {
+	inputs []*sns.PublishInput
+}
+
+func (m *mockSNSClient) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	m.inputs = append(m.inputs, params)
+	return &sns.PublishOutput{}, nil
+}
+
+// TestSNSNotifierPublishesFailure verifies that a failed restore publishes the
+// error and partial report to the configured topic.
+func TestSNSNotifierPublishesFailure(t *testing.T) {
+	client := &mockSNSClient{}
+	n := NewSNSNotifier(client, "arn:aws:sns:eu-west-1:123456789012:restores")
+
+	report := metrics.NewMetrics().GenerateReport()
+	err := n.Notify(context.Background(), NewNotification("orders", "s3://b/p", &report, errors.New("worker 0 failed")))
+	if err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	if len(client.inputs) != 1 {
+		t.Fatalf("expected 1 publish, got %d", len(client.inputs))
+	}
+	in := client.inputs[0]
+	if *in.TopicArn != "arn:aws:sns:eu-west-1:123456789012:restores" || *in.Subject != "ddb-pitr restore of orders failed" {
+		t.Errorf("unexpected publish input: topic=%s subject=%s", *in.TopicArn, *in.Subject)
+	}
+	// Report encodes its duration as a string, so decode generically
+	var got map[string]any
+	if err := json.Unmarshal([]byte(*in.Message), &got); err != nil {
+		t.Fatalf("message is not JSON: %v", err)
+	}
+	if got["status"] != StatusFailed || got["error"] != "worker 0 failed" || got["report"] == nil {
+		t.Errorf("unexpected notification: %v", got)
+	}
+}
+
+// TestWebhookNotifier posts a success notification to a test server and checks
+// that non-2xx responses are reported as errors.
+func TestWebhookNotifier(t *testing.T) {
+	var body []byte
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected content type %q", r.Header.Get("Content-Type"))
+		}
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	n := NewWebhookNotifier(srv.Client(), srv.URL)
+	if err := n.Notify(context.Background(), NewNotification("orders", "s3://b/p", nil, nil)); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	var got Notification
+	if err := json.Unmarshal(body, &got); err != nil || got.Status != StatusSucceeded || got.TableName != "orders" {
+		t.Errorf("unexpected webhook body %s (err %v)", body, err)
+	}
+
+	status = http.StatusInternalServerError
+	if err := n.Notify(context.Background(), NewNotification("orders", "s3://b/p", nil, nil)); err == nil {
+		t.Error("expected error for 500 response")
+	}
+}
+
+// TestIsSNSTarget distinguishes topic ARNs in any partition from webhook URLs.
+func TestIsSNSTarget(t *testing.T) {
+	for target, want := range map[string]bool{
+		"arn:aws:sns:eu-west-1:123456789012:restores":     true,
+		"arn:aws-cn:sns:cn-north-1:123456789012:restores": true,
+		"https://hooks.example.com/arn:aws:sns:x:y:z":     false,
+		"arn:aws:sqs:eu-west-1:123456789012:not-a-topic":  false,
+	} {
+		if got := IsSNSTarget(target); got != want {
+			t.Errorf("IsSNSTarget(%q) = %v, want %v", target, got, want)
+		}
+	}
+}
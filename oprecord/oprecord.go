@@ -0,0 +1,139 @@
+// Package oprecord encodes operations as JSON records for the files, queues and
+// commands they leave the restore through: the dead-letter file, the SQS write
+// buffer, the journal and the write hook. A record has the shape of an
+// incremental export line, its keys and images in DynamoDB JSON and its write
+// timestamp under Metadata, so records decode with the export decoder:
+//
+//	{"Operation":"PUT","Keys":{"pk":{"S":"order#1"}},"NewImage":{...},"Metadata":{"WriteTimestampMicros":{"N":"1746609560577628"}},"SourceFile":"data/a.json.gz","ByteOffset":120}
+package oprecord
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// Record is one operation with its provenance. Packages add their own fields by
+// embedding it.
+type Record struct {
+	Operation  string          `json:"Operation"`            // PUT, DELETE or UPDATE
+	Keys       json.RawMessage `json:"Keys,omitempty"`       // Primary key, DynamoDB JSON
+	NewImage   json.RawMessage `json:"NewImage,omitempty"`   // New image, DynamoDB JSON
+	OldImage   json.RawMessage `json:"OldImage,omitempty"`   // Old image, DynamoDB JSON
+	Metadata   *Metadata       `json:"Metadata,omitempty"`   // Write timestamp, as in incremental exports
+	SourceFile string          `json:"SourceFile,omitempty"` // Export data file the operation came from
+	ByteOffset int64           `json:"ByteOffset"`           // Offset of the operation's line in SourceFile
+}
+
+// Metadata carries the write timestamp in the incremental export format.
+type Metadata struct {
+	WriteTimestampMicros struct {
+		N string `json:"N"`
+	} `json:"WriteTimestampMicros"`
+}
+
+// New encodes op as a Record.
+// Example:
+//
+//	rec, err := oprecord.New(op)
+//	if err != nil {
+//	    return err
+//	}
+//	line, err := json.Marshal(rec)
+func New(op itemimage.Operation) (Record, error) {
+	r := Record{Operation: op.Type.String(), SourceFile: op.SourceFile, ByteOffset: op.ByteOffset}
+	var err error
+	if r.Keys, err = MarshalImage(op.Keys); err != nil {
+		return Record{}, fmt.Errorf("failed to encode keys: %w", err)
+	}
+	if r.NewImage, err = MarshalImage(op.NewImage); err != nil {
+		return Record{}, fmt.Errorf("failed to encode new image: %w", err)
+	}
+	if r.OldImage, err = MarshalImage(op.OldImage); err != nil {
+		return Record{}, fmt.Errorf("failed to encode old image: %w", err)
+	}
+	if op.WriteTimestampMicros != 0 {
+		r.Metadata = &Metadata{}
+		r.Metadata.WriteTimestampMicros.N = strconv.FormatInt(op.WriteTimestampMicros, 10)
+	}
+	return r, nil
+}
+
+// WriteTimestamp returns the write timestamp of the record in microseconds, or
+// 0 when it has none.
+func (r Record) WriteTimestamp() (int64, error) {
+	if r.Metadata == nil {
+		return 0, nil
+	}
+	ts, err := strconv.ParseInt(r.Metadata.WriteTimestampMicros.N, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid write timestamp %q: %w", r.Metadata.WriteTimestampMicros.N, err)
+	}
+	return ts, nil
+}
+
+// Decode converts the record back to the operation it was encoded from.
+// Records read through the export decoder, which applies the export's view,
+// take only their type from ParseType instead.
+// Example:
+//
+//	op, err := rec.Decode()
+func (r Record) Decode() (itemimage.Operation, error) {
+	t, err := ParseType(r.Operation)
+	if err != nil {
+		return itemimage.Operation{}, err
+	}
+	op := itemimage.Operation{Type: t, SourceFile: r.SourceFile, ByteOffset: r.ByteOffset}
+	if op.WriteTimestampMicros, err = r.WriteTimestamp(); err != nil {
+		return itemimage.Operation{}, err
+	}
+	if op.Keys, err = unmarshalImage(r.Keys); err != nil {
+		return itemimage.Operation{}, fmt.Errorf("invalid keys: %w", err)
+	}
+	if op.NewImage, err = unmarshalImage(r.NewImage); err != nil {
+		return itemimage.Operation{}, fmt.Errorf("invalid new image: %w", err)
+	}
+	if op.OldImage, err = unmarshalImage(r.OldImage); err != nil {
+		return itemimage.Operation{}, fmt.Errorf("invalid old image: %w", err)
+	}
+	return op, nil
+}
+
+// ParseType returns the operation type named by a record's Operation, which
+// the images alone cannot tell: a put with a key looks like a delete, and a put
+// with an old image like an update.
+// Example:
+//
+//	op.Type, err = oprecord.ParseType("DELETE")
+func ParseType(name string) (itemimage.OperationType, error) {
+	switch name {
+	case "PUT":
+		return itemimage.OpPut, nil
+	case "DELETE":
+		return itemimage.OpDelete, nil
+	case "UPDATE":
+		return itemimage.OpUpdate, nil
+	default:
+		return 0, fmt.Errorf("unknown operation %q", name)
+	}
+}
+
+// MarshalImage encodes an image as DynamoDB JSON, returning nil for empty images.
+func MarshalImage(image map[string]types.AttributeValue) (json.RawMessage, error) {
+	if len(image) == 0 {
+		return nil, nil
+	}
+	return attributevalue.MarshalMapJSON(image)
+}
+
+// unmarshalImage decodes a DynamoDB JSON image, returning nil for absent ones.
+func unmarshalImage(raw json.RawMessage) (map[string]types.AttributeValue, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	return attributevalue.UnmarshalMapJSON(raw)
+}
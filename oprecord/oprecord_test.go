@@ -0,0 +1,74 @@
+package oprecord
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+func testOperation() itemimage.Operation {
+	return itemimage.Operation{
+		Type:                 itemimage.OpUpdate,
+		Keys:                 map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "order#1"}},
+		NewImage:             map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "order#1"}, "total": &types.AttributeValueMemberN{Value: "12.5"}},
+		OldImage:             map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "order#1"}},
+		SourceFile:           "data/a.json.gz",
+		ByteOffset:           120,
+		WriteTimestampMicros: 1746609560577628,
+	}
+}
+
+// TestRecordRoundTrip verifies an encoded operation decodes back with its
+// type, images and provenance, as the write hook relies on.
+func TestRecordRoundTrip(t *testing.T) {
+	rec, err := New(testOperation())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var got Record
+	if err := json.Unmarshal(line, &got); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	op, err := got.Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	want := testOperation()
+	if op.Type != want.Type || !itemimage.ItemEqual(op.Keys, want.Keys) || !itemimage.ItemEqual(op.NewImage, want.NewImage) ||
+		!itemimage.ItemEqual(op.OldImage, want.OldImage) || op.SourceFile != want.SourceFile ||
+		op.ByteOffset != want.ByteOffset || op.WriteTimestampMicros != want.WriteTimestampMicros {
+		t.Errorf("expected the operation back, got %+v", op)
+	}
+}
+
+// TestRecordDecodesAsExportLine verifies a record reads with the export
+// decoder, which is what lets the dead-letter file, the journal and the write
+// buffer be replayed like an export.
+func TestRecordDecodesAsExportLine(t *testing.T) {
+	rec, err := New(testOperation())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	line, _ := json.Marshal(rec)
+	op, err := itemimage.NewJSONDecoder().Decode(line)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if op.WriteTimestampMicros != 1746609560577628 || op.OldImage == nil {
+		t.Errorf("expected the write timestamp and old image, got %+v", op)
+	}
+}
+
+// TestParseTypeRejectsUnknownOperations ensures a record naming an unknown
+// operation fails instead of being written as a put.
+func TestParseTypeRejectsUnknownOperations(t *testing.T) {
+	if _, err := ParseType("CORRUPT"); err == nil {
+		t.Error("expected an error for an unknown operation")
+	}
+}
@@ -0,0 +1,192 @@
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gurre/ddb-pitr/manifest"
+)
+
+// ChainExport is one export of a restore chain.
+type ChainExport struct {
+	URI     string           `json:"uri"`            // S3 URI of the export's manifest-summary.json
+	Summary manifest.Summary `json:"-"`              // Loaded manifest summary
+	From    time.Time        `json:"from,omitempty"` // Start of an incremental export's window; zero for a full export
+	To      time.Time        `json:"to"`             // Time the export's data reflects
+}
+
+// IsFull reports whether the export is a full export, which starts the chain.
+func (e ChainExport) IsFull() bool {
+	return !e.Summary.IsIncremental()
+}
+
+// ChainIssue is a discontinuity between two consecutive exports of a chain:
+// a gap whose changes are in no export, or an overlap applied twice.
+type ChainIssue struct {
+	After int       `json:"after"` // Index of the earlier export in Chain.Exports
+	From  time.Time `json:"from"`  // End of the earlier export
+	To    time.Time `json:"to"`    // Start of the later export
+}
+
+// Overlap reports whether the later export starts before the earlier one ends.
+func (i ChainIssue) Overlap() bool {
+	return i.To.Before(i.From)
+}
+
+// String describes the issue, e.g. "gap of 1m9s from ... to ...".
+func (i ChainIssue) String() string {
+	if i.Overlap() {
+		return fmt.Sprintf("overlap of %s from %s to %s", i.From.Sub(i.To), formatChainTime(i.To), formatChainTime(i.From))
+	}
+	return fmt.Sprintf("gap of %s from %s to %s", i.To.Sub(i.From), formatChainTime(i.From), formatChainTime(i.To))
+}
+
+// Chain is a full export and the incremental exports to apply after it, in
+// order, with the discontinuities between them.
+type Chain struct {
+	Exports []ChainExport `json:"exports"`          // Full export first, then incrementals by window
+	Issues  []ChainIssue  `json:"issues,omitempty"` // Gaps and overlaps, in timeline order
+}
+
+// NewChain orders exports into a restore chain: the full export, if any, first
+// and incremental exports by their window. Each export must start where the
+// previous one ends; Issues lists those that do not. Exports of different
+// tables, several full exports, and incremental exports ending before the
+// previous export are errors, since no order restores them correctly.
+// Example:
+//
+//	chain, err := plan.NewChain(exports)
+//	if err != nil {
+//	    return err
+//	}
+//	fmt.Println(chain)
+//	if err := chain.Check(); err != nil && !allowGaps {
+//	    return err
+//	}
+func NewChain(exports []ChainExport) (Chain, error) {
+	var c Chain
+	var full []ChainExport
+	for _, e := range exports {
+		if e.Summary.TableARN != exports[0].Summary.TableARN {
+			return Chain{}, fmt.Errorf("export %s is of table %s, not %s", e.URI, e.Summary.TableARN, exports[0].Summary.TableARN)
+		}
+		var err error
+		if e.To, err = parseChainTime(e.URI, e.Summary.PointInTime()); err != nil {
+			return Chain{}, err
+		}
+		if e.IsFull() {
+			full = append(full, e)
+			continue
+		}
+		if e.From, err = parseChainTime(e.URI, e.Summary.ExportFromTime); err != nil {
+			return Chain{}, err
+		}
+		c.Exports = append(c.Exports, e)
+	}
+	if len(full) > 1 {
+		return Chain{}, fmt.Errorf("a chain starts from one full export, got %d: %s and %s", len(full), full[0].URI, full[1].URI)
+	}
+	sort.SliceStable(c.Exports, func(i, j int) bool {
+		if !c.Exports[i].From.Equal(c.Exports[j].From) {
+			return c.Exports[i].From.Before(c.Exports[j].From)
+		}
+		return c.Exports[i].To.Before(c.Exports[j].To)
+	})
+	c.Exports = append(full, c.Exports...)
+
+	for i := 1; i < len(c.Exports); i++ {
+		prev, next := c.Exports[i-1], c.Exports[i]
+		if !next.To.After(prev.To) {
+			// Applied after prev, next would revert its items to an earlier state
+			return Chain{}, fmt.Errorf("export %s ends at %s, not after %s which precedes it",
+				next.URI, formatChainTime(next.To), prev.URI)
+		}
+		if !next.From.Equal(prev.To) {
+			c.Issues = append(c.Issues, ChainIssue{After: i - 1, From: prev.To, To: next.From})
+		}
+	}
+	return c, nil
+}
+
+// Check returns an error describing the chain's gaps and overlaps, or nil if
+// every export starts where the previous one ends.
+func (c Chain) Check() error {
+	if len(c.Issues) == 0 {
+		return nil
+	}
+	issues := make([]string, len(c.Issues))
+	for i, issue := range c.Issues {
+		issues[i] = issue.String()
+	}
+	return fmt.Errorf("export chain is not contiguous: %s", strings.Join(issues, "; "))
+}
+
+// String renders the chain's timeline for the console, one export or issue per line.
+func (c Chain) String() string {
+	var b strings.Builder
+	b.WriteString("Timeline:")
+	for i, e := range c.Exports {
+		if e.IsFull() {
+			fmt.Fprintf(&b, "\n  %d. FULL        as of %s, %d items: %s", i+1, formatChainTime(e.To), e.Summary.ItemCount, e.URI)
+		} else {
+			fmt.Fprintf(&b, "\n  %d. INCREMENTAL %s to %s, %d items: %s", i+1,
+				formatChainTime(e.From), formatChainTime(e.To), e.Summary.ItemCount, e.URI)
+		}
+		for _, issue := range c.Issues {
+			if issue.After == i {
+				if issue.Overlap() {
+					fmt.Fprintf(&b, "\n     OVERLAP %s; changes in it are applied twice", issue)
+				} else {
+					fmt.Fprintf(&b, "\n     GAP     %s; changes made in it are missing", issue)
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+// Until returns the part of the chain that restores the table as of t: the
+// exports that start before t. The last of them may end after t, so its records
+// written later must still be filtered out. A full export ending after t is an
+// error, since its items carry no write times to filter by.
+// Example:
+//
+//	chain, err = chain.Until(restoreTo)
+func (c Chain) Until(t time.Time) (Chain, error) {
+	var until Chain
+	for _, e := range c.Exports {
+		if e.IsFull() && e.To.After(t) {
+			return Chain{}, fmt.Errorf("cannot restore to %s, before the full export %s as of %s",
+				formatChainTime(t), e.URI, formatChainTime(e.To))
+		}
+		if !e.IsFull() && !e.From.Before(t) {
+			break
+		}
+		until.Exports = append(until.Exports, e)
+	}
+	if len(until.Exports) == 0 {
+		return Chain{}, fmt.Errorf("no export starts before %s", formatChainTime(t))
+	}
+	for _, issue := range c.Issues {
+		if issue.After < len(until.Exports)-1 {
+			until.Issues = append(until.Issues, issue)
+		}
+	}
+	return until, nil
+}
+
+// parseChainTime parses an RFC 3339 manifest timestamp of the export at uri.
+func parseChainTime(uri, s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("export %s has invalid time %q: %w", uri, s, err)
+	}
+	return t, nil
+}
+
+// formatChainTime formats t for timelines, dropping sub-second digits that are zero.
+func formatChainTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,138 @@
+package plan
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gurre/ddb-pitr/manifest"
+)
+
+const chainTable = "arn:aws:dynamodb:eu-west-1:123456789012:table/t"
+
+func fullExport(uri, at string) ChainExport {
+	return ChainExport{URI: uri, Summary: manifest.Summary{TableARN: chainTable, ExportType: manifest.ExportTypeFull, ExportTime: at}}
+}
+
+func incrementalExport(uri, from, to string) ChainExport {
+	return ChainExport{URI: uri, Summary: manifest.Summary{
+		TableARN: chainTable, ExportType: manifest.ExportTypeIncremental, ExportFromTime: from, ExportToTime: to,
+	}}
+}
+
+// TestNewChainOrdersExports checks exports given in any order are applied as
+// the full export followed by incrementals by window, so later changes win.
+func TestNewChainOrdersExports(t *testing.T) {
+	chain, err := NewChain([]ChainExport{
+		incrementalExport("s3://b/i2", "2025-01-01T11:00:00Z", "2025-01-01T12:00:00Z"),
+		fullExport("s3://b/full", "2025-01-01T10:00:00Z"),
+		incrementalExport("s3://b/i1", "2025-01-01T10:00:00Z", "2025-01-01T11:00:00Z"),
+	})
+	if err != nil {
+		t.Fatalf("NewChain: %v", err)
+	}
+	var uris []string
+	for _, e := range chain.Exports {
+		uris = append(uris, e.URI)
+	}
+	if got := strings.Join(uris, ","); got != "s3://b/full,s3://b/i1,s3://b/i2" {
+		t.Errorf("order = %s", got)
+	}
+	if err := chain.Check(); err != nil {
+		t.Errorf("Check() = %v, want a contiguous chain", err)
+	}
+}
+
+// TestNewChainDetectsGapsAndOverlaps checks discontinuities are reported with
+// their extent, since a gap loses the changes made in it, and that the
+// timeline marks them after the export they follow.
+func TestNewChainDetectsGapsAndOverlaps(t *testing.T) {
+	chain, err := NewChain([]ChainExport{
+		fullExport("s3://b/full", "2025-01-01T10:00:00Z"),
+		incrementalExport("s3://b/i1", "2025-01-01T10:05:00Z", "2025-01-01T11:00:00Z"),
+		incrementalExport("s3://b/i2", "2025-01-01T10:50:00Z", "2025-01-01T12:00:00Z"),
+	})
+	if err != nil {
+		t.Fatalf("NewChain: %v", err)
+	}
+	if len(chain.Issues) != 2 || chain.Issues[0].Overlap() || !chain.Issues[1].Overlap() {
+		t.Fatalf("Issues = %v, want a gap then an overlap", chain.Issues)
+	}
+	err = chain.Check()
+	if err == nil || !strings.Contains(err.Error(), "gap of 5m0s") || !strings.Contains(err.Error(), "overlap of 10m0s") {
+		t.Errorf("Check() = %v", err)
+	}
+	timeline := chain.String()
+	gap := strings.Index(timeline, "GAP")
+	if gap < strings.Index(timeline, "s3://b/full") || gap > strings.Index(timeline, "s3://b/i1") {
+		t.Errorf("gap not placed between the exports it separates:\n%s", timeline)
+	}
+	if !strings.Contains(timeline, "OVERLAP") {
+		t.Errorf("timeline lacks the overlap:\n%s", timeline)
+	}
+}
+
+// TestNewChainRejectsInvalidChains checks chains no order can restore
+// correctly are errors rather than issues that -allow-gaps could accept.
+func TestNewChainRejectsInvalidChains(t *testing.T) {
+	other := incrementalExport("s3://b/other", "2025-01-01T10:00:00Z", "2025-01-01T11:00:00Z")
+	other.Summary.TableARN = chainTable + "2"
+	tests := map[string]struct {
+		exports []ChainExport
+		want    string
+	}{
+		"different tables": {
+			[]ChainExport{fullExport("s3://b/full", "2025-01-01T10:00:00Z"), other},
+			"is of table",
+		},
+		"two full exports": {
+			[]ChainExport{fullExport("s3://b/f1", "2025-01-01T10:00:00Z"), fullExport("s3://b/f2", "2025-01-01T11:00:00Z")},
+			"one full export",
+		},
+		"incremental ending before the full export": {
+			[]ChainExport{fullExport("s3://b/full", "2025-01-01T12:00:00Z"), incrementalExport("s3://b/i1", "2025-01-01T10:00:00Z", "2025-01-01T11:00:00Z")},
+			"not after s3://b/full",
+		},
+		"invalid time": {
+			[]ChainExport{incrementalExport("s3://b/i1", "yesterday", "2025-01-01T11:00:00Z")},
+			"invalid time",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewChain(tt.exports); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewChain() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestChainUntil checks restoring to a time drops the exports starting after
+// it and their issues, and refuses times before the full export, whose items
+// cannot be filtered by write time.
+func TestChainUntil(t *testing.T) {
+	chain, err := NewChain([]ChainExport{
+		fullExport("s3://b/full", "2025-01-01T10:00:00Z"),
+		incrementalExport("s3://b/i1", "2025-01-01T10:00:00Z", "2025-01-01T11:00:00Z"),
+		incrementalExport("s3://b/i2", "2025-01-01T11:05:00Z", "2025-01-01T12:00:00Z"),
+		incrementalExport("s3://b/i3", "2025-01-01T12:00:00Z", "2025-01-01T13:00:00Z"),
+	})
+	if err != nil {
+		t.Fatalf("NewChain: %v", err)
+	}
+
+	until, err := chain.Until(time.Date(2025, 1, 1, 10, 30, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Until: %v", err)
+	}
+	if len(until.Exports) != 2 || until.Exports[1].URI != "s3://b/i1" || len(until.Issues) != 0 {
+		t.Errorf("expected the full export and i1 without the later gap, got %+v", until)
+	}
+	until, err = chain.Until(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil || len(until.Exports) != 3 || len(until.Issues) != 1 {
+		t.Errorf("expected three exports and the gap before i2, got %+v, %v", until, err)
+	}
+	if _, err := chain.Until(time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)); err == nil {
+		t.Error("expected error for a time before the full export")
+	}
+}
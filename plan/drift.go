@@ -0,0 +1,237 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// SchemaDescriber is the subset of the DynamoDB client used to compare the
+// settings of the exported table and a target table.
+type SchemaDescriber interface {
+	TableDescriber
+	DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error)
+}
+
+// Index is a secondary index of a table.
+type Index struct {
+	KeySchema  []KeyAttribute `json:"keySchema"`  // Index key, partition key first
+	Projection string         `json:"projection"` // ALL, KEYS_ONLY or INCLUDE(a, b)
+}
+
+// String formats the index as "key (type), ... projecting ALL".
+func (i Index) String() string {
+	return describeKeys(i.KeySchema) + " projecting " + i.Projection
+}
+
+// Schema holds the settings of a table that change how restored items behave.
+type Schema struct {
+	Table                string            `json:"table"`                    // Table name or ARN
+	KeySchema            []KeyAttribute    `json:"keySchema"`                // Primary key, partition key first
+	AttributeDefinitions map[string]string `json:"attributeDefinitions"`     // Types of key attributes of the table and its indexes
+	GlobalIndexes        map[string]Index  `json:"globalIndexes,omitempty"`  // Global secondary indexes by name
+	LocalIndexes         map[string]Index  `json:"localIndexes,omitempty"`   // Local secondary indexes by name
+	TTLAttribute         string            `json:"ttlAttribute,omitempty"`   // Attribute expiring items; empty if TTL is disabled
+	TTLUnknown           bool              `json:"ttlUnknown,omitempty"`     // TTL could not be described
+	StreamViewType       string            `json:"streamViewType,omitempty"` // View of the enabled stream; empty if streams are disabled
+	Encryption           string            `json:"encryption"`               // AWS owned key, or KMS and the key ARN
+}
+
+// DescribeSchema looks up the settings of table. A failure to describe TTL,
+// which needs its own permission, is recorded in TTLUnknown rather than
+// returned.
+// Example:
+//
+//	source, err := plan.DescribeSchema(ctx, client, summary.TableARN)
+//	if err != nil {
+//	    return err
+//	}
+func DescribeSchema(ctx context.Context, client SchemaDescriber, table string) (Schema, error) {
+	out, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &table})
+	if err != nil {
+		return Schema{}, fmt.Errorf("failed to describe table %s: %w", table, err)
+	}
+	schema := tableSchema(table, out.Table)
+	ttl, err := client.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: &table})
+	switch {
+	case err != nil || ttl.TimeToLiveDescription == nil:
+		schema.TTLUnknown = true
+	case ttl.TimeToLiveDescription.TimeToLiveStatus == types.TimeToLiveStatusEnabled ||
+		ttl.TimeToLiveDescription.TimeToLiveStatus == types.TimeToLiveStatusEnabling:
+		schema.TTLAttribute = awssdk.ToString(ttl.TimeToLiveDescription.AttributeName)
+	}
+	return schema, nil
+}
+
+// tableSchema extracts Schema from a table description, without TTL.
+func tableSchema(table string, desc *types.TableDescription) Schema {
+	schema := Schema{Table: table, Encryption: "AWS owned key"}
+	if desc == nil {
+		return schema
+	}
+	attrTypes := attributeTypes(desc)
+	schema.KeySchema = keyAttributes(desc.KeySchema, attrTypes)
+	schema.AttributeDefinitions = attrTypes
+	for _, gsi := range desc.GlobalSecondaryIndexes {
+		if schema.GlobalIndexes == nil {
+			schema.GlobalIndexes = make(map[string]Index)
+		}
+		schema.GlobalIndexes[awssdk.ToString(gsi.IndexName)] = Index{keyAttributes(gsi.KeySchema, attrTypes), projection(gsi.Projection)}
+	}
+	for _, lsi := range desc.LocalSecondaryIndexes {
+		if schema.LocalIndexes == nil {
+			schema.LocalIndexes = make(map[string]Index)
+		}
+		schema.LocalIndexes[awssdk.ToString(lsi.IndexName)] = Index{keyAttributes(lsi.KeySchema, attrTypes), projection(lsi.Projection)}
+	}
+	if s := desc.StreamSpecification; s != nil && awssdk.ToBool(s.StreamEnabled) {
+		schema.StreamViewType = string(s.StreamViewType)
+	}
+	if s := desc.SSEDescription; s != nil && s.Status == types.SSEStatusEnabled && s.SSEType == types.SSETypeKms {
+		schema.Encryption = "KMS " + awssdk.ToString(s.KMSMasterKeyArn)
+	}
+	return schema
+}
+
+// projection formats an index projection, e.g. "INCLUDE(email, status)".
+func projection(p *types.Projection) string {
+	if p == nil {
+		return string(types.ProjectionTypeAll)
+	}
+	if p.ProjectionType == types.ProjectionTypeInclude {
+		attrs := slices.Sorted(slices.Values(p.NonKeyAttributes))
+		return "INCLUDE(" + strings.Join(attrs, ", ") + ")"
+	}
+	return string(p.ProjectionType)
+}
+
+// Drift is one setting that differs between the exported table and a target.
+type Drift struct {
+	Setting string `json:"setting"` // e.g. "global index byEmail" or "ttl"
+	Source  string `json:"source"`  // Value on the exported table; empty if absent
+	Target  string `json:"target"`  // Value on the target table; empty if absent
+	Effect  string `json:"effect"`  // How restored items behave differently
+}
+
+// DriftReport lists the settings in which a target table differs from the
+// exported table.
+type DriftReport struct {
+	Source  string   `json:"source"`            // Exported table
+	Target  string   `json:"target"`            // Target table
+	Drifts  []Drift  `json:"drifts"`            // Differing settings; empty if none
+	Skipped []string `json:"skipped,omitempty"` // Settings that could not be compared
+}
+
+// CompareSchemas reports the settings in which target differs from source, and
+// what each difference means for the restored items.
+// Example:
+//
+//	report := plan.CompareSchemas(source, target)
+//	fmt.Println(report)
+func CompareSchemas(source, target Schema) DriftReport {
+	r := DriftReport{Source: source.Table, Target: target.Table, Drifts: []Drift{}}
+	add := func(setting, src, dst, effect string) {
+		if src != dst {
+			r.Drifts = append(r.Drifts, Drift{Setting: setting, Source: src, Target: dst, Effect: effect})
+		}
+	}
+
+	add("key schema", describeKeys(source.KeySchema), describeKeys(target.KeySchema),
+		"exported items do not carry the target's key; the restore fails")
+	for _, name := range unionKeys(source.AttributeDefinitions, target.AttributeDefinitions) {
+		src, dst := source.AttributeDefinitions[name], target.AttributeDefinitions[name]
+		if src != "" && dst != "" {
+			add("attribute "+name, src, dst, "items whose "+name+" is a "+src+" are rejected by the target or left out of its indexes")
+		}
+	}
+	compareIndexes(&r, "global index", source.GlobalIndexes, target.GlobalIndexes)
+	compareIndexes(&r, "local index", source.LocalIndexes, target.LocalIndexes)
+
+	if source.TTLUnknown || target.TTLUnknown {
+		r.Skipped = append(r.Skipped, "ttl")
+	} else {
+		switch {
+		case target.TTLAttribute == "":
+			add("ttl", source.TTLAttribute, "", "restored items are never expired")
+		case source.TTLAttribute == "":
+			add("ttl", "", target.TTLAttribute, "restored items whose "+target.TTLAttribute+" lies in the past are deleted within days of the restore")
+		default:
+			add("ttl", source.TTLAttribute, target.TTLAttribute, "items expire by "+target.TTLAttribute+" instead of "+source.TTLAttribute)
+		}
+	}
+
+	switch {
+	case target.StreamViewType == "":
+		add("stream", source.StreamViewType, "", "consumers of the source table's stream see none of the restored writes")
+	default:
+		add("stream", source.StreamViewType, target.StreamViewType, "every restored write is published to the target's stream ("+
+			target.StreamViewType+") and delivered to its consumers")
+	}
+	add("encryption", source.Encryption, target.Encryption, "restored items are encrypted at rest with a different key")
+	return r
+}
+
+// compareIndexes adds the indexes missing from, added to or changed in target.
+func compareIndexes(r *DriftReport, kind string, source, target map[string]Index) {
+	for _, name := range unionKeys(source, target) {
+		src, inSource := source[name]
+		dst, inTarget := target[name]
+		setting := kind + " " + name
+		switch {
+		case !inTarget:
+			r.Drifts = append(r.Drifts, Drift{Setting: setting, Source: src.String(),
+				Effect: "queries on " + name + " fail on the target"})
+		case !inSource:
+			r.Drifts = append(r.Drifts, Drift{Setting: setting, Target: dst.String(),
+				Effect: "restored items are also written to " + name + ", consuming its write capacity"})
+		case src.String() != dst.String():
+			r.Drifts = append(r.Drifts, Drift{Setting: setting, Source: src.String(), Target: dst.String(),
+				Effect: "queries on " + name + " return different items or attributes"})
+		}
+	}
+}
+
+// unionKeys returns the keys of both maps, sorted.
+func unionKeys[V any](a, b map[string]V) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// String renders the report for the console, one drift per line.
+func (r DriftReport) String() string {
+	var b strings.Builder
+	if len(r.Drifts) == 0 {
+		fmt.Fprintf(&b, "Schema of %s matches the exported table %s", r.Target, r.Source)
+	} else {
+		fmt.Fprintf(&b, "Schema drift of %s from the exported table %s:", r.Target, r.Source)
+	}
+	for _, d := range r.Drifts {
+		fmt.Fprintf(&b, "\n  %s: %s -> %s: %s", d.Setting, orNone(d.Source), orNone(d.Target), d.Effect)
+	}
+	if len(r.Skipped) > 0 {
+		fmt.Fprintf(&b, "\n  Not compared: %s", strings.Join(r.Skipped, ", "))
+	}
+	return b.String()
+}
+
+// orNone returns s, or "none" if it is empty.
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
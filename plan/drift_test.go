@@ -0,0 +1,143 @@
+package plan
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeSchemaDescriber describes tables and their TTL by name; a table without
+// a TTL entry fails DescribeTimeToLive as without the permission.
+type fakeSchemaDescriber struct {
+	tables map[string]*types.TableDescription
+	ttl    map[string]string // TTL attribute by table, "" if disabled
+}
+
+func (f *fakeSchemaDescriber) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	desc, ok := f.tables[*params.TableName]
+	if !ok {
+		return nil, errors.New("ResourceNotFoundException")
+	}
+	return &dynamodb.DescribeTableOutput{Table: desc}, nil
+}
+
+func (f *fakeSchemaDescriber) DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	attr, ok := f.ttl[*params.TableName]
+	if !ok {
+		return nil, errors.New("AccessDeniedException")
+	}
+	desc := &types.TimeToLiveDescription{TimeToLiveStatus: types.TimeToLiveStatusDisabled}
+	if attr != "" {
+		desc = &types.TimeToLiveDescription{TimeToLiveStatus: types.TimeToLiveStatusEnabled, AttributeName: awssdk.String(attr)}
+	}
+	return &dynamodb.DescribeTimeToLiveOutput{TimeToLiveDescription: desc}, nil
+}
+
+// ordersTable describes a table keyed by pk with a byEmail index, changed by
+// edit.
+func ordersTable(edit func(*types.TableDescription)) *types.TableDescription {
+	desc := &types.TableDescription{
+		KeySchema: []types.KeySchemaElement{{AttributeName: awssdk.String("pk"), KeyType: types.KeyTypeHash}},
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: awssdk.String("pk"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: awssdk.String("email"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndexDescription{{
+			IndexName:  awssdk.String("byEmail"),
+			KeySchema:  []types.KeySchemaElement{{AttributeName: awssdk.String("email"), KeyType: types.KeyTypeHash}},
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeInclude, NonKeyAttributes: []string{"status", "name"}},
+		}},
+		StreamSpecification: &types.StreamSpecification{StreamEnabled: awssdk.Bool(true), StreamViewType: types.StreamViewTypeNewAndOldImages},
+	}
+	if edit != nil {
+		edit(desc)
+	}
+	return desc
+}
+
+// TestCompareSchemasReportsDrift checks each setting that changes how restored
+// items behave is reported with its values on both tables, and identical
+// tables report no drift.
+func TestCompareSchemasReportsDrift(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeSchemaDescriber{
+		tables: map[string]*types.TableDescription{
+			"source": ordersTable(nil),
+			"same":   ordersTable(nil),
+			"drifted": ordersTable(func(d *types.TableDescription) {
+				d.AttributeDefinitions[1].AttributeType = types.ScalarAttributeTypeN
+				d.GlobalSecondaryIndexes[0].Projection = &types.Projection{ProjectionType: types.ProjectionTypeKeysOnly}
+				d.StreamSpecification = nil
+				d.SSEDescription = &types.SSEDescription{Status: types.SSEStatusEnabled, SSEType: types.SSETypeKms, KMSMasterKeyArn: awssdk.String("arn:aws:kms:key/1")}
+			}),
+		},
+		ttl: map[string]string{"source": "expiresAt", "same": "expiresAt", "drifted": ""},
+	}
+	source, err := DescribeSchema(ctx, client, "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source.GlobalIndexes["byEmail"].Projection != "INCLUDE(name, status)" || source.TTLAttribute != "expiresAt" {
+		t.Fatalf("unexpected schema %+v", source)
+	}
+
+	same, _ := DescribeSchema(ctx, client, "same")
+	if r := CompareSchemas(source, same); len(r.Drifts) != 0 {
+		t.Errorf("expected no drift, got %v", r)
+	}
+
+	drifted, _ := DescribeSchema(ctx, client, "drifted")
+	r := CompareSchemas(source, drifted)
+	got := map[string]Drift{}
+	for _, d := range r.Drifts {
+		got[d.Setting] = d
+	}
+	for _, setting := range []string{"attribute email", "global index byEmail", "ttl", "stream", "encryption"} {
+		if _, ok := got[setting]; !ok {
+			t.Errorf("expected drift of %s, got %v", setting, r)
+		}
+	}
+	if len(r.Drifts) != 5 {
+		t.Errorf("expected 5 drifts, got %v", r)
+	}
+	if d := got["ttl"]; d.Source != "expiresAt" || d.Target != "" || !strings.Contains(d.Effect, "never expired") {
+		t.Errorf("unexpected ttl drift %+v", d)
+	}
+	if !strings.Contains(r.String(), "global index byEmail: email (S) projecting INCLUDE(name, status) -> email (N) projecting KEYS_ONLY") {
+		t.Errorf("unexpected report:\n%s", r)
+	}
+}
+
+// TestCompareSchemasSkipsUnknownTTL checks a table whose TTL cannot be read is
+// reported as not compared rather than as having TTL disabled, and a missing
+// index is reported as missing.
+func TestCompareSchemasSkipsUnknownTTL(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeSchemaDescriber{
+		tables: map[string]*types.TableDescription{
+			"source": ordersTable(nil),
+			"target": ordersTable(func(d *types.TableDescription) { d.GlobalSecondaryIndexes = nil }),
+		},
+		ttl: map[string]string{"source": "expiresAt"},
+	}
+	source, _ := DescribeSchema(ctx, client, "source")
+	target, err := DescribeSchema(ctx, client, "target")
+	if err != nil || !target.TTLUnknown {
+		t.Fatalf("expected the TTL to be unknown, got %+v, %v", target, err)
+	}
+	r := CompareSchemas(source, target)
+	if len(r.Skipped) != 1 || r.Skipped[0] != "ttl" {
+		t.Errorf("expected ttl to be skipped, got %v", r.Skipped)
+	}
+	if len(r.Drifts) != 1 || r.Drifts[0].Setting != "global index byEmail" || r.Drifts[0].Target != "" {
+		t.Errorf("expected only the missing index, got %v", r)
+	}
+	if _, err := DescribeSchema(ctx, client, "missing"); err == nil {
+		t.Error("expected error for a missing table")
+	}
+}
@@ -0,0 +1,158 @@
+package plan
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// KeyAttribute is one attribute of a table's primary key.
+type KeyAttribute struct {
+	Name string `json:"name"` // Attribute name
+	Type string `json:"type"` // S, N or B
+	Role string `json:"role"` // HASH or RANGE
+}
+
+// String formats the attribute as "name (type)".
+func (k KeyAttribute) String() string {
+	return fmt.Sprintf("%s (%s)", k.Name, k.Type)
+}
+
+// keySchema extracts the primary key of a table description, partition key first.
+func keySchema(desc *types.TableDescription) []KeyAttribute {
+	return keyAttributes(desc.KeySchema, attributeTypes(desc))
+}
+
+// attributeTypes returns the types of a table description's attribute
+// definitions by name.
+func attributeTypes(desc *types.TableDescription) map[string]string {
+	attrTypes := make(map[string]string, len(desc.AttributeDefinitions))
+	for _, def := range desc.AttributeDefinitions {
+		if def.AttributeName != nil {
+			attrTypes[*def.AttributeName] = string(def.AttributeType)
+		}
+	}
+	return attrTypes
+}
+
+// keyAttributes describes the key of a table or index, partition key first.
+func keyAttributes(schema []types.KeySchemaElement, attrTypes map[string]string) []KeyAttribute {
+	var keys []KeyAttribute
+	for _, role := range []types.KeyType{types.KeyTypeHash, types.KeyTypeRange} {
+		for _, k := range schema {
+			if k.KeyType == role && k.AttributeName != nil {
+				keys = append(keys, KeyAttribute{Name: *k.AttributeName, Type: attrTypes[*k.AttributeName], Role: string(role)})
+			}
+		}
+	}
+	return keys
+}
+
+// describeKeys formats a key schema for error messages.
+func describeKeys(keys []KeyAttribute) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// CompareKeySchemas checks that the exported source table and a target table
+// have the same primary key, so items of one are items of the other.
+// Example:
+//
+//	source, err := plan.DescribeTable(ctx, client, summary.TableARN, region)
+//	if err == nil {
+//	    err = plan.CompareKeySchemas(source, target)
+//	}
+func CompareKeySchemas(source, target TableInfo) error {
+	if len(source.KeySchema) == 0 || len(target.KeySchema) == 0 {
+		return nil
+	}
+	same := len(source.KeySchema) == len(target.KeySchema)
+	for i := 0; same && i < len(source.KeySchema); i++ {
+		same = source.KeySchema[i] == target.KeySchema[i]
+	}
+	if !same {
+		return fmt.Errorf("table %s has key %s but the exported table %s has key %s",
+			target.Name, describeKeys(target.KeySchema), source.Name, describeKeys(source.KeySchema))
+	}
+	return nil
+}
+
+// CheckKeys checks that op carries the table's primary key: every key attribute
+// with the table's type, and for operations with explicit keys no other
+// attributes. Operations without explicit keys, as in full exports, are checked
+// against their new image.
+// Example:
+//
+//	if err := info.CheckKeys(op); err != nil {
+//	    return fmt.Errorf("export does not match the target table: %w", err)
+//	}
+func (t TableInfo) CheckKeys(op itemimage.Operation) error {
+	attrs, from := op.Keys, "keys"
+	if len(attrs) == 0 {
+		attrs, from = op.NewImage, "item"
+	}
+	for _, k := range t.KeySchema {
+		v, ok := attrs[k.Name]
+		if !ok {
+			return fmt.Errorf("export %s %s lacks key attribute %s of table %s (key %s)",
+				from, describeAttributes(attrs), k, t.Name, describeKeys(t.KeySchema))
+		}
+		if got := attributeType(v); got != k.Type {
+			return fmt.Errorf("key attribute %s of table %s is %s but the export has %s",
+				k.Name, t.Name, k.Type, got)
+		}
+	}
+	if from == "keys" && len(attrs) != len(t.KeySchema) {
+		return fmt.Errorf("export keys %s do not match the key %s of table %s",
+			describeAttributes(attrs), describeKeys(t.KeySchema), t.Name)
+	}
+	return nil
+}
+
+// describeAttributes lists attribute names and types, e.g. "{PK (S), SK (N)}";
+// larger items are described by their attribute count.
+func describeAttributes(attrs map[string]types.AttributeValue) string {
+	if len(attrs) > 5 {
+		return fmt.Sprintf("with %d attributes", len(attrs))
+	}
+	parts := make([]string, 0, len(attrs))
+	for name, v := range attrs {
+		parts = append(parts, KeyAttribute{Name: name, Type: attributeType(v)}.String())
+	}
+	slices.Sort(parts)
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// attributeType returns the DynamoDB type descriptor of v, e.g. "S".
+func attributeType(v types.AttributeValue) string {
+	switch v.(type) {
+	case *types.AttributeValueMemberS:
+		return "S"
+	case *types.AttributeValueMemberN:
+		return "N"
+	case *types.AttributeValueMemberB:
+		return "B"
+	case *types.AttributeValueMemberBOOL:
+		return "BOOL"
+	case *types.AttributeValueMemberNULL:
+		return "NULL"
+	case *types.AttributeValueMemberM:
+		return "M"
+	case *types.AttributeValueMemberL:
+		return "L"
+	case *types.AttributeValueMemberSS:
+		return "SS"
+	case *types.AttributeValueMemberNS:
+		return "NS"
+	case *types.AttributeValueMemberBS:
+		return "BS"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
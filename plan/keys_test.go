@@ -0,0 +1,92 @@
+package plan
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// compositeTable describes a table keyed by PK (S) and SK (N).
+func compositeTable() *types.TableDescription {
+	return &types.TableDescription{
+		// Range key listed first to check the partition key is still reported first
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: awssdk.String("SK"), KeyType: types.KeyTypeRange},
+			{AttributeName: awssdk.String("PK"), KeyType: types.KeyTypeHash},
+		},
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: awssdk.String("PK"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: awssdk.String("SK"), AttributeType: types.ScalarAttributeTypeN},
+			{AttributeName: awssdk.String("GSI1PK"), AttributeType: types.ScalarAttributeTypeS},
+		},
+	}
+}
+
+// TestDescribeTableKeySchema checks the key schema is taken from the table
+// description with types from its attribute definitions, partition key first.
+func TestDescribeTableKeySchema(t *testing.T) {
+	info, err := DescribeTable(context.Background(), &fakeDescriber{table: compositeTable()}, "orders", "us-west-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []KeyAttribute{{Name: "PK", Type: "S", Role: "HASH"}, {Name: "SK", Type: "N", Role: "RANGE"}}
+	if len(info.KeySchema) != 2 || info.KeySchema[0] != want[0] || info.KeySchema[1] != want[1] {
+		t.Errorf("KeySchema = %v, want %v", info.KeySchema, want)
+	}
+}
+
+// TestCheckKeys covers the mismatches that would otherwise fail writes mid-run:
+// a missing key attribute, a key of the wrong type, and explicit keys of a
+// table with a different key. Full-export items are checked by their image.
+func TestCheckKeys(t *testing.T) {
+	table := TableInfo{Name: "orders", KeySchema: []KeyAttribute{{Name: "PK", Type: "S", Role: "HASH"}, {Name: "SK", Type: "N", Role: "RANGE"}}}
+	s := func(v string) types.AttributeValue { return &types.AttributeValueMemberS{Value: v} }
+	n := func(v string) types.AttributeValue { return &types.AttributeValueMemberN{Value: v} }
+
+	tests := []struct {
+		name string
+		op   itemimage.Operation
+		want string // Error substring; empty if the keys match
+	}{
+		{"full export item", itemimage.Operation{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"PK": s("a"), "SK": n("1"), "name": s("x")}}, ""},
+		{"incremental keys", itemimage.Operation{Type: itemimage.OpDelete, Keys: map[string]types.AttributeValue{"PK": s("a"), "SK": n("1")}}, ""},
+		{"missing range key", itemimage.Operation{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"PK": s("a")}}, "lacks key attribute SK (N)"},
+		{"wrong type", itemimage.Operation{Type: itemimage.OpDelete, Keys: map[string]types.AttributeValue{"PK": s("a"), "SK": s("1")}}, "SK of table orders is N but the export has S"},
+		{"extra key", itemimage.Operation{Type: itemimage.OpDelete, Keys: map[string]types.AttributeValue{"PK": s("a"), "SK": n("1"), "TS": n("2")}}, "do not match the key PK (S), SK (N)"},
+		{"different key names", itemimage.Operation{Type: itemimage.OpUpdate, Keys: map[string]types.AttributeValue{"id": s("a")}}, "export keys {id (S)} lacks key attribute PK (S)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := table.CheckKeys(tt.op)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestCompareKeySchemas checks that a target table keyed differently from the
+// exported table is reported, and that unknown schemas are not.
+func TestCompareKeySchemas(t *testing.T) {
+	source := TableInfo{Name: "arn:aws:dynamodb:us-west-2:123456789012:table/orders", KeySchema: []KeyAttribute{{Name: "PK", Type: "S", Role: "HASH"}}}
+	if err := CompareKeySchemas(source, TableInfo{Name: "copy", KeySchema: source.KeySchema}); err != nil {
+		t.Errorf("unexpected error for identical keys: %v", err)
+	}
+	if err := CompareKeySchemas(source, TableInfo{Name: "copy"}); err != nil {
+		t.Errorf("unexpected error for an unknown target key: %v", err)
+	}
+	err := CompareKeySchemas(source, TableInfo{Name: "copy", KeySchema: []KeyAttribute{{Name: "PK", Type: "N", Role: "HASH"}}})
+	if err == nil || !strings.Contains(err.Error(), "table copy has key PK (N) but the exported table") {
+		t.Errorf("error = %v, want a key mismatch", err)
+	}
+}
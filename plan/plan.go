@@ -0,0 +1,180 @@
+// Package plan describes what a restore will do before it writes anything: the
+// export to read, the tables to write and the write capacity it will consume.
+// Global tables are detected here because every write to them is replicated to
+// each replica region, multiplying the cost of a restore.
+package plan
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/manifest"
+)
+
+// writeUnitBytes is the item size covered by one write capacity unit.
+const writeUnitBytes = 1024
+
+// TableDescriber is the subset of the DynamoDB client used to inspect target tables.
+type TableDescriber interface {
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+}
+
+// TableInfo describes a target table.
+type TableInfo struct {
+	Name           string   `json:"name"`                     // Table name
+	BillingMode    string   `json:"billingMode"`              // PROVISIONED or PAY_PER_REQUEST
+	Regions        []string `json:"regions,omitempty"`        // Regions holding a replica, sorted; empty unless a global table
+	ProvisionedWCU int64    `json:"provisionedWcu,omitempty"` // Provisioned write capacity; 0 for on-demand
+	ItemCount      int64    `json:"itemCount,omitempty"`      // Items in the table, updated by DynamoDB about every six hours
+
+	KeySchema    []KeyAttribute `json:"keySchema,omitempty"`    // Primary key, partition key first
+	LocalIndexes []string       `json:"localIndexes,omitempty"` // Local secondary indexes, sorted; they limit each partition key's items to 10 GB
+}
+
+// IsGlobal reports whether the table replicates its writes to other regions.
+func (t TableInfo) IsGlobal() bool {
+	return len(t.Regions) > 1
+}
+
+// DescribeTable looks up table, which is reached through a client in region.
+// Example:
+//
+//	info, err := plan.DescribeTable(ctx, client, "my-table", "us-west-2")
+//	if err != nil {
+//	    return err
+//	}
+//	if info.IsGlobal() {
+//	    fmt.Printf("writes replicate to %v\n", info.Regions)
+//	}
+func DescribeTable(ctx context.Context, client TableDescriber, table, region string) (TableInfo, error) {
+	out, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &table})
+	if err != nil {
+		return TableInfo{}, fmt.Errorf("failed to describe table %s: %w", table, err)
+	}
+	return tableInfo(table, region, out.Table), nil
+}
+
+// tableInfo extracts TableInfo from a table description.
+func tableInfo(table, region string, desc *types.TableDescription) TableInfo {
+	info := TableInfo{Name: table, BillingMode: string(types.BillingModeProvisioned)}
+	if desc == nil {
+		return info
+	}
+	if desc.BillingModeSummary != nil && desc.BillingModeSummary.BillingMode != "" {
+		info.BillingMode = string(desc.BillingModeSummary.BillingMode)
+	}
+	if info.BillingMode == string(types.BillingModeProvisioned) && desc.ProvisionedThroughput != nil &&
+		desc.ProvisionedThroughput.WriteCapacityUnits != nil {
+		info.ProvisionedWCU = *desc.ProvisionedThroughput.WriteCapacityUnits
+	}
+	info.KeySchema = keySchema(desc)
+	info.ItemCount = awssdk.ToInt64(desc.ItemCount)
+	for _, lsi := range desc.LocalSecondaryIndexes {
+		info.LocalIndexes = append(info.LocalIndexes, awssdk.ToString(lsi.IndexName))
+	}
+	slices.Sort(info.LocalIndexes)
+
+	// Depending on the global tables version the replica list may or may not
+	// include the table's own region, so it is added explicitly
+	if len(desc.Replicas) > 0 {
+		info.Regions = []string{region}
+		for _, r := range desc.Replicas {
+			if r.RegionName != nil && !slices.Contains(info.Regions, *r.RegionName) {
+				info.Regions = append(info.Regions, *r.RegionName)
+			}
+		}
+		slices.Sort(info.Regions)
+	}
+	return info
+}
+
+// Target is the estimated write cost of restoring the export into one table.
+type Target struct {
+	TableInfo
+	WriteUnits           int64         `json:"writeUnits"`                    // Write units consumed in the table's own region
+	ReplicatedWriteUnits int64         `json:"replicatedWriteUnits"`          // Replicated write units consumed in the other replica regions
+	ProvisionedDuration  time.Duration `json:"provisionedDuration,omitempty"` // Minimum restore time at the provisioned WCU; 0 for on-demand
+}
+
+// TotalWriteUnits returns the write units consumed across all regions.
+func (t Target) TotalWriteUnits() int64 {
+	return t.WriteUnits + t.ReplicatedWriteUnits
+}
+
+// Plan summarises a restore before it starts.
+type Plan struct {
+	ExportARN   string   `json:"exportArn"`   // Export being restored
+	ExportType  string   `json:"exportType"`  // FULL or INCREMENTAL
+	PointInTime string   `json:"pointInTime"` // Time the export's data reflects
+	Files       int      `json:"files"`       // Data files to read
+	Items       int64    `json:"items"`       // Items in the export
+	Bytes       int64    `json:"bytes"`       // Billed size of the export
+	Targets     []Target `json:"targets"`     // Tables to write, in restore order
+}
+
+// New estimates the cost of restoring the export described by summary into tables.
+// Each item costs one write unit per started KB of the export's average item size,
+// once in the table's region and once more in every other replica region.
+// Example:
+//
+//	p := plan.New(summary, []plan.TableInfo{info})
+//	fmt.Println(p)
+func New(summary manifest.Summary, tables []TableInfo) Plan {
+	p := Plan{
+		ExportARN:   summary.ExportARN,
+		ExportType:  summary.ExportType,
+		PointInTime: summary.PointInTime(),
+		Files:       len(summary.DataFiles),
+		Items:       summary.ItemCount,
+		Bytes:       summary.BilledSizeBytes,
+	}
+
+	unitsPerItem := int64(1)
+	if summary.ItemCount > 0 && summary.BilledSizeBytes > 0 {
+		avg := (summary.BilledSizeBytes + summary.ItemCount - 1) / summary.ItemCount
+		unitsPerItem = (avg + writeUnitBytes - 1) / writeUnitBytes
+	}
+
+	for _, info := range tables {
+		t := Target{TableInfo: info, WriteUnits: summary.ItemCount * unitsPerItem}
+		if info.IsGlobal() {
+			t.ReplicatedWriteUnits = t.WriteUnits * int64(len(info.Regions)-1)
+		}
+		if info.ProvisionedWCU > 0 {
+			t.ProvisionedDuration = time.Duration(t.WriteUnits/info.ProvisionedWCU) * time.Second
+		}
+		p.Targets = append(p.Targets, t)
+	}
+	return p
+}
+
+// String renders the plan for the console.
+func (p Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Export: %s (%s, as of %s)\n", p.ExportARN, p.ExportType, p.PointInTime)
+	fmt.Fprintf(&b, "Items: %d in %d files, %d bytes\n", p.Items, p.Files, p.Bytes)
+	for _, t := range p.Targets {
+		fmt.Fprintf(&b, "Table %s (%s): %d write units", t.Name, t.BillingMode, t.WriteUnits)
+		if t.IsGlobal() {
+			fmt.Fprintf(&b, " + %d replicated write units in %d other regions = %d total",
+				t.ReplicatedWriteUnits, len(t.Regions)-1, t.TotalWriteUnits())
+		}
+		if t.ProvisionedDuration > 0 {
+			fmt.Fprintf(&b, ", at least %s at %d provisioned WCU", t.ProvisionedDuration, t.ProvisionedWCU)
+		}
+		b.WriteString("\n")
+		if t.IsGlobal() {
+			fmt.Fprintf(&b, "  Global table: writes replicate to %s\n", strings.Join(t.Regions, ", "))
+		}
+		if len(t.LocalIndexes) > 0 {
+			fmt.Fprintf(&b, "  Local secondary indexes %s: each partition key holds at most 10 GB\n", strings.Join(t.LocalIndexes, ", "))
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
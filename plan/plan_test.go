@@ -0,0 +1,115 @@
+package plan
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/manifest"
+)
+
+type fakeDescriber struct {
+	table *types.TableDescription
+	err   error
+}
+
+func (f *fakeDescriber) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	return &dynamodb.DescribeTableOutput{Table: f.table}, f.err
+}
+
+func replicas(regions ...string) []types.ReplicaDescription {
+	var out []types.ReplicaDescription
+	for _, r := range regions {
+		out = append(out, types.ReplicaDescription{RegionName: awssdk.String(r)})
+	}
+	return out
+}
+
+// TestDescribeTableDetectsGlobalTables checks replica regions are collected,
+// whether or not DescribeTable lists the local region among the replicas, and
+// local secondary indexes are listed.
+func TestDescribeTableDetectsGlobalTables(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas []types.ReplicaDescription
+		want     []string
+	}{
+		{"regional table", nil, nil},
+		{"replicas exclude local region", replicas("eu-west-1", "ap-southeast-2"), []string{"ap-southeast-2", "eu-west-1", "us-west-2"}},
+		{"replicas include local region", replicas("us-west-2", "eu-west-1"), []string{"eu-west-1", "us-west-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeDescriber{table: &types.TableDescription{
+				BillingModeSummary: &types.BillingModeSummary{BillingMode: types.BillingModePayPerRequest},
+				Replicas:           tt.replicas,
+				LocalSecondaryIndexes: []types.LocalSecondaryIndexDescription{
+					{IndexName: awssdk.String("byStatus")}, {IndexName: awssdk.String("byDate")},
+				},
+			}}
+			info, err := DescribeTable(context.Background(), client, "orders", "us-west-2")
+			if err != nil {
+				t.Fatalf("DescribeTable: %v", err)
+			}
+			if strings.Join(info.Regions, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected regions %v, got %v", tt.want, info.Regions)
+			}
+			if info.IsGlobal() != (tt.want != nil) {
+				t.Errorf("unexpected IsGlobal %v", info.IsGlobal())
+			}
+			if strings.Join(info.LocalIndexes, ",") != "byDate,byStatus" {
+				t.Errorf("expected sorted local indexes, got %v", info.LocalIndexes)
+			}
+			if info.BillingMode != "PAY_PER_REQUEST" {
+				t.Errorf("unexpected billing mode %s", info.BillingMode)
+			}
+		})
+	}
+
+	if _, err := DescribeTable(context.Background(), &fakeDescriber{err: errors.New("AccessDenied")}, "orders", "us-west-2"); err == nil {
+		t.Error("expected DescribeTable errors to be returned")
+	}
+}
+
+// TestNewMultipliesWritesByReplicas verifies the cost estimate rounds item sizes
+// up to whole write units and charges replicated writes per extra region.
+func TestNewMultipliesWritesByReplicas(t *testing.T) {
+	summary := manifest.Summary{
+		ExportARN:       "arn:aws:dynamodb:us-west-2:123456789012:table/orders/export/1",
+		ExportType:      "FULL_EXPORT",
+		ExportTime:      "2024-01-01T00:00:00Z",
+		ItemCount:       1000,
+		BilledSizeBytes: 1500 * 1000, // 1.5 KB per item = 2 write units
+		DataFiles:       []manifest.FileMeta{{Key: "a"}, {Key: "b"}},
+	}
+	p := New(summary, []TableInfo{
+		{Name: "orders", BillingMode: "PROVISIONED", ProvisionedWCU: 100},
+		{Name: "orders-global", BillingMode: "PAY_PER_REQUEST", Regions: []string{"eu-west-1", "us-east-1", "us-west-2"}, LocalIndexes: []string{"byDate"}},
+	})
+
+	regional, global := p.Targets[0], p.Targets[1]
+	if regional.WriteUnits != 2000 || regional.ReplicatedWriteUnits != 0 || regional.ProvisionedDuration != 20*time.Second {
+		t.Errorf("unexpected regional estimate %+v", regional)
+	}
+	if global.WriteUnits != 2000 || global.ReplicatedWriteUnits != 4000 || global.TotalWriteUnits() != 6000 {
+		t.Errorf("unexpected global estimate %+v", global)
+	}
+
+	out := p.String()
+	for _, want := range []string{
+		"Items: 1000 in 2 files",
+		"Table orders (PROVISIONED): 2000 write units, at least 20s at 100 provisioned WCU",
+		"+ 4000 replicated write units in 2 other regions = 6000 total",
+		"Global table: writes replicate to eu-west-1, us-east-1, us-west-2",
+		"Local secondary indexes byDate: each partition key holds at most 10 GB",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in plan:\n%s", want, out)
+		}
+	}
+}
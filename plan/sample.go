@@ -0,0 +1,229 @@
+package plan
+
+import (
+	"cmp"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// Sampler gathers statistics on the items of an export from a sample of them,
+// for capacity planning and schema audits: item sizes, and per attribute how
+// often it is present, its types, sizes, set sizes and distinct values. It is
+// not safe for concurrent use.
+// Example:
+//
+//	s := plan.NewSampler()
+//	s.Add(op.NewImage)
+//	fmt.Println(s.Stats())
+type Sampler struct {
+	sizes []int64 // Size of every item added
+	attrs map[string]*attributeSample
+}
+
+// attributeSample accumulates the values of one attribute.
+type attributeSample struct {
+	count    int
+	bytes    int64
+	maxBytes int64
+	types    map[string]int
+	sets     int // Set values, whose members are counted in members
+	members  int
+	maxSet   int
+	distinct map[uint64]struct{} // Hashes of the values seen
+}
+
+// NewSampler creates an empty Sampler.
+func NewSampler() *Sampler {
+	return &Sampler{attrs: make(map[string]*attributeSample)}
+}
+
+// Add records one item. Empty images, such as those of deletes, are ignored.
+func (s *Sampler) Add(item map[string]types.AttributeValue) {
+	if len(item) == 0 {
+		return
+	}
+	s.sizes = append(s.sizes, itemimage.ItemSize(item))
+	for name, av := range item {
+		a, ok := s.attrs[name]
+		if !ok {
+			a = &attributeSample{types: make(map[string]int), distinct: make(map[uint64]struct{})}
+			s.attrs[name] = a
+		}
+		a.count++
+		size := itemimage.AttributeSize(av)
+		a.bytes += size
+		a.maxBytes = max(a.maxBytes, size)
+		a.types[typeOf(av)]++
+		if n, ok := setSize(av); ok {
+			a.sets++
+			a.members += n
+			a.maxSet = max(a.maxSet, n)
+		}
+		a.distinct[valueHash(av)] = struct{}{}
+	}
+}
+
+// Stats returns the statistics of the items added so far.
+func (s *Sampler) Stats() SampleStats {
+	st := SampleStats{Items: len(s.sizes)}
+	if st.Items == 0 {
+		return st
+	}
+	sizes := slices.Clone(s.sizes)
+	slices.Sort(sizes)
+	var total int64
+	for _, n := range sizes {
+		total += n
+	}
+	st.AvgItemBytes = total / int64(len(sizes))
+	st.P50ItemBytes = percentile(sizes, 50)
+	st.P90ItemBytes = percentile(sizes, 90)
+	st.P99ItemBytes = percentile(sizes, 99)
+	st.MaxItemBytes = sizes[len(sizes)-1]
+
+	for name, a := range s.attrs {
+		as := AttributeStats{
+			Name:      name,
+			Items:     a.count,
+			Frequency: float64(a.count) / float64(st.Items),
+			Types:     a.types,
+			AvgBytes:  a.bytes / int64(a.count),
+			MaxBytes:  a.maxBytes,
+			Distinct:  len(a.distinct),
+			MaxSet:    a.maxSet,
+		}
+		if a.sets > 0 {
+			as.AvgSet = float64(a.members) / float64(a.sets)
+		}
+		st.Attributes = append(st.Attributes, as)
+	}
+	slices.SortFunc(st.Attributes, func(a, b AttributeStats) int {
+		return cmp.Or(cmp.Compare(b.Items, a.Items), cmp.Compare(a.Name, b.Name))
+	})
+	return st
+}
+
+// SampleStats are the statistics of a sample of items. Sizes approximate the
+// bytes DynamoDB bills, as itemimage.ItemSize does.
+type SampleStats struct {
+	Items        int              `json:"items"`        // Items sampled
+	AvgItemBytes int64            `json:"avgItemBytes"` // Mean item size
+	P50ItemBytes int64            `json:"p50ItemBytes"` // Median item size
+	P90ItemBytes int64            `json:"p90ItemBytes"` // 90th percentile item size
+	P99ItemBytes int64            `json:"p99ItemBytes"` // 99th percentile item size
+	MaxItemBytes int64            `json:"maxItemBytes"` // Largest item
+	Attributes   []AttributeStats `json:"attributes"`   // Attributes, most frequent first
+}
+
+// AttributeStats describes one attribute across a sample.
+type AttributeStats struct {
+	Name      string         `json:"name"`             // Attribute name
+	Items     int            `json:"items"`            // Sampled items holding the attribute
+	Frequency float64        `json:"frequency"`        // Share of sampled items holding the attribute
+	Types     map[string]int `json:"types"`            // Values by DynamoDB type (S, N, B, SS, NS, BS, L, M, BOOL, NULL)
+	AvgBytes  int64          `json:"avgBytes"`         // Mean value size
+	MaxBytes  int64          `json:"maxBytes"`         // Largest value
+	Distinct  int            `json:"distinct"`         // Distinct values in the sample, a lower bound of the cardinality
+	AvgSet    float64        `json:"avgSet,omitempty"` // Mean members of set values
+	MaxSet    int            `json:"maxSet,omitempty"` // Most members of a set value
+}
+
+// String renders the statistics for the console.
+func (s SampleStats) String() string {
+	if s.Items == 0 {
+		return "Sampled no items"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Sampled %d items: item size avg %d, p50 %d, p90 %d, p99 %d, max %d bytes\n",
+		s.Items, s.AvgItemBytes, s.P50ItemBytes, s.P90ItemBytes, s.P99ItemBytes, s.MaxItemBytes)
+	for _, a := range s.Attributes {
+		names := make([]string, 0, len(a.Types))
+		for t := range a.Types {
+			names = append(names, t)
+		}
+		slices.Sort(names)
+		types := make([]string, len(names))
+		for i, t := range names {
+			types[i] = fmt.Sprintf("%s %d", t, a.Types[t])
+		}
+		fmt.Fprintf(&b, "  %s: in %.1f%% of items, %s, avg %d max %d bytes, %d distinct",
+			a.Name, a.Frequency*100, strings.Join(types, ", "), a.AvgBytes, a.MaxBytes, a.Distinct)
+		if a.MaxSet > 0 {
+			fmt.Fprintf(&b, ", sets avg %.1f max %d members", a.AvgSet, a.MaxSet)
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted.
+func percentile(sorted []int64, p int) int64 {
+	i := (len(sorted)*p + 99) / 100
+	return sorted[max(i-1, 0)]
+}
+
+// typeOf returns the DynamoDB type descriptor of av.
+func typeOf(av types.AttributeValue) string {
+	switch av.(type) {
+	case *types.AttributeValueMemberS:
+		return "S"
+	case *types.AttributeValueMemberN:
+		return "N"
+	case *types.AttributeValueMemberB:
+		return "B"
+	case *types.AttributeValueMemberSS:
+		return "SS"
+	case *types.AttributeValueMemberNS:
+		return "NS"
+	case *types.AttributeValueMemberBS:
+		return "BS"
+	case *types.AttributeValueMemberL:
+		return "L"
+	case *types.AttributeValueMemberM:
+		return "M"
+	case *types.AttributeValueMemberBOOL:
+		return "BOOL"
+	case *types.AttributeValueMemberNULL:
+		return "NULL"
+	}
+	return fmt.Sprintf("%T", av)
+}
+
+// valueHash returns a hash of av with its type, so values are counted as
+// distinct by their hash. Documents are hashed as DynamoDB JSON.
+func valueHash(av types.AttributeValue) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(typeOf(av)))
+	h.Write([]byte{0})
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		h.Write([]byte(v.Value))
+	case *types.AttributeValueMemberN:
+		h.Write([]byte(v.Value))
+	case *types.AttributeValueMemberB:
+		h.Write(v.Value)
+	default:
+		data, _ := attributevalue.MarshalJSON(av)
+		h.Write(data)
+	}
+	return h.Sum64()
+}
+
+// setSize returns the members of a set value, and whether av is a set.
+func setSize(av types.AttributeValue) (int, bool) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberSS:
+		return len(v.Value), true
+	case *types.AttributeValueMemberNS:
+		return len(v.Value), true
+	case *types.AttributeValueMemberBS:
+		return len(v.Value), true
+	}
+	return 0, false
+}
@@ -0,0 +1,61 @@
+package plan
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TestSamplerStats verifies item size percentiles and per-attribute frequency,
+// types, set sizes and distinct values, and that deletes without an image are
+// not counted as items.
+func TestSamplerStats(t *testing.T) {
+	s := NewSampler()
+	for i := range 100 {
+		item := map[string]types.AttributeValue{
+			"pk":   &types.AttributeValueMemberS{Value: fmt.Sprintf("order#%03d", i)}, // 2 + 9 bytes
+			"body": &types.AttributeValueMemberS{Value: strings.Repeat("x", i)},
+		}
+		if i%4 == 0 {
+			item["tags"] = &types.AttributeValueMemberSS{Value: []string{"a", "b", "c"}[:1+i%3]}
+		}
+		if i%2 == 0 {
+			item["qty"] = &types.AttributeValueMemberN{Value: "1"}
+		} else {
+			item["qty"] = &types.AttributeValueMemberS{Value: "one"}
+		}
+		s.Add(item)
+	}
+	s.Add(nil)
+
+	st := s.Stats()
+	if st.Items != 100 {
+		t.Fatalf("expected 100 items, got %d", st.Items)
+	}
+	if st.MaxItemBytes <= st.P90ItemBytes || st.P90ItemBytes <= st.P50ItemBytes || st.P50ItemBytes < st.AvgItemBytes-10 {
+		t.Errorf("unexpected size distribution: %+v", st)
+	}
+
+	byName := make(map[string]AttributeStats)
+	for _, a := range st.Attributes {
+		byName[a.Name] = a
+	}
+	if st.Attributes[len(st.Attributes)-1].Name != "tags" {
+		t.Errorf("expected the rarest attribute last, got %v", st.Attributes)
+	}
+	if pk := byName["pk"]; pk.Frequency != 1 || pk.Distinct != 100 {
+		t.Errorf("expected pk in every item with 100 distinct values, got %+v", pk)
+	}
+	if qty := byName["qty"]; qty.Types["N"] != 50 || qty.Types["S"] != 50 || qty.Distinct != 2 {
+		t.Errorf("expected qty split between N and S with 2 distinct values, got %+v", qty)
+	}
+	// Items 0, 4, 8... hold 1, 2, 3, 1... members
+	if tags := byName["tags"]; tags.Items != 25 || tags.MaxSet != 3 || tags.AvgSet < 1.9 || tags.AvgSet > 2.1 {
+		t.Errorf("unexpected tags stats: %+v", tags)
+	}
+	if out := st.String(); !strings.Contains(out, "Sampled 100 items") || !strings.Contains(out, "tags: in 25.0% of items, SS 25") {
+		t.Errorf("unexpected rendering:\n%s", out)
+	}
+}
@@ -0,0 +1,72 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// StreamEnabler is the subset of the DynamoDB client used to enable the stream
+// of a target table.
+type StreamEnabler interface {
+	TableDescriber
+	UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error)
+}
+
+// StreamViewType returns the view type of table's stream, or "" if streams are
+// disabled.
+// Example:
+//
+//	viewType, err := plan.StreamViewType(ctx, client, summary.TableARN)
+func StreamViewType(ctx context.Context, client TableDescriber, table string) (string, error) {
+	out, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &table})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe table %s: %w", table, err)
+	}
+	if out.Table == nil || out.Table.StreamSpecification == nil || !awssdk.ToBool(out.Table.StreamSpecification.StreamEnabled) {
+		return "", nil
+	}
+	return string(out.Table.StreamSpecification.StreamViewType), nil
+}
+
+// EnableStream enables the stream of table with viewType and returns its ARN.
+// A stream already enabled with viewType is kept. One with another view type
+// is an error: DynamoDB changes the view type only by disabling the stream,
+// which would cut off its current consumers.
+// Example:
+//
+//	arn, err := plan.EnableStream(ctx, client, "my-table", "NEW_AND_OLD_IMAGES")
+//	if err != nil {
+//	    return err
+//	}
+//	fmt.Printf("Stream of my-table: %s\n", arn)
+func EnableStream(ctx context.Context, client StreamEnabler, table, viewType string) (string, error) {
+	out, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &table})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe table %s: %w", table, err)
+	}
+	if desc := out.Table; desc != nil && desc.StreamSpecification != nil && awssdk.ToBool(desc.StreamSpecification.StreamEnabled) {
+		if current := string(desc.StreamSpecification.StreamViewType); current != viewType {
+			return "", fmt.Errorf("table %s already has a %s stream; disable it to enable a %s stream", table, current, viewType)
+		}
+		return awssdk.ToString(desc.LatestStreamArn), nil
+	}
+
+	update, err := client.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+		TableName: &table,
+		StreamSpecification: &types.StreamSpecification{
+			StreamEnabled:  awssdk.Bool(true),
+			StreamViewType: types.StreamViewType(viewType),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to enable the stream of table %s: %w", table, err)
+	}
+	if update.TableDescription == nil || update.TableDescription.LatestStreamArn == nil {
+		return "", fmt.Errorf("enabling the stream of table %s returned no stream ARN", table)
+	}
+	return *update.TableDescription.LatestStreamArn, nil
+}
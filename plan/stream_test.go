@@ -0,0 +1,80 @@
+package plan
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeStreamEnabler records UpdateTable calls and answers them with a new
+// stream ARN.
+type fakeStreamEnabler struct {
+	fakeDescriber
+	updates []*dynamodb.UpdateTableInput
+}
+
+func (f *fakeStreamEnabler) UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error) {
+	f.updates = append(f.updates, params)
+	arn := "arn:aws:dynamodb:us-west-2:123456789012:table/" + *params.TableName + "/stream/2024-05-01T12:00:00.000"
+	return &dynamodb.UpdateTableOutput{TableDescription: &types.TableDescription{LatestStreamArn: &arn}}, nil
+}
+
+// streaming returns a table description with a stream of viewType.
+func streaming(viewType types.StreamViewType, arn string) *types.TableDescription {
+	return &types.TableDescription{
+		StreamSpecification: &types.StreamSpecification{StreamEnabled: awssdk.Bool(true), StreamViewType: viewType},
+		LatestStreamArn:     awssdk.String(arn),
+	}
+}
+
+// TestEnableStream checks a table without a stream gets one with the requested
+// view type and its ARN is returned.
+func TestEnableStream(t *testing.T) {
+	client := &fakeStreamEnabler{fakeDescriber: fakeDescriber{table: &types.TableDescription{}}}
+	arn, err := EnableStream(context.Background(), client, "orders", "NEW_AND_OLD_IMAGES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(arn, "arn:aws:dynamodb:us-west-2:123456789012:table/orders/stream/") {
+		t.Errorf("unexpected stream ARN %s", arn)
+	}
+	if len(client.updates) != 1 || client.updates[0].StreamSpecification.StreamViewType != types.StreamViewTypeNewAndOldImages ||
+		!awssdk.ToBool(client.updates[0].StreamSpecification.StreamEnabled) {
+		t.Errorf("expected one update enabling a NEW_AND_OLD_IMAGES stream, got %+v", client.updates)
+	}
+}
+
+// TestEnableStreamKeepsExisting checks a stream already enabled with the view
+// type is kept, so a rerun does not touch the table, while one with another
+// view type is refused rather than replaced under its consumers.
+func TestEnableStreamKeepsExisting(t *testing.T) {
+	existing := "arn:aws:dynamodb:us-west-2:123456789012:table/orders/stream/2023-01-01T00:00:00.000"
+	client := &fakeStreamEnabler{fakeDescriber: fakeDescriber{table: streaming(types.StreamViewTypeNewImage, existing)}}
+	arn, err := EnableStream(context.Background(), client, "orders", "NEW_IMAGE")
+	if err != nil || arn != existing {
+		t.Errorf("expected the existing stream %s, got %s, %v", existing, arn, err)
+	}
+	if _, err := EnableStream(context.Background(), client, "orders", "KEYS_ONLY"); err == nil {
+		t.Error("expected error for a stream with another view type")
+	}
+	if len(client.updates) != 0 {
+		t.Errorf("expected no updates, got %d", len(client.updates))
+	}
+}
+
+// TestStreamViewType checks the view type of the exported table's stream is
+// read, and a table without a stream reports none.
+func TestStreamViewType(t *testing.T) {
+	client := &fakeDescriber{table: streaming(types.StreamViewTypeNewAndOldImages, "arn")}
+	if viewType, err := StreamViewType(context.Background(), client, "orders"); err != nil || viewType != "NEW_AND_OLD_IMAGES" {
+		t.Errorf("expected NEW_AND_OLD_IMAGES, got %q, %v", viewType, err)
+	}
+	client = &fakeDescriber{table: &types.TableDescription{}}
+	if viewType, err := StreamViewType(context.Background(), client, "orders"); err != nil || viewType != "" {
+		t.Errorf("expected no stream, got %q, %v", viewType, err)
+	}
+}
@@ -0,0 +1,79 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxTagsPerRequest is the number of tags DynamoDB's TagResource takes at once.
+const maxTagsPerRequest = 50
+
+// TableTagger is the subset of the DynamoDB client used to copy tags from the
+// exported table to the target tables.
+type TableTagger interface {
+	TableDescriber
+	ListTagsOfResource(ctx context.Context, params *dynamodb.ListTagsOfResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTagsOfResourceOutput, error)
+	TagResource(ctx context.Context, params *dynamodb.TagResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TagResourceOutput, error)
+}
+
+// TableTags returns the tags of the table with tableARN. Tags whose key starts
+// with "aws:" are left out: AWS sets them, and they cannot be copied.
+// Example:
+//
+//	tags, err := plan.TableTags(ctx, client, summary.TableARN)
+func TableTags(ctx context.Context, client TableTagger, tableARN string) (map[string]string, error) {
+	tags := make(map[string]string)
+	input := &dynamodb.ListTagsOfResourceInput{ResourceArn: &tableARN}
+	for {
+		out, err := client.ListTagsOfResource(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of table %s: %w", tableARN, err)
+		}
+		for _, tag := range out.Tags {
+			if key := awssdk.ToString(tag.Key); !strings.HasPrefix(key, "aws:") {
+				tags[key] = awssdk.ToString(tag.Value)
+			}
+		}
+		if out.NextToken == nil {
+			return tags, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+// TagTable adds tags to table, replacing the values of tags it already has.
+// Example:
+//
+//	err := plan.TagTable(ctx, client, "my-table", map[string]string{"team": "payments"})
+func TagTable(ctx context.Context, client TableTagger, table string, tags map[string]string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	// TagResource takes the table's ARN, not its name
+	out, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &table})
+	if err != nil {
+		return fmt.Errorf("failed to describe table %s: %w", table, err)
+	}
+	if out.Table == nil || out.Table.TableArn == nil {
+		return fmt.Errorf("table %s has no ARN", table)
+	}
+
+	keys := slices.Sorted(maps.Keys(tags))
+	for chunk := range slices.Chunk(keys, maxTagsPerRequest) {
+		input := &dynamodb.TagResourceInput{ResourceArn: out.Table.TableArn}
+		for _, k := range chunk {
+			input.Tags = append(input.Tags, types.Tag{Key: awssdk.String(k), Value: awssdk.String(tags[k])})
+		}
+		if _, err := client.TagResource(ctx, input); err != nil {
+			return fmt.Errorf("failed to tag table %s: %w", table, err)
+		}
+	}
+	return nil
+}
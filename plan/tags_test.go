@@ -0,0 +1,78 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeTagger lists tags two per page and records TagResource calls.
+type fakeTagger struct {
+	fakeDescriber
+	tags   []types.Tag
+	tagged []*dynamodb.TagResourceInput
+}
+
+func (f *fakeTagger) ListTagsOfResource(ctx context.Context, params *dynamodb.ListTagsOfResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTagsOfResourceOutput, error) {
+	start := 0
+	if params.NextToken != nil {
+		fmt.Sscan(*params.NextToken, &start)
+	}
+	end := min(start+2, len(f.tags))
+	out := &dynamodb.ListTagsOfResourceOutput{Tags: f.tags[start:end]}
+	if end < len(f.tags) {
+		out.NextToken = awssdk.String(fmt.Sprint(end))
+	}
+	return out, nil
+}
+
+func (f *fakeTagger) TagResource(ctx context.Context, params *dynamodb.TagResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TagResourceOutput, error) {
+	f.tagged = append(f.tagged, params)
+	return &dynamodb.TagResourceOutput{}, nil
+}
+
+// TestTableTags checks every page of tags is read and the tags AWS sets, which
+// cannot be copied, are left out.
+func TestTableTags(t *testing.T) {
+	client := &fakeTagger{tags: []types.Tag{
+		{Key: awssdk.String("team"), Value: awssdk.String("payments")},
+		{Key: awssdk.String("aws:cloudformation:stack-name"), Value: awssdk.String("orders")},
+		{Key: awssdk.String("cost-center"), Value: awssdk.String("42")},
+	}}
+	tags, err := TableTags(context.Background(), client, "arn:aws:dynamodb:us-west-2:123456789012:table/orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags["team"] != "payments" || tags["cost-center"] != "42" {
+		t.Errorf("unexpected tags %v", tags)
+	}
+}
+
+// TestTagTable checks tags are added to the table's ARN, at most 50 per
+// request as TagResource allows.
+func TestTagTable(t *testing.T) {
+	arn := "arn:aws:dynamodb:us-west-2:123456789012:table/orders-restored"
+	client := &fakeTagger{fakeDescriber: fakeDescriber{table: &types.TableDescription{TableArn: &arn}}}
+	tags := make(map[string]string)
+	for i := range 60 {
+		tags[fmt.Sprintf("tag-%02d", i)] = "v"
+	}
+	if err := TagTable(context.Background(), client, "orders-restored", tags); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.tagged) != 2 || len(client.tagged[0].Tags) != 50 || len(client.tagged[1].Tags) != 10 {
+		t.Fatalf("expected requests of 50 and 10 tags, got %d requests", len(client.tagged))
+	}
+	if *client.tagged[0].ResourceArn != arn {
+		t.Errorf("expected the table ARN, got %s", *client.tagged[0].ResourceArn)
+	}
+
+	client.tagged = nil
+	if err := TagTable(context.Background(), client, "orders-restored", nil); err != nil || client.tagged != nil {
+		t.Errorf("expected no request without tags, got %v, %v", client.tagged, err)
+	}
+}
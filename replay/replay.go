@@ -0,0 +1,343 @@
+// Package replay applies change records captured from DynamoDB Streams or from
+// Kinesis Data Streams for DynamoDB to a restored table. Replaying the records
+// made after the last export brings the restored table up to the time of the
+// last record, closing the gap between the export and now during DR.
+package replay
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/s3uri"
+	"github.com/gurre/ddb-pitr/transform"
+	"github.com/gurre/ddb-pitr/writer"
+)
+
+// Stream record event names, shared by DynamoDB Streams and Kinesis Data Streams for DynamoDB.
+const (
+	EventInsert = "INSERT"
+	EventModify = "MODIFY"
+	EventRemove = "REMOVE"
+)
+
+// ErrNoNewImage is returned for inserts and modifications recorded without the
+// new item image, by streams with the KEYS_ONLY or OLD_IMAGE view type.
+var ErrNoNewImage = errors.New("stream record has no NewImage; the stream view type must be NEW_IMAGE or NEW_AND_OLD_IMAGES")
+
+// rawRecord is a stream record as returned by GetRecords or delivered by Kinesis.
+// Both use the same field names; the dynamodb section has the shape of an
+// incremental export line.
+type rawRecord struct {
+	EventID   string          `json:"eventID"`   // Unique ID of the change
+	EventName string          `json:"eventName"` // INSERT, MODIFY or REMOVE
+	Dynamodb  json.RawMessage `json:"dynamodb"`  // Keys, NewImage, OldImage and ApproximateCreationDateTime
+}
+
+// envelope is any top-level JSON value of a dump: a single record, or a
+// GetRecords response holding a page of them.
+type envelope struct {
+	rawRecord
+	Records []rawRecord `json:"Records"` // Page of a GetRecords response
+}
+
+// Reader decodes the stream records of a dump into operations. A dump is a
+// sequence of JSON values, each a record or a GetRecords response, separated
+// by any whitespace; this covers JSON lines, the concatenated records written
+// by Firehose and the pretty-printed output of aws dynamodbstreams get-records.
+type Reader struct {
+	dec     *json.Decoder     // Decoder over the dump
+	images  itemimage.Decoder // Decoder of the DynamoDB JSON in each record
+	pending []rawRecord       // Records of the current GetRecords page not yet returned
+}
+
+// NewReader creates a Reader decoding item images from r with images, so
+// -strict-decode and -sdk-decoder apply to replayed records too.
+// Example:
+//
+//	r := replay.NewReader(f, itemimage.NewJSONDecoder())
+//	for {
+//	    op, err := r.Next()
+//	    if err == io.EOF {
+//	        break
+//	    }
+//	}
+func NewReader(r io.Reader, images itemimage.Decoder) *Reader {
+	// Records name their event, so the section of a REMOVE may carry only Keys
+	return &Reader{dec: json.NewDecoder(r), images: itemimage.ForView(images, itemimage.ViewNewAndOld)}
+}
+
+// Next returns the operation of the next record, or io.EOF after the last.
+// Inserts and modifications are puts of the record's NewImage, which is the
+// whole item; removals are deletes of its Keys. Errors from malformed records
+// wrap itemimage.ErrCorrupt.
+func (r *Reader) Next() (itemimage.Operation, error) {
+	for len(r.pending) == 0 {
+		var e envelope
+		if err := r.dec.Decode(&e); err != nil {
+			if err == io.EOF {
+				return itemimage.Operation{}, io.EOF
+			}
+			return itemimage.Operation{}, fmt.Errorf("%w: %v", itemimage.ErrCorrupt, err)
+		}
+		if e.Records != nil {
+			r.pending = e.Records
+		} else if e.EventName != "" || e.Dynamodb != nil {
+			r.pending = []rawRecord{e.rawRecord}
+		}
+		// Other values, such as an empty page's metadata, hold no records
+	}
+	rec := r.pending[0]
+	r.pending = r.pending[1:]
+	op, err := r.decode(rec)
+	if err != nil {
+		return itemimage.Operation{}, fmt.Errorf("record %s: %w", rec.EventID, err)
+	}
+	return op, nil
+}
+
+// decode converts one stream record into an operation.
+func (r *Reader) decode(rec rawRecord) (itemimage.Operation, error) {
+	if len(rec.Dynamodb) == 0 {
+		return itemimage.Operation{}, fmt.Errorf("%w: no dynamodb section", itemimage.ErrCorrupt)
+	}
+	op, err := r.images.Decode(rec.Dynamodb)
+	if err != nil {
+		return itemimage.Operation{}, err
+	}
+	if op.Keys == nil {
+		return itemimage.Operation{}, fmt.Errorf("%w: no Keys", itemimage.ErrCorrupt)
+	}
+	var meta struct {
+		ApproximateCreationDateTime json.RawMessage `json:"ApproximateCreationDateTime"`
+	}
+	if err := json.Unmarshal(rec.Dynamodb, &meta); err != nil {
+		return itemimage.Operation{}, fmt.Errorf("%w: %v", itemimage.ErrCorrupt, err)
+	}
+	if op.WriteTimestampMicros, err = creationMicros(meta.ApproximateCreationDateTime); err != nil {
+		return itemimage.Operation{}, fmt.Errorf("%w: %v", itemimage.ErrCorrupt, err)
+	}
+
+	switch rec.EventName {
+	case EventInsert, EventModify:
+		if op.NewImage == nil {
+			return itemimage.Operation{}, ErrNoNewImage
+		}
+		// The new image is the whole item, so a put restores it exactly
+		return itemimage.Operation{Type: itemimage.OpPut, Keys: op.Keys, NewImage: op.NewImage,
+			WriteTimestampMicros: op.WriteTimestampMicros}, nil
+	case EventRemove:
+		return itemimage.Operation{Type: itemimage.OpDelete, Keys: op.Keys,
+			WriteTimestampMicros: op.WriteTimestampMicros}, nil
+	default:
+		return itemimage.Operation{}, fmt.Errorf("%w: unknown event name %q", itemimage.ErrCorrupt, rec.EventName)
+	}
+}
+
+// creationMicros converts ApproximateCreationDateTime to Unix microseconds.
+// DynamoDB Streams reports seconds, which the AWS CLI prints as an ISO 8601
+// string, and Kinesis Data Streams reports milliseconds.
+func creationMicros(raw json.RawMessage) (int64, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
+	}
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return 0, err
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ApproximateCreationDateTime: %w", err)
+		}
+		return t.UnixMicro(), nil
+	}
+	v, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ApproximateCreationDateTime: %w", err)
+	}
+	if v >= 1e11 { // Milliseconds; 1e11 seconds is in the year 5138
+		return int64(math.Round(v * 1e3)), nil
+	}
+	return int64(math.Round(v * 1e6)), nil
+}
+
+// Stats counts the records of a replay.
+type Stats struct {
+	Records int64 // Records read
+	Puts    int64 // Puts written to each target
+	Deletes int64 // Deletes written to each target
+	Dropped int64 // Operations dropped by the transformer
+}
+
+// Applier writes the operations of stream records to one or more tables.
+type Applier struct {
+	writers     []writer.Writer       // One writer per target table; none in dry runs
+	batchSize   int                   // Operations per WriteBatch call
+	transformer transform.Transformer // Optional rewrite or filter before writing
+}
+
+// Option configures an Applier.
+type Option func(*Applier)
+
+// WithTransformer runs t on every operation before it is written, so key
+// filters, remapping and redaction apply to replayed records as to the export.
+// Example:
+//
+//	a := replay.NewApplier(writers, 25, replay.WithTransformer(chain))
+func WithTransformer(t transform.Transformer) Option {
+	return func(a *Applier) {
+		a.transformer = t
+	}
+}
+
+// NewApplier creates an Applier writing batches of up to batchSize operations
+// to every writer in turn. With no writers records are only decoded and counted.
+// Example:
+//
+//	a := replay.NewApplier([]writer.Writer{w}, cfg.BatchSize)
+//	stats, err := a.Apply(ctx, replay.NewReader(f, decoder))
+func NewApplier(writers []writer.Writer, batchSize int, opts ...Option) *Applier {
+	a := &Applier{writers: writers, batchSize: batchSize}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Source yields operations in the order they are to be written, then io.EOF.
+// Reader is the Source of stream records.
+type Source interface {
+	Next() (itemimage.Operation, error)
+}
+
+// Apply writes the operations read from r in record order. A batch never holds
+// two operations on one key: BatchWriteItem rejects such batches, and the later
+// change must win, so the batch is written before the second operation joins
+// the next one.
+func (a *Applier) Apply(ctx context.Context, r Source) (Stats, error) {
+	var stats Stats
+	batch := make([]itemimage.Operation, 0, a.batchSize)
+	keys := make(map[string]struct{}, a.batchSize)
+	flush := func() error {
+		for _, w := range a.writers {
+			if err := w.WriteBatch(ctx, batch); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		clear(keys)
+		return nil
+	}
+	for {
+		op, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, err
+		}
+		stats.Records++
+		if a.transformer != nil {
+			var keep bool
+			if op, keep, err = a.transformer.Transform(op); err != nil {
+				return stats, err
+			} else if !keep {
+				stats.Dropped++
+				continue
+			}
+		}
+		key := itemimage.KeyFingerprint(op.Keys)
+		if _, ok := keys[key]; ok || len(batch) == a.batchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+		batch = append(batch, op)
+		keys[key] = struct{}{}
+		if op.Type == itemimage.OpDelete {
+			stats.Deletes++
+		} else {
+			stats.Puts++
+		}
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return stats, err
+		}
+	}
+	for _, w := range a.writers {
+		if err := w.Flush(ctx); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// ObjectGetter is the part of the S3 client needed to read dumps from S3.
+type ObjectGetter interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// Open opens a dump from a local path or an s3:// URI. Gzip-compressed dumps,
+// such as Firehose deliveries, are decompressed transparently.
+// Example:
+//
+//	f, err := replay.Open(ctx, s3Client, "s3://my-bucket/streams/shard-0001.json.gz")
+//	if err != nil {
+//	    return err
+//	}
+//	defer f.Close()
+func Open(ctx context.Context, client ObjectGetter, source string) (io.ReadCloser, error) {
+	var body io.ReadCloser
+	if strings.HasPrefix(source, "s3://") {
+		u, err := s3uri.ParseObject(source)
+		if err != nil {
+			return nil, err
+		}
+		out, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: &u.Bucket, Key: &u.Key})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s: %w", source, err)
+		}
+		body = out.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		body = f
+	}
+
+	br := bufio.NewReader(body)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			body.Close()
+			return nil, fmt.Errorf("failed to decompress %s: %w", source, err)
+		}
+		return readCloser{Reader: gz, close: body.Close}, nil
+	}
+	return readCloser{Reader: br, close: body.Close}, nil
+}
+
+// readCloser closes the underlying dump after reading through a wrapper.
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+// Close closes the underlying dump.
+func (r readCloser) Close() error {
+	return r.close()
+}
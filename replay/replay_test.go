@@ -0,0 +1,181 @@
+package replay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/transform"
+	"github.com/gurre/ddb-pitr/writer"
+)
+
+// dump mixes the formats a dump may hold: a DynamoDB Streams record as a JSON
+// line, a Kinesis record with a millisecond timestamp, and a pretty-printed
+// GetRecords page as printed by the AWS CLI.
+const dump = `{"eventID":"1","eventName":"INSERT","dynamodb":{"ApproximateCreationDateTime":1736848800,"Keys":{"pk":{"S":"a"}},"NewImage":{"pk":{"S":"a"},"v":{"N":"1"}},"SequenceNumber":"100","StreamViewType":"NEW_AND_OLD_IMAGES"}}
+{"awsRegion":"eu-west-1","eventID":"2","eventName":"MODIFY","recordFormat":"application/json","tableName":"t","dynamodb":{"ApproximateCreationDateTime":1736848801500,"Keys":{"pk":{"S":"a"}},"NewImage":{"pk":{"S":"a"},"v":{"N":"2"}},"OldImage":{"pk":{"S":"a"},"v":{"N":"1"}}}}
+{
+    "Records": [
+        {
+            "eventID": "3",
+            "eventName": "REMOVE",
+            "dynamodb": {
+                "ApproximateCreationDateTime": "2025-01-14T10:00:02+00:00",
+                "Keys": {"pk": {"S": "b"}},
+                "OldImage": {"pk": {"S": "b"}}
+            }
+        }
+    ],
+    "NextShardIterator": "AAAA"
+}
+{"Records":[],"NextShardIterator":"BBBB"}
+`
+
+func readAll(t *testing.T, r *Reader) []itemimage.Operation {
+	t.Helper()
+	var ops []itemimage.Operation
+	for {
+		op, err := r.Next()
+		if err == io.EOF {
+			return ops
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		ops = append(ops, op)
+	}
+}
+
+// TestReaderDecodesStreamRecords checks every dump format yields the records in
+// order, with inserts and modifications as puts of the whole new image and
+// removals as deletes, and timestamps normalised from seconds, milliseconds
+// and ISO 8601 to microseconds.
+func TestReaderDecodesStreamRecords(t *testing.T) {
+	ops := readAll(t, NewReader(strings.NewReader(dump), itemimage.NewJSONDecoder()))
+	if len(ops) != 3 {
+		t.Fatalf("got %d operations, want 3", len(ops))
+	}
+	want := []struct {
+		typ    itemimage.OperationType
+		key    string
+		micros int64
+	}{
+		{itemimage.OpPut, "a", 1736848800000000},
+		{itemimage.OpPut, "a", 1736848801500000},
+		{itemimage.OpDelete, "b", 1736848802000000},
+	}
+	for i, w := range want {
+		op := ops[i]
+		if op.Type != w.typ || op.Keys["pk"].(*types.AttributeValueMemberS).Value != w.key || op.WriteTimestampMicros != w.micros {
+			t.Errorf("op %d = %v %v at %d, want %v %s at %d", i, op.Type, op.Keys, op.WriteTimestampMicros, w.typ, w.key, w.micros)
+		}
+		if op.OldImage != nil {
+			t.Errorf("op %d keeps its OldImage; a put of the new image must not become an update", i)
+		}
+	}
+	if got := ops[1].NewImage["v"].(*types.AttributeValueMemberN).Value; got != "2" {
+		t.Errorf("modified v = %s, want 2", got)
+	}
+}
+
+// TestReaderRejectsUnusableRecords checks records that cannot be replayed fail
+// instead of being written wrongly: a KEYS_ONLY insert would otherwise look
+// like the keys-only delete of an export.
+func TestReaderRejectsUnusableRecords(t *testing.T) {
+	cases := map[string]error{
+		`{"eventID":"1","eventName":"INSERT","dynamodb":{"Keys":{"pk":{"S":"a"}}}}`:                                           ErrNoNewImage,
+		`{"eventID":"1","eventName":"TRUNCATE","dynamodb":{"Keys":{"pk":{"S":"a"}}}}`:                                         itemimage.ErrCorrupt,
+		`{"eventID":"1","eventName":"REMOVE"}`:                                                                                itemimage.ErrCorrupt,
+		`{"eventID":"1","eventName":"REMOVE","dynamodb":{"NewImage":{"pk":{"S":"a"}}}}`:                                       itemimage.ErrCorrupt,
+		`{"eventID":"1","eventName":"REMOVE","dynamodb":{"ApproximateCreationDateTime":"yesterday","Keys":{"pk":{"S":"a"}}}}`: itemimage.ErrCorrupt,
+		`{"eventID":"1",`: itemimage.ErrCorrupt,
+	}
+	for line, want := range cases {
+		_, err := NewReader(strings.NewReader(line), itemimage.NewJSONDecoder()).Next()
+		if !errors.Is(err, want) {
+			t.Errorf("Next(%s) error = %v, want %v", line, err, want)
+		}
+	}
+}
+
+type recordingWriter struct {
+	batches [][]itemimage.Operation
+	flushed bool
+}
+
+func (w *recordingWriter) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	w.batches = append(w.batches, append([]itemimage.Operation(nil), ops...))
+	return nil
+}
+
+func (w *recordingWriter) Flush(ctx context.Context) error {
+	w.flushed = true
+	return nil
+}
+
+// TestApplierSplitsBatchesOnRepeatedKeys checks a batch never holds two changes
+// of one item, which BatchWriteItem rejects and which could apply out of order,
+// and that every target table receives the same batches.
+func TestApplierSplitsBatchesOnRepeatedKeys(t *testing.T) {
+	w1, w2 := &recordingWriter{}, &recordingWriter{}
+	a := NewApplier([]writer.Writer{w1, w2}, 25)
+	stats, err := a.Apply(context.Background(), NewReader(strings.NewReader(dump), itemimage.NewJSONDecoder()))
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if stats != (Stats{Records: 3, Puts: 2, Deletes: 1}) {
+		t.Errorf("stats = %+v", stats)
+	}
+	for _, w := range []*recordingWriter{w1, w2} {
+		if len(w.batches) != 2 || len(w.batches[0]) != 1 || len(w.batches[1]) != 2 || !w.flushed {
+			t.Errorf("batches = %v, flushed = %v; want the repeated key to start a new batch", w.batches, w.flushed)
+		}
+	}
+}
+
+// TestApplierTransformsAndDrops checks replayed records pass through the same
+// transformers as the export, so filtered keys stay out of the table.
+func TestApplierTransformsAndDrops(t *testing.T) {
+	w := &recordingWriter{}
+	onlyA := transform.NewKeyEqualsFilter("pk", "a")
+	stats, err := NewApplier([]writer.Writer{w}, 1, WithTransformer(onlyA)).
+		Apply(context.Background(), NewReader(strings.NewReader(dump), itemimage.NewJSONDecoder()))
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if stats.Dropped != 1 || stats.Puts != 2 || stats.Deletes != 0 || len(w.batches) != 2 {
+		t.Errorf("stats = %+v, batches = %d", stats, len(w.batches))
+	}
+}
+
+// TestOpenDecompressesGzip checks gzip dumps, as Firehose delivers them, are
+// read transparently next to uncompressed ones.
+func TestOpenDecompressesGzip(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(dump))
+	gz.Close()
+	for name, data := range map[string][]byte{"plain.json": []byte(dump), "delivery.gz": buf.Bytes()} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		f, err := Open(context.Background(), nil, path)
+		if err != nil {
+			t.Fatalf("Open(%s): %v", name, err)
+		}
+		if ops := readAll(t, NewReader(f, itemimage.NewJSONDecoder())); len(ops) != 3 {
+			t.Errorf("%s: got %d operations, want 3", name, len(ops))
+		}
+		f.Close()
+	}
+}
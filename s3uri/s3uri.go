@@ -0,0 +1,127 @@
+// Package s3uri parses and builds s3://bucket/key URIs the same way everywhere,
+// so an object named in a flag is the object every component reads and writes.
+//
+// S3 URIs are not URLs. Like the AWS CLI, the key is taken literally: spaces,
+// '+', '%', '?' and '#' are part of it and nothing is percent-decoded. Slashes
+// inside the key are kept too, since exports written with an S3 prefix ending in
+// "/" really do contain "//". Only the slashes directly after the bucket are
+// dropped, because "s3://bucket//key" is almost always a doubled separator.
+package s3uri
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Scheme is the URI prefix of S3 locations.
+const Scheme = "s3://"
+
+// URI is a parsed S3 location. A Key that is empty or ends with "/" names a prefix.
+// Example:
+//
+//	u, err := s3uri.Parse("s3://my-bucket/exports/AWSDynamoDB/")
+//	if err != nil {
+//	    return err
+//	}
+//	summary := u.Join("01234-abcd", "manifest-summary.json")
+type URI struct {
+	Bucket string // Bucket name
+	Key    string // Object key or prefix, taken literally
+}
+
+// Parse parses an s3://bucket/key URI. The scheme is matched case-insensitively.
+func Parse(s string) (URI, error) {
+	if len(s) < len(Scheme) || !strings.EqualFold(s[:len(Scheme)], Scheme) {
+		return URI{}, fmt.Errorf("invalid S3 URI %q: must start with %s", s, Scheme)
+	}
+	bucket, key, _ := strings.Cut(s[len(Scheme):], "/")
+	if err := validateBucket(bucket); err != nil {
+		return URI{}, fmt.Errorf("invalid S3 URI %q: %w", s, err)
+	}
+	return URI{Bucket: bucket, Key: strings.TrimLeft(key, "/")}, nil
+}
+
+// ParseObject parses a URI that must name an object rather than a prefix.
+// Example:
+//
+//	u, err := s3uri.ParseObject("s3://my-bucket/checkpoints/restore-001.json")
+func ParseObject(s string) (URI, error) {
+	u, err := Parse(s)
+	if err != nil {
+		return URI{}, err
+	}
+	if u.IsPrefix() {
+		return URI{}, fmt.Errorf("invalid S3 URI %q: must name an object, not a bucket or prefix", s)
+	}
+	return u, nil
+}
+
+// validateBucket checks the characters and length of a bucket name. Legacy
+// bucket names may use upper case and underscores, so those are accepted.
+func validateBucket(bucket string) error {
+	if len(bucket) < 3 || len(bucket) > 255 {
+		return fmt.Errorf("bucket name %q must be 3 to 255 characters", bucket)
+	}
+	for _, c := range bucket {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+		default:
+			return fmt.Errorf("bucket name %q contains %q", bucket, c)
+		}
+	}
+	return nil
+}
+
+// String returns the URI as s3://bucket/key.
+func (u URI) String() string {
+	return Scheme + u.Bucket + "/" + u.Key
+}
+
+// IsPrefix reports whether the URI names a bucket or prefix rather than an object.
+func (u URI) IsPrefix() bool {
+	return u.Key == "" || strings.HasSuffix(u.Key, "/")
+}
+
+// Name returns the last element of the key, without a trailing slash.
+func (u URI) Name() string {
+	key := strings.TrimSuffix(u.Key, "/")
+	return key[strings.LastIndex(key, "/")+1:]
+}
+
+// Dir returns the prefix containing the object or prefix, ending with "/", or
+// an empty key at the top of the bucket.
+func (u URI) Dir() URI {
+	key := strings.TrimSuffix(u.Key, "/")
+	return URI{Bucket: u.Bucket, Key: key[:strings.LastIndex(key, "/")+1]}
+}
+
+// Join appends elements to the key, separated by single slashes. An element
+// ending with "/" keeps it, so the result names a prefix.
+func (u URI) Join(elem ...string) URI {
+	key := u.Key
+	for _, e := range elem {
+		e = strings.TrimLeft(e, "/")
+		if e == "" {
+			continue
+		}
+		if key != "" && !strings.HasSuffix(key, "/") {
+			key += "/"
+		}
+		key += e
+	}
+	return URI{Bucket: u.Bucket, Key: key}
+}
+
+// DecodeEventKey decodes an object key from an S3 event notification, which
+// URL-encodes keys with '+' for spaces.
+// Example:
+//
+//	key, err := s3uri.DecodeEventKey("my+exports/AWSDynamoDB/01%3Da/manifest-summary.json")
+func DecodeEventKey(key string) (string, error) {
+	decoded, err := url.QueryUnescape(key)
+	if err != nil {
+		return "", fmt.Errorf("invalid event key %q: %w", key, err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,149 @@
+package s3uri
+
+import "testing"
+
+// TestParse pins how every kind of key is read, since a key parsed differently
+// from how it was written only surfaces as NoSuchKey deep into a restore.
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in     string
+		bucket string
+		key    string
+	}{
+		{"s3://bucket/key.json", "bucket", "key.json"},
+		{"s3://bucket/a/b/c.json", "bucket", "a/b/c.json"},
+		{"S3://bucket/key", "bucket", "key"},
+		{"s3://bucket", "bucket", ""},
+		{"s3://bucket/", "bucket", ""},
+		{"s3://bucket/prefix/", "bucket", "prefix/"},
+		{"s3://bucket//key", "bucket", "key"},                                      // Doubled separator after the bucket
+		{"s3://bucket///prefix//", "bucket", "prefix//"},                           // Only leading slashes are dropped
+		{"s3://bucket/exports//AWSDynamoDB/x", "bucket", "exports//AWSDynamoDB/x"}, // Prefix ending in "/"
+		{"s3://bucket/my key.json", "bucket", "my key.json"},
+		{"s3://bucket/a+b.json", "bucket", "a+b.json"},
+		{"s3://bucket/100%25.json", "bucket", "100%25.json"}, // Not percent-decoded
+		{"s3://bucket/50%.json", "bucket", "50%.json"},       // Not a valid escape either
+		{"s3://bucket/q?x=1#frag", "bucket", "q?x=1#frag"},   // Not a query or fragment
+		{"s3://bucket/ünïcode/键.json", "bucket", "ünïcode/键.json"},
+		{"s3://Legacy_Bucket.1/key", "Legacy_Bucket.1", "key"},
+	}
+	for _, tt := range tests {
+		u, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if u.Bucket != tt.bucket || u.Key != tt.key {
+			t.Errorf("Parse(%q) = {%q, %q}, want {%q, %q}", tt.in, u.Bucket, u.Key, tt.bucket, tt.key)
+		}
+	}
+}
+
+// TestParseRejects checks that malformed URIs fail up front with a clear error.
+func TestParseRejects(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"s3:/",
+		"s3://",
+		"s3:///key",
+		"https://bucket/key",
+		"file:///tmp/x",
+		"bucket/key",
+		"s3://ab/key",         // Too short
+		"s3://bad bucket/key", // Space in bucket
+		"s3://bucket%2F/key",
+	} {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+// TestParseObject checks that flags naming a single object refuse prefixes,
+// which would otherwise write to a key ending in "/".
+func TestParseObject(t *testing.T) {
+	if _, err := ParseObject("s3://bucket/checkpoints/run.json"); err != nil {
+		t.Errorf("ParseObject failed for an object: %v", err)
+	}
+	for _, in := range []string{"s3://bucket", "s3://bucket/", "s3://bucket/checkpoints/"} {
+		if _, err := ParseObject(in); err == nil {
+			t.Errorf("ParseObject(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+// TestRoundTrip checks that String reproduces a parsed URI, so URIs handed
+// between components survive re-parsing unchanged.
+func TestRoundTrip(t *testing.T) {
+	for _, in := range []string{
+		"s3://bucket/key",
+		"s3://bucket/prefix/",
+		"s3://bucket/",
+		"s3://bucket/my key+1%20x.json",
+		"s3://bucket/exports//AWSDynamoDB/x/manifest-summary.json",
+	} {
+		u, err := Parse(in)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", in, err)
+		}
+		again, err := Parse(u.String())
+		if err != nil || again != u || u.String() != in {
+			t.Errorf("round trip of %q gave %q (%v)", in, u.String(), err)
+		}
+	}
+}
+
+// TestPathHelpers checks Join, Dir, Name and IsPrefix at the edges: empty keys,
+// trailing slashes and elements with their own slashes.
+func TestPathHelpers(t *testing.T) {
+	root := URI{Bucket: "b"}
+	tests := []struct {
+		got  URI
+		want string
+	}{
+		{root.Join("AWSDynamoDB/"), "s3://b/AWSDynamoDB/"},
+		{root.Join("a", "b"), "s3://b/a/b"},
+		{URI{"b", "a/"}.Join("/b", "", "c/"), "s3://b/a/b/c/"},
+		{URI{"b", "a"}.Join("b"), "s3://b/a/b"},
+		{URI{"b", "exports//AWSDynamoDB/x/"}.Join("manifest-summary.json"), "s3://b/exports//AWSDynamoDB/x/manifest-summary.json"},
+		{URI{"b", "a/b/c.json"}.Dir(), "s3://b/a/b/"},
+		{URI{"b", "a/b/"}.Dir(), "s3://b/a/"},
+		{URI{"b", "c.json"}.Dir(), "s3://b/"},
+		{root.Dir(), "s3://b/"},
+	}
+	for i, tt := range tests {
+		if tt.got.String() != tt.want {
+			t.Errorf("case %d: got %s, want %s", i, tt.got, tt.want)
+		}
+	}
+
+	for key, want := range map[string]string{"a/b/c.json": "c.json", "a/b/": "b", "c": "c", "": ""} {
+		if got := (URI{"b", key}).Name(); got != want {
+			t.Errorf("Name of %q = %q, want %q", key, got, want)
+		}
+	}
+	for key, want := range map[string]bool{"": true, "a/": true, "a": false, "a/b.json": false} {
+		if got := (URI{"b", key}).IsPrefix(); got != want {
+			t.Errorf("IsPrefix of %q = %v, want %v", key, got, want)
+		}
+	}
+}
+
+// TestDecodeEventKey checks the encoding of S3 event notifications, which
+// differs from S3 URIs: '+' is a space and %XX escapes are decoded.
+func TestDecodeEventKey(t *testing.T) {
+	for in, want := range map[string]string{
+		"plain/key.json":      "plain/key.json",
+		"my+exports/a.json":   "my exports/a.json",
+		"01%3Da/b%2Bc.json":   "01=a/b+c.json",
+		"%E9%94%AE/file.json": "键/file.json",
+	} {
+		got, err := DecodeEventKey(in)
+		if err != nil || got != want {
+			t.Errorf("DecodeEventKey(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := DecodeEventKey("bad%zz"); err == nil {
+		t.Error("expected an error for an invalid escape")
+	}
+}
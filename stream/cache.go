@@ -0,0 +1,310 @@
+package stream
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// partialSuffix marks a cache file holding the start of an object whose
+// download was interrupted.
+const partialSuffix = ".part"
+
+// DiskCache keeps the raw bytes of data files on local disk, so a file that is
+// retried or resumed is read again from disk instead of downloaded again. A file
+// whose read was interrupted keeps the bytes read so far, and reading it again
+// downloads only the rest. Files are evicted least recently used first once the
+// cache exceeds its size; a file that does not fit is not cached.
+//
+// Entries are keyed by bucket and key only. Export data files are never
+// rewritten under the same key, so the cache is not revalidated against S3.
+// Example:
+//
+//	cache, err := stream.NewDiskCache("/mnt/nvme/ddb-pitr", 100<<30)
+//	streamer := stream.NewS3Streamer(client, stream.WithDiskCache(cache))
+type DiskCache struct {
+	dir     string
+	limit   int64
+	mu      sync.Mutex
+	size    int64 // Bytes of every cache file
+	tick    uint64
+	entries map[string]*cacheEntry // By file name without partialSuffix
+}
+
+// cacheEntry is one cached object, complete or partial.
+type cacheEntry struct {
+	size     int64
+	used     uint64 // Tick of the last read, for eviction
+	complete bool
+	open     bool // Being read; not evicted
+}
+
+// NewDiskCache creates a cache of up to limit bytes in dir, creating dir when
+// missing. Files left in dir by an earlier run are reused, oldest first to be
+// evicted.
+// Example:
+//
+//	cache, err := stream.NewDiskCache(os.TempDir()+"/ddb-pitr-cache", 10<<30)
+func NewDiskCache(dir string, limit int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache directory: %w", err)
+	}
+	type found struct {
+		name  string
+		entry *cacheEntry
+		mtime int64
+	}
+	var files []found
+	for _, de := range des {
+		info, err := de.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		name, partial := strings.CutSuffix(de.Name(), partialSuffix)
+		files = append(files, found{name, &cacheEntry{size: info.Size(), complete: !partial}, info.ModTime().UnixNano()})
+	}
+	slices.SortFunc(files, func(a, b found) int { return cmp.Compare(a.mtime, b.mtime) })
+
+	c := &DiskCache{dir: dir, limit: limit, entries: make(map[string]*cacheEntry, len(files))}
+	for _, f := range files {
+		if prev := c.entries[f.name]; prev != nil {
+			// A partial and a complete copy: keep the complete one
+			_ = os.Remove(c.path(f.name, false))
+			if prev.complete {
+				continue
+			}
+			c.size -= prev.size
+		}
+		c.tick++
+		f.entry.used = c.tick
+		c.entries[f.name] = f.entry
+		c.size += f.entry.size
+	}
+	c.mu.Lock()
+	c.evict(0)
+	c.mu.Unlock()
+	return c, nil
+}
+
+// path returns the cache file of name.
+func (c *DiskCache) path(name string, complete bool) string {
+	if complete {
+		return filepath.Join(c.dir, name)
+	}
+	return filepath.Join(c.dir, name+partialSuffix)
+}
+
+// cacheName returns the name of the cache file of an object.
+func cacheName(bucket, key string) string {
+	sum := sha256.Sum256([]byte(bucket + "/" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// open returns the raw bytes of an object from offset, read from the cache as
+// far as it holds them and from fetch after that. fetch returns the object from
+// a byte offset. Bytes fetched are added to the cache when they continue it.
+func (c *DiskCache) open(bucket, key string, offset int64, fetch func(from int64) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	name := cacheName(bucket, key)
+
+	c.mu.Lock()
+	e := c.entries[name]
+	flag := os.O_RDWR
+	switch {
+	case e == nil && offset == 0:
+		e = &cacheEntry{}
+		c.entries[name] = e
+		flag |= os.O_CREATE | os.O_TRUNC
+	case e == nil || e.open || (!e.complete && e.size < offset):
+		// Being read by another worker, or not cached as far as offset
+		c.mu.Unlock()
+		return fetch(offset)
+	case e.complete:
+		flag = os.O_RDONLY
+	}
+	c.tick++
+	e.used = c.tick
+	e.open = true
+	c.mu.Unlock()
+
+	f, err := os.OpenFile(c.path(name, e.complete), flag, 0o644)
+	if err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		if f != nil {
+			_ = f.Close()
+		}
+		c.drop(name)
+		return fetch(offset)
+	}
+	r := &cachedReader{cache: c, name: name, entry: e, file: f}
+	if !e.complete {
+		// A partial file may hold the whole object when its reader stopped
+		// before seeing the end, and S3 refuses a range starting there
+		if r.body, err = fetch(e.size); err != nil && !(e.size > 0 && isInvalidRange(err)) {
+			_ = r.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// peek returns the first n bytes of an object, or the whole object when it is
+// shorter, and false when the cache does not hold them.
+func (c *DiskCache) peek(bucket, key string, n int) ([]byte, bool) {
+	name := cacheName(bucket, key)
+	c.mu.Lock()
+	e := c.entries[name]
+	if e == nil || (!e.complete && e.size < int64(n)) {
+		c.mu.Unlock()
+		return nil, false
+	}
+	path := c.path(name, e.complete)
+	c.mu.Unlock()
+
+	// The file may have been evicted or completed since; S3 is asked instead
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer func() { _ = f.Close() }()
+	head := make([]byte, n)
+	m, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, false
+	}
+	return head[:m], true
+}
+
+// grow accounts n more bytes written to e, evicting other files to make room.
+// It returns false when they do not fit.
+func (c *DiskCache) grow(e *cacheEntry, n int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// A file larger than the cache would evict every other file first
+	if e.size+n > c.limit || !c.evict(n) {
+		return false
+	}
+	e.size += n
+	c.size += n
+	return true
+}
+
+// evict removes the least recently used files not being read until n more
+// bytes fit. It returns false when they cannot be made to fit. c.mu is held.
+func (c *DiskCache) evict(n int64) bool {
+	for c.size+n > c.limit {
+		var victim string
+		var oldest *cacheEntry
+		for name, e := range c.entries {
+			if !e.open && (oldest == nil || e.used < oldest.used) {
+				victim, oldest = name, e
+			}
+		}
+		if oldest == nil {
+			return false
+		}
+		_ = os.Remove(c.path(victim, oldest.complete))
+		c.size -= oldest.size
+		delete(c.entries, victim)
+	}
+	return true
+}
+
+// drop removes the entry of name and its file.
+func (c *DiskCache) drop(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e := c.entries[name]; e != nil {
+		_ = os.Remove(c.path(name, e.complete))
+		c.size -= e.size
+		delete(c.entries, name)
+	}
+}
+
+// release marks the entry of name no longer read, complete when its object was
+// read to the end.
+func (c *DiskCache) release(name string, e *cacheEntry, complete bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.open = false
+	if complete && !e.complete {
+		if err := os.Rename(c.path(name, false), c.path(name, true)); err == nil {
+			e.complete = true
+		}
+	}
+}
+
+// cachedReader reads an object from its cache file, then from body when the
+// file holds only its start, appending what body returns to the file.
+type cachedReader struct {
+	cache *DiskCache
+	name  string
+	entry *cacheEntry
+	file  *os.File      // Cache file; nil once no longer written or read
+	body  io.ReadCloser // Rest of the object; nil when the file is complete
+	tail  bool          // The file is read to its end
+	eof   bool          // The object is read to its end
+}
+
+// Read implements io.Reader.
+func (r *cachedReader) Read(p []byte) (int, error) {
+	if !r.tail {
+		n, err := r.file.Read(p)
+		if n > 0 || (err != nil && err != io.EOF) {
+			return n, err
+		}
+		r.tail = true
+	}
+	if r.body == nil {
+		r.eof = true
+		return 0, io.EOF
+	}
+	n, err := r.body.Read(p)
+	if n > 0 && r.file != nil {
+		// The file is at its end, so writes extend it
+		if _, werr := r.file.Write(p[:n]); werr != nil || !r.cache.grow(r.entry, int64(n)) {
+			r.abandon()
+		}
+	}
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
+
+// abandon stops caching the object, removing what was cached of it.
+func (r *cachedReader) abandon() {
+	_ = r.file.Close()
+	r.file = nil
+	r.cache.release(r.name, r.entry, false)
+	r.cache.drop(r.name)
+	r.entry = nil
+}
+
+// Close implements io.Closer.
+func (r *cachedReader) Close() error {
+	var errs []error
+	if r.body != nil {
+		errs = append(errs, r.body.Close())
+	}
+	if r.file != nil {
+		errs = append(errs, r.file.Close())
+	}
+	if r.entry != nil {
+		r.cache.release(r.name, r.entry, r.eof && r.file != nil)
+	}
+	return errors.Join(errs...)
+}
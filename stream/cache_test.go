@@ -0,0 +1,122 @@
+package stream
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+// streamLines streams key with s and returns its lines, failing the test on
+// an error other than wantErr.
+func streamLines(t *testing.T, s *S3Streamer, key string, wantErr bool) string {
+	t.Helper()
+	var lines []string
+	err := s.Stream(context.Background(), "bucket", key, 0, func(line []byte, _ int64) error {
+		lines = append(lines, string(line))
+		return nil
+	})
+	if (err != nil) != wantErr {
+		t.Fatalf("stream %s: unexpected error %v", key, err)
+	}
+	return strings.Join(lines, ",")
+}
+
+// TestDiskCacheResumesInterruptedDownload verifies a file whose download
+// failed midway is read again from the cached bytes plus a range request for
+// the rest only, and a file read to its end is then served from disk without
+// any request, including by a cache reopened from the same directory.
+func TestDiskCacheResumesInterruptedDownload(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskCache(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &rangeS3Client{body: gzipBytes(t, "line1\nline2\nline3\n"), cutAt: 10}
+	s := NewS3Streamer(client, WithDiskCache(cache))
+
+	streamLines(t, s, "data/a.json.gz", true)
+	if got := streamLines(t, s, "data/a.json.gz", false); got != "line1,line2,line3" {
+		t.Errorf("unexpected lines %q", got)
+	}
+	if len(client.ranges) != 2 || client.ranges[1] != "bytes=10-" {
+		t.Errorf("expected the rest to be requested from byte 10, got %q", client.ranges)
+	}
+
+	reopened, err := NewDiskCache(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = NewS3Streamer(client, WithDiskCache(reopened))
+	if got := streamLines(t, s, "data/a.json.gz", false); got != "line1,line2,line3" {
+		t.Errorf("unexpected cached lines %q", got)
+	}
+	if len(client.ranges) != 2 {
+		t.Errorf("expected the cached file to be read from disk, got requests %q", client.ranges)
+	}
+}
+
+// TestDiskCacheEvictsLeastRecentlyUsed checks the cache stays within its size
+// by removing the file read longest ago, and that a file larger than the whole
+// cache is streamed without being cached or evicting the others.
+func TestDiskCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskCache(dir, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &rangeS3Client{body: []byte("0123456789\n")}
+	s := NewS3Streamer(client, WithDiskCache(cache))
+	for _, key := range []string{"a.json", "b.json", "a.json", "c.json"} {
+		streamLines(t, s, key, false)
+	}
+	// b was read longest ago when c needed room
+	requests := len(client.ranges)
+	streamLines(t, s, "a.json", false)
+	streamLines(t, s, "c.json", false)
+	if len(client.ranges) != requests {
+		t.Errorf("expected a and c to stay cached, got %d more requests", len(client.ranges)-requests)
+	}
+	streamLines(t, s, "b.json", false)
+	if len(client.ranges) != requests+1 {
+		t.Errorf("expected b to have been evicted")
+	}
+
+	large := &rangeS3Client{body: []byte(strings.Repeat("x", 40) + "\n")}
+	if got := streamLines(t, NewS3Streamer(large, WithDiskCache(cache)), "large.json", false); len(got) != 40 {
+		t.Errorf("expected the large file to be streamed, got %d bytes", len(got))
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("expected b and c to stay cached, got %d files", len(files))
+	}
+}
+
+// TestDiskCacheSniffsResumedFile verifies a resumed plain file held by the
+// cache is told plain from its cached first bytes and read from disk, without
+// a request to S3.
+func TestDiskCacheSniffsResumedFile(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &rangeS3Client{body: []byte("line1\nline2\n")}
+	s := NewS3Streamer(client, WithDiskCache(cache))
+	streamLines(t, s, "data/a.json", false)
+	requests := len(client.ranges)
+
+	var lines []string
+	err = s.Stream(context.Background(), "bucket", "data/a.json", 6, func(line []byte, _ int64) error {
+		lines = append(lines, string(line))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if len(client.ranges) != requests {
+		t.Errorf("expected no requests for the cached file, got %q", client.ranges[requests:])
+	}
+	if strings.Join(lines, ",") != "line2" {
+		t.Errorf("unexpected lines %v", lines)
+	}
+}
@@ -0,0 +1,170 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// PartSize is the size of the byte ranges read ahead with WithReadAhead.
+const PartSize = 8 * 1024 * 1024
+
+// partPool recycles the buffers holding parts read ahead.
+var partPool sync.Pool
+
+// part is one byte range of an object, or the error fetching it.
+type part struct {
+	r       io.Reader
+	release func() // Returns the part's buffer or closes its body
+	err     error
+}
+
+// partReader reads an object as consecutive byte ranges of partSize, fetching
+// up to ahead ranges concurrently while the earlier ones are being read, so
+// S3's time to first byte is paid while the worker decodes and writes instead
+// of between ranges. Later ranges are fetched with the ETag of the first, so an
+// object replaced mid-read fails rather than mixing two versions.
+type partReader struct {
+	cancel context.CancelFunc
+	queue  chan chan part // Parts in object order; closed after the last
+	cur    part
+	done   bool
+}
+
+// newPartReader starts reading the object of input from offset. It returns once
+// the first range has been fetched, so a missing object fails like GetObject.
+func newPartReader(ctx context.Context, client S3Client, input s3.GetObjectInput, offset, partSize int64, ahead int) (*partReader, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	first, size, etag, err := fetchPart(ctx, client, input, offset, partSize)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	r := &partReader{cancel: cancel, queue: make(chan chan part, ahead), cur: first}
+	go func() {
+		defer close(r.queue)
+		for start := offset + partSize; size >= 0 && start < size; start += partSize {
+			slot := make(chan part, 1)
+			select {
+			case r.queue <- slot:
+			case <-ctx.Done():
+				return
+			}
+			go func() {
+				in := input
+				in.IfMatch = etag
+				p, _, _, err := fetchPart(ctx, client, in, start, partSize)
+				if err != nil {
+					p = part{err: err}
+				}
+				slot <- p
+			}()
+		}
+	}()
+	return r, nil
+}
+
+// fetchPart reads the range of partSize bytes at start into a pooled buffer. It
+// returns the object's size and ETag from the response, and a size of -1 when
+// the response holds the rest of the object because the range was not applied.
+func fetchPart(ctx context.Context, client S3Client, input s3.GetObjectInput, start, partSize int64) (part, int64, *string, error) {
+	rangeHeader := fmt.Sprintf("bytes=%d-%d", start, start+partSize-1)
+	input.Range = &rangeHeader
+	resp, err := client.GetObject(ctx, &input)
+	if err != nil {
+		// S3 refuses any range of an empty object
+		if start == 0 && isInvalidRange(err) {
+			return part{r: bytes.NewReader(nil), release: func() {}}, 0, nil, nil
+		}
+		return part{}, 0, nil, fmt.Errorf("failed to get object %s bytes %d-%d: %w", *input.Key, start, start+partSize-1, err)
+	}
+	if resp.Body == nil {
+		return part{}, 0, nil, fmt.Errorf("object %s has no body", *input.Key)
+	}
+	size, ok := objectSize(resp.ContentRange)
+	if !ok {
+		return part{r: resp.Body, release: func() { _ = resp.Body.Close() }}, -1, resp.ETag, nil
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	buf, _ := partPool.Get().(*[]byte)
+	if buf == nil || int64(cap(*buf)) < partSize {
+		b := make([]byte, partSize)
+		buf = &b
+	}
+	n, err := io.ReadFull(resp.Body, (*buf)[:partSize])
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		partPool.Put(buf)
+		return part{}, 0, nil, fmt.Errorf("failed to read object %s bytes %d-%d: %w", *input.Key, start, start+partSize-1, err)
+	}
+	return part{r: bytes.NewReader((*buf)[:n]), release: func() { partPool.Put(buf) }}, size, resp.ETag, nil
+}
+
+// isInvalidRange reports whether err is S3 refusing a range that starts at or
+// past the end of the object.
+func isInvalidRange(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidRange"
+}
+
+// objectSize returns the object size of a Content-Range header such as
+// "bytes 0-99/1000".
+func objectSize(contentRange *string) (int64, bool) {
+	if contentRange == nil {
+		return 0, false
+	}
+	_, total, ok := strings.Cut(*contentRange, "/")
+	if !ok {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	return size, err == nil
+}
+
+// Read reads the current part and moves to the next once it is exhausted.
+func (r *partReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for !r.done {
+		if r.cur.err != nil {
+			return 0, r.cur.err
+		}
+		n, err := r.cur.r.Read(p)
+		if n > 0 || (err != nil && err != io.EOF) {
+			return n, err
+		}
+		r.cur.release()
+		r.cur = part{}
+		slot, ok := <-r.queue
+		if !ok {
+			r.done = true
+			break
+		}
+		r.cur = <-slot
+	}
+	return 0, io.EOF
+}
+
+// Close stops fetching and returns the buffers of parts not read.
+func (r *partReader) Close() error {
+	r.cancel()
+	if r.cur.release != nil {
+		r.cur.release()
+	}
+	r.cur, r.done = part{}, true
+	for slot := range r.queue {
+		if p := <-slot; p.release != nil {
+			p.release()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// rangeS3Client serves byte ranges of body as S3 does, failing the range
+// starting at failAt when set, and the first body after cutAt bytes.
+type rangeS3Client struct {
+	body   []byte
+	failAt int64
+	cutAt  int64
+
+	mu        sync.Mutex
+	ranges    []string
+	ifMatches []string
+}
+
+func (f *rangeS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	start, end := int64(0), int64(len(f.body))-1
+	if params.Range != nil {
+		fmt.Sscanf(*params.Range, "bytes=%d-%d", &start, &end)
+	}
+	f.mu.Lock()
+	f.ranges = append(f.ranges, aws.ToString(params.Range))
+	if params.IfMatch != nil {
+		f.ifMatches = append(f.ifMatches, *params.IfMatch)
+	}
+	f.mu.Unlock()
+	if start >= int64(len(f.body)) && params.Range != nil {
+		return nil, &smithy.GenericAPIError{Code: "InvalidRange"}
+	}
+	if f.failAt > 0 && start == f.failAt {
+		return nil, errors.New("connection reset")
+	}
+	end = min(end, int64(len(f.body))-1)
+	var body io.Reader = bytes.NewReader(f.body[start : end+1])
+	if f.cutAt > 0 {
+		// Fail the body after cutAt bytes, once
+		body = io.MultiReader(io.LimitReader(body, f.cutAt), iotest.ErrReader(errors.New("connection reset")))
+		f.cutAt = 0
+	}
+	out := &s3.GetObjectOutput{Body: io.NopCloser(body), ETag: aws.String(`"v1"`)}
+	if params.Range != nil {
+		out.ContentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end, len(f.body)))
+	}
+	return out, nil
+}
+
+// TestReadAheadMatchesSingleRequest verifies a file read as ranges fetched
+// ahead yields the same lines and offsets as a single request, for plain and
+// gzip files and when resuming mid-file, and that later ranges are pinned to
+// the ETag of the first request.
+func TestReadAheadMatchesSingleRequest(t *testing.T) {
+	var plain strings.Builder
+	for i := range 50 {
+		fmt.Fprintf(&plain, "{\"n\":%d}\n", i)
+	}
+	tests := []struct {
+		name   string
+		key    string
+		body   []byte
+		offset int64
+	}{
+		{"plain", "data/a.json", []byte(plain.String()), 0},
+		{"gzip", "data/a.json.gz", gzipBytes(t, plain.String()), 0},
+		{"resumed", "data/a.json", []byte(plain.String()), 80},
+	}
+	for _, tt := range tests {
+		lines := func(s *S3Streamer) string {
+			var out []string
+			err := s.Stream(context.Background(), "bucket", tt.key, tt.offset, func(line []byte, offset int64) error {
+				out = append(out, fmt.Sprintf("%d:%s", offset, line))
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("%s: stream failed: %v", tt.name, err)
+			}
+			return strings.Join(out, ",")
+		}
+		client := &rangeS3Client{body: tt.body}
+		s := NewS3Streamer(client, WithReadAhead(2))
+		s.partSize = 7
+
+		// fakeS3Client ignores the range, so it serves the body from offset
+		want := lines(NewS3Streamer(&fakeS3Client{body: tt.body[tt.offset:]}))
+		if got := lines(s); got != want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, want)
+		}
+		// A resume first reads the object's leading bytes to tell it is plain
+		sniffs := 0
+		if tt.offset > 0 {
+			sniffs = 1
+		}
+		if parts := (int64(len(tt.body)) - tt.offset + 6) / 7; int64(len(client.ranges)) != parts+int64(sniffs) {
+			t.Errorf("%s: expected %d ranges, got %d", tt.name, parts+int64(sniffs), len(client.ranges))
+		}
+		// Every range but the first carries the ETag; after a sniff, the first is the sniff
+		if len(client.ifMatches) != len(client.ranges)-1 || client.ifMatches[0] != `"v1"` {
+			t.Errorf("%s: expected later ranges to carry the ETag, got %q", tt.name, client.ifMatches)
+		}
+	}
+}
+
+// TestReadAheadFailures checks a failed range fails the stream after the lines
+// before it, and that an empty object, whose every range S3 refuses, is read
+// as holding no lines.
+func TestReadAheadFailures(t *testing.T) {
+	client := &rangeS3Client{body: []byte("aaaa\nbbbb\ncccc\n"), failAt: 10}
+	s := NewS3Streamer(client, WithReadAhead(4))
+	s.partSize = 5
+	var lines []string
+	err := s.Stream(context.Background(), "bucket", "data/a.json", 0, func(line []byte, _ int64) error {
+		lines = append(lines, string(line))
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("expected the range error, got %v", err)
+	}
+	if strings.Join(lines, ",") != "aaaa,bbbb" {
+		t.Errorf("expected the lines before the failed range, got %q", lines)
+	}
+
+	err = NewS3Streamer(&rangeS3Client{}, WithReadAhead(2)).Stream(context.Background(), "bucket", "data/a.json", 0, func([]byte, int64) error {
+		t.Error("unexpected line")
+		return nil
+	})
+	if err != nil {
+		t.Errorf("expected an empty object to be read, got %v", err)
+	}
+}
@@ -0,0 +1,416 @@
+// Package stream implements streaming JSON lines from S3 data files with pooled
+// buffers. It satisfies the s3streamer.Streamer contract used by the coordinator,
+// but recycles the read buffer, the line buffer and the decompressors between files
+// so that large restores do not churn megabytes of garbage per data file.
+// Data files may be uncompressed or compressed with gzip, bzip2 or zstd.
+package stream
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gurre/s3streamer"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// readBufferSize is the size of the pooled buffered reader wrapping the S3 body.
+	readBufferSize = 256 * 1024
+	// initialLineBufferSize is the size of the pooled scanner buffer.
+	initialLineBufferSize = 1024 * 1024
+	// DefaultMaxLineSize matches the s3streamer limit so behavior does not change.
+	DefaultMaxLineSize = 10 * 1024 * 1024
+	// maxZstdWindow caps the memory a zstd frame may demand from the decoder.
+	maxZstdWindow = 256 * 1024 * 1024
+)
+
+// ErrLineTooLong is matched by errors.Is when a data file has a line longer than
+// the maximum line size. Reading the file again finds the same line.
+var ErrLineTooLong = errors.New("line exceeds the maximum line size")
+
+// S3Client is the subset of S3 operations the streamer needs.
+type S3Client interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+var (
+	// readerPool recycles buffered readers wrapping S3 object bodies.
+	readerPool = sync.Pool{
+		New: func() any { return bufio.NewReaderSize(nil, readBufferSize) },
+	}
+	// lineBufferPool recycles the initial scanner buffers.
+	lineBufferPool = sync.Pool{
+		New: func() any {
+			b := make([]byte, initialLineBufferSize)
+			return &b
+		},
+	}
+	// gzipPool recycles gzip readers. It has no New func because a gzip.Reader
+	// can only be created from a valid header; getGzipReader handles the miss.
+	gzipPool sync.Pool
+	// zstdPool recycles zstd decoders, which are expensive to construct.
+	zstdPool sync.Pool
+)
+
+// S3Streamer streams newline-delimited records from S3 objects using pooled buffers.
+// Example:
+//
+//	streamer := stream.NewS3Streamer(s3.NewFromConfig(cfg))
+//	err := streamer.Stream(ctx, "my-bucket", "data/abc.json.gz", 0, func(line []byte, offset int64) error {
+//	    return nil
+//	})
+type S3Streamer struct {
+	client      S3Client
+	maxLineSize int   // Longest line accepted, excluding its newline
+	readAhead   int   // Parts fetched ahead of the one being read (0 = one request per file)
+	partSize    int64 // Size of the parts read ahead
+	cache       *DiskCache
+}
+
+// Option configures an S3Streamer.
+type Option func(*S3Streamer)
+
+// WithMaxLineSize fails a file with ErrLineTooLong at the first line longer
+// than n bytes, instead of buffering it whole. n <= 0 keeps DefaultMaxLineSize.
+// Example:
+//
+//	streamer := stream.NewS3Streamer(client, stream.WithMaxLineSize(1<<20))
+func WithMaxLineSize(n int) Option {
+	return func(s *S3Streamer) {
+		if n > 0 {
+			s.maxLineSize = n
+		}
+	}
+}
+
+// WithReadAhead reads each file as byte ranges of PartSize, fetching up to
+// parts ranges ahead of the one being read while it is decoded and written.
+// Each worker then holds up to parts+1 ranges in memory. parts <= 0 reads each
+// file with a single request.
+// Example:
+//
+//	streamer := stream.NewS3Streamer(client, stream.WithReadAhead(2))
+func WithReadAhead(parts int) Option {
+	return func(s *S3Streamer) {
+		s.readAhead = max(parts, 0)
+	}
+}
+
+// WithDiskCache reads data files through cache, so a file read again after a
+// failed attempt or on resume comes from local disk. A nil cache reads every
+// file from S3.
+// Example:
+//
+//	cache, err := stream.NewDiskCache("/mnt/nvme/ddb-pitr", 100<<30)
+//	streamer := stream.NewS3Streamer(client, stream.WithDiskCache(cache))
+func WithDiskCache(cache *DiskCache) Option {
+	return func(s *S3Streamer) {
+		s.cache = cache
+	}
+}
+
+// NewS3Streamer creates a new S3Streamer.
+// Example:
+//
+//	streamer := stream.NewS3Streamer(s3.NewFromConfig(cfg))
+func NewS3Streamer(client S3Client, opts ...Option) *S3Streamer {
+	s := &S3Streamer{client: client, maxLineSize: DefaultMaxLineSize, partSize: PartSize}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Stream downloads the object, decompresses it when gzip, bzip2 or zstd magic bytes
+// are present, and invokes fn for every line together with the line's byte offset
+// in the decompressed stream. The line slice is only valid for the duration of the
+// callback.
+//
+// A non-zero offset resumes at the line starting at that decompressed offset, as
+// passed to fn by an earlier call. Plain files are read from offset with a Range
+// request. Compressed files cannot be entered mid-stream, so they are read from the
+// start and the lines before offset are skipped. Whether a file is plain is told
+// by its first bytes, as when decompressing, not by its name; the read that
+// follows is pinned with If-Match to the object they came from. With WithReadAhead the object
+// is read as byte ranges fetched ahead of the lines being processed, and with
+// WithDiskCache from local disk as far as it was read before.
+// Example:
+//
+//	err := streamer.Stream(ctx, bucket, key, 0, func(line []byte, offset int64) error {
+//	    op, err := decoder.Decode(line)
+//	    ...
+//	})
+func (s *S3Streamer) Stream(ctx context.Context, bucket, key string, offset int64, fn func([]byte, int64) error) error {
+	input := &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	}
+	ranged := false
+	if offset > 0 && compressionFromExtension(key) == uncompressed {
+		c, etag, err := s.sniff(ctx, input)
+		if err != nil {
+			return err
+		}
+		ranged = c == uncompressed
+		// The object read must be the one whose first bytes were sniffed
+		input.IfMatch = etag
+	}
+	body, err := s.open(ctx, input, ranged, offset)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = body.Close() }()
+
+	br := readerPool.Get().(*bufio.Reader)
+	br.Reset(body)
+	defer func() {
+		br.Reset(nil)
+		readerPool.Put(br)
+	}()
+
+	// A ranged body starts mid-object and has no header to detect
+	var reader io.Reader = br
+	release := func() {}
+	if !ranged {
+		reader, release, err = decompress(br, key)
+		if err != nil {
+			return fmt.Errorf("failed to open data stream for %s: %w", key, err)
+		}
+	}
+	defer release()
+
+	buf := lineBufferPool.Get().(*[]byte)
+	defer lineBufferPool.Put(buf)
+
+	// The scanner's limit is the larger of its maximum and its buffer, and
+	// includes the newline
+	limit := s.maxLineSize + 1
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer((*buf)[:0:min(len(*buf), limit)], limit)
+
+	var currentOffset int64
+	if ranged {
+		currentOffset = offset
+	}
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Bytes()
+		lineOffset := currentOffset
+		currentOffset += int64(len(line)) + 1 // +1 for the newline
+		if lineOffset < offset {
+			continue
+		}
+
+		if err := fn(line, lineOffset); err != nil {
+			return fmt.Errorf("error processing line %d: %w", lineNum, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return fmt.Errorf("%w: line %d of %s at byte %d is longer than %d bytes",
+				ErrLineTooLong, lineNum+1, key, currentOffset, s.maxLineSize)
+		}
+		return fmt.Errorf("error scanning lines: %w", err)
+	}
+
+	return nil
+}
+
+// sniff returns the compression of the object of input from its first bytes,
+// and the ETag of the object they were read from. The bytes come from the disk
+// cache when it holds them, with no ETag since cached files are not
+// revalidated, and otherwise from a Range request through the client fetch
+// reads with, so they count against the same bandwidth limit.
+func (s *S3Streamer) sniff(ctx context.Context, input *s3.GetObjectInput) (compression, *string, error) {
+	if s.cache != nil {
+		if magic, ok := s.cache.peek(*input.Bucket, *input.Key, magicPeekSize); ok {
+			return detectCompression(magic), nil, nil
+		}
+	}
+	in := *input
+	rangeHeader := fmt.Sprintf("bytes=0-%d", magicPeekSize-1)
+	in.Range = &rangeHeader
+	resp, err := s.client.GetObject(ctx, &in)
+	if err != nil {
+		return uncompressed, nil, fmt.Errorf("failed to get object %s: %w", *input.Key, err)
+	}
+	if resp.Body == nil {
+		return uncompressed, nil, fmt.Errorf("object %s has no body", *input.Key)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	magic, err := io.ReadAll(io.LimitReader(resp.Body, magicPeekSize))
+	if err != nil {
+		return uncompressed, nil, fmt.Errorf("failed to read object %s: %w", *input.Key, err)
+	}
+	return detectCompression(magic), resp.ETag, nil
+}
+
+// open returns the body of the object of input, from offset when ranged.
+func (s *S3Streamer) open(ctx context.Context, input *s3.GetObjectInput, ranged bool, offset int64) (io.ReadCloser, error) {
+	if !ranged {
+		offset = 0
+	}
+	if s.cache != nil {
+		return s.cache.open(*input.Bucket, *input.Key, offset, func(from int64) (io.ReadCloser, error) {
+			in := *input
+			return s.fetch(ctx, &in, from)
+		})
+	}
+	return s.fetch(ctx, input, offset)
+}
+
+// fetch returns the body of the object of input from S3, from offset.
+func (s *S3Streamer) fetch(ctx context.Context, input *s3.GetObjectInput, offset int64) (io.ReadCloser, error) {
+	if s.readAhead > 0 {
+		r, err := newPartReader(ctx, s.client, *input, offset, s.partSize, s.readAhead)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	if offset > 0 {
+		rangeHeader := fmt.Sprintf("bytes=%d-", offset)
+		input.Range = &rangeHeader
+	}
+	resp, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object %s: %w", *input.Key, err)
+	}
+	if resp.Body == nil {
+		return nil, fmt.Errorf("object %s has no body", *input.Key)
+	}
+	return resp.Body, nil
+}
+
+// compression identifies how a data file is encoded.
+type compression int
+
+const (
+	uncompressed compression = iota
+	compressionGzip
+	compressionBzip2
+	compressionZstd
+)
+
+// String returns the conventional name of the compression.
+func (c compression) String() string {
+	switch c {
+	case compressionGzip:
+		return "gzip"
+	case compressionBzip2:
+		return "bzip2"
+	case compressionZstd:
+		return "zstd"
+	default:
+		return "uncompressed"
+	}
+}
+
+// magicPeekSize is the number of leading bytes needed to recognize every format.
+const magicPeekSize = 4
+
+// detectCompression identifies the compression from leading magic bytes.
+func detectCompression(magic []byte) compression {
+	switch {
+	case len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		return compressionGzip
+	case len(magic) >= 3 && magic[0] == 'B' && magic[1] == 'Z' && magic[2] == 'h':
+		return compressionBzip2
+	case len(magic) >= 4 && magic[0] == 0x28 && magic[1] == 0xb5 && magic[2] == 0x2f && magic[3] == 0xfd:
+		return compressionZstd
+	default:
+		return uncompressed
+	}
+}
+
+// compressionFromExtension returns the compression implied by a key's extension.
+// Keys without a known compressed extension (e.g. .json) report uncompressed.
+func compressionFromExtension(key string) compression {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".gz", ".gzip":
+		return compressionGzip
+	case ".bz2":
+		return compressionBzip2
+	case ".zst", ".zstd":
+		return compressionZstd
+	default:
+		return uncompressed
+	}
+}
+
+// decompress detects the compression of br and returns a reader for the
+// decompressed content plus a release func returning pooled state. Magic bytes
+// are authoritative, so repackaged files are read correctly whatever their name.
+// A key whose extension promises compression but whose content is plain fails
+// instead of feeding compressed or truncated bytes to the decoder.
+func decompress(br *bufio.Reader, key string) (io.Reader, func(), error) {
+	magic, err := br.Peek(magicPeekSize)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	detected := detectCompression(magic)
+	if detected == uncompressed && len(magic) > 0 {
+		if ext := compressionFromExtension(key); ext != uncompressed {
+			return nil, nil, fmt.Errorf("%s has a %s extension but no %s header", key, ext, ext)
+		}
+	}
+
+	switch detected {
+	case compressionGzip:
+		gz, err := getGzipReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gz, func() { gzipPool.Put(gz) }, nil
+	case compressionBzip2:
+		return bzip2.NewReader(br), func() {}, nil
+	case compressionZstd:
+		zr, err := getZstdReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, func() { zstdPool.Put(zr) }, nil
+	default:
+		return br, func() {}, nil
+	}
+}
+
+// getGzipReader returns a pooled gzip reader reset onto r, or a new one on a pool miss.
+func getGzipReader(r io.Reader) (*gzip.Reader, error) {
+	if gz, ok := gzipPool.Get().(*gzip.Reader); ok {
+		if err := gz.Reset(r); err != nil {
+			gzipPool.Put(gz)
+			return nil, err
+		}
+		return gz, nil
+	}
+	return gzip.NewReader(r)
+}
+
+// getZstdReader returns a pooled zstd decoder reset onto r, or a new one on a pool miss.
+// Decoders run single-threaded since every worker already streams its own file.
+func getZstdReader(r io.Reader) (*zstd.Decoder, error) {
+	if zr, ok := zstdPool.Get().(*zstd.Decoder); ok {
+		if err := zr.Reset(r); err != nil {
+			zstdPool.Put(zr)
+			return nil, err
+		}
+		return zr, nil
+	}
+	return zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxZstdWindow))
+}
+
+// Compile-time check that S3Streamer can replace s3streamer.S3Streamer.
+var _ s3streamer.Streamer = (*S3Streamer)(nil)
@@ -0,0 +1,285 @@
+package stream
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/klauspost/compress/zstd"
+)
+
+// TestStreamPlainLines verifies uncompressed objects are split into lines with
+// decompressed byte offsets, matching the s3streamer contract.
+func TestStreamPlainLines(t *testing.T) {
+	client := &fakeS3Client{body: []byte("{\"a\":1}\n{\"b\":2}\n")}
+	s := NewS3Streamer(client)
+
+	var offsets []int64
+	err := s.Stream(context.Background(), "bucket", "key", 0, func(line []byte, offset int64) error {
+		offsets = append(offsets, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if len(offsets) != 2 || offsets[0] != 0 || offsets[1] != 8 {
+		t.Errorf("expected offsets [0 8], got %v", offsets)
+	}
+}
+
+// TestStreamGzipLines verifies gzip objects are transparently decompressed and that
+// the pooled gzip reader yields correct content across repeated calls.
+func TestStreamGzipLines(t *testing.T) {
+	client := &fakeS3Client{body: gzipBytes(t, "line1\nline2\nline3\n")}
+	s := NewS3Streamer(client)
+
+	for i := 0; i < 3; i++ {
+		var lines []string
+		err := s.Stream(context.Background(), "bucket", "key", 0, func(line []byte, _ int64) error {
+			lines = append(lines, string(line))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("stream %d failed: %v", i, err)
+		}
+		if strings.Join(lines, ",") != "line1,line2,line3" {
+			t.Errorf("stream %d: unexpected lines %v", i, lines)
+		}
+	}
+}
+
+// TestStreamCallbackError ensures callback failures abort the stream and remain
+// inspectable with errors.Is so the coordinator can classify them.
+func TestStreamCallbackError(t *testing.T) {
+	client := &fakeS3Client{body: []byte("a\nb\n")}
+	sentinel := errors.New("boom")
+
+	err := NewS3Streamer(client).Stream(context.Background(), "bucket", "key", 0, func([]byte, int64) error {
+		return sentinel
+	})
+	if !errors.Is(err, sentinel) {
+		t.Errorf("expected wrapped sentinel error, got %v", err)
+	}
+}
+
+// TestStreamRangeRequest verifies a non-zero offset is forwarded as a Range header.
+func TestStreamRangeRequest(t *testing.T) {
+	client := &fakeS3Client{body: []byte("x\n")}
+	_ = NewS3Streamer(client).Stream(context.Background(), "bucket", "key", 42, func([]byte, int64) error { return nil })
+
+	if client.lastRange != "bytes=42-" {
+		t.Errorf("expected range bytes=42-, got %q", client.lastRange)
+	}
+}
+
+// TestStreamRangedOffsetsAreAbsolute verifies that offsets reported after a ranged
+// resume are positions in the whole file, so they can be checkpointed again.
+func TestStreamRangedOffsetsAreAbsolute(t *testing.T) {
+	client := &fakeS3Client{body: []byte("{\"b\":2}\n{\"c\":3}\n")}
+	var offsets []int64
+	err := NewS3Streamer(client).Stream(context.Background(), "bucket", "data/a.json", 8, func(_ []byte, offset int64) error {
+		offsets = append(offsets, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if len(offsets) != 2 || offsets[0] != 8 || offsets[1] != 16 {
+		t.Errorf("expected offsets [8 16], got %v", offsets)
+	}
+}
+
+// TestStreamResumesCompressedBySkipping verifies that resuming a gzip file reads it
+// from the start, since compressed bytes cannot be ranged into, and skips the lines
+// before the decompressed offset.
+func TestStreamResumesCompressedBySkipping(t *testing.T) {
+	client := &fakeS3Client{body: gzipBytes(t, "line1\nline2\nline3\n")}
+	var lines []string
+	var offsets []int64
+	err := NewS3Streamer(client).Stream(context.Background(), "bucket", "data/a.json.gz", 6, func(line []byte, offset int64) error {
+		lines = append(lines, string(line))
+		offsets = append(offsets, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if client.lastRange != "" {
+		t.Errorf("expected no range request for a compressed file, got %q", client.lastRange)
+	}
+	if strings.Join(lines, ",") != "line2,line3" || offsets[0] != 6 || offsets[1] != 12 {
+		t.Errorf("expected line2,line3 at [6 12], got %v at %v", lines, offsets)
+	}
+}
+
+// TestStreamResumesMisnamedGzipBySkipping verifies that resuming a gzip file
+// named .json is told compressed by its first bytes and read from the start,
+// rather than ranged into its compressed bytes.
+func TestStreamResumesMisnamedGzipBySkipping(t *testing.T) {
+	client := &rangeS3Client{body: gzipBytes(t, "line1\nline2\nline3\n")}
+	var lines []string
+	var offsets []int64
+	err := NewS3Streamer(client).Stream(context.Background(), "bucket", "data/a.json", 6, func(line []byte, offset int64) error {
+		lines = append(lines, string(line))
+		offsets = append(offsets, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if strings.Join(client.ranges, ",") != "bytes=0-3," {
+		t.Errorf("expected the first bytes, then the whole object, got ranges %q", client.ranges)
+	}
+	if strings.Join(lines, ",") != "line2,line3" || offsets[0] != 6 || offsets[1] != 12 {
+		t.Errorf("expected line2,line3 at [6 12], got %v at %v", lines, offsets)
+	}
+}
+
+// TestStreamPinsResumedPlainFile verifies that the read of a resumed plain
+// file is pinned to the object whose first bytes were sniffed, so a file
+// replaced in between fails instead of being ranged into at the wrong offset.
+func TestStreamPinsResumedPlainFile(t *testing.T) {
+	client := &rangeS3Client{body: []byte("{\"a\":1}\n{\"b\":2}\n")}
+	var lines []string
+	err := NewS3Streamer(client).Stream(context.Background(), "bucket", "data/a.json", 8, func(line []byte, _ int64) error {
+		lines = append(lines, string(line))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if strings.Join(client.ranges, ",") != "bytes=0-3,bytes=8-" {
+		t.Errorf("expected the first bytes, then the rest from the offset, got ranges %q", client.ranges)
+	}
+	if len(client.ifMatches) != 1 || client.ifMatches[0] != `"v1"` {
+		t.Errorf("expected the ranged read to match the sniffed ETag, got %q", client.ifMatches)
+	}
+	if strings.Join(lines, ",") != `{"b":2}` {
+		t.Errorf("unexpected lines %v", lines)
+	}
+}
+
+// TestStreamZstdLines verifies zstd objects are decompressed, including with a
+// recycled decoder on the second call.
+func TestStreamZstdLines(t *testing.T) {
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("zstd writer: %v", err)
+	}
+	client := &fakeS3Client{body: zw.EncodeAll([]byte("z1\nz2\n"), nil)}
+	s := NewS3Streamer(client)
+
+	for i := 0; i < 2; i++ {
+		var lines []string
+		err := s.Stream(context.Background(), "bucket", "data/a.json.zst", 0, func(line []byte, _ int64) error {
+			lines = append(lines, string(line))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("stream %d failed: %v", i, err)
+		}
+		if strings.Join(lines, ",") != "z1,z2" {
+			t.Errorf("stream %d: unexpected lines %v", i, lines)
+		}
+	}
+}
+
+// TestStreamDetectsByContentNotName verifies that magic bytes win over the key's
+// extension, so repackaged files with misleading names still stream.
+func TestStreamDetectsByContentNotName(t *testing.T) {
+	client := &fakeS3Client{body: gzipBytes(t, "g1\n")}
+	var lines []string
+	err := NewS3Streamer(client).Stream(context.Background(), "bucket", "data/a.json", 0, func(line []byte, _ int64) error {
+		lines = append(lines, string(line))
+		return nil
+	})
+	if err != nil || len(lines) != 1 || lines[0] != "g1" {
+		t.Errorf("expected gzip content under a .json key to stream, got %v (err %v)", lines, err)
+	}
+}
+
+// TestStreamRejectsMissingCompressionHeader ensures a .gz key with plain content
+// fails loudly instead of feeding unexpected bytes to the decoder.
+func TestStreamRejectsMissingCompressionHeader(t *testing.T) {
+	client := &fakeS3Client{body: []byte("{\"a\":1}\n")}
+	err := NewS3Streamer(client).Stream(context.Background(), "bucket", "data/a.json.gz", 0, func([]byte, int64) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "no gzip header") {
+		t.Errorf("expected missing header error, got %v", err)
+	}
+}
+
+// BenchmarkStreamGzip measures allocations per gzip file, the metric the pools target.
+func BenchmarkStreamGzip(b *testing.B) {
+	var sb strings.Builder
+	for i := 0; i < 1000; i++ {
+		sb.WriteString(`{"Item":{"PK":{"S":"ITEM#1"},"SK":{"S":"METADATA"}}}` + "\n")
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write([]byte(sb.String()))
+	_ = zw.Close()
+
+	client := &fakeS3Client{body: buf.Bytes()}
+	s := NewS3Streamer(client)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = s.Stream(ctx, "bucket", "key", 0, func([]byte, int64) error { return nil })
+	}
+}
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatalf("gzip write: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// fakeS3Client serves a fixed body and records the requested range.
+type fakeS3Client struct {
+	body      []byte
+	lastRange string
+}
+
+func (f *fakeS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if params.Range != nil {
+		f.lastRange = *params.Range
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(f.body))}, nil
+}
+
+// TestStreamMaxLineSize verifies a line longer than the limit, even one with no
+// newline before the end of the file, fails the file with ErrLineTooLong
+// naming the file and offset, while a line of exactly the limit is accepted.
+func TestStreamMaxLineSize(t *testing.T) {
+	for _, body := range []string{"0123456789\n" + strings.Repeat("x", 20) + "\nafter\n", "0123456789\n" + strings.Repeat("x", 20)} {
+		s := NewS3Streamer(&fakeS3Client{body: []byte(body)}, WithMaxLineSize(10))
+		var lines []string
+		err := s.Stream(context.Background(), "bucket", "data/a.json", 0, func(line []byte, _ int64) error {
+			lines = append(lines, string(line))
+			return nil
+		})
+		if !errors.Is(err, ErrLineTooLong) {
+			t.Fatalf("expected ErrLineTooLong, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "line 2 of data/a.json at byte 11") {
+			t.Errorf("expected the file and offset in %q", err)
+		}
+		if len(lines) != 1 || lines[0] != "0123456789" {
+			t.Errorf("expected only the line within the limit, got %q", lines)
+		}
+	}
+}
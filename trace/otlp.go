@@ -0,0 +1,204 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/smithy-go/tracing"
+	json "github.com/goccy/go-json"
+)
+
+// ServiceName is the service.name resource attribute of exported spans.
+const ServiceName = "ddb-pitr"
+
+// OTLPExporter sends spans to an OpenTelemetry collector, Jaeger or any other
+// receiver of OTLP over HTTP with JSON encoding.
+type OTLPExporter struct {
+	endpoint string // URL of the traces endpoint
+	client   *http.Client
+}
+
+// NewOTLPExporter creates an exporter posting to endpoint. An endpoint without
+// a path gets the standard /v1/traces path, as OTEL_EXPORTER_OTLP_ENDPOINT does.
+// Example:
+//
+//	exporter := trace.NewOTLPExporter("http://localhost:4318")
+func NewOTLPExporter(endpoint string) *OTLPExporter {
+	if u, err := url.Parse(endpoint); err == nil && (u.Path == "" || u.Path == "/") {
+		u.Path = "/v1/traces"
+		endpoint = u.String()
+	}
+	return &OTLPExporter{endpoint: endpoint, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Export implements Exporter.
+func (e *OTLPExporter) Export(ctx context.Context, spans []SpanData) error {
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return fmt.Errorf("failed to marshal spans: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned %s: %s", e.endpoint, resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// OTLP JSON messages; see opentelemetry-proto's trace/v1/trace.proto. Trace and
+// span IDs are hex strings and 64-bit integers decimal strings.
+type (
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Events            []otlpEvent    `json:"events,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpEvent struct {
+		TimeUnixNano string         `json:"timeUnixNano"`
+		Name         string         `json:"name"`
+		Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	}
+	otlpStatus struct {
+		Code int `json:"code"` // 0 unset, 1 ok, 2 error, as tracing.SpanStatus
+	}
+	otlpKeyValue struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+	}
+)
+
+// otlpRequest groups spans by the tracer that created them.
+func otlpRequest(spans []SpanData) otlpTraces {
+	var scopes []otlpScopeSpans
+	index := make(map[string]int)
+	for _, s := range spans {
+		i, ok := index[s.Scope]
+		if !ok {
+			i = len(scopes)
+			index[s.Scope] = i
+			scopes = append(scopes, otlpScopeSpans{Scope: otlpScope{Name: s.Scope}})
+		}
+		span := otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentID,
+			Name:              s.Name,
+			Kind:              otlpKind(s.Kind),
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+			Status:            otlpStatus{Code: int(s.Status)},
+		}
+		for _, ev := range s.Events {
+			span.Events = append(span.Events, otlpEvent{
+				TimeUnixNano: strconv.FormatInt(ev.Time.UnixNano(), 10),
+				Name:         ev.Name,
+				Attributes:   otlpAttributes(ev.Attributes),
+			})
+		}
+		scopes[i].Spans = append(scopes[i].Spans, span)
+	}
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(map[string]any{"service.name": ServiceName})},
+		ScopeSpans: scopes,
+	}}}
+}
+
+// otlpKind converts a span kind to its OTLP number, which orders server
+// before client.
+func otlpKind(k tracing.SpanKind) int {
+	switch k {
+	case tracing.SpanKindServer:
+		return 2
+	case tracing.SpanKindClient:
+		return 3
+	case tracing.SpanKindProducer:
+		return 4
+	case tracing.SpanKindConsumer:
+		return 5
+	default:
+		return 1 // Internal
+	}
+}
+
+// otlpAttributes converts attributes, sorted by key. Values other than
+// strings, integers, floats and booleans are exported as their string form.
+func otlpAttributes(attrs map[string]any) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	out := make([]otlpKeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		var val otlpValue
+		switch v := v.(type) {
+		case string:
+			val.StringValue = &v
+		case bool:
+			val.BoolValue = &v
+		case int:
+			s := strconv.Itoa(v)
+			val.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			val.IntValue = &s
+		case float64:
+			val.DoubleValue = &v
+		default:
+			s := fmt.Sprint(v)
+			val.StringValue = &s
+		}
+		out = append(out, otlpKeyValue{Key: k, Value: val})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// Compile-time check that OTLPExporter can be given to a Provider.
+var _ Exporter = (*OTLPExporter)(nil)
@@ -0,0 +1,295 @@
+// Package trace records the spans of a restore and exports them over OTLP, so
+// a run can be followed in Jaeger, or in X-Ray through an OpenTelemetry
+// collector. It implements the tracing interfaces of smithy-go, which the AWS
+// SDK clients accept, so DynamoDB and S3 calls are traced as children of the
+// pipeline's own spans. Without a provider the pipeline uses smithy-go's no-op
+// tracer and records nothing.
+package trace
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go/tracing"
+)
+
+const (
+	exportBatchSize = 512             // Ended spans exported in one request
+	maxQueuedSpans  = 4096            // Ended spans held while exports are slow; more are dropped
+	exportInterval  = 5 * time.Second // Export queued spans at least this often
+)
+
+// SpanData is an ended span, as handed to an Exporter.
+type SpanData struct {
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]any
+	Events     []EventData
+	Scope      string // Name of the tracer that created the span
+	Name       string
+	TraceID    string // 32 hex digits
+	SpanID     string // 16 hex digits
+	ParentID   string // "" for a root span
+	Kind       tracing.SpanKind
+	Status     tracing.SpanStatus
+}
+
+// EventData is an event recorded on a span.
+type EventData struct {
+	Time       time.Time
+	Attributes map[string]any
+	Name       string
+}
+
+// Exporter sends ended spans to a tracing backend.
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+}
+
+// Provider implements tracing.TracerProvider. Ended spans are queued and
+// exported in batches in the background, so tracing does not slow the
+// pipeline down; spans ended while the queue is full are dropped.
+// Example:
+//
+//	provider := trace.NewProvider(trace.NewOTLPExporter("http://localhost:4318"))
+//	defer provider.Shutdown(context.Background())
+//	client := dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
+//	    o.TracerProvider = provider
+//	})
+type Provider struct {
+	exporter Exporter
+
+	mu      sync.Mutex
+	queue   []SpanData
+	dropped int64
+	kick    chan struct{} // Signals the export loop that a batch is full
+	stop    chan struct{} // Closed by Shutdown
+	done    chan struct{} // Closed when the export loop has exported the last spans
+}
+
+// NewProvider creates a Provider exporting to exporter, and starts its export loop.
+func NewProvider(exporter Exporter) *Provider {
+	p := &Provider{
+		exporter: exporter,
+		kick:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.loop()
+	return p
+}
+
+// Tracer implements tracing.TracerProvider.
+func (p *Provider) Tracer(scope string, opts ...tracing.TracerOption) tracing.Tracer {
+	return &tracer{provider: p, scope: scope}
+}
+
+// Shutdown exports the spans still queued and stops the export loop. Spans
+// ended afterwards are dropped.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	p.mu.Lock()
+	dropped := p.dropped
+	p.mu.Unlock()
+	if dropped > 0 {
+		return fmt.Errorf("%d spans dropped while the exporter fell behind", dropped)
+	}
+	return nil
+}
+
+// enqueue queues an ended span for export.
+func (p *Provider) enqueue(span SpanData) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.stop:
+		p.dropped++
+		return
+	default:
+	}
+	if len(p.queue) >= maxQueuedSpans {
+		p.dropped++
+		return
+	}
+	p.queue = append(p.queue, span)
+	if len(p.queue) >= exportBatchSize {
+		select {
+		case p.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// loop exports queued spans when a batch fills, every exportInterval, and on Shutdown.
+func (p *Provider) loop() {
+	defer close(p.done)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.kick:
+		case <-ticker.C:
+		case <-p.stop:
+			p.export()
+			return
+		}
+		p.export()
+	}
+}
+
+// export sends every queued span, a batch at a time. Failures are reported on
+// stderr and lose the batch, as tracing must not fail a restore.
+func (p *Provider) export() {
+	for {
+		p.mu.Lock()
+		n := min(len(p.queue), exportBatchSize)
+		batch := p.queue[:n:n]
+		p.queue = p.queue[n:]
+		p.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := p.exporter.Export(ctx, batch); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to export %d spans: %v\n", n, err)
+		}
+		cancel()
+	}
+}
+
+// tracer implements tracing.Tracer for one scope.
+type tracer struct {
+	provider *Provider
+	scope    string
+}
+
+// StartSpan implements tracing.Tracer. The span is a child of the span active
+// on ctx, or the root of a new trace.
+func (t *tracer) StartSpan(ctx context.Context, name string, opts ...tracing.SpanOption) (context.Context, tracing.Span) {
+	var options tracing.SpanOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	s := &span{provider: t.provider, data: SpanData{
+		Start:  time.Now(),
+		Scope:  t.scope,
+		Name:   name,
+		SpanID: newSpanID(),
+		Kind:   options.Kind,
+	}}
+	parent, _ := tracing.GetSpan(ctx)
+	if pc := parent.Context(); pc.IsValid() {
+		s.data.TraceID = pc.TraceID
+		s.data.ParentID = pc.SpanID
+	} else {
+		s.data.TraceID = newTraceID(s.data.Start)
+	}
+	for k, v := range options.Properties.Values() {
+		s.SetProperty(k, v)
+	}
+	return tracing.WithSpan(ctx, s), s
+}
+
+// span implements tracing.Span.
+type span struct {
+	provider *Provider
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// Name implements tracing.Span.
+func (s *span) Name() string {
+	return s.data.Name
+}
+
+// Context implements tracing.Span.
+func (s *span) Context() tracing.SpanContext {
+	return tracing.SpanContext{TraceID: s.data.TraceID, SpanID: s.data.SpanID}
+}
+
+// AddEvent implements tracing.Span.
+func (s *span) AddEvent(name string, opts ...tracing.EventOption) {
+	var options tracing.EventOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	event := EventData{Time: time.Now(), Name: name}
+	for k, v := range options.Properties.Values() {
+		if event.Attributes == nil {
+			event.Attributes = make(map[string]any)
+		}
+		event.Attributes[fmt.Sprint(k)] = v
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Events = append(s.data.Events, event)
+}
+
+// SetStatus implements tracing.Span.
+func (s *span) SetStatus(status tracing.SpanStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status = status
+}
+
+// SetProperty implements tracing.Span. Properties are exported as attributes
+// named by the key.
+func (s *span) SetProperty(k, v any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]any)
+	}
+	s.data.Attributes[fmt.Sprint(k)] = v
+}
+
+// End implements tracing.Span. Only the first call has an effect.
+func (s *span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	s.provider.enqueue(data)
+}
+
+// newTraceID returns a random trace ID whose first four bytes are the start
+// time in Unix seconds, the layout X-Ray requires of the traces it accepts.
+func newTraceID(start time.Time) string {
+	var id [16]byte
+	binary.BigEndian.PutUint32(id[:4], uint32(start.Unix()))
+	binary.BigEndian.PutUint32(id[4:8], rand.Uint32())
+	binary.BigEndian.PutUint64(id[8:], rand.Uint64())
+	return hex.EncodeToString(id[:])
+}
+
+// newSpanID returns a random, non-zero span ID.
+func newSpanID() string {
+	var id [8]byte
+	binary.BigEndian.PutUint64(id[:], rand.Uint64()|1)
+	return hex.EncodeToString(id[:])
+}
+
+// Compile-time check that Provider can be given to the AWS SDK clients.
+var _ tracing.TracerProvider = (*Provider)(nil)
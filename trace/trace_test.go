@@ -0,0 +1,84 @@
+package trace
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/smithy-go/tracing"
+	json "github.com/goccy/go-json"
+)
+
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (e *recordingExporter) Export(ctx context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+// TestProviderNestsSpans checks a span started on the context of another is
+// its child in the same trace, as the AWS SDK relies on to attach its call
+// spans to the pipeline's, and that Shutdown exports spans still queued.
+func TestProviderNestsSpans(t *testing.T) {
+	exporter := &recordingExporter{}
+	provider := NewProvider(exporter)
+	tracer := provider.Tracer("test")
+
+	ctx, root := tracer.StartSpan(context.Background(), "Restore")
+	_, child := tracer.StartSpan(ctx, "WriteBatch", func(o *tracing.SpanOptions) { o.Kind = tracing.SpanKindClient })
+	child.SetProperty("batch.items", 25)
+	child.End()
+	root.End()
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	if len(exporter.spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(exporter.spans))
+	}
+	c, r := exporter.spans[0], exporter.spans[1]
+	if c.TraceID != r.TraceID || c.ParentID != r.SpanID || r.ParentID != "" {
+		t.Errorf("child %s/%s under %s, root %s/%s under %q", c.TraceID, c.SpanID, c.ParentID, r.TraceID, r.SpanID, r.ParentID)
+	}
+	if c.Attributes["batch.items"] != 25 || c.Kind != tracing.SpanKindClient {
+		t.Errorf("child = %+v", c)
+	}
+}
+
+// TestOTLPExporterPostsJSON checks spans are posted to the standard traces
+// path in the OTLP JSON encoding: hex IDs, OTLP span kinds, which are ordered
+// differently from smithy-go's, and 64-bit integers as strings.
+func TestOTLPExporterPostsJSON(t *testing.T) {
+	var path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		path, body = r.URL.Path, string(b)
+	}))
+	defer server.Close()
+
+	span := SpanData{Scope: "test", Name: "StreamFile", TraceID: strings.Repeat("a", 32), SpanID: strings.Repeat("b", 16),
+		Kind: tracing.SpanKindClient, Status: tracing.SpanStatusError, Attributes: map[string]any{"file.offset": int64(42)}}
+	if err := NewOTLPExporter(server.URL).Export(context.Background(), []SpanData{span}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if path != "/v1/traces" {
+		t.Errorf("posted to %s", path)
+	}
+	var got otlpTraces
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatal(err)
+	}
+	s := got.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if s.TraceID != span.TraceID || s.Kind != 3 || s.Status.Code != 2 || *s.Attributes[0].Value.IntValue != "42" {
+		t.Errorf("posted %s", body)
+	}
+}
@@ -0,0 +1,102 @@
+package transform
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// KeyFilter keeps only operations whose key attribute matches a prefix or an exact
+// value, e.g. a single tenant's partition. It can reject most non-matching lines
+// before they are decoded with Keep, and makes the precise decision on the decoded
+// keys with Transform.
+// Example:
+//
+//	f := transform.NewKeyPrefixFilter("pk", "TENANT#42")
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil,
+//	    coordinator.WithLineFilter(f),
+//	    coordinator.WithTransformer(f),
+//	)
+type KeyFilter struct {
+	attr   string // Key attribute to match
+	value  string // Prefix or exact value
+	needle []byte // Bytes every matching line must contain; nil disables the pre-scan
+	exact  bool   // Match value exactly instead of as a prefix
+}
+
+// NewKeyPrefixFilter keeps operations whose attr value starts with prefix.
+// Both string and number keys are compared by their textual value.
+// Example:
+//
+//	f := transform.NewKeyPrefixFilter("pk", "TENANT#42#")
+func NewKeyPrefixFilter(attr, prefix string) *KeyFilter {
+	return &KeyFilter{attr: attr, value: prefix, needle: scanNeedle(prefix, false)}
+}
+
+// NewKeyEqualsFilter keeps operations whose attr value equals value.
+// Example:
+//
+//	f := transform.NewKeyEqualsFilter("pk", "TENANT#42")
+func NewKeyEqualsFilter(attr, value string) *KeyFilter {
+	return &KeyFilter{attr: attr, value: value, needle: scanNeedle(value, true), exact: true}
+}
+
+// scanNeedle returns the bytes a JSON line must contain for a string that starts
+// with (or equals) value: an opening quote followed by value. Values that a JSON
+// encoder may escape are not pre-scanned, since their encoded form is ambiguous.
+func scanNeedle(value string, exact bool) []byte {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < 0x20 || c >= 0x7f || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			return nil
+		}
+	}
+	needle := `"` + value
+	if exact {
+		needle += `"`
+	}
+	return []byte(needle)
+}
+
+// Keep reports whether line may contain a matching operation. A false result is
+// definitive; a true result must still be confirmed by Transform.
+//
+// HOT PATH: Called for every line before decoding.
+func (f *KeyFilter) Keep(line []byte) bool {
+	if f.needle == nil {
+		return true
+	}
+	return bytes.Contains(line, f.needle)
+}
+
+// Transform drops operations whose key attribute does not match. FULL exports carry
+// no separate keys, so the attribute is looked up in the images as well.
+func (f *KeyFilter) Transform(op itemimage.Operation) (itemimage.Operation, bool, error) {
+	av, ok := op.Keys[f.attr]
+	if !ok {
+		av, ok = op.NewImage[f.attr]
+	}
+	if !ok {
+		av, ok = op.OldImage[f.attr]
+	}
+	if !ok {
+		return op, false, nil
+	}
+
+	var value string
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		value = v.Value
+	case *types.AttributeValueMemberN:
+		value = v.Value
+	default:
+		return op, false, nil
+	}
+
+	if f.exact {
+		return op, value == f.value, nil
+	}
+	return op, strings.HasPrefix(value, f.value), nil
+}
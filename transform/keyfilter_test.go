@@ -0,0 +1,92 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// TestKeyPrefixFilterFullExport checks the pre-scan and the decoded-key check on
+// FULL export lines, where the key only appears inside Item.
+func TestKeyPrefixFilterFullExport(t *testing.T) {
+	f := NewKeyPrefixFilter("pk", "TENANT#42")
+	decoder := itemimage.NewJSONDecoder()
+
+	cases := []struct {
+		line      string
+		prescan   bool
+		transform bool
+	}{
+		{`{"Item":{"pk":{"S":"TENANT#42#ORDER#1"},"v":{"N":"1"}}}`, true, true},
+		{`{"Item":{"pk":{"S":"TENANT#7#ORDER#1"},"v":{"N":"1"}}}`, false, false},
+		// Prefix occurs in a non-key attribute: passes the pre-scan, dropped after decode
+		{`{"Item":{"pk":{"S":"TENANT#7"},"ref":{"S":"TENANT#42"}}}`, true, false},
+	}
+	for _, tc := range cases {
+		if got := f.Keep([]byte(tc.line)); got != tc.prescan {
+			t.Errorf("Keep(%s) = %v, want %v", tc.line, got, tc.prescan)
+		}
+		op, err := decoder.Decode([]byte(tc.line))
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if _, keep, _ := f.Transform(op); keep != tc.transform {
+			t.Errorf("Transform(%s) keep = %v, want %v", tc.line, keep, tc.transform)
+		}
+	}
+}
+
+// TestKeyEqualsFilterIncrementalExport checks exact matching against the Keys
+// section of incremental export lines, including deletes without a NewImage.
+func TestKeyEqualsFilterIncrementalExport(t *testing.T) {
+	f := NewKeyEqualsFilter("pk", "TENANT#42")
+	decoder := itemimage.NewJSONDecoder()
+
+	match := `{"Keys":{"pk":{"S":"TENANT#42"}},"OldImage":{"pk":{"S":"TENANT#42"}}}`
+	longer := `{"Keys":{"pk":{"S":"TENANT#420"}},"OldImage":{"pk":{"S":"TENANT#420"}}}`
+
+	if !f.Keep([]byte(match)) || f.Keep([]byte(longer)) {
+		t.Error("pre-scan should only pass the exact value")
+	}
+	for line, want := range map[string]bool{match: true, longer: false} {
+		op, err := decoder.Decode([]byte(line))
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if _, keep, _ := f.Transform(op); keep != want {
+			t.Errorf("Transform(%s) keep = %v, want %v", line, keep, want)
+		}
+	}
+}
+
+// TestKeyFilterSkipsPrescanForEscapedValues ensures values a JSON encoder might
+// escape never cause a false rejection in the pre-scan.
+func TestKeyFilterSkipsPrescanForEscapedValues(t *testing.T) {
+	f := NewKeyPrefixFilter("pk", "A&B")
+	if !f.Keep([]byte(`{"Item":{"pk":{"S":"A&B"}}}`)) {
+		t.Error("expected pre-scan to be disabled for escapable values")
+	}
+}
+
+// TestNotKeyFilter checks Not leaves out exactly the operations the filter
+// keeps, so a priority pass and the pass after it together write every item
+// once.
+func TestNotKeyFilter(t *testing.T) {
+	f := NewKeyPrefixFilter("pk", "ACCOUNT#")
+	rest := Not(f)
+	decoder := itemimage.NewJSONDecoder()
+	for _, line := range []string{
+		`{"Item":{"pk":{"S":"ACCOUNT#1"}}}`,
+		`{"Item":{"pk":{"S":"SESSION#1"}}}`,
+		`{"Item":{"sk":{"S":"ACCOUNT#1"}}}`,
+	} {
+		op, err := decoder.Decode([]byte(line))
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		_, kept, _ := f.Transform(op)
+		if _, keep, _ := rest.Transform(op); keep == kept {
+			t.Errorf("Not(%s) keep = %v, the same as the filter", line, keep)
+		}
+	}
+}
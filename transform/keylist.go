@@ -0,0 +1,202 @@
+package transform
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	json "github.com/goccy/go-json"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// KeyResult reports whether one requested key was seen during a restore.
+type KeyResult struct {
+	Key        json.RawMessage `json:"key"`                  // Key as given in the keys file, DynamoDB JSON
+	ExportTime string          `json:"exportTime,omitempty"` // Point in time of the export the key was found in
+	Operation  string          `json:"operation,omitempty"`  // Last operation seen for the key
+	Matches    int64           `json:"matches"`              // Number of operations seen for the key
+	Found      bool            `json:"found"`                // True if at least one operation was seen
+}
+
+// keyEntry tracks one requested key.
+type keyEntry struct {
+	raw        json.RawMessage
+	exportTime string // Export point in time of the last match
+	lastOp     itemimage.OperationType
+	matches    int64
+}
+
+// KeyList keeps only operations whose primary key is in a fixed list, and records
+// which keys were found. It is used for surgical recovery of individual items
+// without restoring the whole table.
+// Example:
+//
+//	keys, err := transform.LoadKeyList("deleted-orders.jsonl")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil,
+//	    coordinator.WithTransformer(keys),
+//	)
+type KeyList struct {
+	entries    map[string]*keyEntry // Keyed by itemimage.KeyFingerprint
+	order      []string             // Fingerprints in file order, for stable results
+	names      []string             // Key attribute names shared by every key
+	exportTime string
+	mu         sync.Mutex
+}
+
+// LoadKeyList reads a JSON lines file with one primary key per line in DynamoDB
+// JSON, e.g. {"pk":{"S":"ORDER#1"},"sk":{"N":"7"}}. Every key must use the same
+// attribute names. Blank lines are ignored.
+// Example:
+//
+//	keys, err := transform.LoadKeyList("keys.jsonl")
+func LoadKeyList(path string) (*KeyList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open keys file: %w", err)
+	}
+	defer f.Close()
+
+	l := &KeyList{entries: make(map[string]*keyEntry)}
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := l.add(line); err != nil {
+			return nil, fmt.Errorf("keys file line %d: %w", lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read keys file: %w", err)
+	}
+	if len(l.entries) == 0 {
+		return nil, fmt.Errorf("keys file %s contains no keys", path)
+	}
+	return l, nil
+}
+
+// add parses and registers one key line.
+func (l *KeyList) add(line []byte) error {
+	key, err := attributevalue.UnmarshalMapJSON(line)
+	if err != nil {
+		return fmt.Errorf("invalid key: %w", err)
+	}
+	if len(key) == 0 || len(key) > 2 {
+		return fmt.Errorf("key must have one or two attributes, got %d", len(key))
+	}
+
+	names := make([]string, 0, len(key))
+	for name, av := range key {
+		switch av.(type) {
+		case *types.AttributeValueMemberS, *types.AttributeValueMemberN, *types.AttributeValueMemberB:
+		default:
+			return fmt.Errorf("key attribute %s must be S, N or B", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if l.names == nil {
+		l.names = names
+	} else if strings.Join(names, ",") != strings.Join(l.names, ",") {
+		return fmt.Errorf("key attributes %v differ from %v", names, l.names)
+	}
+
+	fp := itemimage.KeyFingerprint(key)
+	if _, ok := l.entries[fp]; ok {
+		return nil
+	}
+	l.entries[fp] = &keyEntry{raw: append(json.RawMessage(nil), line...)}
+	l.order = append(l.order, fp)
+	return nil
+}
+
+// SetExportTime sets the point in time recorded for keys found from now on.
+// Example:
+//
+//	keys.SetExportTime(summary.PointInTime())
+func (l *KeyList) SetExportTime(t string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.exportTime = t
+}
+
+// Transform keeps op if its primary key is in the list. FULL exports carry no
+// separate keys, so the key attributes are taken from the images.
+func (l *KeyList) Transform(op itemimage.Operation) (itemimage.Operation, bool, error) {
+	key := op.Keys
+	if len(key) == 0 {
+		image := op.NewImage
+		if image == nil {
+			image = op.OldImage
+		}
+		key = make(map[string]types.AttributeValue, len(l.names))
+		for _, name := range l.names {
+			if av, ok := image[name]; ok {
+				key[name] = av
+			}
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.entries[itemimage.KeyFingerprint(key)]
+	if !ok {
+		return op, false, nil
+	}
+	entry.matches++
+	entry.lastOp = op.Type
+	entry.exportTime = l.exportTime
+	return op, true, nil
+}
+
+// Results returns one result per requested key, in keys file order.
+func (l *KeyList) Results() []KeyResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	results := make([]KeyResult, 0, len(l.order))
+	for _, fp := range l.order {
+		e := l.entries[fp]
+		r := KeyResult{Key: e.raw, Matches: e.matches, Found: e.matches > 0}
+		if r.Found {
+			r.Operation = e.lastOp.String()
+			r.ExportTime = e.exportTime
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// WriteResults writes Results as JSON lines to path, replacing the file.
+// Example:
+//
+//	if err := keys.WriteResults("keys-report.jsonl"); err != nil {
+//	    log.Printf("failed to write key report: %v", err)
+//	}
+func (l *KeyList) WriteResults(path string) error {
+	var buf bytes.Buffer
+	for _, r := range l.Results() {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("failed to encode key result: %w", err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write key report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package transform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+func writeKeys(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.jsonl")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestKeyListMatchesFullAndIncrementalLines verifies that listed keys are kept
+// whether the key comes from Keys (incremental) or the item itself (full), and
+// that the results record what was found and when.
+func TestKeyListMatchesFullAndIncrementalLines(t *testing.T) {
+	keys, err := LoadKeyList(writeKeys(t, `{"pk":{"S":"A"},"sk":{"N":"1"}}
+
+{"pk":{"S":"B"},"sk":{"N":"2"}}
+{"pk":{"S":"C"},"sk":{"N":"3"}}
+`))
+	if err != nil {
+		t.Fatalf("LoadKeyList failed: %v", err)
+	}
+	keys.SetExportTime("2024-01-01T00:00:00Z")
+
+	decoder := itemimage.NewJSONDecoder()
+	lines := map[string]bool{
+		`{"Item":{"pk":{"S":"A"},"sk":{"N":"1"},"v":{"S":"x"}}}`:                              true,
+		`{"Item":{"pk":{"S":"A"},"sk":{"N":"9"}}}`:                                            false,
+		`{"Keys":{"pk":{"S":"B"},"sk":{"N":"2"}},"OldImage":{"pk":{"S":"B"},"sk":{"N":"2"}}}`: true,
+	}
+	for line, want := range lines {
+		op, err := decoder.Decode([]byte(line))
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if _, keep, _ := keys.Transform(op); keep != want {
+			t.Errorf("Transform(%s) keep = %v, want %v", line, keep, want)
+		}
+	}
+
+	results := keys.Results()
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	if !results[0].Found || results[0].Operation != "PUT" || results[0].ExportTime != "2024-01-01T00:00:00Z" {
+		t.Errorf("unexpected result for A: %+v", results[0])
+	}
+	if !results[1].Found || results[1].Operation != "DELETE" {
+		t.Errorf("unexpected result for B: %+v", results[1])
+	}
+	if results[2].Found || results[2].ExportTime != "" {
+		t.Errorf("expected C not found: %+v", results[2])
+	}
+}
+
+// TestLoadKeyListRejectsInconsistentKeys ensures malformed key files fail up front
+// instead of silently matching nothing.
+func TestLoadKeyListRejectsInconsistentKeys(t *testing.T) {
+	for _, content := range []string{
+		"",
+		`{"pk":{"S":"A"}}` + "\n" + `{"id":{"S":"B"}}`,
+		`{"pk":{"M":{}}}`,
+		`{"a":{"S":"1"},"b":{"S":"2"},"c":{"S":"3"}}`,
+		`not json`,
+	} {
+		if _, err := LoadKeyList(writeKeys(t, content)); err == nil {
+			t.Errorf("expected error for %q", content)
+		}
+	}
+}
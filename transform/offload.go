@@ -0,0 +1,155 @@
+package transform
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gurre/ddb-pitr/itemimage"
+	"github.com/gurre/ddb-pitr/s3uri"
+)
+
+// DefaultOffloadThreshold is the item size above which attributes are
+// offloaded, leaving headroom below DynamoDB's 400 KB item limit for the
+// pointers and for indexes projecting the item.
+const DefaultOffloadThreshold = 350 << 10
+
+// Attributes of the map that replaces an offloaded attribute.
+const (
+	PointerBucket = "bucket" // Bucket holding the payload
+	PointerKey    = "key"    // Object key of the payload
+	PointerETag   = "etag"   // ETag S3 returned for the payload
+	PointerType   = "type"   // Encoding of the payload: S and B for raw strings and binaries, JSON for DynamoDB JSON
+)
+
+// OffloadClient is the subset of the S3 client used to upload payloads.
+type OffloadClient interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// Offloader moves the largest attributes of items over a size threshold to S3
+// and replaces each with a pointer map of bucket, key, etag and type, for
+// targets that cannot hold the original values. Strings and binaries are
+// stored as their raw bytes and other types as DynamoDB JSON. Objects are
+// named by the SHA-256 of their payload, so a rerun rewrites the same objects
+// and equal payloads share one. Key attributes are never offloaded.
+//
+// Only new images are rewritten, since old images are never written to the
+// table. Transformers have no context of their own, so uploads run under the
+// one the Offloader was created with.
+// Example:
+//
+//	o, err := transform.NewOffloader(ctx, s3Client, "s3://blobs/orders/", transform.DefaultOffloadThreshold, []string{"pk", "sk"})
+//	// {"pk": "order#1", "pdf": <500 KB>} becomes
+//	// {"pk": "order#1", "pdf": {"bucket": "blobs", "key": "orders/3f9a...", "etag": "\"...\"", "type": "B"}}
+type Offloader struct {
+	ctx       context.Context
+	client    OffloadClient
+	prefix    s3uri.URI       // Prefix the payloads are written under
+	threshold int64           // Item size, in bytes, above which attributes are offloaded
+	keyAttrs  map[string]bool // Key attributes, which stay in the item
+}
+
+// NewOffloader creates an Offloader writing payloads under the s3:// prefix
+// uri for items larger than threshold bytes.
+// Example:
+//
+//	o, err := transform.NewOffloader(ctx, s3Client, "s3://blobs/orders/", 300<<10, []string{"pk"})
+func NewOffloader(ctx context.Context, client OffloadClient, uri string, threshold int64, keyAttrs []string) (*Offloader, error) {
+	u, err := s3uri.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsPrefix() {
+		u.Key += "/"
+	}
+	keys := make(map[string]bool, len(keyAttrs))
+	for _, attr := range keyAttrs {
+		keys[attr] = true
+	}
+	return &Offloader{ctx: ctx, client: client, prefix: u, threshold: threshold, keyAttrs: keys}, nil
+}
+
+// Transform offloads the largest non-key attributes of the new image, one at a
+// time, until the item fits under the threshold. Items that still do not fit,
+// because their keys are too large, fail rather than being written over size.
+func (o *Offloader) Transform(op itemimage.Operation) (itemimage.Operation, bool, error) {
+	size := itemimage.ItemSize(op.NewImage)
+	if size <= o.threshold {
+		return op, true, nil
+	}
+
+	type candidate struct {
+		name string
+		size int64
+	}
+	var candidates []candidate
+	for name, av := range op.NewImage {
+		if !o.keyAttrs[name] {
+			candidates = append(candidates, candidate{name, itemimage.AttributeSize(av)})
+		}
+	}
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		return cmp.Or(cmp.Compare(b.size, a.size), cmp.Compare(a.name, b.name))
+	})
+
+	for _, c := range candidates {
+		if size <= o.threshold {
+			break
+		}
+		pointer, err := o.offload(op.NewImage[c.name])
+		if err != nil {
+			return op, false, fmt.Errorf("failed to offload attribute %s: %w", c.name, err)
+		}
+		op.NewImage[c.name] = pointer
+		size += itemimage.AttributeSize(pointer) - c.size
+	}
+	if size > o.threshold {
+		return op, false, fmt.Errorf("item is %d bytes after offloading, over the %d byte threshold", size, o.threshold)
+	}
+	return op, true, nil
+}
+
+// offload uploads av and returns the pointer replacing it.
+func (o *Offloader) offload(av types.AttributeValue) (types.AttributeValue, error) {
+	var payload []byte
+	var typ, contentType string
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		payload, typ, contentType = []byte(v.Value), "S", "text/plain; charset=utf-8"
+	case *types.AttributeValueMemberB:
+		payload, typ, contentType = v.Value, "B", "application/octet-stream"
+	default:
+		var err error
+		if payload, err = attributevalue.MarshalJSON(av); err != nil {
+			return nil, fmt.Errorf("failed to encode value: %w", err)
+		}
+		typ, contentType = "JSON", "application/json"
+	}
+
+	sum := sha256.Sum256(payload)
+	key := o.prefix.Join(hex.EncodeToString(sum[:]))
+	out, err := o.client.PutObject(o.ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(key.Bucket),
+		Key:         aws.String(key.Key),
+		Body:        bytes.NewReader(payload),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+		PointerBucket: &types.AttributeValueMemberS{Value: key.Bucket},
+		PointerKey:    &types.AttributeValueMemberS{Value: key.Key},
+		PointerETag:   &types.AttributeValueMemberS{Value: aws.ToString(out.ETag)},
+		PointerType:   &types.AttributeValueMemberS{Value: typ},
+	}}, nil
+}
@@ -0,0 +1,102 @@
+package transform
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/ddbpitrtest"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// TestOffloaderMovesLargestAttributes verifies only the largest attributes of
+// an oversized item are offloaded, that their pointers lead to the original
+// payload, and that items under the threshold and key attributes are left as
+// they are.
+func TestOffloaderMovesLargestAttributes(t *testing.T) {
+	s3c := ddbpitrtest.NewS3()
+	o, err := NewOffloader(context.Background(), s3c, "s3://blobs/orders", 1200, []string{"pk"})
+	if err != nil {
+		t.Fatalf("NewOffloader failed: %v", err)
+	}
+
+	pdf := bytes.Repeat([]byte{7}, 900)
+	op := itemimage.Operation{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{
+		"pk":    &types.AttributeValueMemberS{Value: strings.Repeat("k", 500)},
+		"pdf":   &types.AttributeValueMemberB{Value: pdf},
+		"notes": &types.AttributeValueMemberS{Value: strings.Repeat("n", 400)},
+		"lines": &types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberN{Value: "1"}}},
+	}}
+	op, keep, err := o.Transform(op)
+	if err != nil || !keep {
+		t.Fatalf("Transform returned keep=%v err=%v", keep, err)
+	}
+	if _, ok := op.NewImage["pk"].(*types.AttributeValueMemberS); !ok {
+		t.Error("expected the key attribute to stay in the item")
+	}
+	// Offloading the pdf alone, for a pointer of about 140 bytes, fits the item
+	if _, ok := op.NewImage["notes"].(*types.AttributeValueMemberS); !ok {
+		t.Error("expected notes to stay in the item")
+	}
+	pointer, ok := op.NewImage["pdf"].(*types.AttributeValueMemberM)
+	if !ok {
+		t.Fatalf("expected pdf to be replaced by a pointer, got %T", op.NewImage["pdf"])
+	}
+	bucket := pointer.Value[PointerBucket].(*types.AttributeValueMemberS).Value
+	key := pointer.Value[PointerKey].(*types.AttributeValueMemberS).Value
+	if bucket != "blobs" || !strings.HasPrefix(key, "orders/") {
+		t.Errorf("expected the payload under s3://blobs/orders/, got s3://%s/%s", bucket, key)
+	}
+	if typ := pointer.Value[PointerType].(*types.AttributeValueMemberS).Value; typ != "B" {
+		t.Errorf("expected type B, got %s", typ)
+	}
+	if etag := pointer.Value[PointerETag].(*types.AttributeValueMemberS).Value; etag == "" {
+		t.Error("expected the pointer to carry the ETag")
+	}
+	if body, ok := s3c.Object(bucket, key); !ok || !bytes.Equal(body, pdf) {
+		t.Errorf("expected the raw payload at the pointer, got %d bytes", len(body))
+	}
+
+	small := itemimage.Operation{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "order#2"},
+	}}
+	if op, _, _ := o.Transform(small); op.NewImage["pk"].(*types.AttributeValueMemberS).Value != "order#2" {
+		t.Error("expected a small item to be left as it is")
+	}
+}
+
+// TestOffloaderFailures ensures items that cannot be brought under the
+// threshold, and failed uploads, fail the operation instead of writing it over
+// size.
+func TestOffloaderFailures(t *testing.T) {
+	s3c := ddbpitrtest.NewS3()
+	o, _ := NewOffloader(context.Background(), s3c, "s3://blobs/", 100, []string{"pk"})
+	huge := itemimage.Operation{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: strings.Repeat("k", 200)},
+	}}
+	if _, _, err := o.Transform(huge); err == nil {
+		t.Error("expected an error for an item whose keys exceed the threshold")
+	}
+
+	payload := strings.Repeat("x", 200)
+	s3c.FailKey("blobs", offloadKey([]byte(payload)), errors.New("access denied"))
+	op := itemimage.Operation{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{
+		"pk":   &types.AttributeValueMemberS{Value: "order#1"},
+		"body": &types.AttributeValueMemberS{Value: payload},
+	}}
+	if _, _, err := o.Transform(op); err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Errorf("expected the upload error, got %v", err)
+	}
+}
+
+// offloadKey returns the object key a payload is offloaded to under the top of
+// a bucket.
+func offloadKey(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,69 @@
+package transform
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// Projection restricts the top-level attributes that are restored, for example
+// to drop large blobs when rebuilding a lookup table. Key attributes are always
+// kept. Both images of an update lose the same attributes, so a dropped
+// attribute is neither set nor removed and keeps its value in the target. A
+// put replaces the whole item, so an item already in the target loses the
+// attributes dropped from its put.
+// Example:
+//
+//	p := transform.NewProjection(nil, []string{"payload", "thumbnail"}, []string{"pk", "sk"})
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil,
+//	    coordinator.WithTransformer(p),
+//	)
+type Projection struct {
+	include map[string]bool // Attributes kept besides the keys; nil keeps every attribute not excluded
+	exclude map[string]bool // Attributes dropped unless they are keys
+	keys    map[string]bool // Key attributes of the target table
+}
+
+// NewProjection keeps only the include attributes when include is non-empty,
+// and drops the exclude attributes. keyAttrs are the key attributes of the
+// target table, which full export items carry in their image only.
+// Example:
+//
+//	p := transform.NewProjection([]string{"email", "status"}, nil, []string{"pk"})
+func NewProjection(include, exclude, keyAttrs []string) *Projection {
+	set := func(attrs []string) map[string]bool {
+		if len(attrs) == 0 {
+			return nil
+		}
+		m := make(map[string]bool, len(attrs))
+		for _, attr := range attrs {
+			m[attr] = true
+		}
+		return m
+	}
+	return &Projection{include: set(include), exclude: set(exclude), keys: set(keyAttrs)}
+}
+
+// Transform removes the attributes outside the projection from both images.
+// It never drops operations; an update whose changes all lie outside the
+// projection is left with nothing to set and skipped by the writer.
+func (p *Projection) Transform(op itemimage.Operation) (itemimage.Operation, bool, error) {
+	for _, image := range []map[string]types.AttributeValue{op.NewImage, op.OldImage} {
+		for name := range image {
+			if !p.keeps(name, op.Keys) {
+				delete(image, name)
+			}
+		}
+	}
+	return op, true, nil
+}
+
+// keeps reports whether the attribute name is restored.
+func (p *Projection) keeps(name string, keys map[string]types.AttributeValue) bool {
+	if _, isKey := keys[name]; isKey || p.keys[name] {
+		return true
+	}
+	if p.exclude[name] {
+		return false
+	}
+	return p.include == nil || p.include[name]
+}
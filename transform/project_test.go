@@ -0,0 +1,71 @@
+package transform
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+func attrNames(image map[string]types.AttributeValue) []string {
+	var names []string
+	for name := range image {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// TestProjectionKeepsKeys verifies included and excluded attributes are
+// applied to full export items, which carry their key in the image only, and
+// that key attributes survive either list.
+func TestProjectionKeepsKeys(t *testing.T) {
+	item := func() itemimage.Operation {
+		s := &types.AttributeValueMemberS{Value: "x"}
+		return itemimage.Operation{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{
+			"pk": s, "sk": s, "email": s, "payload": s, "thumbnail": s,
+		}}
+	}
+	tests := []struct {
+		include, exclude []string
+		want             []string
+	}{
+		{include: []string{"email"}, want: []string{"email", "pk", "sk"}},
+		{exclude: []string{"payload", "thumbnail", "sk"}, want: []string{"email", "pk", "sk"}},
+		{include: []string{"email", "payload"}, exclude: []string{"payload"}, want: []string{"email", "pk", "sk"}},
+	}
+	for _, tt := range tests {
+		op, keep, err := NewProjection(tt.include, tt.exclude, []string{"pk", "sk"}).Transform(item())
+		if err != nil || !keep {
+			t.Fatalf("Transform returned keep=%v err=%v", keep, err)
+		}
+		if got := attrNames(op.NewImage); !slices.Equal(got, tt.want) {
+			t.Errorf("include %v exclude %v: got %v, want %v", tt.include, tt.exclude, got, tt.want)
+		}
+	}
+}
+
+// TestProjectionOfUpdates checks both images of an update are projected alike,
+// so an attribute outside the projection is not removed from the target just
+// because it is missing from the new image, while a projected attribute that
+// was removed still is.
+func TestProjectionOfUpdates(t *testing.T) {
+	s := &types.AttributeValueMemberS{Value: "x"}
+	op := itemimage.Operation{
+		Type:     itemimage.OpUpdate,
+		Keys:     map[string]types.AttributeValue{"pk": s},
+		OldImage: map[string]types.AttributeValue{"pk": s, "email": s, "status": s, "payload": s},
+		NewImage: map[string]types.AttributeValue{"pk": s, "email": s},
+	}
+	op, _, err := NewProjection([]string{"email", "status"}, nil, nil).Transform(op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := attrNames(op.OldImage); !slices.Equal(got, []string{"email", "pk", "status"}) {
+		t.Errorf("old image = %v, want payload dropped", got)
+	}
+	if got := attrNames(op.NewImage); !slices.Equal(got, []string{"email", "pk"}) {
+		t.Errorf("new image = %v", got)
+	}
+}
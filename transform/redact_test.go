@@ -0,0 +1,152 @@
+package transform
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+func sampleOp(email string) itemimage.Operation {
+	return itemimage.Operation{
+		Type: itemimage.OpPut,
+		Keys: map[string]types.AttributeValue{
+			"email": &types.AttributeValueMemberS{Value: email},
+		},
+		NewImage: map[string]types.AttributeValue{
+			"email": &types.AttributeValueMemberS{Value: email},
+			"ssn":   &types.AttributeValueMemberS{Value: "123-45-6789"},
+			"age":   &types.AttributeValueMemberN{Value: "42"},
+			"profile": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+				"name": &types.AttributeValueMemberS{Value: "Jane Doe"},
+				"city": &types.AttributeValueMemberS{Value: "Oslo"},
+			}},
+		},
+	}
+}
+
+func testRedactor() *Redactor {
+	return NewRedactor(RedactionRules{
+		Salt: "salt",
+		Rules: []RedactionRule{
+			{Path: "email", Action: ActionHash},
+			{Path: "ssn", Action: ActionRedact},
+			{Path: "age", Action: ActionHash},
+			{Path: "profile.name", Action: ActionFake, Kind: FakeName},
+		},
+	})
+}
+
+// TestRedactorAppliesRules checks each action on a representative item, including
+// a nested map path, and that unmatched attributes are left alone.
+func TestRedactorAppliesRules(t *testing.T) {
+	op, keep, err := testRedactor().Transform(sampleOp("jane@example.org"))
+	if err != nil || !keep {
+		t.Fatalf("Transform returned keep=%v err=%v", keep, err)
+	}
+
+	email := op.NewImage["email"].(*types.AttributeValueMemberS).Value
+	if email == "jane@example.org" || len(email) != 32 {
+		t.Errorf("email not hashed: %q", email)
+	}
+	if got := op.NewImage["ssn"].(*types.AttributeValueMemberS).Value; got != redactedString {
+		t.Errorf("ssn not redacted: %q", got)
+	}
+	if got := op.NewImage["age"].(*types.AttributeValueMemberN).Value; got == "42" {
+		t.Errorf("age not hashed: %q", got)
+	}
+	profile := op.NewImage["profile"].(*types.AttributeValueMemberM).Value
+	if got := profile["name"].(*types.AttributeValueMemberS).Value; got == "Jane Doe" {
+		t.Errorf("profile.name not faked: %q", got)
+	}
+	if got := profile["city"].(*types.AttributeValueMemberS).Value; got != "Oslo" {
+		t.Errorf("profile.city should be untouched, got %q", got)
+	}
+}
+
+// TestRedactorHashIsDeterministic verifies that the same value hashes identically
+// across operations and between keys and images, which keeps joins and key
+// lookups working on redacted data.
+func TestRedactorHashIsDeterministic(t *testing.T) {
+	r := testRedactor()
+	a, _, _ := r.Transform(sampleOp("jane@example.org"))
+	b, _, _ := r.Transform(sampleOp("jane@example.org"))
+	c, _, _ := r.Transform(sampleOp("john@example.org"))
+
+	key := a.Keys["email"].(*types.AttributeValueMemberS).Value
+	if img := a.NewImage["email"].(*types.AttributeValueMemberS).Value; img != key {
+		t.Errorf("key and image hashes differ: %q vs %q", key, img)
+	}
+	if other := b.Keys["email"].(*types.AttributeValueMemberS).Value; other != key {
+		t.Errorf("hash is not deterministic: %q vs %q", key, other)
+	}
+	if other := c.Keys["email"].(*types.AttributeValueMemberS).Value; other == key {
+		t.Error("distinct values produced the same hash")
+	}
+
+	salted := NewRedactor(RedactionRules{Salt: "other", Rules: []RedactionRule{{Path: "email", Action: ActionHash}}})
+	d, _, _ := salted.Transform(sampleOp("jane@example.org"))
+	if d.Keys["email"].(*types.AttributeValueMemberS).Value == key {
+		t.Error("hash does not depend on the salt")
+	}
+}
+
+// TestRedactorCollections verifies that sets and lists are rewritten element by
+// element and keep their DynamoDB type.
+func TestRedactorCollections(t *testing.T) {
+	r := NewRedactor(RedactionRules{Rules: []RedactionRule{
+		{Path: "tags", Action: ActionRedact},
+		{Path: "phones", Action: ActionFake, Kind: FakePhone},
+	}})
+	op := itemimage.Operation{NewImage: map[string]types.AttributeValue{
+		"tags": &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+		"phones": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberS{Value: "+47 1234"},
+		}},
+	}}
+	op, _, _ = r.Transform(op)
+
+	// Redacting both elements collapses them into one, since sets must be unique
+	if tags := op.NewImage["tags"].(*types.AttributeValueMemberSS).Value; len(tags) != 1 || tags[0] != redactedString {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+	phone := op.NewImage["phones"].(*types.AttributeValueMemberL).Value[0].(*types.AttributeValueMemberS).Value
+	if !strings.HasPrefix(phone, "+1555") || len(phone) != 12 {
+		t.Errorf("unexpected fake phone: %q", phone)
+	}
+}
+
+// TestLoadRedactionRules loads a rules file from disk and rejects invalid ones.
+func TestLoadRedactionRules(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.json")
+	if err := os.WriteFile(good, []byte(`{"salt":"s","rules":[{"path":"a.b","action":"fake","kind":"email"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRedactionRules(good)
+	if err != nil {
+		t.Fatalf("LoadRedactionRules failed: %v", err)
+	}
+	if len(rules.Rules) != 1 || rules.Rules[0].Path != "a.b" {
+		t.Errorf("unexpected rules: %+v", rules)
+	}
+
+	for _, content := range []string{
+		`{"rules":[]}`,
+		`{"rules":[{"path":"a","action":"scramble"}]}`,
+		`{"rules":[{"path":"a","action":"hash","kind":"email"}]}`,
+		`{"rules":[{"path":"a.","action":"redact"}]}`,
+		`not json`,
+	} {
+		bad := filepath.Join(dir, "bad.json")
+		if err := os.WriteFile(bad, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadRedactionRules(bad); err == nil {
+			t.Errorf("expected error for %s", content)
+		}
+	}
+}
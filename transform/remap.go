@@ -0,0 +1,106 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// maxCollisionSamples caps how many colliding keys are kept for reporting.
+const maxCollisionSamples = 10
+
+// KeyRemapper rewrites a string key attribute to prefix + value + suffix so an
+// export can be restored side by side into the live table it came from.
+//
+// The remapped namespace overlaps the live one whenever a source key already has
+// the prefix and suffix: the restored copy of "A" becomes "RESTORED#A" and would
+// overwrite a live item whose key is literally "RESTORED#A". Such source keys are
+// counted as collisions and reported; the operations themselves are still written.
+// Example:
+//
+//	r := transform.NewKeyRemapper("pk", "RESTORED#", "")
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil,
+//	    coordinator.WithTransformer(r),
+//	)
+//	// after Run
+//	if n, samples := r.Collisions(); n > 0 {
+//	    fmt.Printf("%d keys collide, e.g. %v\n", n, samples)
+//	}
+type KeyRemapper struct {
+	attr       string
+	prefix     string
+	suffix     string
+	samples    []string // First maxCollisionSamples colliding source keys
+	collisions int64
+	mu         sync.Mutex
+}
+
+// NewKeyRemapper creates a KeyRemapper for attr.
+// Example:
+//
+//	r := transform.NewKeyRemapper("pk", "RESTORED#", "")
+func NewKeyRemapper(attr, prefix, suffix string) *KeyRemapper {
+	return &KeyRemapper{attr: attr, prefix: prefix, suffix: suffix}
+}
+
+// Transform rewrites attr in the keys and both images. Operations without attr or
+// with a non-string attr fail, since they cannot be placed in the new namespace.
+func (r *KeyRemapper) Transform(op itemimage.Operation) (itemimage.Operation, bool, error) {
+	original, err := r.originalKey(op)
+	if err != nil {
+		return op, false, err
+	}
+	if strings.HasPrefix(original, r.prefix) && strings.HasSuffix(original, r.suffix) &&
+		len(original) >= len(r.prefix)+len(r.suffix) {
+		r.recordCollision(original)
+	}
+
+	remapped := r.prefix + original + r.suffix
+	for _, image := range []map[string]types.AttributeValue{op.Keys, op.NewImage, op.OldImage} {
+		if _, ok := image[r.attr]; ok {
+			image[r.attr] = &types.AttributeValueMemberS{Value: remapped}
+		}
+	}
+	return op, true, nil
+}
+
+// originalKey returns the string value of attr, looking in the keys first and the
+// images for FULL exports.
+func (r *KeyRemapper) originalKey(op itemimage.Operation) (string, error) {
+	av, ok := op.Keys[r.attr]
+	if !ok {
+		av, ok = op.NewImage[r.attr]
+	}
+	if !ok {
+		av, ok = op.OldImage[r.attr]
+	}
+	if !ok {
+		return "", fmt.Errorf("operation has no %s attribute to remap", r.attr)
+	}
+	s, ok := av.(*types.AttributeValueMemberS)
+	if !ok {
+		return "", fmt.Errorf("cannot remap non-string key attribute %s (%T)", r.attr, av)
+	}
+	return s.Value, nil
+}
+
+// recordCollision counts a source key that already lies in the remapped namespace.
+func (r *KeyRemapper) recordCollision(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collisions++
+	if len(r.samples) < maxCollisionSamples {
+		r.samples = append(r.samples, key)
+	}
+}
+
+// Collisions returns the number of source keys that already lie in the remapped
+// namespace, and up to ten of them as examples.
+func (r *KeyRemapper) Collisions() (int64, []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.collisions, append([]string(nil), r.samples...)
+}
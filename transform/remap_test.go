@@ -0,0 +1,70 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// TestKeyRemapperRewritesKeysAndImages verifies that the key attribute is rewritten
+// consistently in every section of an update, leaving other attributes alone.
+func TestKeyRemapperRewritesKeysAndImages(t *testing.T) {
+	r := NewKeyRemapper("pk", "RESTORED#", "#v1")
+	op := itemimage.Operation{
+		Type:     itemimage.OpUpdate,
+		Keys:     map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "A"}},
+		NewImage: map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "A"}, "v": &types.AttributeValueMemberN{Value: "2"}},
+		OldImage: map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "A"}, "v": &types.AttributeValueMemberN{Value: "1"}},
+	}
+
+	op, keep, err := r.Transform(op)
+	if err != nil || !keep {
+		t.Fatalf("Transform returned keep=%v err=%v", keep, err)
+	}
+	for name, image := range map[string]map[string]types.AttributeValue{"Keys": op.Keys, "NewImage": op.NewImage, "OldImage": op.OldImage} {
+		if got := image["pk"].(*types.AttributeValueMemberS).Value; got != "RESTORED#A#v1" {
+			t.Errorf("%s pk = %q, want RESTORED#A#v1", name, got)
+		}
+	}
+	if got := op.NewImage["v"].(*types.AttributeValueMemberN).Value; got != "2" {
+		t.Errorf("non-key attribute changed: %q", got)
+	}
+	if n, _ := r.Collisions(); n != 0 {
+		t.Errorf("expected no collisions, got %d", n)
+	}
+}
+
+// TestKeyRemapperReportsCollisions checks that source keys already inside the
+// remapped namespace are reported, since their remapped twins overwrite them.
+func TestKeyRemapperReportsCollisions(t *testing.T) {
+	r := NewKeyRemapper("pk", "RESTORED#", "")
+	for _, pk := range []string{"A", "RESTORED#A", "B"} {
+		op := itemimage.Operation{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: pk},
+		}}
+		if _, _, err := r.Transform(op); err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+	}
+
+	n, samples := r.Collisions()
+	if n != 1 || len(samples) != 1 || samples[0] != "RESTORED#A" {
+		t.Errorf("expected one collision on RESTORED#A, got %d %v", n, samples)
+	}
+}
+
+// TestKeyRemapperRejectsUnmappableKeys ensures number keys and missing keys fail
+// instead of being written under their original key.
+func TestKeyRemapperRejectsUnmappableKeys(t *testing.T) {
+	r := NewKeyRemapper("pk", "RESTORED#", "")
+	ops := []itemimage.Operation{
+		{NewImage: map[string]types.AttributeValue{"pk": &types.AttributeValueMemberN{Value: "1"}}},
+		{NewImage: map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "1"}}},
+	}
+	for _, op := range ops {
+		if _, _, err := r.Transform(op); err == nil {
+			t.Errorf("expected error for %v", op.NewImage)
+		}
+	}
+}
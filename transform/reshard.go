@@ -0,0 +1,95 @@
+package transform
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// Resharder moves items between the calculated write shards of a string key
+// attribute whose values end in a shard number, such as "2024-05-01#3", so an
+// export of a table written with one shard count can be restored into a design
+// with another. The new shard is a hash of another attribute, usually the sort
+// key, modulo the shard count; every operation on an item carries the same
+// value, so its puts, updates and deletes all land on the same shard.
+//
+// Items that differ only in their old shard, with equal values of the hashed
+// attribute, land on the same key and overwrite each other, so the hashed
+// attribute must tell apart the items of a base value.
+// Example:
+//
+//	r := transform.NewResharder("pk", "#", "sk", 16)
+//	// {"pk": "2024-05-01#3", "sk": "order#42"} becomes {"pk": "2024-05-01#11", ...}
+type Resharder struct {
+	attr   string // String key attribute holding <base><sep><shard>
+	sep    string // Separator before the shard number
+	by     string // Attribute whose value is hashed to pick the new shard
+	shards int    // Shard count of the target design; shards are numbered from 0
+}
+
+// NewResharder creates a Resharder rewriting the shard suffix of attr, after
+// the last sep, to a hash of by modulo shards.
+// Example:
+//
+//	r := transform.NewResharder("pk", "#", "sk", 16)
+func NewResharder(attr, sep, by string, shards int) *Resharder {
+	return &Resharder{attr: attr, sep: sep, by: by, shards: shards}
+}
+
+// Transform rewrites the shard of attr in the keys and both images. Operations
+// whose attr is missing, not a string or without a numeric shard suffix fail,
+// as do those without the hashed attribute, since they cannot be placed.
+func (r *Resharder) Transform(op itemimage.Operation) (itemimage.Operation, bool, error) {
+	av := lookup(op, r.attr)
+	if av == nil {
+		return op, false, fmt.Errorf("operation has no %s attribute to reshard", r.attr)
+	}
+	s, ok := av.(*types.AttributeValueMemberS)
+	if !ok {
+		return op, false, fmt.Errorf("cannot reshard non-string key attribute %s (%T)", r.attr, av)
+	}
+	i := strings.LastIndex(s.Value, r.sep)
+	if i < 0 {
+		return op, false, fmt.Errorf("%s value %q has no shard suffix after %q", r.attr, s.Value, r.sep)
+	}
+	if _, err := strconv.ParseUint(s.Value[i+len(r.sep):], 10, 32); err != nil {
+		return op, false, fmt.Errorf("%s value %q has no shard number after %q", r.attr, s.Value, r.sep)
+	}
+
+	h := fnv.New32a()
+	switch v := lookup(op, r.by).(type) {
+	case *types.AttributeValueMemberS:
+		h.Write([]byte(v.Value))
+	case *types.AttributeValueMemberN:
+		h.Write([]byte(v.Value))
+	case *types.AttributeValueMemberB:
+		h.Write(v.Value)
+	case nil:
+		return op, false, fmt.Errorf("operation has no %s attribute to pick a shard by", r.by)
+	default:
+		return op, false, fmt.Errorf("cannot pick a shard by %s (%T)", r.by, v)
+	}
+	resharded := s.Value[:i+len(r.sep)] + strconv.Itoa(int(h.Sum32()%uint32(r.shards)))
+
+	for _, image := range []map[string]types.AttributeValue{op.Keys, op.NewImage, op.OldImage} {
+		if _, ok := image[r.attr]; ok {
+			image[r.attr] = &types.AttributeValueMemberS{Value: resharded}
+		}
+	}
+	return op, true, nil
+}
+
+// lookup returns attr of op, looking in the keys first and the images for full
+// exports and non-key attributes, or nil when op has none.
+func lookup(op itemimage.Operation, attr string) types.AttributeValue {
+	for _, image := range []map[string]types.AttributeValue{op.Keys, op.NewImage, op.OldImage} {
+		if av, ok := image[attr]; ok {
+			return av
+		}
+	}
+	return nil
+}
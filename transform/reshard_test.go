@@ -0,0 +1,70 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+func shardedPut(pk, sk string) itemimage.Operation {
+	return itemimage.Operation{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: pk},
+		"sk": &types.AttributeValueMemberS{Value: sk},
+	}}
+}
+
+// TestResharderSpreadsShards verifies items of a 4-shard design spread over
+// every shard of a 16-shard design, keeping the base of the key, and that an
+// item's update and delete land on the shard its put did.
+func TestResharderSpreadsShards(t *testing.T) {
+	r := NewResharder("pk", "#", "sk", 16)
+	seen := make(map[string]bool)
+	for i := range 400 {
+		op, keep, err := r.Transform(shardedPut(fmt.Sprintf("2024-05-01#%d", i%4), fmt.Sprintf("order#%d", i)))
+		if err != nil || !keep {
+			t.Fatalf("Transform returned keep=%v err=%v", keep, err)
+		}
+		pk := op.NewImage["pk"].(*types.AttributeValueMemberS).Value
+		if !strings.HasPrefix(pk, "2024-05-01#") {
+			t.Fatalf("expected the base to be kept, got %q", pk)
+		}
+		seen[pk] = true
+	}
+	if len(seen) != 16 {
+		t.Errorf("expected all 16 shards to be used, got %d", len(seen))
+	}
+
+	put, _, _ := r.Transform(shardedPut("2024-05-01#2", "order#7"))
+	update, _, _ := r.Transform(itemimage.Operation{
+		Type:     itemimage.OpUpdate,
+		Keys:     map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "2024-05-01#2"}, "sk": &types.AttributeValueMemberS{Value: "order#7"}},
+		NewImage: map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "2024-05-01#2"}, "sk": &types.AttributeValueMemberS{Value: "order#7"}},
+		OldImage: map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "2024-05-01#2"}, "sk": &types.AttributeValueMemberS{Value: "order#7"}},
+	})
+	want := put.NewImage["pk"].(*types.AttributeValueMemberS).Value
+	for name, image := range map[string]map[string]types.AttributeValue{"Keys": update.Keys, "NewImage": update.NewImage, "OldImage": update.OldImage} {
+		if got := image["pk"].(*types.AttributeValueMemberS).Value; got != want {
+			t.Errorf("%s pk = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// TestResharderRejectsUnshardedKeys ensures keys without a numeric shard suffix
+// or without the hashed attribute fail instead of being written unsharded.
+func TestResharderRejectsUnshardedKeys(t *testing.T) {
+	r := NewResharder("pk", "#", "sk", 16)
+	for name, op := range map[string]itemimage.Operation{
+		"no separator":    shardedPut("2024-05-01", "order#1"),
+		"non-numeric":     shardedPut("2024-05-01#x", "order#1"),
+		"no sort key":     {Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "a#1"}}},
+		"numeric key":     {Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"pk": &types.AttributeValueMemberN{Value: "1"}}},
+		"missing the key": {Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"sk": &types.AttributeValueMemberS{Value: "order#1"}}},
+	} {
+		if _, _, err := r.Transform(op); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
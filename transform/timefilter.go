@@ -0,0 +1,61 @@
+package transform
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// writeTimestampField opens the write time of an incremental export line as
+// DynamoDB writes it. Attribute values always open with their type, so the
+// bytes cannot occur inside an item, and quotes inside strings are escaped.
+var writeTimestampField = []byte(`"Metadata":{"WriteTimestampMicros":{"N":"`)
+
+// TimeFilter drops incremental export records written after a target time, to
+// restore a table as it was at that time rather than at the end of the last
+// export. It rejects most later lines before they are decoded with Keep, and
+// makes the precise decision on the decoded write time with Transform. Full
+// export items carry no write time and are always kept.
+// Example:
+//
+//	f := transform.NewTimeFilter(restoreTo)
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil,
+//	    coordinator.WithLineFilter(f),
+//	    coordinator.WithTransformer(f),
+//	)
+type TimeFilter struct {
+	until int64 // Latest write time kept, in microseconds since the Unix epoch
+}
+
+// NewTimeFilter keeps records written at or before until.
+// Example:
+//
+//	f := transform.NewTimeFilter(time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC))
+func NewTimeFilter(until time.Time) *TimeFilter {
+	return &TimeFilter{until: until.UnixMicro()}
+}
+
+// Keep reports whether line may hold a record written at or before the target
+// time. Lines whose write time cannot be found without decoding are kept.
+//
+// HOT PATH: Called for every line before decoding.
+func (f *TimeFilter) Keep(line []byte) bool {
+	i := bytes.Index(line, writeTimestampField)
+	if i < 0 {
+		return true
+	}
+	digits := line[i+len(writeTimestampField):]
+	end := bytes.IndexByte(digits, '"')
+	if end < 0 {
+		return true
+	}
+	micros, err := strconv.ParseInt(string(digits[:end]), 10, 64)
+	return err != nil || micros <= f.until
+}
+
+// Transform drops operations written after the target time.
+func (f *TimeFilter) Transform(op itemimage.Operation) (itemimage.Operation, bool, error) {
+	return op, op.WriteTimestampMicros <= f.until, nil
+}
@@ -0,0 +1,42 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// TestTimeFilter checks the pre-scan and the decoded write time agree on
+// incremental export lines, that lines whose write time is not where the
+// pre-scan looks are left to the decoded check, and that full export items
+// are kept.
+func TestTimeFilter(t *testing.T) {
+	f := NewTimeFilter(time.UnixMicro(1700000000000000))
+	decoder := itemimage.NewJSONDecoder()
+
+	cases := []struct {
+		line      string
+		prescan   bool
+		transform bool
+	}{
+		{`{"Metadata":{"WriteTimestampMicros":{"N":"1700000000000000"}},"Keys":{"pk":{"S":"a"}},"NewImage":{"pk":{"S":"a"}}}`, true, true},
+		{`{"Metadata":{"WriteTimestampMicros":{"N":"1700000000000001"}},"Keys":{"pk":{"S":"a"}},"NewImage":{"pk":{"S":"a"}}}`, false, false},
+		// An attribute named like the field does not decide the pre-scan
+		{`{"Keys":{"pk":{"S":"a"}},"NewImage":{"pk":{"S":"a"},"WriteTimestampMicros":{"N":"1"}},"Metadata":{"WriteTimestampMicros":{"N":"1800000000000000"}}}`, false, false},
+		{`{"Keys":{"pk":{"S":"a"}},"NewImage":{"pk":{"S":"a"},"Metadata":{"M":{"WriteTimestampMicros":{"N":"1800000000000000"}}}}}`, true, true},
+		{`{"Item":{"pk":{"S":"a"}}}`, true, true},
+	}
+	for _, tc := range cases {
+		if got := f.Keep([]byte(tc.line)); got != tc.prescan {
+			t.Errorf("Keep(%s) = %v, want %v", tc.line, got, tc.prescan)
+		}
+		op, err := decoder.Decode([]byte(tc.line))
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if _, keep, _ := f.Transform(op); keep != tc.transform {
+			t.Errorf("Transform(%s) keep = %v, want %v", tc.line, keep, tc.transform)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package transform
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// Epoch numbers above these bounds are taken to be in a finer unit: seconds
+// reach 1e11 in the year 5138, so larger values are milliseconds, and so on.
+const (
+	maxEpochSeconds = 1e11
+	maxEpochMillis  = 1e14
+	maxEpochMicros  = 1e17
+)
+
+// TimeShifter rewrites timestamp attributes, moving each by a fixed delta or
+// setting it to a fixed time, so the TTLs and schedules of an old snapshot are
+// not already stale when it is restored. Numbers are taken as epoch times in
+// seconds, milliseconds, microseconds or nanoseconds by their magnitude and
+// keep their unit; strings in ISO 8601 form keep their layout, precision and
+// offset. Values of other types or forms are left as they are and counted.
+// Example:
+//
+//	s := transform.NewTimeShifter([]string{"ttl", "nextRunAt"}, 90*24*time.Hour)
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil,
+//	    coordinator.WithTransformer(s),
+//	)
+type TimeShifter struct {
+	attrs     []string
+	shift     func(time.Time) time.Time
+	unchanged atomic.Int64 // Values of a shifted attribute that are not timestamps
+}
+
+// NewTimeShifter moves attrs by delta, which may be negative.
+// Example:
+//
+//	s := transform.NewTimeShifter([]string{"ttl"}, 30*24*time.Hour)
+func NewTimeShifter(attrs []string, delta time.Duration) *TimeShifter {
+	return &TimeShifter{attrs: attrs, shift: func(t time.Time) time.Time { return t.Add(delta) }}
+}
+
+// NewTimeSetter sets attrs to now, in the unit or layout of each value.
+// Example:
+//
+//	s := transform.NewTimeSetter([]string{"updatedAt"}, time.Now())
+func NewTimeSetter(attrs []string, now time.Time) *TimeShifter {
+	return &TimeShifter{attrs: attrs, shift: func(time.Time) time.Time { return now }}
+}
+
+// Transform rewrites the attributes in the keys and both images, so a
+// timestamp sort key stays consistent between them. It never drops operations.
+func (s *TimeShifter) Transform(op itemimage.Operation) (itemimage.Operation, bool, error) {
+	for _, image := range []map[string]types.AttributeValue{op.Keys, op.NewImage, op.OldImage} {
+		for _, attr := range s.attrs {
+			av, ok := image[attr]
+			if !ok {
+				continue
+			}
+			if shifted, ok := s.shiftValue(av); ok {
+				image[attr] = shifted
+			} else {
+				s.unchanged.Add(1)
+			}
+		}
+	}
+	return op, true, nil
+}
+
+// Unchanged returns the number of values of the attributes that were left as
+// they were because they are neither epoch numbers nor ISO 8601 strings.
+func (s *TimeShifter) Unchanged() int64 {
+	return s.unchanged.Load()
+}
+
+// shiftValue returns av with its time shifted, or false when it holds no time.
+func (s *TimeShifter) shiftValue(av types.AttributeValue) (types.AttributeValue, bool) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberN:
+		n, ok := s.shiftEpoch(v.Value)
+		return &types.AttributeValueMemberN{Value: n}, ok
+	case *types.AttributeValueMemberS:
+		str, ok := s.shiftISO(v.Value)
+		return &types.AttributeValueMemberS{Value: str}, ok
+	}
+	return nil, false
+}
+
+// shiftEpoch shifts an epoch number, keeping its unit. Fractional values keep
+// their number of decimals.
+func (s *TimeShifter) shiftEpoch(value string) (string, bool) {
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		unit := epochUnit(math.Abs(float64(i)))
+		return strconv.FormatInt(fromEpoch(s.shift(toEpoch(i, unit)), unit), 10), true
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) || math.Abs(f) >= math.MaxInt64 {
+		return "", false
+	}
+	unit := epochUnit(math.Abs(f))
+	whole := math.Floor(f)
+	t := toEpoch(int64(whole), unit).Add(time.Duration((f - whole) * float64(unit)))
+	shifted := s.shift(t)
+	n := fromEpoch(shifted, unit)
+	frac := float64(shifted.Sub(toEpoch(n, unit))) / float64(unit)
+	decimals := 0
+	if dot := strings.IndexByte(value, '.'); dot >= 0 && !strings.ContainsAny(value, "eE") {
+		decimals = len(value) - dot - 1
+	}
+	return strconv.FormatFloat(float64(n)+frac, 'f', decimals, 64), true
+}
+
+// epochUnit returns the unit of an epoch number of magnitude abs.
+func epochUnit(abs float64) time.Duration {
+	switch {
+	case abs < maxEpochSeconds:
+		return time.Second
+	case abs < maxEpochMillis:
+		return time.Millisecond
+	case abs < maxEpochMicros:
+		return time.Microsecond
+	default:
+		return time.Nanosecond
+	}
+}
+
+// toEpoch returns the time n units after the Unix epoch.
+func toEpoch(n int64, unit time.Duration) time.Time {
+	switch unit {
+	case time.Second:
+		return time.Unix(n, 0)
+	case time.Millisecond:
+		return time.UnixMilli(n)
+	case time.Microsecond:
+		return time.UnixMicro(n)
+	default:
+		return time.Unix(0, n)
+	}
+}
+
+// fromEpoch returns t as whole units since the Unix epoch, rounded down.
+func fromEpoch(t time.Time, unit time.Duration) int64 {
+	switch unit {
+	case time.Second:
+		return t.Unix()
+	case time.Millisecond:
+		return t.UnixMilli()
+	case time.Microsecond:
+		return t.UnixMicro()
+	default:
+		return t.UnixNano()
+	}
+}
+
+// shiftISO shifts an ISO 8601 date or date and time, formatting the result in
+// the layout, fractional precision and offset of value.
+func (s *TimeShifter) shiftISO(value string) (string, bool) {
+	layout, ok := isoLayout(value)
+	if !ok {
+		return "", false
+	}
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return "", false
+	}
+	return s.shift(t).In(t.Location()).Format(layout), true
+}
+
+// isoLayout returns the layout of an ISO 8601 date (2006-01-02) or date and
+// time with optional fractional seconds and offset.
+func isoLayout(value string) (string, bool) {
+	const date = "2006-01-02"
+	if len(value) == len(date) {
+		return date, true
+	}
+	if len(value) < len(date+"T15:04:05") || (value[10] != 'T' && value[10] != ' ') {
+		return "", false
+	}
+	layout := date + value[10:11] + "15:04:05"
+	rest := value[len(layout):]
+	if strings.HasPrefix(rest, ".") {
+		digits := 1
+		for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+			digits++
+		}
+		layout += "." + strings.Repeat("0", digits-1)
+		rest = rest[digits:]
+	}
+	switch {
+	case rest == "":
+	case rest == "Z" || strings.HasPrefix(rest, "+") || strings.HasPrefix(rest, "-"):
+		layout += "Z07:00"
+	default:
+		return "", false
+	}
+	return layout, true
+}
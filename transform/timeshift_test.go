@@ -0,0 +1,79 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// TestTimeShifterKeepsUnitsAndLayouts verifies values move by the delta while
+// keeping the epoch unit, decimals, ISO layout, precision and offset they had,
+// so the application reading them back parses them as before.
+func TestTimeShifterKeepsUnitsAndLayouts(t *testing.T) {
+	tests := []struct {
+		in   types.AttributeValue
+		want string
+	}{
+		{&types.AttributeValueMemberN{Value: "1700000000"}, "1700086400"},
+		{&types.AttributeValueMemberN{Value: "1700000000123"}, "1700086400123"},
+		{&types.AttributeValueMemberN{Value: "1700000000123456"}, "1700086400123456"},
+		{&types.AttributeValueMemberN{Value: "1700000000123456789"}, "1700086400123456789"},
+		{&types.AttributeValueMemberN{Value: "1700000000.25"}, "1700086400.25"},
+		{&types.AttributeValueMemberS{Value: "2023-11-14T22:13:20Z"}, "2023-11-15T22:13:20Z"},
+		{&types.AttributeValueMemberS{Value: "2023-11-14T23:13:20.500+01:00"}, "2023-11-15T23:13:20.500+01:00"},
+		{&types.AttributeValueMemberS{Value: "2023-11-14 22:13:20"}, "2023-11-15 22:13:20"},
+		{&types.AttributeValueMemberS{Value: "2023-11-14"}, "2023-11-15"},
+	}
+	s := NewTimeShifter([]string{"at"}, 24*time.Hour)
+	for _, tt := range tests {
+		op := itemimage.Operation{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"at": tt.in}}
+		op, keep, err := s.Transform(op)
+		if err != nil || !keep {
+			t.Fatalf("Transform returned keep=%v err=%v", keep, err)
+		}
+		var got string
+		switch v := op.NewImage["at"].(type) {
+		case *types.AttributeValueMemberN:
+			got = v.Value
+		case *types.AttributeValueMemberS:
+			got = v.Value
+		}
+		if got != tt.want {
+			t.Errorf("shifting %v: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if n := s.Unchanged(); n != 0 {
+		t.Errorf("expected every value to be shifted, %d were not", n)
+	}
+}
+
+// TestTimeShifterLeavesOtherValues checks attributes that hold no timestamp are
+// kept and counted instead of failing the restore, and that keys and old images
+// are shifted along with new images.
+func TestTimeShifterLeavesOtherValues(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	s := NewTimeSetter([]string{"at", "ttl"}, now)
+	op := itemimage.Operation{
+		Type:     itemimage.OpUpdate,
+		Keys:     map[string]types.AttributeValue{"at": &types.AttributeValueMemberS{Value: "2020-01-01T00:00:00Z"}},
+		NewImage: map[string]types.AttributeValue{"at": &types.AttributeValueMemberS{Value: "2020-01-01T00:00:00Z"}, "ttl": &types.AttributeValueMemberS{Value: "soon"}},
+		OldImage: map[string]types.AttributeValue{"at": &types.AttributeValueMemberS{Value: "2020-01-01T00:00:00Z"}, "ttl": &types.AttributeValueMemberBOOL{Value: true}},
+	}
+	op, _, err := s.Transform(op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, image := range map[string]map[string]types.AttributeValue{"Keys": op.Keys, "NewImage": op.NewImage, "OldImage": op.OldImage} {
+		if got := image["at"].(*types.AttributeValueMemberS).Value; got != "2026-10-15T12:00:00Z" {
+			t.Errorf("%s at = %q, want the time it was set to", name, got)
+		}
+	}
+	if got := op.NewImage["ttl"].(*types.AttributeValueMemberS).Value; got != "soon" {
+		t.Errorf("non-timestamp value changed to %q", got)
+	}
+	if n := s.Unchanged(); n != 2 {
+		t.Errorf("expected 2 unchanged values, got %d", n)
+	}
+}
@@ -0,0 +1,95 @@
+// Package transform rewrites or filters decoded operations between decoding and
+// writing. Transformers let a restore reshape production data, for example to
+// redact personal data before it lands in a non-production table.
+package transform
+
+import (
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// Transformer rewrites a single operation. Returning keep=false drops the operation
+// so it is never written. Implementations must be safe for concurrent use because
+// every worker shares the same transformer.
+// Example:
+//
+//	op, keep, err := t.Transform(op)
+//	if err != nil || !keep {
+//	    return err
+//	}
+type Transformer interface {
+	Transform(op itemimage.Operation) (itemimage.Operation, bool, error)
+}
+
+// Func adapts an ordinary function to the Transformer interface.
+// Example:
+//
+//	dropDeletes := transform.Func(func(op itemimage.Operation) (itemimage.Operation, bool, error) {
+//	    return op, op.Type != itemimage.OpDelete, nil
+//	})
+type Func func(op itemimage.Operation) (itemimage.Operation, bool, error)
+
+// Transform calls f(op).
+func (f Func) Transform(op itemimage.Operation) (itemimage.Operation, bool, error) {
+	return f(op)
+}
+
+// Not keeps the operations the filter t drops and drops those it keeps,
+// passing them on unchanged, so a filter can leave out what it selects. Errors
+// of t are returned as they are.
+// Example:
+//
+//	rest := transform.Not(transform.NewKeyPrefixFilter("pk", "ACCOUNT#"))
+func Not(t Transformer) Transformer {
+	return Func(func(op itemimage.Operation) (itemimage.Operation, bool, error) {
+		_, keep, err := t.Transform(op)
+		if err != nil {
+			return op, false, err
+		}
+		return op, !keep, nil
+	})
+}
+
+// Chain applies transformers in order, stopping at the first one that drops the
+// operation or fails.
+// Example:
+//
+//	t := transform.Chain{redactor, filter}
+type Chain []Transformer
+
+// Transform runs op through every transformer in the chain.
+func (c Chain) Transform(op itemimage.Operation) (itemimage.Operation, bool, error) {
+	for _, t := range c {
+		var keep bool
+		var err error
+		op, keep, err = t.Transform(op)
+		if err != nil || !keep {
+			return op, keep, err
+		}
+	}
+	return op, true, nil
+}
+
+// LineFilter rejects raw lines before they are decoded. A false result from
+// Keep is definitive; a true one must still be confirmed after decoding.
+type LineFilter interface {
+	Keep(line []byte) bool
+}
+
+// LineFilters keeps the lines every filter keeps, so several filters can
+// pre-scan the lines of one restore.
+// Example:
+//
+//	f := transform.LineFilters{keyFilter, timeFilter}
+type LineFilters []LineFilter
+
+// Keep reports whether every filter keeps line.
+//
+// HOT PATH: Called for every line before decoding.
+func (l LineFilters) Keep(line []byte) bool {
+	for _, f := range l {
+		if !f.Keep(line) {
+			return false
+		}
+	}
+	return true
+}
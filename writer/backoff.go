@@ -0,0 +1,46 @@
+package writer
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// BackoffTimer adds up the time writers spend backing off from throttled and
+// unprocessed writes. It is safe for concurrent use.
+type BackoffTimer struct {
+	nanos atomic.Int64
+}
+
+// Total returns the time backed off so far.
+func (t *BackoffTimer) Total() time.Duration {
+	return time.Duration(t.nanos.Load())
+}
+
+// add records d backed off. It is safe to call on a nil timer.
+func (t *BackoffTimer) add(d time.Duration) {
+	if t != nil {
+		t.nanos.Add(int64(d))
+	}
+}
+
+// backoffKey is the context key of the timer set by WithBackoffTimer.
+type backoffKey struct{}
+
+// WithBackoffTimer adds the backoff of writes made with ctx to t. The
+// coordinator gives each worker a timer of its own, so it can tell how much of
+// each worker's time went to waiting for capacity rather than to the restore.
+// Example:
+//
+//	var t writer.BackoffTimer
+//	err := w.WriteBatch(writer.WithBackoffTimer(ctx, &t), ops)
+//	fmt.Println("backed off for", t.Total())
+func WithBackoffTimer(ctx context.Context, t *BackoffTimer) context.Context {
+	return context.WithValue(ctx, backoffKey{}, t)
+}
+
+// backoffTimerOf returns the timer set on ctx, or nil.
+func backoffTimerOf(ctx context.Context) *BackoffTimer {
+	t, _ := ctx.Value(backoffKey{}).(*BackoffTimer)
+	return t
+}
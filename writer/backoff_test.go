@@ -0,0 +1,44 @@
+package writer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gurre/ddb-pitr/clock"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// TestBackoffTimerAddsWaits verifies the time a throttled write backs off is
+// added to the timer of its context, so a worker's throttling can be reported,
+// and that writes without a timer back off as before.
+func TestBackoffTimerAddsWaits(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	client := &throttlingClient{throttles: 2}
+	w := NewDynamoDBWriter(client, "test-table", 25, WithClock(clk))
+
+	var timer BackoffTimer
+	done := make(chan error, 1)
+	go func() {
+		done <- w.WriteBatch(WithBackoffTimer(context.Background(), &timer), []itemimage.Operation{putOp("a")})
+	}()
+	clk.BlockUntil(1)
+	clk.Advance(200 * time.Millisecond)
+	clk.BlockUntil(1)
+	clk.Advance(400 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+	if got := timer.Total(); got != 600*time.Millisecond {
+		t.Errorf("expected 600ms backed off, got %s", got)
+	}
+
+	client = &throttlingClient{throttles: 1}
+	w = NewDynamoDBWriter(client, "test-table", 25, WithClock(clk))
+	go func() { done <- w.WriteBatch(context.Background(), []itemimage.Operation{putOp("a")}) }()
+	clk.BlockUntil(1)
+	clk.Advance(200 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatalf("WriteBatch without a timer failed: %v", err)
+	}
+}
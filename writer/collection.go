@@ -0,0 +1,206 @@
+package writer
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// ItemCollectionLimit is the most bytes DynamoDB stores under one partition
+// key of a table with local secondary indexes, counting the items and their
+// index projections.
+const ItemCollectionLimit = 10 << 30
+
+// collectionReportStep is how many bytes written to an item collection pass
+// between reports of its size.
+const collectionReportStep = 1 << 30
+
+// maxTrackedCollections bounds the partition keys whose writes are summed, so
+// a table with many small collections does not hold every key in memory.
+const maxTrackedCollections = 1 << 20
+
+// CollectionPolicy is what a writer does with the operations of a partition
+// key whose item collection DynamoDB rejected as full.
+type CollectionPolicy string
+
+const (
+	CollectionAbort CollectionPolicy = "abort" // Fail the batch, naming the partition key
+	CollectionSkip  CollectionPolicy = "skip"  // Skip the operation and every later one on the partition key
+)
+
+// ErrItemCollectionFull marks operations rejected because the item collection
+// of their partition key reached ItemCollectionLimit. It wraps ErrPermanent.
+var ErrItemCollectionFull = fmt.Errorf("%w: item collection size limit exceeded", ErrPermanent)
+
+// CollectionRecorder receives the item collections of a table: their size as
+// it passes every GiB written, and the operations skipped once one is full.
+// metrics.Metrics implements it.
+type CollectionRecorder interface {
+	RecordItemCollection(table, key string, bytes int64)
+	RecordCollectionFull(table, key string, skipped int)
+}
+
+// collectionTracker sums the bytes written per partition key and remembers the
+// keys whose item collection is full.
+type collectionTracker struct {
+	partitionKey string             // Partition key attribute of the table
+	policy       CollectionPolicy   // Handling of full item collections
+	recorder     CollectionRecorder // Optional; receives sizes and skipped operations
+	step         int64              // Bytes written to a collection between reports of its size
+
+	mu    sync.Mutex
+	sizes map[string]int64 // Bytes written per partition key, up to maxTrackedCollections keys
+	full  map[string]bool  // Partition keys whose item collection DynamoDB rejected as full
+}
+
+// WithItemCollections guards the item collections of a table with local
+// secondary indexes, which DynamoDB limits to ItemCollectionLimit per
+// partition key. The bytes of the items written are summed per partition key
+// and passed to rec every GiB, so the largest collections can be found before
+// they fill up. A write DynamoDB rejects with
+// ItemCollectionSizeLimitExceededException fails with ErrItemCollectionFull
+// under CollectionAbort; under CollectionSkip it and every later operation on
+// its partition key are skipped, dead-lettered when a sink is configured, and
+// counted in rec, which may be nil.
+// Example:
+//
+//	w := writer.NewDynamoDBWriter(client, "orders", 25,
+//	    writer.WithItemCollections("customer", writer.CollectionSkip, m))
+func WithItemCollections(partitionKey string, policy CollectionPolicy, rec CollectionRecorder) Option {
+	return func(w *DynamoDBWriter) {
+		w.collections = &collectionTracker{
+			partitionKey: partitionKey,
+			policy:       policy,
+			recorder:     rec,
+			step:         collectionReportStep,
+			sizes:        make(map[string]int64),
+			full:         make(map[string]bool),
+		}
+	}
+}
+
+// isItemCollectionFull reports whether err is DynamoDB rejecting a write to a
+// full item collection.
+func isItemCollectionFull(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "ItemCollectionSizeLimitExceededException"
+}
+
+// keyOf renders the partition key of op: strings and numbers as their value,
+// binaries as base64.
+func (c *collectionTracker) keyOf(op itemimage.Operation) string {
+	v, ok := op.Keys[c.partitionKey]
+	if !ok {
+		v = op.NewImage[c.partitionKey]
+	}
+	switch v := v.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value
+	case *types.AttributeValueMemberN:
+		return v.Value
+	case *types.AttributeValueMemberB:
+		return base64.StdEncoding.EncodeToString(v.Value)
+	}
+	return ""
+}
+
+// added sums the new images of ops written to table into their collections.
+// Deletes free an unknown number of bytes and are not counted.
+func (c *collectionTracker) added(table string, ops []itemimage.Operation) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, op := range ops {
+		if op.Type == itemimage.OpDelete || len(op.NewImage) == 0 {
+			continue
+		}
+		key := c.keyOf(op)
+		before, ok := c.sizes[key]
+		if !ok && len(c.sizes) >= maxTrackedCollections {
+			continue
+		}
+		after := before + itemimage.ItemSize(op.NewImage)
+		c.sizes[key] = after
+		if c.recorder != nil && after/c.step > before/c.step {
+			c.recorder.RecordItemCollection(table, key, after)
+		}
+	}
+}
+
+// skipFull returns ops without the operations on partition keys already found
+// full under CollectionSkip, dead-lettering them when w has a sink.
+func (w *DynamoDBWriter) skipFull(ctx context.Context, ops []itemimage.Operation) ([]itemimage.Operation, error) {
+	c := w.collections
+	if c == nil || c.policy != CollectionSkip {
+		return ops, nil
+	}
+	c.mu.Lock()
+	none := len(c.full) == 0
+	c.mu.Unlock()
+	if none {
+		return ops, nil
+	}
+	kept := ops[:0:0]
+	for _, op := range ops {
+		key, full := c.skipped(op)
+		if !full {
+			kept = append(kept, op)
+			continue
+		}
+		if err := w.collectionFull(ctx, op, key, ErrItemCollectionFull); err != nil {
+			return nil, err
+		}
+	}
+	return kept, nil
+}
+
+// skipped returns the partition key of op and whether op is skipped because
+// its collection is full. It is safe to call on a nil tracker.
+func (c *collectionTracker) skipped(op itemimage.Operation) (string, bool) {
+	if c == nil || c.policy != CollectionSkip {
+		return "", false
+	}
+	key := c.keyOf(op)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return key, c.full[key]
+}
+
+// rejectedByFullCollection handles op, which DynamoDB rejected with cause
+// because its item collection is full: it fails under CollectionAbort and is
+// skipped under CollectionSkip, along with later operations on its key.
+func (w *DynamoDBWriter) rejectedByFullCollection(ctx context.Context, op itemimage.Operation, cause error) error {
+	c := w.collections
+	key := c.keyOf(op)
+	c.mu.Lock()
+	c.full[key] = true
+	c.mu.Unlock()
+	err := fmt.Errorf("%w for partition key %q: %w", ErrItemCollectionFull, key, cause)
+	if c.policy != CollectionSkip {
+		if c.recorder != nil {
+			c.recorder.RecordCollectionFull(w.tableName, key, 0)
+		}
+		return operationError(ctx, []itemimage.Operation{op}, err)
+	}
+	return w.collectionFull(ctx, op, key, err)
+}
+
+// collectionFull skips op on the full collection of key, dead-lettering it with
+// cause when w has a sink.
+func (w *DynamoDBWriter) collectionFull(ctx context.Context, op itemimage.Operation, key string, cause error) error {
+	if w.collections.recorder != nil {
+		w.collections.recorder.RecordCollectionFull(w.tableName, key, 1)
+	}
+	if w.deadLetter == nil {
+		return nil
+	}
+	return w.sendToDeadLetter(ctx, op, cause)
+}
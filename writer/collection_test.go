@@ -0,0 +1,124 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/gurre/ddb-pitr/deadletter"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// fullCollectionClient rejects every write to the partition key "full" as
+// DynamoDB does once its item collection reached the size limit.
+type fullCollectionClient struct {
+	mockDynamoDBClient
+	rejected int
+}
+
+func (c *fullCollectionClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	for _, requests := range params.RequestItems {
+		for _, req := range requests {
+			if req.PutRequest != nil && req.PutRequest.Item["PK"].(*types.AttributeValueMemberS).Value == "full" {
+				c.rejected++
+				return nil, &smithy.GenericAPIError{Code: "ItemCollectionSizeLimitExceededException", Message: "Item collection size limit exceeded"}
+			}
+		}
+	}
+	return c.mockDynamoDBClient.BatchWriteItem(ctx, params, optFns...)
+}
+
+// collectionCounter records the sizes and skipped operations per partition key.
+type collectionCounter struct {
+	sizes   map[string]int64
+	skipped map[string]int
+}
+
+func (c *collectionCounter) RecordItemCollection(table, key string, bytes int64) {
+	c.sizes[key] = bytes
+}
+
+func (c *collectionCounter) RecordCollectionFull(table, key string, skipped int) {
+	c.skipped[key] += skipped
+}
+
+// TestWriterSkipsFullCollections verifies that under CollectionSkip the write
+// rejected for a full item collection is dead-lettered, later operations on
+// its partition key are skipped without another write, and the rest of the
+// batch is written.
+func TestWriterSkipsFullCollections(t *testing.T) {
+	client := &fullCollectionClient{}
+	sink := deadletter.NewMemorySink()
+	rec := &collectionCounter{sizes: map[string]int64{}, skipped: map[string]int{}}
+	w := NewDynamoDBWriter(client, "test-table", 25, WithDeadLetter(sink), WithItemCollections("PK", CollectionSkip, rec))
+
+	if err := w.WriteBatch(context.Background(), []itemimage.Operation{putOp("a"), putOp("full"), putOp("b")}); err != nil {
+		t.Fatalf("expected the full collection to be skipped, got %v", err)
+	}
+	if err := w.WriteBatch(context.Background(), []itemimage.Operation{putOp("full"), putOp("c")}); err != nil {
+		t.Fatalf("expected the full collection to be skipped, got %v", err)
+	}
+	if client.rejected != 2 {
+		t.Errorf("expected the batch and the isolated write to be rejected only, got %d rejections", client.rejected)
+	}
+	records := sink.Records()
+	if len(records) != 2 || !strings.Contains(records[0].Error, "item collection size limit exceeded") {
+		t.Fatalf("expected both operations on the full key dead-lettered, got %+v", records)
+	}
+	if rec.skipped["full"] != 2 {
+		t.Errorf("expected 2 operations skipped, got %v", rec.skipped)
+	}
+	var written int
+	for _, batch := range client.batches {
+		written += len(batch)
+	}
+	if written != 3 {
+		t.Errorf("expected a, b and c written, got %d items", written)
+	}
+}
+
+// TestWriterAbortsOnFullCollection verifies that under CollectionAbort the
+// batch fails with ErrItemCollectionFull naming the partition key, even with
+// a dead-letter sink.
+func TestWriterAbortsOnFullCollection(t *testing.T) {
+	sink := deadletter.NewMemorySink()
+	w := NewDynamoDBWriter(&fullCollectionClient{}, "test-table", 25, WithDeadLetter(sink), WithItemCollections("PK", CollectionAbort, nil))
+
+	err := w.WriteBatch(context.Background(), []itemimage.Operation{putOp("a"), putOp("full")})
+	var opErr *OperationError
+	if !errors.Is(err, ErrItemCollectionFull) || !errors.Is(err, ErrPermanent) || !errors.As(err, &opErr) || len(opErr.Ops) != 1 {
+		t.Fatalf("expected the batch to fail on the full collection, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `partition key "full"`) {
+		t.Errorf("expected the error to name the partition key, got %v", err)
+	}
+	if n := len(sink.Records()); n != 0 {
+		t.Errorf("expected nothing dead-lettered, got %d records", n)
+	}
+}
+
+// TestWriterReportsCollectionSizes verifies the bytes written are summed per
+// partition key and reported each time a collection passes a report step.
+func TestWriterReportsCollectionSizes(t *testing.T) {
+	rec := &collectionCounter{sizes: map[string]int64{}, skipped: map[string]int{}}
+	w := NewDynamoDBWriter(&mockDynamoDBClient{}, "test-table", 25, WithItemCollections("PK", CollectionAbort, rec))
+	w.collections.step = 10 // Each put of {"PK": "a"} is 3 bytes
+
+	ops := []itemimage.Operation{putOp("a"), putOp("a"), putOp("a"), putOp("b"), {Type: itemimage.OpDelete, Keys: putOp("a").Keys}}
+	if err := w.WriteBatch(context.Background(), ops); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.sizes) != 0 {
+		t.Fatalf("expected no collection past 10 bytes yet, got %v", rec.sizes)
+	}
+	if err := w.WriteBatch(context.Background(), []itemimage.Operation{putOp("a")}); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.sizes) != 1 || rec.sizes["a"] != 12 {
+		t.Errorf("expected collection a reported at 12 bytes, got %v", rec.sizes)
+	}
+}
@@ -0,0 +1,182 @@
+package writer
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/clock"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// fakeItemGetter serves BatchGetItem from items keyed by PK, leaving the first
+// unprocessed keys unprocessed once and the keys of stuck every time.
+type fakeItemGetter struct {
+	items       map[string]map[string]types.AttributeValue
+	unprocessed int
+	stuck       map[string]bool
+	requested   []string
+	consistent  bool
+	calls       int
+}
+
+func (g *fakeItemGetter) BatchGetItem(_ context.Context, params *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	g.calls++
+	out := &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]types.AttributeValue{}}
+	for table, ka := range params.RequestItems {
+		g.consistent = ka.ConsistentRead != nil && *ka.ConsistentRead
+		keys := ka.Keys
+		if g.unprocessed > 0 {
+			n := min(g.unprocessed, len(keys))
+			out.UnprocessedKeys = map[string]types.KeysAndAttributes{table: {Keys: keys[:n], ConsistentRead: ka.ConsistentRead}}
+			keys, g.unprocessed = keys[n:], 0
+		}
+		var left []map[string]types.AttributeValue
+		for _, key := range keys {
+			pk := key["PK"].(*types.AttributeValueMemberS).Value
+			if g.stuck[pk] {
+				left = append(left, key)
+				continue
+			}
+			g.requested = append(g.requested, pk)
+			if item, ok := g.items[pk]; ok {
+				out.Responses[table] = append(out.Responses[table], item)
+			}
+		}
+		if len(left) > 0 {
+			out.UnprocessedKeys = map[string]types.KeysAndAttributes{table: {Keys: left, ConsistentRead: ka.ConsistentRead}}
+		}
+	}
+	return out, nil
+}
+
+// unchangedCount records the puts skipped as unchanged.
+type unchangedCount int64
+
+func (c *unchangedCount) RecordUnchanged(n int64) { *c += unchangedCount(n) }
+
+func item(pk, name string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"PK":   &types.AttributeValueMemberS{Value: pk},
+		"name": &types.AttributeValueMemberS{Value: name},
+		"tags": &types.AttributeValueMemberSS{Value: []string{"x", "y"}},
+	}
+}
+
+// TestSkipUnchanged verifies that only puts whose item the table already holds
+// are skipped: changed and missing items, keys with several operations in the
+// batch and deletes are written, and items of full exports are keyed from their
+// image.
+func TestSkipUnchanged(t *testing.T) {
+	current := item("a", "Alice")
+	current["tags"] = &types.AttributeValueMemberSS{Value: []string{"y", "x"}} // Set order is not preserved
+	getter := &fakeItemGetter{items: map[string]map[string]types.AttributeValue{
+		"a": current,
+		"b": item("b", "Bob"),
+		"d": item("d", "Dan"),
+	}}
+	var skipped unchangedCount
+	client := &mockDynamoDBClient{}
+	w := NewDynamoDBWriter(client, "test-table", 25, WithSkipUnchanged(getter, []string{"PK"}, &skipped))
+
+	ops := []itemimage.Operation{
+		{Type: itemimage.OpPut, NewImage: item("a", "Alice")}, // Full export item, unchanged
+		{Type: itemimage.OpPut, Keys: map[string]types.AttributeValue{"PK": &types.AttributeValueMemberS{Value: "b"}}, NewImage: item("b", "Bobby")},
+		{Type: itemimage.OpPut, NewImage: item("c", "Carol")}, // Missing from the table
+		{Type: itemimage.OpPut, NewImage: item("d", "Dan")},   // Unchanged, but deleted later in the batch
+		{Type: itemimage.OpDelete, Keys: map[string]types.AttributeValue{"PK": &types.AttributeValueMemberS{Value: "d"}}},
+	}
+	if err := w.WriteBatch(context.Background(), ops); err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+	if skipped != 1 {
+		t.Errorf("expected 1 unchanged put, got %d", skipped)
+	}
+	sort.Strings(getter.requested)
+	if got := getter.requested; len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Errorf("expected a, b and c to be read, got %v", got)
+	}
+	if !getter.consistent {
+		t.Error("expected strongly consistent reads")
+	}
+	if len(client.batches) != 1 || len(client.batches[0]) != 4 {
+		t.Fatalf("expected one batch of 4 writes, got %v", client.batches)
+	}
+	for _, req := range client.batches[0] {
+		if req.PutRequest != nil && req.PutRequest.Item["PK"].(*types.AttributeValueMemberS).Value == "a" {
+			t.Error("expected the unchanged put to be skipped")
+		}
+	}
+}
+
+// TestSkipUnchangedWholeBatch verifies a batch of unchanged puts writes
+// nothing, and that unprocessed keys are read again after a backoff.
+func TestSkipUnchangedWholeBatch(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	getter := &fakeItemGetter{
+		items:       map[string]map[string]types.AttributeValue{"a": item("a", "Alice"), "b": item("b", "Bob")},
+		unprocessed: 1,
+	}
+	client := &mockDynamoDBClient{}
+	w := NewDynamoDBWriter(client, "test-table", 25, WithClock(clk), WithSkipUnchanged(getter, []string{"PK"}, nil))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- w.WriteBatch(context.Background(), []itemimage.Operation{
+			{Type: itemimage.OpPut, NewImage: item("a", "Alice")},
+			{Type: itemimage.OpPut, NewImage: item("b", "Bob")},
+		})
+	}()
+	clk.BlockUntil(1)
+	clk.Advance(200 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+	if getter.calls != 2 {
+		t.Errorf("expected the unprocessed key to be read again, got %d calls", getter.calls)
+	}
+	if len(client.batches) != 0 {
+		t.Errorf("expected nothing to be written, got %v", client.batches)
+	}
+}
+
+// TestSkipUnchangedGivesUpUnprocessedKeys verifies that keys BatchGetItem
+// keeps returning unprocessed stop being read after the retries without
+// progress allowed by WithUnprocessedLimit, and that their puts are written
+// as if changed while the puts read as unchanged are still skipped.
+func TestSkipUnchangedGivesUpUnprocessedKeys(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	getter := &fakeItemGetter{
+		items: map[string]map[string]types.AttributeValue{"a": item("a", "Alice"), "b": item("b", "Bob")},
+		stuck: map[string]bool{"b": true},
+	}
+	client := &mockDynamoDBClient{}
+	w := NewDynamoDBWriter(client, "test-table", 25, WithClock(clk), WithUnprocessedLimit(2, nil),
+		WithSkipUnchanged(getter, []string{"PK"}, nil))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- w.WriteBatch(context.Background(), []itemimage.Operation{
+			{Type: itemimage.OpPut, NewImage: item("a", "Alice")},
+			{Type: itemimage.OpPut, NewImage: item("b", "Bob")},
+		})
+	}()
+	// Reading a makes progress; two retries without progress then give up on b
+	for range 2 {
+		clk.BlockUntil(1)
+		clk.Advance(time.Minute)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+	if getter.calls != 3 {
+		t.Errorf("expected 3 reads, got %d", getter.calls)
+	}
+	if len(client.batches) != 1 || len(client.batches[0]) != 1 ||
+		client.batches[0][0].PutRequest.Item["PK"].(*types.AttributeValueMemberS).Value != "b" {
+		t.Errorf("expected only the unread put to be written, got %v", client.batches)
+	}
+}
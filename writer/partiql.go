@@ -0,0 +1,385 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// maxStatementBytes is the longest PartiQL statement DynamoDB accepts. UPDATE
+// statements of wide items are split to stay under it; an INSERT cannot be, so
+// an item too wide for one is rejected with a ValidationError.
+const maxStatementBytes = 8192
+
+// PartiQLClient is the subset of the DynamoDB client used by PartiQLWriter.
+type PartiQLClient interface {
+	BatchExecuteStatement(ctx context.Context, params *dynamodb.BatchExecuteStatementInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchExecuteStatementOutput, error)
+}
+
+// PartiQLWriter implements the Writer interface with PartiQL statements sent
+// through BatchExecuteStatement, for accounts that audit or restrict DynamoDB
+// access by PartiQL action. PartiQL has no unconditional put: INSERT fails on
+// an existing item and UPDATE on a missing one. A put is therefore an INSERT
+// that falls back to a DELETE and an INSERT when the item exists, and an update
+// an UPDATE that falls back to an INSERT of the new image when it does not.
+// Statements of one batch touch distinct items, so operations on one item are
+// applied in export order.
+// Example:
+//
+//	w := writer.NewPartiQLWriter(client, "my-table", []string{"pk", "sk"}, 25,
+//	    writer.WithDeadLetter(sink),
+//	)
+type PartiQLWriter struct {
+	client   PartiQLClient
+	base     *DynamoDBWriter // Holds the options shared with DynamoDBWriter and its backoff, capacity and dead-letter helpers
+	keyAttrs []string        // Primary key attributes, partition key first
+}
+
+// NewPartiQLWriter creates a PartiQLWriter for tableName, whose primary key is
+// keyAttrs. Of the Options, WithUpdateParallelism has no effect: statements are
+// sent in batches of batchSize instead.
+// Example:
+//
+//	w := writer.NewPartiQLWriter(client, "my-table", []string{"pk"}, 25)
+func NewPartiQLWriter(client PartiQLClient, tableName string, keyAttrs []string, batchSize int, opts ...Option) *PartiQLWriter {
+	return &PartiQLWriter{
+		client:   client,
+		base:     NewDynamoDBWriter(nil, tableName, batchSize, opts...),
+		keyAttrs: keyAttrs,
+	}
+}
+
+// partiqlTask tracks the statements left to apply one operation.
+type partiqlTask struct {
+	op       itemimage.Operation
+	keys     map[string]types.AttributeValue
+	next     []types.BatchStatementRequest // Statements still to run, in order
+	fellBack bool                          // Whether the statements were replaced after an INSERT or UPDATE failed its implicit condition
+}
+
+// WriteBatch implements the batch writing requirements from section 4.6 with
+// PartiQL statements. Operations are sent in rounds of up to batchSize distinct
+// items; a later operation on an item already in the round starts the next one.
+func (w *PartiQLWriter) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	kept, err := w.base.skipUnchanged(ctx, ops)
+	if err != nil {
+		return operationError(ctx, ops, err)
+	}
+	ops = kept
+	var round []*partiqlTask
+	inRound := make(map[string]bool, w.base.batchSize)
+	for _, op := range ops {
+		task, err := w.newTask(op)
+		if err != nil {
+			return operationError(ctx, []itemimage.Operation{op}, err)
+		}
+		if task == nil {
+			continue
+		}
+		key := itemimage.KeyFingerprint(task.keys)
+		if inRound[key] || len(round) == w.base.batchSize {
+			if err := w.runTasks(ctx, round); err != nil {
+				return err
+			}
+			round = round[:0]
+			clear(inRound)
+		}
+		round = append(round, task)
+		inRound[key] = true
+	}
+	return w.runTasks(ctx, round)
+}
+
+// Flush implements the flush requirements from section 4.6.
+// Since we write immediately, this is a no-op.
+func (w *PartiQLWriter) Flush(ctx context.Context) error {
+	return nil
+}
+
+// newTask returns the statements applying op, or nil when it changes nothing.
+func (w *PartiQLWriter) newTask(op itemimage.Operation) (*partiqlTask, error) {
+	keys, err := operationKeys(op, w.keyAttrs)
+	if err != nil {
+		return nil, err
+	}
+	task := &partiqlTask{op: op, keys: keys}
+	switch op.Type {
+	case itemimage.OpPut:
+		task.next = []types.BatchStatementRequest{w.insert(op.NewImage)}
+	case itemimage.OpDelete:
+		task.next = []types.BatchStatementRequest{w.delete(keys)}
+	case itemimage.OpUpdate:
+		task.next = w.update(op, keys)
+		if len(task.next) == 0 {
+			return nil, nil
+		}
+	}
+	return task, nil
+}
+
+// runTasks sends the next statement of every unfinished task in one
+// BatchExecuteStatement call until all are applied. Throttled statements retry
+// indefinitely with backoff until ctx is cancelled; statements rejected for
+// good are dead-lettered with their operation when a sink is configured.
+func (w *PartiQLWriter) runTasks(ctx context.Context, tasks []*partiqlTask) error {
+	attempt := 0
+	for {
+		var active []*partiqlTask
+		for _, t := range tasks {
+			if len(t.next) > 0 {
+				active = append(active, t)
+			}
+		}
+		if len(active) == 0 {
+			return nil
+		}
+
+		input := &dynamodb.BatchExecuteStatementInput{Statements: make([]types.BatchStatementRequest, len(active))}
+		for i, t := range active {
+			input.Statements[i] = t.next[0]
+		}
+		if w.base.capacity != nil {
+			input.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+		}
+		output, err := w.client.BatchExecuteStatement(ctx, input)
+		if err != nil {
+			if isThrottlingError(err) {
+				if !w.base.backoffWait(ctx, attempt) {
+					return ctx.Err()
+				}
+				attempt++
+				continue
+			}
+			if !isPermanentError(err) {
+				return operationError(ctx, opsOf(active), fmt.Errorf("failed to execute statements: %w", err))
+			}
+			err = fmt.Errorf("%w: failed to execute statements: %w", ErrPermanent, err)
+			if w.base.deadLetter == nil {
+				return operationError(ctx, opsOf(active), err)
+			}
+			if len(active) == 1 {
+				active[0].next = nil
+				if err := w.base.sendToDeadLetter(ctx, active[0].op, err); err != nil {
+					return err
+				}
+				continue
+			}
+			// The error does not say which statement caused it
+			for _, t := range active {
+				if err := w.runTasks(ctx, []*partiqlTask{t}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if len(output.Responses) != len(active) {
+			return operationError(ctx, opsOf(active), fmt.Errorf("got %d responses to %d statements", len(output.Responses), len(active)))
+		}
+		w.base.recordCapacity(output.ConsumedCapacity...)
+
+		throttled := false
+		for i, t := range active {
+			stmtErr := output.Responses[i].Error
+			if stmtErr == nil {
+				t.next = t.next[1:]
+				continue
+			}
+			switch {
+			case stmtErr.Code == types.BatchStatementErrorCodeEnumDuplicateItem && !t.fellBack:
+				// The item exists: replace it as a put would
+				t.fellBack = true
+				t.next = []types.BatchStatementRequest{w.delete(t.keys), w.insert(t.op.NewImage)}
+			case stmtErr.Code == types.BatchStatementErrorCodeEnumConditionalCheckFailed && t.op.Type == itemimage.OpUpdate && !t.fellBack:
+				// The item does not exist: create it as UpdateItem would
+				t.fellBack = true
+				t.next = []types.BatchStatementRequest{w.insert(t.op.NewImage)}
+			case retryableStatementErrors[stmtErr.Code]:
+				throttled = true
+			default:
+				t.next = nil
+				err := fmt.Errorf("%w: failed to execute statement: %w", ErrPermanent, statementError(stmtErr))
+				if w.base.deadLetter == nil {
+					return operationError(ctx, []itemimage.Operation{t.op}, err)
+				}
+				if err := w.base.sendToDeadLetter(ctx, t.op, err); err != nil {
+					return err
+				}
+			}
+		}
+		if throttled {
+			if !w.base.backoffWait(ctx, attempt) {
+				return ctx.Err()
+			}
+			attempt++
+		}
+	}
+}
+
+// retryableStatementErrors lists the errors of single statements caused by
+// throughput limits or transient conditions, which succeed when sent again.
+var retryableStatementErrors = map[types.BatchStatementErrorCodeEnum]bool{
+	types.BatchStatementErrorCodeEnumProvisionedThroughputExceeded: true,
+	types.BatchStatementErrorCodeEnumRequestLimitExceeded:          true,
+	types.BatchStatementErrorCodeEnumThrottlingError:               true,
+	types.BatchStatementErrorCodeEnumTransactionConflict:           true,
+	types.BatchStatementErrorCodeEnumInternalServerError:           true,
+}
+
+// statementError converts the error of one statement. A failed condition check
+// becomes a ConditionalCheckFailedException carrying the item as stored, so
+// dead-letter records keep it as they do for UpdateItem.
+func statementError(e *types.BatchStatementError) error {
+	message := string(e.Code)
+	if e.Message != nil {
+		message += ": " + *e.Message
+	}
+	if e.Code == types.BatchStatementErrorCodeEnumConditionalCheckFailed {
+		return &types.ConditionalCheckFailedException{Message: &message, Item: e.Item}
+	}
+	return errors.New(message)
+}
+
+// operationKeys returns the primary key of op. Full export items carry their
+// key in the image only, so it is taken from keyAttrs there.
+func operationKeys(op itemimage.Operation, keyAttrs []string) (map[string]types.AttributeValue, error) {
+	if len(op.Keys) > 0 {
+		return op.Keys, nil
+	}
+	keys := make(map[string]types.AttributeValue, len(keyAttrs))
+	for _, attr := range keyAttrs {
+		v, ok := op.NewImage[attr]
+		if !ok {
+			return nil, fmt.Errorf("%w: item lacks key attribute %s", ErrPermanent, attr)
+		}
+		keys[attr] = v
+	}
+	return keys, nil
+}
+
+// opsOf returns the operations of tasks.
+func opsOf(tasks []*partiqlTask) []itemimage.Operation {
+	ops := make([]itemimage.Operation, len(tasks))
+	for i, t := range tasks {
+		ops[i] = t.op
+	}
+	return ops
+}
+
+// insert returns an INSERT of item.
+func (w *PartiQLWriter) insert(item map[string]types.AttributeValue) types.BatchStatementRequest {
+	names := sortedNames(item)
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO ")
+	sb.WriteString(quoteIdentifier(w.base.tableName))
+	sb.WriteString(" VALUE {")
+	params := make([]types.AttributeValue, 0, len(names))
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(quoteString(name))
+		sb.WriteString(": ?")
+		params = append(params, item[name])
+	}
+	sb.WriteByte('}')
+	return w.statement(sb.String(), params)
+}
+
+// delete returns a DELETE of the item with keys.
+func (w *PartiQLWriter) delete(keys map[string]types.AttributeValue) types.BatchStatementRequest {
+	where, params := whereKeys(keys)
+	return w.statement("DELETE FROM "+quoteIdentifier(w.base.tableName)+where, params)
+}
+
+// update returns the UPDATE statements setting the attributes of op's new
+// image and removing those only in its old image, split so each stays under
+// maxStatementBytes. Key attributes are never modified.
+func (w *PartiQLWriter) update(op itemimage.Operation, keys map[string]types.AttributeValue) []types.BatchStatementRequest {
+	clauses := buildUpdateClauses(op)
+	if len(clauses) == 0 {
+		return nil
+	}
+	where, keyParams := whereKeys(keys)
+	prefix := "UPDATE " + quoteIdentifier(w.base.tableName)
+
+	var stmts []types.BatchStatementRequest
+	var sb strings.Builder
+	var params []types.AttributeValue
+	flush := func() {
+		stmts = append(stmts, w.statement(prefix+sb.String()+where, append(params, keyParams...)))
+		sb.Reset()
+		params = nil
+	}
+	for _, c := range clauses {
+		clause := " SET " + quoteIdentifier(c.name) + " = ?"
+		if c.remove {
+			clause = " REMOVE " + quoteIdentifier(c.name)
+		}
+		if sb.Len() > 0 && len(prefix)+sb.Len()+len(clause)+len(where) > maxStatementBytes {
+			flush()
+		}
+		sb.WriteString(clause)
+		if !c.remove {
+			params = append(params, c.value)
+		}
+	}
+	flush()
+	return stmts
+}
+
+// statement builds a request, asking for the stored item on a failed condition
+// check when WithReturnValuesOnConditionCheckFailure is set.
+func (w *PartiQLWriter) statement(text string, params []types.AttributeValue) types.BatchStatementRequest {
+	return types.BatchStatementRequest{
+		Statement:                           &text,
+		Parameters:                          params,
+		ReturnValuesOnConditionCheckFailure: w.base.conditionValues,
+	}
+}
+
+// whereKeys returns a WHERE clause matching keys, with its parameters.
+func whereKeys(keys map[string]types.AttributeValue) (string, []types.AttributeValue) {
+	names := sortedNames(keys)
+	params := make([]types.AttributeValue, 0, len(names))
+	var sb strings.Builder
+	for i, name := range names {
+		if i == 0 {
+			sb.WriteString(" WHERE ")
+		} else {
+			sb.WriteString(" AND ")
+		}
+		sb.WriteString(quoteIdentifier(name))
+		sb.WriteString(" = ?")
+		params = append(params, keys[name])
+	}
+	return sb.String(), params
+}
+
+// sortedNames returns the attribute names of item in order, so statements
+// are deterministic.
+func sortedNames(item map[string]types.AttributeValue) []string {
+	names := make([]string, 0, len(item))
+	for name := range item {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// quoteIdentifier quotes a table or attribute name for PartiQL, so reserved
+// words and names with dots or dashes are taken literally.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteString quotes a string literal for PartiQL, as used for the attribute
+// names of an INSERT.
+func quoteString(s string) string {
+	return `'` + strings.ReplaceAll(s, `'`, `''`) + `'`
+}
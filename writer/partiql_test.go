@@ -0,0 +1,199 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/clock"
+	"github.com/gurre/ddb-pitr/deadletter"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// partiqlTable simulates a table keyed by a string PK as BatchExecuteStatement
+// sees it: INSERT fails on an existing item and UPDATE on a missing one.
+type partiqlTable struct {
+	mu        sync.Mutex
+	items     map[string]map[string]string // PK to attribute values
+	calls     [][]string                   // Statements of each call
+	throttles int                          // Statements answered with ProvisionedThroughputExceeded before any succeed
+	reject    string                       // PK whose statements fail with a ValidationError
+}
+
+func newPartiQLTable(pks ...string) *partiqlTable {
+	t := &partiqlTable{items: make(map[string]map[string]string)}
+	for _, pk := range pks {
+		t.items[pk] = map[string]string{"PK": pk, "name": "stored"}
+	}
+	return t
+}
+
+func (t *partiqlTable) BatchExecuteStatement(ctx context.Context, params *dynamodb.BatchExecuteStatementInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchExecuteStatementOutput, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var stmts []string
+	output := &dynamodb.BatchExecuteStatementOutput{}
+	for _, req := range params.Statements {
+		stmt := *req.Statement
+		stmts = append(stmts, stmt)
+		output.Responses = append(output.Responses, types.BatchStatementResponse{Error: t.execute(stmt, req.Parameters)})
+	}
+	t.calls = append(t.calls, stmts)
+	return output, nil
+}
+
+func (t *partiqlTable) execute(stmt string, params []types.AttributeValue) *types.BatchStatementError {
+	if t.throttles > 0 {
+		t.throttles--
+		return &types.BatchStatementError{Code: types.BatchStatementErrorCodeEnumProvisionedThroughputExceeded}
+	}
+	str := func(v types.AttributeValue) string { return v.(*types.AttributeValueMemberS).Value }
+	switch {
+	case strings.HasPrefix(stmt, "INSERT"):
+		// Attribute names are sorted, so PK comes first
+		pk := str(params[0])
+		if pk == t.reject {
+			return &types.BatchStatementError{Code: types.BatchStatementErrorCodeEnumValidationError}
+		}
+		if t.items[pk] != nil {
+			return &types.BatchStatementError{Code: types.BatchStatementErrorCodeEnumDuplicateItem}
+		}
+		item := map[string]string{"PK": pk}
+		if len(params) > 1 {
+			item["name"] = str(params[1])
+		}
+		t.items[pk] = item
+	case strings.HasPrefix(stmt, "DELETE"):
+		delete(t.items, str(params[0]))
+	case strings.HasPrefix(stmt, "UPDATE"):
+		pk := str(params[len(params)-1])
+		if t.items[pk] == nil {
+			return &types.BatchStatementError{Code: types.BatchStatementErrorCodeEnumConditionalCheckFailed}
+		}
+		t.items[pk]["name"] = str(params[0])
+	}
+	return nil
+}
+
+// TestPartiQLWriterStatements verifies the statements of each operation type
+// and that puts and updates fall back to the statements PartiQL needs when the
+// item already exists or is missing, leaving the table as the export has it.
+func TestPartiQLWriterStatements(t *testing.T) {
+	table := newPartiQLTable("existing", "gone")
+	w := NewPartiQLWriter(table, "my-table", []string{"PK"}, 25)
+
+	gone := itemimage.Operation{Type: itemimage.OpDelete, Keys: map[string]types.AttributeValue{"PK": &types.AttributeValueMemberS{Value: "gone"}}}
+	existing := putOp("existing")
+	existing.NewImage["name"] = &types.AttributeValueMemberS{Value: "exported"}
+	err := w.WriteBatch(context.Background(), []itemimage.Operation{putOp("new"), existing, updateOp("missing", "x"), gone})
+	if err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+
+	want := [][]string{
+		{
+			`INSERT INTO "my-table" VALUE {'PK': ?}`,
+			`INSERT INTO "my-table" VALUE {'PK': ?, 'name': ?}`,
+			`UPDATE "my-table" SET "name" = ? WHERE "PK" = ?`,
+			`DELETE FROM "my-table" WHERE "PK" = ?`,
+		},
+		// The existing item is deleted and the missing one inserted together
+		{`DELETE FROM "my-table" WHERE "PK" = ?`, `INSERT INTO "my-table" VALUE {'PK': ?, 'name': ?}`},
+		{`INSERT INTO "my-table" VALUE {'PK': ?, 'name': ?}`},
+	}
+	if len(table.calls) != len(want) {
+		t.Fatalf("expected %d calls, got %q", len(want), table.calls)
+	}
+	for i := range want {
+		if strings.Join(table.calls[i], "\n") != strings.Join(want[i], "\n") {
+			t.Errorf("call %d = %q, want %q", i, table.calls[i], want[i])
+		}
+	}
+	if table.items["existing"]["name"] != "exported" || table.items["missing"]["name"] != "x" || table.items["new"] == nil || table.items["gone"] != nil {
+		t.Errorf("unexpected table %v", table.items)
+	}
+}
+
+// TestPartiQLWriterOrdersOperationsOnOneItem verifies that operations on one
+// item go to separate calls, since statements of one call run in no set order.
+func TestPartiQLWriterOrdersOperationsOnOneItem(t *testing.T) {
+	table := newPartiQLTable()
+	w := NewPartiQLWriter(table, "my-table", []string{"PK"}, 25)
+
+	err := w.WriteBatch(context.Background(), []itemimage.Operation{putOp("a"), putOp("b"), updateOp("a", "later")})
+	if err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+	if len(table.calls) != 2 || len(table.calls[0]) != 2 || len(table.calls[1]) != 1 {
+		t.Errorf("expected the update of a in a second call, got %q", table.calls)
+	}
+	if table.items["a"]["name"] != "later" {
+		t.Errorf("expected the update applied after the put, got %v", table.items["a"])
+	}
+}
+
+// TestPartiQLWriterKeysOfFullExportItems verifies that items without Keys, as
+// full exports decode them, are keyed by the table's key attributes.
+func TestPartiQLWriterKeysOfFullExportItems(t *testing.T) {
+	w := NewPartiQLWriter(newPartiQLTable(), "my-table", []string{"PK", "SK"}, 25)
+
+	op := itemimage.Operation{Type: itemimage.OpPut, NewImage: map[string]types.AttributeValue{"PK": &types.AttributeValueMemberS{Value: "a"}}}
+	if err := w.WriteBatch(context.Background(), []itemimage.Operation{op}); !errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), "SK") {
+		t.Errorf("expected a permanent error naming the missing key attribute, got %v", err)
+	}
+}
+
+// TestPartiQLWriterRetriesThrottledStatements verifies that throttled
+// statements are sent again after a backoff while the others are not.
+func TestPartiQLWriterRetriesThrottledStatements(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	table := newPartiQLTable()
+	table.throttles = 1
+	w := NewPartiQLWriter(table, "my-table", []string{"PK"}, 25, WithClock(clk))
+
+	done := make(chan error, 1)
+	go func() { done <- w.WriteBatch(context.Background(), []itemimage.Operation{putOp("a"), putOp("b")}) }()
+	clk.BlockUntil(1)
+	clk.Advance(200 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+	if len(table.calls) != 2 || len(table.calls[1]) != 1 {
+		t.Errorf("expected only the throttled statement to be retried, got %q", table.calls)
+	}
+	if len(table.items) != 2 {
+		t.Errorf("expected both items written, got %v", table.items)
+	}
+}
+
+// TestPartiQLWriterDeadLettersRejectedStatements verifies that a rejected
+// statement fails the batch without a sink, and with one is dead-lettered
+// while the rest of the batch is written.
+func TestPartiQLWriterDeadLettersRejectedStatements(t *testing.T) {
+	table := newPartiQLTable()
+	table.reject = "bad"
+	w := NewPartiQLWriter(table, "my-table", []string{"PK"}, 25)
+	err := w.WriteBatch(context.Background(), []itemimage.Operation{putOp("bad")})
+	var opErr *OperationError
+	if !errors.As(err, &opErr) || !errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), "ValidationError") {
+		t.Fatalf("expected a permanent OperationError, got %v", err)
+	}
+
+	sink := deadletter.NewMemorySink()
+	w = NewPartiQLWriter(table, "my-table", []string{"PK"}, 25, WithDeadLetter(sink))
+	if err := w.WriteBatch(context.Background(), []itemimage.Operation{putOp("a"), putOp("bad"), putOp("b")}); err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+	records := sink.Records()
+	if len(records) != 1 || records[0].Operation != "PUT" || !strings.Contains(string(records[0].Keys), `"bad"`) {
+		t.Errorf("expected the bad put dead-lettered, got %+v", records)
+	}
+	if table.items["a"] == nil || table.items["b"] == nil {
+		t.Errorf("expected the good items written, got %v", table.items)
+	}
+}
@@ -0,0 +1,233 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// KeyRouter implements the Writer interface by routing every operation to one
+// of a fixed set of writer goroutines by a hash of its partition key, instead
+// of writing each worker's batch as it was read from its file. Each goroutine
+// merges the operations workers route to it into batches of up to batchSize
+// and writes them in the order they arrived, so the writes of one partition
+// key come from one goroutine, in order, and a batch never holds one item
+// twice. WriteBatch returns once all of its operations are written; when a
+// merged batch fails, each caller's operations are written again on their own
+// so only the callers whose operations fail get an error.
+// Example:
+//
+//	r := writer.NewKeyRouter(w, []string{"pk", "sk"}, 8, 25)
+//	defer r.Close()
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, r, store, nil)
+type KeyRouter struct {
+	w         Writer
+	keyAttrs  []string // Primary key attributes, partition key first
+	batchSize int
+	shards    []chan *routedOps
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// routedOps are the operations of one WriteBatch call routed to one goroutine.
+type routedOps struct {
+	ctx  context.Context
+	ops  []itemimage.Operation
+	keys []string   // Key fingerprint of each operation
+	done chan error // Receives the result of writing ops
+}
+
+// NewKeyRouter starts shards goroutines writing to w, whose table's primary
+// key is keyAttrs. Close stops them.
+// Example:
+//
+//	r := writer.NewKeyRouter(w, []string{"pk"}, 16, 25)
+func NewKeyRouter(w Writer, keyAttrs []string, shards, batchSize int) *KeyRouter {
+	r := &KeyRouter{w: w, keyAttrs: keyAttrs, batchSize: batchSize, shards: make([]chan *routedOps, shards)}
+	for i := range r.shards {
+		r.shards[i] = make(chan *routedOps)
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.run(r.shards[i])
+		}()
+	}
+	return r
+}
+
+// WriteBatch routes ops to the goroutines of their partition keys and waits
+// until every goroutine has written its share.
+func (r *KeyRouter) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	parts, err := r.route(ctx, ops)
+	if err != nil {
+		return err
+	}
+	// Each goroutine gets the first part of its share before any gets a second
+	var sent []*routedOps
+	for round := 0; ; round++ {
+		more := false
+		for i, share := range parts {
+			if round >= len(share) {
+				continue
+			}
+			more = true
+			select {
+			case r.shards[i] <- share[round]:
+				sent = append(sent, share[round])
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if !more {
+			break
+		}
+	}
+	var errs []error
+	for _, part := range sent {
+		select {
+		case err := <-part.done:
+			errs = append(errs, err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// route splits ops by the goroutine of their partition key, indexed like
+// shards, into parts of up to batchSize operations that hold no item twice, in
+// the order of ops. Goroutines receiving no operations get no parts.
+func (r *KeyRouter) route(ctx context.Context, ops []itemimage.Operation) ([][]*routedOps, error) {
+	parts := make([][]*routedOps, len(r.shards))
+	seen := make([]map[string]bool, len(r.shards)) // Items of each goroutine's last part
+	partition := r.keyAttrs[0]
+	for _, op := range ops {
+		keys, err := operationKeys(op, r.keyAttrs)
+		if err != nil {
+			return nil, operationError(ctx, []itemimage.Operation{op}, err)
+		}
+		h := fnv.New32a()
+		h.Write([]byte(itemimage.KeyFingerprint(map[string]types.AttributeValue{partition: keys[partition]})))
+		i := h.Sum32() % uint32(len(parts))
+		key := itemimage.KeyFingerprint(keys)
+		last := len(parts[i]) - 1
+		if last < 0 || len(parts[i][last].ops) >= r.batchSize || seen[i][key] {
+			parts[i] = append(parts[i], &routedOps{ctx: ctx, done: make(chan error, 1)})
+			seen[i] = make(map[string]bool)
+			last++
+		}
+		parts[i][last].ops = append(parts[i][last].ops, op)
+		parts[i][last].keys = append(parts[i][last].keys, key)
+		seen[i][key] = true
+	}
+	return parts, nil
+}
+
+// Flush flushes the underlying writer.
+func (r *KeyRouter) Flush(ctx context.Context) error {
+	return r.w.Flush(ctx)
+}
+
+// Close stops the goroutines once they have written what was routed to them.
+// WriteBatch must not be called after Close.
+func (r *KeyRouter) Close() {
+	r.closeOnce.Do(func() {
+		for _, ch := range r.shards {
+			close(ch)
+		}
+		r.wg.Wait()
+	})
+}
+
+// run writes the operations routed to one goroutine until ch is closed. Parts
+// waiting when a write ends are merged into the next batch; a part that would
+// take the batch past batchSize operations, or with an item already in the
+// batch, waits for the next.
+func (r *KeyRouter) run(ch chan *routedOps) {
+	var next *routedOps
+	for {
+		part := next
+		next = nil
+		if part == nil {
+			var ok bool
+			if part, ok = <-ch; !ok {
+				return
+			}
+		}
+		parts := []*routedOps{part}
+		seen := make(map[string]bool, r.batchSize)
+		for _, key := range part.keys {
+			seen[key] = true
+		}
+		n := len(part.ops)
+	merge:
+		for n < r.batchSize {
+			select {
+			case more, ok := <-ch:
+				if !ok {
+					break merge
+				}
+				if n+len(more.ops) > r.batchSize {
+					next = more
+					break merge
+				}
+				for _, key := range more.keys {
+					if seen[key] {
+						next = more
+						break merge
+					}
+				}
+				for _, key := range more.keys {
+					seen[key] = true
+				}
+				parts = append(parts, more)
+				n += len(more.ops)
+			default:
+				break merge
+			}
+		}
+		r.write(parts, n)
+	}
+}
+
+// write writes parts as one batch. When it fails, each part is written again
+// on its own, so the operations of one caller do not fail the others.
+func (r *KeyRouter) write(parts []*routedOps, n int) {
+	err := r.writeParts(parts, n)
+	if err != nil && len(parts) > 1 {
+		for _, part := range parts {
+			part.done <- r.writeParts([]*routedOps{part}, len(part.ops))
+		}
+		return
+	}
+	for _, part := range parts {
+		part.done <- err
+	}
+}
+
+// writeParts writes the operations of parts as one batch, with the values of
+// the first caller's context, such as its backoff timer. The write is
+// cancelled only once every caller has given up on it, so one cancelled caller
+// does not fail the others.
+func (r *KeyRouter) writeParts(parts []*routedOps, n int) error {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parts[0].ctx))
+	defer cancel()
+	var waiting atomic.Int32
+	waiting.Store(int32(len(parts)))
+	ops := make([]itemimage.Operation, 0, n)
+	for _, part := range parts {
+		stop := context.AfterFunc(part.ctx, func() {
+			if waiting.Add(-1) == 0 {
+				cancel()
+			}
+		})
+		defer stop()
+		ops = append(ops, part.ops...)
+	}
+	return r.w.WriteBatch(ctx, ops)
+}
@@ -0,0 +1,246 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gurre/ddb-pitr/clock"
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// batchRecorder records the batches written to it and fails them with err,
+// or only those holding the item reject.
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches [][]itemimage.Operation
+	ctxErrs []error // Error of each write's context when it was made
+	err     error
+	reject  string
+}
+
+func (w *batchRecorder) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.batches = append(w.batches, append([]itemimage.Operation(nil), ops...))
+	w.ctxErrs = append(w.ctxErrs, ctx.Err())
+	if w.reject == "" {
+		return w.err
+	}
+	for _, op := range ops {
+		if op.NewImage["PK"].(*types.AttributeValueMemberS).Value == w.reject {
+			return w.err
+		}
+	}
+	return nil
+}
+
+func (w *batchRecorder) Flush(ctx context.Context) error {
+	return nil
+}
+
+// pkOp returns a put of the item pk carrying the sequence number n.
+func pkOp(pk string, n int) itemimage.Operation {
+	return itemimage.Operation{
+		Type: itemimage.OpPut,
+		NewImage: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: pk},
+			"n":  &types.AttributeValueMemberN{Value: fmt.Sprint(n)},
+		},
+	}
+}
+
+// describe lists the item and sequence number of each operation of batches.
+func describe(batches [][]itemimage.Operation) string {
+	var out []string
+	for _, batch := range batches {
+		s := ""
+		for _, op := range batch {
+			s += op.NewImage["PK"].(*types.AttributeValueMemberS).Value + op.NewImage["n"].(*types.AttributeValueMemberN).Value
+		}
+		out = append(out, s)
+	}
+	return strings.Join(out, " ")
+}
+
+// TestKeyRouterMergesWaitingCalls verifies that calls waiting for a goroutine
+// are merged into one batch, and that a call with an item already in the
+// batch waits for the next, so a batch never holds an item twice and each
+// item's operations are written in the order they were routed.
+func TestKeyRouterMergesWaitingCalls(t *testing.T) {
+	w := &batchRecorder{}
+	r := &KeyRouter{w: w, keyAttrs: []string{"PK"}, batchSize: 25, shards: make([]chan *routedOps, 1)}
+
+	ch := make(chan *routedOps, 4)
+	for _, op := range []itemimage.Operation{pkOp("a", 1), pkOp("b", 1), pkOp("c", 1), pkOp("b", 2)} {
+		parts, err := r.route(context.Background(), []itemimage.Operation{op})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch <- parts[0][0]
+	}
+	close(ch)
+	r.run(ch)
+
+	if got := describe(w.batches); got != "a1b1c1 b2" {
+		t.Errorf("batches = %q, want %q", got, "a1b1c1 b2")
+	}
+}
+
+// TestKeyRouterBoundsBatches verifies a call is split into parts of up to
+// batchSize operations, starting a new part at an item already in the current
+// one, and that waiting calls are only merged while the batch stays within
+// batchSize, so no batch exceeds it or holds an item twice.
+func TestKeyRouterBoundsBatches(t *testing.T) {
+	w := &batchRecorder{}
+	r := &KeyRouter{w: w, keyAttrs: []string{"PK"}, batchSize: 3, shards: make([]chan *routedOps, 1)}
+
+	ch := make(chan *routedOps, 8)
+	calls := [][]itemimage.Operation{
+		{pkOp("a", 1), pkOp("b", 1), pkOp("a", 2), pkOp("c", 1), pkOp("d", 1), pkOp("e", 1)},
+		{pkOp("x", 1), pkOp("y", 1)},
+		{pkOp("z", 1), pkOp("w", 1)},
+	}
+	for _, ops := range calls {
+		parts, err := r.route(context.Background(), ops)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, part := range parts[0] {
+			ch <- part
+		}
+	}
+	close(ch)
+	r.run(ch)
+
+	if got, want := describe(w.batches), "a1b1 a2c1d1 e1x1y1 z1w1"; got != want {
+		t.Errorf("batches = %q, want %q", got, want)
+	}
+}
+
+// TestKeyRouterFailsOnlyTheFailingCaller verifies that when a merged batch
+// fails, each caller's operations are written again on their own, so an
+// operation of one caller fails only that caller and the others' are written.
+func TestKeyRouterFailsOnlyTheFailingCaller(t *testing.T) {
+	w := &batchRecorder{err: errors.New("boom"), reject: "bad"}
+	r := &KeyRouter{w: w, keyAttrs: []string{"PK"}, batchSize: 25, shards: make([]chan *routedOps, 1)}
+
+	good, _ := r.route(context.Background(), []itemimage.Operation{pkOp("a", 1)})
+	bad, _ := r.route(context.Background(), []itemimage.Operation{pkOp("bad", 1)})
+	ch := make(chan *routedOps, 2)
+	ch <- good[0][0]
+	ch <- bad[0][0]
+	close(ch)
+	r.run(ch)
+
+	if got, want := describe(w.batches), "a1bad1 a1 bad1"; got != want {
+		t.Fatalf("batches = %q, want %q", got, want)
+	}
+	if err := <-good[0][0].done; err != nil {
+		t.Errorf("good caller: unexpected error %v", err)
+	}
+	if err := <-bad[0][0].done; err == nil || err.Error() != "boom" {
+		t.Errorf("bad caller: expected the batch's error, got %v", err)
+	}
+}
+
+// TestKeyRouterKeepsCallerContextValues verifies the router writes with the
+// values of its caller's context, so the time a throttled write backs off is
+// still added to the caller's backoff timer.
+func TestKeyRouterKeepsCallerContextValues(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	client := &throttlingClient{throttles: 1}
+	r := NewKeyRouter(NewDynamoDBWriter(client, "test-table", 25, WithClock(clk)), []string{"PK"}, 1, 25)
+	defer r.Close()
+
+	var timer BackoffTimer
+	done := make(chan error, 1)
+	go func() {
+		done <- r.WriteBatch(WithBackoffTimer(context.Background(), &timer), []itemimage.Operation{putOp("a")})
+	}()
+	clk.BlockUntil(1)
+	clk.Advance(200 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+	if got := timer.Total(); got != 200*time.Millisecond {
+		t.Errorf("expected 200ms backed off, got %s", got)
+	}
+}
+
+// TestKeyRouterRoutesByPartitionKey checks concurrent callers get every
+// operation written, each partition key's in the order it was routed although
+// several goroutines write, and failures returned to the callers.
+func TestKeyRouterRoutesByPartitionKey(t *testing.T) {
+	w := &batchRecorder{}
+	r := NewKeyRouter(w, []string{"PK"}, 4, 25)
+
+	var wg sync.WaitGroup
+	for caller := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range 10 {
+				op := pkOp(fmt.Sprint("caller", caller), n)
+				if err := r.WriteBatch(context.Background(), []itemimage.Operation{op, pkOp(fmt.Sprint("other", n), caller)}); err != nil {
+					t.Errorf("WriteBatch failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	r.Close()
+
+	last := make(map[string]int)
+	written := 0
+	for _, batch := range w.batches {
+		for _, op := range batch {
+			written++
+			pk := op.NewImage["PK"].(*types.AttributeValueMemberS).Value
+			if !strings.HasPrefix(pk, "caller") {
+				continue
+			}
+			var n int
+			fmt.Sscan(op.NewImage["n"].(*types.AttributeValueMemberN).Value, &n)
+			if prev, ok := last[pk]; ok && n <= prev {
+				t.Errorf("%s written out of order: %d after %d", pk, n, prev)
+			}
+			last[pk] = n
+		}
+	}
+	if written != 160 {
+		t.Errorf("expected 160 operations written, got %d", written)
+	}
+
+	failing := &batchRecorder{err: errors.New("boom")}
+	r = NewKeyRouter(failing, []string{"PK"}, 4, 25)
+	defer r.Close()
+	if err := r.WriteBatch(context.Background(), []itemimage.Operation{pkOp("a", 1)}); err == nil || err.Error() != "boom" {
+		t.Errorf("expected the write error, got %v", err)
+	}
+}
+
+// TestKeyRouterWriteOutlivesCancelledCaller verifies a merged write is only
+// cancelled once every caller in it has given up, so one worker's cancelled
+// attempt does not fail the writes of the others.
+func TestKeyRouterWriteOutlivesCancelledCaller(t *testing.T) {
+	w := &batchRecorder{}
+	r := &KeyRouter{w: w, keyAttrs: []string{"PK"}, batchSize: 25, shards: make([]chan *routedOps, 1)}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	gone, _ := r.route(cancelled, []itemimage.Operation{pkOp("a", 1)})
+	live, _ := r.route(context.Background(), []itemimage.Operation{pkOp("b", 1)})
+	r.write([]*routedOps{gone[0][0], live[0][0]}, 2)
+	if w.ctxErrs[0] != nil {
+		t.Errorf("expected the write to run for the live caller, got %v", w.ctxErrs[0])
+	}
+	if err := <-live[0][0].done; err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package writer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// ShadowRecorder receives the outcome of every write to a shadow table.
+// metrics.Metrics implements it.
+type ShadowRecorder interface {
+	RecordTargetWrite(table string, items int, d time.Duration)
+	RecordTargetError(table string)
+}
+
+// ShadowWriter writes every batch to a primary writer and mirrors it to the
+// writer of a shadow table, so a restore can run next to an established
+// restore process and the tables be compared before it is trusted. The shadow
+// is written concurrently with the primary and is best effort: its failures
+// are counted and kept for Err but never fail the batch, and a batch retried
+// for the primary is mirrored again.
+// Example:
+//
+//	w := writer.NewShadowWriter(primary, writer.NewDynamoDBWriter(client, "orders-shadow", 25), "orders-shadow", m)
+//	coord := coordinator.NewCoordinator(cfg, loader, streamer, decoder, w, store, nil)
+type ShadowWriter struct {
+	primary  Writer
+	shadow   Writer
+	table    string         // Shadow table, as recorded
+	recorder ShadowRecorder // Optional; receives the shadow's writes and failures
+
+	mu       sync.Mutex
+	firstErr error // First failure of the shadow
+	failures int64 // Shadow writes and flushes that failed
+}
+
+// NewShadowWriter creates a ShadowWriter mirroring primary's batches to
+// shadow, the writer of table. rec may be nil.
+func NewShadowWriter(primary, shadow Writer, table string, rec ShadowRecorder) *ShadowWriter {
+	return &ShadowWriter{primary: primary, shadow: shadow, table: table, recorder: rec}
+}
+
+// WriteBatch writes ops to the primary and the shadow, returning the primary's
+// error only.
+func (w *ShadowWriter) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		start := time.Now()
+		if err := w.shadow.WriteBatch(ctx, ops); err != nil {
+			w.fail(err)
+			return
+		}
+		if w.recorder != nil {
+			w.recorder.RecordTargetWrite(w.table, len(ops), time.Since(start))
+		}
+	}()
+	err := w.primary.WriteBatch(ctx, ops)
+	<-done
+	return err
+}
+
+// Flush flushes the primary and the shadow, returning the primary's error only.
+func (w *ShadowWriter) Flush(ctx context.Context) error {
+	if err := w.shadow.Flush(ctx); err != nil {
+		w.fail(err)
+	}
+	return w.primary.Flush(ctx)
+}
+
+// fail records a failure of the shadow.
+func (w *ShadowWriter) fail(err error) {
+	if w.recorder != nil {
+		w.recorder.RecordTargetError(w.table)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.failures++
+	if w.firstErr == nil {
+		w.firstErr = err
+	}
+}
+
+// Err returns an error counting the shadow's failed writes and holding the
+// first of them, or nil when every write to the shadow succeeded.
+func (w *ShadowWriter) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.firstErr == nil {
+		return nil
+	}
+	return fmt.Errorf("%d writes to shadow table %s failed, the first with: %w", w.failures, w.table, w.firstErr)
+}
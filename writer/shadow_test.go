@@ -0,0 +1,77 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gurre/ddb-pitr/itemimage"
+)
+
+// shadowCounts records the writes and failures of a shadow table.
+type shadowCounts struct {
+	mu     sync.Mutex
+	items  int
+	errors int
+}
+
+func (c *shadowCounts) RecordTargetWrite(table string, items int, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items += items
+}
+
+func (c *shadowCounts) RecordTargetError(table string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errors++
+}
+
+// TestShadowWriterMirrorsBatches verifies every batch reaches both writers and
+// the shadow's writes are recorded.
+func TestShadowWriterMirrorsBatches(t *testing.T) {
+	primary, shadow := &batchRecorder{}, &batchRecorder{}
+	counts := &shadowCounts{}
+	w := NewShadowWriter(primary, shadow, "orders-shadow", counts)
+
+	ops := []itemimage.Operation{pkOp("a", 1), pkOp("b", 1)}
+	if err := w.WriteBatch(context.Background(), ops); err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+	if describe(primary.batches) != "a1b1" || describe(shadow.batches) != "a1b1" {
+		t.Errorf("expected both writers to get the batch, got %q and %q", describe(primary.batches), describe(shadow.batches))
+	}
+	if counts.items != 2 || w.Err() != nil {
+		t.Errorf("expected 2 shadow items and no error, got %d and %v", counts.items, w.Err())
+	}
+}
+
+// TestShadowWriterIsBestEffort ensures a failing shadow never fails the
+// restore, and that its failures are counted with the first error kept, while
+// the primary's errors are returned as they are.
+func TestShadowWriterIsBestEffort(t *testing.T) {
+	primary := &batchRecorder{}
+	shadow := &batchRecorder{err: errors.New("table not found")}
+	counts := &shadowCounts{}
+	w := NewShadowWriter(primary, shadow, "orders-shadow", counts)
+
+	for range 2 {
+		if err := w.WriteBatch(context.Background(), []itemimage.Operation{pkOp("a", 1)}); err != nil {
+			t.Fatalf("expected the shadow's failure not to fail the batch, got %v", err)
+		}
+	}
+	if counts.errors != 2 {
+		t.Errorf("expected 2 shadow errors, got %d", counts.errors)
+	}
+	if err := w.Err(); err == nil || !strings.Contains(err.Error(), "2 writes to shadow table orders-shadow failed") || !strings.Contains(err.Error(), "table not found") {
+		t.Errorf("unexpected shadow error: %v", err)
+	}
+
+	primary.err = errors.New("throttled")
+	if err := w.WriteBatch(context.Background(), []itemimage.Operation{pkOp("b", 1)}); err == nil || err.Error() != "throttled" {
+		t.Errorf("expected the primary's error, got %v", err)
+	}
+}
@@ -7,13 +7,20 @@ import (
 	"errors"
 	"fmt"
 	"math/rand/v2"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
 	"github.com/gurre/ddb-pitr/aws"
+	"github.com/gurre/ddb-pitr/clock"
+	"github.com/gurre/ddb-pitr/deadletter"
 	"github.com/gurre/ddb-pitr/itemimage"
+	"golang.org/x/sync/errgroup"
 )
 
 // Writer interface as defined in section 4.6 of the spec.
@@ -26,20 +33,139 @@ type Writer interface {
 // DynamoDBWriter implements the Writer interface using AWS DynamoDB as specified in section 4.6.
 // It handles batching operations and retrying with exponential backoff.
 type DynamoDBWriter struct {
-	client    aws.DynamoDBClient
-	tableName string
-	batchSize int // Maximum number of operations per batch (≤25)
+	client            aws.DynamoDBClient
+	deadLetter        DeadLetterSink                            // Receives operations rejected with permanent errors; nil fails the batch
+	capacity          CapacityRecorder                          // Receives the capacity consumed by each request; nil does not request it
+	conditionValues   types.ReturnValuesOnConditionCheckFailure // Item returned by a failed condition check; empty returns none
+	clock             clock.Clock                               // Time source for retry backoff
+	unchanged         *unchangedFilter                          // Skips puts of items the table already holds; nil writes every put
+	unprocessedLimit  int                                       // Retries without progress before unprocessed items are given up; 0 retries indefinitely
+	unprocessedRec    UnprocessedRecorder                       // Receives the items given up; may be nil
+	collections       *collectionTracker                        // Sizes and full item collections of a table with LSIs; nil tracks none
+	tableName         string
+	batchSize         int // Maximum number of operations per batch (≤25)
+	updateParallelism int // Maximum concurrent UpdateItem calls per batch
 }
 
-// NewDynamoDBWriter creates a new DynamoDBWriter instance with the specified batch size
-func NewDynamoDBWriter(client aws.DynamoDBClient, tableName string, batchSize int) *DynamoDBWriter {
-	return &DynamoDBWriter{
-		client:    client,
-		tableName: tableName,
-		batchSize: batchSize,
+// DeadLetterSink receives operations that DynamoDB rejected with a permanent error.
+type DeadLetterSink interface {
+	Write(ctx context.Context, rec deadletter.Record) error
+}
+
+// CapacityRecorder receives the write capacity units a request consumed on a table
+// and on each of its secondary indexes, keyed by index name.
+type CapacityRecorder interface {
+	RecordConsumedCapacity(table string, units float64, indexes map[string]float64)
+}
+
+// UnprocessedRecorder receives the items of a table that DynamoDB kept
+// returning unprocessed until the writer gave up on them.
+type UnprocessedRecorder interface {
+	RecordUnprocessedLimit(table string, items int)
+}
+
+// Option configures optional DynamoDBWriter behavior.
+type Option func(*DynamoDBWriter)
+
+// WithUpdateParallelism sets how many UpdateItem calls a single WriteBatch may have
+// in flight. Updates to the same key are still applied sequentially in batch order.
+// Example:
+//
+//	w := writer.NewDynamoDBWriter(client, "my-table", 25, writer.WithUpdateParallelism(8))
+func WithUpdateParallelism(n int) Option {
+	return func(w *DynamoDBWriter) {
+		if n > 0 {
+			w.updateParallelism = n
+		}
+	}
+}
+
+// WithDeadLetter routes operations rejected with permanent errors to sink instead of
+// failing the batch. Without a sink, permanent errors fail immediately without retries.
+// Example:
+//
+//	sink, _ := deadletter.NewFileSink("file:///var/tmp/restore.deadletter.jsonl")
+//	w := writer.NewDynamoDBWriter(client, "my-table", 25, writer.WithDeadLetter(sink))
+func WithDeadLetter(sink DeadLetterSink) Option {
+	return func(w *DynamoDBWriter) {
+		w.deadLetter = sink
+	}
+}
+
+// WithCapacityRecorder asks DynamoDB to return the capacity consumed by every
+// BatchWriteItem and UpdateItem call, retries included, and records it in rec.
+// Example:
+//
+//	m := metrics.NewMetrics()
+//	w := writer.NewDynamoDBWriter(client, "my-table", 25, writer.WithCapacityRecorder(m))
+func WithCapacityRecorder(rec CapacityRecorder) Option {
+	return func(w *DynamoDBWriter) {
+		w.capacity = rec
+	}
+}
+
+// WithReturnValuesOnConditionCheckFailure asks DynamoDB to return the item as
+// stored when an UpdateItem fails its condition check. The item is carried by the
+// ConditionalCheckFailedException and kept in dead-letter records for triage.
+// Example:
+//
+//	w := writer.NewDynamoDBWriter(client, "my-table", 25,
+//	    writer.WithDeadLetter(sink),
+//	    writer.WithReturnValuesOnConditionCheckFailure(types.ReturnValuesOnConditionCheckFailureAllOld),
+//	)
+func WithReturnValuesOnConditionCheckFailure(v types.ReturnValuesOnConditionCheckFailure) Option {
+	return func(w *DynamoDBWriter) {
+		w.conditionValues = v
+	}
+}
+
+// WithUnprocessedLimit gives up on the items DynamoDB returns as unprocessed
+// once retries consecutive retries of a BatchWriteItem request left as many
+// unprocessed as before, rather than retrying them indefinitely. Items that
+// never get processed, e.g. because their item collection in a table with a
+// local secondary index is full, are then dead-lettered with ErrUnprocessed,
+// or fail the batch without a dead-letter sink, and are counted in rec, which
+// may be nil. The same limit ends the reads of WithSkipUnchanged, whose puts
+// left unread are then written.
+// Example:
+//
+//	w := writer.NewDynamoDBWriter(client, "my-table", 25, writer.WithDeadLetter(sink), writer.WithUnprocessedLimit(20, m))
+func WithUnprocessedLimit(retries int, rec UnprocessedRecorder) Option {
+	return func(w *DynamoDBWriter) {
+		w.unprocessedLimit = retries
+		w.unprocessedRec = rec
 	}
 }
 
+// WithClock sets the time source used for retry backoff. Tests pass a
+// clock.Fake to drive retries without sleeping.
+// Example:
+//
+//	w := writer.NewDynamoDBWriter(client, "my-table", 25, writer.WithClock(clock.NewFake(time.Now())))
+func WithClock(c clock.Clock) Option {
+	return func(w *DynamoDBWriter) {
+		w.clock = c
+	}
+}
+
+// NewDynamoDBWriter creates a new DynamoDBWriter instance with the specified batch size.
+// Example:
+//
+//	w := writer.NewDynamoDBWriter(client, "my-table", 25)
+func NewDynamoDBWriter(client aws.DynamoDBClient, tableName string, batchSize int, opts ...Option) *DynamoDBWriter {
+	w := &DynamoDBWriter{
+		client:            client,
+		tableName:         tableName,
+		batchSize:         batchSize,
+		updateParallelism: 1,
+		clock:             clock.Real,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
 // isThrottlingError returns true if the error is a DynamoDB throughput throttling error.
 // These errors indicate temporary capacity constraints and should trigger backoff and retry.
 //
@@ -49,17 +175,126 @@ func NewDynamoDBWriter(client aws.DynamoDBClient, tableName string, batchSize in
 //  3. Account-level service quotas exceeded - per-table limits in on-demand mode
 //  4. On-demand maximum throughput exceeded - configured cost control limits
 //
-// All scenarios return ProvisionedThroughputExceededException or RequestLimitExceeded.
-// These are recoverable by waiting - capacity refills over time.
+// All scenarios return ProvisionedThroughputExceededException or RequestLimitExceeded,
+// which the SDK's retryer classifies as throttles too. These are recoverable by
+// waiting - capacity refills over time.
 func isThrottlingError(err error) bool {
-	var throughputErr *types.ProvisionedThroughputExceededException
-	var requestLimitErr *types.RequestLimitExceeded
-	return errors.As(err, &throughputErr) || errors.As(err, &requestLimitErr)
+	return aws.IsThrottle(err)
+}
+
+// OperationError is returned by WriteBatch when a write fails. It names the
+// operations the failed request carried, by type, key and the export file and
+// offset they were decoded from, so the failure can be traced back to its source.
+// Use errors.As to inspect it; errors.Is still matches ErrPermanent and the
+// underlying DynamoDB error.
+type OperationError struct {
+	Ops []itemimage.Operation // Operations of the failed request, in batch order
+	Err error                 // Underlying write error
 }
 
-// backoffWait sleeps for an exponentially increasing duration with jitter.
-// Returns false if the context is cancelled during the wait.
-func backoffWait(ctx context.Context, attempt int) bool {
+// maxDescribedOps caps how many operations an OperationError message lists.
+const maxDescribedOps = 3
+
+// Error lists up to maxDescribedOps of the failed operations and the cause.
+func (e *OperationError) Error() string {
+	var sb strings.Builder
+	if len(e.Ops) == 1 {
+		sb.WriteString(describeOperation(e.Ops[0]))
+	} else {
+		fmt.Fprintf(&sb, "batch of %d operations (", len(e.Ops))
+		for i, op := range e.Ops[:min(len(e.Ops), maxDescribedOps)] {
+			if i > 0 {
+				sb.WriteString("; ")
+			}
+			sb.WriteString(describeOperation(op))
+		}
+		if len(e.Ops) > maxDescribedOps {
+			fmt.Fprintf(&sb, "; and %d more", len(e.Ops)-maxDescribedOps)
+		}
+		sb.WriteByte(')')
+	}
+	sb.WriteString(": ")
+	sb.WriteString(e.Err.Error())
+	return sb.String()
+}
+
+// Unwrap returns the underlying write error.
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// describeOperation formats the type, key and origin of op, e.g.
+// "UPDATE pk=S:42 sk=S:a from data/x.json.gz@1024". Operations of full exports
+// carry no separate key, so their origin identifies them.
+func describeOperation(op itemimage.Operation) string {
+	s := op.Type.String()
+	if len(op.Keys) > 0 {
+		key := strings.TrimSuffix(strings.ReplaceAll(itemimage.KeyFingerprint(op.Keys), "\x00", " "), " ")
+		s += " " + key
+	}
+	if op.SourceFile != "" {
+		s += fmt.Sprintf(" from %s@%d", op.SourceFile, op.ByteOffset)
+	}
+	return s
+}
+
+// operationError wraps err with the operations it failed on. Cancellation is
+// returned as is, since it says nothing about the operations.
+func operationError(ctx context.Context, ops []itemimage.Operation, err error) error {
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return err
+	}
+	return &OperationError{Ops: append([]itemimage.Operation(nil), ops...), Err: err}
+}
+
+// ErrPermanent marks write errors that will not succeed on retry.
+// Callers can test for it with errors.Is.
+var ErrPermanent = errors.New("permanent write error")
+
+// ErrUnprocessed marks items DynamoDB kept returning unprocessed beyond the
+// limit set by WithUnprocessedLimit. It wraps ErrPermanent.
+var ErrUnprocessed = fmt.Errorf("%w: items stayed unprocessed", ErrPermanent)
+
+// unprocessedError carries the requests given up by writeRequests.
+type unprocessedError struct {
+	requests []types.WriteRequest // Requests still unprocessed
+	retries  int                  // Retries without progress made for them
+}
+
+func (e *unprocessedError) Error() string {
+	return fmt.Sprintf("%s: %d after %d retries without progress", ErrUnprocessed, len(e.requests), e.retries)
+}
+
+func (e *unprocessedError) Unwrap() error {
+	return ErrUnprocessed
+}
+
+// permanentErrorCodes lists DynamoDB error codes caused by the request or the
+// target rather than by transient service conditions. Retrying them only wastes time.
+var permanentErrorCodes = map[string]bool{
+	"ValidationException":                      true,
+	"ConditionalCheckFailedException":          true,
+	"ItemCollectionSizeLimitExceededException": true,
+	"AccessDeniedException":                    true,
+	"ResourceNotFoundException":                true,
+	"UnrecognizedClientException":              true,
+	"SerializationException":                   true,
+}
+
+// isPermanentError returns true if err is a DynamoDB error that cannot succeed on retry.
+// Throttling, 5xx and network errors are transient and return false.
+func isPermanentError(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return permanentErrorCodes[apiErr.ErrorCode()]
+	}
+	return false
+}
+
+// backoffWait sleeps for an exponentially increasing duration with jitter,
+// adding it to the BackoffTimer of ctx. Returns false if the context is
+// cancelled during the wait.
+func (w *DynamoDBWriter) backoffWait(ctx context.Context, attempt int) bool {
 	// Base delay 100ms, max delay 30s
 	base := 100 * time.Millisecond
 	maxDelay := 30 * time.Second
@@ -73,8 +308,10 @@ func backoffWait(ctx context.Context, attempt int) bool {
 	jitter := time.Duration(rand.Int64N(int64(delay)))
 	delay = delay + jitter
 
+	start := w.clock.Now()
+	defer func() { backoffTimerOf(ctx).add(w.clock.Now().Sub(start)) }()
 	select {
-	case <-time.After(delay):
+	case <-w.clock.After(delay):
 		return true
 	case <-ctx.Done():
 		return false
@@ -93,8 +330,16 @@ func backoffWait(ctx context.Context, attempt int) bool {
 // Performance notes:
 //   - Batch size of 25 (DynamoDB max) minimizes API calls
 //   - Put/Delete operations are batched; Update operations are individual API calls
+//     issued concurrently up to updateParallelism
 //   - Exponential backoff handles DynamoDB throttling
 func (w *DynamoDBWriter) WriteBatch(ctx context.Context, ops []itemimage.Operation) error {
+	kept, err := w.skipUnchanged(ctx, ops)
+	if err != nil {
+		return operationError(ctx, ops, err)
+	}
+	if ops, err = w.skipFull(ctx, kept); err != nil {
+		return err
+	}
 	if len(ops) == 0 {
 		return nil
 	}
@@ -109,6 +354,8 @@ func (w *DynamoDBWriter) WriteBatch(ctx context.Context, ops []itemimage.Operati
 
 		// Convert operations to DynamoDB requests
 		requests := make([]types.WriteRequest, 0, len(batch))
+		requestOps := make([]itemimage.Operation, 0, len(batch)) // Source op for each request, for dead-lettering
+		var updates []itemimage.Operation
 		for _, op := range batch {
 			switch op.Type {
 			case itemimage.OpPut:
@@ -117,73 +364,198 @@ func (w *DynamoDBWriter) WriteBatch(ctx context.Context, ops []itemimage.Operati
 						Item: op.NewImage,
 					},
 				})
+				requestOps = append(requestOps, op)
 			case itemimage.OpDelete:
 				requests = append(requests, types.WriteRequest{
 					DeleteRequest: &types.DeleteRequest{
 						Key: op.Keys,
 					},
 				})
+				requestOps = append(requestOps, op)
 			case itemimage.OpUpdate:
 				// For updates, we need to use UpdateItem
 				// This is handled separately since it can't be batched
-				if err := w.updateItem(ctx, op); err != nil {
-					return fmt.Errorf("failed to update item: %w", err)
-				}
+				updates = append(updates, op)
 			}
 		}
 
+		if err := w.applyUpdates(ctx, updates); err != nil {
+			return err
+		}
+
 		if len(requests) == 0 {
 			continue
 		}
 
-		// Write the batch
-		input := &dynamodb.BatchWriteItemInput{
-			RequestItems: map[string][]types.WriteRequest{
-				w.tableName: requests,
-			},
-		}
-
-		// Retry with exponential backoff.
-		// Throttling errors retry indefinitely until context is cancelled.
-		// Other errors fail after maxRetries attempts.
-		const maxRetries = 5
-		attempt := 0
-		for {
-			output, err := w.client.BatchWriteItem(ctx, input)
-			if err != nil {
-				if isThrottlingError(err) {
-					// Throttling: wait and retry indefinitely
-					if !backoffWait(ctx, attempt) {
-						return ctx.Err()
-					}
-					attempt++
-					continue
-				}
-				// Non-throttling error: retry up to maxRetries
-				if attempt < maxRetries {
-					if !backoffWait(ctx, attempt) {
-						return ctx.Err()
-					}
-					attempt++
-					continue
-				}
-				return fmt.Errorf("failed to write batch after %d retries: %w", maxRetries, err)
-			}
+		err := w.writeRequests(ctx, requests)
+		var unprocessed *unprocessedError
+		switch {
+		case err == nil:
+			w.collections.added(w.tableName, requestOps)
+		case errors.As(err, &unprocessed):
+			err = w.giveUpUnprocessed(ctx, unprocessed, requests, requestOps)
+		case w.collections != nil && isItemCollectionFull(err):
+			err = w.isolatePermanentFailures(ctx, requests, requestOps)
+		case errors.Is(err, ErrPermanent) && w.deadLetter != nil:
+			err = w.isolatePermanentFailures(ctx, requests, requestOps)
+		default:
+			err = operationError(ctx, requestOps, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeRequests writes one BatchWriteItem request set with retries.
+// Throttling errors and unprocessed items retry indefinitely until the context
+// is cancelled, or for unprocessed items until the limit of
+// WithUnprocessedLimit, and permanent errors return immediately wrapped in
+// ErrPermanent. Other errors are returned as is: the SDK client's retryer has
+// already retried them, and a second retry loop here would multiply its backoff.
+func (w *DynamoDBWriter) writeRequests(ctx context.Context, requests []types.WriteRequest) error {
+	input := &dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]types.WriteRequest{
+			w.tableName: requests,
+		},
+	}
+	if w.capacity != nil {
+		input.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+	}
 
-			// Handle unprocessed items (indicates throttling)
-			if len(output.UnprocessedItems) > 0 {
-				input.RequestItems = output.UnprocessedItems
-				if !backoffWait(ctx, attempt) {
+	attempt := 0
+	pending := len(requests)
+	stuck := 0 // Consecutive responses that left every pending item unprocessed
+	for {
+		output, err := w.client.BatchWriteItem(ctx, input)
+		if err != nil {
+			if isPermanentError(err) {
+				return fmt.Errorf("%w: failed to write batch: %w", ErrPermanent, err)
+			}
+			if isThrottlingError(err) {
+				// Still throttled after the SDK's attempts: wait and retry indefinitely
+				if !w.backoffWait(ctx, attempt) {
 					return ctx.Err()
 				}
 				attempt++
 				continue
 			}
+			return fmt.Errorf("failed to write batch: %w", err)
+		}
+
+		w.recordCapacity(output.ConsumedCapacity...)
+
+		// Handle unprocessed items (indicates throttling)
+		if len(output.UnprocessedItems) > 0 {
+			left := output.UnprocessedItems[w.tableName]
+			if len(left) < pending {
+				stuck = 0
+			} else {
+				stuck++
+			}
+			pending = len(left)
+			if w.unprocessedLimit > 0 && stuck >= w.unprocessedLimit {
+				if w.unprocessedRec != nil {
+					w.unprocessedRec.RecordUnprocessedLimit(w.tableName, len(left))
+				}
+				return &unprocessedError{requests: left, retries: w.unprocessedLimit}
+			}
+			input.RequestItems = output.UnprocessedItems
+			if !w.backoffWait(ctx, attempt) {
+				return ctx.Err()
+			}
+			attempt++
+			continue
+		}
+
+		return nil
+	}
+}
+
+// giveUpUnprocessed dead-letters the operations of the requests writeRequests
+// gave up on, or fails with them without a dead-letter sink. DynamoDB returns
+// the unprocessed requests themselves, so they are matched to the batch's
+// requests to find their operations. When any matches none, which operations
+// were written is unknown, so the batch fails as a whole and nothing is
+// dead-lettered.
+func (w *DynamoDBWriter) giveUpUnprocessed(ctx context.Context, cause *unprocessedError, requests []types.WriteRequest, ops []itemimage.Operation) error {
+	var left []itemimage.Operation
+	matched := make([]bool, len(requests))
+	unmatched := 0
+	for _, req := range cause.requests {
+		found := false
+		for i := range requests {
+			if !matched[i] && reflect.DeepEqual(req, requests[i]) {
+				matched[i] = true
+				left = append(left, ops[i])
+				found = true
+				break
+			}
+		}
+		if !found {
+			unmatched++
+		}
+	}
+	if unmatched > 0 {
+		return operationError(ctx, ops, fmt.Errorf("%d of %d unprocessed requests match no request of the batch: %w",
+			unmatched, len(cause.requests), cause))
+	}
+	if w.deadLetter == nil {
+		return operationError(ctx, left, cause)
+	}
+	for _, op := range left {
+		if err := w.sendToDeadLetter(ctx, op, cause); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-			break
+// isolatePermanentFailures retries each request of a rejected batch on its own so
+// that only the offending operations are dead-lettered, or handled as of a
+// full item collection. A permanent error on a batch does not say which item
+// caused it.
+func (w *DynamoDBWriter) isolatePermanentFailures(ctx context.Context, requests []types.WriteRequest, ops []itemimage.Operation) error {
+	for i, req := range requests {
+		if key, full := w.collections.skipped(ops[i]); full {
+			if err := w.collectionFull(ctx, ops[i], key, ErrItemCollectionFull); err != nil {
+				return err
+			}
+			continue
+		}
+		err := w.writeRequests(ctx, []types.WriteRequest{req})
+		if err == nil {
+			w.collections.added(w.tableName, ops[i:i+1])
+			continue
+		}
+		if w.collections != nil && isItemCollectionFull(err) {
+			if err := w.rejectedByFullCollection(ctx, ops[i], err); err != nil {
+				return err
+			}
+			continue
+		}
+		if !errors.Is(err, ErrPermanent) || w.deadLetter == nil {
+			return operationError(ctx, ops[i:i+1], err)
+		}
+		if err := w.sendToDeadLetter(ctx, ops[i], err); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
+// sendToDeadLetter records op with its cause in the dead-letter sink.
+func (w *DynamoDBWriter) sendToDeadLetter(ctx context.Context, op itemimage.Operation, cause error) error {
+	rec, err := deadletter.NewRecord(op, cause)
+	if err != nil {
+		return fmt.Errorf("failed to build dead-letter record: %w", err)
+	}
+	rec.Table = w.tableName
+	if err := w.deadLetter.Write(ctx, rec); err != nil {
+		return fmt.Errorf("failed to dead-letter %s operation: %w", op.Type, err)
+	}
 	return nil
 }
 
@@ -194,19 +566,112 @@ func (w *DynamoDBWriter) Flush(ctx context.Context) error {
 	return nil
 }
 
+// applyUpdates issues UpdateItem calls for ops with at most updateParallelism in flight.
+// Operations are grouped by primary key so that successive updates to one item keep
+// their export order; distinct items are updated concurrently. Each call keeps its
+// own throttling backoff, and the first failure cancels the remaining updates.
+func (w *DynamoDBWriter) applyUpdates(ctx context.Context, ops []itemimage.Operation) error {
+	if len(ops) == 0 {
+		return nil
+	}
+
+	// Fast path: no concurrency requested or nothing to parallelize
+	if w.updateParallelism <= 1 || len(ops) == 1 {
+		for _, op := range ops {
+			if err := w.applyUpdate(ctx, op); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Group by key, preserving first-seen order of keys and per-key op order
+	groups := make(map[string][]itemimage.Operation, len(ops))
+	order := make([]string, 0, len(ops))
+	for _, op := range ops {
+		k := itemimage.KeyFingerprint(op.Keys)
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], op)
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(w.updateParallelism)
+	for _, k := range order {
+		keyOps := groups[k]
+		g.Go(func() error {
+			for _, op := range keyOps {
+				if err := w.applyUpdate(gctx, op); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// applyUpdate runs a single update, dead-lettering it on a permanent error when a
+// sink is configured.
+func (w *DynamoDBWriter) applyUpdate(ctx context.Context, op itemimage.Operation) error {
+	if key, full := w.collections.skipped(op); full {
+		return w.collectionFull(ctx, op, key, ErrItemCollectionFull)
+	}
+	err := w.updateItem(ctx, op)
+	if err == nil {
+		w.collections.added(w.tableName, []itemimage.Operation{op})
+		return nil
+	}
+	if w.collections != nil && isItemCollectionFull(err) {
+		return w.rejectedByFullCollection(ctx, op, err)
+	}
+	if errors.Is(err, ErrPermanent) && w.deadLetter != nil {
+		return w.sendToDeadLetter(ctx, op, err)
+	}
+	return operationError(ctx, []itemimage.Operation{op}, err)
+}
+
+// DynamoDB expression limits that updateItem must stay within.
+// See https://docs.aws.amazon.com/amazondynamodb/latest/developerguide/ServiceQuotas.html
+const (
+	maxExpressionBytes = 4096 // Maximum length of an UpdateExpression string
+	maxUpdateClauses   = 255  // Conservative cap on SET/REMOVE operands per UpdateItem
+)
+
+// updateClause is a single SET or REMOVE action on one attribute.
+type updateClause struct {
+	value  types.AttributeValue // Value to SET; nil for REMOVE
+	name   string               // Attribute name
+	remove bool                 // True for REMOVE, false for SET
+}
+
 // updateItem is a helper function that handles individual UpdateItem operations
 // as required by section 4.6 for operations that can't be batched.
 // It uses SET for new/modified attributes and REMOVE for deleted attributes.
+//
+// Wide items can produce expressions beyond DynamoDB's 4KB / operand limits, so the
+// clauses are packed into as few UpdateItem calls as the limits allow. Chunks are
+// applied sequentially; the item is only fully updated once every chunk succeeds.
 func (w *DynamoDBWriter) updateItem(ctx context.Context, op itemimage.Operation) error {
-	// Build update expression and attribute maps
-	// Preallocate with estimated capacity based on typical item size
-	setExpr := make([]string, 0, len(op.NewImage))
-	removeExpr := make([]string, 0, len(op.OldImage))
-	values := make(map[string]types.AttributeValue, len(op.NewImage))
-	names := make(map[string]string, len(op.NewImage)+len(op.OldImage))
+	clauses := buildUpdateClauses(op)
+	if len(clauses) == 0 {
+		return nil // No changes to make
+	}
 
-	// Track which attributes are being modified (exist in NewImage)
-	modifiedAttrs := make(map[string]bool, len(op.NewImage))
+	for _, chunk := range chunkUpdateClauses(clauses) {
+		if err := w.sendUpdate(ctx, op.Keys, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildUpdateClauses derives SET clauses from NewImage and REMOVE clauses for
+// attributes only present in OldImage. Key attributes are never modified.
+// Clauses are sorted by attribute name so chunking is deterministic.
+func buildUpdateClauses(op itemimage.Operation) []updateClause {
+	clauses := make([]updateClause, 0, len(op.NewImage)+len(op.OldImage))
 
 	// Process NEW image for SET operations
 	for k, v := range op.NewImage {
@@ -214,28 +679,76 @@ func (w *DynamoDBWriter) updateItem(ctx context.Context, op itemimage.Operation)
 		if _, isKey := op.Keys[k]; isKey {
 			continue
 		}
-		setExpr = append(setExpr, fmt.Sprintf("#%s = :%s", k, k))
-		values[":"+k] = v
-		names["#"+k] = k
-		modifiedAttrs[k] = true
+		clauses = append(clauses, updateClause{name: k, value: v})
 	}
 
 	// Process OLD image for REMOVE operations
 	// Attributes that exist in OldImage but not in NewImage should be removed
 	for k := range op.OldImage {
-		// Skip if this is a key attribute (exists in Keys)
 		if _, isKey := op.Keys[k]; isKey {
 			continue
 		}
-		if !modifiedAttrs[k] {
-			// Attribute exists in OLD but not in NEW - remove it
-			removeExpr = append(removeExpr, fmt.Sprintf("#%s", k))
-			names["#"+k] = k
+		if _, modified := op.NewImage[k]; !modified {
+			clauses = append(clauses, updateClause{name: k, remove: true})
 		}
 	}
 
-	if len(setExpr) == 0 && len(removeExpr) == 0 {
-		return nil // No changes to make
+	sort.Slice(clauses, func(i, j int) bool { return clauses[i].name < clauses[j].name })
+	return clauses
+}
+
+// clauseLength returns the worst-case bytes a clause adds to the update expression,
+// including its separator. Placeholders are synthetic (#n<i>, :v<i>) and i never
+// exceeds maxUpdateClauses, so the length is independent of the attribute name.
+func clauseLength(c updateClause) int {
+	if c.remove {
+		return len("#n254, ")
+	}
+	return len("#n254 = :v254, ")
+}
+
+// chunkUpdateClauses splits clauses so each chunk's expression stays under
+// maxExpressionBytes and maxUpdateClauses. The fixed "SET " and " REMOVE "
+// keywords are reserved up front.
+func chunkUpdateClauses(clauses []updateClause) [][]updateClause {
+	const keywordOverhead = len("SET ") + len(" REMOVE ")
+
+	var chunks [][]updateClause
+	start, size := 0, keywordOverhead
+	for i, c := range clauses {
+		n := clauseLength(c)
+		if i > start && (size+n > maxExpressionBytes || i-start >= maxUpdateClauses) {
+			chunks = append(chunks, clauses[start:i])
+			start, size = i, keywordOverhead
+		}
+		size += n
+	}
+	return append(chunks, clauses[start:])
+}
+
+// sendUpdate issues one UpdateItem call for the given clauses, retrying with
+// exponential backoff. Only names and values referenced by this chunk are sent,
+// since DynamoDB rejects unused expression attributes.
+//
+// Attribute names are never embedded in the expression. Each clause gets a
+// synthetic placeholder (#n0, :v0, #n1, ...) so reserved words, dots, dashes,
+// unicode and names longer than the 255-character placeholder limit all work.
+func (w *DynamoDBWriter) sendUpdate(ctx context.Context, keys map[string]types.AttributeValue, clauses []updateClause) error {
+	setExpr := make([]string, 0, len(clauses))
+	removeExpr := make([]string, 0, len(clauses))
+	values := make(map[string]types.AttributeValue, len(clauses))
+	names := make(map[string]string, len(clauses))
+
+	for i, c := range clauses {
+		namePlaceholder := "#n" + strconv.Itoa(i)
+		names[namePlaceholder] = c.name
+		if c.remove {
+			removeExpr = append(removeExpr, namePlaceholder)
+			continue
+		}
+		valuePlaceholder := ":v" + strconv.Itoa(i)
+		setExpr = append(setExpr, namePlaceholder+" = "+valuePlaceholder)
+		values[valuePlaceholder] = c.value
 	}
 
 	// Build the final update expression combining SET and REMOVE clauses
@@ -252,7 +765,7 @@ func (w *DynamoDBWriter) updateItem(ctx context.Context, op itemimage.Operation)
 
 	input := &dynamodb.UpdateItemInput{
 		TableName:                &w.tableName,
-		Key:                      op.Keys,
+		Key:                      keys,
 		UpdateExpression:         &updateExpr,
 		ExpressionAttributeNames: names,
 	}
@@ -261,34 +774,77 @@ func (w *DynamoDBWriter) updateItem(ctx context.Context, op itemimage.Operation)
 	if len(values) > 0 {
 		input.ExpressionAttributeValues = values
 	}
+	if w.capacity != nil {
+		input.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+	}
+	input.ReturnValuesOnConditionCheckFailure = w.conditionValues
 
-	// Retry with exponential backoff.
-	// Throttling errors retry indefinitely until context is cancelled.
-	const maxRetries = 5
+	// Throttling errors retry indefinitely until context is cancelled; other
+	// errors were already retried by the SDK client's retryer.
 	attempt := 0
 	for {
-		_, err := w.client.UpdateItem(ctx, input)
+		output, err := w.client.UpdateItem(ctx, input)
 		if err != nil {
-			if isThrottlingError(err) {
-				// Throttling: wait and retry indefinitely
-				if !backoffWait(ctx, attempt) {
-					return ctx.Err()
-				}
-				attempt++
-				continue
+			if isPermanentError(err) {
+				return fmt.Errorf("%w: failed to update item: %w", ErrPermanent, err)
 			}
-			// Non-throttling error: retry up to maxRetries
-			if attempt < maxRetries {
-				if !backoffWait(ctx, attempt) {
+			if isThrottlingError(err) {
+				// Still throttled after the SDK's attempts: wait and retry indefinitely
+				if !w.backoffWait(ctx, attempt) {
 					return ctx.Err()
 				}
 				attempt++
 				continue
 			}
-			return fmt.Errorf("failed to update item after %d retries: %w", maxRetries, err)
+			return fmt.Errorf("failed to update item: %w", err)
+		}
+		if output.ConsumedCapacity != nil {
+			w.recordCapacity(*output.ConsumedCapacity)
 		}
 		break
 	}
 
 	return nil
 }
+
+// recordCapacity passes consumed capacity to the recorder, split into the base
+// table and its indexes. Table is only set when indexes were requested, so the
+// total is used for the base table otherwise.
+func (w *DynamoDBWriter) recordCapacity(consumed ...types.ConsumedCapacity) {
+	if w.capacity == nil {
+		return
+	}
+	for _, cc := range consumed {
+		table := w.tableName
+		if cc.TableName != nil {
+			table = *cc.TableName
+		}
+		units := capacityUnits(cc.CapacityUnits, cc.WriteCapacityUnits)
+		if cc.Table != nil {
+			units = capacityUnits(cc.Table.CapacityUnits, cc.Table.WriteCapacityUnits)
+		}
+		var indexes map[string]float64
+		if n := len(cc.GlobalSecondaryIndexes) + len(cc.LocalSecondaryIndexes); n > 0 {
+			indexes = make(map[string]float64, n)
+			for name, c := range cc.GlobalSecondaryIndexes {
+				indexes[name] = capacityUnits(c.CapacityUnits, c.WriteCapacityUnits)
+			}
+			for name, c := range cc.LocalSecondaryIndexes {
+				indexes[name] = capacityUnits(c.CapacityUnits, c.WriteCapacityUnits)
+			}
+		}
+		w.capacity.RecordConsumedCapacity(table, units, indexes)
+	}
+}
+
+// capacityUnits prefers the write units of a capacity breakdown and falls back to
+// the total units when DynamoDB does not break them out.
+func capacityUnits(total, write *float64) float64 {
+	if write != nil {
+		return *write
+	}
+	if total != nil {
+		return *total
+	}
+	return 0
+}
@@ -2,11 +2,19 @@ package writer
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/gurre/ddb-pitr/clock"
+	"github.com/gurre/ddb-pitr/deadletter"
 	"github.com/gurre/ddb-pitr/itemimage"
 )
 
@@ -131,28 +139,23 @@ func TestWriterHappyPath(t *testing.T) {
 
 	// Verify update expression contains both SET and REMOVE operations
 	if updateInput.UpdateExpression == nil {
-		t.Error("expected update expression")
-	} else {
-		expr := *updateInput.UpdateExpression
-		if !strings.Contains(expr, "name") || !strings.Contains(expr, "age") || !strings.Contains(expr, "email") {
-			t.Errorf("update expression missing expected attributes: %s", expr)
-		}
+		t.Fatal("expected update expression")
+	}
+	expr := *updateInput.UpdateExpression
+	if !strings.Contains(expr, "SET ") || !strings.Contains(expr, "REMOVE ") {
+		t.Errorf("update expression missing SET or REMOVE: %s", expr)
 	}
 
-	// Verify expression attribute values
-	values := updateInput.ExpressionAttributeValues
-	if values == nil {
-		t.Error("expected expression attribute values")
-	} else {
-		if name, ok := values[":name"].(*types.AttributeValueMemberS); !ok || name.Value != "Jane Smith" {
-			t.Error("expected name value 'Jane Smith'")
-		}
-		if age, ok := values[":age"].(*types.AttributeValueMemberN); !ok || age.Value != "26" {
-			t.Error("expected age value '26'")
-		}
-		if email, ok := values[":email"].(*types.AttributeValueMemberS); !ok || email.Value != "jane@example.com" {
-			t.Error("expected email value 'jane@example.com'")
-		}
+	// Verify expression attribute values resolved through the placeholders
+	values := setValuesByName(t, updateInput)
+	if name, ok := values["name"].(*types.AttributeValueMemberS); !ok || name.Value != "Jane Smith" {
+		t.Error("expected name value 'Jane Smith'")
+	}
+	if age, ok := values["age"].(*types.AttributeValueMemberN); !ok || age.Value != "26" {
+		t.Error("expected age value '26'")
+	}
+	if email, ok := values["email"].(*types.AttributeValueMemberS); !ok || email.Value != "jane@example.com" {
+		t.Error("expected email value 'jane@example.com'")
 	}
 }
 
@@ -274,7 +277,7 @@ func TestWriterAllAttributeTypes(t *testing.T) {
 	}
 
 	updateInput := mockClient.updateItems[0]
-	values := updateInput.ExpressionAttributeValues
+	values := setValuesByName(t, updateInput)
 
 	// Verify all attribute types are handled correctly
 	tests := []struct {
@@ -282,15 +285,15 @@ func TestWriterAllAttributeTypes(t *testing.T) {
 		value    types.AttributeValue
 		expected interface{}
 	}{
-		{"Id", values[":Id"], &types.AttributeValueMemberN{Value: "123"}},
-		{"Title", values[":Title"], &types.AttributeValueMemberS{Value: "Bicycle 123"}},
-		{"Price", values[":Price"], &types.AttributeValueMemberN{Value: "500"}},
-		{"Color", values[":Color"], &types.AttributeValueMemberSS{Value: []string{"Red", "Black"}}},
-		{"InStock", values[":InStock"], &types.AttributeValueMemberBOOL{Value: true}},
-		{"QuantityOnHand", values[":QuantityOnHand"], &types.AttributeValueMemberNULL{Value: true}},
-		{"RelatedItems", values[":RelatedItems"], &types.AttributeValueMemberNS{Value: []string{"341", "472", "649"}}},
-		{"Comment", values[":Comment"], &types.AttributeValueMemberS{Value: "This product sells out quickly during the summer"}},
-		{"Safety.Warning", values[":Safety.Warning"], &types.AttributeValueMemberS{Value: "Always wear a helmet"}},
+		{"Id", values["Id"], &types.AttributeValueMemberN{Value: "123"}},
+		{"Title", values["Title"], &types.AttributeValueMemberS{Value: "Bicycle 123"}},
+		{"Price", values["Price"], &types.AttributeValueMemberN{Value: "500"}},
+		{"Color", values["Color"], &types.AttributeValueMemberSS{Value: []string{"Red", "Black"}}},
+		{"InStock", values["InStock"], &types.AttributeValueMemberBOOL{Value: true}},
+		{"QuantityOnHand", values["QuantityOnHand"], &types.AttributeValueMemberNULL{Value: true}},
+		{"RelatedItems", values["RelatedItems"], &types.AttributeValueMemberNS{Value: []string{"341", "472", "649"}}},
+		{"Comment", values["Comment"], &types.AttributeValueMemberS{Value: "This product sells out quickly during the summer"}},
+		{"Safety.Warning", values["Safety.Warning"], &types.AttributeValueMemberS{Value: "Always wear a helmet"}},
 	}
 
 	for _, tt := range tests {
@@ -352,3 +355,697 @@ func TestWriterAllAttributeTypes(t *testing.T) {
 		})
 	}
 }
+
+// TestWriterParallelUpdates verifies updates to distinct items are issued concurrently
+// up to the configured limit, which is what makes NEW_AND_OLD restores faster.
+func TestWriterParallelUpdates(t *testing.T) {
+	client := &concurrentUpdateClient{delay: 20 * time.Millisecond}
+	w := NewDynamoDBWriter(client, "test-table", 25, WithUpdateParallelism(4))
+
+	ops := make([]itemimage.Operation, 0, 12)
+	for i := 0; i < 12; i++ {
+		ops = append(ops, updateOp(fmt.Sprintf("USER#%d", i), fmt.Sprintf("v%d", i)))
+	}
+
+	if err := w.WriteBatch(context.Background(), ops); err != nil {
+		t.Fatalf("failed to write batch: %v", err)
+	}
+
+	if client.maxInFlight != 4 {
+		t.Errorf("expected 4 concurrent updates, got %d", client.maxInFlight)
+	}
+}
+
+// TestWriterParallelUpdatesPreserveKeyOrder verifies successive updates to the same
+// item are not reordered by the parallel updater, so the last image wins.
+func TestWriterParallelUpdatesPreserveKeyOrder(t *testing.T) {
+	client := &concurrentUpdateClient{}
+	w := NewDynamoDBWriter(client, "test-table", 25, WithUpdateParallelism(8))
+
+	ops := []itemimage.Operation{
+		updateOp("USER#1", "first"),
+		updateOp("USER#2", "other"),
+		updateOp("USER#1", "second"),
+		updateOp("USER#1", "third"),
+	}
+
+	if err := w.WriteBatch(context.Background(), ops); err != nil {
+		t.Fatalf("failed to write batch: %v", err)
+	}
+
+	got := strings.Join(client.valuesByKey["USER#1"], ",")
+	if got != "first,second,third" {
+		t.Errorf("expected updates in export order, got %s", got)
+	}
+}
+
+// TestWriterChunksWideItemUpdates verifies an item with hundreds of attributes is
+// split across several UpdateItem calls that each respect DynamoDB's expression limits,
+// instead of failing with a ValidationException.
+func TestWriterChunksWideItemUpdates(t *testing.T) {
+	mockClient := &mockDynamoDBClient{}
+	w := NewDynamoDBWriter(mockClient, "test-table", 25)
+
+	op := updateOp("USER#1", "wide")
+	for i := 0; i < 600; i++ {
+		op.NewImage[fmt.Sprintf("attribute_%04d", i)] = &types.AttributeValueMemberN{Value: "1"}
+		op.OldImage[fmt.Sprintf("legacy_%04d", i)] = &types.AttributeValueMemberN{Value: "1"}
+	}
+
+	if err := w.WriteBatch(context.Background(), []itemimage.Operation{op}); err != nil {
+		t.Fatalf("failed to write batch: %v", err)
+	}
+
+	if len(mockClient.updateItems) < 2 {
+		t.Fatalf("expected the update to be chunked, got %d calls", len(mockClient.updateItems))
+	}
+	total := 0
+	for _, in := range mockClient.updateItems {
+		if len(*in.UpdateExpression) > 4096 {
+			t.Errorf("expression exceeds 4KB: %d bytes", len(*in.UpdateExpression))
+		}
+		if len(in.ExpressionAttributeNames) > 255 {
+			t.Errorf("chunk has %d operands, limit is 255", len(in.ExpressionAttributeNames))
+		}
+		total += len(in.ExpressionAttributeNames)
+	}
+	if total != 1201 {
+		t.Errorf("expected 1201 attributes across chunks, got %d", total)
+	}
+}
+
+// TestWriterChunkOnlySendsReferencedValues verifies each chunk only carries the
+// names/values it references, since DynamoDB rejects unused expression attributes.
+func TestWriterChunkOnlySendsReferencedValues(t *testing.T) {
+	mockClient := &mockDynamoDBClient{}
+	w := NewDynamoDBWriter(mockClient, "test-table", 25)
+
+	op := updateOp("USER#1", "wide")
+	for i := 0; i < 300; i++ {
+		op.NewImage[fmt.Sprintf("attribute_%04d", i)] = &types.AttributeValueMemberN{Value: "1"}
+	}
+
+	if err := w.WriteBatch(context.Background(), []itemimage.Operation{op}); err != nil {
+		t.Fatalf("failed to write batch: %v", err)
+	}
+
+	for _, in := range mockClient.updateItems {
+		for placeholder := range in.ExpressionAttributeValues {
+			if !strings.Contains(*in.UpdateExpression, placeholder) {
+				t.Errorf("value %s not referenced by expression", placeholder)
+			}
+		}
+	}
+}
+
+// TestWriterPlaceholdersHandleAwkwardNames verifies attribute names that are reserved
+// words, contain dots/dashes/unicode, or exceed the 255-character placeholder limit
+// never leak into the expression itself, which would be rejected by DynamoDB.
+func TestWriterPlaceholdersHandleAwkwardNames(t *testing.T) {
+	mockClient := &mockDynamoDBClient{}
+	w := NewDynamoDBWriter(mockClient, "test-table", 25)
+
+	awkward := []string{"status", "Safety.Warning", "first-name", "prénom", "日本語", strings.Repeat("a", 255)}
+	op := updateOp("USER#1", "x")
+	for _, name := range awkward {
+		op.NewImage[name] = &types.AttributeValueMemberS{Value: name}
+	}
+
+	if err := w.WriteBatch(context.Background(), []itemimage.Operation{op}); err != nil {
+		t.Fatalf("failed to write batch: %v", err)
+	}
+
+	in := mockClient.updateItems[0]
+	for _, part := range strings.FieldsFunc(*in.UpdateExpression, func(r rune) bool { return r == ' ' || r == ',' || r == '=' }) {
+		if part == "SET" || part == "REMOVE" {
+			continue
+		}
+		if !strings.HasPrefix(part, "#n") && !strings.HasPrefix(part, ":v") {
+			t.Errorf("unexpected token in expression: %q", part)
+		}
+	}
+	values := setValuesByName(t, in)
+	for _, name := range awkward {
+		if v, ok := values[name].(*types.AttributeValueMemberS); !ok || v.Value != name {
+			t.Errorf("attribute %q not set correctly", name)
+		}
+	}
+}
+
+// setValuesByName resolves the SET clauses of an UpdateItem input into a map of
+// attribute name to value through the expression placeholders.
+func setValuesByName(t *testing.T, in *dynamodb.UpdateItemInput) map[string]types.AttributeValue {
+	t.Helper()
+	expr := *in.UpdateExpression
+	if idx := strings.Index(expr, " REMOVE "); idx != -1 {
+		expr = expr[:idx]
+	}
+	expr = strings.TrimPrefix(expr, "SET ")
+
+	out := make(map[string]types.AttributeValue)
+	for _, assignment := range strings.Split(expr, ", ") {
+		parts := strings.Split(assignment, " = ")
+		if len(parts) != 2 {
+			continue
+		}
+		out[in.ExpressionAttributeNames[parts[0]]] = in.ExpressionAttributeValues[parts[1]]
+	}
+	return out
+}
+
+func updateOp(pk, name string) itemimage.Operation {
+	return itemimage.Operation{
+		Type: itemimage.OpUpdate,
+		Keys: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: pk},
+		},
+		OldImage: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: pk},
+		},
+		NewImage: map[string]types.AttributeValue{
+			"PK":   &types.AttributeValueMemberS{Value: pk},
+			"name": &types.AttributeValueMemberS{Value: name},
+		},
+	}
+}
+
+// concurrentUpdateClient records UpdateItem concurrency and per-key value order.
+type concurrentUpdateClient struct {
+	mockDynamoDBClient
+	valuesByKey map[string][]string
+	delay       time.Duration
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (c *concurrentUpdateClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	c.mu.Lock()
+	c.inFlight++
+	if c.inFlight > c.maxInFlight {
+		c.maxInFlight = c.inFlight
+	}
+	c.mu.Unlock()
+
+	time.Sleep(c.delay)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+	if c.valuesByKey == nil {
+		c.valuesByKey = make(map[string][]string)
+	}
+	pk := params.Key["PK"].(*types.AttributeValueMemberS).Value
+	for _, v := range params.ExpressionAttributeValues {
+		if s, ok := v.(*types.AttributeValueMemberS); ok {
+			c.valuesByKey[pk] = append(c.valuesByKey[pk], s.Value)
+		}
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+// rejectingClient fails any request touching the item with PK "bad" with a
+// ValidationException and counts calls, to verify classification and isolation.
+type rejectingClient struct {
+	mockDynamoDBClient
+	batchCalls  int
+	updateCalls int
+}
+
+func (m *rejectingClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	m.batchCalls++
+	for _, requests := range params.RequestItems {
+		for _, req := range requests {
+			if req.PutRequest != nil && isBadKey(req.PutRequest.Item) {
+				return nil, &smithy.GenericAPIError{Code: "ValidationException", Message: "item too large"}
+			}
+		}
+	}
+	return m.mockDynamoDBClient.BatchWriteItem(ctx, params, optFns...)
+}
+
+func (m *rejectingClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.updateCalls++
+	if isBadKey(params.Key) {
+		err := &types.ConditionalCheckFailedException{Message: ptr("condition failed")}
+		if params.ReturnValuesOnConditionCheckFailure == types.ReturnValuesOnConditionCheckFailureAllOld {
+			err.Item = map[string]types.AttributeValue{"PK": params.Key["PK"], "stored": &types.AttributeValueMemberS{Value: "y"}}
+		}
+		return nil, err
+	}
+	return m.mockDynamoDBClient.UpdateItem(ctx, params, optFns...)
+}
+
+func isBadKey(item map[string]types.AttributeValue) bool {
+	pk, ok := item["PK"].(*types.AttributeValueMemberS)
+	return ok && pk.Value == "bad"
+}
+
+func ptr(s string) *string { return &s }
+
+func putOp(pk string) itemimage.Operation {
+	return itemimage.Operation{
+		Type:     itemimage.OpPut,
+		Keys:     map[string]types.AttributeValue{"PK": &types.AttributeValueMemberS{Value: pk}},
+		NewImage: map[string]types.AttributeValue{"PK": &types.AttributeValueMemberS{Value: pk}},
+	}
+}
+
+// TestWriterPermanentErrorNotRetried ensures that a permanent error fails the batch
+// on the first attempt instead of going through the transient retry loop.
+func TestWriterPermanentErrorNotRetried(t *testing.T) {
+	client := &rejectingClient{}
+	w := NewDynamoDBWriter(client, "test-table", 25)
+
+	err := w.WriteBatch(context.Background(), []itemimage.Operation{putOp("good"), putOp("bad")})
+	if !errors.Is(err, ErrPermanent) {
+		t.Fatalf("expected ErrPermanent, got %v", err)
+	}
+	if client.batchCalls != 1 {
+		t.Errorf("expected 1 BatchWriteItem call, got %d", client.batchCalls)
+	}
+}
+
+// TestWriterDeadLettersRejectedPut verifies that with a sink configured only the
+// rejected item is dead-lettered and the rest of the batch is still written.
+func TestWriterDeadLettersRejectedPut(t *testing.T) {
+	client := &rejectingClient{}
+	sink := deadletter.NewMemorySink()
+	w := NewDynamoDBWriter(client, "test-table", 25, WithDeadLetter(sink))
+
+	err := w.WriteBatch(context.Background(), []itemimage.Operation{putOp("a"), putOp("bad"), putOp("b")})
+	if err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+
+	records := sink.Records()
+	if len(records) != 1 {
+		t.Fatalf("expected 1 dead-letter record, got %d", len(records))
+	}
+	if records[0].Operation != "PUT" || records[0].Table != "test-table" || !strings.Contains(records[0].Error, "ValidationException") {
+		t.Errorf("unexpected record: %+v", records[0])
+	}
+	if !strings.Contains(string(records[0].Keys), `"bad"`) {
+		t.Errorf("expected keys to identify the bad item, got %s", records[0].Keys)
+	}
+	if len(client.batches) != 2 {
+		t.Errorf("expected the two good items to be written, got %d writes", len(client.batches))
+	}
+}
+
+// stuckClient returns the requests for the keys in stuck as unprocessed on
+// every call, as for items whose item collection is full, and writes the rest.
+// The requests in foreign are returned as unprocessed too, though never sent.
+type stuckClient struct {
+	mockDynamoDBClient
+	stuck   map[string]bool
+	foreign []types.WriteRequest
+	calls   int
+}
+
+func (c *stuckClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	c.calls++
+	out := &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]types.WriteRequest{}}
+	for table, requests := range params.RequestItems {
+		var written []types.WriteRequest
+		for _, req := range requests {
+			if pk := req.PutRequest.Item["PK"].(*types.AttributeValueMemberS).Value; c.stuck[pk] {
+				out.UnprocessedItems[table] = append(out.UnprocessedItems[table], req)
+			} else {
+				written = append(written, req)
+			}
+		}
+		c.batches = append(c.batches, written)
+		if len(c.foreign) > 0 {
+			out.UnprocessedItems[table] = append(out.UnprocessedItems[table], c.foreign...)
+		}
+	}
+	if len(out.UnprocessedItems) == 0 {
+		out.UnprocessedItems = nil
+	}
+	return out, nil
+}
+
+// unprocessedCounter counts the items given up per table.
+type unprocessedCounter map[string]int
+
+func (c unprocessedCounter) RecordUnprocessedLimit(table string, items int) {
+	c[table] += items
+}
+
+// TestWriterGivesUpUnprocessedItems verifies items DynamoDB keeps returning
+// unprocessed are given up after the configured retries without progress:
+// dead-lettered with ErrUnprocessed and counted when a sink is configured, and
+// failing the batch, naming them, when not.
+func TestWriterGivesUpUnprocessedItems(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	write := func(w *DynamoDBWriter) error {
+		done := make(chan error, 1)
+		go func() {
+			done <- w.WriteBatch(context.Background(), []itemimage.Operation{putOp("a"), putOp("full"), putOp("b")})
+		}()
+		// Two retries without progress, then the third response gives up
+		for range 2 {
+			clk.BlockUntil(1)
+			clk.Advance(time.Minute)
+		}
+		return <-done
+	}
+
+	client := &stuckClient{stuck: map[string]bool{"full": true}}
+	sink := deadletter.NewMemorySink()
+	counts := unprocessedCounter{}
+	w := NewDynamoDBWriter(client, "test-table", 25, WithClock(clk), WithDeadLetter(sink), WithUnprocessedLimit(2, counts))
+	if err := write(w); err != nil {
+		t.Fatalf("expected the stuck item to be dead-lettered, got %v", err)
+	}
+	records := sink.Records()
+	if len(records) != 1 || !strings.Contains(string(records[0].Keys), `"full"`) || !strings.Contains(records[0].Error, "items stayed unprocessed") {
+		t.Fatalf("unexpected dead-letter records: %+v", records)
+	}
+	if client.calls != 3 || counts["test-table"] != 1 {
+		t.Errorf("expected 3 calls and 1 item given up, got %d calls and %v", client.calls, counts)
+	}
+
+	client = &stuckClient{stuck: map[string]bool{"full": true}}
+	w = NewDynamoDBWriter(client, "test-table", 25, WithClock(clk), WithUnprocessedLimit(2, nil))
+	err := write(w)
+	var opErr *OperationError
+	if !errors.Is(err, ErrUnprocessed) || !errors.Is(err, ErrPermanent) || !errors.As(err, &opErr) || len(opErr.Ops) != 1 {
+		t.Fatalf("expected the batch to fail naming the stuck item, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "full") {
+		t.Errorf("expected the error to name the stuck item, got %v", err)
+	}
+}
+
+// TestWriterFailsUnmatchedUnprocessedItems verifies that when unprocessed
+// requests DynamoDB returns match no request of the batch, the batch fails as
+// a whole with nothing dead-lettered, whether none or only some of them match,
+// since which operations were written is then unknown.
+func TestWriterFailsUnmatchedUnprocessedItems(t *testing.T) {
+	ghost := types.WriteRequest{PutRequest: &types.PutRequest{Item: putOp("ghost").NewImage}}
+	for _, tt := range []struct {
+		name  string
+		stuck map[string]bool
+		want  string
+	}{
+		{"no match", nil, "1 of 1 unprocessed requests"},
+		{"partial match", map[string]bool{"full": true}, "1 of 2 unprocessed requests"},
+	} {
+		clk := clock.NewFake(time.Unix(0, 0))
+		client := &stuckClient{stuck: tt.stuck, foreign: []types.WriteRequest{ghost}}
+		sink := deadletter.NewMemorySink()
+		w := NewDynamoDBWriter(client, "test-table", 25, WithClock(clk), WithDeadLetter(sink), WithUnprocessedLimit(2, nil))
+
+		done := make(chan error, 1)
+		go func() {
+			done <- w.WriteBatch(context.Background(), []itemimage.Operation{putOp("a"), putOp("full"), putOp("b")})
+		}()
+		for range 2 {
+			clk.BlockUntil(1)
+			clk.Advance(time.Minute)
+		}
+		err := <-done
+
+		var opErr *OperationError
+		if !errors.Is(err, ErrUnprocessed) || !errors.As(err, &opErr) || len(opErr.Ops) != 3 {
+			t.Fatalf("%s: expected the whole batch to fail, got %v", tt.name, err)
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected %q in %v", tt.name, tt.want, err)
+		}
+		if n := len(sink.Records()); n != 0 {
+			t.Errorf("%s: expected nothing dead-lettered, got %d records", tt.name, n)
+		}
+	}
+}
+
+// TestWriterDeadLettersRejectedUpdate verifies that a conditional check failure on
+// an UpdateItem is dead-lettered once without retries and does not fail the batch.
+func TestWriterDeadLettersRejectedUpdate(t *testing.T) {
+	client := &rejectingClient{}
+	sink := deadletter.NewMemorySink()
+	w := NewDynamoDBWriter(client, "test-table", 25, WithDeadLetter(sink))
+
+	err := w.WriteBatch(context.Background(), []itemimage.Operation{updateOp("bad", "x"), updateOp("good", "x")})
+	if err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+	if client.updateCalls != 2 {
+		t.Errorf("expected 2 UpdateItem calls, got %d", client.updateCalls)
+	}
+	if records := sink.Records(); len(records) != 1 || records[0].Operation != "UPDATE" {
+		t.Errorf("expected 1 UPDATE dead-letter record, got %+v", records)
+	}
+}
+
+// TestWriterErrorNamesOperations verifies that a failed write says which
+// operations failed and where in the export they came from, and still matches
+// ErrPermanent.
+func TestWriterErrorNamesOperations(t *testing.T) {
+	w := NewDynamoDBWriter(&rejectingClient{}, "test-table", 25)
+
+	bad := putOp("bad")
+	bad.SourceFile, bad.ByteOffset = "data/a.json.gz", 512
+	var ops []itemimage.Operation
+	for i := 0; i < 5; i++ {
+		ops = append(ops, putOp(fmt.Sprint(i)))
+	}
+	err := w.WriteBatch(context.Background(), append(ops, bad))
+	var opErr *OperationError
+	if !errors.As(err, &opErr) || !errors.Is(err, ErrPermanent) {
+		t.Fatalf("expected a permanent OperationError, got %v", err)
+	}
+	if len(opErr.Ops) != 6 || opErr.Ops[5].SourceFile != "data/a.json.gz" {
+		t.Errorf("expected the 6 operations of the batch, got %+v", opErr.Ops)
+	}
+	if msg := err.Error(); !strings.HasPrefix(msg, "batch of 6 operations (PUT PK=S:0; PUT PK=S:1; PUT PK=S:2; and 3 more): ") {
+		t.Errorf("unexpected message %q", msg)
+	}
+
+	err = w.WriteBatch(context.Background(), []itemimage.Operation{withSource(updateOp("bad", "x"), "data/b.json.gz", 0)})
+	if !errors.As(err, &opErr) || !strings.HasPrefix(err.Error(), "UPDATE PK=S:bad from data/b.json.gz@0: ") {
+		t.Errorf("unexpected update error %v", err)
+	}
+}
+
+// TestWriterDeadLetterKeepsConditionContext verifies that dead-letter records
+// carry the operation's origin and, when requested, the item as stored.
+func TestWriterDeadLetterKeepsConditionContext(t *testing.T) {
+	sink := deadletter.NewMemorySink()
+	w := NewDynamoDBWriter(&rejectingClient{}, "test-table", 25, WithDeadLetter(sink),
+		WithReturnValuesOnConditionCheckFailure(types.ReturnValuesOnConditionCheckFailureAllOld))
+
+	err := w.WriteBatch(context.Background(), []itemimage.Operation{withSource(updateOp("bad", "x"), "data/b.json.gz", 2048)})
+	if err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+	records := sink.Records()
+	if len(records) != 1 {
+		t.Fatalf("expected 1 dead-letter record, got %d", len(records))
+	}
+	rec := records[0]
+	if rec.SourceFile != "data/b.json.gz" || rec.ByteOffset != 2048 {
+		t.Errorf("expected the origin in the record, got %s@%d", rec.SourceFile, rec.ByteOffset)
+	}
+	if !strings.Contains(string(rec.CurrentImage), `"stored"`) {
+		t.Errorf("expected the stored item in the record, got %s", rec.CurrentImage)
+	}
+}
+
+func withSource(op itemimage.Operation, file string, offset int64) itemimage.Operation {
+	op.SourceFile, op.ByteOffset = file, offset
+	return op
+}
+
+// TestIsPermanentError documents which errors skip retries.
+func TestIsPermanentError(t *testing.T) {
+	permanent := []error{
+		&smithy.GenericAPIError{Code: "ValidationException"},
+		&smithy.GenericAPIError{Code: "AccessDeniedException"},
+		&types.ConditionalCheckFailedException{},
+		&types.ItemCollectionSizeLimitExceededException{},
+	}
+	for _, err := range permanent {
+		if !isPermanentError(fmt.Errorf("wrapped: %w", err)) {
+			t.Errorf("expected %T %v to be permanent", err, err)
+		}
+	}
+
+	transient := []error{
+		&types.ProvisionedThroughputExceededException{},
+		&smithy.GenericAPIError{Code: "InternalServerError"},
+		errors.New("connection reset"),
+	}
+	for _, err := range transient {
+		if isPermanentError(err) {
+			t.Errorf("expected %v to be transient", err)
+		}
+	}
+}
+
+// capacityClient returns the capacity DynamoDB reports when asked for INDEXES.
+type capacityClient struct {
+	mockDynamoDBClient
+	requested []types.ReturnConsumedCapacity
+}
+
+func (c *capacityClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	c.requested = append(c.requested, params.ReturnConsumedCapacity)
+	return &dynamodb.BatchWriteItemOutput{ConsumedCapacity: []types.ConsumedCapacity{{
+		TableName:              awssdk.String("test-table"),
+		CapacityUnits:          awssdk.Float64(4),
+		Table:                  &types.Capacity{CapacityUnits: awssdk.Float64(2)},
+		GlobalSecondaryIndexes: map[string]types.Capacity{"gsi": {CapacityUnits: awssdk.Float64(2)}},
+	}}}, nil
+}
+
+func (c *capacityClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	c.requested = append(c.requested, params.ReturnConsumedCapacity)
+	return &dynamodb.UpdateItemOutput{ConsumedCapacity: &types.ConsumedCapacity{
+		TableName:             awssdk.String("test-table"),
+		CapacityUnits:         awssdk.Float64(3),
+		Table:                 &types.Capacity{CapacityUnits: awssdk.Float64(1)},
+		LocalSecondaryIndexes: map[string]types.Capacity{"lsi": {CapacityUnits: awssdk.Float64(2)}},
+	}}, nil
+}
+
+// capacityRecord is one call to RecordConsumedCapacity.
+type capacityRecord struct {
+	table   string
+	units   float64
+	indexes map[string]float64
+}
+
+type recordingCapacity struct {
+	mu      sync.Mutex
+	records []capacityRecord
+}
+
+func (r *recordingCapacity) RecordConsumedCapacity(table string, units float64, indexes map[string]float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, capacityRecord{table, units, indexes})
+}
+
+// TestWriterRecordsConsumedCapacity verifies that with a recorder every call asks
+// for per-index capacity and reports the base table apart from its indexes, and
+// that without one the requests are left unchanged.
+func TestWriterRecordsConsumedCapacity(t *testing.T) {
+	ops := []itemimage.Operation{putOp("a"), updateOp("b", "x")}
+
+	client := &capacityClient{}
+	rec := &recordingCapacity{}
+	w := NewDynamoDBWriter(client, "test-table", 25, WithCapacityRecorder(rec))
+	if err := w.WriteBatch(context.Background(), ops); err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+	for _, r := range client.requested {
+		if r != types.ReturnConsumedCapacityIndexes {
+			t.Errorf("expected INDEXES to be requested, got %q", r)
+		}
+	}
+	if len(rec.records) != 2 {
+		t.Fatalf("expected 2 capacity records, got %+v", rec.records)
+	}
+	update, batch := rec.records[0], rec.records[1] // Updates are applied first
+	if update.table != "test-table" || update.units != 1 || update.indexes["lsi"] != 2 {
+		t.Errorf("unexpected update capacity %+v", update)
+	}
+	if batch.table != "test-table" || batch.units != 2 || batch.indexes["gsi"] != 2 {
+		t.Errorf("unexpected batch capacity %+v", batch)
+	}
+
+	plain := &capacityClient{}
+	if err := NewDynamoDBWriter(plain, "test-table", 25).WriteBatch(context.Background(), ops); err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+	for _, r := range plain.requested {
+		if r != "" {
+			t.Errorf("expected no capacity to be requested without a recorder, got %q", r)
+		}
+	}
+}
+
+// throttlingClient rejects its first n BatchWriteItem calls, n being throttles,
+// with err, or a throttling error when err is nil.
+type throttlingClient struct {
+	mockDynamoDBClient
+	throttles int
+	err       error
+	calls     int
+}
+
+func (c *throttlingClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	c.calls++
+	if c.calls <= c.throttles {
+		if c.err != nil {
+			return nil, c.err
+		}
+		return nil, &types.ProvisionedThroughputExceededException{Message: ptr("slow down")}
+	}
+	return c.mockDynamoDBClient.BatchWriteItem(ctx, params, optFns...)
+}
+
+// TestWriterBackoffUsesClock verifies that throttled writes wait on the injected
+// clock: nothing is retried until the clock advances past the backoff, and a
+// cancelled context ends the wait.
+func TestWriterBackoffUsesClock(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	client := &throttlingClient{throttles: 2}
+	w := NewDynamoDBWriter(client, "test-table", 25, WithClock(clk))
+
+	done := make(chan error, 1)
+	go func() { done <- w.WriteBatch(context.Background(), []itemimage.Operation{putOp("a")}) }()
+
+	// Attempt 0 waits at most 200ms and attempt 1 at most 400ms, jitter included
+	clk.BlockUntil(1)
+	clk.Advance(200 * time.Millisecond)
+	clk.BlockUntil(1)
+	clk.Advance(400 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+	if client.calls != 3 || len(client.batches) != 1 {
+		t.Errorf("expected 3 calls and 1 write, got %d calls and %d writes", client.calls, len(client.batches))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client = &throttlingClient{throttles: 1}
+	w = NewDynamoDBWriter(client, "test-table", 25, WithClock(clk))
+	go func() { done <- w.WriteBatch(ctx, []itemimage.Operation{putOp("a")}) }()
+	clk.BlockUntil(1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled while backing off, got %v", err)
+	}
+}
+
+// TestWriterLeavesTransientRetriesToSDK verifies that the writer only retries
+// throttling, recognised by error code as the SDK does, and returns other
+// failures at once since the SDK client has already retried them.
+func TestWriterLeavesTransientRetriesToSDK(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	client := &throttlingClient{throttles: 1, err: &smithy.GenericAPIError{Code: "InternalServerError"}}
+	w := NewDynamoDBWriter(client, "test-table", 25, WithClock(clk))
+	if err := w.WriteBatch(context.Background(), []itemimage.Operation{putOp("a")}); err == nil || errors.Is(err, ErrPermanent) {
+		t.Fatalf("expected a transient error, got %v", err)
+	}
+	if client.calls != 1 {
+		t.Errorf("expected 1 call for a transient error, got %d", client.calls)
+	}
+
+	client = &throttlingClient{throttles: 1, err: &smithy.GenericAPIError{Code: "ThrottlingException"}}
+	w = NewDynamoDBWriter(client, "test-table", 25, WithClock(clk))
+	done := make(chan error, 1)
+	go func() { done <- w.WriteBatch(context.Background(), []itemimage.Operation{putOp("a")}) }()
+	clk.BlockUntil(1)
+	clk.Advance(200 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+	if client.calls != 2 {
+		t.Errorf("expected the throttled call to be retried, got %d calls", client.calls)
+	}
+}